@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultAnomalyThreshold is the score dimensions without a --threshold of
+// their own are flagged from, unless --threshold sets another.
+const defaultAnomalyThreshold = 3.5
+
+var (
+	anomalyMethod     string
+	anomalyWindow     int
+	anomalyThreshold  string
+	anomalyDimensions []string
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Compute derived metrics over already scraped data",
+}
+
+var analyzeCDDCmd = &cobra.Command{
+	Use:   "cdd",
+	Short: "Backfill coin days destroyed for stored blocks",
+	Long: `Recompute coin days destroyed for every stored block in the date range.
+Run it after scraping out of order or without --compute-cdd, since a block's
+CDD only counts spent outputs whose creating block is already stored.`,
+	RunE: runAnalyzeCDD,
+}
+
+var analyzeAnomaliesCmd = &cobra.Command{
+	Use:   "anomalies",
+	Short: "Flag blocks that are statistically unusual",
+	Long: `Score every stored block in the date range against the --window blocks before
+it on its transaction count, total fees, fee rate (the fees over the virtual
+size of the block), interval since the block below and OP_RETURN bytes, and
+store those scoring at least the threshold in the block_anomalies table,
+replacing the anomalies of the range found before. --method mad scores the
+distance from the median in median absolute deviations, scaled to match a
+standard deviation, which the outliers of the window don't inflate; zscore
+the distance from the mean in standard deviations. --threshold is a score, a
+score per dimension such as fee_rate=5,interval=8, or both. Blocks with fewer
+stored blocks before them than the window aren't scored, nor dimensions whose
+window doesn't vary, such as OP_RETURN bytes without --profile full. See the
+results with scrapbtc stats anomalies.`,
+	RunE: runAnalyzeAnomalies,
+}
+
+func init() {
+	analyzeAnomaliesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	analyzeAnomaliesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	analyzeAnomaliesCmd.Flags().StringVar(&anomalyMethod, "method", analysis.MethodMAD, "Scoring method: "+strings.Join(analysis.Methods, " or "))
+	analyzeAnomaliesCmd.Flags().IntVar(&anomalyWindow, "window", 2016, "Number of blocks before a block it is scored against")
+	analyzeAnomaliesCmd.Flags().StringVar(&anomalyThreshold, "threshold", strconv.FormatFloat(defaultAnomalyThreshold, 'f', -1, 64), "Absolute score from which a block is flagged, and per dimension overrides such as fee_rate=5")
+	analyzeAnomaliesCmd.Flags().StringSliceVar(&anomalyDimensions, "dimensions", models.AnomalyDimensions, "Dimensions to score")
+	analyzeCDDCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	analyzeCDDCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+
+	analyzeCmd.AddCommand(analyzeCDDCmd)
+	analyzeCmd.AddCommand(analyzeAnomaliesCmd)
+	rootCmd.AddCommand(analyzeCmd)
+}
+
+func runAnalyzeCDD(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	err = analysis.BackfillCDD(database, from, to, func(done, total int) {
+		if done%1000 == 0 || done == total {
+			fmt.Fprintf(os.Stderr, "Computed CDD for %d/%d blocks\n", done, total)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to backfill coin days destroyed: %w", err)
+	}
+	return nil
+}
+
+// parseThresholds parses --threshold into the threshold of each of
+// dimensions: a score for all of them and dimension=score overrides,
+// separated by commas.
+func parseThresholds(spec string, dimensions []string) (map[string]float64, error) {
+	defaults := defaultAnomalyThreshold
+	overrides := make(map[string]float64)
+	for _, part := range strings.Split(spec, ",") {
+		name, value, named := strings.Cut(strings.TrimSpace(part), "=")
+		if !named {
+			name, value = "", name
+		}
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil || score <= 0 {
+			return nil, fmt.Errorf("invalid threshold %q: must be a positive score", part)
+		}
+		switch {
+		case !named:
+			defaults = score
+		case !slices.Contains(models.AnomalyDimensions, name):
+			return nil, fmt.Errorf("invalid threshold %q: unknown dimension %s", part, name)
+		default:
+			overrides[name] = score
+		}
+	}
+
+	thresholds := make(map[string]float64, len(dimensions))
+	for _, d := range dimensions {
+		if !slices.Contains(models.AnomalyDimensions, d) {
+			return nil, fmt.Errorf("invalid dimension %q: must be one of %s", d, strings.Join(models.AnomalyDimensions, ", "))
+		}
+		thresholds[d] = defaults
+		if score, ok := overrides[d]; ok {
+			thresholds[d] = score
+		}
+	}
+	return thresholds, nil
+}
+
+func runAnalyzeAnomalies(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+	thresholds, err := parseThresholds(anomalyThreshold, anomalyDimensions)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	scored, anomalies, err := analysis.FindAnomalies(database, from, to, analysis.AnomalyOptions{
+		Method:     anomalyMethod,
+		Window:     anomalyWindow,
+		Thresholds: thresholds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find anomalies: %w", err)
+	}
+
+	byDimension := make(map[string]int)
+	blocks := make(map[int64]bool)
+	for _, a := range anomalies {
+		byDimension[a.Dimension]++
+		blocks[a.Height] = true
+	}
+	fmt.Printf("Scored %d blocks, %d anomalies in %d blocks\n", scored, len(anomalies), len(blocks))
+	for _, d := range models.AnomalyDimensions {
+		if _, ok := thresholds[d]; ok {
+			fmt.Printf("  %-16s %d\n", d, byDimension[d])
+		}
+	}
+	if len(anomalies) > 0 {
+		fmt.Println("See them with: scrapbtc stats anomalies")
+	}
+	return nil
+}
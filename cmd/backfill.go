@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/ui"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	backfillField     string
+	backfillBatchSize int64
+)
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Recompute a derived field on already scraped blocks",
+	Long: `Recompute a derived field on already scraped blocks without re-scraping them:
+
+  fees         input value and fee from the stored outputs each transaction
+               spends, and the total fees of each block
+  fee-rate     fee rate in sat/vB from the stored fee and virtual size
+  spent-links  link stored outputs to the stored inputs that spend them
+  rbf          RBF signaling from the sequence of the stored inputs
+  segwit       transactions with witness data and witness bytes per block,
+               parsed from the raw_blocks table or fetched from the node
+               with --host/--user/--pass when the block wasn't archived
+  io-heights   block height of inputs and outputs stored before they had one,
+               from their transaction
+  chainwork    work of each block from its bits, and chainwork by adding it
+               to the previous block's; where that isn't stored, chainwork
+               is fetched from the node with --host/--user/--pass, or left
+               unset without a connection
+  prevouts     value and address of inputs from the stored outputs they
+               spend; inputs spending outputs outside the scraped range stay
+               unset, see stats inputs
+  categories   category of each transaction (consolidation, batch, simple or
+               other) from its stored input and output counts
+
+Blocks are processed in height order and progress is saved after every batch,
+so rerunning an interrupted backfill with the same range resumes it.`,
+	RunE: runBackfill,
+}
+
+func init() {
+	backfillCmd.Flags().StringVar(&backfillField, "field", "", "Field to recompute: "+strings.Join(processor.BackfillFields, ", "))
+	backfillCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	backfillCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	backfillCmd.Flags().Int64Var(&backfillBatchSize, "batch-size", 1000, "Number of blocks updated per batch")
+	backfillCmd.Flags().BoolVar(&forceTUI, "tui", false, "Always use the interactive terminal UI")
+	backfillCmd.Flags().BoolVar(&noTUI, "no-tui", false, "Disable the interactive terminal UI and print a status line or plain progress lines")
+	backfillCmd.Flags().StringVar(&progressFormat, "progress-format", "text", "Progress output: text (terminal UI or plain lines) or json (one JSON object per line on stdout)")
+	backfillCmd.Flags().StringVar(&progressStyle, "progress-style", "auto", "Text progress: auto, tui, line (a status line rewritten in place) or plain (a line per message)")
+	backfillCmd.Flags().Float64Var(&failThreshold, "fail-threshold", ui.DefaultFailThreshold, "Percentage of failed blocks above which the terminal UI warns")
+	backfillCmd.Flags().StringSliceVarP(&rpcHosts, "host", "H", []string{"localhost:8332"}, "Bitcoin RPC host and port or URL, for fields that fetch blocks")
+	backfillCmd.Flags().StringVarP(&rpcUser, "user", "u", "", "Bitcoin RPC username")
+	backfillCmd.Flags().StringVarP(&rpcPass, "pass", "p", "", "Bitcoin RPC password")
+	backfillCmd.MarkFlagsMutuallyExclusive("tui", "no-tui", "progress-style")
+	backfillCmd.MarkFlagRequired("field")
+
+	rootCmd.AddCommand(backfillCmd)
+}
+
+func runBackfill(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if err := validateProgressFormat(); err != nil {
+		return err
+	}
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Only segwit usage may need blocks from the node, when their raw block
+	// wasn't archived, and chainwork headers, when the previous block has none
+	var rpcClient *rpc.Client
+	needsNode := backfillField == processor.FieldSegwit || backfillField == processor.FieldChainwork
+	if needsNode {
+		user, pass, err := rpcCredentials()
+		if err != nil {
+			return err
+		}
+		if user != "" && pass != "" {
+			if rpcClient, err = rpc.NewClient(rpcHosts, user, pass, 0, 0, 0); err != nil {
+				return fmt.Errorf("failed to create RPC client: %w", err)
+			}
+			defer rpcClient.Close()
+		}
+	}
+
+	backfiller, err := processor.NewBackfiller(database, rpcClient, backfillField, backfillBatchSize)
+	if err != nil {
+		return err
+	}
+
+	fromHeight, toHeight, err := database.GetHeightRangeByTime(from, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no stored blocks between %s and %s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get height range: %w", err)
+	}
+
+	startHeight, err := backfiller.ResumeHeight(fromHeight, toHeight)
+	if err != nil {
+		return err
+	}
+	if startHeight > toHeight {
+		fmt.Fprintf(infoOut(), "Backfill of %s for blocks %d to %d already completed\n", backfillField, fromHeight, toHeight)
+		return nil
+	}
+	if startHeight > fromHeight {
+		fmt.Fprintf(infoOut(), "Resuming backfill of %s at height %d\n", backfillField, startHeight)
+	}
+	fmt.Fprintf(infoOut(), "Backfilling %s for blocks %d to %d\n", backfillField, fromHeight, toHeight)
+
+	backfillDone := make(chan error, 1)
+	go func() {
+		backfillDone <- backfiller.Run(ctx, fromHeight, toHeight)
+	}()
+
+	uiErr := ui.RunProgressUI(ctx, startHeight, toHeight, toHeight-startHeight+1, dbPath, uiOptions(), backfiller.GetProgressChannel())
+	if err := <-backfillDone; err != nil {
+		fmt.Fprintf(os.Stderr, "Backfill error: %v\n", err)
+		return err
+	}
+	if backfillField == processor.FieldIOHeights {
+		// The backfill drops the height bucket indexes it updates
+		fmt.Fprintln(infoOut(), "Creating indexes...")
+		if err := database.CreateIndexes(); err != nil {
+			return err
+		}
+	}
+	return uiErr
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchSample    int
+	benchFetchers  []int
+	benchFlushRows []int
+	benchProfile   string
+)
+
+// benchNodeShare is the share of the blocks' time spent fetching them above
+// which bench warns that the node sets the pace.
+const benchNodeShare = 0.5
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure scraping speed under several settings and recommend the fastest",
+	Long: `Scrape a sample of recent blocks once for every combination of --fetchers and
+--flush-rows and print the blocks per minute of each, followed by the settings
+to use for this node and disk.
+
+The sample is spread evenly over the last 2016 blocks below the tip. Every
+combination stores it into a fresh in-memory database that is discarded
+afterwards, so --database is never written to and nothing is left on disk.
+A first pass, which isn't measured, warms up the node's caches so the first
+combination doesn't pay for reading the blocks from its disk.
+
+The time each block spent being fetched, parsed and inserted shows what
+limits the speed: when fetching dominates, the node is the bottleneck and a
+closer node or a higher rpcthreads in bitcoin.conf helps more than any of
+these settings.`,
+	RunE: runBench,
+}
+
+func init() {
+	benchCmd.Flags().IntVar(&benchSample, "sample", 50, "Number of recent blocks scraped per combination")
+	benchCmd.Flags().IntSliceVar(&benchFetchers, "fetchers", []int{2, 4, 8, 16}, "Numbers of concurrent block fetchers to try")
+	benchCmd.Flags().IntSliceVar(&benchFlushRows, "flush-rows", []int{10000, processor.DefaultFlushRows, 200000}, "Numbers of rows per batch insert to try")
+	benchCmd.Flags().StringVar(&benchProfile, "profile", string(models.ProfileFull), "Rows stored per block: minimal, standard or full")
+	benchCmd.Flags().StringSliceVarP(&rpcHosts, "host", "H", []string{"localhost:8332"}, "Bitcoin RPC host and port, or an http(s) URL with a path prefix (repeat or comma-separate for multiple nodes)")
+	benchCmd.Flags().StringVarP(&rpcUser, "user", "u", "", "Bitcoin RPC username")
+	benchCmd.Flags().StringVarP(&rpcPass, "pass", "p", "", "Bitcoin RPC password")
+
+	rootCmd.AddCommand(benchCmd)
+}
+
+func runBench(cmd *cobra.Command, args []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if benchSample < 1 {
+		return fmt.Errorf("--sample must be at least 1")
+	}
+	var configs []processor.BenchConfig
+	for _, fetchers := range benchFetchers {
+		for _, rows := range benchFlushRows {
+			if fetchers < 1 || rows < 1 {
+				return fmt.Errorf("--fetchers and --flush-rows must be at least 1")
+			}
+			configs = append(configs, processor.BenchConfig{Fetchers: fetchers, FlushRows: rows})
+		}
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("--fetchers and --flush-rows need at least one value each")
+	}
+	profile, err := models.ParseProfile(benchProfile)
+	if err != nil {
+		return err
+	}
+
+	user, pass, err := rpcCredentials()
+	if err != nil {
+		return err
+	}
+	if user == "" || pass == "" {
+		return fmt.Errorf("Bitcoin RPC credentials are required. Provide via --user/--pass flags or BTC_RPC_USER/BTC_RPC_PASS environment variables, or the config file")
+	}
+	rpcClient, err := rpc.NewClient(rpcHosts, user, pass, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create RPC client: %w", err)
+	}
+	defer rpcClient.Close()
+	fmt.Println(rpcClient.Banner())
+
+	tip, err := rpcClient.GetBestBlockHeight()
+	if err != nil {
+		return fmt.Errorf("failed to get best block height: %w", err)
+	}
+	heights := processor.BenchSample(tip, benchSample, processor.DefaultBenchWindow)
+	opts := processor.Options{Mode: processor.ModeFull, Profile: profile}
+	// Never the --database: every combination starts from an empty
+	// in-memory database, closed and so freed once it's measured
+	open := func() (db.Store, error) {
+		database, err := db.Open(db.DriverDuckDB, db.MemoryPath, false)
+		if err != nil {
+			return nil, err
+		}
+		if err := database.EnableFastInserts(); err != nil {
+			database.Close()
+			return nil, err
+		}
+		return database, nil
+	}
+
+	fmt.Printf("Benchmarking %d combinations on %d blocks between heights %d and %d with the %s profile\n",
+		len(configs), len(heights), heights[0], heights[len(heights)-1], profile)
+	fmt.Println("Warming up the node...")
+	if _, err := processor.Bench(ctx, rpcClient, heights, configs[len(configs)-1:], opts, open, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("%8s %10s %10s %8s %7s %7s %7s\n", "Fetchers", "Flush rows", "Blocks/min", "Failed", "Fetch", "Parse", "Insert")
+	results, err := processor.Bench(ctx, rpcClient, heights, configs, opts, open, func(r processor.BenchResult) {
+		total := max(r.FetchMs+r.ParseMs+r.InsertMs, 1)
+		fmt.Printf("%8d %10d %10.1f %8d %6.0f%% %6.0f%% %6.0f%%\n", r.Fetchers, r.FlushRows, r.BlocksPerMin(), r.Failed,
+			float64(r.FetchMs)/float64(total)*100, float64(r.ParseMs)/float64(total)*100, float64(r.InsertMs)/float64(total)*100)
+	})
+	if err != nil {
+		return err
+	}
+
+	best := processor.FastestBench(results)
+	if best.Completed == 0 {
+		return fmt.Errorf("no block could be scraped, see the failures with the scraper itself")
+	}
+	fmt.Printf("\nFastest: %.1f blocks/min, use --fetchers %d --flush-rows %d\n", best.BlocksPerMin(), best.Fetchers, best.FlushRows)
+	if share := best.FetchShare(); share > benchNodeShare {
+		fmt.Fprintf(os.Stderr, "Warning: The node appears to be the bottleneck: fetching took %.0f%% of the blocks' time. A closer node or a higher rpcthreads in bitcoin.conf helps more than these settings\n", share*100)
+	} else {
+		fmt.Printf("Local parsing and inserts took %.0f%% of the blocks' time, so the CPU and disk set the pace rather than the node\n", (1-share)*100)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/price"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/sink"
+	"scrapbtc/pkg/models"
+
+	"github.com/spf13/cobra"
+)
+
+// registerCompletions adds shell completion for the flags that take one of a
+// fixed set of values or a path, used by the completion command cobra adds
+// to the root. It runs once every command's flags are defined.
+func registerCompletions() {
+	values := func(cmd *cobra.Command, flag string, choices ...string) {
+		mustComplete(cmd.RegisterFlagCompletionFunc(flag, cobra.FixedCompletions(choices, cobra.ShellCompDirectiveNoFileComp)), flag)
+	}
+	values(rootCmd, "db-driver", db.Drivers...)
+	values(rootCmd, "output", "text", "json", "csv")
+	values(rootCmd, "mode", string(processor.ModeFull), string(processor.ModeStats))
+	values(rootCmd, "progress-format", "text", "json")
+	values(rootCmd, "progress-style", "auto", "tui", "line", "plain")
+	values(rootCmd, "schedule", string(processor.ScheduleFIFO), string(processor.ScheduleSize))
+	values(rootCmd, "sink", sink.Formats...)
+	values(rootCmd, "output-format", storeFormats...)
+	values(rootCmd, "price-source", price.Sources...)
+	values(backfillCmd, "progress-format", "text", "json")
+	values(backfillCmd, "progress-style", "auto", "tui", "line", "plain")
+	values(backfillCmd, "field", processor.BackfillFields...)
+	values(headersCmd, "progress-format", "text", "json")
+	values(headersCmd, "progress-style", "auto", "tui", "line", "plain")
+	values(statsBlocksCmd, "granularity", db.GranularityDay, db.GranularityWeek)
+	values(statsFullnessCmd, "granularity", db.GranularityBlock, db.GranularityDay, db.GranularityWeek)
+	values(statsOutputDistCmd, "granularity", db.GranularityAll, db.GranularityBlock, db.GranularityDay, db.GranularityWeek)
+	values(statsMinersCmd, "granularity", db.GranularityDay, db.GranularityWeek)
+	values(statsHashrateCmd, "granularity", db.GranularityDay, db.GranularityWeek)
+	values(statsMempoolCmd, "granularity", db.GranularityHour, db.GranularityDay)
+	values(analyzeAnomaliesCmd, "method", analysis.Methods...)
+	values(analyzeAnomaliesCmd, "dimensions", models.AnomalyDimensions...)
+	values(statsAnomaliesCmd, "dimension", models.AnomalyDimensions...)
+	values(priceOHLCCmd, "granularity", db.GranularityHour, db.GranularityDay, db.GranularityWeek, db.GranularityMonth)
+	values(exportCmd, "format", sink.Formats...)
+
+	mustComplete(rootCmd.MarkPersistentFlagFilename("database"), "database")
+	mustComplete(rootCmd.MarkFlagFilename("heights-file"), "heights-file")
+	mustComplete(rootCmd.MarkFlagFilename("miner-tags-file", "json"), "miner-tags-file")
+	mustComplete(rootCmd.MarkFlagFilename("watch-addresses"), "watch-addresses")
+	mustComplete(rootCmd.MarkFlagDirname("raw-dir"), "raw-dir")
+	mustComplete(rootCmd.MarkFlagDirname("sink-dir"), "sink-dir")
+	mustComplete(rootCmd.MarkFlagDirname("export-on-exit"), "export-on-exit")
+	mustComplete(rootCmd.MarkPersistentFlagDirname("lake-dir"), "lake-dir")
+	mustComplete(verifyCmd.MarkFlagDirname("raw-dir"), "raw-dir")
+	mustComplete(exportCmd.MarkFlagDirname("out"), "out")
+	mustComplete(priceImportCmd.MarkFlagFilename("file", "csv"), "file")
+	mustComplete(labelsImportCmd.MarkFlagFilename("file", "csv"), "file")
+	mustComplete(syncCmd.MarkFlagFilename("source"), "source")
+	mustComplete(syncCmd.MarkFlagFilename("dest"), "dest")
+}
+
+// mustComplete panics if registering the completion of flag failed, which
+// only happens when the flag doesn't exist.
+func mustComplete(err error, flag string) {
+	if err != nil {
+		panic(fmt.Sprintf("completion of --%s: %v", flag, err))
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"scrapbtc/internal/config"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passphraseEnv holds the passphrase of an encrypted RPC password for runs
+// without a terminal to prompt on.
+const passphraseEnv = "SCRAPBTC_PASSPHRASE"
+
+var configUser string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the config file holding the RPC credentials",
+}
+
+var configEncryptPassCmd = &cobra.Command{
+	Use:   "encrypt-pass",
+	Short: "Store the RPC password in the config file, encrypted with a passphrase",
+	Long: `Prompt for the RPC password and a passphrase, and store the password in the
+config file encrypted with AES-256-GCM under a key derived from the passphrase
+with argon2id. A plaintext rpc_pass in the file is removed. Commands needing
+the password then prompt for the passphrase, or read it from
+SCRAPBTC_PASSPHRASE when set. Without a terminal the password is read from
+the first line of stdin.`,
+	Args: cobra.NoArgs,
+	RunE: runConfigEncryptPass,
+}
+
+func init() {
+	configEncryptPassCmd.Flags().StringVarP(&configUser, "user", "u", "", "Also store this RPC username")
+
+	configCmd.AddCommand(configEncryptPassCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigEncryptPass(cmd *cobra.Command, args []string) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	if configUser != "" {
+		cfg.RPCUser = configUser
+	}
+
+	var pass string
+	if stdinIsTerminal() {
+		pass, err = readSecret("RPC password")
+	} else {
+		pass, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		pass = strings.TrimRight(pass, "\r\n")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the RPC password: %w", err)
+	}
+	if pass == "" {
+		return fmt.Errorf("the RPC password can't be empty")
+	}
+
+	phrase := os.Getenv(passphraseEnv)
+	if phrase == "" {
+		if !stdinIsTerminal() {
+			return fmt.Errorf("no passphrase: set %s or run in a terminal", passphraseEnv)
+		}
+		if phrase, err = readSecret("Passphrase"); err != nil {
+			return fmt.Errorf("failed to read the passphrase: %w", err)
+		}
+		confirm, err := readSecret("Repeat the passphrase")
+		if err != nil {
+			return fmt.Errorf("failed to read the passphrase: %w", err)
+		}
+		if confirm != phrase {
+			return fmt.Errorf("the passphrases don't match")
+		}
+	}
+
+	encrypted, err := config.Encrypt(pass, phrase)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the RPC password: %w", err)
+	}
+	cfg.RPCPass = ""
+	cfg.RPCPassEncrypted = encrypted
+	if err := config.Save(path, cfg); err != nil {
+		return err
+	}
+	fmt.Printf("Encrypted RPC password stored in %s\n", path)
+	return nil
+}
+
+// configPath returns the --config path, or the default one.
+func configPath() (string, error) {
+	if configFile != "" {
+		return configFile, nil
+	}
+	return config.DefaultPath()
+}
+
+// loadConfig reads the config file. Unlike the default file, a --config
+// file has to exist.
+func loadConfig() (string, *config.Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", nil, err
+	}
+	if configFile != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", nil, fmt.Errorf("failed to read config: %w", err)
+		}
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, cfg, nil
+}
+
+// passphrase returns the passphrase of an encrypted RPC password from
+// SCRAPBTC_PASSPHRASE, or else prompts for it with prompt.
+func passphrase(prompt string) (string, error) {
+	if phrase := os.Getenv(passphraseEnv); phrase != "" {
+		return phrase, nil
+	}
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("the password is encrypted: set %s or run in a terminal to enter the passphrase", passphraseEnv)
+	}
+	return readSecret(prompt)
+}
+
+// readSecret prompts on stderr and reads a line from the terminal without
+// echoing it.
+func readSecret(prompt string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(secret), err
+}
+
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
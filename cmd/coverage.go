@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// coverageBarWidth is the number of cells of the --bar.
+const coverageBarWidth = 60
+
+var (
+	coverageFrom int64
+	coverageTo   int64
+	coverageBar  bool
+	coverageFill bool
+)
+
+var coverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Show which heights in a range are stored and which are missing",
+	Long: `List the contiguous ranges of completed heights between --from and --to, the
+ranges missing between them and the share of the range that is covered.
+Blocks that failed, were interrupted or have only their header stored are
+missing. --to defaults to the node's tip, or without RPC credentials to the
+highest completed height.
+
+With --bar a bar shows where the gaps are: each cell is a slice of the range,
+full when every block in it is stored, shaded when some are and light when
+none are. With --fill the missing ranges are scraped right away, as with
+--heights and the scraper's default settings.`,
+	RunE: runCoverage,
+}
+
+func init() {
+	coverageCmd.Flags().Int64Var(&coverageFrom, "from", 0, "First height of the range")
+	coverageCmd.Flags().Int64Var(&coverageTo, "to", -1, "Last height of the range (default: the node's tip)")
+	coverageCmd.Flags().BoolVar(&coverageBar, "bar", false, "Draw the coverage as a bar")
+	coverageCmd.Flags().BoolVar(&coverageFill, "fill", false, "Scrape the missing ranges")
+	coverageCmd.Flags().StringSliceVarP(&rpcHosts, "host", "H", []string{"localhost:8332"}, "Bitcoin RPC host and port, or an http(s) URL with a path prefix (repeat or comma-separate for multiple nodes)")
+	coverageCmd.Flags().StringVarP(&rpcUser, "user", "u", "", "Bitcoin RPC username")
+	coverageCmd.Flags().StringVarP(&rpcPass, "pass", "p", "", "Bitcoin RPC password")
+	rootCmd.AddCommand(coverageCmd)
+}
+
+// CoverageReport is the output of the coverage command.
+type CoverageReport struct {
+	From          int64                `json:"from"`
+	To            int64                `json:"to"`
+	Blocks        int64                `json:"blocks"`
+	Covered       int64                `json:"covered"`
+	Percent       float64              `json:"percent"`
+	CoveredRanges []models.HeightRange `json:"covered_ranges"`
+	MissingRanges []models.HeightRange `json:"missing_ranges"`
+}
+
+func runCoverage(cmd *cobra.Command, args []string) error {
+	if coverageFill && outputFormat == "json" {
+		return fmt.Errorf("--fill can't be combined with --output json")
+	}
+	if coverageFill && db.IsRemote(dbPath) {
+		return fmt.Errorf("--fill needs a local --database: %s is remote", dbPath)
+	}
+	database, err := openStatsDB("text", "json")
+	if err != nil {
+		return err
+	}
+	// Closed before --fill opens it again to scrape
+	defer func() {
+		if database != nil {
+			database.Close()
+		}
+	}()
+
+	to, err := coverageEnd(database)
+	if err != nil {
+		return err
+	}
+	if coverageFrom < 0 || to < coverageFrom {
+		return fmt.Errorf("invalid range %d-%d: --from must be between 0 and --to", coverageFrom, to)
+	}
+	covered, err := database.GetCoverage(coverageFrom, to)
+	if err != nil {
+		return fmt.Errorf("failed to get coverage: %w", err)
+	}
+	report := CoverageReport{
+		From:          coverageFrom,
+		To:            to,
+		Blocks:        to - coverageFrom + 1,
+		Covered:       db.CoveredBlocks(covered),
+		CoveredRanges: covered,
+		MissingRanges: db.MissingRanges(coverageFrom, to, covered),
+	}
+	report.Percent = float64(report.Covered) / float64(report.Blocks) * 100
+
+	if outputFormat == "json" {
+		return printJSON(report)
+	}
+	fmt.Printf("Heights %s: %.2f%% covered, %d blocks missing\n",
+		formatHeightRange(models.HeightRange{From: report.From, To: report.To}), report.Percent, report.Blocks-report.Covered)
+	if coverageBar {
+		fmt.Printf("%d [%s] %d\n", report.From, renderCoverageBar(report.From, report.To, covered, coverageBarWidth), report.To)
+	}
+	if len(covered) > 0 {
+		fmt.Println("\nCovered:")
+		for _, r := range covered {
+			fmt.Printf("  %s\n", formatHeightRange(r))
+		}
+	}
+	if len(report.MissingRanges) > 0 {
+		fmt.Println("\nMissing:")
+		for _, r := range report.MissingRanges {
+			fmt.Printf("  %s\n", formatHeightRange(r))
+		}
+	}
+
+	if !coverageFill {
+		return nil
+	}
+	if len(report.MissingRanges) == 0 {
+		fmt.Println("\nNothing to fill")
+		return nil
+	}
+	database.Close()
+	database = nil
+	specs := make([]string, len(report.MissingRanges))
+	for i, r := range report.MissingRanges {
+		specs[i] = fmt.Sprintf("%d-%d", r.From, r.To)
+	}
+	heightsSpec = strings.Join(specs, ",")
+	fmt.Printf("\nFilling %d missing blocks\n", report.Blocks-report.Covered)
+	return runScraper(cmd, nil)
+}
+
+// coverageEnd returns --to, or when it isn't given the node's tip, or the
+// highest completed height without RPC credentials.
+func coverageEnd(database db.Store) (int64, error) {
+	if coverageTo >= 0 {
+		return coverageTo, nil
+	}
+	user, pass, err := rpcCredentials()
+	if err != nil {
+		return 0, err
+	}
+	if user == "" || pass == "" {
+		if coverageFill {
+			return 0, fmt.Errorf("Bitcoin RPC credentials are required for --fill. Provide via --user/--pass flags or BTC_RPC_USER/BTC_RPC_PASS environment variables, or the config file")
+		}
+		fmt.Fprintln(os.Stderr, "No RPC credentials: checking up to the highest completed height instead of the node's tip")
+		return database.GetMaxProcessedHeight()
+	}
+	rpcClient, err := rpc.NewClient(rpcHosts, user, pass, 0, 0, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create RPC client: %w", err)
+	}
+	defer rpcClient.Close()
+	tip, err := rpcClient.GetBestBlockHeight()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get best block height: %w", err)
+	}
+	return tip, nil
+}
+
+// renderCoverageBar draws the heights from-to as width cells: █ when every
+// height in the cell is covered, ▒ when some are and ░ when none are.
+func renderCoverageBar(from, to int64, covered []models.HeightRange, width int) string {
+	span := to - from + 1
+	width = int(min(int64(width), span))
+	var bar strings.Builder
+	i := 0
+	for cell := range int64(width) {
+		start, end := from+cell*span/int64(width), from+(cell+1)*span/int64(width)-1
+		var n int64
+		for i < len(covered) && covered[i].To < start {
+			i++
+		}
+		for j := i; j < len(covered) && covered[j].From <= end; j++ {
+			n += min(covered[j].To, end) - max(covered[j].From, start) + 1
+		}
+		switch {
+		case n == end-start+1:
+			bar.WriteString("█")
+		case n > 0:
+			bar.WriteString("▒")
+		default:
+			bar.WriteString("░")
+		}
+	}
+	return bar.String()
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/ui"
+	"scrapbtc/pkg/models"
+)
+
+// validateByDay rejects the flags that don't make sense for a run that
+// processes whole days.
+func validateByDay(listed bool) error {
+	switch {
+	case listed:
+		return fmt.Errorf("--by-day can't be combined with --heights or --heights-file")
+	case follow:
+		return fmt.Errorf("--by-day can't be combined with --follow")
+	case dryRun:
+		return fmt.Errorf("--by-day can't be combined with --dry-run")
+	}
+	return nil
+}
+
+// planDays resolves the days from --from to --to to their heights and
+// returns them with the blocks of each already stored, and the heights of
+// the days still to process. Days recorded as complete with the same heights
+// are skipped unless --force-reprocess is set, and so are the days whose
+// blocks turn out to be all stored already, which are recorded as complete
+// on the way.
+func planDays(ctx context.Context, database db.Store, rpcClient *rpc.Client) ([]ui.DayStatus, []int64, error) {
+	from, to, err := parseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	tip, err := rpcClient.GetBestBlockHeight()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get best block height: %w", err)
+	}
+
+	fmt.Fprintf(infoOut(), "Resolving the days from %s to %s to block heights...\n",
+		from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	days, err := processor.ResolveDays(ctx, rpcClient, from, to.AddDate(0, 0, -1), tip)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(days) == 0 {
+		return nil, nil, fmt.Errorf("no blocks between %s and %s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	// Only whole days are processed, so with --clamp-pruned the days that
+	// begin below the prune height are left out
+	start, err := checkPruned(rpcClient, days[0].FromHeight)
+	if err != nil {
+		return nil, nil, err
+	}
+	for len(days) > 0 && days[0].FromHeight < start {
+		days = days[1:]
+	}
+	if len(days) == 0 {
+		return nil, nil, fmt.Errorf("the whole range is below the prune height %d of the node", start)
+	}
+
+	complete := make(map[int64]models.DayRange)
+	if !forceReprocess {
+		stored, err := database.GetCompletedDays(from, to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get completed days: %w", err)
+		}
+		for _, d := range stored {
+			complete[d.Day.Unix()] = *d
+		}
+	}
+
+	statuses := make([]ui.DayStatus, 0, len(days))
+	var heights []int64
+	for _, d := range days {
+		if c, ok := complete[d.Day.Unix()]; ok && c == *d {
+			statuses = append(statuses, ui.DayStatus{Range: d, Done: d.Blocks()})
+			continue
+		}
+		var done int64
+		if !forceReprocess {
+			if done, _, err = database.GetStatusCounts(d.FromHeight, d.ToHeight); err != nil {
+				return nil, nil, fmt.Errorf("failed to count the stored blocks of %s: %w", d.Day.Format("2006-01-02"), err)
+			}
+		}
+		if done == d.Blocks() {
+			if err := database.MarkDayComplete(d); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			for h := d.FromHeight; h <= d.ToHeight; h++ {
+				heights = append(heights, h)
+			}
+		}
+		statuses = append(statuses, ui.DayStatus{Range: d, Done: done})
+	}
+	return statuses, heights, nil
+}
+
+// markDaysComplete records the days whose blocks are all stored by now, and
+// returns how many days are complete.
+func markDaysComplete(database db.Store, days []ui.DayStatus) (int, error) {
+	var complete int
+	for _, d := range days {
+		if d.Done == d.Range.Blocks() {
+			complete++
+			continue
+		}
+		done, _, err := database.GetStatusCounts(d.Range.FromHeight, d.Range.ToHeight)
+		if err != nil {
+			return complete, fmt.Errorf("failed to count the stored blocks of %s: %w", d.Range.Day.Format("2006-01-02"), err)
+		}
+		if done < d.Range.Blocks() {
+			continue
+		}
+		if err := database.MarkDayComplete(d.Range); err != nil {
+			return complete, err
+		}
+		complete++
+	}
+	return complete, nil
+}
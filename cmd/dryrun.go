@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"time"
+)
+
+const (
+	dryRunSampleBlocks = 3
+	dryRunAvgTxWindow  = 1000
+)
+
+// DryRunPlan describes the work a scrape would do without performing it.
+type DryRunPlan struct {
+	StartHeight       int64   `json:"start_height"`
+	EndHeight         int64   `json:"end_height"`
+	TotalBlocks       int64   `json:"total_blocks"`
+	BlocksToProcess   int64   `json:"blocks_to_process"`
+	AlreadyCompleted  int64   `json:"already_completed"`
+	PreviouslyFailed  int64   `json:"previously_failed"`
+	AvgTxPerBlock     float64 `json:"avg_tx_per_block"`
+	EstimatedTxs      int64   `json:"estimated_transactions"`
+	SampleBlocks      int     `json:"sample_blocks"`
+	AvgBlockFetchMs   int64   `json:"avg_block_fetch_ms"`
+	Workers           int     `json:"workers"`
+	EstimatedDuration string  `json:"estimated_duration"`
+	EstimatedSeconds  int64   `json:"estimated_seconds"`
+	// Raw block estimates are only set with --store-raw-blocks
+	EstimatedRawBytes           int64 `json:"estimated_raw_bytes,omitempty"`
+	EstimatedRawCompressedBytes int64 `json:"estimated_raw_compressed_bytes,omitempty"`
+}
+
+// sampleStats summarizes the blocks fetched by benchmarkSampleBlocks.
+type sampleStats struct {
+	fetchTime time.Duration
+	txs       int
+	blocks    int
+	// rawBytes and compressedBytes are the serialized size of the blocks
+	// before and after compression, measured with --store-raw-blocks.
+	rawBytes        int64
+	compressedBytes int64
+}
+
+// openDryRunDatabase opens the database read-only, so that neither its
+// tables nor its migrations are created, or returns nil when it doesn't exist
+// yet. A PostgreSQL database is always opened.
+func openDryRunDatabase() (db.Store, error) {
+	if dbDriver == db.DriverPostgres {
+		return openDatabase(true)
+	}
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return openDatabase(true)
+}
+
+// runDryRun prints the plan for scraping [startHeight, endHeight]. database
+// is nil when the database doesn't exist yet, in which case nothing has been
+// processed.
+func runDryRun(ctx context.Context, database db.Store, rpcClient *rpc.Client, startHeight, endHeight int64) error {
+	var completed, failed int64
+	var avgTx float64
+	if database != nil {
+		var err error
+		completed, failed, err = database.GetStatusCounts(startHeight, endHeight)
+		if err != nil {
+			return fmt.Errorf("failed to query processing status: %w", err)
+		}
+		avgTx, err = database.GetAverageTxCount(dryRunAvgTxWindow)
+		if err != nil {
+			return fmt.Errorf("failed to query average transaction count: %w", err)
+		}
+	}
+
+	plan := DryRunPlan{
+		StartHeight:      startHeight,
+		EndHeight:        endHeight,
+		TotalBlocks:      endHeight - startHeight + 1,
+		AlreadyCompleted: completed,
+		PreviouslyFailed: failed,
+		Workers:          workers,
+	}
+	plan.BlocksToProcess = plan.TotalBlocks - completed
+
+	sample, err := benchmarkSampleBlocks(ctx, rpcClient, startHeight, endHeight)
+	if err != nil {
+		return fmt.Errorf("failed to benchmark sample blocks: %w", err)
+	}
+	samples, sampleTime, sampleTxs := sample.blocks, sample.fetchTime, sample.txs
+	plan.SampleBlocks = samples
+
+	// Prefer the locally stored history; fall back to the benchmarked blocks
+	if avgTx == 0 && samples > 0 {
+		avgTx = float64(sampleTxs) / float64(samples)
+	}
+	plan.AvgTxPerBlock = avgTx
+	plan.EstimatedTxs = int64(avgTx * float64(plan.BlocksToProcess))
+
+	if samples > 0 {
+		perBlock := sampleTime / time.Duration(samples)
+		plan.AvgBlockFetchMs = perBlock.Milliseconds()
+
+		parallel := workers
+		if parallel < 1 {
+			parallel = 1
+		}
+		estimate := perBlock * time.Duration(plan.BlocksToProcess) / time.Duration(parallel)
+		plan.EstimatedSeconds = int64(estimate.Seconds())
+		plan.EstimatedDuration = estimate.Truncate(time.Second).String()
+
+		if storeRaw {
+			plan.EstimatedRawBytes = sample.rawBytes * plan.BlocksToProcess / int64(samples)
+			plan.EstimatedRawCompressedBytes = sample.compressedBytes * plan.BlocksToProcess / int64(samples)
+		}
+	}
+
+	if outputFormat == "json" {
+		return printJSON(plan)
+	}
+
+	printDryRunPlan(plan)
+	return nil
+}
+
+// benchmarkSampleBlocks fetches a few blocks spread across the range and
+// returns the total fetch time and transaction count, and with
+// --store-raw-blocks the size of the serialized blocks. Nothing is stored.
+func benchmarkSampleBlocks(ctx context.Context, rpcClient *rpc.Client, startHeight, endHeight int64) (sampleStats, error) {
+	var stats sampleStats
+
+	span := endHeight - startHeight
+	seen := make(map[int64]bool)
+	for i := 0; i < dryRunSampleBlocks; i++ {
+		height := startHeight + span*int64(i)/int64(dryRunSampleBlocks-1)
+		if seen[height] {
+			continue
+		}
+		seen[height] = true
+
+		start := time.Now()
+		hash, err := rpcClient.GetBlockHashByHeight(ctx, height)
+		if err != nil {
+			return stats, err
+		}
+		if storeRaw {
+			raw, err := rpcClient.GetRawBlock(ctx, hash)
+			if err != nil {
+				return stats, err
+			}
+			stats.rawBytes += int64(len(raw))
+			stats.compressedBytes += int64(len(db.CompressRawBlock(raw)))
+		}
+		block, _, err := rpcClient.GetBlockWithTransactions(ctx, hash)
+		if err != nil {
+			return stats, err
+		}
+		stats.fetchTime += time.Since(start)
+		stats.txs += block.TxCount
+		stats.blocks++
+	}
+
+	return stats, nil
+}
+
+func printDryRunPlan(plan DryRunPlan) {
+	fmt.Println("Dry run - no data will be written")
+	fmt.Printf("Height range: %d - %d (%d blocks)\n", plan.StartHeight, plan.EndHeight, plan.TotalBlocks)
+	fmt.Printf("Blocks to process: %d\n", plan.BlocksToProcess)
+	fmt.Printf("Already completed: %d\n", plan.AlreadyCompleted)
+	fmt.Printf("Previously failed: %d\n", plan.PreviouslyFailed)
+	fmt.Printf("Average transactions per block: %.1f\n", plan.AvgTxPerBlock)
+	fmt.Printf("Estimated transactions: %d\n", plan.EstimatedTxs)
+	fmt.Printf("Average block fetch time: %dms (%d sample blocks)\n", plan.AvgBlockFetchMs, plan.SampleBlocks)
+	fmt.Printf("Estimated duration with %d fetchers: %s\n", plan.Workers, plan.EstimatedDuration)
+	if plan.EstimatedRawBytes > 0 {
+		fmt.Printf("Estimated raw block storage: %s compressed (%s uncompressed)\n",
+			formatBytes(plan.EstimatedRawCompressedBytes), formatBytes(plan.EstimatedRawBytes))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/sink"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	heatmapBands []float64
+	exportSince  string
+	exportFormat string
+	exportOut    string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the rows stored since a watermark, or data sets for charting",
+	Long: `With --since and --out, export the rows stored after a watermark for
+incremental ingestion elsewhere: the blocks and transactions processed after
+it and the price points fetched after it, in one file per table in the --out
+directory. The new watermark, the latest of those times, is printed on stdout
+to pass as --since next time; it is --since itself when nothing is newer.
+
+The files are named after both watermarks, such as
+blocks-20240501T000000.000000Z-20240502T093000.250000Z.ndjson, and hold the
+rows ordered by time and then by key, so exporting again from the same
+--since writes the same files unless more rows were stored meanwhile. Every
+table gets a file, empty or not. Deleted rows, such as the blocks of a reorg,
+aren't reported.
+
+Blocks are timestamped in the transaction storing them, so a scrape running
+during an export stores the blocks it hasn't committed yet after the new
+watermark, and the next export picks them up.
+
+The subcommands export data sets shaped for charting in other tools. They are
+written to stdout as long-form CSV, one row per cell, or as JSON with
+--output json.`,
+	Args: cobra.NoArgs,
+	RunE: runExport,
+}
+
+var exportFeeHeatmapCmd = &cobra.Command{
+	Use:   "fee-heatmap",
+	Short: "Export the transactions of each block per fee rate band",
+	Long: `Export the number and virtual size of the non-coinbase transactions of every
+block paying a fee rate in each band, for a fee heatmap of block height by fee
+rate. --bands sets the bounds in sat/vB: the default bands are below 1, 1-2,
+2-5 and so on up to 500 and above, each from its lower bound up to but not
+including the upper one. Every band of every block is written, the empty ones
+too.
+
+Transactions with a zero or unknown fee rate are counted in the unknown band,
+not the lowest one. Fee rates need the input values: where they weren't
+resolved while scraping, run backfill --field fees and then --field fee-rate.`,
+	RunE: runExportFeeHeatmap,
+}
+
+func init() {
+	exportFeeHeatmapCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	exportFeeHeatmapCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	exportFeeHeatmapCmd.Flags().Float64SliceVar(&heatmapBands, "bands", db.DefaultFeeRateBands, "Ascending fee rate bounds of the bands in sat/vB")
+
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "Export the rows stored after this RFC3339 time, the watermark of the previous export")
+	exportCmd.Flags().StringVar(&exportFormat, "format", sink.FormatNDJSON, "File format: "+strings.Join(sink.Formats, ", "))
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "Directory to write the files to")
+	exportCmd.MarkFlagsRequiredTogether("since", "out")
+
+	exportCmd.AddCommand(exportFeeHeatmapCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	if exportSince == "" {
+		return cmd.Help()
+	}
+	since, err := time.Parse(time.RFC3339, exportSince)
+	if err != nil {
+		return fmt.Errorf("invalid --since %q: expected an RFC3339 time such as 2024-05-01T00:00:00Z", exportSince)
+	}
+
+	database, err := openStatsDB("text")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	export, err := sink.NewIncrementalExport(exportOut, exportFormat, since)
+	if err != nil {
+		return err
+	}
+	watermark, err := database.ExportSince(since, export)
+	if err != nil {
+		export.Abort()
+		return err
+	}
+	if err := export.Close(watermark); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d blocks, %d transactions and %d price points to %s\n",
+		export.Blocks, export.Transactions, export.Prices, exportOut)
+	fmt.Println(watermark.UTC().Format(time.RFC3339Nano))
+	return nil
+}
+
+func runExportFeeHeatmap(cmd *cobra.Command, args []string) error {
+	// Exports are CSV unless asked otherwise
+	if !cmd.Flags().Changed("output") {
+		outputFormat = "csv"
+	}
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("csv", "json")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	profile, err := database.GetMetadata(db.MetadataProfile)
+	if err != nil {
+		return err
+	}
+	if profile != "" && !models.Profile(profile).Includes(models.ProfileStandard) {
+		return fmt.Errorf("the fee heatmap needs the transactions, which --profile %s doesn't store", profile)
+	}
+
+	cells, err := database.GetFeeHeatmap(from, to, heatmapBands)
+	if err != nil {
+		return fmt.Errorf("failed to get the fee heatmap: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(cells)
+	}
+	rate := func(r *float64) string {
+		if r == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*r, 'f', -1, 64)
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"height", "timestamp", "band", "min_fee_rate", "max_fee_rate", "transactions", "vsize"})
+	for _, c := range cells {
+		w.Write([]string{
+			strconv.FormatInt(c.Height, 10), c.Timestamp.Format(time.RFC3339), c.Band, rate(c.MinFeeRate), rate(c.MaxFeeRate),
+			strconv.FormatInt(c.Transactions, 10), strconv.FormatInt(c.VSize, 10),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
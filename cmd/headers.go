@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/ui"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	headersFetchers  int
+	headersBatchSize int
+)
+
+var headersCmd = &cobra.Command{
+	Use:   "headers",
+	Short: "Sync only the block headers of a date range",
+	Long: `Store the blocks of a date range from their headers alone, without fetching
+their transactions. This takes one small request per block, so the blocks
+table covers the range much faster than a full scrape.
+
+Blocks stored this way have their header fields, transaction count, subsidy,
+work and chainwork, but no size, weight, fees, coinbase or miner. They are
+recorded with the status headers_only, so a later full scrape over the range
+still processes them and replaces their rows. Blocks that are already stored
+are skipped.`,
+	RunE: runHeaders,
+}
+
+func init() {
+	headersCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	headersCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	headersCmd.Flags().IntVar(&headersFetchers, "fetchers", 10, "Number of concurrent header fetchers")
+	headersCmd.Flags().IntVar(&headersBatchSize, "batch-size", 1000, "Number of headers stored per transaction")
+	headersCmd.Flags().BoolVar(&forceTUI, "tui", false, "Always use the interactive terminal UI")
+	headersCmd.Flags().BoolVar(&noTUI, "no-tui", false, "Disable the interactive terminal UI and print a status line or plain progress lines")
+	headersCmd.Flags().StringVar(&progressFormat, "progress-format", "text", "Progress output: text (terminal UI or plain lines) or json (one JSON object per line on stdout)")
+	headersCmd.Flags().StringVar(&progressStyle, "progress-style", "auto", "Text progress: auto, tui, line (a status line rewritten in place) or plain (a line per message)")
+	headersCmd.Flags().Float64Var(&failThreshold, "fail-threshold", ui.DefaultFailThreshold, "Percentage of failed blocks above which the terminal UI warns")
+	headersCmd.Flags().StringSliceVarP(&rpcHosts, "host", "H", []string{"localhost:8332"}, "Bitcoin RPC host and port, or an http(s) URL with a path prefix (repeat or comma-separate for multiple nodes)")
+	headersCmd.Flags().StringVarP(&rpcUser, "user", "u", "", "Bitcoin RPC username")
+	headersCmd.Flags().StringVarP(&rpcPass, "pass", "p", "", "Bitcoin RPC password")
+	headersCmd.MarkFlagsMutuallyExclusive("tui", "no-tui", "progress-style")
+
+	rootCmd.AddCommand(headersCmd)
+}
+
+func runHeaders(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if err := validateProgressFormat(); err != nil {
+		return err
+	}
+	if headersFetchers < 1 {
+		return fmt.Errorf("--fetchers must be at least 1")
+	}
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	user, pass, err := rpcCredentials()
+	if err != nil {
+		return err
+	}
+	if user == "" || pass == "" {
+		return fmt.Errorf("Bitcoin RPC credentials are required. Provide via --user/--pass flags or BTC_RPC_USER/BTC_RPC_PASS environment variables, or the config file")
+	}
+	rpcClient, err := rpc.NewClient(rpcHosts, user, pass, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create RPC client: %w", err)
+	}
+	defer rpcClient.Close()
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Pruned nodes keep every header, so unlike a full scrape the range
+	// isn't checked against the prune height
+	tip, err := rpcClient.GetBestBlockHeight()
+	if err != nil {
+		return fmt.Errorf("failed to get best block height: %w", err)
+	}
+	fromHeight := heightFromTimestamp(from)
+	toHeight := min(heightFromTimestamp(to), tip)
+	if fromHeight > toHeight {
+		return fmt.Errorf("no blocks between %s and %s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	syncer := processor.NewHeaderSyncer(rpcClient, database, headersFetchers, headersBatchSize)
+	heights, err := syncer.PendingHeights(fromHeight, toHeight)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(infoOut(), "Syncing headers from height %d to %d (%d blocks left)\n", fromHeight, toHeight, len(heights))
+
+	syncDone := make(chan error, 1)
+	go func() {
+		syncDone <- syncer.Run(ctx, heights)
+	}()
+
+	uiErr := ui.RunProgressUI(ctx, fromHeight, toHeight, int64(len(heights)), dbPath, uiOptions(), syncer.GetProgressChannel())
+	if err := <-syncDone; err != nil {
+		fmt.Fprintf(os.Stderr, "Header sync error: %v\n", err)
+		return err
+	}
+	return uiErr
+}
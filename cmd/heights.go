@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"scrapbtc/internal/rpc"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseHeights parses a comma-separated list of heights and inclusive
+// ranges such as 800000,800100-800200.
+func parseHeights(spec string) ([]int64, error) {
+	var heights []int64
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.ParseInt(strings.TrimSpace(from), 10, 64)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid height %q in --heights", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.ParseInt(strings.TrimSpace(to), 10, 64)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid height range %q in --heights", part)
+			}
+		}
+		for h := start; h <= end; h++ {
+			heights = append(heights, h)
+		}
+	}
+	return heights, nil
+}
+
+// readHeightsFile reads one block height or hash per line from path, or
+// stdin for "-". Blank lines and lines starting with # are skipped, and
+// hashes are resolved to heights with getblockheader.
+func readHeightsFile(ctx context.Context, path string, rpcClient *rpc.Client) ([]int64, error) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open heights file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var heights []int64
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if isBlockHash(text) {
+			height, err := rpcClient.GetBlockHeight(ctx, text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			heights = append(heights, height)
+			continue
+		}
+		height, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("line %d: %q is neither a block height nor a block hash", line, text)
+		}
+		heights = append(heights, height)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read heights file: %w", err)
+	}
+	return heights, nil
+}
+
+func isBlockHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// blockList returns the distinct heights selected with --heights or
+// --heights-file in ascending order, checked against the node's tip.
+func blockList(ctx context.Context, rpcClient *rpc.Client) ([]int64, error) {
+	var heights []int64
+	var err error
+	if heightsSpec != "" {
+		heights, err = parseHeights(heightsSpec)
+	} else {
+		heights, err = readHeightsFile(ctx, heightsFile, rpcClient)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(heights) == 0 {
+		return nil, fmt.Errorf("no block heights given")
+	}
+
+	slices.Sort(heights)
+	heights = slices.Compact(heights)
+
+	bestHeight, err := rpcClient.GetBestBlockHeight()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get best block height: %w", err)
+	}
+	if last := heights[len(heights)-1]; last > bestHeight {
+		return nil, fmt.Errorf("height %d is above the node's best block %d", last, bestHeight)
+	}
+
+	first, err := checkPruned(rpcClient, heights[0])
+	if err != nil {
+		return nil, err
+	}
+	i, _ := slices.BinarySearch(heights, first)
+	heights = heights[i:]
+	if len(heights) == 0 {
+		return nil, fmt.Errorf("every listed height is below the prune height %d of the node", first)
+	}
+	return heights, nil
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"scrapbtc/pkg/models"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// labelImportBatchSize is the number of labels written per UpsertAddressLabels.
+const labelImportBatchSize = 10000
+
+var (
+	labelFile       string
+	labelSkipErrors bool
+)
+
+var labelsCmd = &cobra.Command{
+	Use:   "labels",
+	Short: "Manage the address labels shown in the reports",
+}
+
+var labelsImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import address labels from a CSV file",
+	Long: `Import labels of known addresses, such as exchange wallets, from a CSV file
+with the columns address, label and category into the address_labels table. The
+category is free text, e.g. exchange, miner or service, and defaults to other.
+A header line is skipped. An address already labeled gets the new label, and of
+the rows of one address in the file the last one is kept.`,
+	RunE: runLabelsImport,
+}
+
+func init() {
+	labelsImportCmd.Flags().StringVar(&labelFile, "file", "", "CSV file to import ('-' for stdin)")
+	labelsImportCmd.Flags().BoolVar(&labelSkipErrors, "skip-errors", false, "Skip malformed rows instead of aborting the import")
+	labelsImportCmd.MarkFlagRequired("file")
+
+	labelsCmd.AddCommand(labelsImportCmd)
+	rootCmd.AddCommand(labelsCmd)
+}
+
+func parseLabelRow(record []string) (*models.AddressLabel, error) {
+	if len(record) < 2 || len(record) > 3 {
+		return nil, fmt.Errorf("expected 2 or 3 columns, got %d", len(record))
+	}
+	l := &models.AddressLabel{
+		Address:  strings.TrimSpace(record[0]),
+		Label:    strings.TrimSpace(record[1]),
+		Category: models.LabelOther,
+	}
+	if l.Address == "" {
+		return nil, errors.New("empty address")
+	}
+	if l.Label == "" {
+		return nil, errors.New("empty label")
+	}
+	if len(record) == 3 {
+		if category := strings.ToLower(strings.TrimSpace(record[2])); category != "" {
+			l.Category = category
+		}
+	}
+	return l, nil
+}
+
+func runLabelsImport(cmd *cobra.Command, args []string) error {
+	in := os.Stdin
+	if labelFile != "-" {
+		f, err := os.Open(labelFile)
+		if err != nil {
+			return fmt.Errorf("failed to open label file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+
+	var imported, skipped int64
+	start := time.Now()
+	batch := make([]*models.AddressLabel, 0, labelImportBatchSize)
+
+	flush := func() error {
+		if err := database.UpsertAddressLabels(batch); err != nil {
+			return fmt.Errorf("failed to store labels: %w", err)
+		}
+		imported += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := r.FieldPos(0)
+
+		var row *models.AddressLabel
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			line = parseErr.Line
+		case err != nil:
+			return fmt.Errorf("failed to read label file: %w", err)
+		case first && strings.EqualFold(strings.TrimSpace(record[0]), "address"):
+			continue
+		default:
+			row, err = parseLabelRow(record)
+		}
+
+		if err != nil {
+			if !labelSkipErrors {
+				return fmt.Errorf("line %d: %w (use --skip-errors to skip malformed rows)", line, err)
+			}
+			skipped++
+			if skipped <= maxReportedImportErrors {
+				fmt.Fprintf(os.Stderr, "Skipping line %d: %v\n", line, err)
+			}
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == labelImportBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if skipped > maxReportedImportErrors {
+		fmt.Fprintf(os.Stderr, "... and %d more malformed rows\n", skipped-maxReportedImportErrors)
+	}
+	fmt.Printf("Imported %d labels, skipped %d malformed rows in %s\n",
+		imported, skipped, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"context"
+
+	"scrapbtc/internal/ui"
+)
+
+// handlePauseSignals does nothing: SIGUSR1 and SIGUSR2 only exist on Unix.
+func handlePauseSignals(ctx context.Context, p ui.Pauser) {}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"scrapbtc/internal/ui"
+)
+
+// handlePauseSignals pauses p on SIGUSR1 and resumes it on SIGUSR2 until ctx
+// is done, for runs without the TUI's 'p' key.
+func handlePauseSignals(ctx context.Context, p ui.Pauser) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case sig := <-sigs:
+				if sig == syscall.SIGUSR1 {
+					p.Pause()
+				} else {
+					p.Resume()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
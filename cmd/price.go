@@ -0,0 +1,453 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// priceImportBatchSize is the number of rows written per InsertPriceDataBatch.
+const priceImportBatchSize = 10000
+
+// maxReportedImportErrors is the number of skipped rows reported one by one.
+const maxReportedImportErrors = 20
+
+var (
+	priceFile       string
+	priceSource     string
+	priceFormat     string
+	priceTimeFormat string
+	priceSkipErrors bool
+	ohlcGranularity string
+	priceMaxGap     time.Duration
+	priceAtGap      time.Duration
+)
+
+var priceCmd = &cobra.Command{
+	Use:   "price",
+	Short: "Manage the price history used by the USD metrics",
+}
+
+var priceImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import price history from a CSV file",
+	Long: `Stream price history from a CSV file, such as an exchange export, into the
+price_data table. --format names the columns in order: timestamp and price are
+required, volume is optional and columns named '-' are ignored. A header line
+is skipped. Timestamps may be unix seconds or milliseconds or RFC3339, detected
+per row unless --time-format forces one. Rows at an already stored timestamp
+replace it.`,
+	RunE: runPriceImport,
+}
+
+var priceOHLCCmd = &cobra.Command{
+	Use:   "ohlc",
+	Short: "Show the open, high, low and close price per period",
+	Long: `Aggregate the stored price points into open, high, low and close prices and
+the summed volume per hour, day, week or month. Periods start at UTC
+boundaries, weeks on Monday, and periods without price points are left out.`,
+	RunE: runPriceOHLC,
+}
+
+var priceAtCmd = &cobra.Command{
+	Use:   "at <timestamp>...",
+	Short: "Show the price at given times, interpolated between price points",
+	Long: `Show the price, market cap and volume at each timestamp, unix seconds or
+milliseconds or RFC3339: the stored price point at that time, or else the
+values interpolated linearly between the points before and after it. Times
+whose points are further apart than --max-gap, or before the first or after
+the last point, have no price.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runPriceAt,
+}
+
+var priceGapsCmd = &cobra.Command{
+	Use:   "gaps",
+	Short: "List the stretches without price data",
+	Long: `List every stretch longer than --max-gap between two consecutive stored price
+points, to find what to import. Time before the first and after the last
+point isn't reported.`,
+	RunE: runPriceGaps,
+}
+
+func init() {
+	priceImportCmd.Flags().StringVar(&priceFile, "file", "", "CSV file to import ('-' for stdin)")
+	priceImportCmd.Flags().StringVar(&priceSource, "source", "csv", "Source name stored with the prices, e.g. the exchange")
+	priceImportCmd.Flags().StringVar(&priceFormat, "format", "timestamp,price", "Columns of the file in order: timestamp, price, volume or - to ignore")
+	priceImportCmd.Flags().StringVar(&priceTimeFormat, "time-format", "auto", "Timestamp format: auto, unix, unix-ms, rfc3339 or a Go time layout")
+	priceImportCmd.Flags().BoolVar(&priceSkipErrors, "skip-errors", false, "Skip malformed rows instead of aborting the import")
+	priceImportCmd.MarkFlagRequired("file")
+
+	priceOHLCCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	priceOHLCCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	priceOHLCCmd.Flags().StringVar(&ohlcGranularity, "granularity", db.GranularityDay, "Period to aggregate prices by: hour, day, week or month")
+
+	priceGapsCmd.Flags().DurationVar(&priceMaxGap, "max-gap", time.Hour, "Report stretches without price data longer than this")
+
+	priceCmd.AddCommand(priceImportCmd)
+	priceCmd.AddCommand(priceOHLCCmd)
+	priceAtCmd.Flags().DurationVar(&priceAtGap, "max-gap", db.DefaultMaxPriceGap, "Interpolate only between price points at most this far apart")
+
+	priceCmd.AddCommand(priceGapsCmd)
+	priceCmd.AddCommand(priceAtCmd)
+	rootCmd.AddCommand(priceCmd)
+}
+
+// priceColumns are the positions of the known columns in a CSV row, -1 if
+// absent.
+type priceColumns struct {
+	timestamp, price, volume int
+	count                    int
+}
+
+func parsePriceFormat(format string) (priceColumns, error) {
+	cols := priceColumns{timestamp: -1, price: -1, volume: -1}
+	names := strings.Split(format, ",")
+	cols.count = len(names)
+	for i, name := range names {
+		var col *int
+		switch strings.TrimSpace(name) {
+		case "timestamp":
+			col = &cols.timestamp
+		case "price":
+			col = &cols.price
+		case "volume":
+			col = &cols.volume
+		case "-":
+			continue
+		default:
+			return cols, fmt.Errorf("unknown column %q in --format, expected timestamp, price, volume or -", name)
+		}
+		if *col >= 0 {
+			return cols, fmt.Errorf("column %q appears twice in --format", name)
+		}
+		*col = i
+	}
+	if cols.timestamp < 0 || cols.price < 0 {
+		return cols, fmt.Errorf("--format must include timestamp and price")
+	}
+	return cols, nil
+}
+
+// parsePriceTime parses a timestamp in the given --time-format. In auto
+// mode numbers are unix seconds, or milliseconds when too large to be
+// seconds, and anything else must be RFC3339.
+func parsePriceTime(s, format string) (time.Time, error) {
+	switch format {
+	case "auto":
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			if math.Abs(n) >= 1e11 {
+				return parsePriceTime(s, "unix-ms")
+			}
+			return parsePriceTime(s, "unix")
+		}
+		return parsePriceTime(s, "rfc3339")
+	case "unix", "unix-ms":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid unix timestamp %q", s)
+		}
+		if format == "unix-ms" {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case "rfc3339":
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid RFC3339 timestamp %q", s)
+		}
+		return t.UTC(), nil
+	default:
+		t, err := time.Parse(format, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timestamp %q doesn't match %q", s, format)
+		}
+		return t.UTC(), nil
+	}
+}
+
+func parsePriceRow(record []string, cols priceColumns, source string, fetchedAt time.Time) (*models.PriceData, error) {
+	if len(record) < cols.count {
+		return nil, fmt.Errorf("expected %d columns, got %d", cols.count, len(record))
+	}
+
+	ts, err := parsePriceTime(strings.TrimSpace(record[cols.timestamp]), priceTimeFormat)
+	if err != nil {
+		return nil, err
+	}
+	price, err := strconv.ParseFloat(strings.TrimSpace(record[cols.price]), 64)
+	if err != nil || price <= 0 || math.IsInf(price, 0) {
+		return nil, fmt.Errorf("invalid price %q", record[cols.price])
+	}
+	var volume float64
+	if cols.volume >= 0 {
+		volume, err = strconv.ParseFloat(strings.TrimSpace(record[cols.volume]), 64)
+		if err != nil || volume < 0 || math.IsInf(volume, 0) {
+			return nil, fmt.Errorf("invalid volume %q", record[cols.volume])
+		}
+	}
+
+	return &models.PriceData{
+		Timestamp: ts,
+		Price:     price,
+		Volume24h: int64(math.Round(volume)),
+		Source:    source,
+		FetchedAt: fetchedAt,
+	}, nil
+}
+
+func runPriceImport(cmd *cobra.Command, args []string) error {
+	cols, err := parsePriceFormat(priceFormat)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if priceFile != "-" {
+		f, err := os.Open(priceFile)
+		if err != nil {
+			return fmt.Errorf("failed to open price file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	var inserted, skipped int64
+	start := time.Now()
+	lastReport := start
+	fetchedAt := time.Now()
+	batch := make([]*models.PriceData, 0, priceImportBatchSize)
+
+	flush := func() error {
+		if err := database.InsertPriceDataBatch(batch); err != nil {
+			return fmt.Errorf("failed to insert prices: %w", err)
+		}
+		inserted += int64(len(batch))
+		batch = batch[:0]
+
+		if time.Since(lastReport) >= time.Second {
+			lastReport = time.Now()
+			fmt.Fprintf(os.Stderr, "Imported %d rows (%.0f rows/s)\n",
+				inserted, float64(inserted)/time.Since(start).Seconds())
+		}
+		return nil
+	}
+
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := r.FieldPos(0)
+
+		var row *models.PriceData
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			line = parseErr.Line
+		case err != nil:
+			return fmt.Errorf("failed to read price file: %w", err)
+		default:
+			row, err = parsePriceRow(record, cols, priceSource, fetchedAt)
+		}
+
+		if err != nil {
+			// A header line doesn't parse, which is expected
+			if first {
+				continue
+			}
+			if !priceSkipErrors {
+				return fmt.Errorf("line %d: %w (use --skip-errors to skip malformed rows)", line, err)
+			}
+			skipped++
+			if skipped <= maxReportedImportErrors {
+				fmt.Fprintf(os.Stderr, "Skipping line %d: %v\n", line, err)
+			}
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == priceImportBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if skipped > maxReportedImportErrors {
+		fmt.Fprintf(os.Stderr, "... and %d more malformed rows\n", skipped-maxReportedImportErrors)
+	}
+	fmt.Printf("Inserted %d price rows from %s, skipped %d malformed rows in %s\n",
+		inserted, priceSource, skipped, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func runPriceOHLC(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ohlc, err := database.GetPriceOHLC(from, to, ohlcGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get price OHLC: %w", err)
+	}
+
+	layout := time.DateOnly
+	if ohlcGranularity == db.GranularityHour {
+		layout = time.DateTime
+	}
+	price := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	switch outputFormat {
+	case "json":
+		return printJSON(ohlc)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "open", "high", "low", "close", "volume", "points"})
+		for _, p := range ohlc {
+			w.Write([]string{
+				p.Period.Format(layout), price(p.Open), price(p.High), price(p.Low), price(p.Close),
+				strconv.FormatInt(p.Volume, 10), strconv.FormatInt(p.Points, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tOPEN\tHIGH\tLOW\tCLOSE\tVOLUME\tPOINTS")
+	for _, p := range ohlc {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			p.Period.Format(layout), price(p.Open), price(p.High), price(p.Low), price(p.Close), p.Volume, p.Points)
+	}
+	return w.Flush()
+}
+
+func runPriceGaps(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	gaps, err := database.FindPriceGaps(priceMaxGap)
+	if err != nil {
+		return fmt.Errorf("failed to find price gaps: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(gaps)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"from", "to", "seconds"})
+		for _, g := range gaps {
+			w.Write([]string{g.From.Format(time.RFC3339), g.To.Format(time.RFC3339), strconv.FormatInt(g.Seconds, 10)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	if len(gaps) == 0 {
+		fmt.Printf("No gaps longer than %s between price points\n", priceMaxGap)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tGAP")
+	for _, g := range gaps {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", g.From.Format(time.DateTime), g.To.Format(time.DateTime), time.Duration(g.Seconds)*time.Second)
+	}
+	return w.Flush()
+}
+
+func runPriceAt(cmd *cobra.Command, args []string) error {
+	times := make([]time.Time, len(args))
+	for i, arg := range args {
+		t, err := parsePriceTime(arg, "auto")
+		if err != nil {
+			return err
+		}
+		times[i] = t
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	database.SetMaxPriceGap(priceAtGap)
+	prices, err := database.GetPricesAt(times)
+	if err != nil {
+		return fmt.Errorf("failed to get prices: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		type priceAt struct {
+			Time  time.Time         `json:"time"`
+			Price *models.PriceData `json:"price"`
+		}
+		out := make([]priceAt, len(times))
+		for i, t := range times {
+			out[i] = priceAt{Time: t, Price: prices[i]}
+		}
+		return printJSON(out)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"time", "price", "market_cap", "volume_24h", "source"})
+		for i, t := range times {
+			row := []string{t.Format(time.RFC3339), "", "", "", ""}
+			if p := prices[i]; p != nil {
+				row = []string{t.Format(time.RFC3339), strconv.FormatFloat(p.Price, 'f', 2, 64),
+					strconv.FormatInt(p.MarketCap, 10), strconv.FormatInt(p.Volume24h, 10), p.Source}
+			}
+			w.Write(row)
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPRICE (USD)\tMARKET CAP (USD)\tVOLUME 24H (USD)\tSOURCE")
+	for i, t := range times {
+		p := prices[i]
+		if p == nil {
+			fmt.Fprintf(w, "%s\tno price\t\t\t\n", t.Format(time.DateTime))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%.2f\t%d\t%d\t%s\n", t.Format(time.DateTime), p.Price, p.MarketCap, p.Volume24h, p.Source)
+	}
+	return w.Flush()
+}
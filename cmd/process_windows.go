@@ -0,0 +1,15 @@
+package cmd
+
+import "os"
+
+// processAlive reports whether a process with the given pid runs on this
+// host. FindProcess opens the process on Windows, which fails once it has
+// exited.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
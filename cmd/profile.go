@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/processor"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/ui"
+	"scrapbtc/pkg/models"
+)
+
+// resolveProfile returns the profile the database is scraped with, if any,
+// and the profile of the run: --profile, or else the database's. Databases
+// scraped before profiles were recorded store everything, so they are full
+// once they have blocks. Only --migrate-profile lets a run change it.
+func resolveProfile(database db.Store) (stored, profile models.Profile, err error) {
+	if database != nil {
+		value, err := database.GetMetadata(db.MetadataProfile)
+		if err != nil {
+			return "", "", err
+		}
+		stored = models.Profile(value)
+		if stored == "" {
+			completed, _, err := database.GetStatusCounts(0, math.MaxInt64)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to count processed blocks: %w", err)
+			}
+			if completed > 0 {
+				stored = models.ProfileFull
+			}
+		}
+	}
+
+	switch {
+	case profileName != "":
+		if profile, err = models.ParseProfile(profileName); err != nil {
+			return "", "", err
+		}
+	case stored != "":
+		profile = stored
+	default:
+		profile = models.ProfileFull
+	}
+	if stored != "" && profile != stored && !migrateProfile {
+		return "", "", fmt.Errorf("the database is scraped with --profile %s; add --migrate-profile to switch it to %s", stored, profile)
+	}
+	return stored, profile, nil
+}
+
+// validateProfile rejects the flags that need rows profile doesn't store.
+func validateProfile(profile models.Profile) error {
+	for _, f := range []struct {
+		name  string
+		set   bool
+		needs models.Profile
+	}{
+		{"--compute-cdd", computeCDD, models.ProfileFull},
+		{"--resolve-inputs", resolveInputs, models.ProfileFull},
+		{"--skip-dust", skipDust, models.ProfileFull},
+		{"--min-output-value", minOutputValue > 0, models.ProfileStandard},
+	} {
+		if f.set && !profile.Includes(f.needs) {
+			return fmt.Errorf("%s needs --profile %s or above", f.name, f.needs)
+		}
+	}
+	return nil
+}
+
+// applyProfile records opts.Profile as the profile of the database. Moving
+// to a larger profile first fetches every completed block again and stores
+// it with opts, in a backfill that an interrupted run continues; a smaller
+// profile only applies to the blocks stored from then on.
+func applyProfile(ctx context.Context, database db.Store, rpcClient *rpc.Client, stored models.Profile, opts processor.Options) error {
+	profile := opts.Profile
+	switch {
+	case stored == profile:
+		return nil
+	case stored == "":
+	case !profile.Includes(stored):
+		fmt.Fprintf(os.Stderr, "Warning: The blocks already stored keep the rows of --profile %s\n", stored)
+	default:
+		toHeight, err := database.GetMaxProcessedHeight()
+		if err != nil {
+			return fmt.Errorf("failed to get the highest processed block: %w", err)
+		}
+		backfiller := processor.NewProfileBackfiller(database, rpcClient, opts, 0)
+		startHeight, err := backfiller.ResumeHeight(0, toHeight)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(infoOut(), "Migrating the database from --profile %s to %s: storing the blocks up to height %d again\n",
+			stored, profile, toHeight)
+
+		migrateDone := make(chan error, 1)
+		go func() {
+			migrateDone <- backfiller.Run(ctx, 0, toHeight)
+		}()
+		uiErr := ui.RunProgressUI(ctx, startHeight, toHeight, toHeight-startHeight+1, dbPath, uiOptions(), backfiller.GetProgressChannel())
+		if err := <-migrateDone; err != nil {
+			return fmt.Errorf("failed to migrate to --profile %s: %w", profile, err)
+		}
+		if uiErr != nil {
+			return uiErr
+		}
+		// Replacing the blocks dropped the secondary indexes on DuckDB
+		if err := database.CreateIndexes(); err != nil {
+			return err
+		}
+	}
+	return database.SetMetadata(db.MetadataProfile, string(profile))
+}
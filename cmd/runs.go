@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	forceRun  bool
+	runsLimit int
+)
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List past scrape runs",
+	Long: `List the scrape runs recorded in the database, newest first, with the height
+range, duration, blocks processed and failed, outcome, binary version and
+the transaction filters (--min-output-value, --skip-dust) the run stored
+blocks with.`,
+	RunE: runRuns,
+}
+
+func init() {
+	runsCmd.Flags().IntVarP(&runsLimit, "limit", "n", 20, "Number of runs to show (0 = all)")
+	rootCmd.AddCommand(runsCmd)
+}
+
+// redactArgs returns the command line with the RPC password and the webhook
+// secret replaced.
+func redactArgs(args []string) string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i, arg := range redacted {
+		switch {
+		case arg == "--pass" || arg == "-p" || arg == "--webhook-secret":
+			if i+1 < len(redacted) {
+				redacted[i+1] = "***"
+			}
+		case strings.HasPrefix(arg, "--pass="):
+			redacted[i] = "--pass=***"
+		case strings.HasPrefix(arg, "--webhook-secret="):
+			redacted[i] = "--webhook-secret=***"
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2:
+			redacted[i] = "-p***"
+		}
+	}
+	return strings.Join(redacted, " ")
+}
+
+// startRun records a scrape run with its transaction filters, refusing to
+// start while another run is recorded as running unless --force is given.
+// Runs left running by a process on this host that no longer exists are
+// marked aborted first. It warns when earlier runs stored blocks with
+// different filters, as the database then mixes them.
+func startRun(database db.Store, fromHeight, toHeight int64, filters string) (int64, error) {
+	hostname, _ := os.Hostname()
+
+	running, err := database.GetRuns(models.RunRunning, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check for running scrapes: %w", err)
+	}
+	for _, r := range running {
+		if r.Hostname == hostname && !processAlive(r.PID) {
+			if err := database.FinishRun(r.ID, models.RunAborted, r.BlocksProcessed, r.BlocksFailed, "process exited without recording the end of the run"); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	runs, err := database.GetRuns("", 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check the filters of earlier runs: %w", err)
+	}
+	for _, r := range runs {
+		if r.BlocksProcessed > 0 && r.Filters != filters {
+			fmt.Fprintf(os.Stderr, "Warning: run %d stored blocks with %s and this run uses %s, so the database mixes filtered and unfiltered transactions\n",
+				r.ID, describeFilters(r.Filters), describeFilters(filters))
+			break
+		}
+	}
+
+	// The check for a running run is part of recording this one, so two
+	// runs starting at once can't both pass it
+	id, err := database.StartRun(&models.Run{
+		StartedAt:  models.Now(),
+		FromHeight: fromHeight,
+		ToHeight:   toHeight,
+		Version:    buildVersion(),
+		Args:       redactArgs(os.Args[1:]),
+		Hostname:   hostname,
+		PID:        os.Getpid(),
+		Filters:    filters,
+	}, forceRun)
+	if errors.Is(err, db.ErrRunInProgress) {
+		if running, err := database.GetRuns(models.RunRunning, 1); err == nil && len(running) > 0 {
+			r := running[0]
+			return 0, fmt.Errorf("run %d (pid %d on %s, started %s) is still running against this database; use --force to start anyway",
+				r.ID, r.PID, r.Hostname, r.StartedAt.Local().Format(time.DateTime))
+		}
+		return 0, fmt.Errorf("another run is still running against this database; use --force to start anyway")
+	}
+	return id, err
+}
+
+func describeFilters(filters string) string {
+	if filters == "" {
+		return "no filters"
+	}
+	return "filters " + filters
+}
+
+func runRuns(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB("text", "json")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	runs, err := database.GetRuns("", runsLimit)
+	if err != nil {
+		return fmt.Errorf("failed to get runs: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(runs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTARTED\tDURATION\tHEIGHTS\tPROCESSED\tFAILED\tSTATUS\tVERSION\tFILTERS")
+	for _, r := range runs {
+		duration := "-"
+		if r.FinishedAt != nil {
+			duration = r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+		} else if r.Status == models.RunRunning {
+			duration = time.Since(r.StartedAt).Round(time.Second).String() + " so far"
+		}
+		filters := r.Filters
+		if filters == "" {
+			filters = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d-%d\t%d\t%d\t%s\t%s\t%s\n",
+			r.ID, r.StartedAt.Local().Format(time.DateTime), duration, r.FromHeight, r.ToHeight,
+			r.BlocksProcessed, r.BlocksFailed, r.Status, r.Version, filters)
+	}
+	return w.Flush()
+}
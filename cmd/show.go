@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+var showLive bool
+
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show a stored block or transaction",
+	Long: `Print one stored block or transaction, formatted, or as JSON with --output json.
+With --live, records that aren't stored yet are fetched from the node instead.`,
+}
+
+var showBlockCmd = &cobra.Command{
+	Use:   "block <height|hash>",
+	Short: "Show a block: its header, transactions, fees and fullness",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runShowBlock,
+}
+
+var showTxCmd = &cobra.Command{
+	Use:   "tx <txid>",
+	Short: "Show a transaction: its values, fee, fee rate and counts",
+	Long: `Show a stored transaction. With --live, a transaction that isn't stored is
+looked up on the node, which finds transactions outside its mempool only when
+it runs with -txindex.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runShowTx,
+}
+
+func init() {
+	showCmd.PersistentFlags().BoolVar(&showLive, "live", false, "Fetch from the node what isn't stored in the database")
+	showCmd.PersistentFlags().StringSliceVarP(&rpcHosts, "host", "H", []string{"localhost:8332"}, "Bitcoin RPC host and port, or an http(s) URL with a path prefix (repeat or comma-separate for multiple nodes)")
+	showCmd.PersistentFlags().StringVarP(&rpcUser, "user", "u", "", "Bitcoin RPC username")
+	showCmd.PersistentFlags().StringVarP(&rpcPass, "pass", "p", "", "Bitcoin RPC password")
+
+	showCmd.AddCommand(showBlockCmd)
+	showCmd.AddCommand(showTxCmd)
+	rootCmd.AddCommand(showCmd)
+}
+
+func runShowBlock(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB("text", "json")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	height, byHeight := parseHeight(args[0])
+	var block *models.Block
+	if byHeight {
+		block, err = database.GetBlockByHeight(height)
+	} else {
+		block, err = database.GetBlockByHash(args[0])
+	}
+	source := "database"
+	if errors.Is(err, sql.ErrNoRows) && showLive {
+		source = "node"
+		block, err = liveBlock(args[0], height, byHeight)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("block %s not found in the database, use --live to fetch it from the node", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get block %s: %w", args[0], err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(block)
+	}
+	txs := strconv.Itoa(block.TxCount)
+	if block.FilteredTxCount > 0 {
+		txs += fmt.Sprintf(" (%d filtered out)", block.FilteredTxCount)
+	}
+	if block.Weight == 0 {
+		txs += " (header only)"
+	}
+	fields := [][2]string{
+		{"Height", strconv.FormatInt(block.Height, 10)},
+		{"Hash", block.Hash},
+		{"Previous", block.PreviousBlockHash},
+		{"Merkle root", block.MerkleRoot},
+		{"Time", formatShowTime(block.Timestamp)},
+		{"Transactions", txs},
+		{"Segwit txs", strconv.Itoa(block.SegwitTxCount)},
+		{"Size", fmt.Sprintf("%d bytes", block.Size)},
+		{"Weight", fmt.Sprintf("%d WU", block.Weight)},
+		{"Fullness", fmt.Sprintf("%.1f%%", float64(block.Weight)/db.MaxBlockWeight*100)},
+		{"Total fees", formatBTC(block.TotalFees) + " BTC"},
+		{"Subsidy", formatBTC(block.Subsidy) + " BTC"},
+		{"Coinbase value", formatBTC(block.CoinbaseValue) + " BTC"},
+		{"Miner", block.MinerTag},
+		{"Difficulty", strconv.FormatFloat(block.Difficulty, 'f', 2, 64)},
+		{"Bits", block.Bits},
+		{"Nonce", strconv.FormatUint(uint64(block.Nonce), 10)},
+		{"Chainwork", block.Chainwork},
+	}
+	fmt.Println(renderRecord(fmt.Sprintf("Block %d (from the %s)", block.Height, source), fields))
+	return nil
+}
+
+func runShowTx(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB("text", "json")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	tx, err := database.GetTransaction(args[0])
+	source := "database"
+	if errors.Is(err, sql.ErrNoRows) && showLive {
+		source = "node"
+		tx, err = liveTransaction(args[0])
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("transaction %s not found in the database, use --live to fetch it from the node", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get transaction %s: %w", args[0], err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(tx)
+	}
+	fields := [][2]string{
+		{"Txid", tx.Txid},
+		{"Block", fmt.Sprintf("%d (%s)", tx.BlockHeight, tx.BlockHash)},
+		{"Time", formatShowTime(tx.Timestamp)},
+		{"Coinbase", strconv.FormatBool(tx.IsCoinbase)},
+		{"Inputs", strconv.Itoa(tx.InputCount)},
+		{"Outputs", strconv.Itoa(tx.OutputCount)},
+		{"Input value", formatBTC(tx.InputValue) + " BTC"},
+		{"Output value", formatBTC(tx.OutputValue) + " BTC"},
+		{"Fee", formatBTC(tx.Fee) + " BTC"},
+		{"Fee rate", fmt.Sprintf("%.2f sat/vB", tx.FeeRate)},
+		{"Size", fmt.Sprintf("%d bytes, %d vB, %d WU", tx.Size, tx.VSize, tx.Weight)},
+		{"Version", strconv.Itoa(int(tx.Version))},
+		{"Locktime", strconv.FormatUint(uint64(tx.LockTime), 10)},
+		{"Signals RBF", strconv.FormatBool(tx.SignalsRBF)},
+		{"Category", string(tx.Category)},
+	}
+	if !tx.ProcessedAt.IsZero() {
+		fields = append(fields, [2]string{"Scraped", formatShowTime(tx.ProcessedAt)})
+	}
+	fmt.Println(renderRecord("Transaction (from the "+source+")", fields))
+	return nil
+}
+
+// parseHeight reports whether arg is a block height rather than a hash.
+func parseHeight(arg string) (int64, bool) {
+	if len(arg) == 64 {
+		return 0, false
+	}
+	height, err := strconv.ParseInt(arg, 10, 64)
+	return height, err == nil && height >= 0
+}
+
+// liveClient connects to the node for --live.
+func liveClient() (*rpc.Client, error) {
+	user, pass, err := rpcCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if user == "" || pass == "" {
+		return nil, fmt.Errorf("Bitcoin RPC credentials are required for --live. Provide via --user/--pass flags or BTC_RPC_USER/BTC_RPC_PASS environment variables, or the config file")
+	}
+	rpcClient, err := rpc.NewClient(rpcHosts, user, pass, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RPC client: %w", err)
+	}
+	return rpcClient, nil
+}
+
+func liveBlock(arg string, height int64, byHeight bool) (*models.Block, error) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	rpcClient, err := liveClient()
+	if err != nil {
+		return nil, err
+	}
+	defer rpcClient.Close()
+
+	hash := arg
+	if byHeight {
+		if hash, err = rpcClient.GetBlockHashByHeight(ctx, height); err != nil {
+			return nil, err
+		}
+	}
+	data, err := rpcClient.GetBlockData(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return data.Block, nil
+}
+
+func liveTransaction(txid string) (*models.Transaction, error) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	rpcClient, err := liveClient()
+	if err != nil {
+		return nil, err
+	}
+	defer rpcClient.Close()
+
+	hash, err := rpcClient.GetTransactionBlockHash(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := rpcClient.GetBlockData(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range data.Transactions {
+		if tx.Txid == txid {
+			return tx, nil
+		}
+	}
+	return nil, fmt.Errorf("transaction not in its block %s", hash)
+}
+
+func formatShowTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// renderRecord draws fields as aligned label and value lines under title,
+// in a box. Empty values, such as those of columns not recorded yet, are
+// shown as "-".
+func renderRecord(title string, fields [][2]string) string {
+	labelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f[0]))
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("5")).Render(title), ""}
+	for _, f := range fields {
+		value := f[1]
+		if value == "" {
+			value = "-"
+		}
+		lines = append(lines, labelStyle.Render(fmt.Sprintf("%-*s", width, f[0]))+"  "+value)
+	}
+	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(strings.Join(lines, "\n"))
+}
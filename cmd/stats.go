@@ -0,0 +1,1775 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	topAddressesLimit   int
+	statsFrom           string
+	statsTo             string
+	interpolatePrices   bool
+	recomputeMetrics    bool
+	hodlAsOf            string
+	granularity         string
+	mempoolGranularity  string
+	minersGranularity   string
+	hashrateGranularity string
+	fullnessGranularity string
+	rollingWindow       string
+	partialWindows      bool
+	emaAlpha            float64
+	excludeChange       bool
+	watchedAddress      string
+	labelCategory       string
+	outputGranularity   string
+	anomalyDimension    string
+	anomalyLimit        int
+)
+
+// histogramWidth is the length of the longest bar of a text histogram.
+const histogramWidth = 40
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Query statistics from the scraped data",
+}
+
+var statsAddressCmd = &cobra.Command{
+	Use:   "address <address>",
+	Short: "Show the balance and activity of an address",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runStatsAddress,
+}
+
+var statsTopAddressesCmd = &cobra.Command{
+	Use:   "top-addresses",
+	Short: "List the addresses with the highest balance",
+	RunE:  runStatsTopAddresses,
+}
+
+var statsAddressesCmd = &cobra.Command{
+	Use:   "addresses",
+	Short: "Show the daily new and active addresses",
+	Long: `Show how many addresses were first seen each day, from the address_first_seen
+table, and how many distinct addresses received or spent coins that day. Spends
+only count once the output they spend is scraped. First seen days are exact
+once a run over every block before them has finished.`,
+	RunE: runStatsAddresses,
+}
+
+var statsCDDCmd = &cobra.Command{
+	Use:   "cdd",
+	Short: "Show daily coin days destroyed and average dormancy",
+	Long: `Show daily coin days destroyed and average dormancy from the block_metrics
+table. Populate it by scraping with --compute-cdd or with 'scrapbtc analyze cdd'.`,
+	RunE: runStatsCDD,
+}
+
+var statsRealizedCapCmd = &cobra.Command{
+	Use:   "realized-cap",
+	Short: "Show the daily realized cap of the scraped outputs",
+	Long: `Show the daily realized cap: every unspent output valued at the price of the
+day it was created. Only outputs in the scraped range are counted.`,
+	RunE: runStatsRealizedCap,
+}
+
+var statsSOPRCmd = &cobra.Command{
+	Use:   "sopr",
+	Short: "Show the daily spent output profit ratio",
+	Long: `Show the daily spent output profit ratio (SOPR): the value of the outputs
+spent that day at that day's price divided by their value at the price of the
+day they were created.`,
+	RunE: runStatsSOPR,
+}
+
+var statsBlocksCmd = &cobra.Command{
+	Use:   "blocks",
+	Short: "Show block intervals, difficulty and estimated hashrate",
+	Long: `Show blocks per day or week, the average and median interval between
+consecutive stored blocks, the average difficulty and the hashrate estimated
+from them. Intervals made negative by out-of-order timestamps count as zero
+in the average. Supports --output text, json and csv.`,
+	RunE: runStatsBlocks,
+}
+
+var statsFullnessCmd = &cobra.Command{
+	Use:   "fullness",
+	Short: "Show how full blocks are against the 4M weight unit limit",
+	Long: `Show the weight of blocks as a percentage of the 4M weight unit limit, per
+block or as the average of each day or week, and how many blocks were full
+(above 99% of the limit), partial (room left, as in low-fee periods) or empty
+(only a coinbase). Full blocks were constrained by the limit; the others by
+demand for block space or the miner. Header-only blocks are left out.
+Supports --output text, json and csv.`,
+	RunE: runStatsFullness,
+}
+
+var statsOutputDistCmd = &cobra.Command{
+	Use:   "output-distribution",
+	Short: "Show the histogram of output values",
+	Long: `Show how many outputs were created with values in each log-scale bucket,
+from 1k sats or less to over 1000 BTC, and their value, over the whole range
+or per block, day or week. A surge of the smallest buckets is the mark of a
+dust storm. Needs the outputs stored by --profile full; outputs left out by
+--skip-dust or --min-output-value are missing. Text output draws a histogram
+per period. Supports --output text, json and csv.`,
+	RunE: runStatsOutputDist,
+}
+
+var statsAnomaliesCmd = &cobra.Command{
+	Use:   "anomalies",
+	Short: "List the unusual blocks found by analyze anomalies",
+	Long: `List the anomalies stored by scrapbtc analyze anomalies for the blocks in the
+date range, the most severe first: the block, the dimension it is unusual on,
+its value, the baseline of the blocks before it and the score, negative below
+the baseline. Supports --output text, json and csv.`,
+	RunE: runStatsAnomalies,
+}
+
+var statsMinersCmd = &cobra.Command{
+	Use:   "miners",
+	Short: "Show the share of blocks mined by each pool",
+	Long: `Show how many blocks each mining pool mined per day or week and their share of
+the period's blocks. Pools are identified by the tags they put in the coinbase
+scriptSig, from a built-in list extended by --miner-tags-file while scraping;
+blocks matching no tag count as unknown, and their coinbase_script is kept for
+later classification. Blocks scraped by older versions are left out. Supports
+--output text, json and csv.`,
+	RunE: runStatsMiners,
+}
+
+var statsEpochsCmd = &cobra.Command{
+	Use:   "epochs",
+	Short: "Show block counts, fees and issuance per halving epoch",
+	Long: `Show, for each halving epoch of 210,000 blocks in the scraped range, the
+heights and dates of its first and last stored block, the number of blocks,
+their average fees, the subsidy the halving schedule allowed them and what
+their coinbases actually issued beyond the fees. Issued falls short of the
+subsidy when miners claimed less than allowed; verify lists those blocks.
+Without --from, all stored blocks are included. Supports --output text, json
+and csv.`,
+	RunE: runStatsEpochs,
+}
+
+var statsHashrateCmd = &cobra.Command{
+	Use:   "hashrate",
+	Short: "Show the network hashrate estimated from chainwork",
+	Long: `Show the network hashrate per day or week, estimated at the last block of each
+period from the chainwork added over the trailing 2016 blocks divided by the
+time between their timestamps. Unlike the estimate of stats blocks it follows
+the difficulty of every block in the window rather than an average.
+
+It needs the chainwork of both ends of the window: blocks scraped by older
+versions get it with backfill --field chainwork, and periods whose window
+reaches below the scraped range are left out. Supports --output text, json
+and csv.`,
+	RunE: runStatsHashrate,
+}
+
+var statsFeeEstimatesCmd = &cobra.Command{
+	Use:   "fee-estimates",
+	Short: "Compare the fee estimates recorded in follow mode with the blocks mined next",
+	Long: `Compare the estimatesmartfee fee rates recorded by --follow for 1, 3, 6 and 144
+block confirmation targets with the median fee rate of the first block mined
+after each estimate, per day and target: the average estimate and median, the
+mean absolute error and the share of estimates at or above the median. Estimates
+whose next block isn't stored yet are left out. Supports --output text, json
+and csv.`,
+	RunE: runStatsFeeEstimates,
+}
+
+var statsNextBlockCmd = &cobra.Command{
+	Use:   "next-block",
+	Short: "Compare the block templates recorded in follow mode with the blocks mined",
+	Long: `Compare the fees of each mined block with the last block template recorded by
+--follow for its height, per day: the transactions in the templates and the
+blocks, their fees, the fees the templates offered beyond what the blocks
+collected (negative when transactions that arrived later paid more) and the
+average fee rate floor of the templates. Blocks without a template are left
+out. Supports --output text, json and csv.`,
+	RunE: runStatsNextBlock,
+}
+
+var statsMempoolCmd = &cobra.Command{
+	Use:   "mempool",
+	Short: "Show the mempool size recorded in follow mode against block fullness",
+	Long: `Show the average and peak mempool size from the node snapshots recorded by
+--follow per hour or day, next to the number of stored blocks mined in the
+same period, their average weight as a percentage of the 4M weight unit limit
+and the fees they paid. Only periods with snapshots are shown. Supports
+--output text, json and csv.`,
+	RunE: runStatsMempool,
+}
+
+var statsRBFCmd = &cobra.Command{
+	Use:   "rbf",
+	Short: "Show the daily share of transactions signaling RBF",
+	Long: `Show how many non-coinbase transactions per day signal replace-by-fee
+(BIP125) through an input sequence below 0xfffffffe. Transactions scraped by
+older versions are left out until 'scrapbtc backfill --field rbf' is run.`,
+	RunE: runStatsRBF,
+}
+
+var statsCategoriesCmd = &cobra.Command{
+	Use:   "categories",
+	Short: "Show the daily mix of consolidations, batch payments and simple spends",
+	Long: fmt.Sprintf(`Show how many non-coinbase transactions per day fall in each category,
+guessed from their input and output counts: consolidations (at least %d inputs
+and at most %d outputs), batch payments (at most %d inputs and at least %d
+outputs), simple spends (at most %d inputs and 2 outputs) and other.
+Transactions scraped by older versions are left out until
+'scrapbtc backfill --field categories' is run. Supports --output text, json
+and csv.`, models.ConsolidationMinInputs, models.FewCoins, models.FewCoins, models.BatchMinOutputs, models.FewCoins),
+	RunE: runStatsCategories,
+}
+
+var statsWatchlistCmd = &cobra.Command{
+	Use:   "watchlist",
+	Short: "Show the daily inflows and outflows of the watched addresses",
+	Long: `Show per day and address of --watch-addresses the payments it received and
+the spends of its outputs, with their totals. Only blocks scraped with
+--watch-addresses are covered, and spends only from nodes running Bitcoin
+Core 23 or later, which print the outputs the inputs spend. Amounts are in
+BTC in the text table and in satoshis in json and csv.`,
+	RunE: runStatsWatchlist,
+}
+
+var statsLabelFlowsCmd = &cobra.Command{
+	Use:   "label-flows",
+	Short: "Show the daily net flow into and out of each labeled cluster",
+	Long: `Show per day and label of 'scrapbtc labels import' the value paid to its
+addresses, the value spent from them and the difference, e.g. the netflow of
+an exchange. Spends count on the day of the spending transaction, so they need
+the full profile. Moves between addresses of one label cancel out in the net
+flow. Amounts are in BTC in the text table and in satoshis in json and csv.`,
+	RunE: runStatsLabelFlows,
+}
+
+var statsSegwitCmd = &cobra.Command{
+	Use:   "segwit",
+	Short: "Show the daily share of transactions using segwit",
+	Long: `Show how many transactions per day carry witness data, the witness bytes and
+the ratio of block weight to block size, which is 4 without witness data and
+drops as segwit usage grows. Blocks scraped by older versions are left out
+until 'scrapbtc backfill --field segwit' is run.`,
+	RunE: runStatsSegwit,
+}
+
+var statsInputsCmd = &cobra.Command{
+	Use:   "inputs",
+	Short: "Show the daily share of inputs whose value and address are resolved",
+	Long: `Show how many of the inputs stored per day have their value and address
+resolved from the stored output they spend, how many spend a stored output but
+weren't resolved yet, and how many spend an output created outside the scraped
+range, which input-side analyses can't account for. Resolve them while scraping
+with --resolve-inputs or afterwards with 'scrapbtc backfill --field prevouts'.
+Supports --output text, json and csv.`,
+	RunE: runStatsInputs,
+}
+
+var statsScriptTypesCmd = &cobra.Command{
+	Use:   "script-types",
+	Short: "Show the daily mix of output script types",
+	Long: `Show how many outputs of each script type (p2pkh, p2sh, p2wpkh, p2wsh, p2tr,
+multisig, op_return, nonstandard, ...) were created per day and their share of
+the day's outputs. Types Bitcoin Core reports that aren't known to this version
+are shown as reported. Outputs scraped by older versions are left out.
+Supports --output text, json and csv.`,
+	RunE: runStatsScriptTypes,
+}
+
+var statsUSDVolumeCmd = &cobra.Command{
+	Use:   "usd-volume",
+	Short: "Show the daily output value, fees and miner revenue in BTC and USD",
+	Long: `Show the value of the non-coinbase transaction outputs, the fees and the miner
+revenue (subsidy plus fees) per day, in BTC and in USD. Each block is valued at
+the price interpolated between the price points around it when they are at
+most --max-price-gap apart, else at the latest price at or before it, or the
+next one, within 24 hours; the USD amounts leave out blocks without either,
+counted in the PRICED column.
+Supports --output text, json and csv.`,
+	RunE: runStatsUSDVolume,
+}
+
+var statsRatiosCmd = &cobra.Command{
+	Use:   "ratios",
+	Short: "Show daily NVT, fee-to-reward ratio and Mayer multiple",
+	Long: `Show price-to-chain ratios per day: NVT, the market cap of the issued supply
+divided by the value transferred by non-coinbase transactions, the share of
+fees in the miner reward, and the Mayer multiple, the price divided by its
+200-day moving average. The price of a day is the average of its price points.
+--exclude-change leaves the largest output of each transaction out of the
+transferred value as presumed change. Cached in daily_metrics with realized
+cap and SOPR. Supports --output text, json and csv.`,
+	RunE: runStatsRatios,
+}
+
+var statsDailyCmd = &cobra.Command{
+	Use:   "daily",
+	Short: "Show daily transactions, fees and volume with rolling averages",
+	Long: `Show the transactions, fees and value of the non-coinbase outputs per day.
+--rolling adds their averages over the 7, 30 or 90 days ending each day, which
+reach back before --from; windows missing stored days, at the start of the
+stored blocks or around gaps, are left empty unless --partial-windows averages
+the days they have. --ema-alpha adds exponential moving averages with that
+smoothing factor, starting from the first day. Supports --output text, json
+and csv.`,
+	RunE: runStatsDaily,
+}
+
+var statsHodlWavesCmd = &cobra.Command{
+	Use:   "hodl-waves",
+	Short: "Show the unspent outputs bucketed by coin age",
+	Long: `Show the value of the unspent outputs in each coin age band as of a height or
+the end of a date. Percentages are of the unspent value in the scraped range.
+Supports --output text, json and csv.`,
+	RunE: runStatsHodlWaves,
+}
+
+func init() {
+	statsHodlWavesCmd.Flags().StringVar(&hodlAsOf, "as-of", "", "Block height or date (YYYY-MM-DD), default: latest processed block")
+	for _, c := range []*cobra.Command{statsRealizedCapCmd, statsSOPRCmd, statsRatiosCmd} {
+		c.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+		c.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+		c.Flags().BoolVar(&interpolatePrices, "interpolate-prices", false, "Interpolate prices for blocks without price data within 24 hours instead of reporting their value as unpriced")
+		c.Flags().BoolVar(&recomputeMetrics, "recompute", false, "Recompute the daily metrics even if they are cached")
+	}
+	statsAddressesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsAddressesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsCDDCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsCDDCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsRBFCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsRBFCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsCategoriesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsCategoriesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsWatchlistCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsWatchlistCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsWatchlistCmd.Flags().StringVar(&watchedAddress, "address", "", "Only show this address")
+	statsLabelFlowsCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsLabelFlowsCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsLabelFlowsCmd.Flags().StringVar(&labelCategory, "category", "", "Only show labels of this category, e.g. exchange")
+	statsSegwitCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsSegwitCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsInputsCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsInputsCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsScriptTypesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsScriptTypesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsUSDVolumeCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsUSDVolumeCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsUSDVolumeCmd.Flags().DurationVar(&priceAtGap, "max-price-gap", db.DefaultMaxPriceGap, "Interpolate block prices only between price points at most this far apart")
+	statsRatiosCmd.Flags().BoolVar(&excludeChange, "exclude-change", false, "Leave the largest output of each transaction out of the transferred value as presumed change")
+	statsDailyCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsDailyCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsDailyCmd.Flags().StringVar(&rollingWindow, "rolling", "", "Rolling average window: 7d, 30d or 90d")
+	statsDailyCmd.Flags().BoolVar(&partialWindows, "partial-windows", false, "Average the stored days of rolling windows missing some instead of leaving them empty")
+	statsDailyCmd.Flags().Float64Var(&emaAlpha, "ema-alpha", 0, "Smoothing factor in (0, 1] of exponential moving averages, 0 for none")
+	statsBlocksCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsBlocksCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsBlocksCmd.Flags().StringVar(&granularity, "granularity", db.GranularityDay, "Period to group blocks by: day or week")
+	statsFullnessCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsFullnessCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsFullnessCmd.Flags().StringVar(&fullnessGranularity, "granularity", db.GranularityDay, "Period to group blocks by: block, day or week")
+	statsOutputDistCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsOutputDistCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsOutputDistCmd.Flags().StringVar(&outputGranularity, "granularity", db.GranularityAll, "Period to group outputs by: all (the whole range), block, day or week")
+	statsAnomaliesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsAnomaliesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsAnomaliesCmd.Flags().StringVar(&anomalyDimension, "dimension", "", "Only show anomalies of this dimension, e.g. fee_rate")
+	statsAnomaliesCmd.Flags().IntVarP(&anomalyLimit, "limit", "n", 50, "Number of anomalies to show (0 = all)")
+	statsMinersCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsMinersCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsMinersCmd.Flags().StringVar(&minersGranularity, "granularity", db.GranularityWeek, "Period to group blocks by: day or week")
+	statsEpochsCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: the first stored block")
+	statsEpochsCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsHashrateCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsHashrateCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsHashrateCmd.Flags().StringVar(&hashrateGranularity, "granularity", db.GranularityDay, "Period to estimate the hashrate for: day or week")
+	statsFeeEstimatesCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsFeeEstimatesCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsNextBlockCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsNextBlockCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsMempoolCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	statsMempoolCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	statsMempoolCmd.Flags().StringVar(&mempoolGranularity, "granularity", db.GranularityHour, "Period to group snapshots and blocks by: hour or day")
+	statsTopAddressesCmd.Flags().IntVarP(&topAddressesLimit, "limit", "n", 20, "Number of addresses to show")
+
+	statsCmd.AddCommand(statsAddressCmd)
+	statsCmd.AddCommand(statsTopAddressesCmd)
+	statsCmd.AddCommand(statsAddressesCmd)
+	statsCmd.AddCommand(statsCDDCmd)
+	statsCmd.AddCommand(statsRealizedCapCmd)
+	statsCmd.AddCommand(statsSOPRCmd)
+	statsCmd.AddCommand(statsRatiosCmd)
+	statsCmd.AddCommand(statsHodlWavesCmd)
+	statsCmd.AddCommand(statsBlocksCmd)
+	statsCmd.AddCommand(statsFullnessCmd)
+	statsCmd.AddCommand(statsOutputDistCmd)
+	statsCmd.AddCommand(statsAnomaliesCmd)
+	statsCmd.AddCommand(statsEpochsCmd)
+	statsCmd.AddCommand(statsHashrateCmd)
+	statsCmd.AddCommand(statsMempoolCmd)
+	statsCmd.AddCommand(statsFeeEstimatesCmd)
+	statsCmd.AddCommand(statsNextBlockCmd)
+	statsCmd.AddCommand(statsMinersCmd)
+	statsCmd.AddCommand(statsRBFCmd)
+	statsCmd.AddCommand(statsCategoriesCmd)
+	statsCmd.AddCommand(statsWatchlistCmd)
+	statsCmd.AddCommand(statsLabelFlowsCmd)
+	statsCmd.AddCommand(statsSegwitCmd)
+	statsCmd.AddCommand(statsInputsCmd)
+	statsCmd.AddCommand(statsScriptTypesCmd)
+	statsCmd.AddCommand(statsUSDVolumeCmd)
+	statsCmd.AddCommand(statsDailyCmd)
+	rootCmd.AddCommand(statsCmd)
+}
+
+// openStatsDB validates the shared report flags against the formats the
+// command supports and opens the database.
+func openStatsDB(formats ...string) (db.Store, error) {
+	if err := validateOutputFormat(formats...); err != nil {
+		return nil, err
+	}
+	// Remote databases and lakes are only ever read
+	return openDatabase(dbReadOnly || db.IsRemote(dbPath) || lakeDir != "")
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatBTC(sats int64) string {
+	return fmt.Sprintf("%.8f", float64(sats)/1e8)
+}
+
+// addressName is the label of an address in text tables, or the address if
+// it has none.
+func addressName(address, label string) string {
+	if label != "" {
+		return label
+	}
+	return address
+}
+
+// parseDateRange turns --from/--to dates into a half-open time range that
+// includes the whole end day. Missing dates default to the last year.
+func parseDateRange(from, to string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year()-1, now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start date format: %w", err)
+		}
+		start = t
+	}
+	if to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end date format: %w", err)
+		}
+		end = t
+	}
+
+	return start, end.AddDate(0, 0, 1), nil
+}
+
+func runStatsAddress(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetAddressBalance(args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("address %s not found in the scraped data", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get address balance: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(stats)
+	}
+
+	fmt.Printf("Address:         %s\n", stats.Address)
+	fmt.Printf("Balance:         %s BTC\n", formatBTC(stats.Balance))
+	fmt.Printf("Total received:  %s BTC\n", formatBTC(stats.TotalReceived))
+	fmt.Printf("Total sent:      %s BTC\n", formatBTC(stats.TotalSent))
+	fmt.Printf("UTXOs:           %d\n", stats.UTXOCount)
+	fmt.Printf("First seen:      block %d\n", stats.FirstSeenHeight)
+	fmt.Printf("Last seen:       block %d\n", stats.LastSeenHeight)
+	return nil
+}
+
+func runStatsTopAddresses(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetTopAddresses(topAddressesLimit)
+	if err != nil {
+		return fmt.Errorf("failed to get top addresses: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tADDRESS\tBALANCE (BTC)\tRECEIVED (BTC)\tUTXOS\tFIRST SEEN\tLAST SEEN")
+	for i, s := range stats {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\n",
+			i+1, addressName(s.Address, s.Label), formatBTC(s.Balance), formatBTC(s.TotalReceived),
+			s.UTXOCount, s.FirstSeenHeight, s.LastSeenHeight)
+	}
+	return w.Flush()
+}
+
+// addressDay is a day of stats addresses.
+type addressDay struct {
+	Day    time.Time `json:"day"`
+	New    int64     `json:"new"`
+	Active int64     `json:"active"`
+}
+
+func runStatsAddresses(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	newAddresses, err := database.GetNewAddressesPerDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get new addresses: %w", err)
+	}
+	active, err := database.GetActiveAddressesPerDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get active addresses: %w", err)
+	}
+
+	// Days with only spends of outputs older than the scraped range have
+	// no new addresses, so merge by day
+	byDay := make(map[time.Time]*addressDay)
+	var days []*addressDay
+	day := func(t time.Time) *addressDay {
+		d, ok := byDay[t]
+		if !ok {
+			d = &addressDay{Day: t}
+			byDay[t] = d
+			days = append(days, d)
+		}
+		return d
+	}
+	for _, c := range newAddresses {
+		day(c.Day).New = c.Addresses
+	}
+	for _, c := range active {
+		day(c.Day).Active = c.Addresses
+	}
+	slices.SortFunc(days, func(a, b *addressDay) int { return a.Day.Compare(b.Day) })
+
+	if outputFormat == "json" {
+		return printJSON(days)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tNEW\tACTIVE")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", d.Day.Format("2006-01-02"), d.New, d.Active)
+	}
+	return w.Flush()
+}
+
+func runStatsCDD(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetDailyCDD(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get coin days destroyed: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(days)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tCDD (BTC-DAYS)\tSPENT (BTC)\tAVG DORMANCY (DAYS)")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%.2f\t%s\t%.2f\n",
+			d.Day.Format("2006-01-02"), d.CoinDaysDestroyed, formatBTC(d.ValueSpent), d.AvgDormancy)
+	}
+	return w.Flush()
+}
+
+func dailyMetrics() ([]*models.DailyMetrics, error) {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return nil, err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	metrics, err := analysis.DailyMetrics(database, from, to, interpolatePrices, recomputeMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute daily metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+func runStatsRBF(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetRBFShareByDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get RBF signaling: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(days)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tTRANSACTIONS\tSIGNALING RBF\tSHARE")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\n", d.Day.Format("2006-01-02"), d.Transactions, d.Signaling, d.Percent)
+	}
+	return w.Flush()
+}
+
+func runStatsCategories(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetTxCategoriesByDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction categories: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(days)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "transactions", "consolidations", "batches", "simple", "other"})
+		for _, d := range days {
+			w.Write([]string{
+				d.Day.Format(time.DateOnly), strconv.FormatInt(d.Transactions, 10),
+				strconv.FormatInt(d.Consolidations, 10), strconv.FormatInt(d.Batches, 10),
+				strconv.FormatInt(d.Simple, 10), strconv.FormatInt(d.Other, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	share := func(n, total int64) string {
+		return fmt.Sprintf("%d (%.1f%%)", n, float64(n)/float64(total)*100)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tTRANSACTIONS\tCONSOLIDATIONS\tBATCHES\tSIMPLE\tOTHER")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", d.Day.Format(time.DateOnly), d.Transactions,
+			share(d.Consolidations, d.Transactions), share(d.Batches, d.Transactions),
+			share(d.Simple, d.Transactions), share(d.Other, d.Transactions))
+	}
+	return w.Flush()
+}
+
+func runStatsWatchlist(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetWatchlistByDay(from, to, watchedAddress)
+	if err != nil {
+		return fmt.Errorf("failed to get the watched activity: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(days)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "address", "label", "inflows", "received", "outflows", "sent"})
+		for _, d := range days {
+			w.Write([]string{
+				d.Day.Format(time.DateOnly), d.Address, d.Label,
+				strconv.FormatInt(d.Inflows, 10), strconv.FormatInt(d.Received, 10),
+				strconv.FormatInt(d.Outflows, 10), strconv.FormatInt(d.Sent, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tADDRESS\tINFLOWS\tRECEIVED (BTC)\tOUTFLOWS\tSENT (BTC)\tNET (BTC)")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\n", d.Day.Format(time.DateOnly), addressName(d.Address, d.Label),
+			d.Inflows, formatBTC(d.Received), d.Outflows, formatBTC(d.Sent), formatBTC(d.Received-d.Sent))
+	}
+	return w.Flush()
+}
+
+func runStatsLabelFlows(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	all, err := database.GetFlowsByLabel(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get the flows by label: %w", err)
+	}
+	var flows []*models.LabelFlow
+	for _, f := range all {
+		if labelCategory == "" || f.Category == strings.ToLower(labelCategory) {
+			flows = append(flows, f)
+		}
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(flows)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "label", "category", "inflow", "outflow", "net"})
+		for _, f := range flows {
+			w.Write([]string{
+				f.Day.Format(time.DateOnly), f.Label, f.Category,
+				strconv.FormatInt(f.Inflow, 10), strconv.FormatInt(f.Outflow, 10), strconv.FormatInt(f.Net, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tLABEL\tCATEGORY\tINFLOW (BTC)\tOUTFLOW (BTC)\tNET (BTC)")
+	for _, f := range flows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Day.Format(time.DateOnly), f.Label, f.Category,
+			formatBTC(f.Inflow), formatBTC(f.Outflow), formatBTC(f.Net))
+	}
+	return w.Flush()
+}
+
+func runStatsSegwit(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetSegwitAdoptionByDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get segwit usage: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(days)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tBLOCKS\tTRANSACTIONS\tSEGWIT\tSHARE\tWITNESS BYTES\tWEIGHT/SIZE")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.2f%%\t%d\t%.3f\n",
+			d.Day.Format("2006-01-02"), d.Blocks, d.Transactions, d.SegwitTxs, d.Percent, d.WitnessBytes, d.WeightRatio)
+	}
+	return w.Flush()
+}
+
+func runStatsInputs(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetInputResolution(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get input resolution: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(days)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "inputs", "resolved", "resolvable", "missing", "resolved_pct"})
+		for _, d := range days {
+			w.Write([]string{
+				d.Day.Format(time.DateOnly), strconv.FormatInt(d.Inputs, 10), strconv.FormatInt(d.Resolved, 10),
+				strconv.FormatInt(d.Resolvable, 10), strconv.FormatInt(d.Missing, 10), strconv.FormatFloat(d.Percent, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tINPUTS\tRESOLVED\tRESOLVABLE\tMISSING\tRESOLVED %")
+	for _, d := range days {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.2f%%\n",
+			d.Day.Format("2006-01-02"), d.Inputs, d.Resolved, d.Resolvable, d.Missing, d.Percent)
+	}
+	return w.Flush()
+}
+
+func runStatsScriptTypes(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetOutputTypeDistribution(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get output script types: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "script_type", "outputs", "value_sats", "percent"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Day.Format("2006-01-02"), s.ScriptType, strconv.FormatInt(s.Outputs, 10),
+				strconv.FormatInt(s.Value, 10), strconv.FormatFloat(s.Percent, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tTYPE\tOUTPUTS\tSHARE\tVALUE (BTC)")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f%%\t%s\n",
+			s.Day.Format("2006-01-02"), s.ScriptType, s.Outputs, s.Percent, formatBTC(s.Value))
+	}
+	return w.Flush()
+}
+
+func runStatsUSDVolume(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	database.SetMaxPriceGap(priceAtGap)
+	volumes, err := database.GetUSDVolumeByDay(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get USD volume: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(volumes)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "blocks", "priced_blocks", "output_value_sats", "output_value_usd",
+			"fees_sats", "fees_usd", "miner_revenue_sats", "miner_revenue_usd"})
+		for _, v := range volumes {
+			w.Write([]string{
+				v.Day.Format("2006-01-02"), strconv.FormatInt(v.Blocks, 10), strconv.FormatInt(v.PricedBlocks, 10),
+				strconv.FormatInt(v.OutputValue, 10), strconv.FormatFloat(v.OutputValueUSD, 'f', 2, 64),
+				strconv.FormatInt(v.Fees, 10), strconv.FormatFloat(v.FeesUSD, 'f', 2, 64),
+				strconv.FormatInt(v.MinerRevenue, 10), strconv.FormatFloat(v.MinerRevenueUSD, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tBLOCKS\tPRICED\tOUTPUTS (BTC)\tOUTPUTS (USD)\tFEES (BTC)\tFEES (USD)\tMINER REVENUE (BTC)\tMINER REVENUE (USD)")
+	for _, v := range volumes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.2f\t%s\t%.2f\t%s\t%.2f\n",
+			v.Day.Format("2006-01-02"), v.Blocks, v.PricedBlocks,
+			formatBTC(v.OutputValue), v.OutputValueUSD,
+			formatBTC(v.Fees), v.FeesUSD,
+			formatBTC(v.MinerRevenue), v.MinerRevenueUSD)
+	}
+	return w.Flush()
+}
+
+// parseRollingWindow returns the number of days of a --rolling window, 0
+// for none.
+func parseRollingWindow(window string) (int, error) {
+	switch window {
+	case "":
+		return 0, nil
+	case "7d":
+		return 7, nil
+	case "30d":
+		return 30, nil
+	case "90d":
+		return 90, nil
+	}
+	return 0, fmt.Errorf("invalid rolling window %q: must be 7d, 30d or 90d", window)
+}
+
+// formatOptional formats an optional value with prec decimals, empty if
+// it's missing.
+func formatOptional(v *float64, prec int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', prec, 64)
+}
+
+func runStatsDaily(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+	window, err := parseRollingWindow(rollingWindow)
+	if err != nil {
+		return err
+	}
+	if emaAlpha < 0 || emaAlpha > 1 {
+		return fmt.Errorf("invalid --ema-alpha %g: must be in (0, 1]", emaAlpha)
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	days, err := database.GetDailyStats(from, to, db.DailyStatsOptions{
+		RollingWindow:  window,
+		PartialWindows: partialWindows,
+		EMAAlpha:       emaAlpha,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get daily stats: %w", err)
+	}
+	if outputFormat == "json" {
+		return printJSON(days)
+	}
+
+	// Fees and volume are averaged in BTC
+	btc := func(v *float64) *float64 {
+		if v == nil {
+			return nil
+		}
+		b := *v / 1e8
+		return &b
+	}
+	header := []string{"day", "blocks", "transactions", "fees_sats", "volume_sats"}
+	columns := []string{"DAY", "BLOCKS", "TRANSACTIONS", "FEES (BTC)", "VOLUME (BTC)"}
+	if window > 0 {
+		header = append(header, "transactions_avg", "fees_avg_sats", "volume_avg_sats")
+		columns = append(columns, fmt.Sprintf("TRANSACTIONS (%s)", rollingWindow),
+			fmt.Sprintf("FEES (%s, BTC)", rollingWindow), fmt.Sprintf("VOLUME (%s, BTC)", rollingWindow))
+	}
+	if emaAlpha > 0 {
+		header = append(header, "transactions_ema", "fees_ema_sats", "volume_ema_sats")
+		columns = append(columns, "TRANSACTIONS (EMA)", "FEES (EMA, BTC)", "VOLUME (EMA, BTC)")
+	}
+
+	if outputFormat == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		for _, d := range days {
+			record := []string{d.Day.Format("2006-01-02"), strconv.FormatInt(d.Blocks, 10),
+				strconv.FormatInt(d.Transactions, 10), strconv.FormatInt(d.Fees, 10), strconv.FormatInt(d.Volume, 10)}
+			if window > 0 {
+				record = append(record, formatOptional(d.TransactionsAvg, 2), formatOptional(d.FeesAvg, 0), formatOptional(d.VolumeAvg, 0))
+			}
+			if emaAlpha > 0 {
+				record = append(record, formatOptional(d.TransactionsEMA, 2), formatOptional(d.FeesEMA, 0), formatOptional(d.VolumeEMA, 0))
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, d := range days {
+		fields := []string{d.Day.Format("2006-01-02"), strconv.FormatInt(d.Blocks, 10),
+			strconv.FormatInt(d.Transactions, 10), formatBTC(d.Fees), formatBTC(d.Volume)}
+		if window > 0 {
+			fields = append(fields, formatOptional(d.TransactionsAvg, 1), formatOptional(btc(d.FeesAvg), 8), formatOptional(btc(d.VolumeAvg), 8))
+		}
+		if emaAlpha > 0 {
+			fields = append(fields, formatOptional(d.TransactionsEMA, 1), formatOptional(btc(d.FeesEMA), 8), formatOptional(btc(d.VolumeEMA), 8))
+		}
+		for i, f := range fields {
+			if f == "" {
+				fields[i] = "-"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	return w.Flush()
+}
+
+func runStatsRealizedCap(cmd *cobra.Command, args []string) error {
+	metrics, err := dailyMetrics()
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return printJSON(metrics)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tSUPPLY (BTC)\tREALIZED CAP (USD)\tUNPRICED (BTC)")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%s\n",
+			m.Day.Format("2006-01-02"), formatBTC(m.Supply), m.RealizedCap, formatBTC(m.UnpricedSupply))
+	}
+	return w.Flush()
+}
+
+func runStatsSOPR(cmd *cobra.Command, args []string) error {
+	metrics, err := dailyMetrics()
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == "json" {
+		return printJSON(metrics)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tSPENT (BTC)\tSOPR\tUNPRICED SPENT (BTC)")
+	for _, m := range metrics {
+		sopr := "-"
+		if m.SOPR != nil {
+			sopr = fmt.Sprintf("%.4f", *m.SOPR)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			m.Day.Format("2006-01-02"), formatBTC(m.ValueSpent), sopr, formatBTC(m.UnpricedSpent))
+	}
+	return w.Flush()
+}
+
+func runStatsRatios(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ratios, err := analysis.DailyRatios(database, from, to, excludeChange, interpolatePrices, recomputeMetrics)
+	if err != nil {
+		return fmt.Errorf("failed to compute daily ratios: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(ratios)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "price_usd", "market_cap_usd", "transferred_sats", "nvt", "fee_reward_ratio", "mayer_multiple"})
+		for _, r := range ratios {
+			w.Write([]string{
+				r.Day.Format("2006-01-02"), formatOptional(r.Price, 2), formatOptional(r.MarketCap, 0),
+				strconv.FormatInt(r.TransferredValue, 10), formatOptional(r.NVT, 2),
+				formatOptional(r.FeeRewardRatio, 6), formatOptional(r.MayerMultiple, 4),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tPRICE (USD)\tMARKET CAP (USD)\tTRANSFERRED (BTC)\tNVT\tFEES/REWARD\tMAYER")
+	for _, r := range ratios {
+		feeShare := "-"
+		if r.FeeRewardRatio != nil {
+			feeShare = fmt.Sprintf("%.2f%%", *r.FeeRewardRatio*100)
+		}
+		fields := []string{formatOptional(r.Price, 2), formatOptional(r.MarketCap, 0), formatOptional(r.NVT, 2), formatOptional(r.MayerMultiple, 4)}
+		for i, f := range fields {
+			if f == "" {
+				fields[i] = "-"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Day.Format("2006-01-02"), fields[0], fields[1],
+			formatBTC(r.TransferredValue), fields[2], feeShare, fields[3])
+	}
+	return w.Flush()
+}
+
+// resolveAsOf turns --as-of into a stored block height. A date means the last
+// block of that day.
+func resolveAsOf(database db.Store, asOf string) (int64, error) {
+	if asOf == "" {
+		return database.GetMaxProcessedHeight()
+	}
+	if height, err := strconv.ParseInt(asOf, 10, 64); err == nil {
+		return height, nil
+	}
+	t, err := time.Parse("2006-01-02", asOf)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --as-of %q: must be a block height or YYYY-MM-DD", asOf)
+	}
+	height, err := database.GetHeightBefore(t.AddDate(0, 0, 1))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("no stored block on or before %s", asOf)
+	}
+	return height, err
+}
+
+func runStatsHodlWaves(cmd *cobra.Command, args []string) error {
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	height, err := resolveAsOf(database, hodlAsOf)
+	if err != nil {
+		return err
+	}
+
+	bands, err := database.GetUTXOAgeBands(height)
+	if err != nil {
+		return fmt.Errorf("failed to get UTXO age bands: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(struct {
+			Height int64                 `json:"height"`
+			Bands  []*models.UTXOAgeBand `json:"bands"`
+		}{height, bands})
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"height", "band", "count", "value_btc", "percent"})
+		for _, b := range bands {
+			w.Write([]string{
+				strconv.FormatInt(height, 10), b.Band, strconv.FormatInt(b.Count, 10),
+				formatBTC(b.Value), strconv.FormatFloat(b.Percent, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	fmt.Printf("UTXO age bands as of block %d\n\n", height)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BAND\tUTXOS\tVALUE (BTC)\tSHARE")
+	for _, b := range bands {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.2f%%\n", b.Band, b.Count, formatBTC(b.Value), b.Percent)
+	}
+	return w.Flush()
+}
+
+func runStatsBlocks(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetBlockIntervalStats(from, to, granularity)
+	if err != nil {
+		return fmt.Errorf("failed to get block interval stats: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "blocks", "avg_interval_s", "median_interval_s", "negative_intervals", "difficulty", "hashrate_hs"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Period.Format("2006-01-02"), strconv.FormatInt(s.Blocks, 10),
+				strconv.FormatFloat(s.AvgInterval, 'f', 1, 64), strconv.FormatFloat(s.MedianInterval, 'f', 1, 64),
+				strconv.FormatInt(s.NegativeIntervals, 10),
+				strconv.FormatFloat(s.Difficulty, 'f', 2, 64), strconv.FormatFloat(s.Hashrate, 'e', 4, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tBLOCKS\tAVG INTERVAL\tMEDIAN INTERVAL\tNEGATIVE\tDIFFICULTY\tHASHRATE")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%.2f\t%s\n",
+			s.Period.Format("2006-01-02"), s.Blocks,
+			time.Duration(s.AvgInterval*float64(time.Second)).Round(time.Second),
+			time.Duration(s.MedianInterval*float64(time.Second)).Round(time.Second),
+			s.NegativeIntervals, s.Difficulty, formatHashrate(s.Hashrate))
+	}
+	return w.Flush()
+}
+
+func runStatsFullness(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetBlockFullness(from, to, fullnessGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get block fullness: %w", err)
+	}
+
+	layout := time.DateOnly
+	if fullnessGranularity == db.GranularityBlock {
+		layout = time.DateTime
+	}
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "from_height", "to_height", "blocks", "fullness_pct", "full_blocks", "partial_blocks", "empty_blocks"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Period.Format(layout), strconv.FormatInt(s.FromHeight, 10), strconv.FormatInt(s.ToHeight, 10),
+				strconv.FormatInt(s.Blocks, 10), strconv.FormatFloat(s.Fullness, 'f', 2, 64),
+				strconv.FormatInt(s.FullBlocks, 10), strconv.FormatInt(s.PartialBlocks, 10), strconv.FormatInt(s.EmptyBlocks, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tHEIGHTS\tBLOCKS\tFULLNESS\tFULL\tPARTIAL\tEMPTY")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d-%d\t%d\t%.1f%%\t%d\t%d\t%d\n",
+			s.Period.Format(layout), s.FromHeight, s.ToHeight, s.Blocks, s.Fullness,
+			s.FullBlocks, s.PartialBlocks, s.EmptyBlocks)
+	}
+	return w.Flush()
+}
+
+func runStatsOutputDist(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	profile, err := database.GetMetadata(db.MetadataProfile)
+	if err != nil {
+		return err
+	}
+	if profile != "" && !models.Profile(profile).Includes(models.ProfileFull) {
+		return fmt.Errorf("the output distribution needs the outputs, which --profile %s doesn't store", profile)
+	}
+
+	stats, err := database.GetOutputValueDistribution(from, to, outputGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get the output value distribution: %w", err)
+	}
+
+	layout := time.DateOnly
+	if outputGranularity == db.GranularityBlock {
+		layout = time.DateTime
+	}
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "from_height", "to_height", "bucket", "outputs", "value"})
+		for _, s := range stats {
+			for _, b := range s.Buckets {
+				w.Write([]string{
+					s.Period.Format(layout), strconv.FormatInt(s.FromHeight, 10), strconv.FormatInt(s.ToHeight, 10),
+					b.Bucket, strconv.FormatInt(b.Count, 10), strconv.FormatInt(b.Value, 10),
+				})
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	if len(stats) == 0 {
+		fmt.Println("No outputs stored in the range.")
+		return nil
+	}
+	for i, s := range stats {
+		if i > 0 {
+			fmt.Println()
+		}
+		if outputGranularity == db.GranularityAll {
+			fmt.Printf("%d outputs created from %s to %s, heights %d-%d\n",
+				s.Outputs, from.Format(time.DateOnly), to.AddDate(0, 0, -1).Format(time.DateOnly), s.FromHeight, s.ToHeight)
+		} else {
+			fmt.Printf("%s: %d outputs, heights %d-%d\n", s.Period.Format(layout), s.Outputs, s.FromHeight, s.ToHeight)
+		}
+		printOutputHistogram(s)
+	}
+	return nil
+}
+
+// printOutputHistogram draws a bar per bucket of d, scaled to the bucket
+// with the most outputs.
+func printOutputHistogram(d *models.OutputValueDistribution) {
+	var most int64
+	for _, b := range d.Buckets {
+		most = max(most, b.Count)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, b := range d.Buckets {
+		bar := ""
+		if b.Count > 0 {
+			// Any output shows at least one mark
+			bar = " " + strings.Repeat("#", max(1, int(b.Count*histogramWidth/most)))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.1f%%\t%s\n", b.Bucket, b.Count, float64(b.Count)/float64(d.Outputs)*100, bar)
+	}
+	w.Flush()
+}
+
+func runStatsAnomalies(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+	if anomalyDimension != "" && !slices.Contains(models.AnomalyDimensions, anomalyDimension) {
+		return fmt.Errorf("invalid dimension %q: must be one of %s", anomalyDimension, strings.Join(models.AnomalyDimensions, ", "))
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	anomalies, err := database.GetAnomalies(from, to, anomalyDimension, anomalyLimit)
+	if err != nil {
+		return fmt.Errorf("failed to get anomalies: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(anomalies)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"height", "block_hash", "timestamp", "dimension", "value", "baseline", "score", "method"})
+		for _, a := range anomalies {
+			w.Write([]string{
+				strconv.FormatInt(a.Height, 10), a.BlockHash, a.Timestamp.Format(time.DateTime), a.Dimension,
+				strconv.FormatFloat(a.Value, 'f', -1, 64), strconv.FormatFloat(a.Baseline, 'f', -1, 64),
+				strconv.FormatFloat(a.Score, 'f', 2, 64), a.Method,
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	if len(anomalies) == 0 {
+		fmt.Println("No anomalies in the range; find them with scrapbtc analyze anomalies.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HEIGHT\tTIME\tDIMENSION\tVALUE\tBASELINE\tSCORE")
+	for _, a := range anomalies {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%+.1f\n",
+			a.Height, a.Timestamp.Format(time.DateTime), a.Dimension, formatScoreValue(a.Value), formatScoreValue(a.Baseline), a.Score)
+	}
+	return w.Flush()
+}
+
+// formatScoreValue formats a value or baseline of an anomaly, which are
+// whole numbers but for fee rates and averages, to two decimals at most.
+func formatScoreValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func runStatsEpochs(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+	if statsFrom == "" {
+		from = time.Time{}
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetEpochStats(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get epoch stats: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"epoch", "first_height", "last_height", "first_block", "last_block", "blocks", "avg_fees_btc", "subsidy_btc", "issued_btc"})
+		for _, s := range stats {
+			w.Write([]string{
+				strconv.FormatInt(s.Epoch, 10), strconv.FormatInt(s.FirstHeight, 10), strconv.FormatInt(s.LastHeight, 10),
+				s.FirstBlock.Format("2006-01-02"), s.LastBlock.Format("2006-01-02"), strconv.FormatInt(s.Blocks, 10),
+				strconv.FormatFloat(s.AvgFees/1e8, 'f', 8, 64), formatBTC(s.Subsidy), formatBTC(s.Issued),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EPOCH\tHEIGHTS\tDATES\tBLOCKS\tAVG FEES (BTC)\tSUBSIDY (BTC)\tISSUED (BTC)")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%d\t%d-%d\t%s to %s\t%d\t%.8f\t%s\t%s\n",
+			s.Epoch, s.FirstHeight, s.LastHeight, s.FirstBlock.Format("2006-01-02"), s.LastBlock.Format("2006-01-02"),
+			s.Blocks, s.AvgFees/1e8, formatBTC(s.Subsidy), formatBTC(s.Issued))
+	}
+	return w.Flush()
+}
+
+func runStatsHashrate(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	estimates, err := database.GetHashrateEstimates(from, to, hashrateGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get hashrate estimates: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(estimates)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "height", "chainwork", "hashrate_hs"})
+		for _, e := range estimates {
+			w.Write([]string{
+				e.Period.Format("2006-01-02"), strconv.FormatInt(e.Height, 10), e.Chainwork,
+				strconv.FormatFloat(e.Hashrate, 'e', 4, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tHEIGHT\tHASHRATE")
+	for _, e := range estimates {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", e.Period.Format("2006-01-02"), e.Height, formatHashrate(e.Hashrate))
+	}
+	return w.Flush()
+}
+
+func formatHashrate(hs float64) string {
+	units := []string{"H/s", "kH/s", "MH/s", "GH/s", "TH/s", "PH/s", "EH/s", "ZH/s"}
+	i := 0
+	for hs >= 1000 && i < len(units)-1 {
+		hs /= 1000
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", hs, units[i])
+}
+
+func runStatsMempool(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetMempoolFullness(from, to, mempoolGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get mempool stats: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "snapshots", "avg_mempool_txs", "avg_mempool_vbytes", "max_mempool_vbytes", "blocks", "fullness_pct", "fees_sat"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Period.Format(time.DateTime), strconv.FormatInt(s.Snapshots, 10),
+				strconv.FormatFloat(s.AvgMempoolTxs, 'f', 0, 64), strconv.FormatFloat(s.AvgMempoolBytes, 'f', 0, 64),
+				strconv.FormatInt(s.MaxMempoolBytes, 10), strconv.FormatInt(s.Blocks, 10),
+				strconv.FormatFloat(s.Fullness, 'f', 2, 64), strconv.FormatInt(s.Fees, 10),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tSNAPSHOTS\tMEMPOOL TXS\tMEMPOOL MB\tPEAK MB\tBLOCKS\tFULLNESS\tFEES (BTC)")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%.1f\t%.1f\t%d\t%.1f%%\t%s\n",
+			s.Period.Format("2006-01-02 15:04"), s.Snapshots, s.AvgMempoolTxs,
+			s.AvgMempoolBytes/1e6, float64(s.MaxMempoolBytes)/1e6,
+			s.Blocks, s.Fullness, formatBTC(s.Fees))
+	}
+	return w.Flush()
+}
+
+func runStatsFeeEstimates(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetFeeEstimateAccuracy(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get fee estimate accuracy: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "target", "estimates", "avg_estimate", "avg_median_fee_rate", "mean_absolute_error", "above_median_pct"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Day.Format(time.DateOnly), strconv.Itoa(s.Target), strconv.FormatInt(s.Estimates, 10),
+				strconv.FormatFloat(s.AvgEstimate, 'f', 2, 64), strconv.FormatFloat(s.AvgMedianFeeRate, 'f', 2, 64),
+				strconv.FormatFloat(s.MeanAbsoluteError, 'f', 2, 64), strconv.FormatFloat(s.AboveMedian, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tTARGET\tESTIMATES\tAVG ESTIMATE\tAVG MEDIAN\tMEAN ABS ERROR\tAT OR ABOVE MEDIAN")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f sat/vB\t%.1f sat/vB\t%.1f sat/vB\t%.1f%%\n",
+			s.Day.Format("2006-01-02"), s.Target, s.Estimates, s.AvgEstimate, s.AvgMedianFeeRate,
+			s.MeanAbsoluteError, s.AboveMedian)
+	}
+	return w.Flush()
+}
+
+func runStatsNextBlock(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	stats, err := database.GetNextBlockFees(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get next block fees: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"day", "blocks", "avg_template_txs", "avg_block_txs", "template_fees_sat", "block_fees_sat", "fees_left_sat", "avg_min_fee_rate"})
+		for _, s := range stats {
+			w.Write([]string{
+				s.Day.Format(time.DateOnly), strconv.FormatInt(s.Blocks, 10),
+				strconv.FormatFloat(s.TemplateTxs, 'f', 1, 64), strconv.FormatFloat(s.BlockTxs, 'f', 1, 64),
+				strconv.FormatInt(s.TemplateFees, 10), strconv.FormatInt(s.BlockFees, 10), strconv.FormatInt(s.FeesLeft, 10),
+				strconv.FormatFloat(s.AvgMinFeeRate, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tBLOCKS\tTEMPLATE TXS\tBLOCK TXS\tTEMPLATE FEES\tBLOCK FEES\tLEFT\tAVG FLOOR")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%.0f\t%s\t%s\t%s\t%.1f sat/vB\n",
+			s.Day.Format(time.DateOnly), s.Blocks, s.TemplateTxs, s.BlockTxs,
+			formatBTC(s.TemplateFees), formatBTC(s.BlockFees), formatBTC(s.FeesLeft), s.AvgMinFeeRate)
+	}
+	return w.Flush()
+}
+
+func runStatsMiners(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB("text", "json", "csv")
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	shares, err := database.GetMinerShares(from, to, minersGranularity)
+	if err != nil {
+		return fmt.Errorf("failed to get miner shares: %w", err)
+	}
+
+	switch outputFormat {
+	case "json":
+		return printJSON(shares)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"period", "miner", "blocks", "percent"})
+		for _, s := range shares {
+			w.Write([]string{
+				s.Period.Format("2006-01-02"), s.MinerTag, strconv.FormatInt(s.Blocks, 10),
+				strconv.FormatFloat(s.Percent, 'f', 2, 64),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tMINER\tBLOCKS\tSHARE")
+	for _, s := range shares {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f%%\n", s.Period.Format("2006-01-02"), s.MinerTag, s.Blocks, s.Percent)
+	}
+	return w.Flush()
+}
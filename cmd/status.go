@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/processor"
+	"scrapbtc/pkg/models"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusSince string
+	statusWatch bool
+	statusRun   int64
+	slowest     int
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Summarize which blocks have been processed and which failed",
+	Long: `Summarize the processing_status table: the number of blocks in each status,
+the contiguous ranges of completed heights, the gaps between them and every
+failed block with its error. --since limits the report to blocks that finished
+after a date or time, or within a duration such as 12h.
+
+With --watch the progress snapshots a scrape records in the run_progress table
+every few seconds are shown instead, until the run ends, so a scrape running in
+another terminal or detached from its own can be followed.
+
+With --slowest N the N completed blocks that took longest to store are listed
+instead, with their size, transaction count and the time spent fetching them
+over RPC, parsing them and inserting them. The total also counts retried
+fetches and waiting for memory.`,
+	RunE: runStatus,
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&statusSince, "since", "", "Only blocks finished since this date (YYYY-MM-DD), time (RFC3339) or duration ago (e.g. 12h)")
+	statusCmd.Flags().BoolVar(&statusWatch, "watch", false, "Follow the progress of a running scrape")
+	statusCmd.Flags().Int64Var(&statusRun, "run", 0, "Run to follow with --watch (default: the latest)")
+	statusCmd.Flags().IntVar(&slowest, "slowest", 0, "List the N blocks that took longest to store")
+	rootCmd.AddCommand(statusCmd)
+}
+
+// StatusReport is the output of the status command.
+type StatusReport struct {
+	*models.StatusSummary
+	Failed []*models.FailedBlock `json:"failed"`
+}
+
+// parseSince parses --since as a duration before now, a date or an RFC3339
+// time. Dates are UTC days, like the dates of every other command. An empty
+// value returns the zero time.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return models.Now().Add(-d), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: expected a duration, YYYY-MM-DD or RFC3339 time", s)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	since, err := parseSince(statusSince)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if statusWatch {
+		return watchProgress(database)
+	}
+	if slowest > 0 {
+		return printSlowest(database, since)
+	}
+
+	summary, err := database.GetStatusSummary(since)
+	if err != nil {
+		return fmt.Errorf("failed to get processing status: %w", err)
+	}
+	failed, err := database.GetFailedBlocks(since)
+	if err != nil {
+		return fmt.Errorf("failed to get failed blocks: %w", err)
+	}
+
+	if outputFormat == "json" {
+		return printJSON(StatusReport{StatusSummary: summary, Failed: failed})
+	}
+
+	statuses := make([]string, 0, len(summary.Counts))
+	for status := range summary.Counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Blocks:\t%d\n", summary.Total)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %s\t%d\n", status, summary.Counts[status])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(summary.CompletedRanges) > 0 {
+		fmt.Println("\nCompleted ranges:")
+		for _, r := range summary.CompletedRanges {
+			fmt.Printf("  %s complete\n", formatHeightRange(r))
+		}
+	}
+	if len(summary.Gaps) > 0 {
+		fmt.Println("\nGaps:")
+		for _, r := range summary.Gaps {
+			fmt.Printf("  %s missing\n", formatHeightRange(r))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	fmt.Printf("\nFailed blocks (%d):\n", len(failed))
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HEIGHT\tSTARTED\tFAILED\tHASH\tERROR")
+	for _, b := range failed {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", b.Height,
+			b.StartedAt.Format(time.DateTime), b.FailedAt.Format(time.DateTime), b.Hash, b.Error)
+	}
+	return w.Flush()
+}
+
+// printSlowest lists the --slowest blocks that took longest to store.
+func printSlowest(database db.Store, since time.Time) error {
+	blocks, err := database.GetSlowestBlocks(slowest, since)
+	if err != nil {
+		return fmt.Errorf("failed to get block timings: %w", err)
+	}
+	if outputFormat == "json" {
+		return printJSON(blocks)
+	}
+	if len(blocks) == 0 {
+		fmt.Println("No block timings recorded")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HEIGHT\tSIZE\tTXS\tRPC MS\tPARSE MS\tDB MS\tTOTAL MS")
+	for _, b := range blocks {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%d\n", b.Height, b.Size, b.TxCount,
+			b.RPCFetchMs, b.ParseMs, b.DBInsertMs, b.TotalMs)
+	}
+	return w.Flush()
+}
+
+func formatHeightRange(r models.HeightRange) string {
+	if r.From == r.To {
+		return fmt.Sprintf("%d (1 block)", r.From)
+	}
+	return fmt.Sprintf("%d-%d (%d blocks)", r.From, r.To, r.To-r.From+1)
+}
+
+// watchProgress prints the progress snapshot of the --run run, or of the
+// latest one, whenever it changes, until the run is no longer running.
+func watchProgress(database db.Store) error {
+	ticker := time.NewTicker(processor.DefaultSnapshotInterval)
+	defer ticker.Stop()
+
+	var last *models.RunProgress
+	for {
+		p, err := database.GetRunProgress(statusRun)
+		if err != nil {
+			return err
+		}
+		switch {
+		case p == nil && last == nil:
+			fmt.Fprintln(os.Stderr, "Waiting for a run to record its progress...")
+			last = &models.RunProgress{}
+		case p != nil && (last == nil || !p.UpdatedAt.Equal(last.UpdatedAt) || p.Status != last.Status):
+			if err := printProgress(p); err != nil {
+				return err
+			}
+			last = p
+		}
+		if p != nil && p.Status != models.RunRunning {
+			return nil
+		}
+		<-ticker.C
+	}
+}
+
+func printProgress(p *models.RunProgress) error {
+	if outputFormat == "json" {
+		return json.NewEncoder(os.Stdout).Encode(p)
+	}
+	_, err := fmt.Printf("%s run %d %s, heights %d-%d: %d blocks processed, %d failed, %d transactions, %.1f blocks/min\n",
+		p.UpdatedAt.Format(time.DateTime), p.RunID, p.Status, p.FromHeight, p.ToHeight,
+		p.Processed, p.Failed, p.TotalTxs, p.Rate)
+	return err
+}
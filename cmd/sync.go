@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncSource       string
+	syncDest         string
+	syncFromHeight   int64
+	syncPreferSource bool
+	syncDryRun       bool
+	syncBatchSize    int
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Copy the blocks another database has and this one lacks",
+	Long: `Attach the --source database and copy the blocks it completed that the
+destination (--dest, default --database) hasn't, with their transactions,
+inputs, outputs and other per-block rows, in height order and in batches of
+--batch-size blocks per transaction. The copied blocks are linked to the
+outputs and inputs already stored and applied to the address rollups as if
+they were scraped, so the destination reads as if it had scraped them itself.
+Price data, address labels and block stats the destination lacks are copied
+too; runs, node snapshots, fee estimates and anomalies are not.
+
+A height both databases completed with different blocks is a conflict: it is
+reported and keeps the destination's block, unless --prefer-source replaces it
+with the source's. --dry-run lists the heights to copy and the conflicts
+without writing anything. Both databases must use the same --db-driver, and
+the source must not be open for writing by another process.`,
+	RunE: runSync,
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncSource, "source", "", "Database file to copy blocks from")
+	syncCmd.Flags().StringVar(&syncDest, "dest", "", "Database file to copy blocks to, default: --database")
+	syncCmd.Flags().Int64Var(&syncFromHeight, "from-height", 0, "Only copy blocks at or above this height")
+	syncCmd.Flags().BoolVar(&syncPreferSource, "prefer-source", false, "Replace the destination's block with the source's where they differ")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "List the heights to copy and the conflicts without copying")
+	syncCmd.Flags().IntVar(&syncBatchSize, "batch-size", 1000, "Number of blocks copied per transaction")
+	syncCmd.MarkFlagRequired("source")
+
+	rootCmd.AddCommand(syncCmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if syncBatchSize < 1 {
+		return fmt.Errorf("--batch-size must be at least 1")
+	}
+	if err := validateOutputFormat("text", "json"); err != nil {
+		return err
+	}
+	if syncDest != "" {
+		dbPath = syncDest
+	}
+	if same, err := sameFile(syncSource, dbPath); err != nil {
+		return err
+	} else if same {
+		return fmt.Errorf("--source and the destination are the same database %s", dbPath)
+	}
+
+	database, err := openDatabase(false)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	profile, err := database.GetMetadata(db.MetadataProfile)
+	if err != nil {
+		return err
+	}
+	source, err := database.AttachSyncSource(ctx, syncSource)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	plan, err := source.Plan(ctx, syncFromHeight, syncPreferSource)
+	if err != nil {
+		return err
+	}
+	if profile != "" && plan.SourceProfile != "" && profile != plan.SourceProfile {
+		return fmt.Errorf("the source is scraped with --profile %s and the destination with %s", plan.SourceProfile, profile)
+	}
+
+	if syncDryRun {
+		if outputFormat == "json" {
+			return printJSON(plan)
+		}
+		printSyncPlan(plan)
+		return nil
+	}
+	for _, c := range plan.Conflicts {
+		resolution := "keeping the destination's, add --prefer-source to replace it"
+		if syncPreferSource {
+			resolution = "replacing it with the source's"
+		}
+		fmt.Fprintf(os.Stderr, "Conflict at height %d: the source stores block %s and the destination %s, %s\n",
+			c.Height, c.SourceHash, c.DestHash, resolution)
+	}
+
+	start := time.Now()
+	for i := 0; i < len(plan.Blocks); i += syncBatchSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("interrupted after copying %d of %d blocks; sync again to copy the rest", i, len(plan.Blocks))
+		}
+		batch := plan.Blocks[i:min(i+syncBatchSize, len(plan.Blocks))]
+		if err := source.CopyBlocks(ctx, batch); err != nil {
+			return fmt.Errorf("failed to copy blocks %d-%d: %w", batch[0].Height, batch[len(batch)-1].Height, err)
+		}
+		done := i + len(batch)
+		fmt.Fprintf(os.Stderr, "Copied %d/%d blocks, up to height %d (%.0f blocks/s)\n",
+			done, len(plan.Blocks), batch[len(batch)-1].Height, float64(done)/time.Since(start).Seconds())
+	}
+	if err := source.CopyKeyedTables(ctx); err != nil {
+		return err
+	}
+	if err := source.Close(); err != nil {
+		return err
+	}
+	if profile == "" && plan.SourceProfile != "" {
+		if err := database.SetMetadata(db.MetadataProfile, plan.SourceProfile); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(infoOut(), "Copied %d blocks from %s in %s, %d conflicts\n",
+		len(plan.Blocks), syncSource, time.Since(start).Round(time.Millisecond), len(plan.Conflicts))
+	return nil
+}
+
+// sameFile reports whether the paths name the same existing file.
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to open the source database: %w", err)
+	}
+	infoB, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB) || filepath.Clean(a) == filepath.Clean(b), nil
+}
+
+func printSyncPlan(plan *models.SyncPlan) {
+	heights := make([]int64, len(plan.Blocks))
+	replaced := 0
+	for i, b := range plan.Blocks {
+		heights[i] = b.Height
+		if b.Replace {
+			replaced++
+		}
+	}
+	fmt.Printf("%d blocks to copy, %d of them replacing a header or another block:\n", len(plan.Blocks), replaced)
+	for _, r := range heightRanges(heights) {
+		fmt.Printf("  %s\n", formatHeightRange(r))
+	}
+	if len(plan.Conflicts) > 0 {
+		fmt.Printf("%d conflicts:\n", len(plan.Conflicts))
+		for _, c := range plan.Conflicts {
+			fmt.Printf("  %d: source %s, destination %s\n", c.Height, c.SourceHash, c.DestHash)
+		}
+		if !syncPreferSource {
+			fmt.Println("The destination's blocks are kept; add --prefer-source to replace them.")
+		}
+	}
+}
+
+// heightRanges merges sorted heights into consecutive ranges.
+func heightRanges(heights []int64) []models.HeightRange {
+	var ranges []models.HeightRange
+	for _, h := range heights {
+		if n := len(ranges); n > 0 && ranges[n-1].To == h-1 {
+			ranges[n-1].To = h
+			continue
+		}
+		ranges = append(ranges, models.HeightRange{From: h, To: h})
+	}
+	return ranges
+}
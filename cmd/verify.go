@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/spf13/cobra"
+)
+
+// blockHeaderSize is the size of a serialized block header, the part of a
+// block its hash is computed from.
+const blockHeaderSize = 80
+
+var verifyRawDir string
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the archived raw blocks against the stored blocks",
+	Long: `Recompute the hash of every raw block archived with --store-raw-blocks in the
+date range from its header and compare it and the block size with the stored
+blocks. Use --raw-dir to check blocks archived as files.
+
+Also checks that every stored block has as many transactions stored as it
+contains, less those left out by --min-output-value or --skip-dust, and lists the blocks whose coinbase claimed less than the subsidy of their
+height plus their fees. The coins left unclaimed are lost for good, which is
+valid, so these don't fail the check. Blocks synced with the headers command
+only are skipped.`,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().StringVarP(&statsFrom, "from", "f", "", "Start date (YYYY-MM-DD), default: 1 year ago")
+	verifyCmd.Flags().StringVarP(&statsTo, "to", "t", "", "End date (YYYY-MM-DD), default: today")
+	verifyCmd.Flags().StringVar(&verifyRawDir, "raw-dir", "", "Directory the raw blocks were archived in, default: the raw_blocks table")
+
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// VerifyMismatch is a stored block that failed a check, and why.
+type VerifyMismatch struct {
+	Height int64  `json:"height"`
+	Reason string `json:"reason"`
+}
+
+// VerifyResult summarizes a verify run. TxCounts lists the blocks whose
+// stored transactions don't add up to their transaction count, and
+// Underclaimed those whose coinbase claimed less than allowed. HeadersOnly
+// counts the blocks skipped because only their header is stored, and
+// Filtered those stored without some of their transactions on purpose.
+type VerifyResult struct {
+	Checked      int              `json:"checked"`
+	Verified     int              `json:"verified"`
+	Missing      int              `json:"missing"`
+	HeadersOnly  int              `json:"headers_only"`
+	Filtered     int              `json:"filtered"`
+	Mismatches   []VerifyMismatch `json:"mismatches"`
+	TxCounts     []VerifyMismatch `json:"tx_count_mismatches"`
+	Underclaimed []VerifyMismatch `json:"underclaimed"`
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	from, to, err := parseDateRange(statsFrom, statsTo)
+	if err != nil {
+		return err
+	}
+
+	database, err := openStatsDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	blocks, err := database.GetBlocksByTime(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get blocks: %w", err)
+	}
+
+	txCounts, err := database.GetStoredTxCounts(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to count stored transactions: %w", err)
+	}
+	// A minimal database stores no transactions to count
+	profile, err := database.GetMetadata(db.MetadataProfile)
+	if err != nil {
+		return err
+	}
+	countTxs := models.Profile(profile).Includes(models.ProfileStandard)
+
+	headersOnly := map[int64]bool{}
+	if len(blocks) > 0 {
+		fromHeight, toHeight := blocks[0].Height, blocks[0].Height
+		for _, block := range blocks {
+			fromHeight = min(fromHeight, block.Height)
+			toHeight = max(toHeight, block.Height)
+		}
+		if headersOnly, err = database.GetHeadersOnlyHeights(fromHeight, toHeight); err != nil {
+			return fmt.Errorf("failed to get header-only blocks: %w", err)
+		}
+	}
+
+	result := VerifyResult{Mismatches: []VerifyMismatch{}, TxCounts: []VerifyMismatch{}, Underclaimed: []VerifyMismatch{}}
+	for _, block := range blocks {
+		if headersOnly[block.Height] {
+			result.HeadersOnly++
+			continue
+		}
+		if block.FilteredTxCount > 0 {
+			result.Filtered++
+		}
+		if stored := txCounts[block.Hash]; countTxs && stored+block.FilteredTxCount != block.TxCount {
+			reason := fmt.Sprintf("block has %d transactions, %d stored", block.TxCount, stored)
+			if block.FilteredTxCount > 0 {
+				reason += fmt.Sprintf(" and %d filtered", block.FilteredTxCount)
+			}
+			result.TxCounts = append(result.TxCounts, VerifyMismatch{Height: block.Height, Reason: reason})
+		}
+		if reason := checkCoinbaseClaim(block); reason != "" {
+			result.Underclaimed = append(result.Underclaimed, VerifyMismatch{Height: block.Height, Reason: reason})
+		}
+
+		raw, err := loadRawBlock(database, block.Height)
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, fs.ErrNotExist) {
+			result.Missing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load raw block %d: %w", block.Height, err)
+		}
+
+		result.Checked++
+		if reason := verifyRawBlock(block, raw); reason != "" {
+			result.Mismatches = append(result.Mismatches, VerifyMismatch{Height: block.Height, Reason: reason})
+			continue
+		}
+		result.Verified++
+	}
+
+	if outputFormat == "json" {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		for _, m := range result.Mismatches {
+			fmt.Printf("Block %d: %s\n", m.Height, m.Reason)
+		}
+		for _, m := range result.TxCounts {
+			fmt.Printf("Block %d: %s\n", m.Height, m.Reason)
+		}
+		for _, m := range result.Underclaimed {
+			fmt.Printf("Block %d: %s\n", m.Height, m.Reason)
+		}
+		fmt.Printf("Checked %d raw blocks: %d verified, %d mismatched, %d blocks without a raw block\n",
+			result.Checked, result.Verified, len(result.Mismatches), result.Missing)
+		fmt.Printf("%d of %d blocks have missing or extra transactions\n", len(result.TxCounts), len(blocks))
+		fmt.Printf("%d of %d blocks claimed less than the subsidy plus fees\n", len(result.Underclaimed), len(blocks))
+		if result.Filtered > 0 {
+			fmt.Printf("%d blocks are stored without the transactions their run filtered out\n", result.Filtered)
+		}
+		if result.HeadersOnly > 0 {
+			fmt.Printf("%d blocks with only their header stored were skipped\n", result.HeadersOnly)
+		}
+	}
+
+	if len(result.Mismatches) > 0 {
+		return fmt.Errorf("%d raw blocks don't match the stored blocks", len(result.Mismatches))
+	}
+	if len(result.TxCounts) > 0 {
+		return fmt.Errorf("%d blocks don't have all their transactions stored", len(result.TxCounts))
+	}
+	return nil
+}
+
+func loadRawBlock(database db.Store, height int64) (*models.RawBlock, error) {
+	if verifyRawDir != "" {
+		return db.ReadRawBlockFile(verifyRawDir, height)
+	}
+	return database.GetRawBlock(height)
+}
+
+// checkCoinbaseClaim returns how much less than allowed the coinbase of
+// block claimed, or "" if it claimed everything it could.
+func checkCoinbaseClaim(block *models.Block) string {
+	allowed := models.SubsidyForHeight(block.Height) + block.TotalFees
+	if block.CoinbaseValue >= allowed {
+		return ""
+	}
+	return fmt.Sprintf("coinbase claimed %s BTC of %s BTC subsidy plus fees, leaving %s BTC unclaimed",
+		formatBTC(block.CoinbaseValue), formatBTC(allowed), formatBTC(allowed-block.CoinbaseValue))
+}
+
+// verifyRawBlock returns why raw doesn't match block, or "" if it does.
+func verifyRawBlock(block *models.Block, raw *models.RawBlock) string {
+	if len(raw.Data) < blockHeaderSize {
+		return fmt.Sprintf("raw block is only %d bytes", len(raw.Data))
+	}
+	if hash := chainhash.DoubleHashH(raw.Data[:blockHeaderSize]).String(); hash != block.Hash {
+		return fmt.Sprintf("header hashes to %s, stored block is %s", hash, block.Hash)
+	}
+	if raw.Hash != "" && raw.Hash != block.Hash {
+		return fmt.Sprintf("raw block was archived as %s, stored block is %s", raw.Hash, block.Hash)
+	}
+	if int64(len(raw.Data)) != int64(block.Size) {
+		return fmt.Sprintf("raw block is %d bytes, stored block size is %d", len(raw.Data), block.Size)
+	}
+	return ""
+}
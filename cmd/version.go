@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Set at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X scrapbtc/cmd.version=v1.2.0 -X scrapbtc/cmd.commit=$(git rev-parse HEAD) -X scrapbtc/cmd.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the commit and date Go embeds for builds from a checkout are
+// used.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// duckdbModule is the module whose version the version command reports.
+const duckdbModule = "github.com/marcboeker/go-duckdb"
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and build information",
+	Long: `Print the version, git commit and build date of the binary, the Go version it
+was built with and the version of the go-duckdb library. Supports --output
+text and json.`,
+	RunE: runVersion,
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
+
+// BuildInfo describes the binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	GoDuckDB  string `json:"go_duckdb"`
+}
+
+// buildInfo returns the version information set at build time, falling back
+// to the VCS settings Go embedded in the binary.
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range build.Settings {
+		switch {
+		case s.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = s.Value
+		case s.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = s.Value
+		}
+	}
+	for _, dep := range build.Deps {
+		if dep.Path == duckdbModule {
+			info.GoDuckDB = dep.Version
+			if dep.Replace != nil {
+				info.GoDuckDB = dep.Replace.Version
+			}
+		}
+	}
+	return info
+}
+
+// buildVersion returns the version recorded with each run: the version and,
+// when known, the first 12 characters of the commit, so that runs of
+// different builds of the same version can be told apart.
+func buildVersion() string {
+	info := buildInfo()
+	if len(info.Commit) >= 12 {
+		return info.Version + "-" + info.Commit[:12]
+	}
+	return info.Version
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	if err := validateOutputFormat("text", "json"); err != nil {
+		return err
+	}
+	info := buildInfo()
+	if outputFormat == "json" {
+		return printJSON(info)
+	}
+
+	fmt.Printf("scrapbtc %s\n", info.Version)
+	for _, field := range []struct{ name, value string }{
+		{"commit", info.Commit},
+		{"built", info.BuildDate},
+		{"go", info.GoVersion},
+		{"go-duckdb", info.GoDuckDB},
+	} {
+		if field.value == "" {
+			field.value = "unknown"
+		}
+		fmt.Printf("  %-10s %s\n", field.name, field.value)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package analysis
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Methods of scoring a block against the blocks before it.
+const (
+	// MethodMAD scores by the distance from the median in median absolute
+	// deviations, scaled by 1.4826 to match the standard deviation of a
+	// normal distribution. Outliers in the window barely move it.
+	MethodMAD = "mad"
+	// MethodZScore scores by the distance from the mean in standard
+	// deviations.
+	MethodZScore = "zscore"
+)
+
+// Methods lists the scoring methods of AnomalyOptions.
+var Methods = []string{MethodMAD, MethodZScore}
+
+// madScale makes the median absolute deviation of normally distributed
+// values an estimate of their standard deviation.
+const madScale = 1.4826
+
+// AnomalyOptions configure DetectAnomalies.
+type AnomalyOptions struct {
+	Method string
+	// Window is the number of blocks before a block it is scored against.
+	Window int
+	// Thresholds are the absolute scores from which a block is flagged, by
+	// dimension. Dimensions without one aren't scored.
+	Thresholds map[string]float64
+}
+
+// featureValue returns the value of a block's dimension, false if it is
+// unknown.
+func featureValue(f *models.BlockFeatures, dimension string) (float64, bool) {
+	switch dimension {
+	case models.AnomalyTxCount:
+		return float64(f.TxCount), true
+	case models.AnomalyFees:
+		return float64(f.TotalFees), true
+	case models.AnomalyFeeRate:
+		return f.FeeRate, true
+	case models.AnomalyInterval:
+		if f.Interval == nil {
+			return 0, false
+		}
+		return *f.Interval, true
+	case models.AnomalyOpReturn:
+		return float64(f.OpReturnBytes), true
+	}
+	return 0, false
+}
+
+// trailingWindow holds the last values of a dimension, in the order they
+// were added and sorted.
+type trailingWindow struct {
+	size   int
+	values []float64
+	sorted []float64
+}
+
+func (w *trailingWindow) add(v float64) {
+	if len(w.values) == w.size {
+		i, _ := slices.BinarySearch(w.sorted, w.values[0])
+		w.sorted = slices.Delete(w.sorted, i, i+1)
+		w.values = w.values[1:]
+	}
+	w.values = append(w.values, v)
+	i, _ := slices.BinarySearch(w.sorted, v)
+	w.sorted = slices.Insert(w.sorted, i, v)
+}
+
+func (w *trailingWindow) full() bool {
+	return len(w.values) == w.size
+}
+
+// score returns the baseline of the window and how many deviations v is
+// from it with method, false if the values don't vary.
+func (w *trailingWindow) score(v float64, method string) (float64, float64, bool) {
+	var baseline, deviation float64
+	if method == MethodZScore {
+		for _, x := range w.sorted {
+			baseline += x
+		}
+		baseline /= float64(len(w.sorted))
+		for _, x := range w.sorted {
+			deviation += (x - baseline) * (x - baseline)
+		}
+		deviation = math.Sqrt(deviation / float64(len(w.sorted)))
+	} else {
+		baseline = median(w.sorted)
+		deviation = madScale * w.medianDeviation(baseline)
+	}
+	if deviation == 0 {
+		return baseline, 0, false
+	}
+	return baseline, (v - baseline) / deviation, true
+}
+
+// medianDeviation returns the median of the absolute deviations of the
+// window from m. The deviations of the values below m, from the closest,
+// and of those above it are each ascending, so they are merged.
+func (w *trailingWindow) medianDeviation(m float64) float64 {
+	n := len(w.sorted)
+	split := sort.SearchFloat64s(w.sorted, m)
+	lo, hi := split-1, split
+	next := func() float64 {
+		if hi >= n || (lo >= 0 && m-w.sorted[lo] <= w.sorted[hi]-m) {
+			lo--
+			return m - w.sorted[lo+1]
+		}
+		hi++
+		return w.sorted[hi-1] - m
+	}
+	var d float64
+	for range n / 2 {
+		d = next()
+	}
+	if n%2 == 1 {
+		return next()
+	}
+	return (d + next()) / 2
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// DetectAnomalies scores the blocks of features, in height order, from the
+// index start on against the opts.Window blocks before each, and returns
+// the dimensions on which they reach the threshold. The window takes the
+// blocks before start too. It also returns the number of blocks scored:
+// those with fewer than opts.Window blocks before them aren't, nor are
+// dimensions whose window doesn't vary.
+func DetectAnomalies(features []*models.BlockFeatures, start int, opts AnomalyOptions) ([]*models.BlockAnomaly, int) {
+	detectedAt := models.Now()
+	var anomalies []*models.BlockAnomaly
+	for _, dimension := range models.AnomalyDimensions {
+		threshold, ok := opts.Thresholds[dimension]
+		if !ok {
+			continue
+		}
+		w := &trailingWindow{size: opts.Window}
+		for i, f := range features {
+			v, ok := featureValue(f, dimension)
+			if !ok {
+				continue
+			}
+			if i >= start && w.full() {
+				if baseline, score, ok := w.score(v, opts.Method); ok && math.Abs(score) >= threshold {
+					anomalies = append(anomalies, &models.BlockAnomaly{
+						Height:     f.Height,
+						BlockHash:  f.Hash,
+						Timestamp:  f.Timestamp,
+						Dimension:  dimension,
+						Value:      v,
+						Baseline:   baseline,
+						Score:      score,
+						Method:     opts.Method,
+						DetectedAt: detectedAt,
+					})
+				}
+			}
+			w.add(v)
+		}
+	}
+	slices.SortFunc(anomalies, func(a, b *models.BlockAnomaly) int {
+		if c := cmp.Compare(a.Height, b.Height); c != 0 {
+			return c
+		}
+		return slices.Index(models.AnomalyDimensions, a.Dimension) - slices.Index(models.AnomalyDimensions, b.Dimension)
+	})
+	return anomalies, max(0, len(features)-max(start, opts.Window))
+}
+
+// FindAnomalies scores the stored blocks with a timestamp in [from, to) and
+// replaces their anomalies with those found. It returns the number of
+// blocks scored and the anomalies.
+func FindAnomalies(database db.Store, from, to time.Time, opts AnomalyOptions) (int, []*models.BlockAnomaly, error) {
+	if !slices.Contains(Methods, opts.Method) {
+		return 0, nil, fmt.Errorf("invalid method %q: must be mad or zscore", opts.Method)
+	}
+	if opts.Window < 2 {
+		return 0, nil, fmt.Errorf("the window must hold at least 2 blocks")
+	}
+	features, start, err := database.GetBlockFeatures(from, to, opts.Window)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get block features: %w", err)
+	}
+	anomalies, scored := DetectAnomalies(features, start, opts)
+	if err := database.ReplaceAnomalies(from, to, anomalies); err != nil {
+		return 0, nil, err
+	}
+	return scored, anomalies, nil
+}
@@ -0,0 +1,85 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"scrapbtc/pkg/models"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMedianDeviation(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 1; n < 20; n++ {
+		w := &trailingWindow{size: n}
+		for range n {
+			w.add(float64(r.Intn(10)))
+		}
+		m := median(w.sorted)
+		var deviations []float64
+		for _, v := range w.values {
+			deviations = append(deviations, math.Abs(v-m))
+		}
+		sort.Float64s(deviations)
+		if got, want := w.medianDeviation(m), median(deviations); got != want {
+			t.Errorf("medianDeviation(%v) = %v, want %v", w.sorted, got, want)
+		}
+	}
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	genesis := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var features []*models.BlockFeatures
+	for h := range int64(30) {
+		interval := 600.0 + float64(h%3)*60
+		f := &models.BlockFeatures{
+			Height:    h,
+			Timestamp: genesis.Add(time.Duration(h) * 10 * time.Minute),
+			TxCount:   2000 + h%5*100,
+			TotalFees: 10000000,
+			FeeRate:   10 + float64(h%4),
+			Interval:  &interval,
+		}
+		features = append(features, f)
+	}
+	// A fee spike, which the z-score of a window holding it hides the next
+	// block's smaller spike behind, and an empty block after a long interval
+	features[20].FeeRate = 200
+	features[21].FeeRate = 40
+	features[25].TxCount = 1
+	*features[25].Interval = 4000
+	features[27].Interval = nil
+
+	thresholds := map[string]float64{}
+	for _, d := range models.AnomalyDimensions {
+		thresholds[d] = 3.5
+	}
+	for _, test := range []struct {
+		method string
+		want   []string
+	}{
+		{MethodMAD, []string{"20 fee_rate 200 12 +126.8", "21 fee_rate 40 12 +18.9", "25 tx_count 1 2200 -14.8", "25 interval 4000 660 +37.5"}},
+		{MethodZScore, []string{"20 fee_rate 200 11.7 +171.2", "25 tx_count 1 2200 -15.5", "25 interval 4000 654 +67.1"}},
+	} {
+		anomalies, scored := DetectAnomalies(features, 5, AnomalyOptions{Method: test.method, Window: 10, Thresholds: thresholds})
+		var got []string
+		for _, a := range anomalies {
+			got = append(got, fmt.Sprintf("%d %s %v %v %+.1f", a.Height, a.Dimension, a.Value, a.Baseline, a.Score))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s:\n got %q\nwant %q", test.method, got, test.want)
+		}
+		if scored != 20 {
+			t.Errorf("%s: scored %d blocks, want 20", test.method, scored)
+		}
+	}
+
+	// Only the dimensions with a threshold are scored
+	anomalies, _ := DetectAnomalies(features, 0, AnomalyOptions{Method: MethodMAD, Window: 10, Thresholds: map[string]float64{models.AnomalyInterval: 3.5}})
+	if len(anomalies) != 1 || anomalies[0].Dimension != models.AnomalyInterval {
+		t.Errorf("anomalies on interval only: %v", anomalies)
+	}
+}
@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"fmt"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// CoinDaysDestroyed sums the value in BTC times the age in days of every
+// spent output, and returns it together with the total value spent in
+// satoshis. Outputs spent before they were created (out-of-order block
+// timestamps) count as zero days old.
+func CoinDaysDestroyed(spent []*models.SpentOutputAge) (float64, int64) {
+	var cdd float64
+	var value int64
+	for _, s := range spent {
+		days := s.SpentAt.Sub(s.CreatedAt).Hours() / 24
+		if days < 0 {
+			days = 0
+		}
+		cdd += float64(s.Value) / 1e8 * days
+		value += s.Value
+	}
+	return cdd, value
+}
+
+// ComputeBlockCDD computes and stores the coin days destroyed by a block.
+// Spent outputs created in blocks that aren't stored yet are skipped, so
+// running it during an out-of-order scrape may undercount until a backfill.
+func ComputeBlockCDD(database db.Store, block *models.Block) error {
+	spent, err := database.GetSpentOutputAges(block.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to get spent outputs of block %d: %w", block.Height, err)
+	}
+
+	cdd, value := CoinDaysDestroyed(spent)
+	return database.UpsertBlockMetrics(&models.BlockMetrics{
+		BlockHeight:       block.Height,
+		BlockHash:         block.Hash,
+		Timestamp:         block.Timestamp,
+		CoinDaysDestroyed: cdd,
+		ValueSpent:        value,
+		ComputedAt:        models.Now(),
+	})
+}
+
+// BackfillCDD recomputes coin days destroyed for every stored block with a
+// timestamp in [from, to). progress, if not nil, is called after each block.
+func BackfillCDD(database db.Store, from, to time.Time, progress func(done, total int)) error {
+	blocks, err := database.GetBlocksByTime(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to list blocks: %w", err)
+	}
+
+	for i, block := range blocks {
+		if err := ComputeBlockCDD(database, block); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i+1, len(blocks))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestCoinDaysDestroyed(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	spent := []*models.SpentOutputAge{
+		{Value: 100000000, CreatedAt: created, SpentAt: created.AddDate(0, 0, 10)},
+		{Value: 50000000, CreatedAt: created, SpentAt: created.Add(36 * time.Hour)},
+		// Timestamps of consecutive blocks may go backwards
+		{Value: 200000000, CreatedAt: created, SpentAt: created.Add(-time.Hour)},
+	}
+
+	cdd, value := CoinDaysDestroyed(spent)
+	if want := 10 + 0.5*1.5; math.Abs(cdd-want) > 1e-9 {
+		t.Errorf("cdd = %v, want %v", cdd, want)
+	}
+	if value != 350000000 {
+		t.Errorf("value = %d, want 350000000", value)
+	}
+
+	if cdd, value := CoinDaysDestroyed(nil); cdd != 0 || value != 0 {
+		t.Errorf("no spends = %v, %d", cdd, value)
+	}
+}
+
+// cddChain is a synthetic chain of three blocks 10 and 20 days apart: the
+// second spends the first's coinbase, and the third spends an output of the
+// second together with its coinbase.
+func cddChain(genesis time.Time) []*models.BlockData {
+	type out struct {
+		txid string
+		vout uint32
+	}
+	txid := func(height int64, i int) string { return fmt.Sprintf("%032x%032x", height, i) }
+	var blocks []*models.BlockData
+	addBlock := func(height int64, day int, spends [][]out, values [][]int64) {
+		timestamp := genesis.AddDate(0, 0, day)
+		data := &models.BlockData{Block: &models.Block{
+			Hash:      fmt.Sprintf("%064x", height),
+			Height:    height,
+			Timestamp: timestamp,
+			TxCount:   len(values),
+		}}
+		for i, txValues := range values {
+			txid := txid(height, i)
+			data.Transactions = append(data.Transactions, &models.Transaction{
+				Txid:        txid,
+				BlockHash:   data.Block.Hash,
+				BlockHeight: height,
+				IsCoinbase:  len(spends[i]) == 0,
+				Timestamp:   timestamp,
+			})
+			for vin, prev := range spends[i] {
+				data.Inputs = append(data.Inputs, &models.TxInput{
+					Txid:         txid,
+					Vout:         uint32(vin),
+					PrevTxid:     prev.txid,
+					PrevVout:     prev.vout,
+					TxidSpending: txid,
+					BlockHeight:  height,
+				})
+			}
+			for vout, value := range txValues {
+				data.Outputs = append(data.Outputs, &models.TxOutput{
+					Txid:        txid,
+					Vout:        uint32(vout),
+					Value:       value,
+					Address:     fmt.Sprintf("addr%d", vout),
+					BlockHeight: height,
+				})
+			}
+		}
+		blocks = append(blocks, data)
+	}
+	addBlock(1, 0, [][]out{nil}, [][]int64{{5000000000}})
+	addBlock(2, 10,
+		[][]out{nil, {{txid(1, 0), 0}}},
+		[][]int64{{5000000000}, {3000000000, 1999000000}})
+	addBlock(3, 30,
+		[][]out{nil, {{txid(2, 1), 0}, {txid(2, 0), 0}}},
+		[][]int64{{5000000000}, {7999000000}})
+	return blocks
+}
+
+func TestBlockCDD(t *testing.T) {
+	genesis := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []struct {
+		cdd   float64
+		value int64
+	}{
+		{0, 0},
+		// 50 BTC 10 days old
+		{500, 5000000000},
+		// 30 BTC and 50 BTC, both 20 days old
+		{1600, 8000000000},
+	}
+
+	// Out of order, the spent outputs aren't stored when a block is, so the
+	// per-block values are only right after the backfill
+	for _, order := range [][]int{{0, 1, 2}, {2, 0, 1}} {
+		t.Run(fmt.Sprint(order), func(t *testing.T) {
+			database, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+
+			ctx := context.Background()
+			blocks := cddChain(genesis)
+			for _, i := range order {
+				block := blocks[i].Block
+				if err := database.MarkBlockProcessing(ctx, block.Height, block.Hash); err != nil {
+					t.Fatal(err)
+				}
+				if err := database.InsertBlocksWithTransactions(ctx, blocks[i:i+1]); err != nil {
+					t.Fatal(err)
+				}
+				if err := ComputeBlockCDD(database, block); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := BackfillCDD(database, genesis, genesis.AddDate(1, 0, 0), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			days, err := database.GetDailyCDD(genesis, genesis.AddDate(1, 0, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(days) != len(want) {
+				t.Fatalf("got %d days, want %d", len(days), len(want))
+			}
+			for i, day := range days {
+				if math.Abs(day.CoinDaysDestroyed-want[i].cdd) > 1e-6 || day.ValueSpent != want[i].value {
+					t.Errorf("day %d: cdd %v value %d, want %v %d",
+						i, day.CoinDaysDestroyed, day.ValueSpent, want[i].cdd, want[i].value)
+				}
+			}
+			if dormancy := days[2].AvgDormancy; math.Abs(dormancy-20) > 1e-6 {
+				t.Errorf("dormancy = %v, want 20", dormancy)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// UnknownMiner is the miner tag of blocks whose coinbase matches no tag.
+const UnknownMiner = "unknown"
+
+// minTextRun is the shortest run of printable characters CoinbaseText keeps,
+// so that bytes of the height and extranonce that happen to be printable
+// don't clutter the text.
+const minTextRun = 4
+
+// DefaultMinerTags maps text that pools put in their coinbase scriptSig to
+// the pool's name.
+var DefaultMinerTags = map[string]string{
+	"Foundry USA":      "Foundry USA",
+	"AntPool":          "AntPool",
+	"/ViaBTC/":         "ViaBTC",
+	"F2Pool":           "F2Pool",
+	"七彩神仙鱼":            "F2Pool",
+	"/Binance/":        "Binance Pool",
+	"MARA Pool":        "MARA Pool",
+	"MARA Made in USA": "MARA Pool",
+	"SpiderPool":       "SpiderPool",
+	"/slush/":          "Braiins Pool",
+	"Luxor":            "Luxor",
+	"poolin.com":       "Poolin",
+	"/BTC.COM/":        "BTC.com",
+	"SBICrypto":        "SBI Crypto",
+	"OCEAN.XYZ":        "OCEAN",
+	"SECPOOL":          "SECPOOL",
+	"/BTC.TOP/":        "BTC.TOP",
+	"/Bitfury/":        "Bitfury",
+	"/HuobiPool/":      "Huobi Pool",
+	"/EMCD/":           "EMCD",
+	"WhitePool":        "WhitePool",
+	"/Bitdeer/":        "Bitdeer",
+}
+
+// minerTag is a tag and the pool it identifies.
+type minerTag struct {
+	text string
+	pool string
+}
+
+// MinerTagger identifies the pool that mined a block from its coinbase
+// scriptSig.
+type MinerTagger struct {
+	tags []minerTag
+}
+
+// NewMinerTagger returns a tagger matching extra, then DefaultMinerTags.
+// Within each, longer tags are tried first so that a specific tag wins over
+// a shorter one it contains. Tags match regardless of case.
+func NewMinerTagger(extra map[string]string) *MinerTagger {
+	t := &MinerTagger{}
+	for _, set := range []map[string]string{extra, DefaultMinerTags} {
+		var tags []minerTag
+		for text, pool := range set {
+			tags = append(tags, minerTag{text: strings.ToLower(text), pool: pool})
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			if len(tags[i].text) != len(tags[j].text) {
+				return len(tags[i].text) > len(tags[j].text)
+			}
+			return tags[i].text < tags[j].text
+		})
+		t.tags = append(t.tags, tags...)
+	}
+	return t
+}
+
+// LoadMinerTags reads a JSON object mapping coinbase tags to pool names,
+// for NewMinerTagger.
+func LoadMinerTags(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read miner tags: %w", err)
+	}
+	var tags map[string]string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse miner tags %s: %w", path, err)
+	}
+	for text, pool := range tags {
+		if text == "" || pool == "" {
+			return nil, fmt.Errorf("miner tags %s: tags and pool names can't be empty", path)
+		}
+	}
+	return tags, nil
+}
+
+// Tag returns the pool whose tag appears in the text of the coinbase
+// scriptSig given in hex, or UnknownMiner.
+func (t *MinerTagger) Tag(scriptHex string) string {
+	text := strings.ToLower(CoinbaseText(scriptHex))
+	if text == "" {
+		return UnknownMiner
+	}
+	for _, tag := range t.tags {
+		if strings.Contains(text, tag.text) {
+			return tag.pool
+		}
+	}
+	return UnknownMiner
+}
+
+// CoinbaseText decodes the runs of printable text in a coinbase scriptSig
+// given in hex, separated by spaces. Runs of UTF-8 text count, so tags in
+// other scripts are kept.
+func CoinbaseText(scriptHex string) string {
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil {
+		return ""
+	}
+
+	var runs []string
+	var run []rune
+	flush := func() {
+		if len(run) >= minTextRun {
+			runs = append(runs, string(run))
+		}
+		run = run[:0]
+	}
+	for len(script) > 0 {
+		r, size := utf8.DecodeRune(script)
+		if r != utf8.RuneError && unicode.IsPrint(r) {
+			run = append(run, r)
+		} else {
+			flush()
+		}
+		script = script[size:]
+	}
+	flush()
+	return strings.Join(runs, " ")
+}
@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// coinbaseScript builds a coinbase scriptSig pushing the height and an
+// extranonce around text, like pools do.
+func coinbaseScript(text string) string {
+	return "03" + "40d10c" + "04" + "9a3c1f00" + hex.EncodeToString([]byte(text)) + "0800000000ffe1a2b3"
+}
+
+func TestCoinbaseText(t *testing.T) {
+	for _, tc := range []struct {
+		script string
+		want   string
+	}{
+		{coinbaseScript("/Foundry USA Pool #dropgold/"), "/Foundry USA Pool #dropgold/"},
+		{coinbaseScript("Mined by AntPool") + hex.EncodeToString([]byte("\x00\x01abcdef")), "Mined by AntPool abcdef"},
+		// Printable bytes of the height and extranonce are too short to count
+		{coinbaseScript(""), ""},
+		{"not hex", ""},
+	} {
+		if got := CoinbaseText(tc.script); got != tc.want {
+			t.Errorf("CoinbaseText(%s) = %q, want %q", tc.script, got, tc.want)
+		}
+	}
+}
+
+func TestMinerTagger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.json")
+	if err := os.WriteFile(path, []byte(`{"/MyPool/": "My Pool", "Foundry USA Pool #dropgold": "Foundry Gold"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	extra, err := LoadMinerTags(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger := NewMinerTagger(extra)
+
+	for text, want := range map[string]string{
+		"/ViaBTC/Mined by someone/": "ViaBTC",
+		"mined by antpool":          "AntPool",
+		"/mypool/":                  "My Pool",
+		// Extra tags win over the built-in ones
+		"/Foundry USA Pool #dropgold/": "Foundry Gold",
+		"/Foundry USA Pool/":           "Foundry USA",
+		"/SomeNewPool/":                UnknownMiner,
+	} {
+		if got := tagger.Tag(coinbaseScript(text)); got != want {
+			t.Errorf("Tag(%q) = %q, want %q", text, got, want)
+		}
+	}
+	if got := tagger.Tag(""); got != UnknownMiner {
+		t.Errorf("Tag of an empty script = %q, want %q", got, UnknownMiner)
+	}
+}
+
+func TestLoadMinerTagsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.json")
+	for _, content := range []string{`["/MyPool/"]`, `{"": "My Pool"}`, `{"/MyPool/": ""}`} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMinerTags(path); err == nil {
+			t.Errorf("LoadMinerTags(%s) succeeded", content)
+		}
+	}
+}
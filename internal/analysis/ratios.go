@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"fmt"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// mayerWindow is the number of days of the moving average of the price the
+// Mayer multiple divides the price by.
+const mayerWindow = 200
+
+// addChainMetrics sets the ratio inputs of metrics, which cover consecutive
+// days from from to to, from the stored blocks and prices.
+func addChainMetrics(database db.Store, metrics []*models.DailyMetrics, from, to time.Time) error {
+	transfers, err := database.GetDailyTransfers(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to get daily transfers: %w", err)
+	}
+	prices, err := database.GetDailyPrices(from.Add(-(mayerWindow-1)*day), to)
+	if err != nil {
+		return fmt.Errorf("failed to get daily prices: %w", err)
+	}
+	setChainMetrics(metrics, transfers, prices)
+	return nil
+}
+
+// setChainMetrics sets the ratio inputs of metrics, which cover consecutive
+// days, from the transfers and prices of those days. prices also holds the
+// days before them the moving average of the first ones covers. The issued
+// supply of a day without blocks is that of the last block before it.
+func setChainMetrics(metrics []*models.DailyMetrics, transfers []*models.DailyTransfers, prices []*models.DailyPrice) {
+	byDay := make(map[time.Time]*models.DailyTransfers, len(transfers))
+	for _, t := range transfers {
+		byDay[t.Day.UTC()] = t
+	}
+	priceOf := make(map[time.Time]float64, len(prices))
+	for _, p := range prices {
+		priceOf[p.Day.UTC()] = p.Price
+	}
+
+	lastHeight := int64(-1)
+	for _, m := range metrics {
+		d := m.Day.UTC()
+		if t, ok := byDay[d]; ok {
+			lastHeight = t.LastHeight
+			m.Fees, m.Subsidy = t.Fees, t.Subsidy
+			m.TransferredValue, m.TransferredExChange = t.Value, t.ValueExChange
+		}
+		m.IssuedSupply = models.IssuedSupply(lastHeight)
+
+		if price, ok := priceOf[d]; ok {
+			m.Price = &price
+		}
+		var sum float64
+		for i := range mayerWindow {
+			price, ok := priceOf[d.Add(-time.Duration(i)*day)]
+			if !ok {
+				sum = -1
+				break
+			}
+			sum += price
+		}
+		if sum >= 0 {
+			avg := sum / mayerWindow
+			m.PriceMA200 = &avg
+		}
+	}
+}
+
+// ComputeRatios derives the price-to-chain ratios of each day from its
+// metrics. excludeChange counts the transferred value without the presumed
+// change outputs, which the naive sum of the outputs overstates the value
+// that changed hands by.
+func ComputeRatios(metrics []*models.DailyMetrics, excludeChange bool) []*models.DailyRatios {
+	ratios := make([]*models.DailyRatios, 0, len(metrics))
+	for _, m := range metrics {
+		r := &models.DailyRatios{Day: m.Day, Price: m.Price, TransferredValue: m.TransferredValue}
+		if excludeChange {
+			r.TransferredValue = m.TransferredExChange
+		}
+		if m.Price != nil {
+			marketCap := float64(m.IssuedSupply) / models.SatoshisPerBTC * *m.Price
+			r.MarketCap = &marketCap
+			if transferred := float64(r.TransferredValue) / models.SatoshisPerBTC * *m.Price; transferred > 0 {
+				nvt := marketCap / transferred
+				r.NVT = &nvt
+			}
+			if m.PriceMA200 != nil && *m.PriceMA200 > 0 {
+				mayer := *m.Price / *m.PriceMA200
+				r.MayerMultiple = &mayer
+			}
+		}
+		if reward := m.Subsidy + m.Fees; reward > 0 {
+			feeShare := float64(m.Fees) / float64(reward)
+			r.FeeRewardRatio = &feeShare
+		}
+		ratios = append(ratios, r)
+	}
+	return ratios
+}
+
+// DailyRatios returns the price-to-chain ratios for the days in [from, to)
+// that have stored blocks, from the DailyMetrics cache.
+func DailyRatios(database db.Store, from, to time.Time, excludeChange, interpolate, recompute bool) ([]*models.DailyRatios, error) {
+	metrics, err := DailyMetrics(database, from, to, interpolate, recompute)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeRatios(metrics, excludeChange), nil
+}
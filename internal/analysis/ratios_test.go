@@ -0,0 +1,63 @@
+package analysis
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestRatios prices days 0 to 199 at 100 and day 200 at 300, and computes
+// the ratios of days 198 to 201: a block at height 0 on day 198, none on
+// day 199, height 1 on day 200 and no price on day 201.
+func TestRatios(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d int) time.Time { return start.AddDate(0, 0, d) }
+
+	var prices []*models.DailyPrice
+	for d := range 201 {
+		price := 100.0
+		if d == 200 {
+			price = 300
+		}
+		prices = append(prices, &models.DailyPrice{Day: at(d), Price: price})
+	}
+	transfers := []*models.DailyTransfers{
+		{Day: at(198), LastHeight: 0, Subsidy: 5000000000},
+		{Day: at(200), LastHeight: 1, Fees: 1000000000, Subsidy: 4000000000, Value: 5000000000, ValueExChange: 1000000000},
+	}
+	var metrics []*models.DailyMetrics
+	for d := 198; d <= 201; d++ {
+		metrics = append(metrics, &models.DailyMetrics{Day: at(d)})
+	}
+	setChainMetrics(metrics, transfers, prices)
+
+	format := func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.4g", *v)
+	}
+	for _, excludeChange := range []bool{false, true} {
+		var got []string
+		for _, r := range ComputeRatios(metrics, excludeChange) {
+			got = append(got, fmt.Sprintf("%s price %s cap %s transferred %d nvt %s fees %s mayer %s",
+				r.Day.Format("01-02"), format(r.Price), format(r.MarketCap), r.TransferredValue,
+				format(r.NVT), format(r.FeeRewardRatio), format(r.MayerMultiple)))
+		}
+		nvt, transferred := "2", "5000000000"
+		if excludeChange {
+			nvt, transferred = "10", "1000000000"
+		}
+		want := []string{
+			"07-17 price 100 cap 5000 transferred 0 nvt - fees 0 mayer -",
+			"07-18 price 100 cap 5000 transferred 0 nvt - fees - mayer 1",
+			"07-19 price 300 cap 3e+04 transferred " + transferred + " nvt " + nvt + " fees 0.2 mayer 2.97",
+			"07-20 price - cap - transferred 0 nvt - fees - mayer -",
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("exclude change %v:\n got %q\nwant %q", excludeChange, got, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SegwitUsage returns the number of transactions with witness data in a
+// serialized block and the bytes taken up by witness data, counted the same
+// way as when the block is scraped.
+func SegwitUsage(raw []byte) (int, int64, error) {
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(raw)); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse raw block: %w", err)
+	}
+
+	var segwitTxs int
+	var witnessBytes int64
+	for _, tx := range block.Transactions {
+		if tx.HasWitness() {
+			segwitTxs++
+		}
+		witnessBytes += int64(tx.SerializeSize() - tx.SerializeSizeStripped())
+	}
+	return segwitTxs, witnessBytes, nil
+}
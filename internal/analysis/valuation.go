@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"scrapbtc/internal/db"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// ComputeDailyMetrics computes realized cap and SOPR for every day in
+// [from, to) from coin flows aggregated by creation and spending day. Flows
+// created before from still count towards the realized cap of later days.
+// interpolate only records how the flows were priced.
+func ComputeDailyMetrics(flows []*models.CoinFlow, from, to time.Time, interpolate bool) []*models.DailyMetrics {
+	dayIndex := func(t time.Time) int64 {
+		return t.Unix() / int64(day/time.Second)
+	}
+
+	type dayTotals struct {
+		supply, unpricedSupply                int64
+		realizedCap                           float64
+		spent, unpricedSpent                  int64
+		spentAtSpendPrice, spentAtCreatePrice float64
+	}
+	totals := make(map[int64]*dayTotals)
+	totalsOf := func(d int64) *dayTotals {
+		t, ok := totals[d]
+		if !ok {
+			t = &dayTotals{}
+			totals[d] = t
+		}
+		return t
+	}
+
+	first := dayIndex(from)
+	for _, f := range flows {
+		created := dayIndex(f.CreatedDay)
+		if created < first {
+			first = created
+		}
+
+		t := totalsOf(created)
+		t.supply += f.Value
+		t.realizedCap += f.CreatedUSD
+		t.unpricedSupply += f.UnpricedValue
+
+		if f.SpentDay.IsZero() {
+			continue
+		}
+		t = totalsOf(dayIndex(f.SpentDay))
+		t.supply -= f.Value
+		t.realizedCap -= f.CreatedUSD
+		t.unpricedSupply -= f.UnpricedValue
+		t.spent += f.Value
+		t.spentAtSpendPrice += f.SpentUSD
+		t.spentAtCreatePrice += f.SpentCreatedUSD
+		t.unpricedSpent += f.UnpricedSpent
+	}
+
+	var metrics []*models.DailyMetrics
+	var running dayTotals
+	computedAt := models.Now()
+	for d := first; d < dayIndex(to); d++ {
+		t, ok := totals[d]
+		if !ok {
+			t = &dayTotals{}
+		}
+		running.supply += t.supply
+		running.realizedCap += t.realizedCap
+		running.unpricedSupply += t.unpricedSupply
+
+		if d < dayIndex(from) {
+			continue
+		}
+		m := &models.DailyMetrics{
+			Day:            time.Unix(d*int64(day/time.Second), 0).UTC(),
+			Supply:         running.supply,
+			RealizedCap:    running.realizedCap,
+			UnpricedSupply: running.unpricedSupply,
+			ValueSpent:     t.spent,
+			UnpricedSpent:  t.unpricedSpent,
+			Interpolated:   interpolate,
+			ComputedAt:     computedAt,
+		}
+		if t.spentAtCreatePrice > 0 {
+			sopr := t.spentAtSpendPrice / t.spentAtCreatePrice
+			m.SOPR = &sopr
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// DailyMetrics returns realized cap, SOPR and the ratio inputs for the days
+// in [from, to) that have stored blocks. Results are cached in the
+// daily_metrics table; they are recomputed for the whole scraped history
+// when a day in the range is missing or recompute is set, and the cache is
+// left untouched when the database is read-only.
+func DailyMetrics(database db.Store, from, to time.Time, interpolate, recompute bool) ([]*models.DailyMetrics, error) {
+	firstBlock, lastBlock, err := database.GetBlockTimeRange()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block time range: %w", err)
+	}
+
+	firstDay := firstBlock.UTC().Truncate(day)
+	if from.Before(firstDay) {
+		from = firstDay
+	}
+	if end := lastBlock.UTC().Truncate(day).Add(day); to.After(end) {
+		to = end
+	}
+	if !to.After(from) {
+		return nil, nil
+	}
+
+	if !recompute {
+		cached, err := database.GetDailyMetrics(from, to, interpolate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get daily metrics: %w", err)
+		}
+		if len(cached) == int(to.Sub(from)/day) {
+			return cached, nil
+		}
+	}
+
+	flows, err := database.GetCoinFlows(interpolate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coin flows: %w", err)
+	}
+
+	metrics := ComputeDailyMetrics(flows, firstDay, to, interpolate)
+	if err := addChainMetrics(database, metrics, firstDay, to); err != nil {
+		return nil, err
+	}
+	if !database.ReadOnly() {
+		if err := database.UpsertDailyMetricsBatch(metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	var inRange []*models.DailyMetrics
+	for _, m := range metrics {
+		if !m.Day.Before(from) {
+			inRange = append(inRange, m)
+		}
+	}
+	return inRange, nil
+}
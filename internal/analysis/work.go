@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// TargetFromBits decodes the compact representation of a block's target, as
+// the hex of the header's nBits field: the top byte is the length of the
+// target in bytes and the lower three its most significant bytes.
+func TargetFromBits(bits string) (*big.Int, error) {
+	compact, err := strconv.ParseUint(bits, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bits %q: %w", bits, err)
+	}
+	size := uint(compact >> 24)
+	mantissa := int64(compact & 0x007fffff)
+	if compact&0x00800000 != 0 && mantissa != 0 {
+		return nil, fmt.Errorf("invalid bits %q: negative target", bits)
+	}
+
+	target := big.NewInt(mantissa)
+	if size <= 3 {
+		return target.Rsh(target, 8*(3-size)), nil
+	}
+	return target.Lsh(target, 8*(size-3)), nil
+}
+
+// BlockWork returns the expected number of hashes needed to find a block
+// with the given bits, 2^256 / (target+1), as Bitcoin Core counts chainwork.
+func BlockWork(bits string) (*big.Int, error) {
+	target, err := TargetFromBits(bits)
+	if err != nil {
+		return nil, err
+	}
+	if target.Sign() == 0 {
+		return nil, fmt.Errorf("invalid bits %q: zero target", bits)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, target.Add(target, big.NewInt(1))), nil
+}
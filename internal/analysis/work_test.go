@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTargetFromBits(t *testing.T) {
+	genesis := new(big.Int).Lsh(big.NewInt(0xffff), 208)
+	for bits, want := range map[string]*big.Int{
+		"1d00ffff": genesis,
+		"17034219": new(big.Int).Lsh(big.NewInt(0x034219), 8*(0x17-3)),
+		"03123456": big.NewInt(0x123456),
+		"02123456": big.NewInt(0x1234),
+		"01003456": big.NewInt(0),
+	} {
+		got, err := TargetFromBits(bits)
+		if err != nil {
+			t.Errorf("TargetFromBits(%s): %v", bits, err)
+		} else if got.Cmp(want) != 0 {
+			t.Errorf("TargetFromBits(%s) = %x, want %x", bits, got, want)
+		}
+	}
+
+	for _, bits := range []string{"04923456", "zz", "1d00ffff00"} {
+		if _, err := TargetFromBits(bits); err == nil {
+			t.Errorf("TargetFromBits(%s) succeeded", bits)
+		}
+	}
+}
+
+func TestBlockWork(t *testing.T) {
+	// The chainwork of the genesis block
+	work, err := BlockWork("1d00ffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Cmp(big.NewInt(0x100010001)) != 0 {
+		t.Errorf("BlockWork(1d00ffff) = %x, want 100010001", work)
+	}
+
+	if _, err := BlockWork("01003456"); err == nil {
+		t.Error("BlockWork() of a zero target succeeded")
+	}
+}
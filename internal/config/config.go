@@ -0,0 +1,92 @@
+// Package config reads and writes the scraper's config file, a JSON object
+// with the RPC credentials, so that they don't have to be passed on every
+// command line. The password may be stored encrypted with a passphrase.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config is the content of the config file.
+type Config struct {
+	RPCUser string `json:"rpc_user,omitempty"`
+	// RPCPass is the password in plaintext, RPCPassEncrypted the password
+	// encrypted by Encrypt. At most one of them is set.
+	RPCPass          string `json:"rpc_pass,omitempty"`
+	RPCPassEncrypted string `json:"rpc_pass_encrypted,omitempty"`
+}
+
+// DefaultPath returns the path of the config file when none is given:
+// scrapbtc/config.json in the user's config directory, such as ~/.config
+// on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the config directory: %w", err)
+	}
+	return filepath.Join(dir, "scrapbtc", "config.json"), nil
+}
+
+// Load reads the config file at path. A missing or empty file is an empty
+// config.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	cfg := &Config{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if cfg.RPCPass != "" && cfg.RPCPassEncrypted != "" {
+		return nil, fmt.Errorf("config %s: rpc_pass and rpc_pass_encrypted can't both be set", path)
+	}
+	return cfg, nil
+}
+
+// Save writes cfg to path, readable by the user only, creating its
+// directory if needed. The file is replaced with a rename, so a failed
+// write leaves the old one.
+func Save(path string, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// Password returns the RPC password of cfg, decrypting it with the
+// passphrase from passphrase when it is stored encrypted. passphrase is only
+// called then.
+func (cfg *Config) Password(passphrase func() (string, error)) (string, error) {
+	if cfg.RPCPassEncrypted == "" {
+		return cfg.RPCPass, nil
+	}
+	phrase, err := passphrase()
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(cfg.RPCPassEncrypted, phrase)
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrapbtc", "config.json")
+	cfg, err := Load(path)
+	if err != nil || *cfg != (Config{}) {
+		t.Fatalf("Load(missing) = %+v, %v, want an empty config", cfg, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := Load(path); err != nil || *cfg != (Config{}) {
+		t.Errorf("Load(empty) = %+v, %v, want an empty config", cfg, err)
+	}
+
+	// Plaintext configs, as written by hand
+	if err := os.WriteFile(path, []byte(`{"rpc_user": "alice", "rpc_pass": "hunter2"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass, err := cfg.Password(func() (string, error) { return "", errors.New("asked for a passphrase") })
+	if cfg.RPCUser != "alice" || pass != "hunter2" || err != nil {
+		t.Errorf("plaintext config = %+v, password %q, %v", cfg, pass, err)
+	}
+
+	encrypted, err := Encrypt("hunter2", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, &Config{RPCUser: "alice", RPCPassEncrypted: encrypted}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0o600 {
+		t.Errorf("saved config mode %v, want 0600", info.Mode().Perm())
+	}
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass, err := cfg.Password(func() (string, error) { return "correct horse", nil }); pass != "hunter2" || err != nil {
+		t.Errorf("Password() = %q, %v, want hunter2", pass, err)
+	}
+	if _, err := cfg.Password(func() (string, error) { return "battery staple", nil }); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Password() with the wrong passphrase error = %v, want ErrDecrypt", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rpc_pass": "a", "rpc_pass_encrypted": "b"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load() of a config with both passwords succeeded")
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// The argon2id parameters of Encrypt, the second recommendation of RFC 9106
+// for memory-constrained machines. They are stored with every ciphertext,
+// so values encrypted with other parameters still decrypt.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	saltSize     = 16
+	keySize      = 32 // AES-256
+	// maxMemory bounds the memory a stored value can make Decrypt use.
+	maxMemory = 4 * 1024 * 1024 // KiB
+)
+
+// secretPrefix starts every value Encrypt returns.
+const secretPrefix = "argon2id"
+
+// ErrDecrypt is returned by Decrypt when the passphrase is wrong or the
+// value was modified.
+var ErrDecrypt = errors.New("failed to decrypt: wrong passphrase or corrupted value")
+
+// Encrypt encrypts plaintext with AES-256-GCM under a key derived from
+// passphrase with argon2id and a random salt. The result is a single line,
+// argon2id$m=<KiB>,t=<time>,p=<threads>$<salt>$<nonce and ciphertext>, in
+// base64.
+func Encrypt(plaintext, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase can't be empty")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(passphrase, salt, argonMemory, argonTime, argonThreads)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return fmt.Sprintf("%s$m=%d,t=%d,p=%d$%s$%s", secretPrefix, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sealed)), nil
+}
+
+// Decrypt returns the plaintext of a value returned by Encrypt, or
+// ErrDecrypt when passphrase isn't the one it was encrypted with.
+func Decrypt(value, passphrase string) (string, error) {
+	parts := strings.Split(value, "$")
+	if len(parts) != 4 || parts[0] != secretPrefix {
+		return "", fmt.Errorf("invalid encrypted value: expected %s$<parameters>$<salt>$<ciphertext>", secretPrefix)
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || memory == 0 || memory > maxMemory || time == 0 || threads == 0 {
+		return "", fmt.Errorf("invalid encrypted value: bad parameters %q", parts[1])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: bad salt: %w", err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: bad ciphertext: %w", err)
+	}
+
+	aead, err := newAEAD(passphrase, salt, memory, time, threads)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+func newAEAD(passphrase string, salt []byte, memory, time uint32, threads uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
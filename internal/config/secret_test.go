@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	for _, plaintext := range []string{"hunter2", "", "pässwörd with $ and spaces"} {
+		value, err := Encrypt(plaintext, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(value, plaintext) && plaintext != "" {
+			t.Errorf("Encrypt(%q) = %q, contains the plaintext", plaintext, value)
+		}
+		got, err := Decrypt(value, "correct horse")
+		if err != nil || got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+
+	// Salts and nonces are random
+	a, _ := Encrypt("hunter2", "correct horse")
+	b, _ := Encrypt("hunter2", "correct horse")
+	if a == b {
+		t.Error("Encrypt() returned the same value twice")
+	}
+	if _, err := Encrypt("hunter2", ""); err == nil {
+		t.Error("Encrypt() with an empty passphrase succeeded")
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	value, err := Encrypt("hunter2", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(value, "battery staple"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt() with the wrong passphrase error = %v, want ErrDecrypt", err)
+	}
+
+	// Flip a character of the ciphertext
+	i := len(value) - 2
+	flipped := value[:i] + string("AB"[(strings.IndexByte("AB", value[i])+1)%2]) + value[i+1:]
+	if _, err := Decrypt(flipped, "correct horse"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Decrypt() of a modified value error = %v, want ErrDecrypt", err)
+	}
+
+	for _, bad := range []string{
+		"hunter2",
+		"scrypt$m=1,t=1,p=1$AAAA$AAAA",
+		"argon2id$m=0,t=1,p=1$AAAA$AAAA",
+		"argon2id$m=999999999,t=1,p=1$AAAA$AAAA",
+		"argon2id$m=8,t=1,p=1$!!$AAAA",
+	} {
+		if _, err := Decrypt(bad, "correct horse"); err == nil || errors.Is(err, ErrDecrypt) {
+			t.Errorf("Decrypt(%q) error = %v, want an invalid value error", bad, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// applyAddressDelta adds (sign = 1) or subtracts (sign = -1) a block's
+// amounts to the addresses table: the outputs it created, and the spends
+// between it and the blocks applied so far, in either direction. A spend is
+// counted once both the spending block and the block of the spent output are
+// applied, whichever comes first, so blocks can be applied in any order. The
+// block itself must be in address_stats_blocks while its delta is applied.
+const applyAddressDelta = `
+INSERT INTO addresses (
+	address, first_seen_height, last_seen_height,
+	total_received, total_sent, utxo_count, balance
+)
+SELECT
+	address, MIN(height), MAX(height),
+	CAST(? * SUM(received) AS BIGINT),
+	CAST(? * SUM(sent) AS BIGINT),
+	CAST(? * SUM(created - spent) AS BIGINT),
+	CAST(? * SUM(received - sent) AS BIGINT)
+FROM (
+	SELECT o.address, t.block_height AS height, o.value AS received, 0 AS sent, 1 AS created, 0 AS spent
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	WHERE t.block_hash = ? AND o.address IS NOT NULL
+	UNION ALL
+	-- Outputs of applied blocks spent by the block
+	SELECT po.address, st.block_height, 0, po.value, 0, 1
+	FROM tx_inputs i
+	JOIN transactions st ON st.txid = i.txid_spending
+	JOIN tx_outputs po ON po.txid = i.prev_txid AND po.vout = i.prev_vout
+	JOIN transactions ft ON ft.txid = po.txid
+	JOIN address_stats_blocks fa ON fa.block_hash = ft.block_hash
+	WHERE st.block_hash = ? AND po.address IS NOT NULL
+	UNION ALL
+	-- Outputs of the block spent by other applied blocks
+	SELECT o.address, st.block_height, 0, o.value, 0, 1
+	FROM tx_outputs o
+	JOIN transactions ft ON ft.txid = o.txid
+	JOIN tx_inputs i ON i.prev_txid = o.txid AND i.prev_vout = o.vout
+	JOIN transactions st ON st.txid = i.txid_spending
+	JOIN address_stats_blocks sa ON sa.block_hash = st.block_hash
+	WHERE ft.block_hash = ? AND st.block_hash <> ? AND o.address IS NOT NULL
+) delta
+GROUP BY address
+ON CONFLICT (address) DO UPDATE SET
+	first_seen_height = LEAST(addresses.first_seen_height, excluded.first_seen_height),
+	last_seen_height = GREATEST(addresses.last_seen_height, excluded.last_seen_height),
+	total_received = addresses.total_received + excluded.total_received,
+	total_sent = addresses.total_sent + excluded.total_sent,
+	utxo_count = addresses.utxo_count + excluded.utxo_count,
+	balance = addresses.balance + excluded.balance`
+
+// applyBlockAddressDelta runs applyAddressDelta for the block with hash.
+func applyBlockAddressDelta(ctx context.Context, tx *sql.Tx, hash string, sign int) error {
+	_, err := tx.ExecContext(ctx, applyAddressDelta, sign, sign, sign, sign, hash, hash, hash, hash)
+	return err
+}
+
+// appliedBlock returns the hash of the block applied at height, or "" if
+// there is none.
+func appliedBlock(ctx context.Context, tx *sql.Tx, height int64) (string, error) {
+	var appliedHash string
+	err := tx.QueryRowContext(ctx, `SELECT block_hash FROM address_stats_blocks WHERE block_height = ?`, height).Scan(&appliedHash)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to check applied block at height %d: %w", height, err)
+	}
+	return appliedHash, nil
+}
+
+// revertAddressStats subtracts the block applied at height, if any, from the
+// rollups and forgets it, so that the blocks applied later no longer count
+// spends from it. It returns the hash of the reverted block, or "" if there
+// was none, for dropUnseenAddresses.
+//
+// Neither the addresses nor the row of the block are deleted here: DuckDB
+// ignores a row inserted with a key deleted in the same transaction, so the
+// block applied next at height would be lost. Its row is kept with an empty
+// hash, and the addresses are dropped once the blocks replacing it are
+// applied.
+func revertAddressStats(ctx context.Context, tx *sql.Tx, height int64) (string, error) {
+	appliedHash, err := appliedBlock(ctx, tx, height)
+	if err != nil || appliedHash == "" {
+		return "", err
+	}
+	if err := applyBlockAddressDelta(ctx, tx, appliedHash, -1); err != nil {
+		return "", fmt.Errorf("failed to revert address stats of block %s: %w", appliedHash, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE address_stats_blocks SET block_hash = '' WHERE block_height = ?`, height); err != nil {
+		return "", fmt.Errorf("failed to forget applied block %s: %w", appliedHash, err)
+	}
+	return appliedHash, nil
+}
+
+// dropUnseenAddresses deletes the addresses paid by the reverted block with
+// hash that no applied block pays anymore. The outputs of the block must
+// still be stored.
+func dropUnseenAddresses(ctx context.Context, tx *sql.Tx, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, unseenAddresses, hash); err != nil {
+		return fmt.Errorf("failed to drop addresses of block %s: %w", hash, err)
+	}
+	return nil
+}
+
+const unseenAddresses = `
+DELETE FROM addresses
+WHERE total_received = 0 AND address IN (
+	SELECT o.address
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	WHERE t.block_hash = ?
+)`
+
+// UpsertAddressStats applies a block's inputs and outputs to the per-address
+// rollups. It must be called after the block's transactions, inputs and
+// outputs are stored. Applying the same block twice is a no-op, and if a
+// different block was applied at the same height (a reorg) its amounts are
+// subtracted first.
+func (db *DB) UpsertAddressStats(ctx context.Context, blockHash string, height int64) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		return upsertAddressStats(ctx, tx, blockHash, height)
+	})
+}
+
+func upsertAddressStats(ctx context.Context, tx *sql.Tx, blockHash string, height int64) error {
+	appliedHash, err := appliedBlock(ctx, tx, height)
+	if err != nil {
+		return err
+	}
+	if appliedHash == blockHash {
+		return nil
+	}
+	orphaned, err := revertAddressStats(ctx, tx, height)
+	if err != nil {
+		return fmt.Errorf("failed to revert orphaned block: %w", err)
+	}
+
+	query := `INSERT INTO address_stats_blocks (block_height, block_hash) VALUES (?, ?)
+	ON CONFLICT (block_height) DO UPDATE SET block_hash = excluded.block_hash`
+	if _, err := tx.ExecContext(ctx, query, height, blockHash); err != nil {
+		return fmt.Errorf("failed to record applied block %s: %w", blockHash, err)
+	}
+	if err := applyBlockAddressDelta(ctx, tx, blockHash, 1); err != nil {
+		return fmt.Errorf("failed to apply address stats of block %s: %w", blockHash, err)
+	}
+
+	return dropUnseenAddresses(ctx, tx, orphaned)
+}
+
+// GetAddressBalance returns the rollup of a single address, or sql.ErrNoRows
+// if the address has never been seen.
+func (db *DB) GetAddressBalance(address string) (*models.AddressStats, error) {
+	query := `SELECT address, first_seen_height, last_seen_height,
+		total_received, total_sent, utxo_count, balance
+	FROM addresses WHERE address = ?`
+
+	s := &models.AddressStats{}
+	err := db.conn.QueryRow(query, address).Scan(
+		&s.Address, &s.FirstSeenHeight, &s.LastSeenHeight,
+		&s.TotalReceived, &s.TotalSent, &s.UTXOCount, &s.Balance)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetTopAddresses returns the n addresses with the highest balance, with
+// their labels.
+func (db *DB) GetTopAddresses(n int) ([]*models.AddressStats, error) {
+	query := `SELECT a.address, a.first_seen_height, a.last_seen_height,
+		a.total_received, a.total_sent, a.utxo_count, a.balance, COALESCE(l.label, '')
+	FROM addresses a
+	LEFT JOIN address_labels l ON l.address = a.address
+	ORDER BY a.balance DESC, a.address LIMIT ?`
+
+	rows, err := db.conn.Query(query, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.AddressStats
+	for rows.Next() {
+		s := &models.AddressStats{}
+		if err := rows.Scan(
+			&s.Address, &s.FirstSeenHeight, &s.LastSeenHeight,
+			&s.TotalReceived, &s.TotalSent, &s.UTXOCount, &s.Balance, &s.Label); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
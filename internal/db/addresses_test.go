@@ -0,0 +1,151 @@
+package db
+
+import (
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+// addressChain returns four blocks in which addresses receive coinbase
+// rewards and spend them, including outputs created two blocks earlier,
+// and a competing third block spending the same output as the first.
+func addressChain() (blocks []*models.BlockData, orphan *models.BlockData) {
+	c := newTestChain()
+	b1, out1 := c.block(1, 0, testTx{outs: []testOut{{"A", 5000}}})
+	b2, out2 := c.block(2, 0,
+		testTx{outs: []testOut{{"B", 5000}}},
+		testTx{ins: out1[0], outs: []testOut{{"C", 3000}, {"A", 1900}}})
+	b3, _ := c.block(3, 0,
+		testTx{outs: []testOut{{"B", 5000}}},
+		testTx{ins: out2[1][:1], outs: []testOut{{"D", 2900}}})
+	orphan, _ = c.block(3, 1,
+		testTx{outs: []testOut{{"F", 5000}}},
+		testTx{ins: out2[1][:1], outs: []testOut{{"F", 2950}}})
+	b4, _ := c.block(4, 0,
+		testTx{outs: []testOut{{"A", 5000}}},
+		testTx{ins: []*models.TxOutput{out2[1][1], out2[0][0]}, outs: []testOut{{"E", 6800}}})
+	return []*models.BlockData{b1, b2, b3, b4}, orphan
+}
+
+func addressRollups(t *testing.T, db *DB) []models.AddressStats {
+	t.Helper()
+	stats, err := db.GetTopAddresses(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollups := make([]models.AddressStats, len(stats))
+	for i, s := range stats {
+		rollups[i] = *s
+	}
+	return rollups
+}
+
+func TestAddressStatsOrder(t *testing.T) {
+	forEachDriver(t, testAddressStatsOrder)
+}
+
+func testAddressStatsOrder(t *testing.T, driver string) {
+	blocks, _ := addressChain()
+	inOrder := newTestDB(t, driver)
+	storeBlocks(t, inOrder, false, blocks...)
+	want := addressRollups(t, inOrder)
+
+	a, err := inOrder.GetAddressBalance("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantA := &models.AddressStats{Address: "A", FirstSeenHeight: 1, LastSeenHeight: 4,
+		TotalReceived: 11900, TotalSent: 6900, UTXOCount: 1, Balance: 5000}
+	if !reflect.DeepEqual(a, wantA) {
+		t.Errorf("A = %+v, want %+v", a, wantA)
+	}
+
+	for _, order := range [][]int{{2, 0, 3, 1}, {3, 2, 1, 0}, {1, 3, 0, 2}} {
+		db := newTestDB(t, driver)
+		for _, i := range order {
+			storeBlocks(t, db, false, blocks[i])
+		}
+		if got := addressRollups(t, db); !reflect.DeepEqual(got, want) {
+			t.Errorf("blocks stored in order %v:\n got %+v\nwant %+v", order, got, want)
+		}
+	}
+}
+
+func TestAddressStatsReorg(t *testing.T) {
+	forEachDriver(t, testAddressStatsReorg)
+}
+
+func testAddressStatsReorg(t *testing.T, driver string) {
+	blocks, orphan := addressChain()
+	want := newTestDB(t, driver)
+	storeBlocks(t, want, false, blocks[0], blocks[1], orphan, blocks[3])
+
+	db := newTestDB(t, driver)
+	storeBlocks(t, db, false, blocks[3], blocks[2], blocks[0])
+	storeBlocks(t, db, true, orphan)
+	storeBlocks(t, db, false, blocks[1])
+	if got := addressRollups(t, db); !reflect.DeepEqual(got, addressRollups(t, want)) {
+		t.Errorf("rollups after reorg:\n got %+v\nwant %+v", got, addressRollups(t, want))
+	}
+}
+
+func firstSeenHeights(t *testing.T, db *DB) map[string]int64 {
+	t.Helper()
+	rows, err := db.conn.Query("SELECT address, first_seen_height FROM address_first_seen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	heights := make(map[string]int64)
+	for rows.Next() {
+		var address string
+		var height int64
+		if err := rows.Scan(&address, &height); err != nil {
+			t.Fatal(err)
+		}
+		heights[address] = height
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return heights
+}
+
+func TestAddressFirstSeen(t *testing.T) {
+	forEachDriver(t, testAddressFirstSeen)
+}
+
+// testAddressFirstSeen stores the blocks backwards, so the first seen
+// blocks of A and B are those stored first until the finalization.
+func testAddressFirstSeen(t *testing.T, driver string) {
+	blocks, _ := addressChain()
+	db := newTestDB(t, driver)
+	storeBlocks(t, db, false, blocks[3], blocks[2], blocks[1], blocks[0])
+
+	stored := map[string]int64{"A": 4, "B": 3, "C": 2, "D": 3, "E": 4}
+	if got := firstSeenHeights(t, db); !reflect.DeepEqual(got, stored) {
+		t.Errorf("first seen heights before finalization = %v, want %v", got, stored)
+	}
+	n, err := db.FinalizeAddressFirstSeen(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"A": 1, "B": 2, "C": 2, "D": 3, "E": 4}
+	if got := firstSeenHeights(t, db); n != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("finalization wrote %d rows to first seen heights %v, want 2 to %v", n, got, want)
+	}
+
+	day := newTestChain().genesis
+	newAddresses, err := db.GetNewAddressesPerDay(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := db.GetActiveAddressesPerDay(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCounts := []*models.DailyAddressCount{{Day: day, Addresses: 5}}
+	if !reflect.DeepEqual(newAddresses, wantCounts) || !reflect.DeepEqual(active, wantCounts) {
+		t.Errorf("new addresses = %+v and active = %+v, want %+v", newAddresses, active, wantCounts)
+	}
+}
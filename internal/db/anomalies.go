@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"time"
+)
+
+var anomalyColumns = []string{"block_height", "block_hash", "timestamp", "dimension", "value", "baseline", "score", "method", "detected_at"}
+
+// selectBlockFeatures reads the features of the blocks in a height range.
+// The interval is taken from the block at the height below, which may be
+// header-only; the stored blocks are those with a weight.
+const selectBlockFeatures = `
+SELECT b.height, b.hash, b.timestamp, b.tx_count, b.total_fees, b.weight, p.timestamp, COALESCE(o.bytes, 0)
+FROM blocks b
+LEFT JOIN blocks p ON p.height = b.height - 1
+LEFT JOIN (
+	SELECT block_height, SUM(data_size) AS bytes
+	FROM op_return_outputs
+	WHERE block_height BETWEEN ? AND ?
+	GROUP BY block_height
+) o ON o.block_height = b.height
+WHERE b.height BETWEEN ? AND ? AND b.weight > 0
+ORDER BY b.height`
+
+// GetBlockFeatures returns the features of the stored blocks from the first
+// to the last with a timestamp in [from, to), preceded by those of up to
+// before stored blocks below them, in height order. It also returns the
+// number of those preceding blocks.
+func (db *DB) GetBlockFeatures(from, to time.Time, before int) ([]*models.BlockFeatures, int, error) {
+	var first, last sql.NullInt64
+	err := db.conn.QueryRow(`SELECT MIN(height), MAX(height) FROM blocks WHERE timestamp >= ? AND timestamp < ? AND weight > 0`,
+		from, to).Scan(&first, &last)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !first.Valid {
+		return nil, 0, nil
+	}
+	start := first.Int64
+	if before > 0 {
+		var below sql.NullInt64
+		err := db.conn.QueryRow(`SELECT MIN(height) FROM (
+			SELECT height FROM blocks WHERE height < ? AND weight > 0 ORDER BY height DESC LIMIT ?
+		) below`, first.Int64, before).Scan(&below)
+		if err != nil {
+			return nil, 0, err
+		}
+		if below.Valid {
+			start = below.Int64
+		}
+	}
+
+	rows, err := db.conn.Query(selectBlockFeatures, start, last.Int64, start, last.Int64)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var features []*models.BlockFeatures
+	preceding := 0
+	for rows.Next() {
+		f := &models.BlockFeatures{}
+		var weight int64
+		var previous time.Time
+		if err := rows.Scan(&f.Height, &f.Hash, &f.Timestamp, &f.TxCount, &f.TotalFees, &weight,
+			scanTime(&previous), &f.OpReturnBytes); err != nil {
+			return nil, 0, err
+		}
+		f.FeeRate = float64(f.TotalFees) / (float64(weight) / 4)
+		if !previous.IsZero() {
+			interval := f.Timestamp.Sub(previous).Seconds()
+			f.Interval = &interval
+		}
+		if f.Height < first.Int64 {
+			preceding++
+		}
+		features = append(features, f)
+	}
+	return features, preceding, rows.Err()
+}
+
+// ReplaceAnomalies replaces the anomalies of the blocks with a timestamp in
+// [from, to) with anomalies.
+func (db *DB) ReplaceAnomalies(from, to time.Time, anomalies []*models.BlockAnomaly) error {
+	ctx := context.Background()
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	// DuckDB can't store a key deleted in the same transaction again, so
+	// the old anomalies are deleted first
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM block_anomalies WHERE timestamp >= ? AND timestamp < ?`, from, to); err != nil {
+		return fmt.Errorf("failed to delete anomalies: %w", err)
+	}
+	if len(anomalies) == 0 {
+		return nil
+	}
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		query, tail := insertQuery("block_anomalies", []string{"block_height", "dimension"}, anomalyColumns, true)
+		err := insertRows(ctx, tx, query, "(?, ?, ?, ?, ?, ?, ?, ?, ?)", tail, len(anomalies), func(i int) []any {
+			a := anomalies[i]
+			return []any{a.Height, a.BlockHash, a.Timestamp, a.Dimension, a.Value, a.Baseline, a.Score, a.Method, a.DetectedAt}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store anomalies: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetAnomalies returns the anomalies of the blocks with a timestamp in
+// [from, to), of every dimension or only of dimension, the most severe
+// first: by the absolute score, then by height. limit 0 returns them all.
+func (db *DB) GetAnomalies(from, to time.Time, dimension string, limit int) ([]*models.BlockAnomaly, error) {
+	query := `SELECT ` + strings.Join(anomalyColumns, ", ") + `
+	FROM block_anomalies
+	WHERE timestamp >= ? AND timestamp < ? AND (? = '' OR dimension = ?)
+	ORDER BY ABS(score) DESC, block_height, dimension`
+	args := []any{from, to, dimension, dimension}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var anomalies []*models.BlockAnomaly
+	for rows.Next() {
+		a := &models.BlockAnomaly{}
+		if err := rows.Scan(&a.Height, &a.BlockHash, &a.Timestamp, &a.Dimension, &a.Value, &a.Baseline,
+			&a.Score, &a.Method, &a.DetectedAt); err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAnomalies(t *testing.T) {
+	forEachDriver(t, testAnomalies)
+}
+
+// testAnomalies reads the features of blocks 0-3 and 5, of which 2 is
+// header-only, stores anomalies of them, replaces those of a day and
+// reorgs a block.
+func testAnomalies(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	coinbase := testTx{outs: []testOut{{"miner", 5000}}}
+	var blocks []*models.BlockData
+	for _, height := range []int64{0, 1, 2, 3, 5} {
+		data, _ := c.block(height, 0, coinbase)
+		data.Block.Weight = 4000
+		data.Block.TotalFees = 1000 * height
+		if height == 3 {
+			tx := data.Transactions[0]
+			data.OpReturns = []*models.OpReturnOutput{
+				{Txid: tx.Txid, Vout: 1, BlockHeight: height, DataHex: "00", DataSize: 1, Timestamp: tx.Timestamp},
+				{Txid: tx.Txid, Vout: 2, BlockHeight: height, DataHex: "0000", DataSize: 2, Timestamp: tx.Timestamp},
+			}
+		}
+		blocks = append(blocks, data)
+	}
+	storeBlocks(t, db, false, blocks[0], blocks[1], blocks[3], blocks[4])
+	header := *blocks[2].Block
+	header.Weight = 0
+	if _, err := db.InsertBlockHeaders(context.Background(), []*models.Block{&header}); err != nil {
+		t.Fatal(err)
+	}
+
+	describe := func(features []*models.BlockFeatures) []string {
+		var got []string
+		for _, f := range features {
+			interval := "-"
+			if f.Interval != nil {
+				interval = fmt.Sprint(*f.Interval)
+			}
+			got = append(got, fmt.Sprintf("%d %d %d %v %s %d", f.Height, f.TxCount, f.TotalFees, f.FeeRate, interval, f.OpReturnBytes))
+		}
+		return got
+	}
+	// The blocks from 00:30 on, after one block before them
+	from, to := c.genesis.Add(30*time.Minute), c.genesis.AddDate(0, 0, 1)
+	features, before, err := db.GetBlockFeatures(from, to, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(features), []string{"1 1 1000 1 600 0", "3 1 3000 3 600 3", "5 1 5000 5 - 0"}; !slices.Equal(got, want) || before != 1 {
+		t.Errorf("GetBlockFeatures() = %q, %d before, want %q, 1", got, before, want)
+	}
+	if features, before, err = db.GetBlockFeatures(c.genesis.AddDate(0, 0, 1), c.genesis.AddDate(0, 0, 2), 1); err != nil || features != nil || before != 0 {
+		t.Errorf("GetBlockFeatures() of a day without blocks = %q, %d, %v", describe(features), before, err)
+	}
+
+	anomaly := func(b *models.BlockData, dimension string, score float64) *models.BlockAnomaly {
+		return &models.BlockAnomaly{Height: b.Block.Height, BlockHash: b.Block.Hash, Timestamp: b.Block.Timestamp,
+			Dimension: dimension, Value: 1, Baseline: 2, Score: score, Method: "mad", DetectedAt: c.genesis}
+	}
+	all := []*models.BlockAnomaly{
+		anomaly(blocks[0], models.AnomalyFees, 4),
+		anomaly(blocks[3], models.AnomalyFees, -6),
+		anomaly(blocks[3], models.AnomalyTxCount, 5),
+		anomaly(blocks[4], models.AnomalyFees, 6),
+	}
+	if err := db.ReplaceAnomalies(c.genesis, to, all); err != nil {
+		t.Fatal(err)
+	}
+	// Replacing those from 00:30 drops block 3's fees and keeps block 0's
+	if err := db.ReplaceAnomalies(from, to, []*models.BlockAnomaly{all[2], all[3]}); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(dimension string, limit int) []string {
+		anomalies, err := db.GetAnomalies(c.genesis, to, dimension, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, a := range anomalies {
+			got = append(got, fmt.Sprintf("%d %s %v", a.Height, a.Dimension, a.Score))
+		}
+		return got
+	}
+	if got, want := read("", 0), []string{"5 total_fees 6", "3 tx_count 5", "0 total_fees 4"}; !slices.Equal(got, want) {
+		t.Errorf("GetAnomalies() = %q, want %q", got, want)
+	}
+	if got, want := read(models.AnomalyFees, 1), []string{"5 total_fees 6"}; !slices.Equal(got, want) {
+		t.Errorf("GetAnomalies(total_fees, 1) = %q, want %q", got, want)
+	}
+
+	reorged, _ := c.block(3, 1, coinbase)
+	storeBlocks(t, db, true, reorged)
+	if got, want := read("", 0), []string{"5 total_fees 6", "0 total_fees 4"}; !slices.Equal(got, want) {
+		t.Errorf("GetAnomalies() after a reorg = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetHeightRangeByTime returns the lowest and highest stored block heights
+// with a timestamp in [from, to), or sql.ErrNoRows if there are none.
+func (db *DB) GetHeightRangeByTime(from, to time.Time) (int64, int64, error) {
+	var minHeight, maxHeight sql.NullInt64
+	err := db.conn.QueryRow(`SELECT MIN(height), MAX(height) FROM blocks WHERE timestamp >= ? AND timestamp < ?`,
+		from, to).Scan(&minHeight, &maxHeight)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !minHeight.Valid {
+		return 0, 0, sql.ErrNoRows
+	}
+	return minHeight.Int64, maxHeight.Int64, nil
+}
+
+// GetBackfillProgress returns the last height a backfill of field over
+// [fromHeight, toHeight] completed, or fromHeight-1 if it hasn't started.
+func (db *DB) GetBackfillProgress(field string, fromHeight, toHeight int64) (int64, error) {
+	var last int64
+	err := db.conn.QueryRow(`SELECT last_height FROM backfill_progress
+	WHERE field = ? AND from_height = ? AND to_height = ?`, field, fromHeight, toHeight).Scan(&last)
+	if err == sql.ErrNoRows {
+		return fromHeight - 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last, nil
+}
+
+func (db *DB) SaveBackfillProgress(field string, fromHeight, toHeight, lastHeight int64) error {
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO backfill_progress (
+		field, from_height, to_height, last_height, updated_at
+	) VALUES (?, ?, ?, ?, ?)`, field, fromHeight, toHeight, lastHeight, models.Now())
+	return err
+}
+
+// BackfillFees recomputes input value and fee of the non-coinbase
+// transactions in [fromHeight, toHeight] from the stored outputs they spend,
+// then the total fees of their blocks. Transactions spending an output that
+// isn't stored keep their current values.
+func (db *DB) BackfillFees(fromHeight, toHeight int64) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE transactions
+	SET input_value = r.input_value, fee = r.input_value - transactions.output_value
+	FROM (
+		SELECT i.txid_spending AS txid,
+			CAST(SUM(po.value) AS BIGINT) AS input_value,
+			COUNT(po.value) AS resolved,
+			COUNT(*) AS inputs
+		FROM tx_inputs i
+		JOIN transactions t ON t.txid = i.txid_spending
+		LEFT JOIN tx_outputs po ON po.txid = i.prev_txid AND po.vout = i.prev_vout
+		WHERE t.block_height BETWEEN ? AND ?
+		GROUP BY i.txid_spending
+	) r
+	WHERE transactions.txid = r.txid AND r.resolved = r.inputs`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update transaction fees: %w", err)
+	}
+	updated, _ := res.RowsAffected()
+
+	_, err = tx.Exec(`UPDATE blocks
+	SET total_fees = f.total_fees
+	FROM (
+		SELECT block_hash, CAST(SUM(fee) AS BIGINT) AS total_fees
+		FROM transactions
+		WHERE block_height BETWEEN ? AND ? AND NOT is_coinbase
+		GROUP BY block_hash
+	) f
+	WHERE blocks.hash = f.block_hash`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update block fees: %w", err)
+	}
+
+	return updated, tx.Commit()
+}
+
+// BackfillFeeRates recomputes the fee rate of the transactions in
+// [fromHeight, toHeight] from their stored fee and virtual size.
+func (db *DB) BackfillFeeRates(fromHeight, toHeight int64) (int64, error) {
+	res, err := db.conn.Exec(`UPDATE transactions
+	SET fee_rate = CASE WHEN vsize > 0 THEN CAST(fee AS DOUBLE) / vsize ELSE 0 END
+	WHERE block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update fee rates: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// BackfillRBF recomputes whether the transactions in [fromHeight, toHeight]
+// signal replaceability (BIP125) from the sequence of their stored inputs.
+func (db *DB) BackfillRBF(fromHeight, toHeight int64) (int64, error) {
+	res, err := db.conn.Exec(`UPDATE transactions
+	SET signals_rbf = COALESCE(r.signals_rbf, FALSE)
+	FROM (
+		SELECT t.txid, bool_or(i.sequence < 4294967294) AS signals_rbf
+		FROM transactions t
+		LEFT JOIN tx_inputs i ON i.txid_spending = t.txid
+		WHERE t.block_height BETWEEN ? AND ?
+		GROUP BY t.txid
+	) r
+	WHERE transactions.txid = r.txid`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update RBF signaling: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// LinkSpentOutputsInRange links the unlinked outputs created in
+// [fromHeight, toHeight] to the stored inputs that spend them.
+func (db *DB) LinkSpentOutputsInRange(fromHeight, toHeight int64) (int64, error) {
+	res, err := db.conn.Exec(`UPDATE tx_outputs
+	SET spent_txid = i.txid_spending, spent_vout = i.vout
+	FROM tx_inputs i, transactions t
+	WHERE i.prev_txid = tx_outputs.txid AND i.prev_vout = tx_outputs.vout
+		AND t.txid = tx_outputs.txid AND t.block_height BETWEEN ? AND ?
+		AND tx_outputs.spent_txid IS NULL`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link spent outputs: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// InsertBlockStats stores the aggregates of several blocks in one
+// transaction, replacing what is stored at their heights.
+func (db *DB) InsertBlockStats(ctx context.Context, stats []*models.BlockStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	query := `INSERT OR REPLACE INTO block_stats (
+		height, block_hash, timestamp, median_time, tx_count, inputs, outputs,
+		total_size, total_weight, total_fee, subsidy, total_out,
+		avg_fee, min_fee, max_fee, median_fee, avg_fee_rate, min_fee_rate, max_fee_rate,
+		fee_rate_p10, fee_rate_p25, fee_rate_p50, fee_rate_p75, fee_rate_p90,
+		segwit_tx_count, segwit_total_size, utxo_increase, utxo_size_increase, processed_at
+	) VALUES `
+	row := "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		err := insertRows(ctx, tx, query, row, "", len(stats), func(i int) []any {
+			s := stats[i]
+			p := s.FeeRatePercentiles
+			return []any{
+				s.Height, s.BlockHash, s.Timestamp, s.MedianTime, s.TxCount, s.Inputs, s.Outputs,
+				s.TotalSize, s.TotalWeight, s.TotalFee, s.Subsidy, s.TotalOut,
+				s.AvgFee, s.MinFee, s.MaxFee, s.MedianFee, s.AvgFeeRate, s.MinFeeRate, s.MaxFeeRate,
+				p[0], p[1], p[2], p[3], p[4],
+				s.SegwitTxCount, s.SegwitTotalSize, s.UTXOIncrease, s.UTXOSizeIncrease, s.ProcessedAt,
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to insert block stats: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetBlockStatsHeights returns the heights in [fromHeight, toHeight] whose
+// aggregates are stored in block_stats.
+func (db *DB) GetBlockStatsHeights(fromHeight, toHeight int64) (map[int64]bool, error) {
+	rows, err := db.conn.Query(`SELECT height FROM block_stats WHERE height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[int64]bool)
+	for rows.Next() {
+		var height int64
+		if err := rows.Scan(&height); err != nil {
+			return nil, err
+		}
+		stored[height] = true
+	}
+	return stored, rows.Err()
+}
+
+// CountBlockStats returns the number of heights in [fromHeight, toHeight]
+// whose aggregates are stored in block_stats.
+func (db *DB) CountBlockStats(fromHeight, toHeight int64) (int64, error) {
+	var n int64
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM block_stats WHERE height BETWEEN ? AND ?`, fromHeight, toHeight).Scan(&n)
+	return n, err
+}
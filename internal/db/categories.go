@@ -0,0 +1,66 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// txCategoryCase computes tx_category from the input and output counts the
+// way models.ClassifyTransaction does.
+var txCategoryCase = fmt.Sprintf(`CASE
+		WHEN input_count >= %[1]d AND output_count <= %[3]d THEN '%[4]s'
+		WHEN input_count <= %[3]d AND output_count >= %[2]d THEN '%[5]s'
+		WHEN input_count <= %[3]d AND output_count = 2 THEN '%[6]s'
+		ELSE '%[7]s'
+	END`, models.ConsolidationMinInputs, models.BatchMinOutputs, models.FewCoins,
+	models.TxConsolidation, models.TxBatch, models.TxSimple, models.TxOther)
+
+// BackfillTxCategories classifies the transactions in [fromHeight, toHeight]
+// from their stored input and output counts.
+func (db *DB) BackfillTxCategories(fromHeight, toHeight int64) (int64, error) {
+	res, err := db.conn.Exec(`UPDATE transactions SET tx_category = `+txCategoryCase+`
+	WHERE block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update transaction categories: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetTxCategoriesByDay counts the non-coinbase transactions of each
+// category per day in the given time range. Transactions scraped before
+// categories were recorded are left out, and a database opened read-only
+// before they existed has none.
+func (db *DB) GetTxCategoriesByDay(from, to time.Time) ([]*models.TxCategoryDailyStats, error) {
+	var n int
+	if err := db.conn.QueryRow(db.dialect.columnExists, "transactions", "tx_category").Scan(&n); err != nil || n == 0 {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT
+		date_trunc('day', timestamp) AS day,
+		COUNT(*),
+		COUNT(*) FILTER (WHERE tx_category = ?),
+		COUNT(*) FILTER (WHERE tx_category = ?),
+		COUNT(*) FILTER (WHERE tx_category = ?),
+		COUNT(*) FILTER (WHERE tx_category = ?)
+	FROM transactions
+	WHERE timestamp >= ? AND timestamp < ? AND NOT is_coinbase AND tx_category IS NOT NULL
+	GROUP BY day
+	ORDER BY day`,
+		string(models.TxConsolidation), string(models.TxBatch), string(models.TxSimple), string(models.TxOther), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.TxCategoryDailyStats
+	for rows.Next() {
+		s := &models.TxCategoryDailyStats{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Transactions, &s.Consolidations, &s.Batches, &s.Simple, &s.Other); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+func TestTxCategories(t *testing.T) {
+	forEachDriver(t, testTxCategories)
+}
+
+// testTxCategories stores a transaction of every category on day 0 and a
+// batch payment on day 1, backfills the categories of a database created
+// before they were recorded, and counts them per day.
+func testTxCategories(t *testing.T, driver string) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := Open(driver, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.(*DB)
+	defer func() { db.Close() }()
+
+	c := newTestChain()
+	coinbase := testTx{outs: []testOut{{"miner", 5000}}}
+	genesis, coins := c.block(0, 0, testTx{outs: []testOut{
+		{"A", 100}, {"A", 100}, {"A", 100}, {"A", 100}, {"A", 100}, {"A", 100}, {"A", 100}, {"A", 100},
+	}})
+	outs := func(n int) []testOut {
+		var outs []testOut
+		for i := range n {
+			outs = append(outs, testOut{fmt.Sprintf("B%d", i), 10})
+		}
+		return outs
+	}
+	day0, _ := c.block(1, 0, coinbase,
+		testTx{ins: coins[0][0:3], outs: outs(1)}, // consolidation
+		testTx{ins: coins[0][3:4], outs: outs(5)}, // batch
+		testTx{ins: coins[0][4:5], outs: outs(2)}, // simple
+		testTx{ins: coins[0][5:6], outs: outs(1)}, // other
+	)
+	day1, _ := c.block(144, 0, coinbase, testTx{ins: coins[0][6:8], outs: outs(3)})
+	blocks := []*models.BlockData{genesis, day0, day1}
+	for _, data := range blocks {
+		for _, tx := range data.Transactions {
+			tx.Category = models.ClassifyTransaction(tx.InputCount, tx.OutputCount)
+		}
+	}
+	storeBlocks(t, db, false, blocks...)
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	categories := func() string {
+		stats, err := db.GetTxCategoriesByDay(from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, s := range stats {
+			got += fmt.Sprintf("%s %d %d/%d/%d/%d; ", s.Day.Format("01-02"), s.Transactions, s.Consolidations, s.Batches, s.Simple, s.Other)
+		}
+		return got
+	}
+	want := "01-01 4 1/1/1/1; 01-02 1 0/1/0/0; "
+	if got := categories(); got != want {
+		t.Errorf("categories %q, want %q", got, want)
+	}
+
+	// Open the database as it was before the categories were recorded
+	if _, err := db.conn.Exec(`ALTER TABLE transactions DROP COLUMN tx_category`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	store, err = Open(driver, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = store.(*DB)
+	if got := categories(); got != "" {
+		t.Errorf("categories %q before the backfill, want none", got)
+	}
+	n, err := db.BackfillTxCategories(0, 144)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Errorf("backfilled %d transactions, want 8", n)
+	}
+	if got := categories(); got != want {
+		t.Errorf("categories %q after the backfill, want %q", got, want)
+	}
+}
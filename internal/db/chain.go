@@ -0,0 +1,29 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// GetBlockHashAtHeight returns the hash of the block stored at height, the
+// most recently processed one if a reorg left several. It returns
+// sql.ErrNoRows if no block is stored at height.
+func (db *DB) GetBlockHashAtHeight(height int64) (string, error) {
+	var hash string
+	err := db.conn.QueryRow(`SELECT hash FROM blocks WHERE height = ? ORDER BY processed_at DESC LIMIT 1`,
+		height).Scan(&hash)
+	return hash, err
+}
+
+// InsertChainBreak records a broken link between two stored blocks. A break
+// already recorded is left as is.
+func (db *DB) InsertChainBreak(b *models.ChainBreak) error {
+	_, err := db.conn.Exec(`INSERT OR IGNORE INTO chain_breaks (
+		height, block_hash, previous_block_hash, stored_previous_hash, detected_at
+	) VALUES (?, ?, ?, ?, ?)`,
+		b.Height, b.BlockHash, b.PreviousBlockHash, b.StoredPreviousHash, b.DetectedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record chain break at height %d: %w", b.Height, err)
+	}
+	return nil
+}
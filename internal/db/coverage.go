@@ -0,0 +1,36 @@
+package db
+
+import "scrapbtc/pkg/models"
+
+// GetCoverage returns the contiguous ranges of completed heights between
+// fromHeight and toHeight, in order. Blocks stored by a header sync, failed
+// or interrupted ones aren't covered.
+func (db *DB) GetCoverage(fromHeight, toHeight int64) ([]models.HeightRange, error) {
+	return db.completedRanges(`block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+}
+
+// MissingRanges returns the ranges between fromHeight and toHeight that the
+// ordered, non-overlapping covered ranges leave out.
+func MissingRanges(fromHeight, toHeight int64, covered []models.HeightRange) []models.HeightRange {
+	var missing []models.HeightRange
+	next := fromHeight
+	for _, r := range covered {
+		if r.From > next {
+			missing = append(missing, models.HeightRange{From: next, To: min(r.From-1, toHeight)})
+		}
+		next = max(next, r.To+1)
+		if next > toHeight {
+			return missing
+		}
+	}
+	return append(missing, models.HeightRange{From: next, To: toHeight})
+}
+
+// CoveredBlocks returns the number of heights in ranges.
+func CoveredBlocks(ranges []models.HeightRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.To - r.From + 1
+	}
+	return n
+}
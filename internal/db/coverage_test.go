@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	forEachDriver(t, testCoverage)
+}
+
+// testCoverage completes heights 0-4 and 7-9, fails 5 and leaves 6 with
+// its header only.
+func testCoverage(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	coinbase := testTx{outs: []testOut{{"miner", 5000}}}
+	for _, height := range []int64{0, 1, 2, 3, 4, 7, 8, 9} {
+		data, _ := c.block(height, 0, coinbase)
+		storeBlocks(t, db, false, data)
+	}
+	if err := db.MarkBlockProcessing(context.Background(), 5, blockHash(5, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkBlockFailed(5, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	header, _ := c.block(6, 0)
+	if _, err := db.InsertBlockHeaders(context.Background(), []*models.Block{header.Block}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		from, to int64
+		want     []models.HeightRange
+	}{
+		{0, 9, []models.HeightRange{{From: 0, To: 4}, {From: 7, To: 9}}},
+		{2, 8, []models.HeightRange{{From: 2, To: 4}, {From: 7, To: 8}}},
+		{5, 6, nil},
+	} {
+		got, err := db.GetCoverage(test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("GetCoverage(%d, %d) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	covered := []models.HeightRange{{From: 10, To: 19}, {From: 30, To: 30}}
+	for _, test := range []struct {
+		from, to int64
+		want     []models.HeightRange
+	}{
+		{0, 40, []models.HeightRange{{From: 0, To: 9}, {From: 20, To: 29}, {From: 31, To: 40}}},
+		{10, 30, []models.HeightRange{{From: 20, To: 29}}},
+		{12, 25, []models.HeightRange{{From: 20, To: 25}}},
+		{0, 5, []models.HeightRange{{From: 0, To: 5}}},
+	} {
+		if got := MissingRanges(test.from, test.to, covered); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MissingRanges(%d, %d) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+	if got := CoveredBlocks(covered); got != 11 {
+		t.Errorf("CoveredBlocks() = %d, want 11", got)
+	}
+}
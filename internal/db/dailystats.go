@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// DailyStatsOptions selects the smoothed series GetDailyStats adds to the
+// daily values.
+type DailyStatsOptions struct {
+	// RollingWindow is the number of days averaged by the rolling
+	// averages, 0 for none.
+	RollingWindow int
+	// PartialWindows averages the stored days of windows that miss some,
+	// at the start of the stored blocks or around gaps, instead of leaving
+	// their averages NULL.
+	PartialWindows bool
+	// EMAAlpha is the smoothing factor of the exponential moving averages,
+	// in (0, 1], 0 for none.
+	EMAAlpha float64
+}
+
+// selectDailyStats sums the blocks per day and averages them over the
+// window of the days ordered by their number since the Unix epoch, so days
+// without stored blocks count as missing rather than shifting the window.
+// The days counts the stored days in each window.
+const selectDailyStats = `
+WITH volume AS (
+	SELECT block_height, SUM(output_value) AS output_value
+	FROM transactions
+	WHERE timestamp >= ? AND timestamp < ? AND NOT is_coinbase
+	GROUP BY block_height
+), daily AS (
+	SELECT
+		date_trunc('day', b.timestamp) AS day,
+		COUNT(*) AS blocks,
+		CAST(SUM(b.tx_count) AS BIGINT) AS txs,
+		CAST(SUM(b.total_fees) AS BIGINT) AS fees,
+		CAST(COALESCE(SUM(v.output_value), 0) AS BIGINT) AS volume
+	FROM blocks b
+	LEFT JOIN volume v ON v.block_height = b.height
+	WHERE b.timestamp >= ? AND b.timestamp < ?
+	GROUP BY day
+), rolling AS (
+	SELECT
+		day, blocks, txs, fees, volume,
+		COUNT(*) OVER w AS days,
+		AVG(txs) OVER w AS txs_avg,
+		AVG(fees) OVER w AS fees_avg,
+		AVG(volume) OVER w AS volume_avg
+	FROM daily
+	WINDOW w AS (ORDER BY CAST(epoch(day) / 86400 AS BIGINT) RANGE BETWEEN %d PRECEDING AND CURRENT ROW)
+)
+SELECT day, blocks, txs, fees, volume, days, txs_avg, fees_avg, volume_avg
+FROM rolling
+WHERE day >= ?
+ORDER BY day`
+
+// GetDailyStats returns the transactions, fees and volume per day for the
+// blocks in [from, to), with the rolling and exponential moving averages
+// selected by opts. Rolling windows reach back before from, so only the
+// first days of the stored blocks have partial windows; the exponential
+// moving averages start from the first day of the range.
+func (db *DB) GetDailyStats(from, to time.Time, opts DailyStatsOptions) ([]*models.DailyStats, error) {
+	if opts.RollingWindow < 0 {
+		return nil, fmt.Errorf("invalid rolling window of %d days", opts.RollingWindow)
+	}
+	if opts.EMAAlpha < 0 || opts.EMAAlpha > 1 {
+		return nil, fmt.Errorf("invalid EMA alpha %g: must be in (0, 1]", opts.EMAAlpha)
+	}
+	window := max(opts.RollingWindow, 1)
+	start := from.AddDate(0, 0, -(window - 1))
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectDailyStats, window-1), start, to, start, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.DailyStats
+	for rows.Next() {
+		s := &models.DailyStats{}
+		var days int
+		var txsAvg, feesAvg, volumeAvg sql.NullFloat64
+		if err := rows.Scan(scanTime(&s.Day), &s.Blocks, &s.Transactions, &s.Fees, &s.Volume,
+			&days, &txsAvg, &feesAvg, &volumeAvg); err != nil {
+			return nil, err
+		}
+		if opts.RollingWindow > 0 && (days == window || opts.PartialWindows) {
+			s.TransactionsAvg = &txsAvg.Float64
+			s.FeesAvg = &feesAvg.Float64
+			s.VolumeAvg = &volumeAvg.Float64
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.EMAAlpha > 0 {
+		addEMAs(stats, opts.EMAAlpha)
+	}
+	return stats, nil
+}
+
+// addEMAs sets the exponential moving averages of stats, seeded with the
+// values of the first day.
+func addEMAs(stats []*models.DailyStats, alpha float64) {
+	var txs, fees, volume float64
+	for i, s := range stats {
+		if i == 0 {
+			txs, fees, volume = float64(s.Transactions), float64(s.Fees), float64(s.Volume)
+		} else {
+			txs += alpha * (float64(s.Transactions) - txs)
+			fees += alpha * (float64(s.Fees) - fees)
+			volume += alpha * (float64(s.Volume) - volume)
+		}
+		t, f, v := txs, fees, volume
+		s.TransactionsEMA, s.FeesEMA, s.VolumeEMA = &t, &f, &v
+	}
+}
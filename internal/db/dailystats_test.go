@@ -0,0 +1,78 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDailyStats(t *testing.T) {
+	forEachDriver(t, testDailyStats)
+}
+
+// testDailyStats stores a block on days 0, 1, 2 and 4 with 1, 2, 3 and 5
+// transactions besides the coinbase, and averages them over 2 days from
+// day 1 on: day 0 fills the first window, but day 3 is missing from the
+// last one.
+func testDailyStats(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	for day, n := range map[int64]int{0: 1, 1: 2, 2: 3, 4: 5} {
+		txs := []testTx{{outs: []testOut{{"miner", 5000}}}}
+		for range n {
+			txs = append(txs, testTx{outs: []testOut{{"A", 100}}})
+		}
+		data, _ := c.block(day*144, 0, txs...)
+		for i, tx := range data.Transactions {
+			tx.IsCoinbase = i == 0
+		}
+		data.Block.TotalFees = int64(10 * n)
+		storeBlocks(t, db, false, data)
+	}
+
+	from, to := c.genesis.AddDate(0, 0, 1), c.genesis.AddDate(0, 0, 5)
+	for _, test := range []struct {
+		opts DailyStatsOptions
+		want []string
+	}{
+		{DailyStatsOptions{}, []string{
+			"01-02 3 20 200 <nil> <nil> <nil> <nil>",
+			"01-03 4 30 300 <nil> <nil> <nil> <nil>",
+			"01-05 6 50 500 <nil> <nil> <nil> <nil>",
+		}},
+		{DailyStatsOptions{RollingWindow: 2}, []string{
+			"01-02 3 20 200 2.5 15 150 <nil>",
+			"01-03 4 30 300 3.5 25 250 <nil>",
+			"01-05 6 50 500 <nil> <nil> <nil> <nil>",
+		}},
+		{DailyStatsOptions{RollingWindow: 2, PartialWindows: true, EMAAlpha: 0.5}, []string{
+			"01-02 3 20 200 2.5 15 150 3",
+			"01-03 4 30 300 3.5 25 250 3.5",
+			"01-05 6 50 500 6 50 500 4.75",
+		}},
+	} {
+		stats, err := db.GetDailyStats(from, to, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range stats {
+			got = append(got, fmt.Sprintf("%s %d %d %d %v %v %v %v", s.Day.Format("01-02"), s.Transactions, s.Fees, s.Volume,
+				deref(s.TransactionsAvg), deref(s.FeesAvg), deref(s.VolumeAvg), deref(s.TransactionsEMA)))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%+v:\n got %q\nwant %q", test.opts, got, test.want)
+		}
+	}
+
+	if _, err := db.GetDailyStats(from, to, DailyStatsOptions{EMAAlpha: 1.5}); err == nil {
+		t.Error("GetDailyStats() accepted an EMA alpha of 1.5")
+	}
+}
+
+func deref(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
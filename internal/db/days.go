@@ -0,0 +1,44 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetCompletedDays returns the days in [from, to) recorded as complete, with
+// the heights they were resolved to then.
+func (db *DB) GetCompletedDays(from, to time.Time) ([]*models.DayRange, error) {
+	rows, err := db.conn.Query(`SELECT day, from_height, to_height FROM days_complete
+	WHERE day >= ? AND day < ?
+	ORDER BY day`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []*models.DayRange
+	for rows.Next() {
+		d := &models.DayRange{}
+		if err := rows.Scan(scanTime(&d.Day), &d.FromHeight, &d.ToHeight); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+
+	return days, rows.Err()
+}
+
+// MarkDayComplete records that every block of d is stored, replacing what
+// was recorded for the day with heights it resolved to differently.
+func (db *DB) MarkDayComplete(d *models.DayRange) error {
+	_, err := db.conn.Exec(`INSERT INTO days_complete (day, from_height, to_height, completed_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (day) DO UPDATE SET
+		from_height = excluded.from_height, to_height = excluded.to_height, completed_at = excluded.completed_at`,
+		d.Day, d.FromHeight, d.ToHeight, models.Now())
+	if err != nil {
+		return fmt.Errorf("failed to mark day %s complete: %w", d.Day.Format("2006-01-02"), err)
+	}
+	return nil
+}
@@ -1,119 +1,803 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"scrapbtc/pkg/models"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/marcboeker/go-duckdb"
 )
 
+// ErrDatabaseLocked is returned when another process holds the lock on the
+// database file.
+var ErrDatabaseLocked = errors.New("database is locked by another process")
+
 type DB struct {
-	conn *sql.DB
+	conn     *sql.DB
+	driver   string
+	dialect  *dialect
+	readOnly bool
+	// priceGap is the maximum gap GetPriceAt interpolates over, see
+	// SetMaxPriceGap.
+	priceGap time.Duration
+
+	// writeMu serializes the block writes that update shared rows, such as
+	// address rollups: blocks processed concurrently often touch the same
+	// addresses, and DuckDB aborts one of two transactions updating the same
+	// row. The processing status transitions take it for the same reason.
+	writeMu sync.Mutex
+	// clock, when set, replaces models.Now as the time blocks are stored
+	// at, for tests.
+	clock func() time.Time
 }
 
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("duckdb", dbPath)
+	conn, err := openConn(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, driver: DriverDuckDB, dialect: duckdbDialect}
 	if err := db.createTables(); err != nil {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
+	if dbPath == MemoryPath {
+		if err := db.SetMetadata(MetadataInMemory, "true"); err != nil {
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
 
+// NewReadOnlyDB opens an existing database without creating or migrating
+// tables. Any number of read-only connections may share the file, but not
+// while a process has it open for writing.
+func NewReadOnlyDB(dbPath string) (*DB, error) {
+	conn, err := openConn(dbPath + "?access_mode=read_only")
+	if err != nil {
+		return nil, err
+	}
+	return &DB{conn: conn, driver: DriverDuckDB, dialect: duckdbDialect, readOnly: true}, nil
+}
+
+func openConn(dsn string) (*sql.DB, error) {
+	conn, err := sql.Open("duckdb", dsn)
+	if err != nil {
+		if strings.Contains(err.Error(), "Could not set lock on file") {
+			return nil, fmt.Errorf("%w: %v", ErrDatabaseLocked, err)
+		}
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return conn, nil
+}
+
+// ReadOnly reports whether the database was opened with NewReadOnlyDB.
+func (db *DB) ReadOnly() bool {
+	return db.readOnly
+}
+
 func (db *DB) createTables() error {
-	queries := []string{
-		CreateBlocksTable,
-		CreateTransactionsTable,
-		CreateTxInputsTable,
-		CreateTxOutputsTable,
-		CreateProcessingStatusTable,
-		CreatePriceDataTable,
+	for _, query := range db.dialect.tables {
+		if _, err := db.conn.Exec(query); err != nil {
+			return fmt.Errorf("failed to execute schema query: %w", err)
+		}
+	}
+
+	if err := db.resetDailyMetrics(); err != nil {
+		return fmt.Errorf("failed to migrate daily_metrics: %w", err)
+	}
+
+	if db.driver == DriverDuckDB {
+		if err := db.widenInputSequence(); err != nil {
+			return fmt.Errorf("failed to migrate tx_inputs.sequence: %w", err)
+		}
+
+		if err := db.allowNewStatuses(); err != nil {
+			return fmt.Errorf("failed to migrate processing_status: %w", err)
+		}
 	}
 
+	if err := db.addBlockTimings(); err != nil {
+		return fmt.Errorf("failed to migrate processing_status: %w", err)
+	}
+	if err := db.addTxCategory(); err != nil {
+		return fmt.Errorf("failed to migrate transactions: %w", err)
+	}
+
+	queries := []string{db.dialect.txIOKeys}
+	if db.driver == DriverDuckDB {
+		queries = append(queries, Migrations)
+	}
 	for _, query := range queries {
 		if _, err := db.conn.Exec(query); err != nil {
 			return fmt.Errorf("failed to execute schema query: %w", err)
 		}
 	}
 
+	if db.driver == DriverDuckDB {
+		// After Migrations, which add the columns copied over
+		if err := db.keyTransactionsByBlock(); err != nil {
+			return fmt.Errorf("failed to migrate transactions: %w", err)
+		}
+	}
+
+	return db.CreatePriceJoinView()
+}
+
+// dailyMetricsCurrent reports whether daily_metrics has the ratio inputs,
+// which tables created by older versions lack.
+func (db *DB) dailyMetricsCurrent() (bool, error) {
+	var n int
+	err := db.conn.QueryRow(db.dialect.columnExists, "daily_metrics", "transferred_ex_change").Scan(&n)
+	return n > 0, err
+}
+
+// resetDailyMetrics recreates daily_metrics when it lacks the ratio inputs.
+// It only caches what analysis.DailyMetrics computes, which fills it again.
+func (db *DB) resetDailyMetrics() error {
+	current, err := db.dailyMetricsCurrent()
+	if err != nil || current {
+		return err
+	}
+	if _, err := db.conn.Exec(`DROP TABLE daily_metrics`); err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(CreateDailyMetricsTable)
+	return err
+}
+
+// blockTimingColumns are the processing_status columns models.BlockTiming
+// is stored in.
+var blockTimingColumns = []string{"rpc_fetch_ms", "parse_ms", "db_insert_ms", "total_ms"}
+
+// addBlockTimings adds the timing columns to processing_status in databases
+// created before they existed, with either driver.
+func (db *DB) addBlockTimings() error {
+	var n int
+	if err := db.conn.QueryRow(db.dialect.columnExists, "processing_status", "total_ms").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	for _, column := range blockTimingColumns {
+		if _, err := db.conn.Exec(`ALTER TABLE processing_status ADD COLUMN ` + column + ` BIGINT`); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// addTxCategory adds tx_category to transactions in databases created
+// before it existed, with either driver. The backfill fills it in.
+func (db *DB) addTxCategory() error {
+	var n int
+	if err := db.conn.QueryRow(db.dialect.columnExists, "transactions", "tx_category").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	_, err := db.conn.Exec(`ALTER TABLE transactions ADD COLUMN tx_category VARCHAR`)
+	return err
+}
+
+// keyTransactionsByBlock recreates transactions in databases created when
+// txid alone was its primary key, which dropped the second of the BIP30
+// duplicate coinbases, since DuckDB can't change a primary key in place.
+// The dropped rows come back when their blocks are reprocessed.
+func (db *DB) keyTransactionsByBlock() error {
+	var current bool
+	query := `SELECT COUNT(*) > 0 FROM duckdb_constraints()
+	WHERE table_name = 'transactions' AND constraint_type = 'PRIMARY KEY'
+		AND len(constraint_column_names) = 2`
+	if err := db.conn.QueryRow(query).Scan(&current); err != nil {
+		return err
+	}
+	if current {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The secondary indexes are recreated by CreateIndexes
+	columns := strings.Join(transactionColumns, ", ")
+	for _, query := range []string{
+		`DROP INDEX IF EXISTS idx_transactions_block_hash`,
+		`DROP INDEX IF EXISTS idx_transactions_block_height`,
+		`DROP INDEX IF EXISTS idx_transactions_timestamp`,
+		`ALTER TABLE transactions RENAME TO transactions_old`,
+		CreateTransactionsTable,
+		`INSERT INTO transactions (` + columns + `) SELECT ` + columns + ` FROM transactions_old`,
+		`DROP TABLE transactions_old`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// allowNewStatuses recreates processing_status in databases created before
+// the 'interrupted' or 'headers_only' status existed, since DuckDB can't
+// alter a CHECK constraint in place.
+func (db *DB) allowNewStatuses() error {
+	var current bool
+	query := `SELECT COUNT(*) > 0 FROM duckdb_constraints()
+	WHERE table_name = 'processing_status' AND constraint_type = 'CHECK'
+		AND constraint_text LIKE '%headers_only%'`
+	if err := db.conn.QueryRow(query).Scan(&current); err != nil {
+		return err
+	}
+	if current {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DROP INDEX IF EXISTS idx_processing_status_status`,
+		`ALTER TABLE processing_status RENAME TO processing_status_old`,
+		CreateProcessingStatusTable,
+		`INSERT INTO processing_status (block_height, block_hash, status, started_at, completed_at, error_message)
+		SELECT block_height, block_hash, status, started_at, completed_at, error_message
+		FROM processing_status_old`,
+		`DROP TABLE processing_status_old`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// widenInputSequence converts tx_inputs.sequence from INTEGER, which cannot
+// hold the common 0xffffffff value, to BIGINT in databases created by older
+// versions.
+func (db *DB) widenInputSequence() error {
+	var dataType string
+	query := `SELECT data_type FROM information_schema.columns WHERE table_name = 'tx_inputs' AND column_name = 'sequence'`
+	if err := db.conn.QueryRow(query).Scan(&dataType); err != nil {
+		return err
+	}
+	if dataType == "BIGINT" {
+		return nil
+	}
+
+	// DuckDB can't change a column type while indexes depend on the table;
+	// they are recreated by createTables and CreateIndexes.
+	_, err := db.conn.Exec(`
+	DROP INDEX IF EXISTS idx_tx_inputs_outpoint;
+	DROP INDEX IF EXISTS idx_tx_inputs_txid;
+	DROP INDEX IF EXISTS idx_tx_inputs_prev;
+	ALTER TABLE tx_inputs ALTER COLUMN sequence SET DATA TYPE BIGINT;
+	`)
+	return err
+}
+
+// inTx runs fn in a transaction that is committed if fn succeeds.
+func (db *DB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// now returns the time rows are stored at, to the microsecond the
+// databases keep, so the stored blocks equal the ones passed in.
+func (db *DB) now() time.Time {
+	if db.clock != nil {
+		return db.clock()
+	}
+	return models.Now().Truncate(time.Microsecond)
+}
+
+// stampProcessed sets the processed_at of blocks and their transactions to
+// t, the time they are stored at rather than parsed at. Writers take it
+// under writeMu in the transaction storing the blocks, so rows committed
+// later always have later times and the watermark of ExportSince covers
+// every row committed before it.
+func stampProcessed(blocks []*models.BlockData, t time.Time) {
+	for _, data := range blocks {
+		data.Block.ProcessedAt = t
+		for _, tx := range data.Transactions {
+			tx.ProcessedAt = t
+		}
+	}
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-func (db *DB) InsertBlock(block *models.Block) error {
-	query := `INSERT OR IGNORE INTO blocks (
-		hash, height, timestamp, size, weight, tx_count,
-		previous_block_hash, merkle_root, nonce, bits, difficulty, processed_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+func (db *DB) InsertBlock(ctx context.Context, block *models.Block) error {
+	return insertBlock(ctx, db.conn, block, false)
+}
 
-	_, err := db.conn.Exec(query,
+// InsertBlockWithTransactions stores a block with its transactions, inputs,
+// outputs and OP_RETURN payloads, marks the outputs it spends, updates the
+// address rollups and marks the block completed in a single transaction, so
+// a block is either fully stored and completed or not stored at all. The
+// block must have been marked processing.
+func (db *DB) InsertBlockWithTransactions(ctx context.Context, data *models.BlockData) error {
+	return db.InsertBlocksWithTransactions(ctx, []*models.BlockData{data})
+}
+
+// InsertBlocksWithTransactions stores several blocks like
+// InsertBlockWithTransactions, in the given order and in a single
+// transaction: if one block fails, none of them is stored. The rows of all
+// blocks are inserted together, which is much faster than block by block.
+func (db *DB) InsertBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error {
+	return db.insertBlocksWithTransactions(ctx, blocks, false)
+}
+
+// ReplaceBlocksWithTransactions stores blocks like
+// InsertBlocksWithTransactions in place of whatever is stored at their
+// heights, in the same transaction: if it fails, the old rows are kept.
+// Rows the blocks store again are updated rather than deleted and
+// reinserted, which DuckDB rejects within a transaction, and the others are
+// deleted. DuckDB can't update indexed columns either, so the secondary
+// indexes are dropped first; CreateIndexes restores them.
+func (db *DB) ReplaceBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error {
+	return db.insertBlocksWithTransactions(ctx, blocks, true)
+}
+
+func (db *DB) insertBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData, replace bool) error {
+	var (
+		transactions []*models.Transaction
+		outputs      []*models.TxOutput
+		inputs       []*models.TxInput
+		opReturns    []*models.OpReturnOutput
+		watched      []*models.WatchedActivity
+		spends       []*models.SpentOutput
+	)
+	for _, data := range blocks {
+		transactions = append(transactions, data.Transactions...)
+		outputs = append(outputs, data.Outputs...)
+		inputs = append(inputs, data.Inputs...)
+		opReturns = append(opReturns, data.OpReturns...)
+		watched = append(watched, data.Watched...)
+		for _, in := range data.Inputs {
+			spends = append(spends, &models.SpentOutput{
+				PrevTxid:     in.PrevTxid,
+				PrevVout:     in.PrevVout,
+				SpendingTxid: in.TxidSpending,
+				SpendingVin:  in.Vout,
+			})
+		}
+	}
+
+	// The header rows of blocks synced with headers only are replaced by
+	// the full blocks
+	if !replace {
+		var err error
+		if replace, err = db.hasStoredBlocks(ctx, blocks); err != nil {
+			return err
+		}
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	if replace && db.driver == DriverDuckDB {
+		if err := db.DropQueryIndexes(); err != nil {
+			return err
+		}
+	}
+
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		stampProcessed(blocks, db.now())
+		var reverted []string
+		if replace {
+			heights := make([]int64, len(blocks))
+			for i, data := range blocks {
+				heights[i] = data.Block.Height
+			}
+			var err error
+			if reverted, err = unlinkBlockData(ctx, tx, heights); err != nil {
+				return err
+			}
+		}
+		for _, data := range blocks {
+			if err := insertBlock(ctx, tx, data.Block, replace); err != nil {
+				return fmt.Errorf("failed to insert block %d: %w", data.Block.Height, err)
+			}
+		}
+		if err := insertTransactions(ctx, tx, transactions, replace); err != nil {
+			return err
+		}
+		if err := db.insertTxOutputs(ctx, tx, outputs, replace); err != nil {
+			return err
+		}
+		if err := insertAddressFirstSeen(ctx, tx, blocks); err != nil {
+			return err
+		}
+		if err := db.insertTxInputs(ctx, tx, inputs, replace); err != nil {
+			return err
+		}
+		if err := insertOpReturns(ctx, tx, opReturns, replace); err != nil {
+			return err
+		}
+		if err := insertWatchedActivity(ctx, tx, watched, replace); err != nil {
+			return err
+		}
+		if err := markOutputsSpent(ctx, tx, spends); err != nil {
+			return err
+		}
+		for _, data := range blocks {
+			block := data.Block
+			if err := upsertAddressStats(ctx, tx, block.Hash, block.Height); err != nil {
+				return fmt.Errorf("failed to update address stats: %w", err)
+			}
+		}
+		if replace {
+			// The old rows are deleted once the new blocks are applied,
+			// since dropping the addresses of a reverted block reads its
+			// outputs, and before outputs are linked to the old inputs
+			for _, hash := range reverted {
+				if err := dropUnseenAddresses(ctx, tx, hash); err != nil {
+					return err
+				}
+			}
+			for _, data := range blocks {
+				if err := deleteStaleBlockData(ctx, tx, data.Block.Height, data.Block.Hash); err != nil {
+					return err
+				}
+			}
+		}
+		for _, data := range blocks {
+			block := data.Block
+			if err := linkSpentOutputsOfBlock(ctx, tx, block.Hash); err != nil {
+				return err
+			}
+			if err := markBlockCompleted(ctx, tx, block.Height, block.Hash); err != nil {
+				return fmt.Errorf("failed to mark block completed: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// insertChunkRows bounds the number of rows in one multi-row INSERT.
+const insertChunkRows = 1000
+
+// insertRows runs query, an INSERT ending in VALUES, for n rows in chunks of
+// insertChunkRows, followed by tail. row is the row template with a ? for
+// each value and args returns the values of row i. The values are inlined as
+// literals: DuckDB runs one statement with many rows much faster than a
+// statement per row, but binding grows quadratically with the number of
+// parameters.
+func insertRows(ctx context.Context, e execer, query, row, tail string, n int, args func(i int) []any) error {
+	parts := strings.Split(row, "?")
+	for start := 0; start < n; start += insertChunkRows {
+		end := start + insertChunkRows
+		if end > n {
+			end = n
+		}
+
+		var b strings.Builder
+		b.WriteString(query)
+		for i := start; i < end; i++ {
+			if i > start {
+				b.WriteString(", ")
+			}
+			values := args(i)
+			if len(values) != len(parts)-1 {
+				return fmt.Errorf("row %d has %d values, expected %d", i, len(values), len(parts)-1)
+			}
+			b.WriteString(parts[0])
+			for j, v := range values {
+				lit, err := sqlLiteral(v)
+				if err != nil {
+					return err
+				}
+				b.WriteString(lit)
+				b.WriteString(parts[j+1])
+			}
+		}
+		b.WriteString(tail)
+
+		if _, err := e.ExecContext(ctx, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlLiteral formats a value for insertRows. Times are written like bound
+// times, in timeFormat.
+func sqlLiteral(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		if !utf8.ValidString(v) {
+			return "", fmt.Errorf("invalid UTF-8 in value %q", v)
+		}
+		return quoteLiteral(v), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprintf("CAST('%v' AS DOUBLE)", v), nil
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		return quoteLiteral(v.UTC().Format(timeFormat)), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// timeFormat is how times are written as text: in UTC and fixed width, so
+// that SQLite, which stores them as text, orders them like DuckDB orders
+// timestamps.
+const timeFormat = "2006-01-02 15:04:05.000000"
+
+// parseTime parses a timestamp SQLite returned as text.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{timeFormat, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// timeScanner scans a timestamp computed by a query, such as a date_trunc
+// or the MIN of a timestamp column. DuckDB returns a time.Time but SQLite
+// only parses columns declared TIMESTAMP and returns computed ones as text.
+// NULL scans as the zero time.
+type timeScanner struct {
+	t *time.Time
+}
+
+func scanTime(t *time.Time) timeScanner {
+	return timeScanner{t}
+}
+
+func (s timeScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case time.Time:
+		*s.t = v
+	case string:
+		t, err := parseTime(v)
+		if err != nil {
+			return err
+		}
+		*s.t = t
+	case []byte:
+		return s.Scan(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a time", src)
+	}
+	return nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertQuery returns the head of an insert of columns into table, up to
+// VALUES, and the clause ending it. Rows whose key is already stored are
+// ignored or, with replace, updated with the new values of the other
+// columns. The id of a stored output or input is kept.
+func insertQuery(table string, key, columns []string, replace bool) (head, tail string) {
+	if !replace {
+		return "INSERT OR IGNORE INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES ", ""
+	}
+	var set []string
+	for _, column := range columns {
+		if column != "id" && !slices.Contains(key, column) {
+			set = append(set, column+" = excluded."+column)
+		}
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES ",
+		" ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(set, ", ")
+}
+
+var (
+	blockColumns = []string{
+		"hash", "height", "timestamp", "size", "weight", "tx_count", "filtered_tx_count",
+		"previous_block_hash", "merkle_root", "nonce", "bits", "difficulty",
+		"coinbase_value", "subsidy", "total_fees", "segwit_tx_count", "witness_size", "coinbase_script", "miner_tag",
+		"work", "chainwork", "processed_at",
+	}
+	transactionColumns = []string{
+		"txid", "block_hash", "block_height", "size", "vsize", "weight", "fee", "fee_rate", "is_coinbase",
+		"input_count", "output_count", "input_value", "output_value", "version", "locktime", "signals_rbf",
+		"tx_category", "timestamp", "processed_at",
+	}
+	outputColumns   = []string{"id", "txid", "vout", "value", "script_pub_key", "script_type", "address", "block_height"}
+	inputColumns    = []string{"id", "txid", "vout", "script_sig", "sequence", "prev_txid", "prev_vout", "txid_spending", "block_height"}
+	opReturnColumns = []string{"txid", "vout", "block_height", "data_hex", "data_size", "timestamp"}
+	watchedColumns  = []string{"address", "txid", "n", "direction", "value", "block_hash", "block_height", "timestamp"}
+)
+
+func insertBlock(ctx context.Context, e execer, block *models.Block, replace bool) error {
+	head, tail := insertQuery("blocks", []string{"hash"}, blockColumns, replace)
+	query := head + `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+		NULLIF(CAST(? AS VARCHAR), ''), NULLIF(CAST(? AS VARCHAR), ''),
+		NULLIF(CAST(? AS VARCHAR), ''), NULLIF(CAST(? AS VARCHAR), ''), ?)` + tail
+
+	_, err := e.ExecContext(ctx, query,
 		block.Hash, block.Height, block.Timestamp, block.Size, block.Weight,
-		block.TxCount, block.PreviousBlockHash, block.MerkleRoot,
-		block.Nonce, block.Bits, block.Difficulty, block.ProcessedAt)
+		block.TxCount, block.FilteredTxCount, block.PreviousBlockHash, block.MerkleRoot,
+		block.Nonce, block.Bits, block.Difficulty,
+		block.CoinbaseValue, block.Subsidy, block.TotalFees, block.SegwitTxCount, block.WitnessSize,
+		block.CoinbaseScript, block.MinerTag, block.Work, block.Chainwork, block.ProcessedAt)
 
 	return err
 }
 
 func (db *DB) InsertTransaction(tx *models.Transaction) error {
 	query := `INSERT OR IGNORE INTO transactions (
-		txid, block_hash, block_height, size, vsize, weight, fee,
-		input_count, output_count, input_value, output_value, timestamp, processed_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		txid, block_hash, block_height, size, vsize, weight, fee, fee_rate, is_coinbase,
+		input_count, output_count, input_value, output_value, version, locktime, signals_rbf,
+		tx_category, timestamp, processed_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := db.conn.Exec(query,
 		tx.Txid, tx.BlockHash, tx.BlockHeight, tx.Size, tx.VSize, tx.Weight,
-		tx.Fee, tx.InputCount, tx.OutputCount, tx.InputValue, tx.OutputValue,
-		tx.Timestamp, tx.ProcessedAt)
+		tx.Fee, tx.FeeRate, tx.IsCoinbase, tx.InputCount, tx.OutputCount, tx.InputValue, tx.OutputValue,
+		tx.Version, tx.LockTime, tx.SignalsRBF, string(tx.Category), tx.Timestamp, tx.ProcessedAt)
 
 	return err
 }
 
-func (db *DB) InsertTransactionsBatch(transactions []*models.Transaction) error {
+func (db *DB) InsertTransactionsBatch(ctx context.Context, transactions []*models.Transaction) error {
 	if len(transactions) == 0 {
 		return nil
 	}
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		return insertTransactions(ctx, tx, transactions, false)
+	})
+}
 
-	tx, err := db.conn.Begin()
+func insertTransactions(ctx context.Context, e execer, transactions []*models.Transaction, replace bool) error {
+	query, tail := insertQuery("transactions", []string{"txid", "block_hash"}, transactionColumns, replace)
+	err := insertRows(ctx, e, query, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tail, len(transactions), func(i int) []any {
+		txn := transactions[i]
+		return []any{
+			txn.Txid, txn.BlockHash, txn.BlockHeight, txn.Size, txn.VSize, txn.Weight,
+			txn.Fee, txn.FeeRate, txn.IsCoinbase, txn.InputCount, txn.OutputCount, txn.InputValue, txn.OutputValue,
+			txn.Version, txn.LockTime, txn.SignalsRBF, string(txn.Category), txn.Timestamp, txn.ProcessedAt,
+		}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to insert transactions: %w", err)
 	}
-	defer tx.Rollback()
+	return nil
+}
 
-	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO transactions (
-		txid, block_hash, block_height, size, vsize, weight, fee,
-		input_count, output_count, input_value, output_value, timestamp, processed_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+func (db *DB) InsertTxOutputsBatch(ctx context.Context, outputs []*models.TxOutput) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		return db.insertTxOutputs(ctx, tx, outputs, false)
+	})
+}
+
+func (db *DB) insertTxOutputs(ctx context.Context, e execer, outputs []*models.TxOutput, replace bool) error {
+	query, tail := insertQuery("tx_outputs", []string{"txid", "vout"}, outputColumns, replace)
+	row := "(" + db.dialect.outputID + ", ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)"
+	err := insertRows(ctx, e, query, row, tail, len(outputs), func(i int) []any {
+		out := outputs[i]
+		return []any{out.Txid, out.Vout, out.Value, out.ScriptPubKey, out.ScriptType, out.Address, out.BlockHeight}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+		return fmt.Errorf("failed to insert outputs: %w", err)
 	}
-	defer stmt.Close()
+	return nil
+}
 
-	for _, txn := range transactions {
-		_, err := stmt.Exec(
-			txn.Txid, txn.BlockHash, txn.BlockHeight, txn.Size, txn.VSize, txn.Weight,
-			txn.Fee, txn.InputCount, txn.OutputCount, txn.InputValue, txn.OutputValue,
-			txn.Timestamp, txn.ProcessedAt)
-		if err != nil {
-			return fmt.Errorf("failed to insert transaction %s: %w", txn.Txid, err)
+func (db *DB) InsertTxInputsBatch(ctx context.Context, inputs []*models.TxInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		return db.insertTxInputs(ctx, tx, inputs, false)
+	})
+}
+
+func (db *DB) insertTxInputs(ctx context.Context, e execer, inputs []*models.TxInput, replace bool) error {
+	query, tail := insertQuery("tx_inputs", []string{"txid_spending", "vout"}, inputColumns, replace)
+	row := "(" + db.dialect.inputID + ", ?, ?, ?, ?, ?, ?, ?, ?)"
+	err := insertRows(ctx, e, query, row, tail, len(inputs), func(i int) []any {
+		in := inputs[i]
+		return []any{in.Txid, in.Vout, in.ScriptSig, in.Sequence, in.PrevTxid, in.PrevVout, in.TxidSpending, in.BlockHeight}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert inputs: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) InsertOpReturnBatch(ctx context.Context, outputs []*models.OpReturnOutput) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		return insertOpReturns(ctx, tx, outputs, false)
+	})
+}
+
+func insertOpReturns(ctx context.Context, e execer, outputs []*models.OpReturnOutput, replace bool) error {
+	query, tail := insertQuery("op_return_outputs", []string{"txid", "vout"}, opReturnColumns, replace)
+	err := insertRows(ctx, e, query, "(?, ?, ?, ?, ?, ?)", tail, len(outputs), func(i int) []any {
+		out := outputs[i]
+		return []any{out.Txid, out.Vout, out.BlockHeight, out.DataHex, out.DataSize, out.Timestamp}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert OP_RETURN outputs: %w", err)
+	}
+	return nil
+}
+
+// GetOpReturnStatsByDay returns the number of OP_RETURN outputs and their
+// payload bytes per day in the given time range.
+func (db *DB) GetOpReturnStatsByDay(from, to time.Time) ([]*models.OpReturnDailyStats, error) {
+	query := `SELECT date_trunc('day', timestamp) AS day, COUNT(*), CAST(SUM(data_size) AS BIGINT)
+	FROM op_return_outputs
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.OpReturnDailyStats
+	for rows.Next() {
+		s := &models.OpReturnDailyStats{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Outputs, &s.Bytes); err != nil {
+			return nil, err
 		}
+		stats = append(stats, s)
 	}
 
-	return tx.Commit()
+	return stats, rows.Err()
 }
 
 func (db *DB) GetProcessedBlocks(fromHeight, toHeight int64) (map[int64]bool, error) {
 	query := `SELECT block_height FROM processing_status WHERE status = 'completed' AND block_height BETWEEN ? AND ?`
-	
+
 	rows, err := db.conn.Query(query, fromHeight, toHeight)
 	if err != nil {
 		return nil, err
@@ -132,28 +816,93 @@ func (db *DB) GetProcessedBlocks(fromHeight, toHeight int64) (map[int64]bool, er
 	return processed, rows.Err()
 }
 
-func (db *DB) MarkBlockProcessing(height int64, hash string) error {
-	query := `INSERT OR REPLACE INTO processing_status (block_height, block_hash, status, started_at) VALUES (?, ?, 'processing', ?)`
-	_, err := db.conn.Exec(query, height, hash, time.Now())
+func (db *DB) GetStatusCounts(fromHeight, toHeight int64) (completed, failed int64, err error) {
+	query := `SELECT
+		COUNT(CASE WHEN status = 'completed' THEN 1 END),
+		COUNT(CASE WHEN status = 'failed' THEN 1 END)
+	FROM processing_status WHERE block_height BETWEEN ? AND ?`
+
+	err = db.conn.QueryRow(query, fromHeight, toHeight).Scan(&completed, &failed)
+	return completed, failed, err
+}
+
+// GetAverageTxCount returns the average transaction count of the most recent
+// stored blocks, or 0 if no blocks are stored yet.
+func (db *DB) GetAverageTxCount(lastBlocks int) (float64, error) {
+	var avg sql.NullFloat64
+	query := `SELECT AVG(tx_count) FROM (SELECT tx_count FROM blocks ORDER BY height DESC LIMIT ?)`
+	if err := db.conn.QueryRow(query, lastBlocks).Scan(&avg); err != nil {
+		return 0, err
+	}
+	return avg.Float64, nil
+}
+
+// MarkBlockProcessing records that an attempt at a block started. A
+// completed block stays completed, so that a retry racing with the attempt
+// that stored it can't undo it; reprocessing it replaces its rows and
+// completes it again.
+func (db *DB) MarkBlockProcessing(ctx context.Context, height int64, hash string) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	query := `INSERT INTO processing_status (block_height, block_hash, status, started_at) VALUES (?, ?, 'processing', ?)
+	ON CONFLICT (block_height) DO UPDATE SET
+		block_hash = excluded.block_hash,
+		status = 'processing',
+		started_at = excluded.started_at,
+		completed_at = NULL,
+		error_message = NULL,
+		rpc_fetch_ms = NULL,
+		parse_ms = NULL,
+		db_insert_ms = NULL,
+		total_ms = NULL
+	WHERE processing_status.status <> 'completed'`
+	_, err := db.conn.ExecContext(ctx, query, height, hash, models.Now())
 	return err
 }
 
-func (db *DB) MarkBlockCompleted(height int64) error {
-	var blockHash string
-	selectQuery := `SELECT block_hash FROM processing_status WHERE block_height = ? LIMIT 1`
-	err := db.conn.QueryRow(selectQuery, height).Scan(&blockHash)
+func (db *DB) MarkBlockCompleted(ctx context.Context, height int64) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return markBlockCompleted(ctx, db.conn, height, "")
+}
+
+// markBlockCompleted moves a block to completed in a single statement, so
+// it can't interleave with MarkBlockFailed for another attempt at the same
+// height, and keeps the started_at recorded by MarkBlockProcessing. A
+// non-empty hash replaces the stored one, which MarkBlockProcessing keeps
+// for completed blocks that are reprocessed.
+func markBlockCompleted(ctx context.Context, e execer, height int64, hash string) error {
+	query := `UPDATE processing_status
+	SET status = 'completed', block_hash = COALESCE(NULLIF(CAST(? AS VARCHAR), ''), block_hash), completed_at = ?, error_message = NULL
+	WHERE block_height = ?`
+	res, err := e.ExecContext(ctx, query, hash, models.Now(), height)
 	if err != nil {
-		return fmt.Errorf("failed to get block hash for height %d: %w", height, err)
+		return err
 	}
-	
-	query := `INSERT OR REPLACE INTO processing_status (block_height, block_hash, status, started_at, completed_at) VALUES (?, ?, 'completed', COALESCE((SELECT started_at FROM processing_status WHERE block_height = ?), ?), ?)`
-	_, err = db.conn.Exec(query, height, blockHash, height, time.Now(), time.Now())
-	return err
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("no processing status for block %d", height)
+	}
+	return nil
 }
 
+// MarkBlockFailed records that processing of a block failed. A block that
+// another attempt already completed stays completed.
 func (db *DB) MarkBlockFailed(height int64, errMsg string) error {
-	query := `UPDATE processing_status SET status = 'failed', completed_at = ?, error_message = ? WHERE block_height = ?`
-	_, err := db.conn.Exec(query, time.Now(), errMsg, height)
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	query := `UPDATE processing_status SET status = 'failed', completed_at = ?, error_message = ? WHERE block_height = ? AND status <> 'completed'`
+	_, err := db.conn.Exec(query, models.Now(), errMsg, height)
+	return err
+}
+
+// MarkBlockInterrupted records that processing of a block was cancelled
+// before it finished. Like failed blocks, it is processed again on the next
+// run.
+func (db *DB) MarkBlockInterrupted(height int64) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	query := `UPDATE processing_status SET status = 'interrupted', completed_at = ?, error_message = NULL WHERE block_height = ? AND status <> 'completed'`
+	_, err := db.conn.Exec(query, models.Now(), height)
 	return err
 }
 
@@ -171,18 +920,91 @@ func (db *DB) GetMaxProcessedHeight() (int64, error) {
 }
 
 func (db *DB) CreateIndexes() error {
-	if _, err := db.conn.Exec(CreateAllIndexes); err != nil {
+	if _, err := db.conn.Exec(db.dialect.indexes); err != nil {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 	return nil
 }
 
+// EnableFastInserts trades durability for insert speed where the driver
+// allows it. SQLite switches to write-ahead logging and only syncs at
+// checkpoints, so a power loss may lose the last transactions but never
+// corrupts the database. DuckDB is already optimized for fast inserts.
 func (db *DB) EnableFastInserts() error {
-	// DuckDB doesn't support SQLite-specific PRAGMA statements
-	// DuckDB is already optimized for fast inserts by default
+	if db.driver != DriverSQLite {
+		return nil
+	}
+	if _, err := db.conn.Exec(`PRAGMA journal_mode = WAL; PRAGMA synchronous = NORMAL`); err != nil {
+		return fmt.Errorf("failed to enable fast inserts: %w", err)
+	}
 	return nil
 }
 
+// GetRBFShareByDay returns the number of non-coinbase transactions and how
+// many of them signal replaceability per day in the given time range.
+// Transactions scraped before RBF signaling was recorded are left out.
+func (db *DB) GetRBFShareByDay(from, to time.Time) ([]*models.RBFDailyStats, error) {
+	query := `SELECT
+		date_trunc('day', timestamp) AS day,
+		COUNT(*),
+		COUNT(*) FILTER (WHERE signals_rbf)
+	FROM transactions
+	WHERE timestamp >= ? AND timestamp < ? AND NOT is_coinbase AND signals_rbf IS NOT NULL
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.RBFDailyStats
+	for rows.Next() {
+		s := &models.RBFDailyStats{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Transactions, &s.Signaling); err != nil {
+			return nil, err
+		}
+		if s.Transactions > 0 {
+			s.Percent = float64(s.Signaling) / float64(s.Transactions) * 100
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// GetMinerRevenueByDay returns the block subsidy and fee income per day in
+// the given time range.
+func (db *DB) GetMinerRevenueByDay(from, to time.Time) ([]*models.MinerRevenue, error) {
+	query := `SELECT
+		date_trunc('day', timestamp) AS day,
+		COUNT(*),
+		CAST(SUM(coinbase_value - total_fees) AS BIGINT),
+		CAST(SUM(total_fees) AS BIGINT)
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revenue []*models.MinerRevenue
+	for rows.Next() {
+		r := &models.MinerRevenue{}
+		if err := rows.Scan(scanTime(&r.Day), &r.Blocks, &r.Subsidy, &r.Fees); err != nil {
+			return nil, err
+		}
+		revenue = append(revenue, r)
+	}
+
+	return revenue, rows.Err()
+}
+
 func (db *DB) InsertPriceData(priceData *models.PriceData) error {
 	query := `INSERT OR REPLACE INTO price_data (
 		timestamp, price, market_cap, volume_24h, source, fetched_at
@@ -195,6 +1017,29 @@ func (db *DB) InsertPriceData(priceData *models.PriceData) error {
 	return err
 }
 
+// GetPriceData returns all price points ordered by timestamp.
+func (db *DB) GetPriceData() ([]*models.PriceData, error) {
+	query := `SELECT timestamp, price, COALESCE(market_cap, 0), COALESCE(volume_24h, 0), source, fetched_at
+	FROM price_data ORDER BY timestamp`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []*models.PriceData
+	for rows.Next() {
+		p := &models.PriceData{}
+		if err := rows.Scan(&p.Timestamp, &p.Price, &p.MarketCap, &p.Volume24h, &p.Source, &p.FetchedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+
+	return prices, rows.Err()
+}
+
 func (db *DB) InsertPriceDataBatch(priceDataSlice []*models.PriceData) error {
 	if len(priceDataSlice) == 0 {
 		return nil
@@ -224,4 +1069,4 @@ func (db *DB) InsertPriceDataBatch(priceDataSlice []*models.PriceData) error {
 	}
 
 	return tx.Commit()
-}
\ No newline at end of file
+}
@@ -0,0 +1,640 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tableCounts returns the number of rows of each table a block writes to,
+// and the number of spent outputs.
+func tableCounts(t *testing.T, db *DB) map[string]int64 {
+	t.Helper()
+	counts := make(map[string]int64)
+	for name, query := range map[string]string{
+		"blocks":               `SELECT COUNT(*) FROM blocks`,
+		"transactions":         `SELECT COUNT(*) FROM transactions`,
+		"tx_inputs":            `SELECT COUNT(*) FROM tx_inputs`,
+		"tx_outputs":           `SELECT COUNT(*) FROM tx_outputs`,
+		"spent outputs":        `SELECT COUNT(*) FROM tx_outputs WHERE spent_txid IS NOT NULL`,
+		"op_return_outputs":    `SELECT COUNT(*) FROM op_return_outputs`,
+		"address_stats_blocks": `SELECT COUNT(*) FROM address_stats_blocks`,
+		"completed":            `SELECT COUNT(*) FROM processing_status WHERE status = 'completed'`,
+	} {
+		var n int64
+		if err := db.conn.QueryRow(query).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		counts[name] = n
+	}
+	return counts
+}
+
+// TestInsertBlocksAtomic fails the insert of two blocks once most of their
+// rows are written. None of them may be left behind, and the blocks must
+// still be processing so that they are retried.
+func TestInsertBlocksAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		ctx := context.Background()
+		db := newTestDB(t, driver)
+		c := newTestChain()
+		b1, outs1 := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+		storeBlocks(t, db, false, b1)
+
+		b2, outs2 := c.block(2, 0,
+			testTx{outs: []testOut{{"miner", 5000000000}}},
+			testTx{ins: outs1[0], outs: []testOut{{"alice", 4999990000}}})
+		b2.OpReturns = []*models.OpReturnOutput{{Txid: b2.Transactions[1].Txid, Vout: 1, BlockHeight: 2, DataHex: "6a00"}}
+		b3, _ := c.block(3, 0,
+			testTx{outs: []testOut{{"miner", 5000000000}}},
+			testTx{ins: outs2[1], outs: []testOut{{"bob", 4999980000}}})
+		for _, data := range []*models.BlockData{b2, b3} {
+			if err := db.MarkBlockProcessing(ctx, data.Block.Height, data.Block.Hash); err != nil {
+				t.Fatal(err)
+			}
+		}
+		before := tableCounts(t, db)
+
+		// The address rollups are updated last, after the other rows
+		if _, err := db.conn.Exec(`ALTER TABLE addresses RENAME TO addresses_moved`); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertBlocksWithTransactions(ctx, []*models.BlockData{b2, b3}); err == nil {
+			t.Fatal("InsertBlocksWithTransactions() succeeded without the addresses table")
+		}
+		after := tableCounts(t, db)
+		for table, n := range before {
+			if after[table] != n {
+				t.Errorf("%s has %d rows after the failed insert, want %d", table, after[table], n)
+			}
+		}
+		summary, err := db.GetStatusSummary(time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Counts["processing"] != 2 {
+			t.Errorf("status counts = %v, want blocks 2 and 3 still processing", summary.Counts)
+		}
+
+		// Once the error is gone, the blocks are stored as if nothing happened
+		if _, err := db.conn.Exec(`ALTER TABLE addresses_moved RENAME TO addresses`); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.InsertBlocksWithTransactions(ctx, []*models.BlockData{b2, b3}); err != nil {
+			t.Fatal(err)
+		}
+		after = tableCounts(t, db)
+		want := map[string]int64{
+			"blocks": 3, "transactions": 5, "tx_inputs": 2, "tx_outputs": 5, "spent outputs": 2,
+			"op_return_outputs": 1, "address_stats_blocks": 3, "completed": 3,
+		}
+		for table, n := range want {
+			if after[table] != n {
+				t.Errorf("%s has %d rows after the retry, want %d", table, after[table], n)
+			}
+		}
+	})
+}
+
+// blockRows returns the block of each stored transaction and the script
+// type of each stored output, which a replace changes.
+func blockRows(t *testing.T, db *DB) []string {
+	t.Helper()
+	rows, err := db.conn.Query(`SELECT t.txid || ' ' || t.block_hash || ' ' || COALESCE(o.script_type, '')
+	FROM transactions t LEFT JOIN tx_outputs o ON o.txid = t.txid
+	ORDER BY t.txid, o.vout`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var stored []string
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
+
+// TestReplaceBlocksAtomic replaces a block by a competing one that shares a
+// transaction with it, and the next block by itself with reclassified
+// outputs, with the query indexes in place. A failed replace must leave the
+// old rows intact, and a successful one store the blocks as if they had
+// never been stored before.
+func TestReplaceBlocksAtomic(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		ctx := context.Background()
+		c := newTestChain()
+		b1, outs1 := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+		b2, outs2 := c.block(2, 0,
+			testTx{outs: []testOut{{"miner", 5000000000}}},
+			testTx{ins: outs1[0], outs: []testOut{{"alice", 4999990000}}})
+		b2.OpReturns = []*models.OpReturnOutput{{Txid: b2.Transactions[1].Txid, Vout: 1, BlockHeight: 2, DataHex: "6a00"}}
+		b3, _ := c.block(3, 0,
+			testTx{outs: []testOut{{"miner", 5000000000}}},
+			testTx{ins: outs2[1], outs: []testOut{{"bob", 4999980000}}})
+
+		// The competing block has its own coinbase and the same spend
+		b2alt, _ := c.block(2, 1, testTx{outs: []testOut{{"other miner", 5000010000}}})
+		shared := *b2.Transactions[1]
+		shared.BlockHash = b2alt.Block.Hash
+		b2alt.Transactions = append(b2alt.Transactions, &shared)
+		b2alt.Inputs = b2.Inputs
+		b2alt.Outputs = append(b2alt.Outputs, outs2[1]...)
+		b2alt.OpReturns = b2.OpReturns
+		b3again := *b3
+		b3again.Outputs = nil
+		for _, out := range b3.Outputs {
+			out := *out
+			out.ScriptType = "witness_v0_keyhash"
+			b3again.Outputs = append(b3again.Outputs, &out)
+		}
+
+		db := newTestDB(t, driver)
+		if err := db.CreateIndexes(); err != nil {
+			t.Fatal(err)
+		}
+		storeBlocks(t, db, false, b1, b2, b3)
+		before, beforeRows := tableCounts(t, db), blockRows(t, db)
+		beforeRollups := addressRollups(t, db)
+
+		// The blocks are marked completed last, after the other rows
+		if _, err := db.conn.Exec(`ALTER TABLE processing_status RENAME TO processing_status_moved`); err != nil {
+			t.Fatal(err)
+		}
+		replacement := []*models.BlockData{b2alt, &b3again}
+		if err := db.ReplaceBlocksWithTransactions(ctx, replacement); err == nil {
+			t.Fatal("ReplaceBlocksWithTransactions() succeeded without the processing_status table")
+		}
+		if _, err := db.conn.Exec(`ALTER TABLE processing_status_moved RENAME TO processing_status`); err != nil {
+			t.Fatal(err)
+		}
+		if after := tableCounts(t, db); !reflect.DeepEqual(after, before) {
+			t.Errorf("row counts after the failed replace = %v, want %v", after, before)
+		}
+		if after := blockRows(t, db); !reflect.DeepEqual(after, beforeRows) {
+			t.Errorf("rows after the failed replace:\n got %v\nwant %v", after, beforeRows)
+		}
+		if after := addressRollups(t, db); !reflect.DeepEqual(after, beforeRollups) {
+			t.Errorf("rollups after the failed replace:\n got %+v\nwant %+v", after, beforeRollups)
+		}
+
+		if err := db.ReplaceBlocksWithTransactions(ctx, replacement); err != nil {
+			t.Fatal(err)
+		}
+		want := newTestDB(t, driver)
+		storeBlocks(t, want, false, b1, b2alt, &b3again)
+		if got := tableCounts(t, db); !reflect.DeepEqual(got, tableCounts(t, want)) {
+			t.Errorf("row counts after the replace = %v, want %v", got, tableCounts(t, want))
+		}
+		if got := blockRows(t, db); !reflect.DeepEqual(got, blockRows(t, want)) {
+			t.Errorf("rows after the replace:\n got %v\nwant %v", got, blockRows(t, want))
+		}
+		if got := addressRollups(t, db); !reflect.DeepEqual(got, addressRollups(t, want)) {
+			t.Errorf("rollups after the replace:\n got %+v\nwant %+v", got, addressRollups(t, want))
+		}
+	})
+}
+
+// TestMarkBlockConcurrent runs attempts at the same block from several
+// goroutines, each marking it processing and then completed, failed or
+// interrupted. Whatever the interleaving, the block ends up completed by
+// one of them.
+func TestMarkBlockConcurrent(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		ctx := context.Background()
+		db := newTestDB(t, driver)
+		hash := blockHash(1, 0)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 30)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := db.MarkBlockProcessing(ctx, 1, hash); err != nil {
+					errs <- err
+					return
+				}
+				switch i % 3 {
+				case 0:
+					errs <- db.MarkBlockCompleted(ctx, 1)
+				case 1:
+					errs <- db.MarkBlockFailed(1, "boom")
+				case 2:
+					errs <- db.MarkBlockInterrupted(1)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var status, storedHash string
+		var errMsg sql.NullString
+		var completedAt time.Time
+		err := db.conn.QueryRow(`SELECT status, block_hash, error_message, completed_at FROM processing_status WHERE block_height = 1`).
+			Scan(&status, &storedHash, &errMsg, scanTime(&completedAt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != "completed" || storedHash != hash || errMsg.Valid || completedAt.IsZero() {
+			t.Errorf("status = %s, hash %s, error %v, completed at %v, want completed", status, storedHash, errMsg, completedAt)
+		}
+
+		// A later retry doesn't undo it either
+		if err := db.MarkBlockProcessing(ctx, 1, hash); err != nil {
+			t.Fatal(err)
+		}
+		if completed, _, err := db.GetStatusCounts(1, 1); err != nil || completed != 1 {
+			t.Errorf("completed blocks after a retry = %d, %v, want 1", completed, err)
+		}
+	})
+}
+
+// TestDuplicateCoinbaseTxids stores the coinbases that BIP30 came too late
+// to forbid, which repeat the txids of earlier coinbases. Both copies of
+// each must be stored, so every block has all its transactions.
+func TestDuplicateCoinbaseTxids(t *testing.T) {
+	duplicates := map[int64]string{
+		91722: "e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468",
+		91880: "e3bf3d07d4b0375638d5f1db5255fe07ba2c4cb067cd81b84ee974b6585fb468",
+		91812: "d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599",
+		91842: "d5d27987d2a3dfc724e359870c6644b40e497bdc0589a033220fe15429d88599",
+	}
+	forEachDriver(t, func(t *testing.T, driver string) {
+		c := newTestChain()
+		var blocks []*models.BlockData
+		for _, height := range []int64{91722, 91812, 91842, 91880} {
+			data, _ := c.block(height, 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+			data.Transactions[0].Txid = duplicates[height]
+			data.Outputs[0].Txid = duplicates[height]
+			blocks = append(blocks, data)
+		}
+
+		db := newTestDB(t, driver)
+		storeBlocks(t, db, false, blocks...)
+
+		for _, txid := range []string{duplicates[91722], duplicates[91812]} {
+			var count int
+			if err := db.conn.QueryRow(`SELECT COUNT(*) FROM transactions WHERE txid = ?`, txid).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != 2 {
+				t.Errorf("%d transactions stored with txid %s, want 2", count, txid)
+			}
+		}
+
+		counts, err := db.GetStoredTxCounts(c.genesis, c.genesis.AddDate(10, 0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range blocks {
+			if got := counts[data.Block.Hash]; got != data.Block.TxCount {
+				t.Errorf("block %d: %d transactions stored, want %d", data.Block.Height, got, data.Block.TxCount)
+			}
+		}
+	})
+}
+
+// TestTimestampsUTC stores blocks whose times are in a local time zone far
+// from UTC. They must read back in UTC and fall in their UTC day, as if
+// they had been scraped on a machine set to UTC.
+func TestTimestampsUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	forEachDriver(t, func(t *testing.T, driver string) {
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		c := newTestChain()
+		var blocks []*models.BlockData
+		// 23:50 on February 29th and 00:10 and 23:50 on March 1st in UTC,
+		// which are all on March 1st or 2nd in UTC+5
+		for i, at := range []time.Time{day.Add(-10 * time.Minute), day.Add(10 * time.Minute), day.Add(24*time.Hour - 10*time.Minute)} {
+			data, _ := c.block(int64(i+1), 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+			data.Block.Timestamp = at.Local()
+			data.Transactions[0].Timestamp = at.Local()
+			blocks = append(blocks, data)
+		}
+		db := newTestDB(t, driver)
+		storeBlocks(t, db, false, blocks...)
+
+		stored, err := db.GetBlocksByTime(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2 || stored[0].Height != 2 || stored[1].Height != 3 {
+			t.Fatalf("got %d blocks on March 1st, want blocks 2 and 3", len(stored))
+		}
+		for _, b := range stored {
+			if b.Timestamp.Location() != time.UTC || !b.Timestamp.Equal(blocks[b.Height-1].Block.Timestamp) {
+				t.Errorf("block %d read back at %v, want %v in UTC", b.Height, b.Timestamp, blocks[b.Height-1].Block.Timestamp)
+			}
+		}
+
+		revenue, err := db.GetMinerRevenueByDay(day.AddDate(0, 0, -1), day.AddDate(0, 0, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var days []string
+		for _, r := range revenue {
+			days = append(days, fmt.Sprintf("%s: %d", r.Day.UTC().Format("2006-01-02"), r.Blocks))
+		}
+		if want := []string{"2024-02-29: 1", "2024-03-01: 2"}; !reflect.DeepEqual(days, want) {
+			t.Errorf("blocks per day = %v, want %v", days, want)
+		}
+	})
+}
+
+// headerOf returns the block of data as a header sync stores it, without
+// anything derived from its transactions.
+func headerOf(data *models.BlockData) *models.Block {
+	return &models.Block{
+		Hash:              data.Block.Hash,
+		Height:            data.Block.Height,
+		Timestamp:         data.Block.Timestamp,
+		TxCount:           data.Block.TxCount,
+		PreviousBlockHash: data.Block.PreviousBlockHash,
+		Subsidy:           data.Block.Subsidy,
+	}
+}
+
+// TestHeadersOnlyBlocks syncs the headers of a range with a fully stored
+// block in it, then fully stores the header-only blocks, one of them
+// replaced by a competing block, with the query indexes in place. The full
+// blocks must replace the header rows as if they had never been there.
+func TestHeadersOnlyBlocks(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		ctx := context.Background()
+		c := newTestChain()
+		b1, outs1 := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+		b2, _ := c.block(2, 0,
+			testTx{outs: []testOut{{"miner", 5000010000}}},
+			testTx{ins: outs1[0], outs: []testOut{{"alice", 4999990000}}})
+		b2.Block.Size = 400
+		b3, _ := c.block(3, 0, testTx{outs: []testOut{{"miner", 5000000000}}})
+		b3alt, _ := c.block(3, 1, testTx{outs: []testOut{{"other miner", 5000000000}}})
+		b3alt.Block.Size = 200
+
+		db := newTestDB(t, driver)
+		if err := db.CreateIndexes(); err != nil {
+			t.Fatal(err)
+		}
+		storeBlocks(t, db, false, b1)
+
+		stored, err := db.InsertBlockHeaders(ctx, []*models.Block{headerOf(b1), headerOf(b2), headerOf(b3)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != 2 {
+			t.Errorf("InsertBlockHeaders() stored %d headers, want 2 without the stored block 1", stored)
+		}
+		headersOnly, err := db.GetHeadersOnlyHeights(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[int64]bool{2: true, 3: true}; !reflect.DeepEqual(headersOnly, want) {
+			t.Errorf("GetHeadersOnlyHeights() = %v, want %v", headersOnly, want)
+		}
+		txCounts, err := db.GetBlockTxCounts(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[int64]int{1: 1, 2: 2, 3: 1}; !reflect.DeepEqual(txCounts, want) {
+			t.Errorf("GetBlockTxCounts() = %v, want %v", txCounts, want)
+		}
+		if counts := tableCounts(t, db); counts["blocks"] != 3 || counts["transactions"] != 1 || counts["completed"] != 1 {
+			t.Errorf("row counts after the header sync = %v, want 3 blocks and block 1 complete", counts)
+		}
+
+		// A second sync leaves them alone
+		if stored, err := db.InsertBlockHeaders(ctx, []*models.Block{headerOf(b2)}); err != nil || stored != 0 {
+			t.Errorf("InsertBlockHeaders() again = %d, %v, want 0", stored, err)
+		}
+
+		storeBlocks(t, db, false, b2, b3alt)
+		if err := db.CreateIndexes(); err != nil {
+			t.Fatal(err)
+		}
+		want := newTestDB(t, driver)
+		storeBlocks(t, want, false, b1, b2, b3alt)
+		if got := tableCounts(t, db); !reflect.DeepEqual(got, tableCounts(t, want)) {
+			t.Errorf("row counts after the full scrape = %v, want %v", got, tableCounts(t, want))
+		}
+		if got := blockRows(t, db); !reflect.DeepEqual(got, blockRows(t, want)) {
+			t.Errorf("rows after the full scrape:\n got %v\nwant %v", got, blockRows(t, want))
+		}
+		for _, data := range []*models.BlockData{b2, b3alt} {
+			hash, err := db.GetBlockHashAtHeight(data.Block.Height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var size int32
+			if err := db.conn.QueryRow(`SELECT size FROM blocks WHERE hash = ?`, hash).Scan(&size); err != nil {
+				t.Fatal(err)
+			}
+			if hash != data.Block.Hash || size != data.Block.Size {
+				t.Errorf("block %d is %s of size %d, want %s of size %d", data.Block.Height, hash, size, data.Block.Hash, data.Block.Size)
+			}
+		}
+		if headersOnly, err := db.GetHeadersOnlyHeights(0, 10); err != nil || len(headersOnly) != 0 {
+			t.Errorf("GetHeadersOnlyHeights() after the full scrape = %v, %v, want none", headersOnly, err)
+		}
+	})
+}
+
+// TestResetDailyMetrics opens a database whose daily_metrics predates the
+// ratio inputs: read-only, it has no cached metrics, and opened for writing
+// the table is recreated.
+func TestResetDailyMetrics(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		store, err := Open(driver, path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := store.(*DB)
+		day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for _, query := range []string{
+			`DROP TABLE daily_metrics`,
+			`CREATE TABLE daily_metrics (
+				day TIMESTAMP PRIMARY KEY, supply BIGINT NOT NULL, realized_cap DOUBLE NOT NULL,
+				unpriced_supply BIGINT NOT NULL, value_spent BIGINT NOT NULL, sopr DOUBLE,
+				unpriced_spent BIGINT NOT NULL, interpolated BOOLEAN NOT NULL, computed_at TIMESTAMP NOT NULL)`,
+		} {
+			if _, err := db.conn.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.conn.Exec(`INSERT INTO daily_metrics VALUES (?, 1, 1, 0, 0, NULL, 0, FALSE, ?)`, day, day); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+
+		for _, readOnly := range []bool{true, false} {
+			store, err := Open(driver, path, readOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics, err := store.GetDailyMetrics(day, day.AddDate(0, 0, 1), false)
+			if err != nil || len(metrics) != 0 {
+				t.Errorf("read-only %v: GetDailyMetrics() = %d metrics, %v, want none", readOnly, len(metrics), err)
+			}
+			if current, err := store.(*DB).dailyMetricsCurrent(); err != nil || current == readOnly {
+				t.Errorf("read-only %v: daily_metrics current = %v, %v", readOnly, current, err)
+			}
+			store.Close()
+		}
+	})
+}
+
+// TestBlockTimings records the timings of two stored blocks, reprocesses
+// one, and opens a database created before the timings existed.
+func TestBlockTimings(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, driver string) {
+		ctx := context.Background()
+		path := filepath.Join(t.TempDir(), "test.db")
+		store, err := Open(driver, path, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := store.(*DB)
+		c := newTestChain()
+		var blocks []*models.BlockData
+		for height := int64(1); height <= 3; height++ {
+			data, _ := c.block(height, 0, testTx{outs: []testOut{{"A", 100}}})
+			storeBlocks(t, db, false, data)
+			blocks = append(blocks, data)
+		}
+		if err := db.SetBlockTimings(ctx, []*models.BlockTiming{
+			{Height: 1, RPCFetchMs: 5, ParseMs: 1, DBInsertMs: 2, TotalMs: 10},
+			{Height: 2, RPCFetchMs: 50, ParseMs: 3, DBInsertMs: 20, TotalMs: 90},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		slowest := func() string {
+			blocks, err := db.GetSlowestBlocks(5, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, b := range blocks {
+				got = append(got, fmt.Sprintf("%d:%d/%d/%d/%d", b.Height, b.RPCFetchMs, b.ParseMs, b.DBInsertMs, b.TotalMs))
+			}
+			return strings.Join(got, " ")
+		}
+		if got, want := slowest(), "2:50/3/20/90 1:5/1/2/10"; got != want {
+			t.Errorf("slowest blocks %s, want %s", got, want)
+		}
+
+		// A completed block keeps its timings until it is stored again, but
+		// loses them while it is processed again
+		if err := db.MarkBlockProcessing(ctx, 2, blockHash(2, 0)); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := slowest(), "2:50/3/20/90 1:5/1/2/10"; got != want {
+			t.Errorf("after reprocessing a completed block: slowest blocks %s, want %s", got, want)
+		}
+		if _, err := db.conn.Exec(`UPDATE processing_status SET status = 'failed' WHERE block_height = 2`); err != nil {
+			t.Fatal(err)
+		}
+		storeBlocks(t, db, true, blocks[1])
+		if got, want := slowest(), "1:5/1/2/10"; got != want {
+			t.Errorf("after storing a failed block again: slowest blocks %s, want %s", got, want)
+		}
+
+		for _, query := range []string{
+			`DROP TABLE processing_status`,
+			`CREATE TABLE processing_status (
+				block_height BIGINT PRIMARY KEY, block_hash VARCHAR NOT NULL, status VARCHAR NOT NULL,
+				started_at TIMESTAMP NOT NULL, completed_at TIMESTAMP, error_message VARCHAR)`,
+		} {
+			if _, err := db.conn.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := db.conn.Exec(`INSERT INTO processing_status VALUES (1, ?, 'completed', ?, ?, NULL)`,
+			blockHash(1, 0), c.genesis, c.genesis); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+		for _, readOnly := range []bool{true, false} {
+			store, err := Open(driver, path, readOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blocks, err := store.GetSlowestBlocks(5, time.Time{})
+			if err != nil || len(blocks) != 0 {
+				t.Errorf("read-only %v: GetSlowestBlocks() = %d blocks, %v, want none", readOnly, len(blocks), err)
+			}
+			if !readOnly {
+				err = store.SetBlockTimings(ctx, []*models.BlockTiming{{Height: 1, TotalMs: 7}})
+				if blocks, _ := store.GetSlowestBlocks(5, time.Time{}); err != nil || len(blocks) != 1 || blocks[0].TotalMs != 7 {
+					t.Errorf("after migrating: SetBlockTimings() = %v, slowest blocks %v", err, blocks)
+				}
+			}
+			store.Close()
+		}
+	})
+}
+
+// TestMemoryExport stores blocks in an in-memory database, exports it and
+// imports the export into a database file, which must have the same rows.
+func TestMemoryExport(t *testing.T) {
+	if _, err := Open(DriverSQLite, MemoryPath, false); err == nil {
+		t.Error("opened an in-memory SQLite database")
+	}
+	if _, err := Open(DriverDuckDB, MemoryPath, true); err == nil {
+		t.Error("opened a read-only in-memory database")
+	}
+
+	c := newTestChain()
+	b1, coinbase := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000}}})
+	b2, _ := c.block(2, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: coinbase[0], outs: []testOut{{"A", 4900}}})
+	db := newTestDB(t, DriverDuckDB)
+	storeBlocks(t, db, false, b1, b2)
+	if inMemory, err := db.GetMetadata(MetadataInMemory); err != nil || inMemory != "true" {
+		t.Errorf("GetMetadata(%s) = %q, %v, want true", MetadataInMemory, inMemory, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "export")
+	if err := db.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Export(dir); err == nil {
+		t.Error("exported into a non-empty directory")
+	}
+
+	conn, err := openConn(filepath.Join(t.TempDir(), "imported.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(`IMPORT DATABASE ` + quoteLiteral(dir)); err != nil {
+		t.Fatal(err)
+	}
+	imported := &DB{conn: conn, driver: DriverDuckDB, dialect: duckdbDialect}
+	if got, want := tableCounts(t, imported), tableCounts(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported rows %v, want %v", got, want)
+	}
+	if inMemory, err := imported.GetMetadata(MetadataInMemory); err != nil || inMemory != "true" {
+		t.Errorf("imported GetMetadata(%s) = %q, %v, want true", MetadataInMemory, inMemory, err)
+	}
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DeleteBlockData deletes everything stored for the block at height,
+// whatever its hash, and its processing status, so the next run processes
+// it again.
+func (db *DB) DeleteBlockData(height int64) error {
+	ctx := context.Background()
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		if err := deleteBlockData(ctx, tx, []int64{height}); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM processing_status WHERE block_height = ?`, height); err != nil {
+			return fmt.Errorf("failed to delete processing status of block %d: %w", height, err)
+		}
+		return nil
+	})
+}
+
+// staleTxids selects the transactions stored at a height that aren't part of
+// the block with the given hash, by height rather than hash so that rows of a
+// block replaced by a reorg are found too. A transaction both blocks include
+// is left out, since its inputs and outputs are keyed by txid alone and
+// belong to the kept block now. An empty hash selects all of them.
+const staleTxids = `SELECT txid FROM transactions WHERE block_height = ? AND block_hash <> ?
+	AND txid NOT IN (SELECT txid FROM transactions WHERE block_hash = ?)`
+
+// deleteBlockData deletes the rows of the blocks stored at heights.
+func deleteBlockData(ctx context.Context, tx *sql.Tx, heights []int64) error {
+	reverted, err := unlinkBlockData(ctx, tx, heights)
+	if err != nil {
+		return err
+	}
+	for _, hash := range reverted {
+		if err := dropUnseenAddresses(ctx, tx, hash); err != nil {
+			return err
+		}
+	}
+	for _, height := range heights {
+		if err := deleteStaleBlockData(ctx, tx, height, ""); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM address_stats_blocks WHERE block_height = ?`, height); err != nil {
+			return fmt.Errorf("failed to delete data of block %d: %w", height, err)
+		}
+		// The day is missing a block again
+		if _, err := tx.ExecContext(ctx, `DELETE FROM days_complete WHERE ? BETWEEN from_height AND to_height`, height); err != nil {
+			return fmt.Errorf("failed to delete data of block %d: %w", height, err)
+		}
+	}
+	return nil
+}
+
+// unlinkBlockData undoes what the blocks stored at heights changed in other
+// rows and returns the hashes of the blocks whose address rollups were
+// reverted. The rollups of all of them are reverted first, since that reads
+// the rows, including the outputs of earlier blocks in heights that their
+// inputs spend. The outputs spent by their inputs are marked unspent again;
+// outputs of the blocks spent by later blocks are linked again when the
+// blocks are reinserted.
+func unlinkBlockData(ctx context.Context, tx *sql.Tx, heights []int64) ([]string, error) {
+	var reverted []string
+	for _, height := range heights {
+		hash, err := revertAddressStats(ctx, tx, height)
+		if err != nil {
+			return nil, err
+		}
+		if hash != "" {
+			reverted = append(reverted, hash)
+		}
+	}
+	for _, height := range heights {
+		query := `UPDATE tx_outputs SET spent_txid = NULL, spent_vout = NULL
+		WHERE spent_txid IN (SELECT txid FROM transactions WHERE block_height = ?)`
+		if _, err := tx.ExecContext(ctx, query, height); err != nil {
+			return nil, fmt.Errorf("failed to unlink spends of block %d: %w", height, err)
+		}
+	}
+	return reverted, nil
+}
+
+// deleteStaleBlockData deletes the rows stored at height that don't belong
+// to the block with hash keep, after unlinkBlockData. With an empty keep,
+// everything stored at height is deleted.
+func deleteStaleBlockData(ctx context.Context, tx *sql.Tx, height int64, keep string) error {
+	for _, query := range []string{
+		`DELETE FROM tx_inputs WHERE txid_spending IN (` + staleTxids + `)`,
+		`DELETE FROM tx_outputs WHERE txid IN (` + staleTxids + `)`,
+		`DELETE FROM op_return_outputs WHERE txid IN (` + staleTxids + `)`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, height, keep, keep); err != nil {
+			return fmt.Errorf("failed to delete data of block %d: %w", height, err)
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM transactions WHERE block_height = ? AND block_hash <> ?`,
+		`DELETE FROM watched_activity WHERE block_height = ? AND block_hash <> ?`,
+		`DELETE FROM block_anomalies WHERE block_height = ? AND block_hash <> ?`,
+		`DELETE FROM blocks WHERE height = ? AND hash <> ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, height, keep); err != nil {
+			return fmt.Errorf("failed to delete data of block %d: %w", height, err)
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM block_metrics WHERE block_height = ?`,
+		`DELETE FROM chain_breaks WHERE height = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, height); err != nil {
+			return fmt.Errorf("failed to delete data of block %d: %w", height, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package db
+
+// dialect holds the statements each driver writes differently. The other
+// queries are shared: they stick to SQL both drivers understand, and the
+// DuckDB functions they call are registered on SQLite connections by
+// registerSQLiteFunctions.
+type dialect struct {
+	// tables creates the tables, in order.
+	tables []string
+	// txIOKeys creates the natural keys of inputs and outputs.
+	txIOKeys string
+	// indexes creates the secondary indexes.
+	indexes string
+	// queryIndexes lists the names of the secondary indexes.
+	queryIndexes string
+	// tableExists counts the tables named by its parameter.
+	tableExists string
+	// columnExists counts the columns of the table named by its first
+	// parameter named by the second.
+	columnExists string
+	// blockPricesView creates or replaces the block_prices view.
+	blockPricesView string
+	// blockPrices is the query GetCoinFlows prices blocks with.
+	blockPrices string
+	// outputID and inputID assign the id of an inserted output or input.
+	outputID, inputID string
+	// attachOptions ends the ATTACH of the database synced from.
+	attachOptions string
+	// sourceTables lists the tables of the database synced from.
+	sourceTables string
+}
+
+var duckdbDialect = &dialect{
+	tables: []string{
+		CreateBlocksTable,
+		CreateTransactionsTable,
+		CreateTxInputsTable,
+		CreateTxOutputsTable,
+		CreateProcessingStatusTable,
+		CreatePriceDataTable,
+		CreateOpReturnOutputsTable,
+		CreateWatchedActivityTable,
+		CreateAddressesTable,
+		CreateAddressStatsBlocksTable,
+		CreateAddressFirstSeenTable,
+		CreateAddressLabelsTable,
+		CreateBlockMetricsTable,
+		CreateDailyMetricsTable,
+		CreateBackfillProgressTable,
+		CreateRawBlocksTable,
+		CreateRunsTable,
+		CreateRunProgressTable,
+		CreateChainBreaksTable,
+		CreateDaysCompleteTable,
+		CreateBlockStatsTable,
+		CreateNodeSnapshotsTable,
+		CreateFeeEstimatesTable,
+		CreateNextBlockEstimatesTable,
+		CreateBlockAnomaliesTable,
+		CreateMetadataTable,
+	},
+	txIOKeys:        CreateTxIOKeys,
+	indexes:         CreateAllIndexes,
+	queryIndexes:    `SELECT index_name FROM duckdb_indexes() WHERE NOT is_unique`,
+	tableExists:     `SELECT COUNT(*) FROM duckdb_tables() WHERE table_name = ?`,
+	columnExists:    `SELECT COUNT(*) FROM duckdb_columns() WHERE table_name = ? AND column_name = ?`,
+	blockPricesView: CreateBlockPricesView,
+	blockPrices:     blockPrices,
+	outputID:        `nextval('tx_outputs_id_seq')`,
+	inputID:         `nextval('tx_inputs_id_seq')`,
+	attachOptions:   ` (READ_ONLY)`,
+	sourceTables:    `SELECT table_name FROM duckdb_tables() WHERE database_name = 'sync_source'`,
+}
+
+var sqliteDialect = &dialect{
+	tables: []string{
+		CreateBlocksTable,
+		CreateTransactionsTable,
+		CreateTxInputsTableSQLite,
+		CreateTxOutputsTableSQLite,
+		CreateProcessingStatusTable,
+		CreatePriceDataTable,
+		CreateOpReturnOutputsTable,
+		CreateWatchedActivityTable,
+		CreateAddressesTable,
+		CreateAddressStatsBlocksTable,
+		CreateAddressFirstSeenTable,
+		CreateAddressLabelsTable,
+		CreateBlockMetricsTable,
+		CreateDailyMetricsTable,
+		CreateBackfillProgressTable,
+		CreateRawBlocksTable,
+		CreateRunsTableSQLite,
+		CreateRunProgressTable,
+		CreateChainBreaksTable,
+		CreateDaysCompleteTable,
+		CreateBlockStatsTable,
+		CreateNodeSnapshotsTable,
+		CreateFeeEstimatesTable,
+		CreateNextBlockEstimatesTable,
+		CreateBlockAnomaliesTable,
+		CreateMetadataTable,
+	},
+	txIOKeys: CreateTxIOKeysSQLite,
+	indexes:  CreateAllIndexesSQLite,
+	queryIndexes: `SELECT name FROM sqlite_master
+	WHERE type = 'index' AND sql IS NOT NULL AND sql NOT LIKE 'CREATE UNIQUE INDEX%'`,
+	tableExists:     `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	columnExists:    `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+	blockPricesView: CreateBlockPricesViewSQLite,
+	blockPrices:     sqliteBlockPrices,
+	outputID:        `NULL`,
+	inputID:         `NULL`,
+	sourceTables:    `SELECT name FROM sync_source.sqlite_master WHERE type = 'table'`,
+}
+
+// postgresDialect is the dialect of the statements PostgresDB inherits from
+// DB. It has no price view nor inputs and outputs, which PostgresDB doesn't
+// store.
+var postgresDialect = &dialect{
+	tables: []string{
+		CreateBlocksTablePostgres,
+		CreateTransactionsTablePostgres,
+		CreateProcessingStatusTablePostgres,
+		CreateRunsTablePostgres,
+		CreateRunProgressTablePostgres,
+		CreateChainBreaksTablePostgres,
+		CreateMetadataTablePostgres,
+		CreateAllIndexesPostgres,
+	},
+	indexes: CreateAllIndexesPostgres,
+	queryIndexes: `SELECT indexname FROM pg_indexes
+	WHERE schemaname = current_schema() AND indexdef NOT LIKE 'CREATE UNIQUE INDEX%'`,
+	tableExists: `SELECT COUNT(*) FROM information_schema.tables
+	WHERE table_schema = current_schema() AND table_name = ?`,
+	columnExists: `SELECT COUNT(*) FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetEpochStats summarizes the stored blocks with a timestamp in [from, to)
+// per halving epoch.
+func (db *DB) GetEpochStats(from, to time.Time) ([]*models.EpochStats, error) {
+	// height - height % interval is the first height of the epoch in both
+	// drivers, which divide integers differently
+	query := `SELECT
+		height - height % ? AS epoch_start,
+		MIN(height),
+		MAX(height),
+		MIN(timestamp),
+		MAX(timestamp),
+		COUNT(*),
+		AVG(total_fees),
+		CAST(SUM(subsidy) AS BIGINT),
+		CAST(SUM(coinbase_value - total_fees) AS BIGINT)
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY epoch_start
+	ORDER BY epoch_start`
+
+	rows, err := db.conn.Query(query, models.HalvingInterval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.EpochStats
+	for rows.Next() {
+		s := &models.EpochStats{}
+		var start int64
+		if err := rows.Scan(&start, &s.FirstHeight, &s.LastHeight, scanTime(&s.FirstBlock), scanTime(&s.LastBlock),
+			&s.Blocks, &s.AvgFees, &s.Subsidy, &s.Issued); err != nil {
+			return nil, err
+		}
+		s.Epoch = models.HalvingEpoch(start)
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
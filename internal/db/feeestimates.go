@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// InsertFeeEstimates records the estimates of one poll.
+func (db *DB) InsertFeeEstimates(ctx context.Context, estimates []*models.FeeEstimate) error {
+	query := `INSERT OR REPLACE INTO fee_estimates (estimated_at, target, height, fee_rate, blocks) VALUES `
+	err := insertRows(ctx, db.conn, query, "(?, ?, ?, ?, ?)", "", len(estimates), func(i int) []any {
+		e := estimates[i]
+		return []any{e.EstimatedAt, e.Target, e.Height, e.FeeRate, e.Blocks}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert fee estimates: %w", err)
+	}
+	return nil
+}
+
+// selectFeeEstimateAccuracy matches every estimate with the median fee rate
+// of the non-coinbase transactions of the block above the tip it was taken
+// at, the first block mined after it.
+const selectFeeEstimateAccuracy = `
+WITH estimates AS (
+	SELECT * FROM fee_estimates
+	WHERE estimated_at >= ? AND estimated_at < ?
+), realized AS (
+	SELECT b.height, median(t.fee_rate) AS median_fee_rate
+	FROM blocks b
+	JOIN transactions t ON t.block_hash = b.hash
+	WHERE NOT t.is_coinbase AND b.height IN (SELECT height + 1 FROM estimates)
+	GROUP BY b.height
+)
+SELECT
+	date_trunc('day', e.estimated_at) AS day,
+	e.target,
+	COUNT(*),
+	AVG(e.fee_rate),
+	AVG(r.median_fee_rate),
+	AVG(ABS(e.fee_rate - r.median_fee_rate)),
+	100.0 * SUM(CASE WHEN e.fee_rate >= r.median_fee_rate THEN 1 ELSE 0 END) / COUNT(*)
+FROM estimates e
+JOIN realized r ON r.height = e.height + 1
+GROUP BY day, e.target
+ORDER BY day, e.target`
+
+// GetFeeEstimateAccuracy compares the fee estimates taken in [from, to)
+// with the blocks mined after them, per day and confirmation target.
+func (db *DB) GetFeeEstimateAccuracy(from, to time.Time) ([]*models.FeeEstimateAccuracy, error) {
+	rows, err := db.conn.Query(selectFeeEstimateAccuracy, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.FeeEstimateAccuracy
+	for rows.Next() {
+		s := &models.FeeEstimateAccuracy{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Target, &s.Estimates, &s.AvgEstimate, &s.AvgMedianFeeRate,
+			&s.MeanAbsoluteError, &s.AboveMedian); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestFeeEstimateAccuracy(t *testing.T) {
+	forEachDriver(t, testFeeEstimateAccuracy)
+}
+
+// testFeeEstimateAccuracy estimates at the tips 1, 2 and 3 with block 3
+// missing, so the estimates at 2 are left out.
+func testFeeEstimateAccuracy(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	for _, height := range []int64{1, 2, 4} {
+		data, _ := c.block(height, 0,
+			testTx{outs: []testOut{{"miner", 5000}}},
+			testTx{outs: []testOut{{"A", 100}}},
+			testTx{outs: []testOut{{"B", 100}}},
+			testTx{outs: []testOut{{"C", 100}}})
+		// Fee rates 1, 2 and 3 times the height, with a median of 2
+		for i, tx := range data.Transactions {
+			tx.IsCoinbase = i == 0
+			tx.FeeRate = float64(i) * float64(height)
+		}
+		storeBlocks(t, db, false, data)
+	}
+
+	var estimates []*models.FeeEstimate
+	for _, height := range []int64{1, 2, 3} {
+		estimates = append(estimates,
+			&models.FeeEstimate{EstimatedAt: c.genesis.Add(10 * time.Duration(height) * time.Minute), Target: 1, Height: height, FeeRate: 6, Blocks: 1},
+			&models.FeeEstimate{EstimatedAt: c.genesis.Add(10 * time.Duration(height) * time.Minute), Target: 6, Height: height, FeeRate: 1, Blocks: 6})
+	}
+	if err := db.InsertFeeEstimates(context.Background(), estimates); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetFeeEstimateAccuracy(c.genesis, c.genesis.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The medians of the next blocks are 4 and 8
+	want := []*models.FeeEstimateAccuracy{
+		{Day: c.genesis, Target: 1, Estimates: 2, AvgEstimate: 6, AvgMedianFeeRate: 6, MeanAbsoluteError: 2, AboveMedian: 50},
+		{Day: c.genesis, Target: 6, Estimates: 2, AvgEstimate: 1, AvgMedianFeeRate: 6, MeanAbsoluteError: 5, AboveMedian: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("accuracy:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFeeRateBands are the fee rate bounds, in sat/vB, of the bands of
+// GetFeeHeatmap.
+var DefaultFeeRateBands = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// FeeBandUnknown is the band of the transactions without a fee rate.
+const FeeBandUnknown = "unknown"
+
+// selectFeeHeatmap counts the non-coinbase transactions of each block by
+// the band expression of its argument. Blocks without any have a single
+// row with no transactions.
+const selectFeeHeatmap = `
+SELECT
+	b.height,
+	b.timestamp,
+	%s AS band,
+	COUNT(t.txid),
+	CAST(COALESCE(SUM(t.vsize), 0) AS BIGINT)
+FROM blocks b
+LEFT JOIN transactions t ON t.block_hash = b.hash AND NOT t.is_coinbase
+WHERE b.timestamp >= ? AND b.timestamp < ?
+GROUP BY b.height, b.timestamp, band
+ORDER BY b.height, band`
+
+// feeRateBand returns the SQL expression of the band index of a
+// transaction t: -1 without a fee rate, else the number of bounds at or
+// below its rate.
+func feeRateBand(bounds []float64) string {
+	var b strings.Builder
+	b.WriteString("CASE WHEN t.fee_rate IS NULL OR t.fee_rate <= 0 THEN -1")
+	for i, bound := range bounds {
+		fmt.Fprintf(&b, " WHEN t.fee_rate < %s THEN %d", formatRate(bound), i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(bounds))
+	return b.String()
+}
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
+
+// feeRateBands returns the bands of bounds, from below the first bound to
+// at or above the last, followed by the unknown band.
+func feeRateBands(bounds []float64) []*models.FeeHeatmapCell {
+	bands := make([]*models.FeeHeatmapCell, 0, len(bounds)+2)
+	for i := 0; i <= len(bounds); i++ {
+		band := &models.FeeHeatmapCell{}
+		switch {
+		case i == 0:
+			band.Band = "<" + formatRate(bounds[0])
+		case i == len(bounds):
+			band.Band = formatRate(bounds[i-1]) + "+"
+		default:
+			band.Band = formatRate(bounds[i-1]) + "-" + formatRate(bounds[i])
+		}
+		if i > 0 {
+			band.MinFeeRate = &bounds[i-1]
+		}
+		if i < len(bounds) {
+			band.MaxFeeRate = &bounds[i]
+		}
+		bands = append(bands, band)
+	}
+	return append(bands, &models.FeeHeatmapCell{Band: FeeBandUnknown})
+}
+
+// GetFeeHeatmap returns, for every block in [from, to), the number and
+// virtual size of its non-coinbase transactions in each fee rate band
+// delimited by bounds, which must be positive and ascending. Every band of
+// every block is listed, the empty ones too, in the order of feeRateBands.
+// Transactions with a zero or unknown fee rate, such as those scraped before
+// their fees were backfilled, are in the unknown band.
+func (db *DB) GetFeeHeatmap(from, to time.Time, bounds []float64) ([]*models.FeeHeatmapCell, error) {
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("no fee rate bands")
+	}
+	for i, bound := range bounds {
+		if bound <= 0 || (i > 0 && bound <= bounds[i-1]) {
+			return nil, fmt.Errorf("invalid fee rate bands %v: must be positive and ascending", bounds)
+		}
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectFeeHeatmap, feeRateBand(bounds)), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cells, block []*models.FeeHeatmapCell
+	for rows.Next() {
+		var height, txs, vsize int64
+		var timestamp time.Time
+		var band int
+		if err := rows.Scan(&height, &timestamp, &band, &txs, &vsize); err != nil {
+			return nil, err
+		}
+		if block == nil || block[0].Height != height {
+			block = feeRateBands(bounds)
+			for _, cell := range block {
+				cell.Height, cell.Timestamp = height, timestamp
+			}
+			cells = append(cells, block...)
+		}
+		if band < 0 {
+			band = len(block) - 1
+		}
+		block[band].Transactions = txs
+		block[band].VSize = vsize
+	}
+
+	return cells, rows.Err()
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestFeeHeatmap(t *testing.T) {
+	forEachDriver(t, testFeeHeatmap)
+}
+
+// testFeeHeatmap stores a block with transactions at and around the band
+// bounds, one without a fee rate, and a block with only its coinbase.
+func testFeeHeatmap(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	coinbase := testTx{outs: []testOut{{"miner", 5000000000}}}
+	first, outs := c.block(0, 0, coinbase)
+	storeBlocks(t, db, false, first)
+
+	var txs []testTx
+	rates := []float64{0.5, 1, 1.99, 2, 4.5, 0}
+	for range rates {
+		txs = append(txs, testTx{ins: outs[0], outs: []testOut{{"A", 1000}}})
+	}
+	data, _ := c.block(1, 0, append([]testTx{coinbase}, txs...)...)
+	for i, rate := range rates {
+		tx := data.Transactions[i+1]
+		tx.FeeRate = rate
+		tx.VSize = int32(100 * (i + 1))
+	}
+	storeBlocks(t, db, false, data)
+
+	cells, err := db.GetFeeHeatmap(c.genesis, c.genesis.AddDate(0, 0, 1), []float64{1, 2, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, cell := range cells {
+		bounds := ""
+		if cell.MinFeeRate != nil {
+			bounds += fmt.Sprintf(">=%g", *cell.MinFeeRate)
+		}
+		if cell.MaxFeeRate != nil {
+			bounds += fmt.Sprintf("<%g", *cell.MaxFeeRate)
+		}
+		got = append(got, fmt.Sprintf("%d %s %s %d %d", cell.Height, cell.Band, bounds, cell.Transactions, cell.VSize))
+	}
+	want := []string{
+		"0 <1 <1 0 0", "0 1-2 >=1<2 0 0", "0 2-5 >=2<5 0 0", "0 5+ >=5 0 0", "0 unknown  0 0",
+		"1 <1 <1 1 100", "1 1-2 >=1<2 2 500", "1 2-5 >=2<5 2 900", "1 5+ >=5 0 0", "1 unknown  1 600",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	for _, bounds := range [][]float64{nil, {2, 1}, {0, 1}} {
+		if _, err := db.GetFeeHeatmap(c.genesis, c.genesis.AddDate(0, 0, 1), bounds); err == nil {
+			t.Errorf("GetFeeHeatmap() accepted bands %v", bounds)
+		}
+	}
+}
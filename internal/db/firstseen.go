@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// insertAddressFirstSeen records the addresses the outputs of blocks pay
+// to, at the lowest of the blocks for each, unless they already have a row.
+// A row written by a later block stored first keeps that block until
+// FinalizeAddressFirstSeen.
+func insertAddressFirstSeen(ctx context.Context, e execer, blocks []*models.BlockData) error {
+	type seen struct {
+		height int64
+		time   time.Time
+	}
+	first := make(map[string]seen)
+	var addresses []string
+	for _, data := range blocks {
+		for _, out := range data.Outputs {
+			if out.Address == "" {
+				continue
+			}
+			s, ok := first[out.Address]
+			if !ok {
+				addresses = append(addresses, out.Address)
+			}
+			if !ok || data.Block.Height < s.height {
+				first[out.Address] = seen{data.Block.Height, data.Block.Timestamp}
+			}
+		}
+	}
+
+	query := `INSERT OR IGNORE INTO address_first_seen (address, first_seen_height, first_seen_time) VALUES `
+	err := insertRows(ctx, e, query, "(?, ?, ?)", "", len(addresses), func(i int) []any {
+		s := first[addresses[i]]
+		return []any{addresses[i], s.height, s.time}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record first seen addresses: %w", err)
+	}
+	return nil
+}
+
+// finalizeFirstSeen lowers the first seen block of the addresses paid in
+// the block range given by its parameters, see FinalizeAddressFirstSeen.
+const finalizeFirstSeen = `INSERT INTO address_first_seen (address, first_seen_height, first_seen_time)
+SELECT address, height, timestamp FROM (
+	SELECT o.address, b.height, b.timestamp,
+		ROW_NUMBER() OVER (PARTITION BY o.address ORDER BY b.height) AS n
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	JOIN blocks b ON b.hash = t.block_hash
+	WHERE b.height BETWEEN ? AND ? AND o.address IS NOT NULL
+) first
+WHERE n = 1
+ON CONFLICT (address) DO UPDATE SET
+	first_seen_height = excluded.first_seen_height,
+	first_seen_time = excluded.first_seen_time
+WHERE excluded.first_seen_height < address_first_seen.first_seen_height`
+
+// FinalizeAddressFirstSeen lowers the first seen block of every address paid
+// by an output stored in [fromHeight, toHeight] to the lowest such block,
+// correcting the rows of blocks stored out of order, and adds the addresses
+// stored before first seen blocks were recorded. It returns the number of
+// rows written.
+func (db *DB) FinalizeAddressFirstSeen(fromHeight, toHeight int64) (int64, error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	res, err := db.conn.Exec(finalizeFirstSeen, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to finalize first seen addresses: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetNewAddressesPerDay returns the number of addresses first seen on each
+// day of [from, to) that has any, as far as the stored blocks go.
+func (db *DB) GetNewAddressesPerDay(from, to time.Time) ([]*models.DailyAddressCount, error) {
+	return db.dailyAddressCounts(`SELECT date_trunc('day', first_seen_time) AS day, COUNT(*)
+	FROM address_first_seen
+	WHERE first_seen_time >= ? AND first_seen_time < ?
+	GROUP BY day
+	ORDER BY day`, from, to)
+}
+
+// GetActiveAddressesPerDay returns the number of distinct addresses paid by
+// an output or spending one on each day of [from, to) that has any. Spends
+// count once the output they spend is stored.
+func (db *DB) GetActiveAddressesPerDay(from, to time.Time) ([]*models.DailyAddressCount, error) {
+	return db.dailyAddressCounts(`SELECT day, COUNT(DISTINCT address) FROM (
+		SELECT date_trunc('day', b.timestamp) AS day, o.address
+		FROM tx_outputs o
+		JOIN transactions t ON t.txid = o.txid
+		JOIN blocks b ON b.hash = t.block_hash
+		WHERE b.timestamp >= ? AND b.timestamp < ? AND o.address IS NOT NULL
+		UNION ALL
+		SELECT date_trunc('day', b.timestamp) AS day, po.address
+		FROM tx_inputs i
+		JOIN tx_outputs po ON po.txid = i.prev_txid AND po.vout = i.prev_vout
+		JOIN transactions t ON t.txid = i.txid_spending
+		JOIN blocks b ON b.hash = t.block_hash
+		WHERE b.timestamp >= ? AND b.timestamp < ? AND po.address IS NOT NULL
+	) active
+	GROUP BY day
+	ORDER BY day`, from, to, from, to)
+}
+
+func (db *DB) dailyAddressCounts(query string, args ...any) ([]*models.DailyAddressCount, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*models.DailyAddressCount
+	for rows.Next() {
+		c := &models.DailyAddressCount{}
+		if err := rows.Scan(scanTime(&c.Day), &c.Addresses); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// MaxBlockWeight is the consensus limit on the weight of a block, in weight
+// units. Before segwit blocks were limited to 1MB, which is the same limit
+// as the weight of a block without witness data is 4 times its size.
+const MaxBlockWeight = 4000000
+
+// fullThreshold is the share of MaxBlockWeight above which a block counts
+// as full.
+const fullThreshold = 0.99
+
+// selectBlockFullness groups blocks by the period or block expression and
+// grouping of its first two arguments. Header-only blocks have no weight
+// and are left out.
+const selectBlockFullness = `
+SELECT
+	%[1]s AS period,
+	MIN(height),
+	MAX(height),
+	COUNT(*),
+	AVG(weight) / %[3]d.0 * 100,
+	COUNT(*) FILTER (WHERE tx_count > 1 AND weight > %[4]f * %[3]d),
+	COUNT(*) FILTER (WHERE tx_count > 1 AND weight <= %[4]f * %[3]d),
+	COUNT(*) FILTER (WHERE tx_count <= 1)
+FROM blocks
+WHERE timestamp >= ? AND timestamp < ? AND weight > 0
+GROUP BY %[2]s
+ORDER BY period, MIN(height)`
+
+// GetBlockFullness returns how full the blocks in [from, to) were, per
+// block, day or week.
+func (db *DB) GetBlockFullness(from, to time.Time, granularity string) ([]*models.BlockFullness, error) {
+	var period, group string
+	switch granularity {
+	case GranularityBlock:
+		period, group = "timestamp", "height, timestamp"
+	case GranularityDay, GranularityWeek:
+		period, group = fmt.Sprintf("date_trunc('%s', timestamp)", granularity), "1"
+	default:
+		return nil, fmt.Errorf("invalid granularity %q: must be block, day or week", granularity)
+	}
+
+	query := fmt.Sprintf(selectBlockFullness, period, group, MaxBlockWeight, fullThreshold)
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.BlockFullness
+	for rows.Next() {
+		s := &models.BlockFullness{}
+		if err := rows.Scan(scanTime(&s.Period), &s.FromHeight, &s.ToHeight, &s.Blocks, &s.Fullness,
+			&s.FullBlocks, &s.PartialBlocks, &s.EmptyBlocks); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
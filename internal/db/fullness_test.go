@@ -0,0 +1,72 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestBlockFullness(t *testing.T) {
+	forEachDriver(t, testBlockFullness)
+}
+
+// testBlockFullness stores a full, a partial and an empty block on day 0,
+// and a header-only and a full block on day 1.
+func testBlockFullness(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	coinbase := testTx{outs: []testOut{{"miner", 5000}}}
+	payment := testTx{outs: []testOut{{"A", 100}}}
+	for _, b := range []struct {
+		height int64
+		weight int32
+		txs    []testTx
+	}{
+		{0, 3990000, []testTx{coinbase, payment}},
+		{1, 2000000, []testTx{coinbase, payment}},
+		{2, 1000, []testTx{coinbase}},
+		{144, 0, []testTx{coinbase, payment}},
+		{145, 4000000, []testTx{coinbase, payment}},
+	} {
+		data, _ := c.block(b.height, 0, b.txs...)
+		data.Block.Weight = b.weight
+		storeBlocks(t, db, false, data)
+	}
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	for _, test := range []struct {
+		granularity string
+		want        []string
+	}{
+		{GranularityBlock, []string{
+			"01-01 00:00 0-0 1 99.75 1/0/0",
+			"01-01 00:10 1-1 1 50.00 0/1/0",
+			"01-01 00:20 2-2 1 0.03 0/0/1",
+			"01-02 00:10 145-145 1 100.00 1/0/0",
+		}},
+		{GranularityDay, []string{
+			"01-01 00:00 0-2 3 49.93 1/1/1",
+			"01-02 00:00 145-145 1 100.00 1/0/0",
+		}},
+		{GranularityWeek, []string{
+			"01-01 00:00 0-145 4 62.44 2/1/1",
+		}},
+	} {
+		stats, err := db.GetBlockFullness(from, to, test.granularity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range stats {
+			got = append(got, fmt.Sprintf("%s %d-%d %d %.2f %d/%d/%d", s.Period.Format("01-02 15:04"), s.FromHeight, s.ToHeight,
+				s.Blocks, s.Fullness, s.FullBlocks, s.PartialBlocks, s.EmptyBlocks))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s:\n got %q\nwant %q", test.granularity, got, test.want)
+		}
+	}
+
+	if _, err := db.GetBlockFullness(from, to, GranularityHour); err == nil {
+		t.Error("GetBlockFullness() accepted hour granularity")
+	}
+}
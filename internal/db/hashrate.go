@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// hashrateWindow is the number of blocks hashrate is averaged over, one
+// difficulty period.
+const hashrateWindow = 2016
+
+// selectHashrateWindows picks, for each period, its last block that has the
+// block hashrateWindow blocks below it, along with that block. Blocks
+// without chainwork are left out.
+const selectHashrateWindows = `
+WITH windows AS (
+	SELECT
+		date_trunc('%[1]s', b.timestamp) AS period,
+		b.height, b.timestamp, b.chainwork,
+		w.timestamp AS start_time, w.chainwork AS start_chainwork,
+		ROW_NUMBER() OVER (PARTITION BY date_trunc('%[1]s', b.timestamp) ORDER BY b.height DESC) AS n
+	FROM blocks b
+	JOIN blocks w ON w.height = b.height - %[2]d
+	WHERE b.timestamp >= ? AND b.timestamp < ?
+		AND b.chainwork IS NOT NULL AND w.chainwork IS NOT NULL
+)
+SELECT period, height, timestamp, chainwork, start_time, start_chainwork
+FROM windows
+WHERE n = 1
+ORDER BY period`
+
+// GetHashrateEstimates returns the hashrate per day or week for the blocks
+// in [from, to), estimated at the last block of each period from the
+// chainwork added over the trailing 2016 blocks and the time between their
+// timestamps.
+func (db *DB) GetHashrateEstimates(from, to time.Time, granularity string) ([]*models.HashrateEstimate, error) {
+	if granularity != GranularityDay && granularity != GranularityWeek {
+		return nil, fmt.Errorf("invalid granularity %q: must be day or week", granularity)
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectHashrateWindows, granularity, hashrateWindow), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var estimates []*models.HashrateEstimate
+	for rows.Next() {
+		e := &models.HashrateEstimate{}
+		var end, start time.Time
+		var startChainwork string
+		if err := rows.Scan(scanTime(&e.Period), &e.Height, scanTime(&end), &e.Chainwork, scanTime(&start), &startChainwork); err != nil {
+			return nil, err
+		}
+		work, ok := new(big.Int).SetString(e.Chainwork, 10)
+		startWork := new(big.Int)
+		if ok {
+			_, ok = startWork.SetString(startChainwork, 10)
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid chainwork stored for block %d or %d", e.Height, e.Height-hashrateWindow)
+		}
+		if seconds := end.Sub(start).Seconds(); seconds > 0 {
+			hashes, _ := new(big.Float).SetInt(work.Sub(work, startWork)).Float64()
+			e.Hashrate = hashes / seconds
+		}
+		estimates = append(estimates, e)
+	}
+
+	return estimates, rows.Err()
+}
+
+// GetBlocksWork returns the stored blocks in [fromHeight, toHeight] by
+// height with only their hash, previous block hash, bits, work and chainwork
+// set.
+func (db *DB) GetBlocksWork(fromHeight, toHeight int64) ([]*models.Block, error) {
+	rows, err := db.conn.Query(`SELECT hash, height, COALESCE(previous_block_hash, ''), bits,
+		COALESCE(work, ''), COALESCE(chainwork, '')
+	FROM blocks
+	WHERE height BETWEEN ? AND ?
+	ORDER BY height`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.Block
+	for rows.Next() {
+		b := &models.Block{}
+		if err := rows.Scan(&b.Hash, &b.Height, &b.PreviousBlockHash, &b.Bits, &b.Work, &b.Chainwork); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+func (db *DB) UpdateBlockWork(hash, work, chainwork string) error {
+	_, err := db.conn.Exec(`UPDATE blocks SET work = ?, chainwork = NULLIF(CAST(? AS VARCHAR), '') WHERE hash = ?`,
+		work, chainwork, hash)
+	return err
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+)
+
+// InsertBlockHeaders stores blocks fetched with headers only and records
+// their heights as 'headers_only', so that a later full scrape knows their
+// transactions are still missing. Heights that already have a status, from
+// a full scrape or an earlier header sync, are left as they are. It returns
+// the number of blocks stored.
+func (db *DB) InsertBlockHeaders(ctx context.Context, blocks []*models.Block) (int, error) {
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+	fromHeight, toHeight := blocks[0].Height, blocks[0].Height
+	for _, block := range blocks {
+		fromHeight = min(fromHeight, block.Height)
+		toHeight = max(toHeight, block.Height)
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	var stored int
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		known, err := statusHeights(ctx, tx, fromHeight, toHeight)
+		if err != nil {
+			return err
+		}
+		now := db.now()
+		for _, block := range blocks {
+			if known[block.Height] {
+				continue
+			}
+			block.ProcessedAt = now
+			if err := insertBlock(ctx, tx, block, false); err != nil {
+				return fmt.Errorf("failed to insert header of block %d: %w", block.Height, err)
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO processing_status (block_height, block_hash, status, started_at, completed_at)
+			VALUES (?, ?, 'headers_only', ?, ?)`, block.Height, block.Hash, block.ProcessedAt, block.ProcessedAt)
+			if err != nil {
+				return fmt.Errorf("failed to mark block %d headers only: %w", block.Height, err)
+			}
+			known[block.Height] = true
+			stored++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return stored, nil
+}
+
+func statusHeights(ctx context.Context, tx *sql.Tx, fromHeight, toHeight int64) (map[int64]bool, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT block_height FROM processing_status WHERE block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heights := make(map[int64]bool)
+	for rows.Next() {
+		var height int64
+		if err := rows.Scan(&height); err != nil {
+			return nil, err
+		}
+		heights[height] = true
+	}
+	return heights, rows.Err()
+}
+
+// GetHeadersOnlyHeights returns the heights in [fromHeight, toHeight] whose
+// blocks are stored with headers only.
+func (db *DB) GetHeadersOnlyHeights(fromHeight, toHeight int64) (map[int64]bool, error) {
+	rows, err := db.conn.Query(`SELECT block_height FROM processing_status
+	WHERE status = 'headers_only' AND block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	heights := make(map[int64]bool)
+	for rows.Next() {
+		var height int64
+		if err := rows.Scan(&height); err != nil {
+			return nil, err
+		}
+		heights[height] = true
+	}
+	return heights, rows.Err()
+}
+
+// GetBlockTxCounts returns the transaction count of the blocks stored in
+// [fromHeight, toHeight], whether fully or with headers only, by height.
+func (db *DB) GetBlockTxCounts(fromHeight, toHeight int64) (map[int64]int, error) {
+	rows, err := db.conn.Query(`SELECT height, MAX(tx_count) FROM blocks
+	WHERE height BETWEEN ? AND ?
+	GROUP BY height`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var height int64
+		var count int
+		if err := rows.Scan(&height, &count); err != nil {
+			return nil, err
+		}
+		counts[height] = count
+	}
+	return counts, rows.Err()
+}
+
+// hasStoredBlocks reports whether a block is stored at any of the heights
+// of blocks. Blocks are only stored once completed and completed heights
+// aren't processed again without replacing, so these are the header rows of
+// blocks synced with headers only, whose status MarkBlockProcessing already
+// moved on.
+func (db *DB) hasStoredBlocks(ctx context.Context, blocks []*models.BlockData) (bool, error) {
+	if len(blocks) == 0 {
+		return false, nil
+	}
+	args := make([]any, len(blocks))
+	for i, data := range blocks {
+		args[i] = data.Block.Height
+	}
+	query := `SELECT COUNT(*) > 0 FROM blocks WHERE height IN (?` + strings.Repeat(", ?", len(blocks)-1) + `)`
+	var found bool
+	if err := db.conn.QueryRowContext(ctx, query, args...).Scan(&found); err != nil {
+		return false, fmt.Errorf("failed to check for stored headers: %w", err)
+	}
+	return found, nil
+}
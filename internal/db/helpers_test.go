@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+// testDrivers are the drivers the database tests run against.
+var testDrivers = []string{DriverDuckDB, DriverSQLite}
+
+// forEachDriver runs test as a subtest for every driver.
+func forEachDriver(t *testing.T, test func(t *testing.T, driver string)) {
+	for _, driver := range testDrivers {
+		t.Run(driver, func(t *testing.T) { test(t, driver) })
+	}
+}
+
+// newTestDB opens a fresh database of driver, in memory for DuckDB and in a
+// temporary directory for SQLite.
+func newTestDB(t testing.TB, driver string) *DB {
+	t.Helper()
+	path := MemoryPath
+	if driver == DriverSQLite {
+		path = filepath.Join(t.TempDir(), "test.db")
+	}
+	store, err := Open(driver, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := store.(*DB)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testOut is an output of a testTx.
+type testOut struct {
+	address string
+	value   int64
+}
+
+// testTx is a transaction of a synthetic block. A transaction without
+// inputs is the block's coinbase.
+type testTx struct {
+	ins  []*models.TxOutput
+	outs []testOut
+}
+
+// testChain builds synthetic blocks whose transactions spend each other's
+// outputs. Txids are unique across the chain, so blocks built for the same
+// height with different variants are competing blocks of a reorg. The
+// activity of the addresses in watch is recorded as the parser does.
+type testChain struct {
+	txCount int
+	genesis time.Time
+	watch   map[string]bool
+}
+
+func newTestChain() *testChain {
+	return &testChain{genesis: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// block builds the block at height, one block per 10 minutes. It returns
+// the block and the outputs of each transaction, in order.
+func (c *testChain) block(height int64, variant int, txs ...testTx) (*models.BlockData, [][]*models.TxOutput) {
+	timestamp := c.genesis.Add(time.Duration(height) * 10 * time.Minute)
+	block := &models.Block{
+		Hash:              blockHash(height, variant),
+		Height:            height,
+		Timestamp:         timestamp,
+		TxCount:           len(txs),
+		PreviousBlockHash: blockHash(height-1, 0),
+		Subsidy:           models.SubsidyForHeight(height),
+	}
+	data := &models.BlockData{Block: block}
+
+	outputs := make([][]*models.TxOutput, len(txs))
+	for i, spec := range txs {
+		c.txCount++
+		tx := &models.Transaction{
+			Txid:        fmt.Sprintf("%064x", c.txCount),
+			BlockHash:   block.Hash,
+			BlockHeight: height,
+			IsCoinbase:  len(spec.ins) == 0,
+			InputCount:  len(spec.ins),
+			OutputCount: len(spec.outs),
+			Timestamp:   timestamp,
+		}
+		for vin, prev := range spec.ins {
+			tx.InputValue += prev.Value
+			if c.watch[prev.Address] {
+				data.Watched = append(data.Watched, c.watched(block, tx.Txid, uint32(vin), models.DirectionOut, prev.Address, prev.Value))
+			}
+			data.Inputs = append(data.Inputs, &models.TxInput{
+				Txid:         tx.Txid,
+				Vout:         uint32(vin),
+				PrevTxid:     prev.Txid,
+				PrevVout:     prev.Vout,
+				TxidSpending: tx.Txid,
+				BlockHeight:  height,
+			})
+		}
+		for vout, spec := range spec.outs {
+			tx.OutputValue += spec.value
+			if c.watch[spec.address] {
+				data.Watched = append(data.Watched, c.watched(block, tx.Txid, uint32(vout), models.DirectionIn, spec.address, spec.value))
+			}
+			out := &models.TxOutput{
+				Txid:        tx.Txid,
+				Vout:        uint32(vout),
+				Value:       spec.value,
+				ScriptType:  "p2wpkh",
+				Address:     spec.address,
+				BlockHeight: height,
+			}
+			data.Outputs = append(data.Outputs, out)
+			outputs[i] = append(outputs[i], out)
+		}
+		if !tx.IsCoinbase {
+			tx.Fee = tx.InputValue - tx.OutputValue
+			block.TotalFees += tx.Fee
+		} else {
+			block.CoinbaseValue = tx.OutputValue
+		}
+		data.Transactions = append(data.Transactions, tx)
+	}
+	return data, outputs
+}
+
+func (c *testChain) watched(block *models.Block, txid string, n uint32, direction models.Direction, address string, value int64) *models.WatchedActivity {
+	return &models.WatchedActivity{
+		Address: address, Txid: txid, N: n, Direction: direction, Value: value,
+		BlockHash: block.Hash, BlockHeight: block.Height, Timestamp: block.Timestamp,
+	}
+}
+
+func blockHash(height int64, variant int) string {
+	return fmt.Sprintf("%056x%08x", height, variant)
+}
+
+// storeBlocks stores blocks one call each, the way the worker pool does.
+func storeBlocks(t testing.TB, db *DB, replace bool, blocks ...*models.BlockData) {
+	t.Helper()
+	ctx := context.Background()
+	for _, data := range blocks {
+		if err := db.MarkBlockProcessing(ctx, data.Block.Height, data.Block.Hash); err != nil {
+			t.Fatal(err)
+		}
+		store := db.InsertBlocksWithTransactions
+		if replace {
+			store = db.ReplaceBlocksWithTransactions
+		}
+		if err := store(ctx, []*models.BlockData{data}); err != nil {
+			t.Fatalf("failed to store block %d: %v", data.Block.Height, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// RowWriter receives the rows of ExportSince.
+type RowWriter interface {
+	WriteBlock(block *models.Block) error
+	WriteTransaction(tx *models.Transaction) error
+	WritePrice(price *models.PriceData) error
+}
+
+// ExportSince writes to w the blocks and transactions stored after since
+// and the price points fetched after it, and returns the latest of those
+// times, or since when there are none. Each table is read in the order of
+// that time and then of its key, so the same rows are always written in
+// the same order. The tables are read in one transaction, and blocks are
+// timestamped in the transaction storing them, so the rows committed later
+// are newer than the watermark.
+func (db *DB) ExportSince(since time.Time, w RowWriter) (time.Time, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return since, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	watermark := since
+	seen := func(t time.Time) {
+		if t.After(watermark) {
+			watermark = t
+		}
+	}
+	err = exportRows(tx, selectBlock+` WHERE processed_at > ? ORDER BY processed_at, height, hash`, since,
+		func(rows *sql.Rows) error {
+			b, err := scanStoredBlock(rows)
+			if err != nil {
+				return err
+			}
+			seen(b.ProcessedAt)
+			return w.WriteBlock(b)
+		})
+	if err != nil {
+		return since, fmt.Errorf("failed to export blocks: %w", err)
+	}
+	err = exportRows(tx, selectTransaction+` WHERE processed_at > ? ORDER BY processed_at, block_height, block_hash, txid`, since,
+		func(rows *sql.Rows) error {
+			t, err := scanStoredTransaction(rows)
+			if err != nil {
+				return err
+			}
+			seen(t.ProcessedAt)
+			return w.WriteTransaction(t)
+		})
+	if err != nil {
+		return since, fmt.Errorf("failed to export transactions: %w", err)
+	}
+	err = exportRows(tx, `SELECT timestamp, price, COALESCE(market_cap, 0), COALESCE(volume_24h, 0), source, fetched_at
+		FROM price_data WHERE fetched_at > ? ORDER BY fetched_at, timestamp`, since,
+		func(rows *sql.Rows) error {
+			p := &models.PriceData{}
+			if err := rows.Scan(scanTime(&p.Timestamp), &p.Price, &p.MarketCap, &p.Volume24h, &p.Source, scanTime(&p.FetchedAt)); err != nil {
+				return err
+			}
+			seen(p.FetchedAt)
+			return w.WritePrice(p)
+		})
+	if err != nil {
+		return since, fmt.Errorf("failed to export price data: %w", err)
+	}
+	return watermark, nil
+}
+
+func exportRows(tx *sql.Tx, query string, since time.Time, row func(rows *sql.Rows) error) error {
+	rows, err := tx.Query(query, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := row(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// exportedRows collects the rows of ExportSince.
+type exportedRows struct {
+	Blocks       []*models.Block
+	Transactions []*models.Transaction
+	Prices       []*models.PriceData
+}
+
+func (r *exportedRows) WriteBlock(b *models.Block) error {
+	r.Blocks = append(r.Blocks, b)
+	return nil
+}
+
+func (r *exportedRows) WriteTransaction(tx *models.Transaction) error {
+	r.Transactions = append(r.Transactions, tx)
+	return nil
+}
+
+func (r *exportedRows) WritePrice(p *models.PriceData) error {
+	r.Prices = append(r.Prices, p)
+	return nil
+}
+
+func TestExportSince(t *testing.T) {
+	forEachDriver(t, testExportSince)
+}
+
+// testExportSince stores two blocks a minute apart, the later one first,
+// and price points fetched at both times, and exports what is newer than
+// successive watermarks. The blocks are parsed in the opposite order, and
+// it's the time they are stored at that counts.
+func testExportSince(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	first := c.genesis.Add(time.Hour + 123456*time.Microsecond)
+	second := first.Add(time.Minute)
+	b1, _ := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{outs: []testOut{{"A", 100}}})
+	b2, _ := c.block(2, 0, testTx{outs: []testOut{{"miner", 5000}}})
+	b1.Block.ProcessedAt, b2.Block.ProcessedAt = c.genesis, second.Add(time.Hour)
+	for data, storedAt := range map[*models.BlockData]time.Time{b2: first, b1: second} {
+		db.clock = func() time.Time { return storedAt }
+		storeBlocks(t, db, false, data)
+	}
+	err := db.InsertPriceDataBatch([]*models.PriceData{
+		{Timestamp: c.genesis.Add(time.Hour), Price: 42000, Source: "test", FetchedAt: second},
+		{Timestamp: c.genesis, Price: 41000, Source: "test", FetchedAt: first},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var all exportedRows
+	watermark, err := db.ExportSince(c.genesis, &all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !watermark.Equal(second) {
+		t.Errorf("watermark = %v, want %v", watermark, second)
+	}
+	heights := func(rows exportedRows) []int64 {
+		var heights []int64
+		for _, b := range rows.Blocks {
+			heights = append(heights, b.Height)
+		}
+		for _, tx := range rows.Transactions {
+			heights = append(heights, tx.BlockHeight)
+		}
+		return heights
+	}
+	if got := heights(all); !slices.Equal(got, []int64{2, 1, 2, 1, 1}) {
+		t.Errorf("exported block and transaction heights %v, want blocks 2, 1 then the transactions of 2 and 1", got)
+	}
+	if len(all.Prices) != 2 || all.Prices[0].Price != 41000 || !all.Prices[1].FetchedAt.Equal(second) {
+		t.Errorf("exported prices %+v, want both in fetch order", all.Prices)
+	}
+	if !all.Blocks[0].ProcessedAt.Equal(first) || !all.Transactions[0].Timestamp.Equal(b2.Block.Timestamp) {
+		t.Errorf("exported block %+v and transaction %+v, want their stored times", all.Blocks[0], all.Transactions[0])
+	}
+
+	var again exportedRows
+	if _, err := db.ExportSince(c.genesis, &again); err != nil {
+		t.Fatal(err)
+	}
+	for i := range all.Transactions {
+		if *again.Transactions[i] != *all.Transactions[i] {
+			t.Errorf("second export transaction %d = %+v, want %+v", i, again.Transactions[i], all.Transactions[i])
+		}
+	}
+
+	var newer exportedRows
+	if watermark, err = db.ExportSince(first, &newer); err != nil {
+		t.Fatal(err)
+	}
+	if got := heights(newer); !watermark.Equal(second) || !slices.Equal(got, []int64{1, 1, 1}) || len(newer.Prices) != 1 {
+		t.Errorf("ExportSince(first) = heights %v, %d prices, watermark %v, want block 1 and one price up to %v", got, len(newer.Prices), watermark, second)
+	}
+
+	var none exportedRows
+	if watermark, err = db.ExportSince(second, &none); err != nil {
+		t.Fatal(err)
+	}
+	if !watermark.Equal(second) || len(none.Blocks)+len(none.Transactions)+len(none.Prices) > 0 {
+		t.Errorf("ExportSince(watermark) = %+v, watermark %v, want nothing and the same watermark", none, watermark)
+	}
+}
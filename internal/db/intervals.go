@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// Granularities accepted by GetBlockIntervalStats (day and week),
+// GetMempoolFullness (hour and day), GetBlockFullness (block, day and
+// week), which reports each block on its own with GranularityBlock,
+// GetPriceOHLC (hour, day, week and month) and GetOutputValueDistribution
+// (all, block, day and week), which reports the whole range as one period
+// with GranularityAll.
+const (
+	GranularityAll   = "all"
+	GranularityBlock = "block"
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// selectBlockIntervals groups blocks by period. Intervals are only taken
+// between consecutive heights so gaps in the scraped range don't show up as
+// long intervals, and the window runs over all blocks so the first block of
+// the range still gets its interval.
+const selectBlockIntervals = `
+WITH intervals AS (
+	SELECT
+		height, timestamp, difficulty,
+		CASE WHEN LAG(height) OVER w = height - 1
+			THEN date_diff('second', LAG(timestamp) OVER w, timestamp)
+		END AS interval
+	FROM blocks
+	WINDOW w AS (ORDER BY height)
+)
+SELECT
+	date_trunc('%s', timestamp) AS period,
+	COUNT(*),
+	AVG(GREATEST(interval, 0)),
+	MEDIAN(interval),
+	COUNT(*) FILTER (WHERE interval < 0),
+	AVG(difficulty)
+FROM intervals
+WHERE timestamp >= ? AND timestamp < ?
+GROUP BY period
+ORDER BY period`
+
+// GetBlockIntervalStats returns block counts, intervals, difficulty and an
+// estimated hashrate per day or week for the blocks in [from, to).
+func (db *DB) GetBlockIntervalStats(from, to time.Time, granularity string) ([]*models.BlockIntervalStats, error) {
+	if granularity != GranularityDay && granularity != GranularityWeek {
+		return nil, fmt.Errorf("invalid granularity %q: must be day or week", granularity)
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectBlockIntervals, granularity), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.BlockIntervalStats
+	for rows.Next() {
+		s := &models.BlockIntervalStats{}
+		var avg, median sql.NullFloat64
+		if err := rows.Scan(scanTime(&s.Period), &s.Blocks, &avg, &median, &s.NegativeIntervals, &s.Difficulty); err != nil {
+			return nil, err
+		}
+		s.AvgInterval = avg.Float64
+		s.MedianInterval = median.Float64
+		if s.AvgInterval > 0 {
+			// A block at difficulty 1 takes 2^32 hashes on average
+			s.Hashrate = s.Difficulty * (1 << 32) / s.AvgInterval
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
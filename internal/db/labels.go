@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+var labelColumns = []string{"address", "label", "category", "updated_at"}
+
+// UpsertAddressLabels stores labels, replacing the label and category of
+// the addresses already labeled. Of the labels of one address, the last
+// one is kept.
+func (db *DB) UpsertAddressLabels(labels []*models.AddressLabel) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	// An upsert can't update the same row twice in one statement
+	last := make(map[string]int, len(labels))
+	for i, l := range labels {
+		last[l.Address] = i
+	}
+	unique := make([]*models.AddressLabel, 0, len(last))
+	for i, l := range labels {
+		if last[l.Address] == i {
+			unique = append(unique, l)
+		}
+	}
+
+	updatedAt := models.Now()
+	ctx := context.Background()
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		query, tail := insertQuery("address_labels", []string{"address"}, labelColumns, true)
+		err := insertRows(ctx, tx, query, "(?, ?, ?, ?)", tail, len(unique), func(i int) []any {
+			l := unique[i]
+			return []any{l.Address, l.Label, l.Category, updatedAt}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store address labels: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetFlowsByLabel sums per day the value paid to the addresses of each
+// label and spent from them, from the stored outputs. Spends are dated by
+// the transaction spending them, so they need the spent links, and moves
+// between addresses of the same label count both ways, leaving its net
+// flow unchanged.
+func (db *DB) GetFlowsByLabel(from, to time.Time) ([]*models.LabelFlow, error) {
+	rows, err := db.conn.Query(`SELECT day, label, category,
+		CAST(SUM(inflow) AS BIGINT) AS inflow, CAST(SUM(outflow) AS BIGINT) AS outflow
+	FROM (
+		SELECT date_trunc('day', t.timestamp) AS day, l.label, l.category, o.value AS inflow, 0 AS outflow
+		FROM tx_outputs o
+		JOIN address_labels l ON l.address = o.address
+		JOIN transactions t ON t.txid = o.txid AND t.block_height = o.block_height
+		WHERE t.timestamp >= ? AND t.timestamp < ?
+		UNION ALL
+		SELECT date_trunc('day', t.timestamp) AS day, l.label, l.category, 0 AS inflow, o.value AS outflow
+		FROM tx_outputs o
+		JOIN address_labels l ON l.address = o.address
+		JOIN transactions t ON t.txid = o.spent_txid
+		WHERE t.timestamp >= ? AND t.timestamp < ?
+	) flows
+	GROUP BY day, label, category
+	ORDER BY day, label, category`, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flows []*models.LabelFlow
+	for rows.Next() {
+		f := &models.LabelFlow{}
+		if err := rows.Scan(scanTime(&f.Day), &f.Label, &f.Category, &f.Inflow, &f.Outflow); err != nil {
+			return nil, err
+		}
+		f.Net = f.Inflow - f.Outflow
+		flows = append(flows, f)
+	}
+	return flows, rows.Err()
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestAddressLabels(t *testing.T) {
+	forEachDriver(t, testAddressLabels)
+}
+
+// testAddressLabels labels the addresses of an exchange and a pool, moves
+// coins into, within and out of the exchange over two days and checks the
+// flows of each label.
+func testAddressLabels(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	if err := db.UpsertAddressLabels([]*models.AddressLabel{
+		{Address: "A", Label: "Exchange hot wallet", Category: models.LabelExchange},
+		{Address: "B", Label: "Exchange", Category: models.LabelExchange},
+		{Address: "P", Label: "Pool", Category: models.LabelMiner},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Imported again, with the last label of A in the file kept
+	if err := db.UpsertAddressLabels([]*models.AddressLabel{
+		{Address: "A", Label: "Exchange hot wallet", Category: models.LabelExchange},
+		{Address: "A", Label: "Exchange", Category: models.LabelExchange},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b1, coinbase := c.block(1, 0, testTx{outs: []testOut{{"P", 5000}}})
+	b2, outs := c.block(2, 0,
+		testTx{outs: []testOut{{"P", 5000}}},
+		testTx{ins: coinbase[0], outs: []testOut{{"A", 4000}, {"X", 900}}},
+	)
+	// The exchange moves the deposit to its cold wallet and pays it out
+	b144, moved := c.block(144, 0,
+		testTx{outs: []testOut{{"miner", 5000}}},
+		testTx{ins: outs[1][:1], outs: []testOut{{"B", 3900}}},
+	)
+	b145, _ := c.block(145, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: moved[1], outs: []testOut{{"Y", 3800}}})
+	storeBlocks(t, db, false, b1, b2, b144, b145)
+
+	flows, err := db.GetFlowsByLabel(c.genesis, c.genesis.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range flows {
+		got = append(got, fmt.Sprintf("%s %s/%s %d-%d=%d", f.Day.Format("01-02"), f.Label, f.Category, f.Inflow, f.Outflow, f.Net))
+	}
+	want := []string{
+		"01-01 Exchange/exchange 4000-0=4000",
+		"01-01 Pool/miner 10000-5000=5000",
+		"01-02 Exchange/exchange 3900-7900=-4000",
+	}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("flows:\n got %q\nwant %q", got, want)
+	}
+
+	top, err := db.GetTopAddresses(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, a := range top {
+		got = append(got, a.Address+":"+a.Label)
+	}
+	if want := "miner: P:Pool Y:"; strings.Join(got, " ") != want {
+		t.Errorf("top addresses %q, want %q", strings.Join(got, " "), want)
+	}
+}
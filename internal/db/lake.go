@@ -0,0 +1,403 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LakeStatusFile is the status database of a lake, in its directory.
+const LakeStatusFile = "status.db"
+
+// lakeBucketBlocks is the number of heights in a height_bucket partition.
+const lakeBucketBlocks = 10000
+
+// lakeAlias is the name the status database of a lake is attached as by
+// NewReadOnlyLakeDB.
+const lakeAlias = "lake_status"
+
+// lakeTable is a table whose rows a lake keeps in Parquet files rather than
+// in its status database, with the column holding the height of their block.
+type lakeTable struct {
+	name   string
+	height string
+}
+
+var lakeTables = []lakeTable{
+	{"blocks", "height"},
+	{"transactions", "block_height"},
+	{"tx_outputs", "block_height"},
+	{"tx_inputs", "block_height"},
+	{"op_return_outputs", "block_height"},
+	{"watched_activity", "block_height"},
+}
+
+// LakeDB stores the rows of the lakeTables as Parquet files in a directory
+// instead of in a single database file, one file per table and height
+// bucket for each stored batch, e.g.
+// blocks/height_bucket=80/part-<batch>.parquet for heights 800000 to
+// 809999. Everything else, including processing_status, lives in the
+// status database LakeStatusFile next to them, which the embedded *DB is.
+//
+// A batch is staged in an in-memory database and copied out with DuckDB's
+// COPY, to temporary files renamed once all are written. Its blocks are
+// then recorded in lake_blocks, in the transaction marking them completed.
+// Readers only see the rows of the batch lake_blocks records for each
+// height, so files of an interrupted batch or of a block replaced since are
+// never read; the latter are deleted once no height refers to their batch.
+//
+// Only the rows of the blocks are written: spent links, the address rollups
+// and first seen heights are derived when read, see NewReadOnlyLakeDB, and
+// the other data computed from stored blocks, such as coin days destroyed,
+// isn't available.
+type LakeDB struct {
+	*DB
+	dir string
+
+	// mu serializes the batches, which share the staging database.
+	mu    sync.Mutex
+	stage *DB
+	batch int64
+}
+
+var _ Store = (*LakeDB)(nil)
+
+// NewLakeDB opens the lake in dir for writing, creating it if needed.
+func NewLakeDB(dir string) (*LakeDB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lake directory: %w", err)
+	}
+	status, err := NewDB(filepath.Join(dir, LakeStatusFile))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := status.conn.Exec(CreateLakeBlocksTable); err != nil {
+		status.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+	stage, err := NewDB(MemoryPath)
+	if err != nil {
+		status.Close()
+		return nil, err
+	}
+	return &LakeDB{DB: status, dir: dir, stage: stage}, nil
+}
+
+func (l *LakeDB) Close() error {
+	return errors.Join(l.stage.Close(), l.DB.Close())
+}
+
+func (l *LakeDB) InsertBlockWithTransactions(ctx context.Context, data *models.BlockData) error {
+	return l.writeBatch(ctx, []*models.BlockData{data})
+}
+
+func (l *LakeDB) InsertBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error {
+	return l.writeBatch(ctx, blocks)
+}
+
+// ReplaceBlocksWithTransactions is InsertBlocksWithTransactions: a block
+// stored again at a height replaces the one before in lake_blocks either way.
+func (l *LakeDB) ReplaceBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error {
+	return l.writeBatch(ctx, blocks)
+}
+
+// GetBlockHashAtHeight returns the hash of the block stored at height, or
+// sql.ErrNoRows if there is none.
+func (l *LakeDB) GetBlockHashAtHeight(height int64) (string, error) {
+	var hash string
+	err := l.conn.QueryRow(`SELECT hash FROM lake_blocks WHERE height = ?`, height).Scan(&hash)
+	return hash, err
+}
+
+// writeBatch writes the Parquet files of blocks, then records them and
+// marks them completed.
+func (l *LakeDB) writeBatch(ctx context.Context, blocks []*models.BlockData) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.batch = max(l.batch+1, time.Now().UnixNano())
+	files, err := l.writeFiles(ctx, blocks, l.batch)
+	if err != nil {
+		return err
+	}
+	replaced, err := l.recordBatch(ctx, blocks, l.batch)
+	if err != nil {
+		for _, path := range files {
+			os.Remove(path)
+		}
+		return err
+	}
+	for _, batch := range replaced {
+		l.dropBatch(batch)
+	}
+	return nil
+}
+
+// writeFiles stages the rows of blocks and copies them to the Parquet files
+// of batch, returning their paths. The staging transaction is rolled back
+// once they are written, which leaves the staging database empty.
+func (l *LakeDB) writeFiles(ctx context.Context, blocks []*models.BlockData, batch int64) ([]string, error) {
+	tx, err := l.stage.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := l.stage.stageBlocks(ctx, tx, blocks); err != nil {
+		return nil, err
+	}
+
+	var temps, files []string
+	removeTemps := func() {
+		for _, path := range temps {
+			os.Remove(path)
+		}
+	}
+	name := "part-" + strconv.FormatInt(batch, 10) + ".parquet"
+	for _, t := range lakeTables {
+		buckets, err := stagedBuckets(ctx, tx, t)
+		if err != nil {
+			removeTemps()
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			dir := filepath.Join(l.dir, t.name, "height_bucket="+strconv.FormatInt(bucket, 10))
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				removeTemps()
+				return nil, fmt.Errorf("failed to create lake directory: %w", err)
+			}
+			temp := filepath.Join(dir, "."+name+".tmp")
+			temps = append(temps, temp)
+			files = append(files, filepath.Join(dir, name))
+			query := fmt.Sprintf(`COPY (
+				SELECT *, %[1]d AS lake_batch FROM %[2]s WHERE %[3]s // %[4]d = %[5]d ORDER BY %[3]s
+			) TO %[6]s (FORMAT PARQUET)`, batch, t.name, t.height, lakeBucketBlocks, bucket, quoteLiteral(temp))
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				removeTemps()
+				return nil, fmt.Errorf("failed to write %s: %w", temp, err)
+			}
+		}
+	}
+	for i, temp := range temps {
+		if err := os.Rename(temp, files[i]); err != nil {
+			removeTemps()
+			return files[:i], fmt.Errorf("failed to complete %s: %w", files[i], err)
+		}
+	}
+	return files, nil
+}
+
+// stageBlocks inserts the rows of the lakeTables of blocks.
+func (db *DB) stageBlocks(ctx context.Context, tx *sql.Tx, blocks []*models.BlockData) error {
+	var (
+		transactions []*models.Transaction
+		outputs      []*models.TxOutput
+		inputs       []*models.TxInput
+		opReturns    []*models.OpReturnOutput
+		watched      []*models.WatchedActivity
+	)
+	// The files are written under LakeDB.mu, so like writeMu it orders
+	// the times with the batches
+	stampProcessed(blocks, db.now())
+	for _, data := range blocks {
+		if err := insertBlock(ctx, tx, data.Block, false); err != nil {
+			return fmt.Errorf("failed to insert block %d: %w", data.Block.Height, err)
+		}
+		transactions = append(transactions, data.Transactions...)
+		outputs = append(outputs, data.Outputs...)
+		inputs = append(inputs, data.Inputs...)
+		opReturns = append(opReturns, data.OpReturns...)
+		watched = append(watched, data.Watched...)
+	}
+	if err := insertTransactions(ctx, tx, transactions, false); err != nil {
+		return err
+	}
+	if err := db.insertTxOutputs(ctx, tx, outputs, false); err != nil {
+		return err
+	}
+	if err := db.insertTxInputs(ctx, tx, inputs, false); err != nil {
+		return err
+	}
+	if err := insertOpReturns(ctx, tx, opReturns, false); err != nil {
+		return err
+	}
+	return insertWatchedActivity(ctx, tx, watched, false)
+}
+
+// stagedBuckets returns the height buckets the staged rows of t fall in.
+func stagedBuckets(ctx context.Context, tx *sql.Tx, t lakeTable) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT DISTINCT %s // %d AS bucket FROM %s ORDER BY bucket`,
+		t.height, lakeBucketBlocks, t.name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged %s: %w", t.name, err)
+	}
+	defer rows.Close()
+	var buckets []int64
+	for rows.Next() {
+		var bucket int64
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// recordBatch records blocks in lake_blocks as stored by batch and marks
+// them completed, in one transaction. It returns the batches that stored
+// blocks at their heights before.
+func (l *LakeDB) recordBatch(ctx context.Context, blocks []*models.BlockData, batch int64) ([]int64, error) {
+	heights := make([]string, len(blocks))
+	for i, data := range blocks {
+		heights[i] = strconv.FormatInt(data.Block.Height, 10)
+	}
+
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	var replaced []int64
+	err := l.inTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT DISTINCT batch FROM lake_blocks WHERE height IN (`+strings.Join(heights, ", ")+`)`)
+		if err != nil {
+			return fmt.Errorf("failed to read lake blocks: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var b int64
+			if err := rows.Scan(&b); err != nil {
+				return err
+			}
+			replaced = append(replaced, b)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		err = insertRows(ctx, tx, `INSERT INTO lake_blocks (height, hash, batch) VALUES `, "(?, ?, ?)",
+			` ON CONFLICT (height) DO UPDATE SET hash = excluded.hash, batch = excluded.batch`,
+			len(blocks), func(i int) []any {
+				return []any{blocks[i].Block.Height, blocks[i].Block.Hash, batch}
+			})
+		if err != nil {
+			return fmt.Errorf("failed to record lake blocks: %w", err)
+		}
+		for _, data := range blocks {
+			if err := markBlockCompleted(ctx, tx, data.Block.Height, data.Block.Hash); err != nil {
+				return fmt.Errorf("failed to mark block completed: %w", err)
+			}
+		}
+		return nil
+	})
+	return replaced, err
+}
+
+// dropBatch deletes the files of batch once no height refers to it. Failing
+// to only leaves stale rows, which are never read, behind.
+func (l *LakeDB) dropBatch(batch int64) {
+	var n int64
+	if err := l.conn.QueryRow(`SELECT COUNT(*) FROM lake_blocks WHERE batch = ?`, batch).Scan(&n); err != nil || n > 0 {
+		return
+	}
+	files, _ := filepath.Glob(filepath.Join(l.dir, "*", "*", "part-"+strconv.FormatInt(batch, 10)+".parquet"))
+	for _, path := range files {
+		os.Remove(path)
+	}
+}
+
+// NewReadOnlyLakeDB opens the lake in dir for the reports. Its status
+// database is attached read-only, and the tables a lake keeps in Parquet
+// files are replaced by views reading the rows of the batches lake_blocks
+// records, so that queries read the lake like a database file. The views
+// derive what LakeDB doesn't write: the spent links of tx_outputs, the
+// values and addresses of tx_inputs, and the addresses, address_first_seen
+// and address_stats_blocks tables. Unlike in a database file, outputs whose
+// txid and index a later coinbase repeats (BIP30) are read twice.
+func NewReadOnlyLakeDB(dir string) (*DB, error) {
+	statusPath := filepath.Join(dir, LakeStatusFile)
+	if _, err := os.Stat(statusPath); err != nil {
+		return nil, fmt.Errorf("no lake in %s: %w", dir, err)
+	}
+	// The views shadow the empty tables of the status database
+	db, err := openAttached(statusPath, lakeAlias, nil, `SET search_path = 'memory.main,`+lakeAlias+`.main'`)
+	if err != nil && strings.Contains(err.Error(), "Could not set lock on file") {
+		return nil, fmt.Errorf("%w: %v", ErrDatabaseLocked, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the lake in %s: %w", dir, err)
+	}
+	for _, query := range lakeViews(dir) {
+		if _, err := db.conn.Exec(query); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open the lake in %s: %w", dir, err)
+		}
+	}
+	return db, nil
+}
+
+// lakeViews returns the statements creating the views of the lake in dir.
+// The rows of the lakeTables are read from the Parquet files, by views named
+// after the tables except for those of tx_outputs and tx_inputs, which are
+// lake_tx_outputs and lake_tx_inputs, or from the empty tables while there
+// are none.
+func lakeViews(dir string) []string {
+	var views []string
+	for _, t := range lakeTables {
+		name := t.name
+		if name == "tx_outputs" || name == "tx_inputs" {
+			name = "lake_" + name
+		}
+		source := `SELECT * FROM ` + lakeAlias + `.main.` + t.name
+		pattern := filepath.Join(dir, t.name, "*", "*.parquet")
+		if files, _ := filepath.Glob(pattern); len(files) > 0 {
+			source = fmt.Sprintf(`SELECT p.* EXCLUDE (lake_batch)
+			FROM read_parquet(%s, union_by_name = true, hive_partitioning = false) p
+			SEMI JOIN %s.lake_blocks l ON l.height = p.%s AND l.batch = p.lake_batch`,
+				quoteLiteral(pattern), lakeAlias, t.height)
+		}
+		views = append(views, `CREATE VIEW memory.main.`+name+` AS `+source)
+	}
+	return append(views,
+		`CREATE VIEW memory.main.tx_inputs AS
+		SELECT i.* REPLACE (COALESCE(i.value, o.value) AS value, COALESCE(i.address, o.address) AS address)
+		FROM memory.main.lake_tx_inputs i
+		LEFT JOIN memory.main.lake_tx_outputs o ON o.txid = i.prev_txid AND o.vout = i.prev_vout`,
+		`CREATE VIEW memory.main.tx_outputs AS
+		SELECT o.* REPLACE (i.txid_spending AS spent_txid, i.vout AS spent_vout)
+		FROM memory.main.lake_tx_outputs o
+		LEFT JOIN memory.main.lake_tx_inputs i ON i.prev_txid = o.txid AND i.prev_vout = o.vout`,
+		// As applyAddressDelta sums them
+		`CREATE VIEW memory.main.addresses AS
+		SELECT
+			address, MIN(height) AS first_seen_height, MAX(height) AS last_seen_height,
+			CAST(SUM(received) AS BIGINT) AS total_received,
+			CAST(SUM(sent) AS BIGINT) AS total_sent,
+			CAST(SUM(created - spent) AS BIGINT) AS utxo_count,
+			CAST(SUM(received - sent) AS BIGINT) AS balance
+		FROM (
+			SELECT address, block_height AS height, value AS received, 0 AS sent, 1 AS created, 0 AS spent
+			FROM memory.main.lake_tx_outputs
+			WHERE address IS NOT NULL
+			UNION ALL
+			SELECT o.address, i.block_height, 0, o.value, 0, 1
+			FROM memory.main.lake_tx_inputs i
+			JOIN memory.main.lake_tx_outputs o ON o.txid = i.prev_txid AND o.vout = i.prev_vout
+			WHERE o.address IS NOT NULL
+		) delta
+		GROUP BY address`,
+		`CREATE VIEW memory.main.address_first_seen AS
+		SELECT o.address, MIN(o.block_height) AS first_seen_height, arg_min(b.timestamp, b.height) AS first_seen_time
+		FROM memory.main.lake_tx_outputs o
+		JOIN memory.main.blocks b ON b.height = o.block_height
+		WHERE o.address IS NOT NULL
+		GROUP BY o.address`,
+		`CREATE VIEW memory.main.address_stats_blocks AS
+		SELECT height AS block_height, hash AS block_hash FROM `+lakeAlias+`.lake_blocks`,
+	)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+// TestLake stores blocks in a lake in batches, one replacing a block after
+// a reorg and another storing a block again, and checks that the lake reads
+// the same as a database file storing them.
+func TestLake(t *testing.T) {
+	ctx := context.Background()
+	c := newTestChain()
+	c.watch = map[string]bool{"A": true}
+	b1, coinbase := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000}}})
+	b2, outs := c.block(2, 0,
+		testTx{outs: []testOut{{"miner", 5000}}},
+		testTx{ins: coinbase[0], outs: []testOut{{"A", 4000}, {"B", 900}}},
+	)
+	b3, _ := c.block(3, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: outs[1][:1], outs: []testOut{{"C", 3900}}})
+	orphan, _ := c.block(3, 1, testTx{outs: []testOut{{"D", 5000}}})
+	b4, _ := c.block(4, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: outs[1][1:], outs: []testOut{{"A", 800}}})
+
+	dir := t.TempDir()
+	lake, err := NewLakeDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lake and the database it's compared with store the blocks at the
+	// same time
+	storedAt := func() time.Time { return c.genesis.AddDate(1, 0, 0) }
+	lake.stage.clock = storedAt
+	for _, batch := range [][]*models.BlockData{{b1, b2}, {orphan, b4}, {b3}, {b4}} {
+		for _, data := range batch {
+			if err := lake.MarkBlockProcessing(ctx, data.Block.Height, data.Block.Hash); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := lake.InsertBlocksWithTransactions(ctx, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hash, err := lake.GetBlockHashAtHeight(3); err != nil || hash != b3.Block.Hash {
+		t.Errorf("hash at height 3 %q, %v, want %q", hash, err, b3.Block.Hash)
+	}
+	// As an interrupted run leaves them, written but not recorded
+	if _, err := lake.writeFiles(ctx, []*models.BlockData{b2}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := lake.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The batch storing the orphan and b4 first is dropped
+	files, err := filepath.Glob(filepath.Join(dir, "blocks", "height_bucket=0", "part-*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("%d block files, want 4: %v", len(files), files)
+	}
+
+	want := newTestDB(t, DriverDuckDB)
+	want.clock = storedAt
+	storeBlocks(t, want, false, b1, b2, orphan)
+	storeBlocks(t, want, true, b3)
+	storeBlocks(t, want, false, b4)
+
+	store, err := OpenLake(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := store.(*DB)
+	defer got.Close()
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	reads := []struct {
+		name string
+		read func(db *DB) (any, error)
+	}{
+		{"GetProcessedBlocks", func(db *DB) (any, error) { return db.GetProcessedBlocks(0, 10) }},
+		{"GetBlocksByTime", func(db *DB) (any, error) {
+			blocks, err := db.GetBlocksByTime(from, to)
+			for _, b := range blocks {
+				b.ProcessedAt = b.ProcessedAt.UTC()
+			}
+			return blocks, err
+		}},
+		{"GetTopAddresses", func(db *DB) (any, error) { return db.GetTopAddresses(100) }},
+		{"GetAddressBalance", func(db *DB) (any, error) { return db.GetAddressBalance("A") }},
+		{"GetActiveAddressesPerDay", func(db *DB) (any, error) { return db.GetActiveAddressesPerDay(from, to) }},
+		{"GetWatchlistByDay", func(db *DB) (any, error) { return db.GetWatchlistByDay(from, to, "") }},
+		{"GetUnspentOutputs", func(db *DB) (any, error) {
+			var unspent []*models.TxOutput
+			for _, address := range []string{"miner", "A", "B", "C", "D"} {
+				outputs, err := db.GetUnspentOutputs(address)
+				if err != nil {
+					return nil, err
+				}
+				unspent = append(unspent, outputs...)
+			}
+			return unspent, nil
+		}},
+		{"spent outputs", func(db *DB) (any, error) {
+			rows, err := db.conn.Query(`SELECT txid, vout, spent_txid, spent_vout FROM tx_outputs WHERE spent_txid IS NOT NULL ORDER BY txid, vout`)
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+			var spent []string
+			for rows.Next() {
+				var txid, spentTxid string
+				var vout, spentVout int
+				if err := rows.Scan(&txid, &vout, &spentTxid, &spentVout); err != nil {
+					return nil, err
+				}
+				spent = append(spent, fmt.Sprintf("%s:%d>%s:%d", txid[60:], vout, spentTxid[60:], spentVout))
+			}
+			return spent, rows.Err()
+		}},
+	}
+	for _, r := range reads {
+		result, err := r.read(got)
+		if err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		expected, err := r.read(want)
+		if err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			gotJSON, _ := json.Marshal(result)
+			wantJSON, _ := json.Marshal(expected)
+			t.Errorf("%s of the lake:\n got %s\nwant %s", r.name, gotJSON, wantJSON)
+		}
+	}
+
+	// The inputs are resolved from the outputs they spend
+	var value int64
+	var address string
+	if err := got.conn.QueryRow(`SELECT value, address FROM tx_inputs WHERE block_height = 3`).Scan(&value, &address); err != nil {
+		t.Fatal(err)
+	}
+	if value != 4000 || address != "A" {
+		t.Errorf("input of block 3 spends %d from %q, want 4000 from A", value, address)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import "scrapbtc/pkg/models"
+
+// selectBlock reads the blocks columns for scanStoredBlock. Columns recorded
+// by later versions of the scraper read as their zero value while NULL.
+const selectBlock = `SELECT hash, height, timestamp, size, weight, tx_count, COALESCE(filtered_tx_count, 0),
+	COALESCE(previous_block_hash, ''), merkle_root, nonce, bits, difficulty,
+	coinbase_value, COALESCE(subsidy, 0), total_fees, COALESCE(segwit_tx_count, 0), COALESCE(witness_size, 0),
+	COALESCE(coinbase_script, ''), COALESCE(miner_tag, ''), COALESCE(work, ''), COALESCE(chainwork, ''), processed_at
+FROM blocks`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStoredBlock(row rowScanner) (*models.Block, error) {
+	b := &models.Block{}
+	err := row.Scan(&b.Hash, &b.Height, scanTime(&b.Timestamp), &b.Size, &b.Weight, &b.TxCount, &b.FilteredTxCount,
+		&b.PreviousBlockHash, &b.MerkleRoot, &b.Nonce, &b.Bits, &b.Difficulty,
+		&b.CoinbaseValue, &b.Subsidy, &b.TotalFees, &b.SegwitTxCount, &b.WitnessSize,
+		&b.CoinbaseScript, &b.MinerTag, &b.Work, &b.Chainwork, scanTime(&b.ProcessedAt))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBlockByHeight returns the stored block at height, or sql.ErrNoRows.
+// Blocks stored by a header sync have no transactions yet.
+func (db *DB) GetBlockByHeight(height int64) (*models.Block, error) {
+	return scanStoredBlock(db.conn.QueryRow(selectBlock+` WHERE height = ? ORDER BY processed_at DESC LIMIT 1`, height))
+}
+
+// GetBlockByHash returns the stored block with hash, or sql.ErrNoRows.
+func (db *DB) GetBlockByHash(hash string) (*models.Block, error) {
+	return scanStoredBlock(db.conn.QueryRow(selectBlock+` WHERE hash = ?`, hash))
+}
+
+// selectTransaction reads the transactions columns for
+// scanStoredTransaction.
+const selectTransaction = `SELECT txid, block_hash, block_height, size, vsize, weight, fee, COALESCE(fee_rate, 0), is_coinbase,
+	input_count, output_count, input_value, output_value, COALESCE(version, 0), COALESCE(locktime, 0),
+	COALESCE(signals_rbf, FALSE), COALESCE(tx_category, ''), timestamp, processed_at
+FROM transactions`
+
+func scanStoredTransaction(row rowScanner) (*models.Transaction, error) {
+	t := &models.Transaction{}
+	var category string
+	err := row.Scan(&t.Txid, &t.BlockHash, &t.BlockHeight, &t.Size, &t.VSize, &t.Weight,
+		&t.Fee, &t.FeeRate, &t.IsCoinbase, &t.InputCount, &t.OutputCount, &t.InputValue, &t.OutputValue,
+		&t.Version, &t.LockTime, &t.SignalsRBF, &category, scanTime(&t.Timestamp), scanTime(&t.ProcessedAt))
+	if err != nil {
+		return nil, err
+	}
+	t.Category = models.TxCategory(category)
+	return t, nil
+}
+
+// GetTransaction returns the stored transaction with txid, or sql.ErrNoRows.
+// Of the two coinbases repeated before BIP30 it returns the first.
+func (db *DB) GetTransaction(txid string) (*models.Transaction, error) {
+	return scanStoredTransaction(db.conn.QueryRow(selectTransaction+` WHERE txid = ? ORDER BY block_height LIMIT 1`, txid))
+}
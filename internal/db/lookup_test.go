@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	forEachDriver(t, testLookup)
+}
+
+// testLookup stores two blocks whose coinbases share a txid, as before
+// BIP30, and a header-only block, and reads them back one at a time.
+func testLookup(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	coinbase := testTx{outs: []testOut{{"miner", 5000}}}
+	b1, _ := c.block(1, 0, coinbase, testTx{outs: []testOut{{"A", 100}}})
+	b2, _ := c.block(2, 0, coinbase)
+	b2.Transactions[0].Txid = b1.Transactions[0].Txid
+	for _, out := range b2.Outputs {
+		out.Txid = b1.Transactions[0].Txid
+	}
+	storeBlocks(t, db, false, b2, b1)
+	header, _ := c.block(3, 0)
+	if _, err := db.InsertBlockHeaders(context.Background(), []*models.Block{header.Block}); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := db.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Hash != b1.Block.Hash || block.TxCount != 2 || block.Subsidy != b1.Block.Subsidy || !block.Timestamp.Equal(b1.Block.Timestamp) {
+		t.Errorf("GetBlockByHeight(1) = %+v, want %+v", block, b1.Block)
+	}
+	if block, err := db.GetBlockByHash(header.Block.Hash); err != nil || block.Height != 3 || block.TxCount != 0 {
+		t.Errorf("GetBlockByHash(header) = %+v, %v, want the header-only block 3", block, err)
+	}
+
+	tx, err := db.GetTransaction(b1.Transactions[1].Txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.BlockHeight != 1 || tx.OutputValue != 100 || !tx.Timestamp.Equal(b1.Block.Timestamp) {
+		t.Errorf("GetTransaction() = %+v, want the second transaction of block 1", tx)
+	}
+	if tx, err := db.GetTransaction(b1.Transactions[0].Txid); err != nil || tx.BlockHeight != 1 || !tx.IsCoinbase {
+		t.Errorf("GetTransaction(repeated coinbase) = %+v, %v, want the one of block 1", tx, err)
+	}
+
+	if _, err := db.GetBlockByHeight(4); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetBlockByHeight(4) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := db.GetBlockByHash(blockHash(1, 1)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetBlockByHash(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := db.GetTransaction("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetTransaction(missing) error = %v, want sql.ErrNoRows", err)
+	}
+}
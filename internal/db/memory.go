@@ -0,0 +1,26 @@
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// MemoryPath is the path that opens an in-memory DuckDB database instead of
+// a file. It is discarded when closed, unless saved with Export first.
+const MemoryPath = ":memory:"
+
+// Export writes the database to the directory path with DuckDB's EXPORT
+// DATABASE, as a schema.sql and load.sql script and a Parquet file per
+// table, which IMPORT DATABASE loads into another database.
+func (db *DB) Export(path string) error {
+	if db.driver != DriverDuckDB {
+		return fmt.Errorf("exporting needs the %s driver", DriverDuckDB)
+	}
+	if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+		return fmt.Errorf("export directory %s is not empty", path)
+	}
+	if _, err := db.conn.Exec(`EXPORT DATABASE ` + quoteLiteral(path) + ` (FORMAT PARQUET)`); err != nil {
+		return fmt.Errorf("failed to export the database to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// Names of the metadata entries.
+const (
+	// MetadataProfile is the models.Profile the database is scraped with.
+	MetadataProfile = "profile"
+	// MetadataInMemory is set to "true" in databases created at MemoryPath,
+	// and kept in their exports.
+	MetadataInMemory = "in_memory"
+)
+
+// GetMetadata returns the value of the metadata entry name, or "" if it
+// isn't set.
+func (db *DB) GetMetadata(name string) (string, error) {
+	if db.readOnly {
+		// Read-only databases aren't migrated, so they may predate the table
+		var tables int
+		if err := db.conn.QueryRow(db.dialect.tableExists, "metadata").Scan(&tables); err != nil {
+			return "", fmt.Errorf("failed to look for the metadata table: %w", err)
+		}
+		if tables == 0 {
+			return "", nil
+		}
+	}
+
+	var value string
+	err := db.conn.QueryRow(`SELECT value FROM metadata WHERE name = ?`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// SetMetadata sets the metadata entry name to value.
+func (db *DB) SetMetadata(name, value string) error {
+	_, err := db.conn.Exec(`INSERT INTO metadata (name, value, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		name, value, models.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+const selectBlockColumns = `hash, height, timestamp, size, weight, tx_count, COALESCE(filtered_tx_count, 0),
+	COALESCE(previous_block_hash, ''), merkle_root, nonce, bits, difficulty,
+	COALESCE(coinbase_value, 0), COALESCE(subsidy, 0), COALESCE(total_fees, 0),
+	COALESCE(segwit_tx_count, 0), COALESCE(witness_size, 0), processed_at`
+
+func scanBlock(row interface{ Scan(...interface{}) error }) (*models.Block, error) {
+	b := &models.Block{}
+	err := row.Scan(&b.Hash, &b.Height, &b.Timestamp, &b.Size, &b.Weight, &b.TxCount, &b.FilteredTxCount,
+		&b.PreviousBlockHash, &b.MerkleRoot, &b.Nonce, &b.Bits, &b.Difficulty,
+		&b.CoinbaseValue, &b.Subsidy, &b.TotalFees, &b.SegwitTxCount, &b.WitnessSize, &b.ProcessedAt)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBlocksByTime returns the stored blocks with a timestamp in [from, to)
+// ordered by height.
+func (db *DB) GetBlocksByTime(from, to time.Time) ([]*models.Block, error) {
+	query := `SELECT ` + selectBlockColumns + ` FROM blocks
+	WHERE timestamp >= ? AND timestamp < ?
+	ORDER BY height`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.Block
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+// GetStoredTxCounts returns the number of transactions stored for each
+// block with a timestamp in [from, to), by block hash. Blocks without stored
+// transactions are left out.
+func (db *DB) GetStoredTxCounts(from, to time.Time) (map[string]int, error) {
+	rows, err := db.conn.Query(`SELECT t.block_hash, COUNT(*)
+	FROM transactions t
+	JOIN blocks b ON b.hash = t.block_hash
+	WHERE b.timestamp >= ? AND b.timestamp < ?
+	GROUP BY t.block_hash`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var hash string
+		var count int
+		if err := rows.Scan(&hash, &count); err != nil {
+			return nil, err
+		}
+		counts[hash] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetSpentOutputAges returns the outputs spent by a block whose creating
+// transaction is stored, together with their creation and spending times.
+func (db *DB) GetSpentOutputAges(blockHash string) ([]*models.SpentOutputAge, error) {
+	query := `SELECT o.value, ct.timestamp, st.timestamp
+	FROM tx_outputs o
+	JOIN transactions st ON st.txid = o.spent_txid
+	JOIN transactions ct ON ct.txid = o.txid
+	WHERE st.block_hash = ?`
+
+	rows, err := db.conn.Query(query, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ages []*models.SpentOutputAge
+	for rows.Next() {
+		a := &models.SpentOutputAge{}
+		if err := rows.Scan(&a.Value, &a.CreatedAt, &a.SpentAt); err != nil {
+			return nil, err
+		}
+		ages = append(ages, a)
+	}
+
+	return ages, rows.Err()
+}
+
+func (db *DB) UpsertBlockMetrics(m *models.BlockMetrics) error {
+	query := `INSERT OR REPLACE INTO block_metrics (
+		block_height, block_hash, timestamp, coin_days_destroyed, value_spent, computed_at
+	) VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := db.conn.Exec(query,
+		m.BlockHeight, m.BlockHash, m.Timestamp, m.CoinDaysDestroyed, m.ValueSpent, m.ComputedAt)
+	return err
+}
+
+// GetDailyCDD returns coin days destroyed and average dormancy per day from
+// the block_metrics table.
+func (db *DB) GetDailyCDD(from, to time.Time) ([]*models.DailyCDD, error) {
+	query := `SELECT
+		date_trunc('day', timestamp) AS day,
+		SUM(coin_days_destroyed),
+		CAST(SUM(value_spent) AS BIGINT)
+	FROM block_metrics
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []*models.DailyCDD
+	for rows.Next() {
+		d := &models.DailyCDD{}
+		var cdd sql.NullFloat64
+		if err := rows.Scan(scanTime(&d.Day), &cdd, &d.ValueSpent); err != nil {
+			return nil, err
+		}
+		d.CoinDaysDestroyed = cdd.Float64
+		if d.ValueSpent > 0 {
+			d.AvgDormancy = d.CoinDaysDestroyed / (float64(d.ValueSpent) / 1e8)
+		}
+		days = append(days, d)
+	}
+
+	return days, rows.Err()
+}
+
+// GetBlockTimeRange returns the timestamps of the oldest and newest stored
+// blocks, or sql.ErrNoRows if there are none.
+func (db *DB) GetBlockTimeRange() (time.Time, time.Time, error) {
+	var first, last time.Time
+	err := db.conn.QueryRow(`SELECT MIN(timestamp), MAX(timestamp) FROM blocks`).Scan(scanTime(&first), scanTime(&last))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if first.IsZero() {
+		return time.Time{}, time.Time{}, sql.ErrNoRows
+	}
+	return first, last, nil
+}
+
+// GetHeightBefore returns the height of the newest stored block with a
+// timestamp before t, or sql.ErrNoRows if there is none.
+func (db *DB) GetHeightBefore(t time.Time) (int64, error) {
+	var height sql.NullInt64
+	if err := db.conn.QueryRow(`SELECT MAX(height) FROM blocks WHERE timestamp < ?`, t).Scan(&height); err != nil {
+		return 0, err
+	}
+	if !height.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return height.Int64, nil
+}
+
+// blockPrices prices every block with the price point nearest to its
+// timestamp, as long as it is within 24 hours of the block. When the single
+// parameter is true, blocks without such a point get a price interpolated
+// linearly between the points before and after them.
+const blockPrices = `
+SELECT
+	b.hash,
+	CASE
+		WHEN pb.timestamp IS NOT NULL AND (pa.timestamp IS NULL OR
+			epoch(b.timestamp) - epoch(pb.timestamp) <= epoch(pa.timestamp) - epoch(b.timestamp))
+		THEN CASE WHEN pb.timestamp >= b.timestamp - INTERVAL 24 HOUR THEN pb.price END
+		ELSE CASE WHEN pa.timestamp <= b.timestamp + INTERVAL 24 HOUR THEN pa.price END
+	END AS nearest_price,
+	COALESCE(nearest_price, CASE WHEN ? AND pb.timestamp IS NOT NULL AND pa.timestamp IS NOT NULL THEN
+		pb.price + (pa.price - pb.price) *
+			(epoch(b.timestamp) - epoch(pb.timestamp)) / (epoch(pa.timestamp) - epoch(pb.timestamp))
+	END) AS price
+FROM blocks b
+ASOF LEFT JOIN price_data pb ON b.timestamp >= pb.timestamp
+ASOF LEFT JOIN price_data pa ON b.timestamp <= pa.timestamp`
+
+// sqliteBlockPrices is blockPrices for SQLite, which has neither ASOF joins
+// nor references to columns of the same SELECT.
+const sqliteBlockPrices = `
+SELECT
+	hash,
+	COALESCE(nearest_price, CASE WHEN ? AND tb IS NOT NULL AND ta IS NOT NULL THEN
+		price_b + (price_a - price_b) * (t - tb) / (ta - tb)
+	END) AS price
+FROM (
+	SELECT
+		hash, t, tb, price_b, ta, price_a,
+		CASE
+			WHEN tb IS NOT NULL AND (ta IS NULL OR t - tb <= ta - t)
+			THEN CASE WHEN tb >= t - 86400 THEN price_b END
+			ELSE CASE WHEN ta <= t + 86400 THEN price_a END
+		END AS nearest_price
+	FROM (
+		SELECT
+			b.hash,
+			epoch(b.timestamp) AS t,
+			epoch(pb.timestamp) AS tb,
+			pb.price AS price_b,
+			epoch(pa.timestamp) AS ta,
+			pa.price AS price_a
+		FROM blocks b
+		LEFT JOIN price_data pb ON pb.timestamp = (SELECT MAX(timestamp) FROM price_data WHERE timestamp <= b.timestamp)
+		LEFT JOIN price_data pa ON pa.timestamp = (SELECT MIN(timestamp) FROM price_data WHERE timestamp >= b.timestamp)
+	)
+)`
+
+// GetCoinFlows aggregates all stored outputs by the day they were created and
+// the day they were spent. Each output is valued at the blockPrices price of
+// the block that created it and of the block that spent it.
+func (db *DB) GetCoinFlows(interpolate bool) ([]*models.CoinFlow, error) {
+	query := `WITH block_price AS (` + db.dialect.blockPrices + `)
+	SELECT
+		date_trunc('day', ct.timestamp) AS created_day,
+		date_trunc('day', st.timestamp) AS spent_day,
+		CAST(SUM(o.value) AS BIGINT),
+		CAST(SUM(CASE WHEN cp.price IS NULL THEN o.value ELSE 0 END) AS BIGINT),
+		COALESCE(SUM(o.value * cp.price), 0) / 1e8,
+		CAST(SUM(CASE WHEN st.txid IS NOT NULL AND (cp.price IS NULL OR sp.price IS NULL) THEN o.value ELSE 0 END) AS BIGINT),
+		COALESCE(SUM(CASE WHEN cp.price IS NOT NULL THEN o.value * sp.price END), 0) / 1e8,
+		COALESCE(SUM(CASE WHEN sp.price IS NOT NULL THEN o.value * cp.price END), 0) / 1e8
+	FROM tx_outputs o
+	JOIN transactions ct ON ct.txid = o.txid
+	LEFT JOIN block_price cp ON cp.hash = ct.block_hash
+	LEFT JOIN transactions st ON st.txid = o.spent_txid
+	LEFT JOIN block_price sp ON sp.hash = st.block_hash
+	GROUP BY created_day, spent_day`
+
+	rows, err := db.conn.Query(query, interpolate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flows []*models.CoinFlow
+	for rows.Next() {
+		f := &models.CoinFlow{}
+		if err := rows.Scan(scanTime(&f.CreatedDay), scanTime(&f.SpentDay), &f.Value, &f.UnpricedValue, &f.CreatedUSD,
+			&f.UnpricedSpent, &f.SpentUSD, &f.SpentCreatedUSD); err != nil {
+			return nil, err
+		}
+		flows = append(flows, f)
+	}
+
+	return flows, rows.Err()
+}
+
+func (db *DB) UpsertDailyMetricsBatch(metrics []*models.DailyMetrics) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO daily_metrics (
+		day, supply, realized_cap, unpriced_supply, value_spent, sopr,
+		unpriced_spent, interpolated, computed_at, price, price_ma200,
+		issued_supply, fees, subsidy, transferred_value, transferred_ex_change
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, m := range metrics {
+		_, err := stmt.Exec(
+			m.Day, m.Supply, m.RealizedCap, m.UnpricedSupply, m.ValueSpent, m.SOPR,
+			m.UnpricedSpent, m.Interpolated, m.ComputedAt, m.Price, m.PriceMA200,
+			m.IssuedSupply, m.Fees, m.Subsidy, m.TransferredValue, m.TransferredExChange)
+		if err != nil {
+			return fmt.Errorf("failed to insert daily metrics: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDailyMetrics returns the stored daily metrics in [from, to) that were
+// computed with the given price interpolation setting. A table without the
+// ratio inputs, in a database older versions created and opened read-only,
+// holds none.
+func (db *DB) GetDailyMetrics(from, to time.Time, interpolated bool) ([]*models.DailyMetrics, error) {
+	if current, err := db.dailyMetricsCurrent(); err != nil || !current {
+		return nil, err
+	}
+
+	query := `SELECT day, supply, realized_cap, unpriced_supply, value_spent, sopr,
+		unpriced_spent, interpolated, computed_at, price, price_ma200,
+		issued_supply, fees, subsidy, transferred_value, transferred_ex_change
+	FROM daily_metrics
+	WHERE day >= ? AND day < ? AND interpolated = ?
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to, interpolated)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []*models.DailyMetrics
+	for rows.Next() {
+		m := &models.DailyMetrics{}
+		var sopr, price, priceMA200 sql.NullFloat64
+		if err := rows.Scan(&m.Day, &m.Supply, &m.RealizedCap, &m.UnpricedSupply, &m.ValueSpent, &sopr,
+			&m.UnpricedSpent, &m.Interpolated, &m.ComputedAt, &price, &priceMA200,
+			&m.IssuedSupply, &m.Fees, &m.Subsidy, &m.TransferredValue, &m.TransferredExChange); err != nil {
+			return nil, err
+		}
+		if sopr.Valid {
+			m.SOPR = &sopr.Float64
+		}
+		if price.Valid {
+			m.Price = &price.Float64
+		}
+		if priceMA200.Valid {
+			m.PriceMA200 = &priceMA200.Float64
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, rows.Err()
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"math"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestGetCoinFlows(t *testing.T) {
+	forEachDriver(t, testGetCoinFlows)
+}
+
+func testGetCoinFlows(t *testing.T, driver string) {
+	c := newTestChain()
+	b1, out1 := c.block(1, 0, testTx{outs: []testOut{{"A", 100000000}}})
+	// A day after the genesis
+	b144, out144 := c.block(144, 0, testTx{ins: out1[0], outs: []testOut{{"B", 100000000}}})
+	// Almost 7 days after the genesis, without a price within 24 hours
+	b1000, _ := c.block(1000, 0, testTx{ins: out144[0], outs: []testOut{{"C", 100000000}}})
+
+	db := newTestDB(t, driver)
+	storeBlocks(t, db, false, b1, b144, b1000)
+	prices := []*models.PriceData{
+		{Timestamp: c.genesis, Price: 100, Source: "test"},
+		{Timestamp: c.genesis.AddDate(0, 0, 1), Price: 200, Source: "test"},
+		{Timestamp: c.genesis.AddDate(0, 0, 10), Price: 1000, Source: "test"},
+	}
+	if err := db.InsertPriceDataBatch(prices); err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(n int) time.Time { return c.genesis.AddDate(0, 0, n) }
+	// b1000 is 5.94 days after the second price and 3.06 days before the third
+	interpolated := 200 + 800*float64(1000*600-86400)/float64(9*86400)
+	tests := []struct {
+		interpolate bool
+		want        []models.CoinFlow
+	}{
+		{false, []models.CoinFlow{
+			{CreatedDay: day(0), SpentDay: day(1), Value: 100000000, CreatedUSD: 100, SpentUSD: 200, SpentCreatedUSD: 100},
+			{CreatedDay: day(1), SpentDay: day(6), Value: 100000000, CreatedUSD: 200, UnpricedSpent: 100000000},
+			{CreatedDay: day(6), Value: 100000000, UnpricedValue: 100000000},
+		}},
+		{true, []models.CoinFlow{
+			{CreatedDay: day(0), SpentDay: day(1), Value: 100000000, CreatedUSD: 100, SpentUSD: 200, SpentCreatedUSD: 100},
+			{CreatedDay: day(1), SpentDay: day(6), Value: 100000000, CreatedUSD: 200, SpentUSD: interpolated, SpentCreatedUSD: 200},
+			{CreatedDay: day(6), Value: 100000000, CreatedUSD: interpolated},
+		}},
+	}
+
+	for _, tt := range tests {
+		flows, err := db.GetCoinFlows(tt.interpolate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flows) != len(tt.want) {
+			t.Fatalf("interpolate=%v: got %d flows, want %d", tt.interpolate, len(flows), len(tt.want))
+		}
+		for _, got := range flows {
+			var want *models.CoinFlow
+			for i := range tt.want {
+				if tt.want[i].CreatedDay.Equal(got.CreatedDay) {
+					want = &tt.want[i]
+				}
+			}
+			if want == nil || !got.SpentDay.Equal(want.SpentDay) || got.Value != want.Value ||
+				got.UnpricedValue != want.UnpricedValue || got.UnpricedSpent != want.UnpricedSpent ||
+				!near(got.CreatedUSD, want.CreatedUSD) || !near(got.SpentUSD, want.SpentUSD) ||
+				!near(got.SpentCreatedUSD, want.SpentCreatedUSD) {
+				t.Errorf("interpolate=%v: flow %+v, want %+v", tt.interpolate, got, want)
+			}
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
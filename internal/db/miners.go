@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetMinerShares returns the number of blocks each pool mined per day or
+// week in [from, to) and its share of the period's blocks. Blocks scraped
+// before miners were identified are left out.
+func (db *DB) GetMinerShares(from, to time.Time, granularity string) ([]*models.MinerShare, error) {
+	if granularity != GranularityDay && granularity != GranularityWeek {
+		return nil, fmt.Errorf("invalid granularity %q: must be day or week", granularity)
+	}
+
+	query := fmt.Sprintf(`SELECT
+		date_trunc('%[1]s', timestamp) AS period,
+		miner_tag,
+		COUNT(*),
+		COUNT(*) * 100.0 / SUM(COUNT(*)) OVER (PARTITION BY date_trunc('%[1]s', timestamp))
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ? AND miner_tag IS NOT NULL
+	GROUP BY period, miner_tag
+	ORDER BY period, COUNT(*) DESC, miner_tag`, granularity)
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*models.MinerShare
+	for rows.Next() {
+		s := &models.MinerShare{}
+		if err := rows.Scan(scanTime(&s.Period), &s.MinerTag, &s.Blocks, &s.Percent); err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+
+	return shares, rows.Err()
+}
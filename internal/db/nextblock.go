@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// InsertNextBlockEstimate records the summary of one block template.
+func (db *DB) InsertNextBlockEstimate(e *models.NextBlockEstimate) error {
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO next_block_estimates (
+		estimated_at, height, tx_count, weight, total_fees, min_fee_rate
+	) VALUES (?, ?, ?, ?, ?, ?)`,
+		e.EstimatedAt, e.Height, e.TxCount, e.Weight, e.TotalFees, e.MinFeeRate)
+	if err != nil {
+		return fmt.Errorf("failed to insert next block estimate: %w", err)
+	}
+	return nil
+}
+
+// selectNextBlockFees matches every block mined in the range with the last
+// template taken for its height, the closest to what the miner worked on.
+const selectNextBlockFees = `
+WITH latest AS (
+	SELECT height, MAX(estimated_at) AS estimated_at
+	FROM next_block_estimates
+	GROUP BY height
+)
+SELECT
+	date_trunc('day', b.timestamp) AS day,
+	COUNT(*),
+	AVG(e.tx_count),
+	AVG(b.tx_count - 1),
+	CAST(SUM(e.total_fees) AS BIGINT),
+	CAST(SUM(b.total_fees) AS BIGINT),
+	CAST(SUM(e.total_fees - b.total_fees) AS BIGINT),
+	AVG(e.min_fee_rate)
+FROM blocks b
+JOIN latest l ON l.height = b.height
+JOIN next_block_estimates e ON e.estimated_at = l.estimated_at
+WHERE b.timestamp >= ? AND b.timestamp < ?
+GROUP BY day
+ORDER BY day`
+
+// GetNextBlockFees compares the fees of the blocks mined in [from, to)
+// with the templates recorded before them, per day.
+func (db *DB) GetNextBlockFees(from, to time.Time) ([]*models.NextBlockFees, error) {
+	rows, err := db.conn.Query(selectNextBlockFees, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.NextBlockFees
+	for rows.Next() {
+		s := &models.NextBlockFees{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Blocks, &s.TemplateTxs, &s.BlockTxs, &s.TemplateFees, &s.BlockFees,
+			&s.FeesLeft, &s.AvgMinFeeRate); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
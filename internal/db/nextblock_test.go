@@ -0,0 +1,52 @@
+package db
+
+import (
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestNextBlockFees(t *testing.T) {
+	forEachDriver(t, testNextBlockFees)
+}
+
+// testNextBlockFees takes two templates for block 1, of which only the
+// later counts, one for block 2 and one for block 3, which isn't stored.
+func testNextBlockFees(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	for _, b := range []struct {
+		height, fees int64
+	}{{1, 900}, {2, 1200}} {
+		data, _ := c.block(b.height, 0,
+			testTx{outs: []testOut{{"miner", 5000}}},
+			testTx{outs: []testOut{{"A", 100}}},
+			testTx{outs: []testOut{{"B", 100}}})
+		data.Block.TotalFees = b.fees
+		storeBlocks(t, db, false, data)
+	}
+
+	for i, e := range []*models.NextBlockEstimate{
+		{Height: 1, TxCount: 1, Weight: 1000, TotalFees: 500, MinFeeRate: 1},
+		{Height: 1, TxCount: 3, Weight: 3000, TotalFees: 1000, MinFeeRate: 2},
+		{Height: 2, TxCount: 1, Weight: 1000, TotalFees: 1000, MinFeeRate: 4},
+		{Height: 3, TxCount: 5, Weight: 5000, TotalFees: 9000, MinFeeRate: 8},
+	} {
+		e.EstimatedAt = c.genesis.Add(time.Duration(i) * time.Minute)
+		if err := db.InsertNextBlockEstimate(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.GetNextBlockFees(c.genesis, c.genesis.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*models.NextBlockFees{
+		{Day: c.genesis, Blocks: 2, TemplateTxs: 2, BlockTxs: 2, TemplateFees: 2000, BlockFees: 2100, FeesLeft: -100, AvgMinFeeRate: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("next block fees:\n got %+v\nwant %+v", got, want)
+	}
+}
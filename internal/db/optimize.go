@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+)
+
+// DropQueryIndexes drops the secondary indexes created by CreateIndexes, so
+// a bulk load doesn't maintain them row by row. The unique outpoint indexes
+// that deduplicate retried blocks are kept.
+func (db *DB) DropQueryIndexes() error {
+	rows, err := db.conn.Query(db.dialect.queryIndexes)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan index name: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+
+	for _, name := range names {
+		if _, err := db.conn.Exec(fmt.Sprintf(`DROP INDEX IF EXISTS "%s"`, name)); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// OptimizeForQueries creates the secondary indexes and refreshes the
+// statistics the query planner uses. It is meant to run once bulk loading
+// is done, since the indexes slow down inserts.
+func (db *DB) OptimizeForQueries() error {
+	if err := db.CreateIndexes(); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(`ANALYZE`); err != nil {
+		return fmt.Errorf("failed to analyze database: %w", err)
+	}
+	return nil
+}
+
+// BackfillIOHeights sets the block height of the inputs and outputs of the
+// transactions in [fromHeight, toHeight] stored before inputs and outputs
+// carried it. DuckDB can't update a column an index depends on, so the
+// height bucket indexes are dropped; CreateIndexes recreates them.
+func (db *DB) BackfillIOHeights(fromHeight, toHeight int64) (int64, error) {
+	if _, err := db.conn.Exec(`
+	DROP INDEX IF EXISTS idx_tx_inputs_height_bucket;
+	DROP INDEX IF EXISTS idx_tx_outputs_height_bucket;
+	`); err != nil {
+		return 0, fmt.Errorf("failed to drop height bucket indexes: %w", err)
+	}
+
+	var updated int64
+	for _, query := range []string{
+		`UPDATE tx_inputs SET block_height = t.block_height
+		FROM transactions t
+		WHERE t.txid = tx_inputs.txid_spending AND tx_inputs.block_height IS NULL
+			AND t.block_height BETWEEN ? AND ?`,
+		`UPDATE tx_outputs SET block_height = t.block_height
+		FROM transactions t
+		WHERE t.txid = tx_outputs.txid AND tx_outputs.block_height IS NULL
+			AND t.block_height BETWEEN ? AND ?`,
+	} {
+		res, err := db.conn.Exec(query, fromHeight, toHeight)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update input and output heights: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		updated += n
+	}
+	return updated, nil
+}
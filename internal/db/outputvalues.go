@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"time"
+)
+
+// outputValueBounds are the inclusive upper bounds, in satoshis, of the
+// output value buckets but the last, which holds the larger outputs.
+var outputValueBounds = []int64{1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e11}
+
+// outputValueBuckets names the buckets of outputValueBounds.
+var outputValueBuckets = []string{
+	"<=1k sats", "1k-10k sats", "10k-100k sats", "0.001-0.01 BTC", "0.01-0.1 BTC",
+	"0.1-1 BTC", "1-10 BTC", "10-100 BTC", "100-1000 BTC", ">1000 BTC",
+}
+
+// selectOutputValueDistribution counts the outputs of each bucket by the
+// period or block expression and grouping of its first two arguments, and
+// the bucket expression of its third. Rows of the same period or block are
+// consecutive.
+const selectOutputValueDistribution = `
+SELECT
+	%[1]s AS period,
+	MIN(b.height),
+	MAX(b.height),
+	%[3]s AS bucket,
+	COUNT(*),
+	CAST(SUM(o.value) AS BIGINT)
+FROM tx_outputs o
+JOIN blocks b ON b.height = o.block_height
+WHERE b.timestamp >= ? AND b.timestamp < ?
+GROUP BY %[2]s
+ORDER BY period, MIN(b.height), bucket`
+
+// outputValueBucket returns the SQL expression of the bucket index of an
+// output o.
+func outputValueBucket() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i, bound := range outputValueBounds {
+		fmt.Fprintf(&b, " WHEN o.value <= %d THEN %d", bound, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(outputValueBounds))
+	return b.String()
+}
+
+// GetOutputValueDistribution returns the histogram of the values of the
+// outputs created in [from, to), for the whole range or per block, day or
+// week, from the stored outputs.
+func (db *DB) GetOutputValueDistribution(from, to time.Time, granularity string) ([]*models.OutputValueDistribution, error) {
+	var period, group string
+	switch granularity {
+	case GranularityAll:
+		period, group = "MIN(b.timestamp)", "bucket"
+	case GranularityBlock:
+		period, group = "b.timestamp", "b.height, b.timestamp, bucket"
+	case GranularityDay, GranularityWeek:
+		period, group = fmt.Sprintf("date_trunc('%s', b.timestamp)", granularity), "1, bucket"
+	default:
+		return nil, fmt.Errorf("invalid granularity %q: must be all, block, day or week", granularity)
+	}
+
+	query := fmt.Sprintf(selectOutputValueDistribution, period, group, outputValueBucket())
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.OutputValueDistribution
+	var last *models.OutputValueDistribution
+	for rows.Next() {
+		var period time.Time
+		var fromHeight, toHeight, count, value int64
+		var bucket int
+		if err := rows.Scan(scanTime(&period), &fromHeight, &toHeight, &bucket, &count, &value); err != nil {
+			return nil, err
+		}
+
+		same := last != nil
+		switch {
+		case !same || granularity == GranularityAll:
+		case granularity == GranularityBlock:
+			same = fromHeight == last.FromHeight
+		default:
+			same = period.Equal(last.Period)
+		}
+		if !same {
+			last = &models.OutputValueDistribution{Period: period, FromHeight: fromHeight, ToHeight: toHeight}
+			for _, name := range outputValueBuckets {
+				last.Buckets = append(last.Buckets, &models.OutputValueBucket{Bucket: name})
+			}
+			stats = append(stats, last)
+		}
+		if period.Before(last.Period) {
+			last.Period = period
+		}
+		last.FromHeight = min(last.FromHeight, fromHeight)
+		last.ToHeight = max(last.ToHeight, toHeight)
+		last.Outputs += count
+		last.Buckets[bucket].Count = count
+		last.Buckets[bucket].Value = value
+	}
+
+	return stats, rows.Err()
+}
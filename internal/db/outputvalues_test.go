@@ -0,0 +1,69 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestOutputValueDistribution(t *testing.T) {
+	forEachDriver(t, testOutputValueDistribution)
+}
+
+// testOutputValueDistribution stores two blocks on day 0 and one on day 1
+// with outputs at and around the bucket bounds.
+func testOutputValueDistribution(t *testing.T, driver string) {
+	c := newTestChain()
+	db := newTestDB(t, driver)
+	for _, b := range []struct {
+		height int64
+		outs   []testOut
+	}{
+		{0, []testOut{{"miner", 5000000000}, {"A", 546}, {"A", 1000}}},
+		{1, []testOut{{"miner", 5000000000}, {"A", 1001}, {"B", 200000000000}}},
+		{144, []testOut{{"miner", 100000000000}, {"A", 330}}},
+	} {
+		data, _ := c.block(b.height, 0, testTx{outs: b.outs})
+		storeBlocks(t, db, false, data)
+	}
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	for _, test := range []struct {
+		granularity string
+		want        []string
+	}{
+		{GranularityAll, []string{"01-01 00:00 0-144 8 [3 1 0 0 0 0 0 2 1 1] 310000002877"}},
+		{GranularityBlock, []string{
+			"01-01 00:00 0-0 3 [2 0 0 0 0 0 0 1 0 0] 5000001546",
+			"01-01 00:10 1-1 3 [0 1 0 0 0 0 0 1 0 1] 205000001001",
+			"01-02 00:00 144-144 2 [1 0 0 0 0 0 0 0 1 0] 100000000330",
+		}},
+		{GranularityDay, []string{
+			"01-01 00:00 0-1 6 [2 1 0 0 0 0 0 2 0 1] 210000002547",
+			"01-02 00:00 144-144 2 [1 0 0 0 0 0 0 0 1 0] 100000000330",
+		}},
+	} {
+		stats, err := db.GetOutputValueDistribution(from, to, test.granularity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range stats {
+			var counts []int64
+			var value int64
+			for _, b := range s.Buckets {
+				counts = append(counts, b.Count)
+				value += b.Value
+			}
+			got = append(got, fmt.Sprintf("%s %d-%d %d %v %d", s.Period.Format("01-02 15:04"), s.FromHeight, s.ToHeight,
+				s.Outputs, counts, value))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s:\n got %q\nwant %q", test.granularity, got, test.want)
+		}
+	}
+
+	if _, err := db.GetOutputValueDistribution(from, to, GranularityHour); err == nil {
+		t.Error("GetOutputValueDistribution() accepted hour granularity")
+	}
+}
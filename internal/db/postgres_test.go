@@ -0,0 +1,25 @@
+package db
+
+import "testing"
+
+func TestRebindPostgres(t *testing.T) {
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{`SELECT hash FROM blocks WHERE height = ? AND hash <> ?`, `SELECT hash FROM blocks WHERE height = $1 AND hash <> $2`},
+		{`SELECT 'why?', ? -- or not?
+		FROM blocks WHERE hash = 'it''s?' AND height = ?`, `SELECT 'why?', $1 -- or not?
+		FROM blocks WHERE hash = 'it''s?' AND height = $2`},
+		{`INSERT OR IGNORE INTO chain_breaks (height, block_hash) VALUES (?, ?)`,
+			`INSERT INTO chain_breaks (height, block_hash) VALUES ($1, $2) ON CONFLICT DO NOTHING`},
+		{`
+	INSERT OR IGNORE INTO metadata (name) VALUES ('profile');
+	`, `INSERT INTO metadata (name) VALUES ('profile') ON CONFLICT DO NOTHING`},
+		{`INSERT INTO metadata (name) VALUES (?) ON CONFLICT (name) DO NOTHING`,
+			`INSERT INTO metadata (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`},
+	} {
+		if got := rebindPostgres(tc.query); got != tc.want {
+			t.Errorf("rebindPostgres(%q) = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
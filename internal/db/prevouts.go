@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"time"
+)
+
+// resolveInputs sets the value and address of the unresolved inputs the
+// condition selects from the stored output each spends, which the query
+// calls po.
+const resolveInputs = `UPDATE tx_inputs
+SET value = po.value, address = po.address
+FROM tx_outputs po
+WHERE po.txid = tx_inputs.prev_txid AND po.vout = tx_inputs.prev_vout
+	AND tx_inputs.value IS NULL AND `
+
+// ResolveInputs fills the value and address of the inputs in
+// [fromHeight, toHeight] from the stored outputs they spend, without asking
+// the node. Inputs whose output isn't stored, because it was created
+// outside the scraped range, stay unresolved; so do inputs stored without a
+// height until the io-heights backfill gives them one.
+func (db *DB) ResolveInputs(fromHeight, toHeight int64) (int64, error) {
+	res, err := db.conn.Exec(resolveInputs+`tx_inputs.block_height BETWEEN ? AND ?`, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve inputs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ResolveBlockInputs resolves the inputs of the stored blocks at heights,
+// and the inputs stored before them that spend their outputs, like
+// ResolveInputs.
+func (db *DB) ResolveBlockInputs(ctx context.Context, heights []int64) error {
+	if len(heights) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(heights)), ", ")
+	args := make([]any, len(heights))
+	for i, height := range heights {
+		args[i] = height
+	}
+
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		for _, condition := range []string{
+			`tx_inputs.block_height IN (` + placeholders + `)`,
+			`po.block_height IN (` + placeholders + `)`,
+		} {
+			if _, err := tx.ExecContext(ctx, resolveInputs+condition, args...); err != nil {
+				return fmt.Errorf("failed to resolve inputs: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetInputResolution counts, per day, the stored inputs whose value and
+// address are resolved, those that can be once their outputs are looked up,
+// and those whose outputs aren't stored.
+func (db *DB) GetInputResolution(from, to time.Time) ([]*models.InputResolution, error) {
+	query := `SELECT
+		date_trunc('day', t.timestamp) AS day,
+		COUNT(*),
+		COUNT(i.value),
+		COUNT(*) FILTER (WHERE i.value IS NULL AND po.txid IS NOT NULL),
+		COUNT(*) FILTER (WHERE i.value IS NULL AND po.txid IS NULL)
+	FROM tx_inputs i
+	JOIN transactions t ON t.txid = i.txid_spending
+	LEFT JOIN tx_outputs po ON po.txid = i.prev_txid AND po.vout = i.prev_vout
+	WHERE t.timestamp >= ? AND t.timestamp < ?
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.InputResolution
+	for rows.Next() {
+		s := &models.InputResolution{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Inputs, &s.Resolved, &s.Resolvable, &s.Missing); err != nil {
+			return nil, err
+		}
+		if s.Inputs > 0 {
+			s.Percent = float64(s.Resolved) / float64(s.Inputs) * 100
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+)
+
+func TestResolveInputs(t *testing.T) {
+	forEachDriver(t, testResolveInputs)
+}
+
+// testResolveInputs stores block 3, spending an output of block 2 and one
+// created outside the scraped range, before block 2, which spends an
+// output of block 1. Inputs are resolved as blocks are stored in one
+// database, and by a backfill afterwards in the other.
+func testResolveInputs(t *testing.T, driver string) {
+	ctx := context.Background()
+	c := newTestChain()
+	block1, outs1 := c.block(1, 0, testTx{outs: []testOut{{"A", 5000}, {"B", 3000}}})
+	block2, outs2 := c.block(2, 0, testTx{outs: []testOut{{"miner", 5000}}},
+		testTx{ins: []*models.TxOutput{outs1[0][0]}, outs: []testOut{{"C", 4000}}})
+	foreign := &models.TxOutput{Txid: fmt.Sprintf("%064x", 999), Vout: 1}
+	block3, _ := c.block(3, 0, testTx{outs: []testOut{{"miner", 5000}}},
+		testTx{ins: []*models.TxOutput{outs2[1][0], foreign}, outs: []testOut{{"D", 3500}}})
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 1)
+
+	check := func(t *testing.T, db *DB, wantInputs []string, wantResolution string) {
+		t.Helper()
+		rows, err := db.conn.Query(`SELECT prev_vout, value, address FROM tx_inputs ORDER BY block_height, vout`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var inputs []string
+		for rows.Next() {
+			var vout int
+			var value *int64
+			var address *string
+			if err := rows.Scan(&vout, &value, &address); err != nil {
+				t.Fatal(err)
+			}
+			if value == nil {
+				inputs = append(inputs, fmt.Sprintf("%d:-", vout))
+			} else {
+				inputs = append(inputs, fmt.Sprintf("%d:%d %s", vout, *value, *address))
+			}
+		}
+		if !slices.Equal(inputs, wantInputs) {
+			t.Errorf("inputs %q, want %q", inputs, wantInputs)
+		}
+
+		days, err := db.GetInputResolution(from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, d := range days {
+			got += fmt.Sprintf("%s %d %d %d %d %.1f", d.Day.Format("01-02"), d.Inputs, d.Resolved, d.Resolvable, d.Missing, d.Percent)
+		}
+		if got != wantResolution {
+			t.Errorf("input resolution %q, want %q", got, wantResolution)
+		}
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		db := newTestDB(t, driver)
+		for _, data := range []*models.BlockData{block1, block3, block2} {
+			storeBlocks(t, db, false, data)
+			if err := db.ResolveBlockInputs(ctx, []int64{data.Block.Height}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		check(t, db, []string{"0:5000 A", "0:4000 C", "1:-"}, "01-01 3 2 0 1 66.7")
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		db := newTestDB(t, driver)
+		storeBlocks(t, db, false, block1, block3, block2)
+		check(t, db, []string{"0:-", "0:-", "1:-"}, "01-01 3 0 2 1 0.0")
+		resolved, err := db.ResolveInputs(1, 2)
+		if err != nil || resolved != 1 {
+			t.Errorf("ResolveInputs(1, 2) = %d, %v, want 1", resolved, err)
+		}
+		if resolved, err = db.ResolveInputs(1, 3); err != nil || resolved != 1 {
+			t.Errorf("ResolveInputs(1, 3) = %d, %v, want the 1 input left", resolved, err)
+		}
+		check(t, db, []string{"0:5000 A", "0:4000 C", "1:-"}, "01-01 3 2 0 1 66.7")
+	})
+}
@@ -0,0 +1,378 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"scrapbtc/pkg/models"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CreatePriceJoinView creates or updates the block_prices view, which
+// attaches the nearest price to each block. It only stores the query, so
+// it stays current as blocks and prices are added.
+func (db *DB) CreatePriceJoinView() error {
+	if _, err := db.conn.Exec(db.dialect.blockPricesView); err != nil {
+		return fmt.Errorf("failed to create block_prices view: %w", err)
+	}
+	return nil
+}
+
+// GetUSDVolumeByDay returns the value of the non-coinbase transaction
+// outputs, the fees and the miner revenue per day in the given time range.
+// Each block is valued at its GetPricesAt price or, where the price points
+// around it are further apart, at the latest point at or before it or the
+// next one within 24 hours, as matched by block_prices.
+func (db *DB) GetUSDVolumeByDay(from, to time.Time) ([]*models.USDVolume, error) {
+	rows, err := db.conn.Query(`WITH volume AS (
+		SELECT block_height, CAST(SUM(output_value) AS BIGINT) AS output_value
+		FROM transactions
+		WHERE timestamp >= ? AND timestamp < ? AND NOT is_coinbase
+		GROUP BY block_height
+	)
+	SELECT b.timestamp, CAST(COALESCE(v.output_value, 0) AS BIGINT), COALESCE(b.total_fees, 0), COALESCE(b.coinbase_value, 0)
+	FROM blocks b
+	LEFT JOIN volume v ON v.block_height = b.height
+	WHERE b.timestamp >= ? AND b.timestamp < ?
+	ORDER BY b.timestamp, b.height`, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type blockValues struct {
+		timestamp                       time.Time
+		outputValue, fees, minerRevenue int64
+	}
+	var blocks []blockValues
+	var times []time.Time
+	for rows.Next() {
+		var b blockValues
+		if err := rows.Scan(&b.timestamp, &b.outputValue, &b.fees, &b.minerRevenue); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+		times = append(times, b.timestamp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	points, err := db.pricePointsAround(times)
+	if err != nil {
+		return nil, err
+	}
+	gap := db.maxPriceGap()
+	var volumes []*models.USDVolume
+	for _, b := range blocks {
+		t := b.timestamp.UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if len(volumes) == 0 || !volumes[len(volumes)-1].Day.Equal(day) {
+			volumes = append(volumes, &models.USDVolume{Day: day})
+		}
+		v := volumes[len(volumes)-1]
+		v.Blocks++
+		v.OutputValue += b.outputValue
+		v.Fees += b.fees
+		v.MinerRevenue += b.minerRevenue
+
+		price := interpolatePrice(points, t, gap)
+		if price == nil {
+			price = latestPrice(points, t, 24*time.Hour)
+		}
+		if price == nil {
+			continue
+		}
+		v.PricedBlocks++
+		v.OutputValueUSD += float64(b.outputValue) * price.Price / 1e8
+		v.FeesUSD += float64(b.fees) * price.Price / 1e8
+		v.MinerRevenueUSD += float64(b.minerRevenue) * price.Price / 1e8
+	}
+
+	return volumes, nil
+}
+
+// DefaultMaxPriceGap is how far apart the price points around a time may be
+// for GetPriceAt to interpolate between them.
+const DefaultMaxPriceGap = 6 * time.Hour
+
+// ErrPriceGap is returned by GetPriceAt for a time without a price point,
+// when the points around it are further apart than the maximum gap or
+// there is none on one side.
+var ErrPriceGap = errors.New("the price points around the time are too far apart")
+
+// SetMaxPriceGap sets how far apart the price points around a time may be
+// for GetPriceAt and GetPricesAt to interpolate between them. 0 restores
+// DefaultMaxPriceGap.
+func (db *DB) SetMaxPriceGap(gap time.Duration) {
+	db.priceGap = gap
+}
+
+func (db *DB) maxPriceGap() time.Duration {
+	if db.priceGap > 0 {
+		return db.priceGap
+	}
+	return DefaultMaxPriceGap
+}
+
+// GetPriceAt returns the price point at t or, without one, the price, market
+// cap and volume interpolated linearly between the points before and after
+// t, with the source and fetch time of the nearer one. It returns
+// ErrPriceGap when these are further apart than the maximum gap.
+func (db *DB) GetPriceAt(t time.Time) (models.PriceData, error) {
+	prices, err := db.GetPricesAt([]time.Time{t})
+	if err != nil {
+		return models.PriceData{}, err
+	}
+	if prices[0] == nil {
+		return models.PriceData{}, fmt.Errorf("no price at %s: %w", t.UTC().Format(time.RFC3339), ErrPriceGap)
+	}
+	return *prices[0], nil
+}
+
+// GetPricesAt returns the GetPriceAt price at each of times, in the same
+// order, or nil for the times in a gap. The price points around them are
+// read in a single query.
+func (db *DB) GetPricesAt(times []time.Time) ([]*models.PriceData, error) {
+	points, err := db.pricePointsAround(times)
+	if err != nil {
+		return nil, err
+	}
+	gap := db.maxPriceGap()
+	prices := make([]*models.PriceData, len(times))
+	for i, t := range times {
+		prices[i] = interpolatePrice(points, t, gap)
+	}
+	return prices, nil
+}
+
+// pricePointsAround returns the price points from the last one at or before
+// the earliest of times to the first one at or after the latest, ordered by
+// timestamp.
+func (db *DB) pricePointsAround(times []time.Time) ([]*models.PriceData, error) {
+	if len(times) == 0 {
+		return nil, nil
+	}
+	first := slices.MinFunc(times, time.Time.Compare)
+	last := slices.MaxFunc(times, time.Time.Compare)
+	rows, err := db.conn.Query(`SELECT timestamp, price, COALESCE(market_cap, 0), COALESCE(volume_24h, 0), source, fetched_at
+	FROM price_data
+	WHERE timestamp >= COALESCE((SELECT MAX(timestamp) FROM price_data WHERE timestamp <= ?), ?)
+		AND timestamp <= COALESCE((SELECT MIN(timestamp) FROM price_data WHERE timestamp >= ?), ?)
+	ORDER BY timestamp`, first, first, last, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*models.PriceData
+	for rows.Next() {
+		p := &models.PriceData{}
+		if err := rows.Scan(&p.Timestamp, &p.Price, &p.MarketCap, &p.Volume24h, &p.Source, &p.FetchedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// interpolatePrice returns the GetPriceAt price at t from the ordered
+// points around it, or nil.
+func interpolatePrice(points []*models.PriceData, t time.Time, gap time.Duration) *models.PriceData {
+	i := sort.Search(len(points), func(i int) bool { return !points[i].Timestamp.Before(t) })
+	if i < len(points) && points[i].Timestamp.Equal(t) {
+		p := *points[i]
+		return &p
+	}
+	if i == 0 || i == len(points) {
+		return nil
+	}
+	before, after := points[i-1], points[i]
+	span := after.Timestamp.Sub(before.Timestamp)
+	if span > gap {
+		return nil
+	}
+	f := float64(t.Sub(before.Timestamp)) / float64(span)
+	nearer := before
+	if f > 0.5 {
+		nearer = after
+	}
+	lerp := func(a, b int64) int64 { return a + int64(math.Round(float64(b-a)*f)) }
+	return &models.PriceData{
+		Timestamp: t,
+		Price:     before.Price + (after.Price-before.Price)*f,
+		MarketCap: lerp(before.MarketCap, after.MarketCap),
+		Volume24h: lerp(before.Volume24h, after.Volume24h),
+		Source:    nearer.Source,
+		FetchedAt: nearer.FetchedAt,
+	}
+}
+
+// latestPrice returns the last of the ordered points at or before t, or
+// else the first one after it, as long as it is within window of t.
+func latestPrice(points []*models.PriceData, t time.Time, window time.Duration) *models.PriceData {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Timestamp.After(t) })
+	if i > 0 && t.Sub(points[i-1].Timestamp) <= window {
+		return points[i-1]
+	}
+	if i < len(points) && points[i].Timestamp.Sub(t) <= window {
+		return points[i]
+	}
+	return nil
+}
+
+// GetDailyPrices returns the average of the price points of each day in
+// [from, to) that has any.
+func (db *DB) GetDailyPrices(from, to time.Time) ([]*models.DailyPrice, error) {
+	rows, err := db.conn.Query(`SELECT date_trunc('day', timestamp) AS day, AVG(price)
+	FROM price_data
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY day
+	ORDER BY day`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []*models.DailyPrice
+	for rows.Next() {
+		p := &models.DailyPrice{}
+		if err := rows.Scan(scanTime(&p.Day), &p.Price); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+
+	return prices, rows.Err()
+}
+
+// selectPriceOHLC buckets the price points by the date_trunc part of its
+// argument. The window runs over the whole bucket so that every row of it
+// carries the first and last price.
+const selectPriceOHLC = `
+WITH points AS (
+	SELECT
+		date_trunc('%s', timestamp) AS period,
+		price,
+		COALESCE(volume_24h, 0) AS volume,
+		first_value(price) OVER w AS open,
+		last_value(price) OVER w AS close
+	FROM price_data
+	WHERE timestamp >= ? AND timestamp < ?
+	WINDOW w AS (PARTITION BY date_trunc('%[1]s', timestamp) ORDER BY timestamp
+		ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING)
+)
+SELECT
+	period,
+	MIN(open),
+	MAX(price),
+	MIN(price),
+	MIN(close),
+	CAST(SUM(volume) AS BIGINT),
+	COUNT(*)
+FROM points
+GROUP BY period
+ORDER BY period`
+
+// GetPriceOHLC returns the open, high, low and close price and the volume
+// of the price points in [from, to) per hour, day, week or month. Periods
+// start at UTC boundaries and weeks on Monday; a period with one point has
+// it as all four prices, and periods without points are left out.
+func (db *DB) GetPriceOHLC(from, to time.Time, granularity string) ([]*models.PriceOHLC, error) {
+	switch granularity {
+	case GranularityHour, GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return nil, fmt.Errorf("invalid granularity %q: must be hour, day, week or month", granularity)
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectPriceOHLC, granularity), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ohlc []*models.PriceOHLC
+	for rows.Next() {
+		p := &models.PriceOHLC{}
+		if err := rows.Scan(scanTime(&p.Period), &p.Open, &p.High, &p.Low, &p.Close, &p.Volume, &p.Points); err != nil {
+			return nil, err
+		}
+		ohlc = append(ohlc, p)
+	}
+
+	return ohlc, rows.Err()
+}
+
+// FindPriceGaps returns the stretches longer than maxGap between
+// consecutive price points, oldest first. Time before the first and after
+// the last point isn't reported.
+func (db *DB) FindPriceGaps(maxGap time.Duration) ([]*models.PriceGap, error) {
+	if maxGap <= 0 {
+		return nil, fmt.Errorf("invalid gap %s: must be positive", maxGap)
+	}
+
+	rows, err := db.conn.Query(`SELECT previous, timestamp, date_diff('second', previous, timestamp) AS seconds
+	FROM (
+		SELECT LAG(timestamp) OVER (ORDER BY timestamp) AS previous, timestamp
+		FROM price_data
+	) points
+	WHERE previous IS NOT NULL AND date_diff('second', previous, timestamp) > ?
+	ORDER BY timestamp`, int64(maxGap/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps []*models.PriceGap
+	for rows.Next() {
+		g := &models.PriceGap{}
+		if err := rows.Scan(scanTime(&g.From), scanTime(&g.To), &g.Seconds); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, g)
+	}
+
+	return gaps, rows.Err()
+}
+
+// ReplacePriceData replaces the price points of source in [from, to) with
+// prices, such as the settled history of a day with the estimates recorded
+// during it. Points of other sources are kept.
+func (db *DB) ReplacePriceData(ctx context.Context, source string, from, to time.Time, prices []*models.PriceData) error {
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		// Only points missing from prices are deleted: DuckDB fails to
+		// insert a key deleted in the same transaction, and the others are
+		// replaced by the insert
+		query := `DELETE FROM price_data WHERE source = ? AND timestamp >= ? AND timestamp < ?`
+		args := []any{source, from, to}
+		if len(prices) > 0 {
+			query += ` AND timestamp NOT IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(prices)), ", ") + `)`
+			for _, p := range prices {
+				args = append(args, p.Timestamp)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete price data: %w", err)
+		}
+
+		stmt, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO price_data (
+			timestamp, price, market_cap, volume_24h, source, fetched_at
+		) VALUES (?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		for _, p := range prices {
+			if _, err := stmt.ExecContext(ctx, p.Timestamp, p.Price, p.MarketCap, p.Volume24h, p.Source, p.FetchedAt); err != nil {
+				return fmt.Errorf("failed to insert price data: %w", err)
+			}
+		}
+		return nil
+	})
+}
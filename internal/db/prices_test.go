@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPriceOHLC(t *testing.T) {
+	forEachDriver(t, testPriceOHLC)
+}
+
+// testPriceOHLC stores four hourly prices on day 0, inserted out of order,
+// a single one on day 1 and one on day 4 after a gap of three days.
+func testPriceOHLC(t *testing.T, driver string) {
+	db := newTestDB(t, driver)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	var prices []*models.PriceData
+	for _, p := range []struct {
+		hours  int
+		price  float64
+		volume int64
+	}{
+		{2, 90, 30},
+		{0, 100, 10},
+		{1, 120, 20},
+		{3, 110, 40},
+		{30, 130, 5},
+		{100, 140, 0},
+	} {
+		prices = append(prices, &models.PriceData{Timestamp: at(p.hours), Price: p.price, Volume24h: p.volume, Source: "test", FetchedAt: start})
+	}
+	if err := db.InsertPriceDataBatch(prices); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		granularity string
+		want        []string
+	}{
+		{GranularityDay, []string{
+			"01-01 00:00 100 120 90 110 100 4",
+			"01-02 00:00 130 130 130 130 5 1",
+			"01-05 00:00 140 140 140 140 0 1",
+		}},
+		{GranularityHour, []string{
+			"01-01 00:00 100 100 100 100 10 1",
+			"01-01 01:00 120 120 120 120 20 1",
+			"01-01 02:00 90 90 90 90 30 1",
+			"01-01 03:00 110 110 110 110 40 1",
+			"01-02 06:00 130 130 130 130 5 1",
+		}},
+		{GranularityWeek, []string{
+			"01-01 00:00 100 140 90 140 105 6",
+		}},
+	} {
+		to := at(48)
+		if test.granularity != GranularityHour {
+			to = at(24 * 7)
+		}
+		ohlc, err := db.GetPriceOHLC(start, to, test.granularity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range ohlc {
+			got = append(got, fmt.Sprintf("%s %g %g %g %g %d %d", p.Period.UTC().Format("01-02 15:04"), p.Open, p.High, p.Low, p.Close, p.Volume, p.Points))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s:\n got %q\nwant %q", test.granularity, got, test.want)
+		}
+	}
+	if _, err := db.GetPriceOHLC(start, at(48), GranularityBlock); err == nil {
+		t.Error("GetPriceOHLC() accepted block granularity")
+	}
+
+	for _, test := range []struct {
+		maxGap time.Duration
+		want   []string
+	}{
+		{time.Hour, []string{"01-01 03:00 01-02 06:00 97200", "01-02 06:00 01-05 04:00 252000"}},
+		{48 * time.Hour, []string{"01-02 06:00 01-05 04:00 252000"}},
+		{70 * time.Hour, nil},
+	} {
+		gaps, err := db.FindPriceGaps(test.maxGap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, g := range gaps {
+			got = append(got, fmt.Sprintf("%s %s %d", g.From.UTC().Format("01-02 15:04"), g.To.UTC().Format("01-02 15:04"), g.Seconds))
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("gaps over %s:\n got %q\nwant %q", test.maxGap, got, test.want)
+		}
+	}
+}
+
+func TestReplacePriceData(t *testing.T) {
+	forEachDriver(t, testReplacePriceData)
+}
+
+// testReplacePriceData replaces the estimates of day 0 of one source, one
+// of them at the time of a settled point, keeping the point of another
+// source and the next day's estimate.
+func testReplacePriceData(t *testing.T, driver string) {
+	db := newTestDB(t, driver)
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	point := func(minutes int, price float64, source string) *models.PriceData {
+		return &models.PriceData{Timestamp: day.Add(time.Duration(minutes) * time.Minute), Price: price, Source: source, FetchedAt: day}
+	}
+	if err := db.InsertPriceDataBatch([]*models.PriceData{
+		point(570, 1, "csv"),
+		point(605, 2, "live"),
+		point(660, 3, "live"),
+		point(1445, 4, "live"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	settled := []*models.PriceData{point(600, 10, "live"), point(660, 11, "live")}
+	for range 2 {
+		if err := db.ReplacePriceData(context.Background(), "live", day, day.AddDate(0, 0, 1), settled); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prices, err := db.GetPriceData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range prices {
+		got = append(got, fmt.Sprintf("%s %g %s", p.Timestamp.UTC().Format("01-02 15:04"), p.Price, p.Source))
+	}
+	want := []string{"01-01 09:30 1 csv", "01-01 10:00 10 live", "01-01 11:00 11 live", "01-02 00:05 4 live"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestPriceAt(t *testing.T) {
+	forEachDriver(t, testPriceAt)
+}
+
+// testPriceAt stores points at hours 0 and 4, and at hour 20 after a gap
+// longer than the default maximum of 6 hours.
+func testPriceAt(t *testing.T, driver string) {
+	db := newTestDB(t, driver)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	if err := db.InsertPriceDataBatch([]*models.PriceData{
+		{Timestamp: at(0), Price: 100, MarketCap: 1000, Volume24h: 10, Source: "a", FetchedAt: at(0)},
+		{Timestamp: at(240), Price: 200, MarketCap: 3000, Volume24h: 20, Source: "b", FetchedAt: at(240)},
+		{Timestamp: at(1200), Price: 300, MarketCap: 5000, Volume24h: 30, Source: "b", FetchedAt: at(1200)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	format := func(p models.PriceData) string {
+		return fmt.Sprintf("%s %g %d %d %s", p.Timestamp.UTC().Format("15:04"), p.Price, p.MarketCap, p.Volume24h, p.Source)
+	}
+
+	for _, test := range []struct {
+		minutes int
+		want    string
+	}{
+		// Exact hits, even next to a gap
+		{0, "00:00 100 1000 10 a"},
+		{1200, "20:00 300 5000 30 b"},
+		// A quarter and three quarters of the way, from the nearer source
+		{60, "01:00 125 1500 13 a"},
+		{180, "03:00 175 2500 18 b"},
+		// Outside the points and in the gap
+		{-1, ""},
+		{1201, ""},
+		{600, ""},
+	} {
+		p, err := db.GetPriceAt(at(test.minutes))
+		if test.want == "" {
+			if !errors.Is(err, ErrPriceGap) {
+				t.Errorf("GetPriceAt(%d min) = %s, %v, want ErrPriceGap", test.minutes, format(p), err)
+			}
+			continue
+		}
+		if err != nil || format(p) != test.want {
+			t.Errorf("GetPriceAt(%d min) = %s, %v, want %s", test.minutes, format(p), err, test.want)
+		}
+	}
+
+	// Out of order in one pass, with a gap wide enough for hours 4 to 20
+	db.SetMaxPriceGap(16 * time.Hour)
+	prices, err := db.GetPricesAt([]time.Time{at(720), at(-60), at(60)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 3 || prices[0] == nil || prices[1] != nil || prices[2] == nil ||
+		format(*prices[0]) != "12:00 250 4000 25 b" || format(*prices[2]) != "01:00 125 1500 13 a" {
+		t.Errorf("GetPricesAt() = %v, want hours 12 and 1 priced", prices)
+	}
+	if prices, err := db.GetPricesAt(nil); err != nil || len(prices) != 0 {
+		t.Errorf("GetPricesAt(nil) = %v, %v", prices, err)
+	}
+}
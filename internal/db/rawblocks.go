@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The encoder and decoder are safe for concurrent EncodeAll and DecodeAll
+// calls, so every worker shares them.
+var (
+	rawEncoder, _ = zstd.NewWriter(nil)
+	rawDecoder, _ = zstd.NewReader(nil)
+)
+
+// CompressRawBlock returns the zstd compressed form raw blocks are archived in.
+func CompressRawBlock(data []byte) []byte {
+	return rawEncoder.EncodeAll(data, nil)
+}
+
+func decompressRawBlock(data []byte) ([]byte, error) {
+	raw, err := rawDecoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress raw block: %w", err)
+	}
+	return raw, nil
+}
+
+func (db *DB) InsertRawBlock(ctx context.Context, block *models.RawBlock) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT OR REPLACE INTO raw_blocks (
+		block_height, block_hash, size_bytes, data
+	) VALUES (?, ?, ?, ?)`, block.Height, block.Hash, int64(len(block.Data)), CompressRawBlock(block.Data))
+	return err
+}
+
+// GetRawBlock returns the archived raw block at height, or sql.ErrNoRows if
+// it wasn't stored.
+func (db *DB) GetRawBlock(height int64) (*models.RawBlock, error) {
+	block := &models.RawBlock{Height: height}
+	var data []byte
+	err := db.conn.QueryRow(`SELECT block_hash, size_bytes, data FROM raw_blocks WHERE block_height = ?`,
+		height).Scan(&block.Hash, &block.SizeBytes, &data)
+	if err != nil {
+		return nil, err
+	}
+	if block.Data, err = decompressRawBlock(data); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// rawBlockFile is the path of the archived block at height under dir.
+func rawBlockFile(dir string, height int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.blk.zst", height))
+}
+
+// WriteRawBlockFile archives a raw block as a zstd compressed file under dir.
+// The file is written under a temporary name and renamed so a crash never
+// leaves a truncated block behind.
+func WriteRawBlockFile(dir string, block *models.RawBlock) error {
+	path := rawBlockFile(dir, block.Height)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, CompressRawBlock(block.Data), 0o644); err != nil {
+		return fmt.Errorf("failed to write raw block %d: %w", block.Height, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write raw block %d: %w", block.Height, err)
+	}
+	return nil
+}
+
+// ReadRawBlockFile reads a block archived by WriteRawBlockFile. The file
+// doesn't record the hash, so Hash is left empty. It returns an error
+// satisfying os.IsNotExist if the block wasn't archived.
+func ReadRawBlockFile(dir string, height int64) (*models.RawBlock, error) {
+	data, err := os.ReadFile(rawBlockFile(dir, height))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := decompressRawBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RawBlock{Height: height, SizeBytes: int64(len(raw)), Data: raw}, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marcboeker/go-duckdb"
+)
+
+// remoteSchemes are the URL schemes of the database files DuckDB reads with
+// its httpfs extension.
+var remoteSchemes = []string{"s3://", "https://", "http://"}
+
+// IsRemote reports whether path is the URL of a remote database file rather
+// than a local path.
+func IsRemote(path string) bool {
+	for _, scheme := range remoteSchemes {
+		if strings.HasPrefix(strings.ToLower(path), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteOptions are the S3 settings of a remote database. Empty fields keep
+// DuckDB's defaults.
+type RemoteOptions struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint is the host, or the http(s) URL, of an S3 compatible
+	// service other than AWS, which is addressed in path style.
+	Endpoint string
+}
+
+// RemoteOptionsFromEnv reads the RemoteOptions from the standard AWS
+// environment variables.
+func RemoteOptionsFromEnv() RemoteOptions {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return RemoteOptions{
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+}
+
+// settings returns the statements applying o to a connection.
+func (o RemoteOptions) settings() []string {
+	var settings []string
+	set := func(name, value string) {
+		if value != "" {
+			settings = append(settings, "SET "+name+" = "+quoteLiteral(value))
+		}
+	}
+	set("s3_region", o.Region)
+	set("s3_access_key_id", o.AccessKeyID)
+	set("s3_secret_access_key", o.SecretAccessKey)
+	set("s3_session_token", o.SessionToken)
+	if o.Endpoint != "" {
+		endpoint := strings.TrimPrefix(o.Endpoint, "https://")
+		if plain := strings.TrimPrefix(endpoint, "http://"); plain != endpoint {
+			endpoint = plain
+			settings = append(settings, "SET s3_use_ssl = false")
+		}
+		set("s3_endpoint", strings.TrimSuffix(endpoint, "/"))
+		set("s3_url_style", "path")
+	}
+	return settings
+}
+
+// remoteAlias is the name the remote database is attached as.
+const remoteAlias = "remote"
+
+// NewRemoteDB opens the DuckDB database file at url read-only, through the
+// httpfs extension, which is installed on first use. Only the pages the
+// queries need are fetched.
+func NewRemoteDB(url string, opts RemoteOptions) (*DB, error) {
+	setup := append([]string{`INSTALL httpfs`, `LOAD httpfs`}, opts.settings()...)
+	db, err := openAttached(url, remoteAlias, setup, `USE `+remoteAlias)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open remote database %s: %w", url, err)
+	}
+	return db, nil
+}
+
+// openAttached attaches the database file at path read-only as alias to an
+// in-memory database on every connection, after running the setup
+// statements, and then runs scope, which makes its tables readable without
+// the alias, so that queries read it like a database opened from the file.
+func openAttached(path, alias string, setup []string, scope string) (*DB, error) {
+	statements := append(setup,
+		`ATTACH IF NOT EXISTS `+quoteLiteral(path)+` AS `+alias+` (READ_ONLY)`,
+		scope,
+	)
+	connector, err := duckdb.NewConnector("", func(execer driver.ExecerContext) error {
+		for _, query := range statements {
+			if _, err := execer.ExecContext(context.Background(), query, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn := sql.OpenDB(connector)
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &DB{conn: conn, driver: DriverDuckDB, dialect: duckdbDialect, readOnly: true}, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestIsRemote(t *testing.T) {
+	for path, want := range map[string]bool{
+		"s3://bucket/btc.db":           true,
+		"https://example.com/btc.db":   true,
+		"HTTP://example.com/btc.db":    true,
+		"bitcoin_data.db":              false,
+		"/data/s3://btc.db":            false,
+		MemoryPath:                     false,
+		"file:///data/bitcoin_data.db": false,
+		"gs://bucket/btc.db":           false,
+	} {
+		if got := IsRemote(path); got != want {
+			t.Errorf("IsRemote(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	if _, err := Open(DriverSQLite, "s3://bucket/btc.db", true); err == nil {
+		t.Error("opened a remote SQLite database")
+	}
+	if _, err := Open(DriverDuckDB, "s3://bucket/btc.db", false); err == nil {
+		t.Error("opened a remote database for writing")
+	}
+}
+
+func TestRemoteSettings(t *testing.T) {
+	opts := RemoteOptions{Region: "eu-west-1", AccessKeyID: "key", SecretAccessKey: "it's secret", Endpoint: "http://minio:9000/"}
+	want := []string{
+		"SET s3_region = 'eu-west-1'",
+		"SET s3_access_key_id = 'key'",
+		"SET s3_secret_access_key = 'it''s secret'",
+		"SET s3_use_ssl = false",
+		"SET s3_endpoint = 'minio:9000'",
+		"SET s3_url_style = 'path'",
+	}
+	if got := opts.settings(); !slices.Equal(got, want) {
+		t.Errorf("settings() =\n%q\nwant\n%q", got, want)
+	}
+	if got := (RemoteOptions{}).settings(); len(got) != 0 {
+		t.Errorf("settings() of the defaults = %q, want none", got)
+	}
+}
+
+// TestOpenAttached reads a local database the way a remote one is read,
+// attached to an in-memory database, from several connections at once.
+func TestOpenAttached(t *testing.T) {
+	c := newTestChain()
+	b1, coinbase := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000}}})
+	b2, _ := c.block(2, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: coinbase[0], outs: []testOut{{"A", 4900}}})
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	store, err := Open(DriverDuckDB, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := store.(*DB)
+	storeBlocks(t, local, false, b1, b2)
+	if err := local.SetMetadata(MetadataProfile, "full"); err != nil {
+		t.Fatal(err)
+	}
+	want, err := local.GetTopAddresses(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local.Close()
+
+	db, err := openAttached(path, remoteAlias, nil, `USE `+remoteAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if !db.ReadOnly() {
+		t.Error("the attached database isn't read-only")
+	}
+	if profile, err := db.GetMetadata(MetadataProfile); err != nil || profile != "full" {
+		t.Errorf("GetMetadata(profile) = %q, %v, want full", profile, err)
+	}
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := db.GetTopAddresses(10)
+			if err != nil {
+				t.Error(err)
+			} else if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetTopAddresses() = %v, want %v", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := db.conn.Exec(`DELETE FROM blocks`); err == nil {
+		t.Error("deleted from the attached database")
+	}
+}
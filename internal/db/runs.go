@@ -0,0 +1,149 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// ErrRunInProgress is returned by StartRun when another run is recorded as
+// running.
+var ErrRunInProgress = errors.New("another run is recorded as running")
+
+// StartRun records a run as running and returns its id. Unless force is
+// set it fails with ErrRunInProgress if another run is running: the check
+// and the insert are one transaction, so of two runs starting at once only
+// one is recorded.
+func (db *DB) StartRun(run *models.Run, force bool) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !force {
+		var running int64
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM runs WHERE status = ?`, models.RunRunning).Scan(&running); err != nil {
+			return 0, fmt.Errorf("failed to check for running runs: %w", err)
+		}
+		if running > 0 {
+			return 0, ErrRunInProgress
+		}
+	}
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO runs (
+		started_at, from_height, to_height, status, version, args, hostname, pid, filters
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	RETURNING run_id`,
+		run.StartedAt, run.FromHeight, run.ToHeight, models.RunRunning,
+		run.Version, run.Args, run.Hostname, run.PID, run.Filters).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	return id, nil
+}
+
+// FinishRun records the outcome of a run.
+func (db *DB) FinishRun(id int64, status string, processed, failed int64, errMsg string) error {
+	_, err := db.conn.Exec(`UPDATE runs
+	SET finished_at = ?, status = ?, blocks_processed = ?, blocks_failed = ?, error = NULLIF(?, '')
+	WHERE run_id = ?`, models.Now(), status, processed, failed, errMsg, id)
+	if err != nil {
+		return fmt.Errorf("failed to record end of run %d: %w", id, err)
+	}
+	return nil
+}
+
+// GetRuns returns the latest limit runs, newest first, optionally only
+// those with the given status. A limit of zero or less returns all of them.
+func (db *DB) GetRuns(status string, limit int) ([]*models.Run, error) {
+	query := `SELECT run_id, started_at, finished_at, from_height, to_height,
+		blocks_processed, blocks_failed, status, COALESCE(error, ''),
+		version, args, hostname, pid, COALESCE(filters, '')
+	FROM runs
+	WHERE ? = '' OR status = ?
+	ORDER BY run_id DESC`
+	args := []any{status, status}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.Run
+	for rows.Next() {
+		r := &models.Run{}
+		var finished sql.NullTime
+		if err := rows.Scan(&r.ID, &r.StartedAt, &finished, &r.FromHeight, &r.ToHeight,
+			&r.BlocksProcessed, &r.BlocksFailed, &r.Status, &r.Error,
+			&r.Version, &r.Args, &r.Hostname, &r.PID, &r.Filters); err != nil {
+			return nil, err
+		}
+		if finished.Valid {
+			r.FinishedAt = &finished.Time
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
+
+// SaveRunProgress records p as the latest progress snapshot of its run.
+func (db *DB) SaveRunProgress(p *models.RunProgress) error {
+	_, err := db.conn.Exec(`INSERT INTO run_progress (run_id, processed, failed, total_txs, rate, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (run_id) DO UPDATE SET
+		processed = excluded.processed,
+		failed = excluded.failed,
+		total_txs = excluded.total_txs,
+		rate = excluded.rate,
+		updated_at = excluded.updated_at`,
+		p.RunID, p.Processed, p.Failed, p.TotalTxs, p.Rate, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record progress of run %d: %w", p.RunID, err)
+	}
+	return nil
+}
+
+// GetRunProgress returns the latest progress snapshot of run runID, or of
+// the latest run that has one if runID is zero, along with the status and
+// range of the run. It returns nil if there is none.
+func (db *DB) GetRunProgress(runID int64) (*models.RunProgress, error) {
+	if db.readOnly {
+		// Read-only databases aren't migrated, so they may predate the table
+		var tables int
+		if err := db.conn.QueryRow(db.dialect.tableExists, "run_progress").Scan(&tables); err != nil {
+			return nil, fmt.Errorf("failed to look for the run_progress table: %w", err)
+		}
+		if tables == 0 {
+			return nil, nil
+		}
+	}
+
+	p := &models.RunProgress{}
+	err := db.conn.QueryRow(`SELECT p.run_id, p.processed, p.failed, p.total_txs, p.rate, p.updated_at,
+		r.status, r.from_height, r.to_height
+	FROM run_progress p
+	JOIN runs r ON r.run_id = p.run_id
+	WHERE ? = 0 OR p.run_id = ?
+	ORDER BY p.run_id DESC
+	LIMIT 1`, runID, runID).Scan(&p.RunID, &p.Processed, &p.Failed, &p.TotalTxs, &p.Rate, scanTime(&p.UpdatedAt),
+		&p.Status, &p.FromHeight, &p.ToHeight)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress of run %d: %w", runID, err)
+	}
+	return p, nil
+}
@@ -9,40 +9,71 @@ const (
 		size INTEGER NOT NULL,
 		weight INTEGER NOT NULL,
 		tx_count INTEGER NOT NULL,
+		-- Transactions counted in tx_count but not stored, left out by the
+		-- --min-output-value and --skip-dust filters
+		filtered_tx_count INTEGER DEFAULT 0,
 		previous_block_hash VARCHAR,
 		merkle_root VARCHAR NOT NULL,
 		nonce BIGINT NOT NULL,
 		bits VARCHAR NOT NULL,
 		difficulty DOUBLE NOT NULL,
+		coinbase_value BIGINT NOT NULL DEFAULT 0,
+		subsidy BIGINT,
+		total_fees BIGINT NOT NULL DEFAULT 0,
+		-- NULL for blocks scraped before segwit usage was recorded
+		segwit_tx_count INTEGER,
+		witness_size BIGINT,
+		-- NULL for blocks scraped before miners were identified
+		coinbase_script VARCHAR,
+		miner_tag VARCHAR,
+		-- Decimal, as they overflow BIGINT. NULL for blocks scraped before
+		-- work was recorded, until the chainwork backfill
+		work VARCHAR,
+		chainwork VARCHAR,
 		processed_at TIMESTAMP NOT NULL
 	);`
 
 	CreateBlocksIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_blocks_height ON blocks(height);
 	CREATE INDEX IF NOT EXISTS idx_blocks_timestamp ON blocks(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_blocks_processed_at ON blocks(processed_at);
 	`
 
+	// CreateTransactionsTable keys transactions by block as well as txid:
+	// the coinbases of blocks 91842 and 91880 repeat the txids of those of
+	// blocks 91812 and 91722, which BIP30 forbids from then on.
 	CreateTransactionsTable = `
 	CREATE TABLE IF NOT EXISTS transactions (
-		txid VARCHAR PRIMARY KEY,
+		txid VARCHAR NOT NULL,
 		block_hash VARCHAR NOT NULL,
 		block_height BIGINT NOT NULL,
 		size INTEGER NOT NULL,
 		vsize INTEGER NOT NULL,
 		weight INTEGER NOT NULL,
 		fee BIGINT NOT NULL,
+		fee_rate DOUBLE DEFAULT 0,
+		is_coinbase BOOLEAN NOT NULL DEFAULT FALSE,
 		input_count INTEGER NOT NULL,
 		output_count INTEGER NOT NULL,
 		input_value BIGINT NOT NULL,
 		output_value BIGINT NOT NULL,
+		version INTEGER,
+		locktime BIGINT,
+		-- NULL for transactions scraped before RBF signaling was recorded
+		signals_rbf BOOLEAN,
+		-- models.TxCategory, NULL for transactions scraped before it was
+		-- recorded
+		tx_category VARCHAR,
 		timestamp TIMESTAMP NOT NULL,
-		processed_at TIMESTAMP NOT NULL
+		processed_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (txid, block_hash)
 	);`
 
 	CreateTransactionsIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_transactions_block_hash ON transactions(block_hash);
 	CREATE INDEX IF NOT EXISTS idx_transactions_block_height ON transactions(block_height);
 	CREATE INDEX IF NOT EXISTS idx_transactions_timestamp ON transactions(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_transactions_processed_at ON transactions(processed_at);
 	`
 
 	CreateTxInputsTable = `
@@ -51,17 +82,32 @@ const (
 		txid VARCHAR NOT NULL,
 		vout INTEGER NOT NULL,
 		script_sig VARCHAR,
-		sequence INTEGER NOT NULL,
+		sequence BIGINT NOT NULL,
 		prev_txid VARCHAR,
 		prev_vout INTEGER,
 		value BIGINT,
 		address VARCHAR,
-		txid_spending VARCHAR NOT NULL
+		txid_spending VARCHAR NOT NULL,
+		block_height BIGINT
 	);`
 
+	// CreateTxIOKeys provides ids and natural keys for inputs and outputs so
+	// that INSERT OR IGNORE deduplicates retried blocks.
+	CreateTxIOKeys = `
+	CREATE SEQUENCE IF NOT EXISTS tx_inputs_id_seq;
+	CREATE SEQUENCE IF NOT EXISTS tx_outputs_id_seq;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_inputs_outpoint ON tx_inputs(txid_spending, vout);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_outputs_outpoint ON tx_outputs(txid, vout);
+	`
+
+	// The height bucket indexes serve queries on buckets of 10000 blocks,
+	// e.g. WHERE block_height // 10000 = 80. Plain block_height ranges are
+	// pruned by DuckDB's per row group min/max statistics instead, as rows
+	// are appended roughly in height order.
 	CreateTxInputsIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_tx_inputs_txid ON tx_inputs(txid_spending);
 	CREATE INDEX IF NOT EXISTS idx_tx_inputs_prev ON tx_inputs(prev_txid, prev_vout);
+	CREATE INDEX IF NOT EXISTS idx_tx_inputs_height_bucket ON tx_inputs((block_height // 10000));
 	`
 
 	CreateTxOutputsTable = `
@@ -71,31 +117,35 @@ const (
 		vout INTEGER NOT NULL,
 		value BIGINT NOT NULL,
 		script_pub_key VARCHAR,
+		script_type VARCHAR,
 		address VARCHAR,
 		spent_txid VARCHAR,
-		spent_vout INTEGER
+		spent_vout INTEGER,
+		block_height BIGINT
 	);`
 
 	CreateTxOutputsIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_tx_outputs_txid ON tx_outputs(txid);
 	CREATE INDEX IF NOT EXISTS idx_tx_outputs_address ON tx_outputs(address);
-	CREATE INDEX IF NOT EXISTS idx_tx_outputs_spent ON tx_outputs(spent_txid, spent_vout);
+	CREATE INDEX IF NOT EXISTS idx_tx_outputs_height_bucket ON tx_outputs((block_height // 10000));
 	`
 
 	CreateProcessingStatusTable = `
 	CREATE TABLE IF NOT EXISTS processing_status (
 		block_height BIGINT PRIMARY KEY,
 		block_hash VARCHAR NOT NULL,
-		status VARCHAR NOT NULL CHECK (status IN ('processing', 'completed', 'failed')),
+		status VARCHAR NOT NULL CHECK (status IN ('processing', 'completed', 'failed', 'interrupted', 'headers_only')),
 		started_at TIMESTAMP NOT NULL,
 		completed_at TIMESTAMP,
-		error_message VARCHAR
+		error_message VARCHAR,
+		-- See models.BlockTiming. NULL until the block is stored, and for
+		-- blocks stored before they were recorded
+		rpc_fetch_ms BIGINT,
+		parse_ms BIGINT,
+		db_insert_ms BIGINT,
+		total_ms BIGINT
 	);`
 
-	CreateProcessingStatusIndexes = `
-	CREATE INDEX IF NOT EXISTS idx_processing_status_status ON processing_status(status);
-	`
-
 	CreatePriceDataTable = `
 	CREATE TABLE IF NOT EXISTS price_data (
 		timestamp TIMESTAMP PRIMARY KEY,
@@ -109,6 +159,381 @@ const (
 	CreatePriceDataIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_price_data_timestamp ON price_data(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_price_data_source ON price_data(source);
+	CREATE INDEX IF NOT EXISTS idx_price_data_fetched_at ON price_data(fetched_at);
+	`
+
+	CreateOpReturnOutputsTable = `
+	CREATE TABLE IF NOT EXISTS op_return_outputs (
+		txid VARCHAR NOT NULL,
+		vout INTEGER NOT NULL,
+		block_height BIGINT NOT NULL,
+		data_hex VARCHAR NOT NULL,
+		data_size INTEGER NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		PRIMARY KEY (txid, vout)
+	);`
+
+	CreateOpReturnOutputsIndexes = `
+	CREATE INDEX IF NOT EXISTS idx_op_return_outputs_block_height ON op_return_outputs(block_height);
+	CREATE INDEX IF NOT EXISTS idx_op_return_outputs_timestamp ON op_return_outputs(timestamp);
+	`
+
+	// CreateWatchedActivityTable records the outputs paying the addresses
+	// of --watch-addresses and the inputs spending them, by block so that
+	// a reorg drops those of the replaced block. n is the index of the
+	// output or input.
+	CreateWatchedActivityTable = `
+	CREATE TABLE IF NOT EXISTS watched_activity (
+		address VARCHAR NOT NULL,
+		txid VARCHAR NOT NULL,
+		n INTEGER NOT NULL,
+		direction VARCHAR NOT NULL,
+		value BIGINT NOT NULL,
+		block_hash VARCHAR NOT NULL,
+		block_height BIGINT NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		PRIMARY KEY (block_hash, txid, direction, n)
+	);`
+
+	// CreateAddressLabelsTable holds the imported labels of addresses, one
+	// per address.
+	CreateAddressLabelsTable = `
+	CREATE TABLE IF NOT EXISTS address_labels (
+		address VARCHAR PRIMARY KEY,
+		label VARCHAR NOT NULL,
+		category VARCHAR NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`
+
+	// addresses has no index on balance: the rollups are updated in place,
+	// which DuckDB refuses for indexed columns.
+	CreateAddressesTable = `
+	CREATE TABLE IF NOT EXISTS addresses (
+		address VARCHAR PRIMARY KEY,
+		first_seen_height BIGINT NOT NULL,
+		last_seen_height BIGINT NOT NULL,
+		total_received BIGINT NOT NULL,
+		total_sent BIGINT NOT NULL,
+		utxo_count BIGINT NOT NULL,
+		balance BIGINT NOT NULL
+	);`
+
+	// CreateAddressFirstSeenTable records the block each address first
+	// received an output in. Blocks are stored out of order, so a row may
+	// hold a later block until FinalizeAddressFirstSeen corrects it.
+	CreateAddressFirstSeenTable = `
+	CREATE TABLE IF NOT EXISTS address_first_seen (
+		address VARCHAR PRIMARY KEY,
+		first_seen_height BIGINT NOT NULL,
+		first_seen_time TIMESTAMP NOT NULL
+	);`
+
+	// CreateAddressStatsBlocksTable records which block was applied to the
+	// addresses table at each height, so retries are idempotent and a block
+	// replaced by a reorg can be subtracted again.
+	CreateAddressStatsBlocksTable = `
+	CREATE TABLE IF NOT EXISTS address_stats_blocks (
+		block_height BIGINT PRIMARY KEY,
+		block_hash VARCHAR NOT NULL
+	);`
+
+	CreateBlockMetricsTable = `
+	CREATE TABLE IF NOT EXISTS block_metrics (
+		block_height BIGINT PRIMARY KEY,
+		block_hash VARCHAR NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		coin_days_destroyed DOUBLE NOT NULL,
+		value_spent BIGINT NOT NULL,
+		computed_at TIMESTAMP NOT NULL
+	);`
+
+	CreateBlockMetricsIndexes = `
+	CREATE INDEX IF NOT EXISTS idx_block_metrics_timestamp ON block_metrics(timestamp);
+	`
+
+	// CreateDailyMetricsTable caches analysis.DailyMetrics. Tables from
+	// before the ratio inputs were added are dropped on open, see
+	// resetDailyMetrics.
+	CreateDailyMetricsTable = `
+	CREATE TABLE IF NOT EXISTS daily_metrics (
+		day TIMESTAMP PRIMARY KEY,
+		supply BIGINT NOT NULL,
+		realized_cap DOUBLE NOT NULL,
+		unpriced_supply BIGINT NOT NULL,
+		value_spent BIGINT NOT NULL,
+		sopr DOUBLE,
+		unpriced_spent BIGINT NOT NULL,
+		interpolated BOOLEAN NOT NULL,
+		computed_at TIMESTAMP NOT NULL,
+		price DOUBLE,
+		price_ma200 DOUBLE,
+		issued_supply BIGINT NOT NULL,
+		fees BIGINT NOT NULL,
+		subsidy BIGINT NOT NULL,
+		transferred_value BIGINT NOT NULL,
+		transferred_ex_change BIGINT NOT NULL
+	);`
+
+	CreateBackfillProgressTable = `
+	CREATE TABLE IF NOT EXISTS backfill_progress (
+		field VARCHAR NOT NULL,
+		from_height BIGINT NOT NULL,
+		to_height BIGINT NOT NULL,
+		last_height BIGINT NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (field, from_height, to_height)
+	);`
+
+	// CreateRunsTable records every scrape run. A run stays 'running' until
+	// it exits; hostname and pid identify the process holding it.
+	CreateRunsTable = `
+	CREATE SEQUENCE IF NOT EXISTS runs_id_seq;
+	CREATE TABLE IF NOT EXISTS runs (
+		run_id BIGINT PRIMARY KEY DEFAULT nextval('runs_id_seq'),
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		from_height BIGINT NOT NULL,
+		to_height BIGINT NOT NULL,
+		blocks_processed BIGINT NOT NULL DEFAULT 0,
+		blocks_failed BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR NOT NULL,
+		error VARCHAR,
+		version VARCHAR NOT NULL,
+		args VARCHAR NOT NULL,
+		hostname VARCHAR NOT NULL,
+		pid INTEGER NOT NULL,
+		-- The transaction filters of the run, NULL without any
+		filters VARCHAR
+	);`
+
+	// CreateRunProgressTable holds the latest progress snapshot of each
+	// run, written every few seconds while it runs.
+	CreateRunProgressTable = `
+	CREATE TABLE IF NOT EXISTS run_progress (
+		run_id BIGINT PRIMARY KEY,
+		processed BIGINT NOT NULL,
+		failed BIGINT NOT NULL,
+		total_txs BIGINT NOT NULL,
+		-- Blocks completed per minute since the run started
+		rate DOUBLE NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`
+
+	// CreateChainBreaksTable records stored blocks whose previous block hash
+	// doesn't match the block stored at the height below, found with
+	// --validate-chain.
+	CreateChainBreaksTable = `
+	CREATE TABLE IF NOT EXISTS chain_breaks (
+		height BIGINT NOT NULL,
+		block_hash VARCHAR NOT NULL,
+		previous_block_hash VARCHAR,
+		stored_previous_hash VARCHAR NOT NULL,
+		detected_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (block_hash, stored_previous_hash)
+	);`
+
+	// CreateLakeBlocksTable is created in the status database of a lake, see
+	// LakeDB. It records the block stored at each height and the batch whose
+	// Parquet files hold its rows; rows of other batches are stale.
+	CreateLakeBlocksTable = `
+	CREATE TABLE IF NOT EXISTS lake_blocks (
+		height BIGINT PRIMARY KEY,
+		hash VARCHAR NOT NULL,
+		batch BIGINT NOT NULL
+	);`
+
+	// CreateMetadataTable holds settings of the database as a whole, such as
+	// the profile it is scraped with.
+	CreateMetadataTable = `
+	CREATE TABLE IF NOT EXISTS metadata (
+		name VARCHAR PRIMARY KEY,
+		value VARCHAR NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);`
+
+	// CreateDaysCompleteTable records the days a --by-day run stored every
+	// block of, with the heights the day was resolved to.
+	CreateDaysCompleteTable = `
+	CREATE TABLE IF NOT EXISTS days_complete (
+		day TIMESTAMP PRIMARY KEY,
+		from_height BIGINT NOT NULL,
+		to_height BIGINT NOT NULL,
+		completed_at TIMESTAMP NOT NULL
+	);`
+
+	// CreateRawBlocksTable stores the serialized blocks archived with
+	// --store-raw-blocks, zstd compressed.
+	CreateRawBlocksTable = `
+	CREATE TABLE IF NOT EXISTS raw_blocks (
+		block_height BIGINT PRIMARY KEY,
+		block_hash VARCHAR NOT NULL,
+		size_bytes BIGINT NOT NULL,
+		data BLOB NOT NULL
+	);`
+
+	// CreateBlockStatsTable stores the getblockstats aggregates of the blocks
+	// scraped with --mode stats. It is independent of the blocks table, so
+	// both modes can fill the same database.
+	CreateBlockStatsTable = `
+	CREATE TABLE IF NOT EXISTS block_stats (
+		height BIGINT PRIMARY KEY,
+		block_hash VARCHAR NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		median_time TIMESTAMP NOT NULL,
+		tx_count BIGINT NOT NULL,
+		inputs BIGINT NOT NULL,
+		outputs BIGINT NOT NULL,
+		total_size BIGINT NOT NULL,
+		total_weight BIGINT NOT NULL,
+		total_fee BIGINT NOT NULL,
+		subsidy BIGINT NOT NULL,
+		total_out BIGINT NOT NULL,
+		avg_fee BIGINT NOT NULL,
+		min_fee BIGINT NOT NULL,
+		max_fee BIGINT NOT NULL,
+		median_fee BIGINT NOT NULL,
+		avg_fee_rate BIGINT NOT NULL,
+		min_fee_rate BIGINT NOT NULL,
+		max_fee_rate BIGINT NOT NULL,
+		fee_rate_p10 BIGINT NOT NULL,
+		fee_rate_p25 BIGINT NOT NULL,
+		fee_rate_p50 BIGINT NOT NULL,
+		fee_rate_p75 BIGINT NOT NULL,
+		fee_rate_p90 BIGINT NOT NULL,
+		segwit_tx_count BIGINT NOT NULL,
+		segwit_total_size BIGINT NOT NULL,
+		utxo_increase BIGINT NOT NULL,
+		utxo_size_increase BIGINT NOT NULL,
+		processed_at TIMESTAMP NOT NULL
+	);`
+
+	CreateBlockStatsIndexes = `
+	CREATE INDEX IF NOT EXISTS idx_block_stats_timestamp ON block_stats(timestamp);
+	`
+
+	// CreateFeeEstimatesTable records the estimatesmartfee answers for each
+	// confirmation target polled in follow mode, with the tip at the time.
+	CreateFeeEstimatesTable = `
+	CREATE TABLE IF NOT EXISTS fee_estimates (
+		estimated_at TIMESTAMP NOT NULL,
+		target INTEGER NOT NULL,
+		height BIGINT NOT NULL,
+		fee_rate DOUBLE NOT NULL,
+		blocks INTEGER NOT NULL,
+		PRIMARY KEY (estimated_at, target)
+	);`
+
+	// CreateNextBlockEstimatesTable records the getblocktemplate summaries
+	// taken in follow mode, for the block at height.
+	CreateNextBlockEstimatesTable = `
+	CREATE TABLE IF NOT EXISTS next_block_estimates (
+		estimated_at TIMESTAMP PRIMARY KEY,
+		height BIGINT NOT NULL,
+		tx_count BIGINT NOT NULL,
+		weight BIGINT NOT NULL,
+		total_fees BIGINT NOT NULL,
+		min_fee_rate DOUBLE NOT NULL
+	);`
+
+	// CreateNodeSnapshotsTable records the node and mempool state at every
+	// poll in follow mode.
+	CreateNodeSnapshotsTable = `
+	CREATE TABLE IF NOT EXISTS node_snapshots (
+		taken_at TIMESTAMP PRIMARY KEY,
+		height BIGINT NOT NULL,
+		headers BIGINT NOT NULL,
+		verification_progress DOUBLE NOT NULL,
+		chain_tx_count BIGINT NOT NULL,
+		window_blocks BIGINT NOT NULL,
+		window_txs BIGINT NOT NULL,
+		window_seconds BIGINT NOT NULL,
+		tx_rate DOUBLE NOT NULL,
+		mempool_txs BIGINT NOT NULL,
+		mempool_bytes BIGINT NOT NULL,
+		mempool_usage BIGINT NOT NULL,
+		mempool_min_fee DOUBLE NOT NULL,
+		connections INTEGER NOT NULL,
+		connections_in INTEGER NOT NULL,
+		connections_out INTEGER NOT NULL
+	);`
+
+	// CreateBlockAnomaliesTable records the dimensions on which scrapbtc
+	// analyze anomalies found blocks unusual, by block so that a reorg drops
+	// those of the replaced block.
+	CreateBlockAnomaliesTable = `
+	CREATE TABLE IF NOT EXISTS block_anomalies (
+		block_height BIGINT NOT NULL,
+		block_hash VARCHAR NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		dimension VARCHAR NOT NULL,
+		value DOUBLE NOT NULL,
+		baseline DOUBLE NOT NULL,
+		score DOUBLE NOT NULL,
+		method VARCHAR NOT NULL,
+		detected_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (block_height, dimension)
+	);`
+
+	// CreateBlockPricesView attaches to every block the latest price at or
+	// before its timestamp, or failing that the next price, as long as it is
+	// within 24 hours of the block. price_match is 'before', 'after' or
+	// 'none' for blocks without a usable price, whose price_usd is NULL.
+	CreateBlockPricesView = `
+	CREATE OR REPLACE VIEW block_prices AS
+	SELECT
+		b.height,
+		b.hash,
+		b.timestamp,
+		CASE
+			WHEN pb.timestamp >= b.timestamp - INTERVAL 24 HOUR THEN pb.price
+			WHEN pa.timestamp <= b.timestamp + INTERVAL 24 HOUR THEN pa.price
+		END AS price_usd,
+		CASE
+			WHEN pb.timestamp >= b.timestamp - INTERVAL 24 HOUR THEN pb.timestamp
+			WHEN pa.timestamp <= b.timestamp + INTERVAL 24 HOUR THEN pa.timestamp
+		END AS price_timestamp,
+		CASE
+			WHEN pb.timestamp >= b.timestamp - INTERVAL 24 HOUR THEN 'before'
+			WHEN pa.timestamp <= b.timestamp + INTERVAL 24 HOUR THEN 'after'
+			ELSE 'none'
+		END AS price_match
+	FROM blocks b
+	ASOF LEFT JOIN price_data pb ON b.timestamp >= pb.timestamp
+	ASOF LEFT JOIN price_data pa ON b.timestamp <= pa.timestamp;`
+
+	// Migrations bring databases created by older versions up to date. Each
+	// statement must be idempotent since they all run on every startup.
+	Migrations = `
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS coinbase_value BIGINT DEFAULT 0;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS total_fees BIGINT DEFAULT 0;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS subsidy BIGINT;
+	-- Follows models.SubsidyForHeight, which stays below 64 halvings for
+	-- millions of years
+	UPDATE blocks SET subsidy = 5000000000 >> (height // 210000) WHERE subsidy IS NULL;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS segwit_tx_count INTEGER;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS witness_size BIGINT;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS coinbase_script VARCHAR;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS miner_tag VARCHAR;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS work VARCHAR;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS chainwork VARCHAR;
+	ALTER TABLE blocks ADD COLUMN IF NOT EXISTS filtered_tx_count INTEGER DEFAULT 0;
+	ALTER TABLE runs ADD COLUMN IF NOT EXISTS filters VARCHAR;
+	ALTER TABLE tx_outputs ADD COLUMN IF NOT EXISTS script_type VARCHAR;
+	-- Inputs and outputs stored before these columns existed get their
+	-- height from the io-heights backfill
+	ALTER TABLE tx_inputs ADD COLUMN IF NOT EXISTS block_height BIGINT;
+	ALTER TABLE tx_outputs ADD COLUMN IF NOT EXISTS block_height BIGINT;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS is_coinbase BOOLEAN DEFAULT FALSE;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee_rate DOUBLE DEFAULT 0;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS version INTEGER;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS locktime BIGINT;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS signals_rbf BOOLEAN;
+	-- DuckDB rewrites updates of indexed columns as delete+insert, which
+	-- conflicts with the primary key when spent outputs get linked
+	DROP INDEX IF EXISTS idx_tx_outputs_spent;
+	-- Same for processing_status.status, where INSERT OR REPLACE additionally
+	-- becomes a silent no-op while the index exists
+	DROP INDEX IF EXISTS idx_processing_status_status;
 	`
 
 	CreateAllIndexes = `
@@ -116,6 +541,8 @@ const (
 	` + CreateTransactionsIndexes + `
 	` + CreateTxInputsIndexes + `
 	` + CreateTxOutputsIndexes + `
-	` + CreateProcessingStatusIndexes + `
-	` + CreatePriceDataIndexes
-)
\ No newline at end of file
+	` + CreatePriceDataIndexes + `
+	` + CreateOpReturnOutputsIndexes + `
+	` + CreateBlockMetricsIndexes + `
+	` + CreateBlockStatsIndexes
+)
@@ -0,0 +1,125 @@
+package db
+
+// The PostgreSQL versions of the tables PostgresDB stores: the blocks and
+// transactions of the standard and minimal profiles, processing_status, the
+// runs and the metadata. Times are timestamptz and run ids come from a
+// serial column. There are no migrations: the tables are created with the
+// current schema, in one transaction under an advisory lock, see PostgresDB.
+const (
+	CreateBlocksTablePostgres = `
+	CREATE TABLE IF NOT EXISTS blocks (
+		hash VARCHAR PRIMARY KEY,
+		height BIGINT NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL,
+		size INTEGER NOT NULL,
+		weight INTEGER NOT NULL,
+		tx_count INTEGER NOT NULL,
+		filtered_tx_count INTEGER DEFAULT 0,
+		previous_block_hash VARCHAR,
+		merkle_root VARCHAR NOT NULL,
+		nonce BIGINT NOT NULL,
+		bits VARCHAR NOT NULL,
+		difficulty DOUBLE PRECISION NOT NULL,
+		coinbase_value BIGINT NOT NULL DEFAULT 0,
+		subsidy BIGINT,
+		total_fees BIGINT NOT NULL DEFAULT 0,
+		segwit_tx_count INTEGER,
+		witness_size BIGINT,
+		coinbase_script VARCHAR,
+		miner_tag VARCHAR,
+		work VARCHAR,
+		chainwork VARCHAR,
+		processed_at TIMESTAMPTZ NOT NULL
+	);`
+
+	CreateTransactionsTablePostgres = `
+	CREATE TABLE IF NOT EXISTS transactions (
+		txid VARCHAR NOT NULL,
+		block_hash VARCHAR NOT NULL,
+		block_height BIGINT NOT NULL,
+		size INTEGER NOT NULL,
+		vsize INTEGER NOT NULL,
+		weight INTEGER NOT NULL,
+		fee BIGINT NOT NULL,
+		fee_rate DOUBLE PRECISION DEFAULT 0,
+		is_coinbase BOOLEAN NOT NULL DEFAULT FALSE,
+		input_count INTEGER NOT NULL,
+		output_count INTEGER NOT NULL,
+		input_value BIGINT NOT NULL,
+		output_value BIGINT NOT NULL,
+		version INTEGER,
+		locktime BIGINT,
+		signals_rbf BOOLEAN,
+		tx_category VARCHAR,
+		timestamp TIMESTAMPTZ NOT NULL,
+		processed_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (txid, block_hash)
+	);`
+
+	CreateProcessingStatusTablePostgres = `
+	CREATE TABLE IF NOT EXISTS processing_status (
+		block_height BIGINT PRIMARY KEY,
+		block_hash VARCHAR NOT NULL,
+		status VARCHAR NOT NULL CHECK (status IN ('processing', 'completed', 'failed', 'interrupted', 'headers_only')),
+		started_at TIMESTAMPTZ NOT NULL,
+		completed_at TIMESTAMPTZ,
+		error_message VARCHAR,
+		rpc_fetch_ms BIGINT,
+		parse_ms BIGINT,
+		db_insert_ms BIGINT,
+		total_ms BIGINT
+	);`
+
+	CreateRunsTablePostgres = `
+	CREATE TABLE IF NOT EXISTS runs (
+		run_id BIGSERIAL PRIMARY KEY,
+		started_at TIMESTAMPTZ NOT NULL,
+		finished_at TIMESTAMPTZ,
+		from_height BIGINT NOT NULL,
+		to_height BIGINT NOT NULL,
+		blocks_processed BIGINT NOT NULL DEFAULT 0,
+		blocks_failed BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR NOT NULL,
+		error VARCHAR,
+		version VARCHAR NOT NULL,
+		args VARCHAR NOT NULL,
+		hostname VARCHAR NOT NULL,
+		pid INTEGER NOT NULL,
+		filters VARCHAR
+	);`
+
+	CreateRunProgressTablePostgres = `
+	CREATE TABLE IF NOT EXISTS run_progress (
+		run_id BIGINT PRIMARY KEY,
+		processed BIGINT NOT NULL,
+		failed BIGINT NOT NULL,
+		total_txs BIGINT NOT NULL,
+		rate DOUBLE PRECISION NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);`
+
+	CreateChainBreaksTablePostgres = `
+	CREATE TABLE IF NOT EXISTS chain_breaks (
+		height BIGINT NOT NULL,
+		block_hash VARCHAR NOT NULL,
+		previous_block_hash VARCHAR,
+		stored_previous_hash VARCHAR NOT NULL,
+		detected_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (block_hash, stored_previous_hash)
+	);`
+
+	CreateMetadataTablePostgres = `
+	CREATE TABLE IF NOT EXISTS metadata (
+		name VARCHAR PRIMARY KEY,
+		value VARCHAR NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	);`
+
+	// Unlike DuckDB, PostgreSQL has no zone maps to scan the tables by
+	// height without an index, so the indexes are created with the tables.
+	// The status index lets each instance find the completed heights of its
+	// range without reading the rows.
+	CreateAllIndexesPostgres = CreateBlocksIndexes + CreateTransactionsIndexes + `
+	CREATE INDEX IF NOT EXISTS idx_processing_status_coverage ON processing_status(block_height, status);
+	`
+)
@@ -0,0 +1,118 @@
+package db
+
+// The SQLite versions of the schema statements SQLite can't run as written
+// for DuckDB. Ids are INTEGER PRIMARY KEY columns, which SQLite assigns
+// itself, instead of sequences. SQLite databases are always created with
+// the current schema, so none of the DuckDB migrations apply to them.
+const (
+	CreateTxInputsTableSQLite = `
+	CREATE TABLE IF NOT EXISTS tx_inputs (
+		id INTEGER PRIMARY KEY,
+		txid VARCHAR NOT NULL,
+		vout INTEGER NOT NULL,
+		script_sig VARCHAR,
+		sequence BIGINT NOT NULL,
+		prev_txid VARCHAR,
+		prev_vout INTEGER,
+		value BIGINT,
+		address VARCHAR,
+		txid_spending VARCHAR NOT NULL,
+		block_height BIGINT
+	);`
+
+	CreateTxOutputsTableSQLite = `
+	CREATE TABLE IF NOT EXISTS tx_outputs (
+		id INTEGER PRIMARY KEY,
+		txid VARCHAR NOT NULL,
+		vout INTEGER NOT NULL,
+		value BIGINT NOT NULL,
+		script_pub_key VARCHAR,
+		script_type VARCHAR,
+		address VARCHAR,
+		spent_txid VARCHAR,
+		spent_vout INTEGER,
+		block_height BIGINT
+	);`
+
+	CreateTxIOKeysSQLite = `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_inputs_outpoint ON tx_inputs(txid_spending, vout);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_outputs_outpoint ON tx_outputs(txid, vout);
+	`
+
+	// Dividing integers truncates in SQLite, where DuckDB uses //.
+	CreateTxInputsIndexesSQLite = `
+	CREATE INDEX IF NOT EXISTS idx_tx_inputs_txid ON tx_inputs(txid_spending);
+	CREATE INDEX IF NOT EXISTS idx_tx_inputs_prev ON tx_inputs(prev_txid, prev_vout);
+	CREATE INDEX IF NOT EXISTS idx_tx_inputs_height_bucket ON tx_inputs((block_height / 10000));
+	`
+
+	CreateTxOutputsIndexesSQLite = `
+	CREATE INDEX IF NOT EXISTS idx_tx_outputs_txid ON tx_outputs(txid);
+	CREATE INDEX IF NOT EXISTS idx_tx_outputs_address ON tx_outputs(address);
+	CREATE INDEX IF NOT EXISTS idx_tx_outputs_height_bucket ON tx_outputs((block_height / 10000));
+	`
+
+	// CreateProcessingStatusIndexesSQLite covers the status with the height,
+	// so that the coverage of a height range is read from the index alone.
+	// DuckDB goes without: it rewrites updates of indexed columns, and
+	// scans the status table fast enough from its zone maps.
+	CreateProcessingStatusIndexesSQLite = `
+	CREATE INDEX IF NOT EXISTS idx_processing_status_coverage ON processing_status(block_height, status);
+	`
+
+	CreateRunsTableSQLite = `
+	CREATE TABLE IF NOT EXISTS runs (
+		run_id INTEGER PRIMARY KEY,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP,
+		from_height BIGINT NOT NULL,
+		to_height BIGINT NOT NULL,
+		blocks_processed BIGINT NOT NULL DEFAULT 0,
+		blocks_failed BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR NOT NULL,
+		error VARCHAR,
+		version VARCHAR NOT NULL,
+		args VARCHAR NOT NULL,
+		hostname VARCHAR NOT NULL,
+		pid INTEGER NOT NULL,
+		filters VARCHAR
+	);`
+
+	// CreateBlockPricesViewSQLite is CreateBlockPricesView without ASOF
+	// joins: the neighbouring prices are looked up by timestamp, which the
+	// primary key of price_data indexes.
+	CreateBlockPricesViewSQLite = `
+	DROP VIEW IF EXISTS block_prices;
+	CREATE VIEW block_prices AS
+	SELECT
+		b.height,
+		b.hash,
+		b.timestamp,
+		CASE
+			WHEN epoch(pb.timestamp) >= epoch(b.timestamp) - 86400 THEN pb.price
+			WHEN epoch(pa.timestamp) <= epoch(b.timestamp) + 86400 THEN pa.price
+		END AS price_usd,
+		CASE
+			WHEN epoch(pb.timestamp) >= epoch(b.timestamp) - 86400 THEN pb.timestamp
+			WHEN epoch(pa.timestamp) <= epoch(b.timestamp) + 86400 THEN pa.timestamp
+		END AS price_timestamp,
+		CASE
+			WHEN epoch(pb.timestamp) >= epoch(b.timestamp) - 86400 THEN 'before'
+			WHEN epoch(pa.timestamp) <= epoch(b.timestamp) + 86400 THEN 'after'
+			ELSE 'none'
+		END AS price_match
+	FROM blocks b
+	LEFT JOIN price_data pb ON pb.timestamp = (SELECT MAX(timestamp) FROM price_data WHERE timestamp <= b.timestamp)
+	LEFT JOIN price_data pa ON pa.timestamp = (SELECT MIN(timestamp) FROM price_data WHERE timestamp >= b.timestamp);`
+
+	CreateAllIndexesSQLite = `
+	` + CreateBlocksIndexes + `
+	` + CreateTransactionsIndexes + `
+	` + CreateTxInputsIndexesSQLite + `
+	` + CreateTxOutputsIndexesSQLite + `
+	` + CreatePriceDataIndexes + `
+	` + CreateOpReturnOutputsIndexes + `
+	` + CreateBlockMetricsIndexes + `
+	` + CreateBlockStatsIndexes + `
+	` + CreateProcessingStatusIndexesSQLite
+)
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetOutputTypeDistribution returns the number and value of the outputs of
+// each script type created per day in the given time range. Outputs scraped
+// before script types were recorded are left out.
+func (db *DB) GetOutputTypeDistribution(from, to time.Time) ([]*models.OutputTypeStats, error) {
+	query := `SELECT
+		date_trunc('day', t.timestamp) AS day,
+		o.script_type,
+		COUNT(*),
+		CAST(SUM(o.value) AS BIGINT),
+		COUNT(*) * 100.0 / SUM(COUNT(*)) OVER (PARTITION BY date_trunc('day', t.timestamp))
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	WHERE t.timestamp >= ? AND t.timestamp < ? AND o.script_type IS NOT NULL
+	GROUP BY day, o.script_type
+	ORDER BY day, COUNT(*) DESC, o.script_type`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.OutputTypeStats
+	for rows.Next() {
+		s := &models.OutputTypeStats{}
+		if err := rows.Scan(scanTime(&s.Day), &s.ScriptType, &s.Outputs, &s.Value, &s.Percent); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
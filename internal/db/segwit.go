@@ -0,0 +1,76 @@
+package db
+
+import (
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetSegwitAdoptionByDay returns segwit usage per day in the given time
+// range. Blocks scraped before segwit usage was recorded are left out.
+func (db *DB) GetSegwitAdoptionByDay(from, to time.Time) ([]*models.SegwitDailyStats, error) {
+	query := `SELECT
+		date_trunc('day', timestamp) AS day,
+		COUNT(*),
+		CAST(SUM(tx_count) AS BIGINT),
+		CAST(SUM(segwit_tx_count) AS BIGINT),
+		CAST(SUM(witness_size) AS BIGINT),
+		CAST(SUM(weight) AS BIGINT),
+		CAST(SUM(size) AS BIGINT)
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ? AND segwit_tx_count IS NOT NULL
+	GROUP BY day
+	ORDER BY day`
+
+	rows, err := db.conn.Query(query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.SegwitDailyStats
+	for rows.Next() {
+		s := &models.SegwitDailyStats{}
+		var weight, size int64
+		if err := rows.Scan(scanTime(&s.Day), &s.Blocks, &s.Transactions, &s.SegwitTxs, &s.WitnessBytes, &weight, &size); err != nil {
+			return nil, err
+		}
+		if s.Transactions > 0 {
+			s.Percent = float64(s.SegwitTxs) / float64(s.Transactions) * 100
+		}
+		if size > 0 {
+			s.WeightRatio = float64(weight) / float64(size)
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// GetBlocksMissingSegwit returns the hashes by height of the stored blocks in
+// [fromHeight, toHeight] whose segwit usage hasn't been recorded.
+func (db *DB) GetBlocksMissingSegwit(fromHeight, toHeight int64) (map[int64]string, error) {
+	rows, err := db.conn.Query(`SELECT height, hash FROM blocks
+	WHERE height BETWEEN ? AND ? AND segwit_tx_count IS NULL`, fromHeight, toHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := make(map[int64]string)
+	for rows.Next() {
+		var height int64
+		var hash string
+		if err := rows.Scan(&height, &hash); err != nil {
+			return nil, err
+		}
+		blocks[height] = hash
+	}
+
+	return blocks, rows.Err()
+}
+
+func (db *DB) UpdateBlockSegwit(hash string, segwitTxs int, witnessSize int64) error {
+	_, err := db.conn.Exec(`UPDATE blocks SET segwit_tx_count = ?, witness_size = ? WHERE hash = ?`,
+		segwitTxs, witnessSize, hash)
+	return err
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// InsertNodeSnapshot records the node and mempool state at one poll.
+func (db *DB) InsertNodeSnapshot(s *models.NodeSnapshot) error {
+	_, err := db.conn.Exec(`INSERT OR REPLACE INTO node_snapshots (
+		taken_at, height, headers, verification_progress, chain_tx_count,
+		window_blocks, window_txs, window_seconds, tx_rate,
+		mempool_txs, mempool_bytes, mempool_usage, mempool_min_fee,
+		connections, connections_in, connections_out
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.TakenAt, s.Height, s.Headers, s.VerificationProgress, s.ChainTxCount,
+		s.WindowBlocks, s.WindowTxs, s.WindowSeconds, s.TxRate,
+		s.MempoolTxs, s.MempoolBytes, s.MempoolUsage, s.MempoolMinFee,
+		s.Connections, s.ConnectionsIn, s.ConnectionsOut)
+	if err != nil {
+		return fmt.Errorf("failed to insert node snapshot: %w", err)
+	}
+	return nil
+}
+
+// selectMempoolFullness groups the snapshots and the stored blocks by period
+// and keeps the periods with snapshots.
+const selectMempoolFullness = `
+WITH snaps AS (
+	SELECT
+		date_trunc('%[1]s', taken_at) AS period,
+		COUNT(*) AS snapshots,
+		AVG(mempool_txs) AS avg_txs,
+		AVG(mempool_bytes) AS avg_bytes,
+		MAX(mempool_bytes) AS max_bytes
+	FROM node_snapshots
+	WHERE taken_at >= ? AND taken_at < ?
+	GROUP BY period
+), mined AS (
+	SELECT
+		date_trunc('%[1]s', timestamp) AS period,
+		COUNT(*) AS blocks,
+		AVG(weight) / 4000000.0 * 100 AS fullness,
+		SUM(total_fees) AS fees
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY period
+)
+SELECT
+	s.period, s.snapshots, s.avg_txs, s.avg_bytes, s.max_bytes,
+	COALESCE(m.blocks, 0), COALESCE(m.fullness, 0), CAST(COALESCE(m.fees, 0) AS BIGINT)
+FROM snaps s
+LEFT JOIN mined m ON m.period = s.period
+ORDER BY s.period`
+
+// GetMempoolFullness returns the average and peak mempool size recorded by
+// node snapshots per hour or day in [from, to), next to how full the blocks
+// mined in the same period were and the fees they paid.
+func (db *DB) GetMempoolFullness(from, to time.Time, granularity string) ([]*models.MempoolFullness, error) {
+	if granularity != GranularityHour && granularity != GranularityDay {
+		return nil, fmt.Errorf("invalid granularity %q: must be hour or day", granularity)
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf(selectMempoolFullness, granularity), from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.MempoolFullness
+	for rows.Next() {
+		s := &models.MempoolFullness{}
+		if err := rows.Scan(scanTime(&s.Period), &s.Snapshots, &s.AvgMempoolTxs, &s.AvgMempoolBytes, &s.MaxMempoolBytes,
+			&s.Blocks, &s.Fullness, &s.Fees); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteDriverName is the database/sql driver the SQLite backend opens. It
+// wraps the cgo-free modernc.org/sqlite so that times are bound as text in
+// timeFormat and the DuckDB functions used by the shared queries are
+// available.
+const sqliteDriverName = "scrapbtc_sqlite"
+
+func init() {
+	registerSQLiteFunctions()
+	// modernc.org/sqlite adds the registered functions to the connections
+	// of the driver it registers as "sqlite", which isn't exported.
+	base, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(sqliteDriverName, &sqliteDriver{base.Driver()})
+	base.Close()
+}
+
+// NewSQLiteDB opens or creates the SQLite database at dbPath.
+func NewSQLiteDB(dbPath string) (*DB, error) {
+	conn, err := openSQLiteConn(dbPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{conn: conn, driver: DriverSQLite, dialect: sqliteDialect}
+	if err := db.createTables(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	return db, nil
+}
+
+// NewReadOnlySQLiteDB opens an existing SQLite database without creating
+// tables.
+func NewReadOnlySQLiteDB(dbPath string) (*DB, error) {
+	conn, err := openSQLiteConn(dbPath, true)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{conn: conn, driver: DriverSQLite, dialect: sqliteDialect, readOnly: true}, nil
+}
+
+// openSQLiteConn opens a pool of a single connection: SQLite allows one
+// writer at a time anyway, and the PRAGMAs set by EnableFastInserts only
+// apply to the connection that runs them. Other processes using the file
+// are waited for rather than failing right away.
+func openSQLiteConn(path string, readOnly bool) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(10000)"
+	if readOnly {
+		dsn += "&mode=ro"
+	}
+	conn, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	conn.SetMaxOpenConns(1)
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return conn, nil
+}
+
+type sqliteDriver struct {
+	driver.Driver
+}
+
+func (d *sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{conn.(sqliteBaseConn)}, nil
+}
+
+// sqliteBaseConn is what database/sql uses of a modernc.org/sqlite
+// connection.
+type sqliteBaseConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type sqliteConn struct {
+	sqliteBaseConn
+}
+
+// CheckNamedValue binds times as UTC text in timeFormat. modernc.org/sqlite
+// would keep their time zone and trim trailing zeros, and such text doesn't
+// sort in time order.
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if t, ok := nv.Value.(time.Time); ok {
+		nv.Value = t.UTC().Format(timeFormat)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// registerSQLiteFunctions provides the DuckDB functions used by the queries
+// both drivers share, on every connection opened afterwards. Timestamps are
+// text in SQLite, so the date functions parse their arguments and return
+// text in timeFormat.
+func registerSQLiteFunctions() {
+	scalar := func(nArgs int32, f func(args []driver.Value) (any, error)) *sqlite.FunctionImpl {
+		return &sqlite.FunctionImpl{
+			NArgs:         nArgs,
+			Deterministic: true,
+			Scalar: func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				return f(args)
+			},
+		}
+	}
+	aggregate := func(newAggregate func() sqlite.AggregateFunction) *sqlite.FunctionImpl {
+		return &sqlite.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+				return newAggregate(), nil
+			},
+		}
+	}
+	for name, impl := range map[string]*sqlite.FunctionImpl{
+		"date_trunc": scalar(2, func(args []driver.Value) (any, error) {
+			part, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported date_trunc part %v", args[0])
+			}
+			return sqliteDateTrunc(part, args[1])
+		}),
+		"date_diff": scalar(3, func(args []driver.Value) (any, error) {
+			part, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported date_diff part %v", args[0])
+			}
+			return sqliteDateDiff(part, args[1], args[2])
+		}),
+		"epoch":    scalar(1, func(args []driver.Value) (any, error) { return sqliteEpoch(args[0]) }),
+		"greatest": scalar(-1, func(args []driver.Value) (any, error) { return sqliteExtreme(args, 1) }),
+		"least":    scalar(-1, func(args []driver.Value) (any, error) { return sqliteExtreme(args, -1) }),
+		"median":   aggregate(func() sqlite.AggregateFunction { return &medianAggregate{} }),
+		"bool_or":  aggregate(func() sqlite.AggregateFunction { return &boolOrAggregate{} }),
+	} {
+		sqlite.MustRegisterFunction(name, impl)
+	}
+}
+
+// sqliteNull reports whether a function argument is NULL, which
+// modernc.org/sqlite passes as nil, or as a nil []byte for blobs.
+func sqliteNull(v any) bool {
+	b, ok := v.([]byte)
+	return v == nil || ok && b == nil
+}
+
+// sqliteTime converts a timestamp argument of a function. ok is false for
+// NULL.
+func sqliteTime(v any) (t time.Time, ok bool, err error) {
+	if sqliteNull(v) {
+		return time.Time{}, false, nil
+	}
+	switch v := v.(type) {
+	case string:
+		t, err = parseTime(v)
+	case []byte:
+		t, err = parseTime(string(v))
+	default:
+		err = fmt.Errorf("unsupported timestamp %v of type %T", v, v)
+	}
+	return t, err == nil, err
+}
+
+// sqliteDateTrunc truncates a timestamp like DuckDB's date_trunc. Weeks
+// start on Monday.
+func sqliteDateTrunc(part string, v any) (any, error) {
+	t, ok, err := sqliteTime(v)
+	if !ok {
+		return nil, err
+	}
+	switch part {
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "day":
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case "week":
+		t = time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+	case "month":
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		t = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return nil, fmt.Errorf("unsupported date_trunc part %q", part)
+	}
+	return t.Format(timeFormat), nil
+}
+
+// sqliteDateDiff returns the number of seconds from start to end, the only
+// part used.
+func sqliteDateDiff(part string, start, end any) (any, error) {
+	if part != "second" {
+		return nil, fmt.Errorf("unsupported date_diff part %q", part)
+	}
+	from, ok, err := sqliteTime(start)
+	if !ok {
+		return nil, err
+	}
+	to, ok, err := sqliteTime(end)
+	if !ok {
+		return nil, err
+	}
+	return to.Unix() - from.Unix(), nil
+}
+
+// sqliteEpoch returns the seconds since the Unix epoch of a timestamp.
+func sqliteEpoch(v any) (any, error) {
+	t, ok, err := sqliteTime(v)
+	if !ok {
+		return nil, err
+	}
+	return float64(t.UnixMicro()) / 1e6, nil
+}
+
+// sqliteExtreme returns the greatest (sign 1) or least (sign -1) of numbers.
+// NULLs are ignored like in DuckDB: the result is only NULL if all of them
+// are.
+func sqliteExtreme(args []driver.Value, sign float64) (any, error) {
+	var best any
+	var bestValue float64
+	for _, arg := range args {
+		if sqliteNull(arg) {
+			continue
+		}
+		var value float64
+		switch v := arg.(type) {
+		case int64:
+			value = float64(v)
+		case float64:
+			value = v
+		default:
+			return nil, fmt.Errorf("unsupported argument %v of type %T", v, v)
+		}
+		if best == nil || sign*(value-bestValue) > 0 {
+			best, bestValue = arg, value
+		}
+	}
+	return best, nil
+}
+
+// medianAggregate is DuckDB's MEDIAN: the middle value, or the mean of the
+// two middle values, ignoring NULLs.
+type medianAggregate struct {
+	values []float64
+}
+
+func (a *medianAggregate) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	v := args[0]
+	if sqliteNull(v) {
+		return nil
+	}
+	switch v := v.(type) {
+	case int64:
+		a.values = append(a.values, float64(v))
+	case float64:
+		a.values = append(a.values, v)
+	default:
+		return fmt.Errorf("unsupported median argument %v of type %T", v, v)
+	}
+	return nil
+}
+
+func (a *medianAggregate) WindowInverse(*sqlite.FunctionContext, []driver.Value) error {
+	return fmt.Errorf("median can't be used as a window function")
+}
+
+func (a *medianAggregate) Final(*sqlite.FunctionContext) {}
+
+func (a *medianAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	n := len(a.values)
+	if n == 0 {
+		return nil, nil
+	}
+	sort.Float64s(a.values)
+	if n%2 == 1 {
+		return a.values[n/2], nil
+	}
+	lo, hi := a.values[n/2-1], a.values[n/2]
+	return lo + (hi-lo)/2, nil
+}
+
+// boolOrAggregate is DuckDB's bool_or, NULL if all values are NULL.
+type boolOrAggregate struct {
+	seen, result bool
+}
+
+func (a *boolOrAggregate) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	switch v := args[0].(type) {
+	case int64:
+		a.seen = true
+		a.result = a.result || v != 0
+	case float64:
+		a.seen = true
+		a.result = a.result || v != 0
+	}
+	return nil
+}
+
+func (a *boolOrAggregate) WindowInverse(*sqlite.FunctionContext, []driver.Value) error {
+	return fmt.Errorf("bool_or can't be used as a window function")
+}
+
+func (a *boolOrAggregate) Final(*sqlite.FunctionContext) {}
+
+func (a *boolOrAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	if !a.seen {
+		return nil, nil
+	}
+	return a.result, nil
+}
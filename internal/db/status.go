@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// GetStatusSummary returns the number of blocks in each processing status,
+// the contiguous ranges of completed heights and the gaps between them.
+// With a non-zero since only blocks that finished (completed, failed or
+// were interrupted) at or after since are counted.
+func (db *DB) GetStatusSummary(since time.Time) (*models.StatusSummary, error) {
+	summary := &models.StatusSummary{Counts: make(map[string]int64)}
+
+	rows, err := db.conn.Query(`SELECT status, COUNT(*)
+	FROM processing_status
+	WHERE ? OR completed_at >= ?
+	GROUP BY status
+	ORDER BY status`, since.IsZero(), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		summary.Counts[status] = count
+		summary.Total += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary.CompletedRanges, err = db.completedRanges(`? OR completed_at >= ?`, since.IsZero(), since)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(summary.CompletedRanges); n > 0 {
+		summary.Gaps = MissingRanges(summary.CompletedRanges[0].From, summary.CompletedRanges[n-1].To, summary.CompletedRanges)
+	}
+	return summary, nil
+}
+
+// completedRanges returns the contiguous ranges of completed heights whose
+// processing_status rows match the condition where, in order.
+func (db *DB) completedRanges(where string, args ...any) ([]models.HeightRange, error) {
+	// Consecutive heights have the same difference to their row number
+	rows, err := db.conn.Query(`SELECT MIN(block_height), MAX(block_height)
+	FROM (
+		SELECT block_height, block_height - ROW_NUMBER() OVER (ORDER BY block_height) AS island
+		FROM processing_status
+		WHERE status = 'completed' AND (`+where+`)
+	)
+	GROUP BY island
+	ORDER BY 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranges []models.HeightRange
+	for rows.Next() {
+		var r models.HeightRange
+		if err := rows.Scan(&r.From, &r.To); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// GetFailedBlocks returns the blocks whose processing failed, by height,
+// optionally only those that failed at or after since.
+func (db *DB) GetFailedBlocks(since time.Time) ([]*models.FailedBlock, error) {
+	rows, err := db.conn.Query(`SELECT block_height, block_hash, COALESCE(error_message, ''), started_at, completed_at
+	FROM processing_status
+	WHERE status = 'failed' AND (? OR completed_at >= ?)
+	ORDER BY block_height`, since.IsZero(), since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.FailedBlock
+	for rows.Next() {
+		b := &models.FailedBlock{}
+		var failedAt sql.NullTime
+		if err := rows.Scan(&b.Height, &b.Hash, &b.Error, &b.StartedAt, &failedAt); err != nil {
+			return nil, err
+		}
+		b.FailedAt = failedAt.Time
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+// SetBlockTimings records how long the run that stored the blocks spent on
+// each of them.
+func (db *DB) SetBlockTimings(ctx context.Context, timings []*models.BlockTiming) error {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+	return db.inTx(ctx, func(tx *sql.Tx) error {
+		for _, t := range timings {
+			_, err := tx.ExecContext(ctx, `UPDATE processing_status
+			SET rpc_fetch_ms = ?, parse_ms = ?, db_insert_ms = ?, total_ms = ?
+			WHERE block_height = ?`, t.RPCFetchMs, t.ParseMs, t.DBInsertMs, t.TotalMs, t.Height)
+			if err != nil {
+				return fmt.Errorf("failed to set timings of block %d: %w", t.Height, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetSlowestBlocks returns up to limit completed blocks with the longest
+// total time, optionally only those completed at or after since. A database
+// opened read-only before the timings were recorded has none.
+func (db *DB) GetSlowestBlocks(limit int, since time.Time) ([]*models.SlowBlock, error) {
+	var n int
+	if err := db.conn.QueryRow(db.dialect.columnExists, "processing_status", "total_ms").Scan(&n); err != nil || n == 0 {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT p.block_height, p.block_hash, b.size, b.tx_count,
+		p.rpc_fetch_ms, p.parse_ms, p.db_insert_ms, p.total_ms
+	FROM processing_status p
+	JOIN blocks b ON b.hash = p.block_hash
+	WHERE p.status = 'completed' AND p.total_ms IS NOT NULL AND (? OR p.completed_at >= ?)
+	ORDER BY p.total_ms DESC, p.block_height
+	LIMIT ?`, since.IsZero(), since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.SlowBlock
+	for rows.Next() {
+		b := &models.SlowBlock{}
+		if err := rows.Scan(&b.Height, &b.Hash, &b.Size, &b.TxCount,
+			&b.RPCFetchMs, &b.ParseMs, &b.DBInsertMs, &b.TotalMs); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"time"
+)
+
+// Supported database drivers.
+const (
+	DriverDuckDB   = "duckdb"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Drivers lists the supported database drivers. Open takes the file based
+// ones; PostgreSQL is opened with NewPostgresDB.
+var Drivers = []string{DriverDuckDB, DriverSQLite, DriverPostgres}
+
+// Store is the storage backend used by the scraper, the processors and the
+// reports. *DB implements it on top of DuckDB or SQLite.
+type Store interface {
+	Close() error
+	Export(path string) error
+	ReadOnly() bool
+	EnableFastInserts() error
+	CreateIndexes() error
+	DropQueryIndexes() error
+	OptimizeForQueries() error
+
+	InsertBlock(ctx context.Context, block *models.Block) error
+	InsertBlockWithTransactions(ctx context.Context, data *models.BlockData) error
+	InsertBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error
+	ReplaceBlocksWithTransactions(ctx context.Context, blocks []*models.BlockData) error
+	InsertBlockHeaders(ctx context.Context, blocks []*models.Block) (int, error)
+	DeleteBlockData(height int64) error
+	AttachSyncSource(ctx context.Context, path string) (*SyncSource, error)
+	InsertTransaction(tx *models.Transaction) error
+	InsertTransactionsBatch(ctx context.Context, transactions []*models.Transaction) error
+	InsertTxOutputsBatch(ctx context.Context, outputs []*models.TxOutput) error
+	InsertTxInputsBatch(ctx context.Context, inputs []*models.TxInput) error
+	InsertOpReturnBatch(ctx context.Context, outputs []*models.OpReturnOutput) error
+	MarkOutputsSpent(ctx context.Context, spends []*models.SpentOutput) error
+	LinkSpentOutputsOfBlock(ctx context.Context, blockHash string) error
+	UpsertAddressStats(ctx context.Context, blockHash string, height int64) error
+	FinalizeAddressFirstSeen(fromHeight, toHeight int64) (int64, error)
+	InsertRawBlock(ctx context.Context, block *models.RawBlock) error
+	GetRawBlock(height int64) (*models.RawBlock, error)
+	GetBlockHashAtHeight(height int64) (string, error)
+	GetBlockByHeight(height int64) (*models.Block, error)
+	GetBlockByHash(hash string) (*models.Block, error)
+	GetTransaction(txid string) (*models.Transaction, error)
+	ExportSince(since time.Time, w RowWriter) (time.Time, error)
+	InsertChainBreak(b *models.ChainBreak) error
+	GetCompletedDays(from, to time.Time) ([]*models.DayRange, error)
+	MarkDayComplete(d *models.DayRange) error
+	GetMetadata(name string) (string, error)
+	SetMetadata(name, value string) error
+	InsertBlockStats(ctx context.Context, stats []*models.BlockStats) error
+	GetBlockStatsHeights(fromHeight, toHeight int64) (map[int64]bool, error)
+	CountBlockStats(fromHeight, toHeight int64) (int64, error)
+	InsertNodeSnapshot(s *models.NodeSnapshot) error
+	InsertFeeEstimates(ctx context.Context, estimates []*models.FeeEstimate) error
+	InsertNextBlockEstimate(e *models.NextBlockEstimate) error
+
+	GetProcessedBlocks(fromHeight, toHeight int64) (map[int64]bool, error)
+	GetStatusCounts(fromHeight, toHeight int64) (completed, failed int64, err error)
+	GetHeadersOnlyHeights(fromHeight, toHeight int64) (map[int64]bool, error)
+	GetBlockTxCounts(fromHeight, toHeight int64) (map[int64]int, error)
+	GetStatusSummary(since time.Time) (*models.StatusSummary, error)
+	GetCoverage(fromHeight, toHeight int64) ([]models.HeightRange, error)
+	GetFailedBlocks(since time.Time) ([]*models.FailedBlock, error)
+	GetAverageTxCount(lastBlocks int) (float64, error)
+	GetMaxProcessedHeight() (int64, error)
+	MarkBlockProcessing(ctx context.Context, height int64, hash string) error
+	MarkBlockCompleted(ctx context.Context, height int64) error
+	MarkBlockFailed(height int64, errMsg string) error
+	MarkBlockInterrupted(height int64) error
+	SetBlockTimings(ctx context.Context, timings []*models.BlockTiming) error
+	GetSlowestBlocks(limit int, since time.Time) ([]*models.SlowBlock, error)
+
+	InsertPriceData(priceData *models.PriceData) error
+	InsertPriceDataBatch(priceDataSlice []*models.PriceData) error
+	ReplacePriceData(ctx context.Context, source string, from, to time.Time, prices []*models.PriceData) error
+	GetPriceData() ([]*models.PriceData, error)
+	GetPriceOHLC(from, to time.Time, granularity string) ([]*models.PriceOHLC, error)
+	FindPriceGaps(maxGap time.Duration) ([]*models.PriceGap, error)
+	CreatePriceJoinView() error
+
+	UpsertAddressLabels(labels []*models.AddressLabel) error
+
+	GetOpReturnStatsByDay(from, to time.Time) ([]*models.OpReturnDailyStats, error)
+	GetMinerRevenueByDay(from, to time.Time) ([]*models.MinerRevenue, error)
+	GetEpochStats(from, to time.Time) ([]*models.EpochStats, error)
+	GetUSDVolumeByDay(from, to time.Time) ([]*models.USDVolume, error)
+	GetDailyStats(from, to time.Time, opts DailyStatsOptions) ([]*models.DailyStats, error)
+	GetRBFShareByDay(from, to time.Time) ([]*models.RBFDailyStats, error)
+	GetTxCategoriesByDay(from, to time.Time) ([]*models.TxCategoryDailyStats, error)
+	GetWatchlistByDay(from, to time.Time, address string) ([]*models.WatchlistDailyStats, error)
+	GetFlowsByLabel(from, to time.Time) ([]*models.LabelFlow, error)
+	GetSegwitAdoptionByDay(from, to time.Time) ([]*models.SegwitDailyStats, error)
+	GetInputResolution(from, to time.Time) ([]*models.InputResolution, error)
+	GetOutputTypeDistribution(from, to time.Time) ([]*models.OutputTypeStats, error)
+	GetBlockIntervalStats(from, to time.Time, granularity string) ([]*models.BlockIntervalStats, error)
+	GetBlockFullness(from, to time.Time, granularity string) ([]*models.BlockFullness, error)
+	GetOutputValueDistribution(from, to time.Time, granularity string) ([]*models.OutputValueDistribution, error)
+	GetFeeHeatmap(from, to time.Time, bounds []float64) ([]*models.FeeHeatmapCell, error)
+	GetBlockFeatures(from, to time.Time, before int) ([]*models.BlockFeatures, int, error)
+	ReplaceAnomalies(from, to time.Time, anomalies []*models.BlockAnomaly) error
+	GetAnomalies(from, to time.Time, dimension string, limit int) ([]*models.BlockAnomaly, error)
+	GetMinerShares(from, to time.Time, granularity string) ([]*models.MinerShare, error)
+	GetHashrateEstimates(from, to time.Time, granularity string) ([]*models.HashrateEstimate, error)
+	GetMempoolFullness(from, to time.Time, granularity string) ([]*models.MempoolFullness, error)
+	GetFeeEstimateAccuracy(from, to time.Time) ([]*models.FeeEstimateAccuracy, error)
+	GetNextBlockFees(from, to time.Time) ([]*models.NextBlockFees, error)
+	GetAddressBalance(address string) (*models.AddressStats, error)
+	GetTopAddresses(n int) ([]*models.AddressStats, error)
+	GetNewAddressesPerDay(from, to time.Time) ([]*models.DailyAddressCount, error)
+	GetActiveAddressesPerDay(from, to time.Time) ([]*models.DailyAddressCount, error)
+	GetUnspentOutputs(address string) ([]*models.TxOutput, error)
+	GetUTXOSetSize(atHeight int64) (*models.UTXOSetSize, error)
+	GetUTXOAgeBands(height int64) ([]*models.UTXOAgeBand, error)
+
+	GetBlocksByTime(from, to time.Time) ([]*models.Block, error)
+	GetStoredTxCounts(from, to time.Time) (map[string]int, error)
+	GetBlockTimeRange() (time.Time, time.Time, error)
+	GetHeightBefore(t time.Time) (int64, error)
+	GetHeightRangeByTime(from, to time.Time) (int64, int64, error)
+	GetSpentOutputAges(blockHash string) ([]*models.SpentOutputAge, error)
+	UpsertBlockMetrics(m *models.BlockMetrics) error
+	GetDailyCDD(from, to time.Time) ([]*models.DailyCDD, error)
+	GetCoinFlows(interpolate bool) ([]*models.CoinFlow, error)
+	UpsertDailyMetricsBatch(metrics []*models.DailyMetrics) error
+	GetDailyMetrics(from, to time.Time, interpolated bool) ([]*models.DailyMetrics, error)
+	GetDailyTransfers(from, to time.Time) ([]*models.DailyTransfers, error)
+	GetDailyPrices(from, to time.Time) ([]*models.DailyPrice, error)
+	SetMaxPriceGap(gap time.Duration)
+	GetPriceAt(t time.Time) (models.PriceData, error)
+	GetPricesAt(times []time.Time) ([]*models.PriceData, error)
+
+	StartRun(run *models.Run, force bool) (int64, error)
+	FinishRun(id int64, status string, processed, failed int64, errMsg string) error
+	GetRuns(status string, limit int) ([]*models.Run, error)
+	SaveRunProgress(p *models.RunProgress) error
+	GetRunProgress(runID int64) (*models.RunProgress, error)
+
+	GetBackfillProgress(field string, fromHeight, toHeight int64) (int64, error)
+	SaveBackfillProgress(field string, fromHeight, toHeight, lastHeight int64) error
+	BackfillFees(fromHeight, toHeight int64) (int64, error)
+	BackfillFeeRates(fromHeight, toHeight int64) (int64, error)
+	BackfillRBF(fromHeight, toHeight int64) (int64, error)
+	BackfillTxCategories(fromHeight, toHeight int64) (int64, error)
+	BackfillIOHeights(fromHeight, toHeight int64) (int64, error)
+	GetBlocksMissingSegwit(fromHeight, toHeight int64) (map[int64]string, error)
+	UpdateBlockSegwit(hash string, segwitTxs int, witnessSize int64) error
+	GetBlocksWork(fromHeight, toHeight int64) ([]*models.Block, error)
+	UpdateBlockWork(hash, work, chainwork string) error
+	LinkSpentOutputsInRange(fromHeight, toHeight int64) (int64, error)
+	ResolveInputs(fromHeight, toHeight int64) (int64, error)
+	ResolveBlockInputs(ctx context.Context, heights []int64) error
+}
+
+var _ Store = (*DB)(nil)
+
+// Open opens the database file at path with the given driver, or a new
+// in-memory DuckDB database if path is MemoryPath. A remote path is opened
+// read-only with NewRemoteDB and the RemoteOptionsFromEnv.
+func Open(driver, path string, readOnly bool) (Store, error) {
+	if IsRemote(path) {
+		if driver == DriverSQLite {
+			return nil, fmt.Errorf("remote databases need the %s driver", DriverDuckDB)
+		}
+		if !readOnly {
+			return nil, fmt.Errorf("remote databases can only be opened read-only")
+		}
+		return NewRemoteDB(path, RemoteOptionsFromEnv())
+	}
+	switch driver {
+	case DriverDuckDB, "":
+		if readOnly && path == MemoryPath {
+			return nil, fmt.Errorf("an in-memory database can't be opened read-only")
+		}
+		if readOnly {
+			return NewReadOnlyDB(path)
+		}
+		return NewDB(path)
+	case DriverSQLite:
+		if path == MemoryPath {
+			return nil, fmt.Errorf("in-memory databases need the %s driver", DriverDuckDB)
+		}
+		if readOnly {
+			return NewReadOnlySQLiteDB(path)
+		}
+		return NewSQLiteDB(path)
+	case DriverPostgres:
+		return nil, fmt.Errorf("database driver %q connects to a server rather than opening a file, see NewPostgresDB", driver)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q, expected one of: %s", driver, strings.Join(Drivers, ", "))
+	}
+}
+
+// OpenLake opens the lake in dir, see LakeDB, for writing, or read-only with
+// NewReadOnlyLakeDB.
+func OpenLake(dir string, readOnly bool) (Store, error) {
+	if readOnly {
+		return NewReadOnlyLakeDB(dir)
+	}
+	return NewLakeDB(dir)
+}
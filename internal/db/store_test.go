@@ -0,0 +1,539 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+	"time"
+)
+
+// driversChain returns blocks spread over five weeks, each spending the
+// coinbase of the block before, and a competing block at height 1001.
+func driversChain() (blocks []*models.BlockData, orphan *models.BlockData) {
+	c := newTestChain()
+	c.watch = map[string]bool{"miner1": true, "addr2": true}
+	heights := []int64{1, 2, 3, 144, 145, 1000, 1001, 1008, 2016, 5000}
+	var coinbase *models.TxOutput
+	for i, height := range heights {
+		txs := []testTx{{outs: []testOut{{fmt.Sprintf("miner%d", i%3), 5000000000}}}}
+		if coinbase != nil {
+			txs = append(txs, testTx{
+				ins:  []*models.TxOutput{coinbase},
+				outs: []testOut{{fmt.Sprintf("addr%d", i%4), 3000000000}, {fmt.Sprintf("addr%d", (i+1)%4), 1999990000}},
+			})
+		}
+		if height == 1001 {
+			orphan, _ = c.block(height, 1, txs...)
+		}
+		data, outs := c.block(height, 0, txs...)
+		coinbase = outs[0][0]
+
+		block := data.Block
+		block.Size = int32(1000 + i)
+		block.Weight = int32(3000000 + 1000*i)
+		block.Difficulty = 1e12 + float64(i)
+		block.SegwitTxCount = i % 2
+		block.WitnessSize = int64(100 * i)
+		block.FilteredTxCount = i % 3
+		// The last blocks were scraped before miners were identified
+		if i < 7 {
+			block.CoinbaseScript = fmt.Sprintf("03%06x", height)
+			block.MinerTag = []string{"Foundry USA", "AntPool", "unknown"}[i%3]
+		}
+		// The last block was scraped before work was recorded
+		if i < 9 {
+			block.Work = fmt.Sprintf("%d000000000000000000000", i+1)
+			block.Chainwork = fmt.Sprintf("%d000000000000000000000", height)
+		}
+		// Timestamps of consecutive blocks may go backwards
+		if height == 145 {
+			block.Timestamp = block.Timestamp.Add(-20 * time.Minute)
+		}
+		for j, tx := range data.Transactions {
+			tx.Size, tx.VSize, tx.Weight = 250, 141, 561
+			tx.Version = 2
+			tx.SignalsRBF = (i+j)%2 == 1
+			tx.FeeRate = float64(10*i + j)
+		}
+		for j, out := range data.Outputs {
+			out.ScriptPubKey = fmt.Sprintf("0014%036x", j)
+			if j == 1 {
+				out.ScriptType = "p2tr"
+			}
+		}
+		for _, in := range data.Inputs {
+			in.Sequence = 0xfffffffd + uint32(i%3)
+		}
+		if i%3 == 0 {
+			data.OpReturns = append(data.OpReturns, &models.OpReturnOutput{
+				Txid: data.Transactions[0].Txid, Vout: 9, BlockHeight: height,
+				DataHex: "6a0401020304", DataSize: 4, Timestamp: block.Timestamp,
+			})
+		}
+		blocks = append(blocks, data)
+	}
+	return blocks, orphan
+}
+
+// populate stores the same data through every write method of the Store.
+func populate(t *testing.T, db *DB) {
+	t.Helper()
+	ctx := context.Background()
+	blocks, orphan := driversChain()
+	genesis := newTestChain().genesis
+	// Every driver stores the blocks a year after the chain began
+	db.clock = func() time.Time { return genesis.AddDate(1, 0, 0) }
+
+	if err := db.EnableFastInserts(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropQueryIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Out of order, through a reorg at 1001
+	storeBlocks(t, db, false, blocks[5], orphan, blocks[0], blocks[2], blocks[1])
+	storeBlocks(t, db, true, blocks[6])
+	for _, height := range []int64{1008, 2016} {
+		if err := db.MarkBlockProcessing(ctx, height, blockHash(height, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.InsertBlocksWithTransactions(ctx, blocks[7:9]); err != nil {
+		t.Fatal(err)
+	}
+	storeBlocks(t, db, false, blocks[3], blocks[4], blocks[9])
+	if err := db.DeleteBlockData(5000); err != nil {
+		t.Fatal(err)
+	}
+	storeBlocks(t, db, false, blocks[9])
+	var timings []*models.BlockTiming
+	for i, data := range blocks[:4] {
+		timings = append(timings, &models.BlockTiming{Height: data.Block.Height, RPCFetchMs: int64(10 * i), ParseMs: 2, DBInsertMs: 3, TotalMs: int64(100 - i)})
+	}
+	if err := db.SetBlockTimings(ctx, timings); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.MarkBlockProcessing(ctx, 7000, blockHash(7000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkBlockFailed(7000, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkBlockProcessing(ctx, 7001, blockHash(7001, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkBlockInterrupted(7001); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkBlockProcessing(ctx, 7002, blockHash(7002, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	cet := time.FixedZone("CET", 3600)
+	prices := []*models.PriceData{
+		{Timestamp: genesis, Price: 42000, MarketCap: 8e11, Volume24h: 2e10, Source: "test", FetchedAt: genesis},
+		{Timestamp: time.Date(2024, 1, 2, 1, 30, 0, 500000000, cet), Price: 43000.5, Source: "test", FetchedAt: genesis},
+		{Timestamp: genesis.AddDate(0, 0, 7), Price: 45000, Source: "test", FetchedAt: genesis},
+	}
+	if err := db.InsertPriceDataBatch(prices); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertPriceData(&models.PriceData{
+		Timestamp: genesis.AddDate(0, 0, 30), Price: 50000, Source: "other", FetchedAt: genesis,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreatePriceJoinView(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpsertAddressLabels([]*models.AddressLabel{
+		{Address: "addr1", Label: "Exchange", Category: models.LabelExchange},
+		{Address: "addr2", Label: "Exchange", Category: models.LabelExchange},
+		{Address: "miner0", Label: "Foundry USA", Category: models.LabelMiner},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []*models.BlockStats
+	for _, data := range blocks[:4] {
+		b := data.Block
+		stats = append(stats, &models.BlockStats{
+			Height: b.Height, BlockHash: b.Hash, Timestamp: b.Timestamp, MedianTime: b.Timestamp.Add(-time.Hour),
+			TxCount: int64(b.TxCount), TotalFee: b.TotalFees, FeeRatePercentiles: [5]int64{1, 2, 3, 4, 5},
+			UTXOIncrease: -1, ProcessedAt: genesis,
+		})
+	}
+	if err := db.InsertBlockStats(ctx, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := db.InsertNodeSnapshot(&models.NodeSnapshot{
+			TakenAt: genesis.Add(time.Duration(i) * 25 * time.Minute), Height: int64(i),
+			VerificationProgress: 0.5, TxRate: 3.5, MempoolTxs: int64(1000 * i), MempoolBytes: int64(300000 * (i + 1)),
+			MempoolMinFee: 1.01, Connections: 10,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The block after 5000 isn't stored
+	for _, height := range []int64{1, 144, 5000} {
+		var estimates []*models.FeeEstimate
+		for _, target := range []int{1, 6} {
+			estimates = append(estimates, &models.FeeEstimate{
+				EstimatedAt: genesis.Add(time.Duration(height) * 10 * time.Minute), Target: target,
+				Height: height, FeeRate: float64(100*height) / float64(target), Blocks: target,
+			})
+		}
+		if err := db.InsertFeeEstimates(ctx, estimates); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, height := range []int64{2, 2, 145, 5001} {
+		if err := db.InsertNextBlockEstimate(&models.NextBlockEstimate{
+			EstimatedAt: genesis.Add(time.Duration(height)*10*time.Minute - time.Duration(i)*time.Second), Height: height,
+			TxCount: int64(i + 1), Weight: 4000 * int64(i+1), TotalFees: 1000 * height, MinFeeRate: float64(i) + 0.5,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, status := range []string{models.RunCompleted, ""} {
+		id, err := db.StartRun(&models.Run{
+			StartedAt: genesis.Add(time.Duration(i) * time.Hour), FromHeight: 1, ToHeight: 5000,
+			Version: "test", Args: "scrapbtc scrape", Hostname: "host", PID: 100 + i,
+			Filters: []string{"", "skip-dust"}[i],
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The second snapshot of a run replaces the first
+		for processed := int64(5); processed <= 10; processed += 5 {
+			if err := db.SaveRunProgress(&models.RunProgress{
+				RunID: id, Processed: processed, Failed: 1, TotalTxs: 100 * processed, Rate: 2.5,
+				UpdatedAt: genesis.Add(time.Duration(processed) * time.Minute),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if status != "" {
+			if err := db.FinishRun(id, status, 10, 1, "one failed"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := db.InsertChainBreak(&models.ChainBreak{
+		Height: 3, BlockHash: blockHash(3, 0), PreviousBlockHash: blockHash(2, 0),
+		StoredPreviousHash: blockHash(2, 1), DetectedAt: genesis,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertRawBlock(ctx, &models.RawBlock{Height: 2, Hash: blockHash(2, 0), Data: []byte{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range blocks {
+		b := data.Block
+		if err := db.UpsertBlockMetrics(&models.BlockMetrics{
+			BlockHeight: b.Height, BlockHash: b.Hash, Timestamp: b.Timestamp,
+			CoinDaysDestroyed: float64(b.Height) / 3, ValueSpent: b.Height * 1000, ComputedAt: genesis,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sopr := 1.25
+	if err := db.UpsertDailyMetricsBatch([]*models.DailyMetrics{
+		{Day: genesis, Supply: 10, RealizedCap: 1.5, SOPR: &sopr, Interpolated: true, ComputedAt: genesis},
+		{Day: genesis.AddDate(0, 0, 1), Supply: 20, RealizedCap: 2.5, Interpolated: true, ComputedAt: genesis,
+			Price: &sopr, IssuedSupply: 5000000000, Fees: 7, Subsidy: 50, TransferredValue: 300, TransferredExChange: 100},
+		{Day: genesis, Supply: 30, UnpricedSupply: 5, ComputedAt: genesis},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A bare block ending a 2016 block window that starts at 1001
+	if err := db.InsertBlock(ctx, &models.Block{
+		Hash: blockHash(3017, 0), Height: 3017, Timestamp: genesis.Add(3017 * 10 * time.Minute),
+		PreviousBlockHash: blockHash(3016, 0), Bits: "17034219", Work: "1000000000000000000000",
+		Chainwork: "3017000000000000000000000", ProcessedAt: genesis,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateBlockWork(blockHash(5000, 0), "5000000000000000000000", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Marked again with other heights, and a day dropped by deleting its block
+	for _, d := range []*models.DayRange{
+		{Day: genesis, FromHeight: 1, ToHeight: 144},
+		{Day: genesis.AddDate(0, 0, 1), FromHeight: 145, ToHeight: 1000},
+		{Day: genesis, FromHeight: 1, ToHeight: 143},
+		{Day: genesis.AddDate(0, 0, 2), FromHeight: 9000, ToHeight: 9001},
+	} {
+		if err := db.MarkDayComplete(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteBlockData(9001); err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []string{"minimal", "standard"} {
+		if err := db.SetMetadata(MetadataProfile, profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Headers of a stored block, which is kept, and of two new ones
+	headers := []*models.Block{{Hash: blockHash(1, 0), Height: 1}}
+	for _, h := range []int64{8000, 8001} {
+		headers = append(headers, &models.Block{
+			Hash: blockHash(h, 0), Height: h, Timestamp: genesis.Add(time.Duration(h) * 10 * time.Minute),
+			TxCount: 3, PreviousBlockHash: blockHash(h-1, 0), Bits: "17034219", Subsidy: models.SubsidyForHeight(h),
+			ProcessedAt: genesis,
+		})
+	}
+	if _, err := db.InsertBlockHeaders(ctx, headers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SaveBackfillProgress("fees", 1, 5000, 144); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateBlockSegwit(blockHash(2, 0), 7, 700); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.OptimizeForQueries(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDriversAgree stores the same data with every driver and checks that
+// every read method returns the same.
+func TestDriversAgree(t *testing.T) {
+	genesis := newTestChain().genesis
+	from, to := genesis.AddDate(0, 0, -1), genesis.AddDate(0, 1, 0)
+	reads := []struct {
+		name string
+		read func(db *DB) (any, error)
+	}{
+		{"BackfillFees", func(db *DB) (any, error) { return db.BackfillFees(1, 5000) }},
+		{"BackfillFeeRates", func(db *DB) (any, error) { return db.BackfillFeeRates(1, 5000) }},
+		{"BackfillRBF", func(db *DB) (any, error) { return db.BackfillRBF(1, 5000) }},
+		{"BackfillTxCategories", func(db *DB) (any, error) { return db.BackfillTxCategories(1, 5000) }},
+		{"GetTxCategoriesByDay", func(db *DB) (any, error) { return db.GetTxCategoriesByDay(from, to) }},
+		{"GetWatchlistByDay", func(db *DB) (any, error) { return db.GetWatchlistByDay(from, to, "") }},
+		{"GetWatchlistByDay address", func(db *DB) (any, error) { return db.GetWatchlistByDay(from, to, "addr2") }},
+		{"BackfillIOHeights", func(db *DB) (any, error) { return db.BackfillIOHeights(1, 5000) }},
+		{"LinkSpentOutputsInRange", func(db *DB) (any, error) { return db.LinkSpentOutputsInRange(1, 5000) }},
+		{"GetFlowsByLabel", func(db *DB) (any, error) { return db.GetFlowsByLabel(from, to) }},
+		{"GetInputResolution before", func(db *DB) (any, error) { return db.GetInputResolution(from, to) }},
+		{"ResolveInputs", func(db *DB) (any, error) { return db.ResolveInputs(1, 5000) }},
+		{"GetInputResolution", func(db *DB) (any, error) { return db.GetInputResolution(from, to) }},
+		{"GetRawBlock", func(db *DB) (any, error) { return db.GetRawBlock(2) }},
+		{"GetBlockHashAtHeight", func(db *DB) (any, error) { return db.GetBlockHashAtHeight(1001) }},
+		{"GetBlockByHeight", func(db *DB) (any, error) { return db.GetBlockByHeight(1001) }},
+		{"GetBlockByHash", func(db *DB) (any, error) { return db.GetBlockByHash(blockHash(2, 0)) }},
+		{"GetTransaction", func(db *DB) (any, error) { return db.GetTransaction(fmt.Sprintf("%064x", 3)) }},
+		{"ExportSince", func(db *DB) (any, error) {
+			var rows exportedRows
+			watermark, err := db.ExportSince(genesis.AddDate(0, 0, -1), &rows)
+			return []any{rows, watermark}, err
+		}},
+		{"GetBlockStatsHeights", func(db *DB) (any, error) { return db.GetBlockStatsHeights(0, 10000) }},
+		{"CountBlockStats", func(db *DB) (any, error) { return db.CountBlockStats(0, 10000) }},
+		{"GetProcessedBlocks", func(db *DB) (any, error) { return db.GetProcessedBlocks(0, 10000) }},
+		{"GetHeadersOnlyHeights", func(db *DB) (any, error) { return db.GetHeadersOnlyHeights(0, 10000) }},
+		{"GetBlockTxCounts", func(db *DB) (any, error) { return db.GetBlockTxCounts(0, 10000) }},
+		{"GetStatusCounts", func(db *DB) (any, error) {
+			completed, failed, err := db.GetStatusCounts(0, 10000)
+			return []int64{completed, failed}, err
+		}},
+		{"GetStatusSummary", func(db *DB) (any, error) { return db.GetStatusSummary(time.Time{}) }},
+		{"GetCoverage", func(db *DB) (any, error) { return db.GetCoverage(1, 3000) }},
+		{"GetStatusSummary since", func(db *DB) (any, error) { return db.GetStatusSummary(genesis) }},
+		{"GetStatusSummary future", func(db *DB) (any, error) { return db.GetStatusSummary(time.Now().AddDate(1, 0, 0)) }},
+		{"GetFailedBlocks", func(db *DB) (any, error) {
+			blocks, err := db.GetFailedBlocks(genesis)
+			for _, b := range blocks {
+				if b.StartedAt.IsZero() || b.FailedAt.IsZero() {
+					return nil, fmt.Errorf("block %d has no start or failure time", b.Height)
+				}
+				b.StartedAt, b.FailedAt = time.Time{}, time.Time{}
+			}
+			return blocks, err
+		}},
+		{"GetSlowestBlocks", func(db *DB) (any, error) { return db.GetSlowestBlocks(3, genesis) }},
+		{"GetBlockFullness", func(db *DB) (any, error) { return db.GetBlockFullness(from, to, GranularityDay) }},
+		{"GetBlockFullness block", func(db *DB) (any, error) { return db.GetBlockFullness(from, to, GranularityBlock) }},
+		{"GetOutputValueDistribution", func(db *DB) (any, error) { return db.GetOutputValueDistribution(from, to, GranularityDay) }},
+		{"GetFeeHeatmap", func(db *DB) (any, error) { return db.GetFeeHeatmap(from, to, DefaultFeeRateBands) }},
+		{"GetBlockFeatures", func(db *DB) (any, error) {
+			features, before, err := db.GetBlockFeatures(from, to, 10)
+			return []any{features, before}, err
+		}},
+		{"GetAverageTxCount", func(db *DB) (any, error) { return db.GetAverageTxCount(5) }},
+		{"GetMaxProcessedHeight", func(db *DB) (any, error) { return db.GetMaxProcessedHeight() }},
+		{"GetPriceData", func(db *DB) (any, error) { return db.GetPriceData() }},
+		{"GetOpReturnStatsByDay", func(db *DB) (any, error) { return db.GetOpReturnStatsByDay(from, to) }},
+		{"GetMinerRevenueByDay", func(db *DB) (any, error) { return db.GetMinerRevenueByDay(from, to) }},
+		{"GetEpochStats", func(db *DB) (any, error) { return db.GetEpochStats(from, to) }},
+		{"GetUSDVolumeByDay", func(db *DB) (any, error) { return db.GetUSDVolumeByDay(from, to) }},
+		{"GetDailyStats", func(db *DB) (any, error) {
+			return db.GetDailyStats(from, to, DailyStatsOptions{RollingWindow: 7, PartialWindows: true, EMAAlpha: 0.2})
+		}},
+		{"GetRBFShareByDay", func(db *DB) (any, error) { return db.GetRBFShareByDay(from, to) }},
+		{"GetSegwitAdoptionByDay", func(db *DB) (any, error) { return db.GetSegwitAdoptionByDay(from, to) }},
+		{"GetOutputTypeDistribution", func(db *DB) (any, error) { return db.GetOutputTypeDistribution(from, to) }},
+		{"GetBlockIntervalStats day", func(db *DB) (any, error) { return db.GetBlockIntervalStats(from, to, GranularityDay) }},
+		{"GetBlockIntervalStats week", func(db *DB) (any, error) { return db.GetBlockIntervalStats(from, to, GranularityWeek) }},
+		{"GetMinerShares day", func(db *DB) (any, error) { return db.GetMinerShares(from, to, GranularityDay) }},
+		{"GetMinerShares week", func(db *DB) (any, error) { return db.GetMinerShares(from, to, GranularityWeek) }},
+		{"GetHashrateEstimates day", func(db *DB) (any, error) { return db.GetHashrateEstimates(from, to, GranularityDay) }},
+		{"GetHashrateEstimates week", func(db *DB) (any, error) { return db.GetHashrateEstimates(from, to, GranularityWeek) }},
+		{"GetMempoolFullness hour", func(db *DB) (any, error) { return db.GetMempoolFullness(from, to, GranularityHour) }},
+		{"GetFeeEstimateAccuracy", func(db *DB) (any, error) { return db.GetFeeEstimateAccuracy(from, to) }},
+		{"GetNextBlockFees", func(db *DB) (any, error) { return db.GetNextBlockFees(from, to) }},
+		{"GetMetadata", func(db *DB) (any, error) { return db.GetMetadata(MetadataProfile) }},
+		{"GetMetadata missing", func(db *DB) (any, error) { return db.GetMetadata("missing") }},
+		{"GetMempoolFullness day", func(db *DB) (any, error) { return db.GetMempoolFullness(from, to, GranularityDay) }},
+		{"GetAddressBalance", func(db *DB) (any, error) { return db.GetAddressBalance("addr1") }},
+		{"GetTopAddresses", func(db *DB) (any, error) { return db.GetTopAddresses(100) }},
+		{"FinalizeAddressFirstSeen", func(db *DB) (any, error) { return db.FinalizeAddressFirstSeen(1, 5000) }},
+		{"GetNewAddressesPerDay", func(db *DB) (any, error) { return db.GetNewAddressesPerDay(from, to) }},
+		{"GetActiveAddressesPerDay", func(db *DB) (any, error) { return db.GetActiveAddressesPerDay(from, to) }},
+		{"GetUnspentOutputs", func(db *DB) (any, error) { return db.GetUnspentOutputs("addr2") }},
+		{"GetUTXOSetSize", func(db *DB) (any, error) { return db.GetUTXOSetSize(1001) }},
+		{"GetUTXOAgeBands", func(db *DB) (any, error) { return db.GetUTXOAgeBands(5000) }},
+		{"GetBlocksByTime", func(db *DB) (any, error) { return db.GetBlocksByTime(from, to) }},
+		{"GetStoredTxCounts", func(db *DB) (any, error) { return db.GetStoredTxCounts(from, to) }},
+		{"GetBlockTimeRange", func(db *DB) (any, error) {
+			first, last, err := db.GetBlockTimeRange()
+			return []time.Time{first, last}, err
+		}},
+		{"GetHeightBefore", func(db *DB) (any, error) { return db.GetHeightBefore(genesis.AddDate(0, 0, 7)) }},
+		{"GetHeightRangeByTime", func(db *DB) (any, error) {
+			lo, hi, err := db.GetHeightRangeByTime(genesis, genesis.AddDate(0, 0, 10))
+			return []int64{lo, hi}, err
+		}},
+		{"GetSpentOutputAges", func(db *DB) (any, error) { return db.GetSpentOutputAges(blockHash(1008, 0)) }},
+		{"GetDailyCDD", func(db *DB) (any, error) { return db.GetDailyCDD(from, to) }},
+		{"GetCoinFlows", func(db *DB) (any, error) { return db.GetCoinFlows(false) }},
+		{"GetCoinFlows interpolated", func(db *DB) (any, error) { return db.GetCoinFlows(true) }},
+		{"GetDailyMetrics", func(db *DB) (any, error) { return db.GetDailyMetrics(from, to, true) }},
+		{"GetDailyTransfers", func(db *DB) (any, error) { return db.GetDailyTransfers(from, to) }},
+		{"GetDailyPrices", func(db *DB) (any, error) { return db.GetDailyPrices(from, to) }},
+		{"GetPricesAt", func(db *DB) (any, error) {
+			return db.GetPricesAt([]time.Time{genesis.Add(time.Hour), genesis.AddDate(0, 0, 20), genesis.AddDate(0, 0, 7)})
+		}},
+		{"GetPriceOHLC", func(db *DB) (any, error) { return db.GetPriceOHLC(from, to, GranularityDay) }},
+		{"GetPriceOHLC month", func(db *DB) (any, error) { return db.GetPriceOHLC(from, to, GranularityMonth) }},
+		{"FindPriceGaps", func(db *DB) (any, error) { return db.FindPriceGaps(48 * time.Hour) }},
+		{"GetRuns", func(db *DB) (any, error) {
+			runs, err := db.GetRuns("", 0)
+			for _, r := range runs {
+				if (r.FinishedAt == nil) != (r.Status == models.RunRunning) {
+					return nil, fmt.Errorf("run %d is %s with finish time %v", r.ID, r.Status, r.FinishedAt)
+				}
+				r.FinishedAt = nil
+			}
+			return runs, err
+		}},
+		{"GetRunProgress latest", func(db *DB) (any, error) { return db.GetRunProgress(0) }},
+		{"GetRunProgress", func(db *DB) (any, error) { return db.GetRunProgress(1) }},
+		{"GetRunProgress missing", func(db *DB) (any, error) { return db.GetRunProgress(10) }},
+		{"GetBackfillProgress", func(db *DB) (any, error) { return db.GetBackfillProgress("fees", 1, 5000) }},
+		{"GetBlocksMissingSegwit", func(db *DB) (any, error) { return db.GetBlocksMissingSegwit(0, 10000) }},
+		{"GetBlocksWork", func(db *DB) (any, error) { return db.GetBlocksWork(0, 10000) }},
+		{"GetCompletedDays", func(db *DB) (any, error) { return db.GetCompletedDays(from, to) }},
+	}
+
+	results := make(map[string][]any)
+	for _, driver := range testDrivers {
+		db := newTestDB(t, driver)
+		populate(t, db)
+		for _, r := range reads {
+			got, err := r.read(db)
+			if err != nil {
+				t.Fatalf("%s: %s: %v", driver, r.name, err)
+			}
+			results[r.name] = append(results[r.name], got)
+		}
+	}
+
+	for _, r := range reads {
+		got := results[r.name]
+		if reflect.ValueOf(got[0]).Kind() == reflect.Slice && reflect.ValueOf(got[0]).Len() == 0 {
+			t.Errorf("%s: %s returned nothing, the test data should cover it", testDrivers[0], r.name)
+		}
+		for i := 1; i < len(got); i++ {
+			if !reflect.DeepEqual(got[i], got[0]) {
+				want, _ := json.Marshal(got[0])
+				diff, _ := json.Marshal(got[i])
+				t.Errorf("%s:\n%s: %s\n%s: %s", r.name, testDrivers[0], want, testDrivers[i], diff)
+			}
+		}
+	}
+}
+
+func TestSQLiteFastInserts(t *testing.T) {
+	db := newTestDB(t, DriverSQLite)
+	if err := db.EnableFastInserts(); err != nil {
+		t.Fatal(err)
+	}
+	var mode string
+	var synchronous int
+	if err := db.conn.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.conn.QueryRow(`PRAGMA synchronous`).Scan(&synchronous); err != nil {
+		t.Fatal(err)
+	}
+	// NORMAL is 1
+	if mode != "wal" || synchronous != 1 {
+		t.Errorf("journal_mode = %s, synchronous = %d, want wal and 1", mode, synchronous)
+	}
+}
+
+func TestStartRunInProgress(t *testing.T) {
+	forEachDriver(t, testStartRunInProgress)
+}
+
+// testStartRunInProgress starts a run while another is running, without
+// and with force, and again once the other one finished.
+func testStartRunInProgress(t *testing.T, driver string) {
+	db := newTestDB(t, driver)
+	run := &models.Run{StartedAt: newTestChain().genesis, FromHeight: 1, ToHeight: 10, Version: "test", Hostname: "host", PID: 100}
+	first, err := db.StartRun(run, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.StartRun(run, false); !errors.Is(err, ErrRunInProgress) {
+		t.Fatalf("StartRun with a run running = %v, want ErrRunInProgress", err)
+	}
+	forced, err := db.StartRun(run, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{first, forced} {
+		if err := db.FinishRun(id, models.RunCompleted, 10, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.StartRun(run, false); err != nil {
+		t.Errorf("StartRun after the others finished = %v", err)
+	}
+	if runs, err := db.GetRuns("", 0); err != nil || len(runs) != 3 {
+		t.Errorf("GetRuns = %d runs, %v, want 3", len(runs), err)
+	}
+}
@@ -0,0 +1,356 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strings"
+)
+
+// syncTable is a table whose rows of a block SyncSource.CopyBlocks copies.
+type syncTable struct {
+	name string
+	key  []string
+	// id assigns the id column, if the table has one; the source's ids
+	// would collide with the destination's.
+	id string
+	// skip lists the columns left out, recomputed in the destination.
+	skip []string
+	// where selects the rows of the blocks from the source, given the
+	// list of their hashes.
+	where string
+	// replace updates rows already stored instead of keeping them.
+	replace bool
+}
+
+// syncTxids selects the transactions of the copied blocks from the source.
+const syncTxids = `SELECT txid FROM sync_source.transactions WHERE block_hash IN (%[1]s)`
+
+// syncTables are copied in order. Outputs are copied unlinked and linked to
+// the inputs stored in the destination, which lacks the blocks the source
+// may have linked them to.
+func (db *DB) syncTables() []syncTable {
+	return []syncTable{
+		{name: "blocks", key: []string{"hash"}, where: `hash IN (%[1]s)`},
+		{name: "transactions", key: []string{"txid", "block_hash"}, where: `block_hash IN (%[1]s)`},
+		{name: "tx_outputs", key: []string{"txid", "vout"}, id: db.dialect.outputID, skip: []string{"spent_txid", "spent_vout"},
+			where: `txid IN (` + syncTxids + `)`},
+		{name: "tx_inputs", key: []string{"txid_spending", "vout"}, id: db.dialect.inputID, where: `txid_spending IN (` + syncTxids + `)`},
+		{name: "op_return_outputs", key: []string{"txid", "vout"}, where: `txid IN (` + syncTxids + `)`},
+		{name: "watched_activity", key: []string{"block_hash", "txid", "direction", "n"}, where: `block_hash IN (%[1]s)`},
+		{name: "block_metrics", key: []string{"block_height"}, where: `block_hash IN (%[1]s)`},
+		{name: "raw_blocks", key: []string{"block_height"}, where: `block_hash IN (%[1]s)`},
+		{name: "processing_status", key: []string{"block_height"}, where: `block_hash IN (%[1]s) AND status = 'completed'`, replace: true},
+	}
+}
+
+// syncKeyedTables are copied whole, except for the rows whose key the
+// destination already stores.
+var syncKeyedTables = []string{"price_data", "address_labels", "block_stats"}
+
+// SyncSource is another database attached to copy the blocks it stores and
+// the database lacks. It holds a connection of the database until Close,
+// which SQLite databases only have one of, so no other method may be
+// called in between.
+type SyncSource struct {
+	db   *DB
+	conn *sql.Conn
+	// tables lists the tables of the source.
+	tables []string
+	// columns lists the columns of each table both databases have, in the
+	// order of the destination. Tables the source lacks are missing.
+	columns map[string][]string
+}
+
+// AttachSyncSource attaches the database file at path, of the same driver,
+// to copy blocks from it. DuckDB attaches it read-only.
+func (db *DB) AttachSyncSource(ctx context.Context, path string) (*SyncSource, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open the source database: %w", err)
+	}
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE `+quoteLiteral(path)+` AS sync_source`+db.dialect.attachOptions); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to attach the source database: %w", err)
+	}
+	s := &SyncSource{db: db, conn: conn, columns: make(map[string][]string)}
+	if err := s.readColumns(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close detaches the source database. Closing it again does nothing.
+func (s *SyncSource) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	_, err := s.conn.ExecContext(context.Background(), `DETACH DATABASE sync_source`)
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	s.conn = nil
+	return err
+}
+
+func (s *SyncSource) readColumns(ctx context.Context) error {
+	rows, err := s.conn.QueryContext(ctx, s.db.dialect.sourceTables)
+	if err != nil {
+		return fmt.Errorf("failed to list the tables of the source database: %w", err)
+	}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		s.tables = append(s.tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !slices.Contains(s.tables, "blocks") || !slices.Contains(s.tables, "processing_status") {
+		return fmt.Errorf("the source isn't a scrapbtc database")
+	}
+
+	names := slices.Clone(syncKeyedTables)
+	for _, t := range s.db.syncTables() {
+		names = append(names, t.name)
+	}
+	for _, table := range names {
+		if !slices.Contains(s.tables, table) {
+			continue
+		}
+		dest, err := s.tableColumns(ctx, table)
+		if err != nil {
+			return err
+		}
+		source, err := s.tableColumns(ctx, "sync_source."+table)
+		if err != nil {
+			return err
+		}
+		for _, column := range dest {
+			if slices.Contains(source, column) {
+				s.columns[table] = append(s.columns[table], column)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SyncSource) tableColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := s.conn.QueryContext(ctx, `SELECT * FROM `+table+` LIMIT 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// Plan lists the blocks at or above fromHeight completed in the source that
+// the destination hasn't completed, and the heights both completed with
+// different blocks. Those are copied as well, replacing the destination's,
+// if preferSource is set.
+func (s *SyncSource) Plan(ctx context.Context, fromHeight int64, preferSource bool) (*models.SyncPlan, error) {
+	type stored struct {
+		hash, status string
+	}
+	dest := make(map[int64]stored)
+	rows, err := s.conn.QueryContext(ctx, `SELECT block_height, block_hash, status FROM processing_status WHERE block_height >= ?`, fromHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the processed blocks: %w", err)
+	}
+	for rows.Next() {
+		var height int64
+		var b stored
+		if err := rows.Scan(&height, &b.hash, &b.status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dest[height] = b
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	plan := &models.SyncPlan{}
+	rows, err = s.conn.QueryContext(ctx, `SELECT p.block_height, p.block_hash
+	FROM sync_source.processing_status p
+	JOIN sync_source.blocks b ON b.hash = p.block_hash
+	WHERE p.status = 'completed' AND p.block_height >= ?
+	ORDER BY p.block_height`, fromHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the blocks of the source: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b := &models.SyncBlock{}
+		if err := rows.Scan(&b.Height, &b.Hash); err != nil {
+			return nil, err
+		}
+		d, ok := dest[b.Height]
+		switch {
+		case !ok:
+		case d.status == "headers_only":
+			b.Replace = true
+		case d.status != "completed":
+		case d.hash == b.Hash:
+			continue
+		default:
+			plan.Conflicts = append(plan.Conflicts, &models.SyncConflict{Height: b.Height, SourceHash: b.Hash, DestHash: d.hash})
+			if !preferSource {
+				continue
+			}
+			b.Replace = true
+		}
+		plan.Blocks = append(plan.Blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(s.tables, "metadata") {
+		err := s.conn.QueryRowContext(ctx, `SELECT value FROM sync_source.metadata WHERE name = ?`, MetadataProfile).Scan(&plan.SourceProfile)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to read the profile of the source: %w", err)
+		}
+	}
+	return plan, nil
+}
+
+// CopyBlocks copies the rows of blocks from the source in one transaction,
+// then links them with the rows already stored and applies them to the
+// address rollups, as if they were scraped. The blocks to replace are
+// deleted in a transaction before, since DuckDB can't store a key deleted
+// in the same transaction: if the copy fails, their heights are missing
+// and the next sync copies them.
+func (s *SyncSource) CopyBlocks(ctx context.Context, blocks []*models.SyncBlock) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	var replaced []int64
+	hashes := make([]string, len(blocks))
+	fromHeight, toHeight := blocks[0].Height, blocks[0].Height
+	for i, b := range blocks {
+		if b.Replace {
+			replaced = append(replaced, b.Height)
+		}
+		hashes[i] = quoteLiteral(b.Hash)
+		fromHeight, toHeight = min(fromHeight, b.Height), max(toHeight, b.Height)
+	}
+
+	s.db.writeMu.Lock()
+	defer s.db.writeMu.Unlock()
+
+	if len(replaced) > 0 {
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			if err := deleteBlockData(ctx, tx, replaced); err != nil {
+				return err
+			}
+			for _, height := range replaced {
+				if _, err := tx.ExecContext(ctx, `DELETE FROM processing_status WHERE block_height = ?`, height); err != nil {
+					return fmt.Errorf("failed to delete processing status of block %d: %w", height, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete the blocks to replace: %w", err)
+		}
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, t := range s.db.syncTables() {
+			columns := slices.DeleteFunc(slices.Clone(s.columns[t.name]), func(c string) bool {
+				return c == "id" || slices.Contains(t.skip, c)
+			})
+			if len(columns) == 0 {
+				continue
+			}
+			selected := strings.Join(columns, ", ")
+			if t.id != "" {
+				columns = append([]string{"id"}, columns...)
+				selected = t.id + ", " + selected
+			}
+			head, tail := insertQuery(t.name, t.key, columns, t.replace)
+			query := strings.TrimSuffix(head, "VALUES ") + `SELECT ` + selected + ` FROM sync_source.` + t.name +
+				` WHERE ` + fmt.Sprintf(t.where, strings.Join(hashes, ", ")) + tail
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", t.name, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, finalizeFirstSeen, fromHeight, toHeight); err != nil {
+			return fmt.Errorf("failed to record first seen addresses: %w", err)
+		}
+		for _, b := range blocks {
+			if err := linkSpendsOfBlock(ctx, tx, b.Hash); err != nil {
+				return err
+			}
+			if err := linkSpentOutputsOfBlock(ctx, tx, b.Hash); err != nil {
+				return err
+			}
+			if err := upsertAddressStats(ctx, tx, b.Hash, b.Height); err != nil {
+				return fmt.Errorf("failed to update address stats: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// CopyKeyedTables copies the price data, address labels and block stats
+// the destination doesn't store yet.
+func (s *SyncSource) CopyKeyedTables(ctx context.Context) error {
+	s.db.writeMu.Lock()
+	defer s.db.writeMu.Unlock()
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, table := range syncKeyedTables {
+			columns := strings.Join(s.columns[table], ", ")
+			if columns == "" {
+				continue
+			}
+			query := `INSERT OR IGNORE INTO ` + table + ` (` + columns + `) SELECT ` + columns + ` FROM sync_source.` + table
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SyncSource) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// linkSpendsOfBlock links the stored outputs the inputs of the block with
+// blockHash spend to them.
+func linkSpendsOfBlock(ctx context.Context, e execer, blockHash string) error {
+	query := `UPDATE tx_outputs
+	SET spent_txid = i.txid_spending, spent_vout = i.vout
+	FROM tx_inputs i, transactions t
+	WHERE i.prev_txid = tx_outputs.txid AND i.prev_vout = tx_outputs.vout
+		AND t.txid = i.txid_spending AND t.block_hash = ?`
+
+	if _, err := e.ExecContext(ctx, query, blockHash); err != nil {
+		return fmt.Errorf("failed to link spends of block %s: %w", blockHash, err)
+	}
+	return nil
+}
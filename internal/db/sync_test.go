@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	forEachDriver(t, testSync)
+}
+
+// testSync copies the blocks a source database has into one missing a
+// block, storing another at a height and only the header at another, and
+// checks that the result reads the same as a database that stored the
+// source's blocks itself.
+func testSync(t *testing.T, driver string) {
+	ctx := context.Background()
+	c := newTestChain()
+	c.watch = map[string]bool{"A": true}
+	b1, coinbase := c.block(1, 0, testTx{outs: []testOut{{"miner", 5000}}})
+	b2, outs := c.block(2, 0,
+		testTx{outs: []testOut{{"miner", 5000}}},
+		testTx{ins: coinbase[0], outs: []testOut{{"A", 4000}, {"B", 900}}},
+	)
+	b3, _ := c.block(3, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: outs[1][:1], outs: []testOut{{"C", 3900}}})
+	orphan, _ := c.block(3, 1, testTx{outs: []testOut{{"D", 5000}}})
+	b4, _ := c.block(4, 0, testTx{outs: []testOut{{"miner", 5000}}}, testTx{ins: outs[1][1:], outs: []testOut{{"A", 800}}})
+	header := *b4.Block
+
+	labels := []*models.AddressLabel{{Address: "A", Label: "Exchange", Category: models.LabelExchange}}
+	price := func(day int, price float64) *models.PriceData {
+		return &models.PriceData{Timestamp: c.genesis.AddDate(0, 0, day), Price: price, Source: "test", FetchedAt: c.genesis}
+	}
+	populate := func(db *DB, prices ...*models.PriceData) {
+		if err := db.InsertPriceDataBatch(prices); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpsertAddressLabels(labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sourcePath := filepath.Join(t.TempDir(), "source.db")
+	store, err := Open(driver, sourcePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := store.(*DB)
+	storeBlocks(t, source, false, b1, b2, b3, b4)
+	populate(source, price(0, 42000), price(1, 43000))
+	source.Close()
+
+	// Reorged the same way, which leaves the addresses of the orphan first
+	// seen
+	want := newTestDB(t, driver)
+	storeBlocks(t, want, false, b1, b2, orphan)
+	storeBlocks(t, want, true, b3)
+	storeBlocks(t, want, false, b4)
+	populate(want, price(0, 41000), price(1, 43000))
+
+	db := newTestDB(t, driver)
+	storeBlocks(t, db, false, b1, orphan)
+	if _, err := db.InsertBlockHeaders(ctx, []*models.Block{&header}); err != nil {
+		t.Fatal(err)
+	}
+	// The destination keeps its own price at the same time
+	populate(db, price(0, 41000))
+
+	s, err := db.AttachSyncSource(ctx, sourcePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	describe := func(plan *models.SyncPlan) string {
+		got := ""
+		for _, b := range plan.Blocks {
+			got += fmt.Sprintf("%d:%v ", b.Height, b.Replace)
+		}
+		for _, c := range plan.Conflicts {
+			got += fmt.Sprintf("conflict %d %s/%s ", c.Height, c.SourceHash[56:], c.DestHash[56:])
+		}
+		return got
+	}
+	plan, err := s.Plan(ctx, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(plan), "2:false 4:true conflict 3 00000000/00000001 "; got != want {
+		t.Errorf("plan %q, want %q", got, want)
+	}
+	if plan, err = s.Plan(ctx, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describe(plan), "3:true 4:true conflict 3 00000000/00000001 "; got != want {
+		t.Errorf("plan from height 3 preferring the source %q, want %q", got, want)
+	}
+	if plan, err = s.Plan(ctx, 0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// In two batches, the second spending an output of the first
+	if err := s.CopyBlocks(ctx, plan.Blocks[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CopyBlocks(ctx, plan.Blocks[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CopyKeyedTables(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = s.Plan(ctx, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := describe(plan); got != "" {
+		t.Errorf("plan after the sync %q, want none", got)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	reads := []struct {
+		name string
+		read func(db *DB) (any, error)
+	}{
+		{"GetProcessedBlocks", func(db *DB) (any, error) { return db.GetProcessedBlocks(0, 10) }},
+		{"GetHeadersOnlyHeights", func(db *DB) (any, error) { return db.GetHeadersOnlyHeights(0, 10) }},
+		{"GetTopAddresses", func(db *DB) (any, error) { return db.GetTopAddresses(100) }},
+		{"GetNewAddressesPerDay", func(db *DB) (any, error) { return db.GetNewAddressesPerDay(from, to) }},
+		{"GetWatchlistByDay", func(db *DB) (any, error) { return db.GetWatchlistByDay(from, to, "") }},
+		{"GetFlowsByLabel", func(db *DB) (any, error) { return db.GetFlowsByLabel(from, to) }},
+		{"GetPriceData", func(db *DB) (any, error) { return db.GetPriceData() }},
+		{"GetUnspentOutputs", func(db *DB) (any, error) {
+			var unspent []*models.TxOutput
+			for _, address := range []string{"miner", "A", "B", "C", "D"} {
+				outputs, err := db.GetUnspentOutputs(address)
+				if err != nil {
+					return nil, err
+				}
+				unspent = append(unspent, outputs...)
+			}
+			return unspent, nil
+		}},
+		{"spent outputs", func(db *DB) (any, error) {
+			rows, err := db.conn.Query(`SELECT txid, vout, spent_txid, spent_vout FROM tx_outputs WHERE spent_txid IS NOT NULL ORDER BY txid, vout`)
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+			var spent []string
+			for rows.Next() {
+				var txid, spentTxid string
+				var vout, spentVout int
+				if err := rows.Scan(&txid, &vout, &spentTxid, &spentVout); err != nil {
+					return nil, err
+				}
+				spent = append(spent, fmt.Sprintf("%s:%d>%s:%d", txid[60:], vout, spentTxid[60:], spentVout))
+			}
+			return spent, rows.Err()
+		}},
+	}
+	for _, r := range reads {
+		got, err := r.read(db)
+		if err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		expected, err := r.read(want)
+		if err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(expected)
+			t.Errorf("%s after the sync:\n got %s\nwant %s", r.name, gotJSON, wantJSON)
+		}
+	}
+}
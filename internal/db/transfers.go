@@ -0,0 +1,68 @@
+package db
+
+import (
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// selectDailyTransfers sums the blocks and the non-coinbase transactions of
+// each day. change holds the largest output of each transaction with
+// several, the presumed change; transactions whose outputs aren't stored,
+// as with the minimal profile, have none.
+const selectDailyTransfers = `
+WITH change AS (
+	SELECT o.txid, MAX(o.value) AS value
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	WHERE t.timestamp >= ? AND t.timestamp < ? AND NOT t.is_coinbase
+	GROUP BY o.txid
+	HAVING COUNT(*) > 1
+), transfers AS (
+	SELECT
+		date_trunc('day', t.timestamp) AS day,
+		SUM(t.output_value) AS value,
+		SUM(t.output_value - COALESCE(c.value, 0)) AS value_ex_change
+	FROM transactions t
+	LEFT JOIN change c ON c.txid = t.txid
+	WHERE t.timestamp >= ? AND t.timestamp < ? AND NOT t.is_coinbase
+	GROUP BY day
+), daily AS (
+	SELECT
+		date_trunc('day', timestamp) AS day,
+		MAX(height) AS last_height,
+		SUM(total_fees) AS fees,
+		SUM(COALESCE(subsidy, 0)) AS subsidy
+	FROM blocks
+	WHERE timestamp >= ? AND timestamp < ?
+	GROUP BY day
+)
+SELECT
+	d.day, d.last_height,
+	CAST(d.fees AS BIGINT),
+	CAST(d.subsidy AS BIGINT),
+	CAST(COALESCE(t.value, 0) AS BIGINT),
+	CAST(COALESCE(t.value_ex_change, 0) AS BIGINT)
+FROM daily d
+LEFT JOIN transfers t ON t.day = d.day
+ORDER BY d.day`
+
+// GetDailyTransfers returns the fees, subsidies and transferred value of the
+// blocks of each day in [from, to) that has any.
+func (db *DB) GetDailyTransfers(from, to time.Time) ([]*models.DailyTransfers, error) {
+	rows, err := db.conn.Query(selectDailyTransfers, from, to, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*models.DailyTransfers
+	for rows.Next() {
+		t := &models.DailyTransfers{}
+		if err := rows.Scan(scanTime(&t.Day), &t.LastHeight, &t.Fees, &t.Subsidy, &t.Value, &t.ValueExChange); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+
+	return transfers, rows.Err()
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+)
+
+// markSpentChunkSize bounds the number of rows in one UPDATE statement.
+const markSpentChunkSize = 1000
+
+// MarkOutputsSpent records which input spends each of the given outputs.
+// Outputs that aren't stored (created outside the scraped range) are left
+// untouched.
+func (db *DB) MarkOutputsSpent(ctx context.Context, spends []*models.SpentOutput) error {
+	return markOutputsSpent(ctx, db.conn, spends)
+}
+
+func markOutputsSpent(ctx context.Context, e execer, spends []*models.SpentOutput) error {
+	for start := 0; start < len(spends); start += markSpentChunkSize {
+		end := start + markSpentChunkSize
+		if end > len(spends) {
+			end = len(spends)
+		}
+
+		// DuckDB fails to commit UPDATE ... FROM (VALUES ...) when the values
+		// are bound parameters, so they are inlined. Txids are hex strings.
+		// The values are named in a CTE since SQLite can't name the columns
+		// of a subquery.
+		values := make([]string, 0, end-start)
+		for _, s := range spends[start:end] {
+			values = append(values, fmt.Sprintf("(%s, %d, %s, %d)",
+				quoteLiteral(s.PrevTxid), s.PrevVout, quoteLiteral(s.SpendingTxid), s.SpendingVin))
+		}
+
+		query := `WITH s(prev_txid, prev_vout, spending_txid, spending_vin) AS (VALUES ` + strings.Join(values, ", ") + `)
+		UPDATE tx_outputs
+		SET spent_txid = s.spending_txid, spent_vout = s.spending_vin
+		FROM s
+		WHERE tx_outputs.txid = s.prev_txid AND tx_outputs.vout = s.prev_vout`
+
+		if _, err := e.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to mark outputs spent: %w", err)
+		}
+	}
+	return nil
+}
+
+// LinkSpentOutputsOfBlock links the outputs created by a block to inputs
+// that were stored before it, which happens when blocks are processed out of
+// order.
+func (db *DB) LinkSpentOutputsOfBlock(ctx context.Context, blockHash string) error {
+	return linkSpentOutputsOfBlock(ctx, db.conn, blockHash)
+}
+
+func linkSpentOutputsOfBlock(ctx context.Context, e execer, blockHash string) error {
+	query := `UPDATE tx_outputs
+	SET spent_txid = i.txid_spending, spent_vout = i.vout
+	FROM tx_inputs i, transactions t
+	WHERE i.prev_txid = tx_outputs.txid AND i.prev_vout = tx_outputs.vout
+		AND t.txid = tx_outputs.txid AND t.block_hash = ?
+		AND tx_outputs.spent_txid IS NULL`
+
+	if _, err := e.ExecContext(ctx, query, blockHash); err != nil {
+		return fmt.Errorf("failed to link outputs of block %s: %w", blockHash, err)
+	}
+	return nil
+}
+
+// GetUnspentOutputs returns the stored outputs paying to address that have
+// not been spent by any stored input.
+func (db *DB) GetUnspentOutputs(address string) ([]*models.TxOutput, error) {
+	query := `SELECT txid, vout, value, COALESCE(script_pub_key, ''), COALESCE(script_type, ''), address
+	FROM tx_outputs
+	WHERE address = ? AND spent_txid IS NULL
+	ORDER BY txid, vout`
+
+	rows, err := db.conn.Query(query, address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outputs []*models.TxOutput
+	for rows.Next() {
+		o := &models.TxOutput{}
+		if err := rows.Scan(&o.Txid, &o.Vout, &o.Value, &o.ScriptPubKey, &o.ScriptType, &o.Address); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+
+	return outputs, rows.Err()
+}
+
+// GetUTXOSetSize returns the number and value of outputs created at or below
+// atHeight that were not spent at or below it.
+func (db *DB) GetUTXOSetSize(atHeight int64) (*models.UTXOSetSize, error) {
+	query := `SELECT COUNT(*), CAST(COALESCE(SUM(o.value), 0) AS BIGINT)
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	LEFT JOIN transactions st ON st.txid = o.spent_txid
+	WHERE t.block_height <= ?
+		AND (o.spent_txid IS NULL OR st.block_height > ?)`
+
+	size := &models.UTXOSetSize{Height: atHeight}
+	if err := db.conn.QueryRow(query, atHeight, atHeight).Scan(&size.Count, &size.Value); err != nil {
+		return nil, err
+	}
+	return size, nil
+}
+
+// utxoAgeBands are the labels of the bands returned by GetUTXOAgeBands, in the
+// order of the band index computed by selectUTXOAgeBands.
+var utxoAgeBands = []string{"<1d", "1d-1w", "1w-1m", "1m-3m", "3m-6m", "6m-1y", "1y-2y", "2y+"}
+
+const selectUTXOAgeBands = `
+WITH as_of AS (SELECT timestamp FROM blocks WHERE height = ?)
+SELECT
+	CASE
+		WHEN age < 86400 THEN 0
+		WHEN age < 7 * 86400 THEN 1
+		WHEN age < 30 * 86400 THEN 2
+		WHEN age < 90 * 86400 THEN 3
+		WHEN age < 180 * 86400 THEN 4
+		WHEN age < 365 * 86400 THEN 5
+		WHEN age < 730 * 86400 THEN 6
+		ELSE 7
+	END AS band,
+	COUNT(*),
+	CAST(SUM(value) AS BIGINT)
+FROM (
+	SELECT o.value, date_diff('second', t.timestamp, as_of.timestamp) AS age
+	FROM tx_outputs o
+	JOIN transactions t ON t.txid = o.txid
+	LEFT JOIN transactions st ON st.txid = o.spent_txid
+	CROSS JOIN as_of
+	WHERE t.block_height <= ?
+		AND (o.spent_txid IS NULL OR st.block_height > ?)
+) utxos
+GROUP BY band`
+
+// GetUTXOAgeBands buckets the outputs unspent at height by their age relative
+// to the timestamp of the block at height. Every band is returned, in order
+// from youngest to oldest, and percentages are of the total unspent value in
+// the scraped range. The block at height must be stored.
+func (db *DB) GetUTXOAgeBands(height int64) ([]*models.UTXOAgeBand, error) {
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT COUNT(*) > 0 FROM blocks WHERE height = ?`, height).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("block %d is not stored", height)
+	}
+
+	bands := make([]*models.UTXOAgeBand, len(utxoAgeBands))
+	for i, label := range utxoAgeBands {
+		bands[i] = &models.UTXOAgeBand{Band: label}
+	}
+
+	rows, err := db.conn.Query(selectUTXOAgeBands, height, height, height)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var total int64
+	for rows.Next() {
+		var band int
+		var count, value int64
+		if err := rows.Scan(&band, &count, &value); err != nil {
+			return nil, err
+		}
+		bands[band].Count = count
+		bands[band].Value = value
+		total += value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if total > 0 {
+		for _, b := range bands {
+			b.Percent = float64(b.Value) / float64(total) * 100
+		}
+	}
+	return bands, nil
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+func insertWatchedActivity(ctx context.Context, e execer, watched []*models.WatchedActivity, replace bool) error {
+	query, tail := insertQuery("watched_activity", []string{"block_hash", "txid", "direction", "n"}, watchedColumns, replace)
+	err := insertRows(ctx, e, query, "(?, ?, ?, ?, ?, ?, ?, ?)", tail, len(watched), func(i int) []any {
+		w := watched[i]
+		return []any{w.Address, w.Txid, w.N, string(w.Direction), w.Value, w.BlockHash, w.BlockHeight, w.Timestamp}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert watched activity: %w", err)
+	}
+	return nil
+}
+
+// GetWatchlistByDay sums the inflows and outflows of each watched address
+// per day in the given time range, of address alone if it isn't empty, with
+// the label of the address.
+func (db *DB) GetWatchlistByDay(from, to time.Time, address string) ([]*models.WatchlistDailyStats, error) {
+	rows, err := db.conn.Query(`SELECT
+		date_trunc('day', w.timestamp) AS day,
+		w.address,
+		COALESCE(l.label, ''),
+		COUNT(*) FILTER (WHERE w.direction = ?),
+		CAST(COALESCE(SUM(w.value) FILTER (WHERE w.direction = ?), 0) AS BIGINT),
+		COUNT(*) FILTER (WHERE w.direction = ?),
+		CAST(COALESCE(SUM(w.value) FILTER (WHERE w.direction = ?), 0) AS BIGINT)
+	FROM watched_activity w
+	LEFT JOIN address_labels l ON l.address = w.address
+	WHERE w.timestamp >= ? AND w.timestamp < ? AND (? = '' OR w.address = ?)
+	GROUP BY day, w.address, l.label
+	ORDER BY day, w.address`,
+		string(models.DirectionIn), string(models.DirectionIn), string(models.DirectionOut), string(models.DirectionOut),
+		from, to, address, address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []*models.WatchlistDailyStats
+	for rows.Next() {
+		s := &models.WatchlistDailyStats{}
+		if err := rows.Scan(scanTime(&s.Day), &s.Address, &s.Label, &s.Inflows, &s.Received, &s.Outflows, &s.Sent); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
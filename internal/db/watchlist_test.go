@@ -0,0 +1,62 @@
+package db
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+	"testing"
+)
+
+func TestWatchlist(t *testing.T) {
+	forEachDriver(t, testWatchlist)
+}
+
+// testWatchlist stores the activity of two watched addresses over two days
+// and drops that of blocks replaced by a reorg or deleted.
+func testWatchlist(t *testing.T, driver string) {
+	c := newTestChain()
+	c.watch = map[string]bool{"A": true, "B": true}
+	db := newTestDB(t, driver)
+
+	b1, outs := c.block(1, 0, testTx{outs: []testOut{{"A", 5000}, {"A", 3000}, {"miner", 100}}})
+	b2, _ := c.block(2, 0, testTx{ins: outs[0][:1], outs: []testOut{{"B", 4000}, {"C", 900}}})
+	b144, _ := c.block(144, 0, testTx{ins: outs[0][1:2], outs: []testOut{{"C", 2900}}})
+	storeBlocks(t, db, false, b1, b2, b144)
+
+	from, to := c.genesis, c.genesis.AddDate(0, 0, 7)
+	watchlist := func(address string) string {
+		stats, err := db.GetWatchlistByDay(from, to, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range stats {
+			got = append(got, fmt.Sprintf("%s %s %d/%d %d/%d", s.Day.Format("01-02"), s.Address, s.Inflows, s.Received, s.Outflows, s.Sent))
+		}
+		return strings.Join(got, "; ")
+	}
+	if got, want := watchlist(""), "01-01 A 2/8000 1/5000; 01-01 B 1/4000 0/0; 01-02 A 0/0 1/3000"; got != want {
+		t.Errorf("watchlist %q, want %q", got, want)
+	}
+	if got, want := watchlist("B"), "01-01 B 1/4000 0/0"; got != want {
+		t.Errorf("watchlist of B %q, want %q", got, want)
+	}
+
+	// A reorg replaces block 2 with one spending A's output to C alone
+	reorged, _ := c.block(2, 1, testTx{ins: outs[0][:1], outs: []testOut{{"C", 4900}}})
+	storeBlocks(t, db, true, reorged)
+	if got, want := watchlist(""), "01-01 A 2/8000 1/5000; 01-02 A 0/0 1/3000"; got != want {
+		t.Errorf("after the reorg: watchlist %q, want %q", got, want)
+	}
+	if err := db.DeleteBlockData(144); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := watchlist(""), "01-01 A 2/8000 1/5000"; got != want {
+		t.Errorf("after deleting block 144: watchlist %q, want %q", got, want)
+	}
+
+	var n int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM watched_activity WHERE direction = ?`, string(models.DirectionOut)).Scan(&n); err != nil || n != 1 {
+		t.Errorf("%d outflows stored, %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package notify posts the events of a run, such as its end or a failure
+// rate above the threshold, as JSON to a webhook.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	RunStarted          = "run_started"
+	RunCompleted        = "run_completed"
+	BlockFailed         = "block_failed"
+	FailureRateExceeded = "failure_rate_exceeded"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the body with the secret,
+// prefixed with sha256=, when the notifier has a secret.
+const SignatureHeader = "X-Scrapbtc-Signature"
+
+const (
+	maxAttempts  = 4
+	initialDelay = time.Second
+	postTimeout  = 10 * time.Second
+)
+
+// Event is the JSON body of a webhook. Text summarizes it in a line, so
+// chat webhooks such as Slack's show something readable; the other fields
+// are set depending on Type.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+
+	RunID       int64 `json:"run_id,omitempty"`
+	StartHeight int64 `json:"start_height,omitempty"`
+	EndHeight   int64 `json:"end_height,omitempty"`
+	TotalBlocks int64 `json:"total_blocks,omitempty"`
+
+	// Status and Error are the end of the run on run_completed
+	Status  string   `json:"status,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Summary *Summary `json:"summary,omitempty"`
+
+	// Failures are the blocks failed since the last block_failed, up to
+	// maxListedFailures of the Failed ones
+	Failures []Failure `json:"failures,omitempty"`
+	Failed   int64     `json:"failed,omitempty"`
+
+	// FailureRate is the percentage of the blocks attempted so far that
+	// failed, on failure_rate_exceeded
+	FailureRate   float64 `json:"failure_rate,omitempty"`
+	FailThreshold float64 `json:"fail_threshold,omitempty"`
+}
+
+// Summary is what a run got done.
+type Summary struct {
+	Completed       int64   `json:"completed"`
+	Failed          int64   `json:"failed"`
+	Transactions    int64   `json:"transactions"`
+	ElapsedSeconds  float64 `json:"elapsed_seconds"`
+	BlocksPerMinute float64 `json:"blocks_per_minute"`
+}
+
+type Failure struct {
+	Height int64  `json:"height"`
+	Error  string `json:"error"`
+}
+
+// Notifier posts events to a webhook URL. A post that fails with a network
+// error or a 5xx or 429 response is retried with exponential backoff.
+type Notifier struct {
+	url    string
+	secret string
+	client *http.Client
+	delay  time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+// New returns a notifier posting to url, signing the bodies with secret
+// unless it is empty.
+func New(url, secret string) *Notifier {
+	return &Notifier{url: url, secret: secret, client: &http.Client{Timeout: postTimeout}, delay: initialDelay}
+}
+
+// Send posts e, stamped with the current time if it has none. The first
+// error of any Send is also kept for Err.
+func (n *Notifier) Send(ctx context.Context, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	err := n.post(ctx, e)
+	if err != nil {
+		err = fmt.Errorf("failed to send the %s webhook: %w", e.Type, err)
+		n.mu.Lock()
+		if n.err == nil {
+			n.err = err
+		}
+		n.mu.Unlock()
+	}
+	return err
+}
+
+// Err returns the first error of a Send, so webhooks that went missing can
+// be reported at the end of the run without disturbing the progress UI.
+func (n *Notifier) Err() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.err
+}
+
+func (n *Notifier) post(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	delay := n.delay
+	for attempt := 1; ; attempt++ {
+		retry, err := n.postOnce(ctx, body)
+		if err == nil || !retry || attempt == maxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// postOnce posts body once and reports whether a failure is worth retrying.
+func (n *Notifier) postOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"scrapbtc/internal/processor"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhook records the events posted to it, failing the first fail posts
+// with a 503. Posts must be signed with secret, if any.
+type webhook struct {
+	t      *testing.T
+	secret string
+	fail   int
+
+	mu     sync.Mutex
+	posts  int
+	events []Event
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.t.Error(err)
+		return
+	}
+	want := ""
+	if h.secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		mac.Write(body)
+		want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	if got := r.Header.Get(SignatureHeader); got != want {
+		h.t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.posts++
+	if h.posts <= h.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		h.t.Error(err)
+	}
+	h.events = append(h.events, e)
+}
+
+func newTestNotifier(t *testing.T, h *webhook) *Notifier {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	n := New(server.URL, h.secret)
+	n.delay = time.Millisecond
+	return n
+}
+
+// TestSendRetries posts an event the webhook only accepts on the third
+// attempt, then one it never accepts.
+func TestSendRetries(t *testing.T) {
+	h := &webhook{t: t, secret: "s3cret", fail: 2}
+	n := newTestNotifier(t, h)
+	if err := n.Send(context.Background(), Event{Type: RunStarted, RunID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if h.posts != 3 || len(h.events) != 1 || h.events[0].RunID != 7 || h.events[0].Time.IsZero() {
+		t.Errorf("%d posts delivered %+v, want the event on the third", h.posts, h.events)
+	}
+	if n.Err() != nil {
+		t.Errorf("Err() = %v after a delivered event", n.Err())
+	}
+
+	h.fail = 100
+	if err := n.Send(context.Background(), Event{Type: RunCompleted}); err == nil {
+		t.Error("Send() succeeded against a failing webhook")
+	}
+	if h.posts != 3+maxAttempts {
+		t.Errorf("%d posts after a failing event, want %d attempts", h.posts-3, maxAttempts)
+	}
+	if n.Err() == nil {
+		t.Error("Err() = nil after a failed event")
+	}
+}
+
+// TestWatch fails every block after the first ten, like a node that went
+// down. That must make a single failure_rate_exceeded and, with the batch
+// interval not yet over, a single block_failed at the end.
+func TestWatch(t *testing.T) {
+	h := &webhook{t: t}
+	n := newTestNotifier(t, h)
+	updates := make(chan processor.ProgressUpdate)
+	go func() {
+		for height := range int64(10) {
+			updates <- processor.ProgressUpdate{BlockHeight: height, Status: "processing"}
+			updates <- processor.ProgressUpdate{BlockHeight: height, Status: "completed", TxCount: 3}
+		}
+		for height := int64(10); height < 500; height++ {
+			updates <- processor.ProgressUpdate{BlockHeight: height, Status: "failed", Error: errors.New("connection refused")}
+		}
+		close(updates)
+	}()
+	summary := n.Watch(context.Background(), updates, 5)
+
+	if summary.Completed != 10 || summary.Failed != 490 || summary.Transactions != 30 {
+		t.Errorf("summary = %+v, want 10 completed with 30 transactions and 490 failed", summary)
+	}
+	if len(h.events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(h.events), h.events)
+	}
+	if e := h.events[0]; e.Type != FailureRateExceeded || e.FailureRate != 50 || e.FailThreshold != 5 {
+		t.Errorf("first event = %+v, want the failure rate of 50%% at 20 blocks", e)
+	}
+	e := h.events[1]
+	if e.Type != BlockFailed || e.Failed != 490 || len(e.Failures) != maxListedFailures ||
+		e.Failures[0] != (Failure{Height: 10, Error: "connection refused"}) {
+		t.Errorf("second event = %s with %d failed and %d listed, want block_failed with 490 and %d",
+			e.Type, e.Failed, len(e.Failures), maxListedFailures)
+	}
+}
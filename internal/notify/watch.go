@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/processor"
+	"time"
+)
+
+const (
+	// failureBatchInterval is how often block_failed events are sent at
+	// most, each listing the blocks failed since the last one
+	failureBatchInterval = time.Minute
+	maxListedFailures    = 100
+	// minRateBlocks is the number of blocks a run attempts before its
+	// failure rate is checked, so the first failure isn't 100%
+	minRateBlocks = 20
+	// rateAlertInterval is the time between two failure_rate_exceeded
+	// events, when the rate drops below the threshold and rises again
+	rateAlertInterval = 15 * time.Minute
+)
+
+// watcher turns progress updates into events, keeping the failures from
+// flooding the webhook: a node that went down fails every block, but that
+// makes one block_failed per minute and one failure_rate_exceeded.
+type watcher struct {
+	n             *Notifier
+	failThreshold float64
+	batchInterval time.Duration
+	rateInterval  time.Duration
+
+	summary   Summary
+	failures  []Failure
+	failed    int64
+	exceeded  bool
+	lastAlert time.Time
+}
+
+// Watch sends block_failed and failure_rate_exceeded events for the updates
+// until the channel is closed, and returns the summary of the run for its
+// run_completed event. The failure rate is checked against failThreshold,
+// a percentage, like the terminal UI does. Events that can't be sent are
+// left for Err.
+func (n *Notifier) Watch(ctx context.Context, updates <-chan processor.ProgressUpdate, failThreshold float64) Summary {
+	w := &watcher{n: n, failThreshold: failThreshold, batchInterval: failureBatchInterval, rateInterval: rateAlertInterval}
+	return w.run(ctx, updates)
+}
+
+func (w *watcher) run(ctx context.Context, updates <-chan processor.ProgressUpdate) Summary {
+	start := time.Now()
+	ticker := time.NewTicker(w.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				w.sendFailures(ctx)
+				w.summary.ElapsedSeconds = time.Since(start).Seconds()
+				if minutes := time.Since(start).Minutes(); minutes > 0 {
+					w.summary.BlocksPerMinute = float64(w.summary.Completed) / minutes
+				}
+				return w.summary
+			}
+			w.record(ctx, u)
+		case <-ticker.C:
+			w.sendFailures(ctx)
+		}
+	}
+}
+
+func (w *watcher) record(ctx context.Context, u processor.ProgressUpdate) {
+	switch u.Status {
+	case "completed":
+		w.summary.Completed++
+		w.summary.Transactions += int64(u.TxCount)
+	case "failed":
+		w.summary.Failed++
+		w.failed++
+		if len(w.failures) < maxListedFailures {
+			f := Failure{Height: u.BlockHeight}
+			if u.Error != nil {
+				f.Error = u.Error.Error()
+			}
+			w.failures = append(w.failures, f)
+		}
+	default:
+		return
+	}
+	w.checkRate(ctx)
+}
+
+// checkRate sends failure_rate_exceeded when the rate rises above the
+// threshold, unless it did so less than rateInterval ago.
+func (w *watcher) checkRate(ctx context.Context) {
+	attempted := w.summary.Completed + w.summary.Failed
+	if attempted < minRateBlocks {
+		return
+	}
+	rate := float64(w.summary.Failed) / float64(attempted) * 100
+	if rate <= w.failThreshold {
+		w.exceeded = false
+		return
+	}
+	if w.exceeded || time.Since(w.lastAlert) < w.rateInterval {
+		return
+	}
+	w.exceeded, w.lastAlert = true, time.Now()
+	w.n.Send(ctx, Event{
+		Type:          FailureRateExceeded,
+		Text:          fmt.Sprintf("%.1f%% of the %d blocks attempted failed (threshold %.1f%%)", rate, attempted, w.failThreshold),
+		Summary:       &Summary{Completed: w.summary.Completed, Failed: w.summary.Failed, Transactions: w.summary.Transactions},
+		FailureRate:   rate,
+		FailThreshold: w.failThreshold,
+	})
+}
+
+// sendFailures sends the blocks failed since the last block_failed, if any.
+func (w *watcher) sendFailures(ctx context.Context) {
+	if w.failed == 0 {
+		return
+	}
+	text := fmt.Sprintf("Block %d failed: %s", w.failures[0].Height, w.failures[0].Error)
+	if w.failed > 1 {
+		text = fmt.Sprintf("%d blocks failed, the first at height %d: %s", w.failed, w.failures[0].Height, w.failures[0].Error)
+	}
+	w.n.Send(ctx, Event{Type: BlockFailed, Text: text, Failures: w.failures, Failed: w.failed})
+	w.failures, w.failed = nil, 0
+}
@@ -0,0 +1,164 @@
+// Package price fetches the bitcoin price from public sources, for the
+// price_data table.
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"time"
+)
+
+// Sources lists the names NewSource accepts.
+var Sources = []string{CoinGecko}
+
+// CoinGecko is the name of the CoinGecko source, which is also stored as
+// the source of its prices.
+const CoinGecko = "coingecko"
+
+const (
+	coinGeckoURL   = "https://api.coingecko.com/api/v3"
+	requestTimeout = 30 * time.Second
+	// maxResponseSize bounds a response; a day of history is a few kB.
+	maxResponseSize = 4 << 20
+)
+
+// Source fetches prices in USD.
+type Source interface {
+	// Name is stored as the source of the prices.
+	Name() string
+	// Latest returns the current price.
+	Latest(ctx context.Context) (*models.PriceData, error)
+	// History returns the price points in [from, to), oldest first.
+	History(ctx context.Context, from, to time.Time) ([]*models.PriceData, error)
+}
+
+// NewSource returns the source called name, one of Sources.
+func NewSource(name string) (Source, error) {
+	switch name {
+	case CoinGecko:
+		return &coinGecko{baseURL: coinGeckoURL, client: &http.Client{Timeout: requestTimeout}}, nil
+	}
+	return nil, fmt.Errorf("unknown price source %q", name)
+}
+
+// coinGecko uses the public CoinGecko API, which needs no key at low
+// request rates.
+type coinGecko struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (c *coinGecko) Name() string { return CoinGecko }
+
+func (c *coinGecko) Latest(ctx context.Context) (*models.PriceData, error) {
+	var reply struct {
+		Bitcoin *struct {
+			USD          float64 `json:"usd"`
+			MarketCap    float64 `json:"usd_market_cap"`
+			Volume       float64 `json:"usd_24h_vol"`
+			LastUpdateAt int64   `json:"last_updated_at"`
+		} `json:"bitcoin"`
+	}
+	query := url.Values{
+		"ids":                     {"bitcoin"},
+		"vs_currencies":           {"usd"},
+		"include_market_cap":      {"true"},
+		"include_24hr_vol":        {"true"},
+		"include_last_updated_at": {"true"},
+	}
+	if err := c.get(ctx, "/simple/price", query, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Bitcoin == nil || reply.Bitcoin.USD <= 0 {
+		return nil, fmt.Errorf("coingecko returned no bitcoin price")
+	}
+	now := time.Now().UTC()
+	ts := now
+	if reply.Bitcoin.LastUpdateAt > 0 {
+		ts = time.Unix(reply.Bitcoin.LastUpdateAt, 0).UTC()
+	}
+	return &models.PriceData{
+		Timestamp: ts,
+		Price:     reply.Bitcoin.USD,
+		MarketCap: int64(reply.Bitcoin.MarketCap),
+		Volume24h: int64(reply.Bitcoin.Volume),
+		Source:    CoinGecko,
+		FetchedAt: now,
+	}, nil
+}
+
+func (c *coinGecko) History(ctx context.Context, from, to time.Time) ([]*models.PriceData, error) {
+	// Each series is a list of [unix milliseconds, value]
+	var reply struct {
+		Prices     [][2]float64 `json:"prices"`
+		MarketCaps [][2]float64 `json:"market_caps"`
+		Volumes    [][2]float64 `json:"total_volumes"`
+	}
+	query := url.Values{
+		"vs_currency": {"usd"},
+		"from":        {strconv.FormatInt(from.Unix(), 10)},
+		"to":          {strconv.FormatInt(to.Unix(), 10)},
+	}
+	if err := c.get(ctx, "/coins/bitcoin/market_chart/range", query, &reply); err != nil {
+		return nil, err
+	}
+
+	caps := make(map[int64]float64, len(reply.MarketCaps))
+	for _, p := range reply.MarketCaps {
+		caps[int64(p[0])] = p[1]
+	}
+	volumes := make(map[int64]float64, len(reply.Volumes))
+	for _, p := range reply.Volumes {
+		volumes[int64(p[0])] = p[1]
+	}
+	now := time.Now().UTC()
+	var prices []*models.PriceData
+	for _, p := range reply.Prices {
+		ms := int64(p[0])
+		ts := time.UnixMilli(ms).UTC()
+		if ts.Before(from) || !ts.Before(to) || p[1] <= 0 {
+			continue
+		}
+		prices = append(prices, &models.PriceData{
+			Timestamp: ts,
+			Price:     p[1],
+			MarketCap: int64(caps[ms]),
+			Volume24h: int64(volumes[ms]),
+			Source:    CoinGecko,
+			FetchedAt: now,
+		})
+	}
+	return prices, nil
+}
+
+// get requests path with query and decodes the JSON response into v.
+func (c *coinGecko) get(ctx context.Context, path string, query url.Values, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("coingecko request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read coingecko response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("coingecko returned %s: %.200s", resp.Status, data)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid coingecko response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCoinGecko parses the latest price and a day of history, with a
+// point outside the day, from responses shaped like CoinGecko's.
+func TestCoinGecko(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ms := func(h int) int64 { return day.Add(time.Duration(h) * time.Hour).UnixMilli() }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/simple/price", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ids") != "bitcoin" || r.URL.Query().Get("vs_currencies") != "usd" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"bitcoin": {"usd": 42000.5, "usd_market_cap": 8.2e11, "usd_24h_vol": 1.5e10, "last_updated_at": %d}}`, day.Unix())
+	})
+	mux.HandleFunc("/coins/bitcoin/market_chart/range", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("from") != fmt.Sprint(day.Unix()) {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"prices": [[%d, 42000], [%d, 43000], [%d, 44000]], "market_caps": [[%d, 8e11]], "total_volumes": [[%d, 2e10]]}`,
+			ms(0), ms(12), ms(24), ms(0), ms(12))
+	})
+	mux.HandleFunc("/limited/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"status": {"error_code": 429}}`, http.StatusTooManyRequests)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	source := &coinGecko{baseURL: server.URL, client: server.Client()}
+	p, err := source.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Timestamp.Equal(day) || p.Price != 42000.5 || p.MarketCap != 8.2e11 || p.Volume24h != 1.5e10 || p.Source != CoinGecko {
+		t.Errorf("Latest() = %+v", p)
+	}
+
+	history, err := source.History(context.Background(), day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range history {
+		got = append(got, fmt.Sprintf("%s %g %d %d", p.Timestamp.Format("15:04"), p.Price, p.MarketCap, p.Volume24h))
+	}
+	if want := fmt.Sprint([]string{"00:00 42000 800000000000 0", "12:00 43000 0 20000000000"}); fmt.Sprint(got) != want {
+		t.Errorf("History() = %v, want %v", got, want)
+	}
+
+	source.baseURL = server.URL + "/limited"
+	if _, err := source.Latest(context.Background()); err == nil {
+		t.Error("Latest() succeeded on a 429")
+	}
+}
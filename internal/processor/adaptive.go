@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxAdaptiveFetchers is the most fetchers adaptive concurrency scales
+	// up to; pass it as the number of workers to NewWorkerPool.
+	MaxAdaptiveFetchers = 32
+	// minAdaptiveFetchers is where adaptive concurrency starts and the
+	// lowest it backs off to.
+	minAdaptiveFetchers = 2
+	// DefaultTargetLatency is the mean RPC latency adaptive concurrency
+	// keeps below.
+	DefaultTargetLatency = time.Second
+	// concurrencyAdjustInterval is how often the fetcher limit is adjusted.
+	concurrencyAdjustInterval = 2 * time.Second
+)
+
+// fetchLimit bounds the number of blocks being fetched at once to a limit
+// that can change while fetchers wait. A nil limit is unlimited.
+type fetchLimit struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	// peak is the most fetches active at once since the last adjustment.
+	peak int
+}
+
+func newFetchLimit(limit int) *fetchLimit {
+	l := &fetchLimit{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until a fetch fits under the limit or ctx is done.
+func (l *fetchLimit) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.active++
+	l.peak = max(l.peak, l.active)
+	return nil
+}
+
+func (l *fetchLimit) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// set changes the limit, waking fetchers that now fit under it.
+func (l *fetchLimit) set(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// window returns the limit and the peak number of active fetches since the
+// previous call, and starts a new window.
+func (l *fetchLimit) window() (limit, peak int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit, peak = l.limit, l.peak
+	l.peak = l.active
+	return limit, peak
+}
+
+// current returns the limit, or zero for a nil limit.
+func (l *fetchLimit) current() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// nextLimit adjusts limit AIMD style: it is halved when requests failed or
+// their mean latency exceeded the target, and raised by one when latency is
+// fine and every allowed fetch was in use, so more could help.
+func nextLimit(limit, peak, maxLimit int, errors int64, mean, target time.Duration) int {
+	switch {
+	case errors > 0 || mean > target:
+		return max(limit/2, minAdaptiveFetchers)
+	case peak >= limit && limit < maxLimit:
+		return limit + 1
+	}
+	return limit
+}
+
+// adjustConcurrency adjusts the fetch limit from the RPC latency until stop
+// is closed. Every change is reported with a "concurrency" update.
+func (wp *WorkerPool) adjustConcurrency(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(concurrencyAdjustInterval)
+	defer ticker.Stop()
+	prev := wp.rpcClient.Latency()
+	for {
+		select {
+		case <-ticker.C:
+			cur := wp.rpcClient.Latency()
+			d := cur.Sub(prev)
+			prev = cur
+			limit, peak := wp.fetchLimit.window()
+			if d.Calls == 0 || wp.Paused() {
+				continue
+			}
+
+			next := nextLimit(limit, peak, wp.numWorkers, d.Errors, d.Mean(), wp.opts.TargetLatency)
+			if next == limit {
+				continue
+			}
+			wp.fetchLimit.set(next)
+			wp.send(ProgressUpdate{
+				Status: "concurrency",
+				DebugMsg: fmt.Sprintf("Fetchers %d -> %d (mean RPC latency %s over %d calls, %d errors)",
+					limit, next, d.Mean().Round(time.Millisecond), d.Calls, d.Errors),
+			})
+		case <-stop:
+			return
+		}
+	}
+}
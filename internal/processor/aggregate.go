@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"scrapbtc/pkg/models"
+	"sync"
+	"time"
+)
+
+// DefaultSnapshotInterval is how often a ProgressAggregator persists its
+// totals.
+const DefaultSnapshotInterval = 5 * time.Second
+
+// ProgressSaver persists progress snapshots; db.Store implements it.
+type ProgressSaver interface {
+	SaveRunProgress(p *models.RunProgress) error
+}
+
+// ProgressAggregator tallies the completed and failed blocks of a run from
+// its progress updates and saves a snapshot of the totals every interval,
+// so that the progress of a run can be followed from another process.
+// Snapshot may be called from any goroutine.
+type ProgressAggregator struct {
+	saver    ProgressSaver
+	interval time.Duration
+
+	mu       sync.Mutex
+	snapshot models.RunProgress
+	start    time.Time
+	err      error
+}
+
+// NewProgressAggregator returns an aggregator saving the progress of run
+// runID to saver every interval.
+func NewProgressAggregator(saver ProgressSaver, runID int64, interval time.Duration) *ProgressAggregator {
+	return &ProgressAggregator{
+		saver:    saver,
+		interval: interval,
+		snapshot: models.RunProgress{RunID: runID},
+		start:    time.Now(),
+	}
+}
+
+// Run tallies updates until the channel is closed, saving a snapshot every
+// interval and a last one at the end. Snapshots that can't be saved are
+// left for Err, the run goes on without them.
+func (a *ProgressAggregator) Run(updates <-chan ProgressUpdate) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				a.save()
+				return
+			}
+			a.record(u)
+		case <-ticker.C:
+			a.save()
+		}
+	}
+}
+
+func (a *ProgressAggregator) record(u ProgressUpdate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch u.Status {
+	case "completed":
+		a.snapshot.Processed++
+		a.snapshot.TotalTxs += int64(u.TxCount)
+	case "failed":
+		a.snapshot.Failed++
+	}
+}
+
+// Snapshot returns the current totals, with the rate of blocks completed per
+// minute since the aggregator was created.
+func (a *ProgressAggregator) Snapshot() models.RunProgress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.snapshot
+	s.UpdatedAt = models.Now()
+	if minutes := time.Since(a.start).Minutes(); minutes > 0 {
+		s.Rate = float64(s.Processed) / minutes
+	}
+	return s
+}
+
+func (a *ProgressAggregator) save() {
+	s := a.Snapshot()
+	err := a.saver.SaveRunProgress(&s)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.err = err
+}
+
+// Err returns the error of the last snapshot saved, if it failed.
+func (a *ProgressAggregator) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
@@ -0,0 +1,305 @@
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"slices"
+)
+
+// Fields that can be recomputed on already scraped data.
+const (
+	FieldFees       = "fees"
+	FieldFeeRate    = "fee-rate"
+	FieldSpentLinks = "spent-links"
+	FieldRBF        = "rbf"
+	FieldSegwit     = "segwit"
+	FieldIOHeights  = "io-heights"
+	FieldChainwork  = "chainwork"
+	FieldPrevouts   = "prevouts"
+	FieldCategories = "categories"
+)
+
+var BackfillFields = []string{FieldFees, FieldFeeRate, FieldSpentLinks, FieldRBF, FieldSegwit, FieldIOHeights, FieldChainwork, FieldPrevouts, FieldCategories}
+
+// Backfiller recomputes one derived field over stored blocks in height
+// ordered batches. Progress is saved after every batch so an interrupted run
+// over the same range continues where it left off.
+type Backfiller struct {
+	db        db.Store
+	rpcClient *rpc.Client
+	field     string
+	apply     func(ctx context.Context, fromHeight, toHeight int64) (int64, error)
+	batchSize int64
+	progress  chan ProgressUpdate
+	updates   <-chan ProgressUpdate
+}
+
+// NewBackfiller returns a backfiller for field. rpcClient is only used by
+// fields that may need to fetch blocks again and can be nil.
+func NewBackfiller(database db.Store, rpcClient *rpc.Client, field string, batchSize int64) (*Backfiller, error) {
+	b := newBackfiller(database, rpcClient, field, batchSize)
+	switch field {
+	case FieldFees:
+		b.apply = withoutContext(database.BackfillFees)
+	case FieldFeeRate:
+		b.apply = withoutContext(database.BackfillFeeRates)
+	case FieldSpentLinks:
+		b.apply = withoutContext(database.LinkSpentOutputsInRange)
+	case FieldRBF:
+		b.apply = withoutContext(database.BackfillRBF)
+	case FieldSegwit:
+		b.apply = b.backfillSegwit
+	case FieldIOHeights:
+		b.apply = withoutContext(database.BackfillIOHeights)
+	case FieldChainwork:
+		b.apply = b.backfillChainwork
+	case FieldPrevouts:
+		b.apply = withoutContext(database.ResolveInputs)
+	case FieldCategories:
+		b.apply = withoutContext(database.BackfillTxCategories)
+	default:
+		return nil, fmt.Errorf("unknown backfill field %q", field)
+	}
+	return b, nil
+}
+
+// NewProfileBackfiller returns a backfiller that fetches the completed
+// blocks again and stores them in place of their rows with opts, to bring
+// blocks stored with a smaller profile to opts.Profile. Its progress is
+// saved as field "profile-<profile>".
+func NewProfileBackfiller(database db.Store, rpcClient *rpc.Client, opts Options, batchSize int64) *Backfiller {
+	b := newBackfiller(database, rpcClient, "profile-"+string(opts.Profile), batchSize)
+	b.apply = func(ctx context.Context, fromHeight, toHeight int64) (int64, error) {
+		return b.backfillProfile(ctx, &opts, fromHeight, toHeight)
+	}
+	return b
+}
+
+func newBackfiller(database db.Store, rpcClient *rpc.Client, field string, batchSize int64) *Backfiller {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	b := &Backfiller{
+		db:        database,
+		rpcClient: rpcClient,
+		field:     field,
+		batchSize: batchSize,
+		progress:  make(chan ProgressUpdate, 100),
+	}
+	b.updates = relayProgress(b.progress)
+	return b
+}
+
+// ResumeHeight returns the first height a run over [fromHeight, toHeight]
+// still has to process.
+func (b *Backfiller) ResumeHeight(fromHeight, toHeight int64) (int64, error) {
+	last, err := b.db.GetBackfillProgress(b.field, fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get backfill progress: %w", err)
+	}
+	return last + 1, nil
+}
+
+// Run backfills [fromHeight, toHeight], starting after the last completed
+// batch of a previous run over the same range. The progress channel is
+// closed when it returns.
+func (b *Backfiller) Run(ctx context.Context, fromHeight, toHeight int64) error {
+	defer close(b.progress)
+
+	start, err := b.ResumeHeight(fromHeight, toHeight)
+	if err != nil {
+		return err
+	}
+	if start > toHeight {
+		b.progress <- ProgressUpdate{Status: "All blocks already processed"}
+		return nil
+	}
+
+	for batchStart := start; batchStart <= toHeight; batchStart += b.batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batchEnd := batchStart + b.batchSize - 1
+		if batchEnd > toHeight {
+			batchEnd = toHeight
+		}
+
+		rows, err := b.apply(ctx, batchStart, batchEnd)
+		if err != nil {
+			b.progress <- ProgressUpdate{BlockHeight: batchStart, Status: "failed", Error: err}
+			return fmt.Errorf("failed to backfill %s for blocks %d-%d: %w", b.field, batchStart, batchEnd, err)
+		}
+		if err := b.db.SaveBackfillProgress(b.field, fromHeight, toHeight, batchEnd); err != nil {
+			return fmt.Errorf("failed to save backfill progress: %w", err)
+		}
+
+		for height := batchStart; height <= batchEnd; height++ {
+			update := ProgressUpdate{BlockHeight: height, Status: "completed"}
+			if height == batchEnd {
+				update.DebugMsg = fmt.Sprintf("Backfilled %s for blocks %d-%d (%d rows updated)", b.field, batchStart, batchEnd, rows)
+			}
+			b.progress <- update
+		}
+	}
+
+	return nil
+}
+
+func withoutContext(apply func(fromHeight, toHeight int64) (int64, error)) func(context.Context, int64, int64) (int64, error) {
+	return func(_ context.Context, fromHeight, toHeight int64) (int64, error) {
+		return apply(fromHeight, toHeight)
+	}
+}
+
+// backfillSegwit records the segwit usage of the blocks in [fromHeight,
+// toHeight] that don't have it yet. Blocks are parsed from the raw_blocks
+// table when they were archived there and fetched from the node otherwise.
+func (b *Backfiller) backfillSegwit(ctx context.Context, fromHeight, toHeight int64) (int64, error) {
+	blocks, err := b.db.GetBlocksMissingSegwit(fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get blocks without segwit usage: %w", err)
+	}
+
+	var updated int64
+	for height, hash := range blocks {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+
+		var data []byte
+		raw, err := b.db.GetRawBlock(height)
+		switch {
+		case err == nil && raw.Hash == hash:
+			data = raw.Data
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			return updated, fmt.Errorf("failed to get raw block %d: %w", height, err)
+		case b.rpcClient == nil:
+			return updated, fmt.Errorf("block %d has no stored raw block and there is no RPC connection to fetch it", height)
+		default:
+			if data, err = b.rpcClient.GetRawBlock(ctx, hash); err != nil {
+				return updated, err
+			}
+		}
+
+		segwitTxs, witnessSize, err := analysis.SegwitUsage(data)
+		if err != nil {
+			return updated, fmt.Errorf("block %d: %w", height, err)
+		}
+		if err := b.db.UpdateBlockSegwit(hash, segwitTxs, witnessSize); err != nil {
+			return updated, fmt.Errorf("failed to update segwit usage of block %d: %w", height, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// backfillProfile stores the completed blocks in [fromHeight, toHeight]
+// again with opts, fetching the block stored at each height from the node.
+func (b *Backfiller) backfillProfile(ctx context.Context, opts *Options, fromHeight, toHeight int64) (int64, error) {
+	processed, err := b.db.GetProcessedBlocks(fromHeight, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get processed blocks: %w", err)
+	}
+
+	var updated int64
+	for _, height := range slices.Sorted(maps.Keys(processed)) {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		hash, err := b.db.GetBlockHashAtHeight(height)
+		if err != nil {
+			return updated, fmt.Errorf("failed to get hash of block %d: %w", height, err)
+		}
+		result, err := b.rpcClient.GetBlockVerbose(ctx, hash)
+		if err != nil {
+			return updated, fmt.Errorf("failed to get block %d with transactions: %w", height, err)
+		}
+		data, err := parseBlockData(result, opts)
+		if err != nil {
+			return updated, fmt.Errorf("failed to parse block %d: %w", height, err)
+		}
+		if err := b.db.ReplaceBlocksWithTransactions(ctx, []*models.BlockData{data}); err != nil {
+			return updated, fmt.Errorf("failed to store block %d: %w", height, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// backfillChainwork records the work of the blocks in [fromHeight, toHeight]
+// that don't have it yet, and their chainwork by adding it to the chainwork
+// of the block they extend. Where that block isn't stored or has no
+// chainwork either, it is taken from the node's header of the block, so
+// without an RPC connection the backfill has to start from a block scraped
+// with its chainwork, or from the genesis block.
+func (b *Backfiller) backfillChainwork(ctx context.Context, fromHeight, toHeight int64) (int64, error) {
+	blocks, err := b.db.GetBlocksWork(fromHeight-1, toHeight)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block work: %w", err)
+	}
+
+	var updated int64
+	var prev *models.Block
+	for _, block := range blocks {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+		var prevChainwork string
+		if prev != nil && prev.Height == block.Height-1 && prev.Hash == block.PreviousBlockHash {
+			prevChainwork = prev.Chainwork
+		}
+		prev = block
+		if block.Height < fromHeight || (block.Work != "" && block.Chainwork != "") {
+			continue
+		}
+
+		work, err := analysis.BlockWork(block.Bits)
+		if err != nil {
+			return updated, fmt.Errorf("block %d: %w", block.Height, err)
+		}
+		block.Work = work.String()
+		if block.Chainwork == "" {
+			if block.Chainwork, err = b.chainwork(ctx, block, work, prevChainwork); err != nil {
+				return updated, err
+			}
+		}
+		if err := b.db.UpdateBlockWork(block.Hash, block.Work, block.Chainwork); err != nil {
+			return updated, fmt.Errorf("failed to update work of block %d: %w", block.Height, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// chainwork returns the chainwork of block, whose work is work, from the
+// chainwork of the block it extends or else from the node. It returns ""
+// when neither is known.
+func (b *Backfiller) chainwork(ctx context.Context, block *models.Block, work *big.Int, prevChainwork string) (string, error) {
+	if block.Height == 0 {
+		return work.String(), nil
+	}
+	if prev, ok := new(big.Int).SetString(prevChainwork, 10); ok {
+		return prev.Add(prev, work).String(), nil
+	}
+	if b.rpcClient == nil {
+		return "", nil
+	}
+	chainwork, err := b.rpcClient.GetBlockChainwork(ctx, block.Hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chainwork of block %d: %w", block.Height, err)
+	}
+	return chainwork, nil
+}
+
+func (b *Backfiller) GetProgressChannel() <-chan ProgressUpdate {
+	return b.updates
+}
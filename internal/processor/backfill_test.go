@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestProfileBackfiller scrapes blocks with the minimal profile and
+// migrates them to the full one, which must store their transactions and
+// outputs.
+func TestProfileBackfiller(t *testing.T) {
+	node := &fakeNode{tip: 3, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			return valueBlock(height, "3.125", "0.5"), nil
+		},
+	}}
+	wp, database := newTestPool(t, node, 2, Options{Profile: models.ProfileMinimal})
+	if err := wp.ProcessBlockRange(context.Background(), 1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := func() map[string]int {
+		t.Helper()
+		counts, err := database.GetStoredTxCounts(time.Time{}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts
+	}
+	blocks, err := database.GetBlocksByTime(time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 || blocks[0].TxCount != 1 || blocks[0].CoinbaseValue != 362500000 || len(counts()) != 0 {
+		t.Fatalf("minimal profile stored %d blocks and transactions of %d, want 3 blocks with their aggregates only", len(blocks), len(counts()))
+	}
+
+	b := NewProfileBackfiller(database, wp.rpcClient.(*rpc.Client), Options{Profile: models.ProfileFull}, 2)
+	go func() {
+		for range b.GetProgressChannel() {
+		}
+	}()
+	if err := b.Run(context.Background(), 0, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(); len(got) != 3 || got[testBlockHash(2)] != 1 {
+		t.Errorf("transaction counts after the migration = %v, want one per block", got)
+	}
+	outputs, err := database.GetUnspentOutputs("bc1qvalue2_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Value != 50000000 {
+		t.Errorf("outputs of bc1qvalue2_1 = %v, want one of 0.5 BTC", outputs)
+	}
+	if start, err := b.ResumeHeight(0, 3); err != nil || start != 4 {
+		t.Errorf("ResumeHeight() = %d, %v after the migration, want 4", start, err)
+	}
+}
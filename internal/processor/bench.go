@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/db"
+	"time"
+)
+
+// DefaultBenchWindow is the number of blocks below the tip BenchSample
+// picks from, about two weeks of blocks.
+const DefaultBenchWindow = 2016
+
+// BenchConfig is a combination of settings measured by Bench.
+type BenchConfig struct {
+	Fetchers  int
+	FlushRows int
+}
+
+// BenchResult is how a BenchConfig performed.
+type BenchResult struct {
+	BenchConfig
+	Completed int64
+	Failed    int64
+	Elapsed   time.Duration
+	// FetchMs, ParseMs and InsertMs add up the timings of the stored
+	// blocks.
+	FetchMs  int64
+	ParseMs  int64
+	InsertMs int64
+}
+
+// BlocksPerMin returns the number of blocks stored per minute.
+func (r BenchResult) BlocksPerMin() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Completed) / r.Elapsed.Minutes()
+}
+
+// FetchShare returns the share of the time spent on the stored blocks that
+// went to fetching them from the node.
+func (r BenchResult) FetchShare() float64 {
+	total := r.FetchMs + r.ParseMs + r.InsertMs
+	if total == 0 {
+		return 0
+	}
+	return float64(r.FetchMs) / float64(total)
+}
+
+// BenchSample returns n heights spread evenly over the window blocks up to
+// tip, or all of them when there are fewer.
+func BenchSample(tip int64, n int, window int64) []int64 {
+	from := max(tip-window+1, 0)
+	span := tip - from + 1
+	count := min(int64(n), span)
+	heights := make([]int64, count)
+	for i := range count {
+		heights[i] = from + i*span/count
+	}
+	return heights
+}
+
+// Bench processes heights once with each configuration, each time into a
+// fresh database from open that is closed afterwards. done, when not nil,
+// is called with each result as soon as it is measured.
+func Bench(ctx context.Context, source BlockSource, heights []int64, configs []BenchConfig, opts Options, open func() (db.Store, error), done func(BenchResult)) ([]BenchResult, error) {
+	results := make([]BenchResult, 0, len(configs))
+	for _, config := range configs {
+		result, err := benchConfig(ctx, source, heights, config, opts, open)
+		if err != nil {
+			return results, fmt.Errorf("benchmark with %d fetchers and %d flush rows: %w", config.Fetchers, config.FlushRows, err)
+		}
+		results = append(results, result)
+		if done != nil {
+			done(result)
+		}
+	}
+	return results, nil
+}
+
+func benchConfig(ctx context.Context, source BlockSource, heights []int64, config BenchConfig, opts Options, open func() (db.Store, error)) (BenchResult, error) {
+	database, err := open()
+	if err != nil {
+		return BenchResult{}, err
+	}
+	defer database.Close()
+
+	opts.FlushRows = config.FlushRows
+	wp := NewWorkerPool(source, database, config.Fetchers, opts)
+	go func() {
+		for range wp.GetProgressChannel() {
+		}
+	}()
+	start := time.Now()
+	if err := wp.ProcessBlockList(ctx, heights); err != nil {
+		return BenchResult{}, err
+	}
+	result := BenchResult{BenchConfig: config, Elapsed: time.Since(start)}
+	result.Completed, result.Failed = wp.Counts()
+
+	timings, err := database.GetSlowestBlocks(len(heights), time.Time{})
+	if err != nil {
+		return BenchResult{}, err
+	}
+	for _, t := range timings {
+		result.FetchMs += t.RPCFetchMs
+		result.ParseMs += t.ParseMs
+		result.InsertMs += t.DBInsertMs
+	}
+	return result, nil
+}
+
+// FastestBench returns the result storing the most blocks per minute,
+// the first of equally fast ones.
+func FastestBench(results []BenchResult) BenchResult {
+	var best BenchResult
+	for _, r := range results {
+		if r.BlocksPerMin() > best.BlocksPerMin() {
+			best = r
+		}
+	}
+	return best
+}
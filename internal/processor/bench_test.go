@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"context"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc/rpctest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBenchSample(t *testing.T) {
+	tests := []struct {
+		tip, window int64
+		n           int
+		want        []int64
+	}{
+		{tip: 100, window: 10, n: 5, want: []int64{91, 93, 95, 97, 99}},
+		{tip: 100, window: 10, n: 3, want: []int64{91, 94, 97}},
+		// Fewer blocks than asked for, near genesis
+		{tip: 3, window: 10, n: 5, want: []int64{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := BenchSample(tt.tip, tt.n, tt.window); !slices.Equal(got, tt.want) {
+			t.Errorf("BenchSample(%d, %d, %d) = %v, want %v", tt.tip, tt.n, tt.window, got, tt.want)
+		}
+	}
+}
+
+// TestBench benchmarks two configurations on a synthetic chain: each must
+// store every sampled block into a database of its own, which is closed
+// afterwards.
+func TestBench(t *testing.T) {
+	chain := rpctest.Synthetic(30)
+	heights := BenchSample(29, 10, 20)
+	var opened []db.Store
+	open := func() (db.Store, error) {
+		database, err := db.Open(db.DriverDuckDB, db.MemoryPath, false)
+		if err == nil {
+			opened = append(opened, database)
+		}
+		return database, err
+	}
+
+	configs := []BenchConfig{{Fetchers: 1, FlushRows: 5}, {Fetchers: 4, FlushRows: 100}}
+	var reported int
+	results, err := Bench(context.Background(), chain, heights, configs, Options{}, open, func(BenchResult) { reported++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || reported != 2 || len(opened) != 2 {
+		t.Fatalf("%d results, %d reported and %d databases opened, want 2 each", len(results), reported, len(opened))
+	}
+	for i, r := range results {
+		if r.BenchConfig != configs[i] || r.Completed != int64(len(heights)) || r.Failed != 0 || r.Elapsed <= 0 {
+			t.Errorf("result %+v, want %d blocks stored with %+v", r, len(heights), configs[i])
+		}
+	}
+	for _, database := range opened {
+		if _, err := database.GetSlowestBlocks(1, time.Time{}); err == nil {
+			t.Error("database still open after its benchmark")
+		}
+	}
+
+	fast := BenchResult{BenchConfig: BenchConfig{Fetchers: 8}, Completed: 10, Elapsed: time.Second}
+	slow := BenchResult{BenchConfig: BenchConfig{Fetchers: 2}, Completed: 10, Elapsed: 2 * time.Second}
+	if best := FastestBench([]BenchResult{slow, fast, slow}); best.Fetchers != 8 {
+		t.Errorf("FastestBench() = %+v, want the 8 fetchers", best)
+	}
+}
@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"context"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// estimatedBytesPerTx approximates the memory a transaction takes while its
+// block is in flight: its share of the verbose JSON plus the parsed
+// transaction, inputs and outputs.
+const estimatedBytesPerTx = 8 << 10
+
+// memoryBudget bounds the estimated size of the blocks between the start of
+// their fetch and the end of their insert. A nil budget is unlimited.
+type memoryBudget struct {
+	sem      *semaphore.Weighted
+	limit    int64
+	inflight atomic.Int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryBudget{sem: semaphore.NewWeighted(limit), limit: limit}
+}
+
+// acquire waits until n bytes fit in the budget and returns the bytes to
+// release once the block is done. A block estimated above the whole budget
+// takes all of it, so it is processed alone instead of waiting forever.
+func (b *memoryBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	if n > b.limit {
+		n = b.limit
+	}
+	if err := b.sem.Acquire(ctx, n); err != nil {
+		return 0, err
+	}
+	b.inflight.Add(n)
+	return n, nil
+}
+
+func (b *memoryBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.inflight.Add(-n)
+	b.sem.Release(n)
+}
+
+// state returns the bytes in flight and the limit, zero for a nil budget.
+func (b *memoryBudget) state() (inflight, limit int64) {
+	if b == nil {
+		return 0, 0
+	}
+	return b.inflight.Load(), b.limit
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// validateLink checks block against the stored block at the height below
+// it, or defers the check if that block isn't stored yet. It is only called
+// by the writer, and the deferred checks run once the writer is done.
+func (wp *WorkerPool) validateLink(block *models.Block) {
+	if block.Height == 0 {
+		return
+	}
+	ok, err := wp.checkLink(block)
+	if err != nil {
+		wp.send(ProgressUpdate{
+			BlockHeight: block.Height,
+			Status:      "chain_break",
+			Warning:     fmt.Sprintf("Failed to validate the link of block %d: %v", block.Height, err),
+		})
+		return
+	}
+	if !ok {
+		wp.deferredLinks = append(wp.deferredLinks, block)
+	}
+}
+
+// validateDeferredLinks checks the blocks whose predecessor wasn't stored
+// when they were. Blocks whose predecessor is outside the scraped range and
+// not stored are skipped.
+func (wp *WorkerPool) validateDeferredLinks() {
+	if len(wp.deferredLinks) == 0 {
+		return
+	}
+
+	var unchecked int
+	for _, block := range wp.deferredLinks {
+		ok, err := wp.checkLink(block)
+		if err != nil || !ok {
+			unchecked++
+		}
+	}
+	wp.send(ProgressUpdate{
+		Status: "chain_validated",
+		DebugMsg: fmt.Sprintf("Validated the links of %d blocks stored before their predecessor, %d without a stored predecessor",
+			len(wp.deferredLinks)-unchecked, unchecked),
+	})
+	wp.deferredLinks = nil
+}
+
+// checkLink compares the previous block hash of block with the hash stored
+// at the height below and records a chain break if they differ. It returns
+// false if no block is stored at that height.
+func (wp *WorkerPool) checkLink(block *models.Block) (bool, error) {
+	prevHash, err := wp.db.GetBlockHashAtHeight(block.Height - 1)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if prevHash == block.PreviousBlockHash {
+		return true, nil
+	}
+	// One of the two blocks was orphaned, so the cached hashes from there on
+	// may be too
+	wp.rpcClient.InvalidateHashesFrom(block.Height - 1)
+
+	err = wp.db.InsertChainBreak(&models.ChainBreak{
+		Height:             block.Height,
+		BlockHash:          block.Hash,
+		PreviousBlockHash:  block.PreviousBlockHash,
+		StoredPreviousHash: prevHash,
+		DetectedAt:         models.Now(),
+	})
+	msg := fmt.Sprintf("Chain break at block %d: previous block hash %s doesn't match the stored block %d %s",
+		block.Height, block.PreviousBlockHash, block.Height-1, prevHash)
+	if err != nil {
+		msg += fmt.Sprintf(" (%v)", err)
+	}
+	wp.send(ProgressUpdate{BlockHeight: block.Height, Status: "chain_break", Warning: msg})
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// blocksPerDay is the first step of the search for the next day's first
+// block, the number of blocks expected in a day.
+const blocksPerDay = 144
+
+// ResolveDays returns the heights of the blocks of each UTC day from the day
+// of from to the day of to, both included, up to tip. Days without a block
+// are left out.
+//
+// The first block of a day is the first one whose timestamp is at or after
+// midnight, found by searching the headers from the first block of the day
+// before. Block timestamps may run backwards by up to a couple of hours, so
+// a block near midnight can fall in the day next to the one its timestamp
+// says, but the days never overlap or leave gaps between them.
+func ResolveDays(ctx context.Context, client *rpc.Client, from, to time.Time, tip int64) ([]*models.DayRange, error) {
+	day := truncateDay(from)
+	end := truncateDay(to).AddDate(0, 0, 1)
+
+	first, err := firstBlockAt(ctx, client, day, 0, tip)
+	if err != nil {
+		return nil, err
+	}
+	var days []*models.DayRange
+	for ; day.Before(end) && first <= tip; day = day.AddDate(0, 0, 1) {
+		next, err := firstBlockAt(ctx, client, day.AddDate(0, 0, 1), first, tip)
+		if err != nil {
+			return nil, err
+		}
+		if next > first {
+			days = append(days, &models.DayRange{Day: day, FromHeight: first, ToHeight: next - 1})
+		}
+		first = next
+	}
+	return days, nil
+}
+
+// firstBlockAt returns the first height from lo on, up to tip, of a block
+// with a timestamp at or after t, or tip+1 if there is none. Starting from
+// lo, it steps forward doubling the step until it passes t, then bisects
+// the last step, so finding the next day's first block takes a handful of
+// headers wherever the day is.
+func firstBlockAt(ctx context.Context, client *rpc.Client, t time.Time, lo, tip int64) (int64, error) {
+	before := func(height int64) (bool, error) {
+		blockTime, err := client.GetBlockTime(ctx, height)
+		if err != nil {
+			return false, fmt.Errorf("failed to find the first block of %s: %w", t.Format("2006-01-02"), err)
+		}
+		return blockTime.Before(t), nil
+	}
+
+	if lo > tip {
+		return tip + 1, nil
+	}
+	if ok, err := before(lo); err != nil || !ok {
+		return lo, err
+	}
+	// The block at lo is before t; find hi past it
+	hi := tip + 1
+	for step := int64(blocksPerDay); lo+step <= tip; step *= 2 {
+		ok, err := before(lo + step)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			hi = lo + step
+			break
+		}
+		lo += step
+	}
+	// The first block at or after t is in (lo, hi]
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := before(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTimeNode starts a node whose block at each height has the timestamp
+// blockTime returns and returns a client for it.
+func newTimeNode(t *testing.T, tip int64, blockTime func(height int64) time.Time) *rpc.Client {
+	t.Helper()
+	node := &fakeNode{tip: tip, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			if height > tip {
+				return nil, fmt.Errorf("block height out of range")
+			}
+			return testBlockHash(height), nil
+		},
+		"getblockheader": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{"hash": hash, "height": height, "time": blockTime(height).Unix()}, nil
+		},
+	}}
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+
+	client, err := rpc.NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func date(day int) time.Time {
+	return time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC)
+}
+
+// A block every 10 minutes from 05:00 on March 1st: 114 blocks that day,
+// then 144 a day.
+func tenMinuteBlocks(height int64) time.Time {
+	return date(1).Add(5*time.Hour + time.Duration(height)*10*time.Minute)
+}
+
+func TestResolveDays(t *testing.T) {
+	client := newTimeNode(t, 1000, tenMinuteBlocks)
+
+	got, err := ResolveDays(context.Background(), client, date(1), date(3), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*models.DayRange{
+		{Day: date(1), FromHeight: 0, ToHeight: 113},
+		{Day: date(2), FromHeight: 114, ToHeight: 257},
+		{Day: date(3), FromHeight: 258, ToHeight: 401},
+	}
+	checkDays(t, got, want)
+
+	// The last day is cut at the tip and the days after it have no blocks
+	got, err = ResolveDays(context.Background(), client, date(7).Add(13*time.Hour), date(20), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []*models.DayRange{
+		{Day: date(7), FromHeight: 834, ToHeight: 977},
+		{Day: date(8), FromHeight: 978, ToHeight: 1000},
+	}
+	checkDays(t, got, want)
+}
+
+// TestResolveDaysBackwardTimestamps has a block timestamped before the
+// block below it across midnight. Whichever day it lands in, the days must
+// stay contiguous.
+func TestResolveDaysBackwardTimestamps(t *testing.T) {
+	client := newTimeNode(t, 1000, func(height int64) time.Time {
+		if height == 259 {
+			return date(2).Add(23*time.Hour + 55*time.Minute)
+		}
+		return tenMinuteBlocks(height)
+	})
+
+	days, err := ResolveDays(context.Background(), client, date(1), date(5), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 5 || days[0].FromHeight != 0 {
+		t.Fatalf("got %d days starting at %d, want 5 starting at 0", len(days), days[0].FromHeight)
+	}
+	for i := 1; i < len(days); i++ {
+		if days[i].FromHeight != days[i-1].ToHeight+1 {
+			t.Errorf("day %s starts at %d, the day before ends at %d",
+				days[i].Day.Format("2006-01-02"), days[i].FromHeight, days[i-1].ToHeight)
+		}
+	}
+}
+
+func checkDays(t *testing.T, got, want []*models.DayRange) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d days, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != *want[i] {
+			t.Errorf("day %d: got %s %d-%d, want %s %d-%d", i,
+				got[i].Day.Format("2006-01-02"), got[i].FromHeight, got[i].ToHeight,
+				want[i].Day.Format("2006-01-02"), want[i].FromHeight, want[i].ToHeight)
+		}
+	}
+}
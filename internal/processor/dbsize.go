@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// dbSizeSampleInterval is how often the database file size is sampled.
+const dbSizeSampleInterval = 5 * time.Second
+
+// minBlocksForProjection is the number of blocks stored in this run before
+// the final database size is projected, since DuckDB grows the file in
+// steps and the first blocks say little about the average.
+const minBlocksForProjection = 10
+
+// ErrDBSizeLimit is returned by ProcessBlockRange when it stopped
+// dispatching blocks because the projected database size exceeded
+// Options.MaxDBSize. The blocks already dispatched are still stored.
+var ErrDBSizeLimit = errors.New("projected database size exceeds the limit")
+
+// dbSizeMonitor samples the size of the database file and its WAL and
+// projects the size at the end of the run from the bytes stored per block.
+type dbSizeMonitor struct {
+	path     string
+	limit    int64
+	baseline int64
+	// remaining is the number of blocks in the range still to be processed
+	// when the run started.
+	remaining int64
+	size      atomic.Int64
+	projected atomic.Int64
+	exceeded  atomic.Bool
+}
+
+// newDBSizeMonitor returns nil when path is empty, e.g. for an in-memory
+// or server database.
+func newDBSizeMonitor(path string, limit, remaining int64) *dbSizeMonitor {
+	if path == "" {
+		return nil
+	}
+	m := &dbSizeMonitor{path: path, limit: limit, remaining: remaining}
+	m.baseline = m.fileSize()
+	m.size.Store(m.baseline)
+	return m
+}
+
+// fileSize returns the size of the database file plus its WAL if present.
+func (m *dbSizeMonitor) fileSize() int64 {
+	var size int64
+	for _, path := range []string{m.path, m.path + ".wal"} {
+		if fi, err := os.Stat(path); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+// sample updates the current and projected size given the number of blocks
+// stored and failed so far in this run.
+func (m *dbSizeMonitor) sample(stored, failed int64) {
+	size := m.fileSize()
+	m.size.Store(size)
+	if stored < minBlocksForProjection {
+		return
+	}
+
+	perBlock := float64(size-m.baseline) / float64(stored)
+	left := m.remaining - stored - failed
+	if perBlock < 0 || left < 0 {
+		perBlock, left = 0, 0
+	}
+	projected := size + int64(perBlock*float64(left))
+	m.projected.Store(projected)
+	if m.limit > 0 && projected > m.limit {
+		m.exceeded.Store(true)
+	}
+}
+
+// state returns the current and projected size, or zeros without a monitor.
+// The projection is zero until enough blocks have been stored.
+func (m *dbSizeMonitor) state() (size, projected int64) {
+	if m == nil {
+		return 0, 0
+	}
+	return m.size.Load(), m.projected.Load()
+}
+
+// overLimit reports whether the projected size has exceeded the limit.
+func (m *dbSizeMonitor) overLimit() bool {
+	return m != nil && m.exceeded.Load()
+}
+
+// monitorDBSize samples the database size until ctx is done or stop is
+// closed. Every sample is reported with a "db_size" update.
+func (wp *WorkerPool) monitorDBSize(ctx context.Context, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(dbSizeSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			wasOver := wp.dbSize.overLimit()
+			wp.dbSize.sample(wp.Counts())
+
+			u := ProgressUpdate{Status: "db_size"}
+			if !wasOver && wp.dbSize.overLimit() {
+				_, projected := wp.dbSize.state()
+				u.DebugMsg = fmt.Sprintf("Projected database size %s exceeds the limit of %s, finishing the blocks in flight",
+					formatBytes(projected), formatBytes(wp.dbSize.limit))
+			}
+			wp.send(u)
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strings"
+)
+
+// DustLimit is the output value in satoshis below which Bitcoin Core
+// considers an output to a P2PKH script dust.
+const DustLimit = 546
+
+// Filter drops transactions a study doesn't need before they are stored,
+// along with their inputs, outputs and OP_RETURN payloads. The block keeps
+// its aggregates over all of its transactions and counts the dropped ones
+// in FilteredTxCount. Coinbase transactions are always kept. The zero
+// Filter keeps everything.
+type Filter struct {
+	// MinOutputValue drops transactions whose outputs add up to less than
+	// this many satoshis.
+	MinOutputValue int64
+	// SkipDust drops transactions whose outputs are all below DustLimit.
+	SkipDust bool
+}
+
+// String describes the filter for the runs table, e.g.
+// "min-output-value=100000,skip-dust", or returns "" for the zero Filter.
+func (f Filter) String() string {
+	var parts []string
+	if f.MinOutputValue > 0 {
+		parts = append(parts, fmt.Sprintf("min-output-value=%d", f.MinOutputValue))
+	}
+	if f.SkipDust {
+		parts = append(parts, "skip-dust")
+	}
+	return strings.Join(parts, ",")
+}
+
+// apply drops the transactions of data the filter leaves out.
+func (f Filter) apply(data *models.BlockData) {
+	if f == (Filter{}) {
+		return
+	}
+
+	// The largest output of each transaction, for SkipDust
+	largest := make(map[string]int64, len(data.Transactions))
+	for _, out := range data.Outputs {
+		largest[out.Txid] = max(largest[out.Txid], out.Value)
+	}
+	dropped := make(map[string]bool)
+	txs := data.Transactions[:0]
+	for _, tx := range data.Transactions {
+		if !tx.IsCoinbase && (tx.OutputValue < f.MinOutputValue || f.SkipDust && largest[tx.Txid] < DustLimit) {
+			dropped[tx.Txid] = true
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	if len(dropped) == 0 {
+		return
+	}
+	data.Transactions = txs
+	data.Block.FilteredTxCount = len(dropped)
+
+	inputs := data.Inputs[:0]
+	for _, in := range data.Inputs {
+		if !dropped[in.TxidSpending] {
+			inputs = append(inputs, in)
+		}
+	}
+	data.Inputs = inputs
+	outputs := data.Outputs[:0]
+	for _, out := range data.Outputs {
+		if !dropped[out.Txid] {
+			outputs = append(outputs, out)
+		}
+	}
+	data.Outputs = outputs
+	opReturns := data.OpReturns[:0]
+	for _, op := range data.OpReturns {
+		if !dropped[op.Txid] {
+			opReturns = append(opReturns, op)
+		}
+	}
+	data.OpReturns = opReturns
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+)
+
+// filterBlock returns a block with a coinbase and three transactions: one
+// paying 10 BTC, one of 1000 satoshis in two outputs, one of dust only.
+func filterBlock() *models.BlockData {
+	data := &models.BlockData{Block: &models.Block{Height: 10, TxCount: 4}}
+	for _, tx := range []struct {
+		txid    string
+		outputs []int64
+	}{
+		{"coinbase", []int64{312500000}},
+		{"large", []int64{1000000000}},
+		{"small", []int64{600, 400}},
+		{"dust", []int64{300, 200}},
+	} {
+		t := &models.Transaction{Txid: tx.txid, IsCoinbase: tx.txid == "coinbase"}
+		for vout, value := range tx.outputs {
+			t.OutputValue += value
+			data.Outputs = append(data.Outputs, &models.TxOutput{Txid: tx.txid, Vout: uint32(vout), Value: value})
+		}
+		data.Transactions = append(data.Transactions, t)
+		if !t.IsCoinbase {
+			data.Inputs = append(data.Inputs, &models.TxInput{TxidSpending: tx.txid, PrevTxid: "prev"})
+		}
+	}
+	data.OpReturns = []*models.OpReturnOutput{{Txid: "dust", Vout: 2}}
+	return data
+}
+
+func TestFilter(t *testing.T) {
+	for _, c := range []struct {
+		filter Filter
+		want   []string
+		desc   string
+	}{
+		{Filter{}, []string{"coinbase", "large", "small", "dust"}, ""},
+		{Filter{SkipDust: true}, []string{"coinbase", "large", "small"}, "skip-dust"},
+		// The coinbase is kept whatever its value
+		{Filter{MinOutputValue: 400000000}, []string{"coinbase", "large"}, "min-output-value=400000000"},
+		{Filter{MinOutputValue: 800, SkipDust: true}, []string{"coinbase", "large", "small"}, "min-output-value=800,skip-dust"},
+	} {
+		if got := c.filter.String(); got != c.desc {
+			t.Errorf("%+v.String() = %q, want %q", c.filter, got, c.desc)
+		}
+
+		data := filterBlock()
+		c.filter.apply(data)
+		var txids, outputs, inputs []string
+		for _, tx := range data.Transactions {
+			txids = append(txids, tx.Txid)
+		}
+		for _, out := range data.Outputs {
+			if !slices.Contains(outputs, out.Txid) {
+				outputs = append(outputs, out.Txid)
+			}
+		}
+		for _, in := range data.Inputs {
+			inputs = append(inputs, in.TxidSpending)
+		}
+		if !slices.Equal(txids, c.want) || !slices.Equal(outputs, c.want) || !slices.Equal(inputs, c.want[1:]) {
+			t.Errorf("%+v kept transactions %v, outputs of %v and inputs of %v, want %v", c.filter, txids, outputs, inputs, c.want)
+		}
+		if filtered := 4 - len(c.want); data.Block.FilteredTxCount != filtered || data.Block.TxCount != 4 {
+			t.Errorf("%+v: block counts %d transactions with %d filtered, want 4 with %d", c.filter, data.Block.TxCount, data.Block.FilteredTxCount, filtered)
+		}
+		if keepsDust := slices.Contains(c.want, "dust"); (len(data.OpReturns) == 1) != keepsDust {
+			t.Errorf("%+v kept %d OP_RETURN payloads", c.filter, len(data.OpReturns))
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/rpc"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval is how often ProcessFollow checks the node for new
+// blocks when Options.PollInterval is zero.
+const DefaultPollInterval = 30 * time.Second
+
+// DefaultFeeEstimateInterval is the default of Options.EstimateInterval.
+const DefaultFeeEstimateInterval = time.Minute
+
+// DefaultTemplateInterval is the default of Options.TemplateInterval.
+const DefaultTemplateInterval = time.Minute
+
+// DefaultPriceInterval is the default of Options.PriceInterval.
+const DefaultPriceInterval = 10 * time.Minute
+
+// ProcessFollow processes the blocks in [fromHeight, toHeight] like
+// ProcessBlockRange and then keeps polling the node every PollInterval,
+// processing the blocks mined since, until ctx is cancelled. Every poll also
+// records a node snapshot, fee estimates are recorded every
+// EstimateInterval and block templates every TemplateInterval. New tips are
+// reported with "tip" updates carrying the new EndHeight. With a
+// PriceSource, prices are recorded in the background for as long as the run
+// lasts.
+func (wp *WorkerPool) ProcessFollow(ctx context.Context, fromHeight, toHeight int64) error {
+	remaining, err := wp.remaining(fromHeight, toHeight)
+	if err != nil {
+		close(wp.progress)
+		return err
+	}
+
+	return wp.run(ctx, remaining, func(jobs chan<- int64) (int64, error) {
+		if wp.opts.PriceSource != nil {
+			// Stopped before run closes the progress channel it reports to
+			stop, done := make(chan struct{}), make(chan struct{})
+			go wp.refreshPrices(ctx, stop, done)
+			defer func() {
+				close(stop)
+				<-done
+			}()
+		}
+		dispatched, err := wp.dispatch(ctx, fromHeight, toHeight, jobs)
+		if err != nil {
+			return dispatched, err
+		}
+		sent, err := wp.follow(ctx, toHeight, jobs)
+		return dispatched + sent, err
+	})
+}
+
+// follow polls the node until ctx is cancelled and dispatches the heights
+// above lastHeight as they appear.
+func (wp *WorkerPool) follow(ctx context.Context, lastHeight int64, jobs chan<- int64) (int64, error) {
+	interval := wp.opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// A nil channel never fires, leaving the estimates out
+	var estimates <-chan time.Time
+	if wp.opts.EstimateInterval > 0 {
+		estimateTicker := time.NewTicker(wp.opts.EstimateInterval)
+		defer estimateTicker.Stop()
+		estimates = estimateTicker.C
+	}
+
+	var templates <-chan time.Time
+	if wp.opts.TemplateInterval > 0 {
+		templateTicker := time.NewTicker(wp.opts.TemplateInterval)
+		defer templateTicker.Stop()
+		templates = templateTicker.C
+	}
+
+	var sent int64
+	for {
+		select {
+		case <-ticker.C:
+		case <-estimates:
+			wp.captureFeeEstimates(ctx)
+			continue
+		case <-templates:
+			wp.captureBlockTemplate(ctx)
+			continue
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		}
+
+		wp.captureSnapshot(ctx)
+
+		best, err := wp.rpcClient.GetBestBlockHeight()
+		if err != nil {
+			wp.send(ProgressUpdate{Status: "tip", Warning: fmt.Sprintf("Failed to poll the node for new blocks: %v", err)})
+			continue
+		}
+		if best <= lastHeight {
+			continue
+		}
+
+		wp.send(ProgressUpdate{
+			Status:    "tip",
+			EndHeight: best,
+			DebugMsg:  fmt.Sprintf("New tip %d, processing blocks %d-%d", best, lastHeight+1, best),
+		})
+		n, err := wp.dispatch(ctx, lastHeight+1, best, jobs)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		lastHeight = best
+	}
+}
+
+// captureSnapshot records the node's state in node_snapshots. A failure is
+// reported as a warning; the next poll tries again.
+func (wp *WorkerPool) captureSnapshot(ctx context.Context) {
+	snapshot, err := wp.rpcClient.GetNodeSnapshot(ctx)
+	if err == nil {
+		err = wp.db.InsertNodeSnapshot(snapshot)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			wp.send(ProgressUpdate{Status: "snapshot", Warning: fmt.Sprintf("Failed to record node snapshot: %v", err)})
+		}
+		return
+	}
+	wp.send(ProgressUpdate{
+		Status: "snapshot",
+		DebugMsg: fmt.Sprintf("Node snapshot: mempool %d txs, %.1f MB, %.2f tx/s, %d connections",
+			snapshot.MempoolTxs, float64(snapshot.MempoolBytes)/(1<<20), snapshot.TxRate, snapshot.Connections),
+	})
+}
+
+// captureFeeEstimates records the node's fee estimates in fee_estimates. A
+// failure is reported as a warning; the next interval tries again.
+func (wp *WorkerPool) captureFeeEstimates(ctx context.Context) {
+	estimates, err := wp.rpcClient.GetFeeEstimates(ctx, rpc.FeeEstimateTargets)
+	if err == nil {
+		err = wp.db.InsertFeeEstimates(ctx, estimates)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			wp.send(ProgressUpdate{Status: "snapshot", Warning: fmt.Sprintf("Failed to record fee estimates: %v", err)})
+		}
+		return
+	}
+	rates := make([]string, len(estimates))
+	for i, e := range estimates {
+		rates[i] = fmt.Sprintf("%d blocks %.1f sat/vB", e.Target, e.FeeRate)
+	}
+	wp.send(ProgressUpdate{Status: "snapshot", DebugMsg: "Fee estimates: " + strings.Join(rates, ", ")})
+}
+
+// captureBlockTemplate records a summary of the node's block template in
+// next_block_estimates. A failure is reported as a warning; the next
+// interval tries again.
+func (wp *WorkerPool) captureBlockTemplate(ctx context.Context) {
+	estimate, err := wp.rpcClient.GetBlockTemplate(ctx)
+	if err == nil {
+		err = wp.db.InsertNextBlockEstimate(estimate)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			wp.send(ProgressUpdate{Status: "snapshot", Warning: fmt.Sprintf("Failed to record the block template: %v", err)})
+		}
+		return
+	}
+	wp.send(ProgressUpdate{
+		Status: "snapshot",
+		DebugMsg: fmt.Sprintf("Block template for %d: %d txs, %d sat in fees, floor %.1f sat/vB",
+			estimate.Height, estimate.TxCount, estimate.TotalFees, estimate.MinFeeRate),
+	})
+}
+
+// refreshPrices records the latest price from the PriceSource every
+// PriceInterval until stop is closed or ctx is done. Once per day it also
+// replaces the estimates of the previous UTC day with its settled history.
+// Failures are reported as warnings and retried at the next interval, the
+// history until it has been stored.
+func (wp *WorkerPool) refreshPrices(ctx context.Context, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	interval := wp.opts.PriceInterval
+	if interval <= 0 {
+		interval = DefaultPriceInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// settled is the last day whose history is stored
+	var settled time.Time
+	for {
+		wp.capturePrice(ctx)
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if yesterday := today.AddDate(0, 0, -1); settled.Before(yesterday) && wp.settlePrices(ctx, yesterday) {
+			settled = yesterday
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// capturePrice records the latest price in price_data.
+func (wp *WorkerPool) capturePrice(ctx context.Context) {
+	source := wp.opts.PriceSource
+	p, err := source.Latest(ctx)
+	if err == nil {
+		err = wp.db.InsertPriceData(p)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			wp.send(ProgressUpdate{Status: "price", Warning: fmt.Sprintf("Failed to record the %s price: %v", source.Name(), err)})
+		}
+		return
+	}
+	wp.send(ProgressUpdate{Status: "price", DebugMsg: fmt.Sprintf("Price from %s: %.2f USD", source.Name(), p.Price)})
+}
+
+// settlePrices replaces the prices recorded from the PriceSource on day
+// with its history and reports whether it succeeded. A day without history
+// keeps its estimates and counts as settled.
+func (wp *WorkerPool) settlePrices(ctx context.Context, day time.Time) bool {
+	source := wp.opts.PriceSource
+	next := day.AddDate(0, 0, 1)
+	history, err := source.History(ctx, day, next)
+	if err == nil && len(history) > 0 {
+		err = wp.db.ReplacePriceData(ctx, source.Name(), day, next, history)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			wp.send(ProgressUpdate{Status: "price", Warning: fmt.Sprintf("Failed to store the %s price history of %s: %v",
+				source.Name(), day.Format(time.DateOnly), err)})
+		}
+		return false
+	}
+	wp.send(ProgressUpdate{Status: "price", DebugMsg: fmt.Sprintf("Stored %d %s prices of %s", len(history), source.Name(), day.Format(time.DateOnly))})
+	return true
+}
@@ -0,0 +1,163 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"sync"
+)
+
+// HeaderSyncer stores blocks from their headers alone, without fetching
+// their transactions, for a quick view of the chain. The blocks are marked
+// 'headers_only' so that a later full scrape still processes them.
+type HeaderSyncer struct {
+	rpcClient *rpc.Client
+	db        db.Store
+	workers   int
+	batchSize int
+	progress  chan ProgressUpdate
+	updates   <-chan ProgressUpdate
+}
+
+func NewHeaderSyncer(rpcClient *rpc.Client, database db.Store, workers, batchSize int) *HeaderSyncer {
+	if workers <= 0 {
+		workers = 1
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	s := &HeaderSyncer{
+		rpcClient: rpcClient,
+		db:        database,
+		workers:   workers,
+		batchSize: batchSize,
+		progress:  make(chan ProgressUpdate, 100),
+	}
+	s.updates = relayProgress(s.progress)
+	return s
+}
+
+// PendingHeights returns the heights in [fromHeight, toHeight] that are
+// neither fully stored nor synced with headers only yet.
+func (s *HeaderSyncer) PendingHeights(fromHeight, toHeight int64) ([]int64, error) {
+	processed, err := s.db.GetProcessedBlocks(fromHeight, toHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processed blocks: %w", err)
+	}
+	synced, err := s.db.GetHeadersOnlyHeights(fromHeight, toHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header-only blocks: %w", err)
+	}
+	var heights []int64
+	for h := fromHeight; h <= toHeight; h++ {
+		if !processed[h] && !synced[h] {
+			heights = append(heights, h)
+		}
+	}
+	return heights, nil
+}
+
+// Run fetches the headers at heights and stores them in batches. The
+// progress channel is closed when it returns.
+func (s *HeaderSyncer) Run(ctx context.Context, heights []int64) error {
+	defer close(s.progress)
+
+	if len(heights) == 0 {
+		s.progress <- ProgressUpdate{Status: "All blocks already processed"}
+		return nil
+	}
+
+	for start := 0; start < len(heights); start += s.batchSize {
+		batch := heights[start:min(start+s.batchSize, len(heights))]
+		blocks, err := s.fetch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		stored, err := s.db.InsertBlockHeaders(ctx, blocks)
+		if err != nil {
+			s.progress <- ProgressUpdate{BlockHeight: batch[0], Status: "failed", Error: err}
+			return fmt.Errorf("failed to store headers %d-%d: %w", batch[0], batch[len(batch)-1], err)
+		}
+
+		for i, block := range blocks {
+			update := ProgressUpdate{BlockHeight: block.Height, TxCount: block.TxCount, Status: "completed"}
+			if i == len(blocks)-1 {
+				update.DebugMsg = fmt.Sprintf("Stored %d headers of blocks %d-%d", stored, batch[0], block.Height)
+			}
+			s.progress <- update
+		}
+	}
+	return nil
+}
+
+// fetch gets the headers at heights with the configured number of workers
+// and returns them in the same order.
+func (s *HeaderSyncer) fetch(ctx context.Context, heights []int64) ([]*models.Block, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blocks := make([]*models.Block, len(heights))
+	next := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for range min(s.workers, len(heights)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				block, err := s.header(ctx, heights[i])
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				blocks[i] = block
+			}
+		}()
+	}
+
+dispatch:
+	for i := range heights {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (s *HeaderSyncer) header(ctx context.Context, height int64) (*models.Block, error) {
+	block, err := s.rpcClient.GetBlockHeaderByHeight(ctx, height)
+	if err != nil {
+		s.progress <- ProgressUpdate{BlockHeight: height, Status: "failed", Error: err}
+		return nil, err
+	}
+	work, err := analysis.BlockWork(block.Bits)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", height, err)
+	}
+	block.Work = work.String()
+	return block, nil
+}
+
+func (s *HeaderSyncer) GetProgressChannel() <-chan ProgressUpdate {
+	return s.updates
+}
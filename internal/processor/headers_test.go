@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"scrapbtc/internal/analysis"
+	"scrapbtc/internal/rpc"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHeaderSyncer syncs the headers of a range, then fully scrapes part of
+// it. The header-only blocks must have the fields of their header, and the
+// fully scraped ones replace them.
+func TestHeaderSyncer(t *testing.T) {
+	node := &fakeNode{tip: 4, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblockheader": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{
+				"hash": hash, "height": height, "time": 1700000000 + height*600, "nTx": 2,
+				"previousblockhash": testBlockHash(height - 1), "merkleroot": fmt.Sprintf("%064x", height+100),
+				"nonce": 42, "bits": "17034219", "difficulty": 83148355189239.77,
+				"chainwork": fmt.Sprintf("%064x", 1000+height),
+			}, nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			return valueBlock(height, "3.125"), nil
+		},
+	}}
+	wp, database := newTestPool(t, node, 1, Options{})
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+	client, err := rpc.NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	syncer := NewHeaderSyncer(client, database, 3, 2)
+	heights, err := syncer.PendingHeights(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range syncer.GetProgressChannel() {
+		}
+	}()
+	if err := syncer.Run(context.Background(), heights); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := time.Unix(1700000000, 0), time.Unix(1700000000+5*600, 0)
+	blocks, err := database.GetBlocksByTime(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("got %d blocks after the header sync, want 4", len(blocks))
+	}
+	work, err := analysis.BlockWork("17034219")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := blocks[2]
+	if b.Height != 3 || b.TxCount != 2 || b.Size != 0 || b.Nonce != 42 || b.Bits != "17034219" ||
+		b.MerkleRoot != fmt.Sprintf("%064x", 103) || !b.Timestamp.Equal(time.Unix(1700001800, 0)) {
+		t.Errorf("block 3 from its header = %+v", b)
+	}
+	worked, err := database.GetBlocksWork(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(worked) != 1 || worked[0].Work != work.String() || worked[0].Chainwork != "1003" {
+		t.Errorf("work of block 3 = %+v, want %s and chainwork 1003", worked, work)
+	}
+
+	if err := wp.ProcessBlockRange(context.Background(), 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err = database.GetBlocksByTime(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 || blocks[0].Size != 300 || blocks[1].Size != 300 || blocks[1].TxCount != 1 || blocks[2].Size != 0 {
+		t.Errorf("blocks after scraping 1-2 = %+v %+v %+v, want 1 and 2 fully stored", blocks[0], blocks[1], blocks[2])
+	}
+	headersOnly, err := database.GetHeadersOnlyHeights(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headersOnly) != 2 || !headersOnly[3] || !headersOnly[4] {
+		t.Errorf("header-only heights = %v, want 3 and 4", headersOnly)
+	}
+	if heights, err := syncer.PendingHeights(1, 4); err != nil || len(heights) != 0 {
+		t.Errorf("PendingHeights() after the sync = %v, %v, want none", heights, err)
+	}
+}
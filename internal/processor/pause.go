@@ -0,0 +1,109 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// pauseGate holds the fetchers between blocks while the pool is paused.
+type pauseGate struct {
+	mu sync.Mutex
+	// resume is closed to release the waiting fetchers; nil while running.
+	resume chan struct{}
+	// changed carries the latest paused state to watchPause.
+	changed chan bool
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{changed: make(chan bool, 1)}
+}
+
+// set pauses or resumes and reports whether the state changed.
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if paused == (g.resume != nil) {
+		return false
+	}
+	if paused {
+		g.resume = make(chan struct{})
+	} else {
+		close(g.resume)
+		g.resume = nil
+	}
+	// Only the latest state matters to the watcher
+	select {
+	case <-g.changed:
+	default:
+	}
+	g.changed <- paused
+	return true
+}
+
+func (g *pauseGate) paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// wait returns once the pool isn't paused or ctx is done.
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resume := g.resume
+	g.mu.Unlock()
+	if resume == nil {
+		return nil
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause lets the fetchers finish the blocks they are on and stops them from
+// starting new ones until Resume. Blocks already fetched are still parsed
+// and stored.
+func (wp *WorkerPool) Pause() {
+	wp.pause.set(true)
+}
+
+// Resume lets the fetchers continue after Pause.
+func (wp *WorkerPool) Resume() {
+	wp.pause.set(false)
+}
+
+// Paused reports whether the pool is paused.
+func (wp *WorkerPool) Paused() bool {
+	return wp.pause.paused()
+}
+
+// watchPause reports every pause and resume with a "paused" or "resumed"
+// update until stop is closed, so no update is sent after the run. Outages
+// of the node pause the pool as well: the client holds every request until
+// the node is back, which is reported with "node_unavailable" and
+// "node_available" updates rather than by failing the blocks in flight.
+func (wp *WorkerPool) watchPause(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case paused := <-wp.pause.changed:
+			if paused {
+				wp.send(ProgressUpdate{Status: "paused", DebugMsg: "Paused, fetchers stop after their current block"})
+			} else {
+				wp.send(ProgressUpdate{Status: "resumed", DebugMsg: "Resumed"})
+			}
+		case err := <-wp.rpcClient.Availability():
+			if err != nil {
+				wp.send(ProgressUpdate{Status: "node_unavailable", DebugMsg: fmt.Sprintf("Node unavailable, retrying: %v", err)})
+			} else {
+				wp.send(ProgressUpdate{Status: "node_available", DebugMsg: "Node available again"})
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package processor
+
+// isInformational reports whether an update only describes work in progress
+// and may be coalesced with later updates for the same block.
+func isInformational(u ProgressUpdate) bool {
+	return u.Error == nil && (u.Status == "processing" || u.Status == "processing_transactions")
+}
+
+// relayProgress forwards updates from in to the returned channel from a
+// dedicated goroutine, so senders on in never wait for a slow consumer.
+// Updates are queued while the consumer is busy; of the informational updates
+// only the latest per block is kept, while every other update (completed,
+// failed, ...) is delivered in order. The returned channel is closed once in
+// is closed and the queue has been drained.
+func relayProgress(in <-chan ProgressUpdate) <-chan ProgressUpdate {
+	out := make(chan ProgressUpdate)
+
+	go func() {
+		defer close(out)
+
+		var queue []ProgressUpdate
+		// pending maps a block height to the position, counted from the first
+		// update ever queued, of its informational update still in the queue.
+		pending := make(map[int64]int)
+		sent := 0
+
+		for in != nil || len(queue) > 0 {
+			var send chan ProgressUpdate
+			var next ProgressUpdate
+			if len(queue) > 0 {
+				send = out
+				next = queue[0]
+			}
+
+			select {
+			case u, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if isInformational(u) {
+					if pos, ok := pending[u.BlockHeight]; ok {
+						queue[pos-sent] = u
+						continue
+					}
+					pending[u.BlockHeight] = sent + len(queue)
+				} else {
+					// Later informational updates must not overtake it
+					delete(pending, u.BlockHeight)
+				}
+				queue = append(queue, u)
+
+			case send <- next:
+				if pos, ok := pending[next.BlockHeight]; ok && pos == sent {
+					delete(pending, next.BlockHeight)
+				}
+				queue = queue[1:]
+				sent++
+			}
+		}
+	}()
+
+	return out
+}
+
+// FanOut delivers every update from in to n consumers. Each has a queue of
+// its own like the one of GetProgressChannel, so a slow consumer doesn't
+// hold the others back. The returned channels are closed once in is closed
+// and they are drained.
+func FanOut(in <-chan ProgressUpdate, n int) []<-chan ProgressUpdate {
+	inputs := make([]chan ProgressUpdate, n)
+	outs := make([]<-chan ProgressUpdate, n)
+	for i := range inputs {
+		inputs[i] = make(chan ProgressUpdate)
+		outs[i] = relayProgress(inputs[i])
+	}
+
+	go func() {
+		for u := range in {
+			// The relays always take updates right away
+			for _, c := range inputs {
+				c <- u
+			}
+		}
+		for _, c := range inputs {
+			close(c)
+		}
+	}()
+
+	return outs
+}
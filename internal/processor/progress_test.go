@@ -0,0 +1,221 @@
+package processor
+
+import (
+	"errors"
+	"scrapbtc/pkg/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRelayProgressSlowConsumer sends updates from several workers the way
+// WorkerPool does, into a channel buffered for two updates per worker, while
+// nobody reads the relayed channel. The workers must finish anyway.
+func TestRelayProgressSlowConsumer(t *testing.T) {
+	const workers = 4
+	const blocksPerWorker = 500
+	const updatesPerBlock = 20
+
+	in := make(chan ProgressUpdate, workers*2)
+	out := relayProgress(in)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for b := 0; b < blocksPerWorker; b++ {
+				height := int64(w*blocksPerWorker + b)
+				for i := 0; i < updatesPerBlock; i++ {
+					in <- ProgressUpdate{BlockHeight: height, Status: "processing_transactions", TxCount: i}
+				}
+				if b%10 == 0 {
+					in <- ProgressUpdate{BlockHeight: height, Status: "failed", Error: errors.New("boom")}
+				} else {
+					in <- ProgressUpdate{BlockHeight: height, Status: "completed"}
+				}
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(in)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workers blocked on a consumer that doesn't read")
+	}
+
+	// Only now does the consumer start reading
+	final := make(map[int64]string)
+	lastInfo := make(map[int64]int)
+	informational := 0
+	for u := range out {
+		if isInformational(u) {
+			informational++
+			if _, ok := final[u.BlockHeight]; ok {
+				t.Fatalf("block %d: informational update after %s", u.BlockHeight, final[u.BlockHeight])
+			}
+			lastInfo[u.BlockHeight] = u.TxCount
+			continue
+		}
+		if _, ok := final[u.BlockHeight]; ok {
+			t.Fatalf("block %d: %s delivered twice", u.BlockHeight, u.Status)
+		}
+		final[u.BlockHeight] = u.Status
+	}
+
+	if len(final) != workers*blocksPerWorker {
+		t.Errorf("got %d final updates, want %d", len(final), workers*blocksPerWorker)
+	}
+	for height, status := range final {
+		want := "completed"
+		if height%blocksPerWorker%10 == 0 {
+			want = "failed"
+		}
+		if status != want {
+			t.Errorf("block %d: status %s, want %s", height, status, want)
+		}
+	}
+	// The queued informational updates are coalesced to the latest one of
+	// each block
+	if informational > workers*blocksPerWorker {
+		t.Errorf("got %d informational updates for %d blocks", informational, workers*blocksPerWorker)
+	}
+	for height, txCount := range lastInfo {
+		if txCount != updatesPerBlock-1 {
+			t.Errorf("block %d: last informational update has TxCount %d, want %d", height, txCount, updatesPerBlock-1)
+		}
+	}
+}
+
+func TestRelayProgressOrder(t *testing.T) {
+	in := make(chan ProgressUpdate)
+	out := relayProgress(in)
+
+	sent := []ProgressUpdate{
+		{BlockHeight: 1, Status: "processing"},
+		{BlockHeight: 2, Status: "processing"},
+		{BlockHeight: 1, Status: "processing_transactions", TxCount: 5},
+		{BlockHeight: 1, Status: "completed"},
+		{BlockHeight: 1, Status: "processing"},
+		{BlockHeight: 2, Status: "failed", Error: errors.New("boom")},
+	}
+	for _, u := range sent {
+		in <- u
+	}
+	close(in)
+
+	var got []ProgressUpdate
+	for u := range out {
+		got = append(got, u)
+	}
+	want := []ProgressUpdate{
+		{BlockHeight: 1, Status: "processing_transactions", TxCount: 5},
+		{BlockHeight: 2, Status: "processing"},
+		{BlockHeight: 1, Status: "completed"},
+		{BlockHeight: 1, Status: "processing"},
+		{BlockHeight: 2, Status: "failed"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d updates, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].BlockHeight != want[i].BlockHeight || got[i].Status != want[i].Status || got[i].TxCount != want[i].TxCount {
+			t.Errorf("update %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[len(got)-1].Error == nil {
+		t.Error("the failure lost its error")
+	}
+}
+
+// TestFanOut reads one output of FanOut only once the other has received
+// everything, which must not wait for it.
+func TestFanOut(t *testing.T) {
+	in := make(chan ProgressUpdate)
+	outs := FanOut(in, 2)
+	go func() {
+		for h := range int64(100) {
+			in <- ProgressUpdate{BlockHeight: h, Status: "completed"}
+		}
+		close(in)
+	}()
+
+	count := func(c <-chan ProgressUpdate) int {
+		n := 0
+		for range c {
+			n++
+		}
+		return n
+	}
+	done := make(chan int)
+	go func() { done <- count(outs[0]) }()
+	select {
+	case n := <-done:
+		if n != 100 {
+			t.Errorf("first consumer got %d updates, want 100", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first consumer blocked on the second")
+	}
+	if n := count(outs[1]); n != 100 {
+		t.Errorf("second consumer got %d updates, want 100", n)
+	}
+}
+
+// progressSaver records the snapshots saved by a ProgressAggregator.
+type progressSaver struct {
+	mu    sync.Mutex
+	saved []models.RunProgress
+}
+
+func (s *progressSaver) SaveRunProgress(p *models.RunProgress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, *p)
+	return nil
+}
+
+func TestProgressAggregator(t *testing.T) {
+	saver := &progressSaver{}
+	a := NewProgressAggregator(saver, 7, time.Millisecond)
+	updates := make(chan ProgressUpdate)
+	done := make(chan struct{})
+	go func() {
+		a.Run(updates)
+		close(done)
+	}()
+
+	for height := range int64(10) {
+		updates <- ProgressUpdate{BlockHeight: height, Status: "processing", TxCount: 50}
+		if height%5 == 4 {
+			updates <- ProgressUpdate{BlockHeight: height, Status: "failed", Error: errors.New("boom")}
+		} else {
+			updates <- ProgressUpdate{BlockHeight: height, Status: "completed", TxCount: 3}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s := a.Snapshot(); s.Processed != 8 || s.Failed != 2 {
+		t.Errorf("Snapshot() = %+v while running, want 8 processed and 2 failed", s)
+	}
+	close(updates)
+	<-done
+
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	if len(saver.saved) < 2 {
+		t.Fatalf("saved %d snapshots, want some while running and one at the end", len(saver.saved))
+	}
+	last := saver.saved[len(saver.saved)-1]
+	if last.RunID != 7 || last.Processed != 8 || last.Failed != 2 || last.TotalTxs != 24 || last.Rate <= 0 {
+		t.Errorf("last snapshot = %+v, want run 7 with 8 processed, 2 failed and 24 transactions", last)
+	}
+	if a.Err() != nil {
+		t.Errorf("Err() = %v", a.Err())
+	}
+}
@@ -0,0 +1,201 @@
+//go:build regtest
+
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"scrapbtc/internal/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The regtest test needs bitcoind in PATH:
+//
+//	go test -tags regtest -run TestRegtest ./internal/processor
+//
+// It starts a node of its own in a temporary data directory and stops it at
+// the end.
+const (
+	regtestUser   = "scrapbtc"
+	regtestPass   = "regtest"
+	regtestBlocks = 150
+)
+
+// regtestNode is a bitcoind in regtest mode.
+type regtestNode struct {
+	host string
+	id   int
+}
+
+// call sends a JSON-RPC request and decodes its result into result, if it
+// isn't nil.
+func (n *regtestNode) call(method string, result any, params ...any) error {
+	n.id++
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{"jsonrpc": "1.0", "id": n.id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+n.host, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(regtestUser, regtestPass)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %s: %w", method, resp.Status, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("%s: %s (%d)", method, reply.Error.Message, reply.Error.Code)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// freePort returns a local port nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startRegtest starts bitcoind and waits until it answers.
+func startRegtest(t *testing.T) *regtestNode {
+	t.Helper()
+	bitcoind, err := exec.LookPath("bitcoind")
+	if err != nil {
+		t.Skip("bitcoind is not in PATH")
+	}
+	rpcPort := freePort(t)
+	cmd := exec.Command(bitcoind, "-regtest", "-datadir="+t.TempDir(),
+		"-rpcuser="+regtestUser, "-rpcpassword="+regtestPass,
+		"-rpcport="+strconv.Itoa(rpcPort), "-port="+strconv.Itoa(freePort(t)),
+		"-listen=0", "-fallbackfee=0.0002", "-printtoconsole=0")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	node := &regtestNode{host: "127.0.0.1:" + strconv.Itoa(rpcPort)}
+	t.Cleanup(func() {
+		if node.call("stop", nil) != nil {
+			cmd.Process.Kill()
+		}
+		cmd.Wait()
+	})
+
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		err := node.call("getblockchaininfo", nil)
+		if err == nil {
+			return node
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bitcoind not ready: %v", err)
+		}
+	}
+}
+
+// TestRegtest mines 150 blocks and a block of wallet payments on a regtest
+// node, scrapes them all through rpc.Client, and checks the stored rows and
+// the fees of every block against getblockstats.
+func TestRegtest(t *testing.T) {
+	node := startRegtest(t)
+	var address string
+	if err := node.call("createwallet", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.call("getnewaddress", &address); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.call("generatetoaddress", nil, regtestBlocks, address); err != nil {
+		t.Fatal(err)
+	}
+	const payments = 5
+	for i := range payments {
+		var to string
+		if err := node.call("getnewaddress", &to); err != nil {
+			t.Fatal(err)
+		}
+		if err := node.call("sendtoaddress", nil, to, 0.5+float64(i)/10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := node.call("generatetoaddress", nil, 1, address); err != nil {
+		t.Fatal(err)
+	}
+	const tip = regtestBlocks + 1
+
+	client, err := rpc.NewClient([]string{node.host}, regtestUser, regtestPass, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	wp, database := newSourcePool(t, client, 4, Options{})
+	if err := wp.ProcessBlockRange(context.Background(), 0, tip); err != nil {
+		t.Fatal(err)
+	}
+	if completed, failed := wp.Counts(); completed != tip+1 || failed != 0 {
+		t.Fatalf("completed %d and failed %d blocks, want %d and none", completed, failed, tip+1)
+	}
+
+	blocks, err := database.GetBlocksByTime(time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != tip+1 {
+		t.Fatalf("stored %d blocks, want %d", len(blocks), tip+1)
+	}
+	txCounts, err := database.GetStoredTxCounts(time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txs int
+	for _, b := range blocks {
+		var stats struct {
+			Txs      int   `json:"txs"`
+			TotalFee int64 `json:"totalfee"`
+		}
+		if err := node.call("getblockstats", &stats, b.Height); err != nil {
+			t.Fatal(err)
+		}
+		if b.TxCount != stats.Txs || txCounts[b.Hash] != stats.Txs {
+			t.Errorf("block %d has %d transactions and %d stored, want %d", b.Height, b.TxCount, txCounts[b.Hash], stats.Txs)
+		}
+		if b.TotalFees != stats.TotalFee {
+			t.Errorf("block %d pays %d in fees, getblockstats says %d", b.Height, b.TotalFees, stats.TotalFee)
+		}
+		txs += txCounts[b.Hash]
+	}
+	// A coinbase in every block, and the payments in the last
+	if txs != tip+1+payments {
+		t.Errorf("stored %d transactions, want %d", txs, tip+1+payments)
+	}
+	if blocks[len(blocks)-1].TotalFees == 0 {
+		t.Error("the block of payments pays no fees")
+	}
+}
@@ -0,0 +1,38 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"scrapbtc/internal/rpc"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		attempts int
+	}{
+		{rpc.ErrConnection, maxFetchRetries},
+		{rpc.ErrNodeBusy, maxFetchRetries},
+		{rpc.ErrBlockNotFound, 1},
+		{rpc.ErrAuthFailed, 0},
+		{rpc.ErrPruned, 0},
+		{errors.New("failed to parse block"), 0},
+		// A request failed over across nodes fails with every node's error
+		{errors.Join(rpc.ErrConnection, rpc.ErrAuthFailed), 0},
+	}
+
+	for _, tt := range tests {
+		err := fmt.Errorf("failed to get block 1: %w", tt.err)
+		attempts := 0
+		for retryable(err, attempts) {
+			attempts++
+			if attempts > maxFetchRetries {
+				break
+			}
+		}
+		if attempts != tt.attempts {
+			t.Errorf("%v retried %d times, want %d", tt.err, attempts, tt.attempts)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Schedule is how the heights of a chunk are ordered relative to the size
+// of their blocks before they are dispatched.
+type Schedule string
+
+const (
+	// ScheduleFIFO dispatches heights in the configured Order.
+	ScheduleFIFO Schedule = "fifo"
+	// ScheduleSize dispatches the largest blocks of each chunk first, so
+	// that the run doesn't end with one fetcher busy with a large block
+	// while the others have nothing left to do. Blocks of the same size
+	// keep the configured Order.
+	ScheduleSize Schedule = "size"
+)
+
+func ParseSchedule(s string) (Schedule, error) {
+	switch sc := Schedule(s); sc {
+	case ScheduleFIFO, ScheduleSize:
+		return sc, nil
+	}
+	return "", fmt.Errorf("invalid schedule %q: must be fifo or size", s)
+}
+
+// scheduleBySize puts heights in the order of ScheduleSize, largest block
+// first. Without the size of every block it leaves them as they are and the
+// run is reported with ScheduleFIFO.
+func (wp *WorkerPool) scheduleBySize(ctx context.Context, heights []int64) {
+	if wp.opts.Schedule != ScheduleSize || len(heights) < 2 {
+		return
+	}
+	sizes, err := wp.blockSizes(ctx, heights)
+	if err != nil {
+		wp.sizesMissing.Store(true)
+		wp.send(ProgressUpdate{
+			Status:   "schedule",
+			DebugMsg: fmt.Sprintf("Dispatching %d blocks in %s order, their sizes are unknown: %v", len(heights), wp.opts.Order, err),
+		})
+		return
+	}
+	sort.SliceStable(heights, func(i, j int) bool { return sizes[heights[i]] > sizes[heights[j]] })
+}
+
+// blockSizes returns the transaction count of the block at each height,
+// which is also what the memory budget estimates blocks from. The counts of
+// the blocks already stored, such as by a headers sync, are read from the
+// database and the others are asked from the node with getblockheader,
+// numWorkers at a time. The hashes and headers are cached by the client, so
+// fetching the blocks afterwards doesn't ask for them again.
+func (wp *WorkerPool) blockSizes(ctx context.Context, heights []int64) (map[int64]int, error) {
+	fromHeight, toHeight := heights[0], heights[0]
+	for _, height := range heights {
+		fromHeight = min(fromHeight, height)
+		toHeight = max(toHeight, height)
+	}
+	stored, err := wp.db.GetBlockTxCounts(fromHeight, toHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored transaction counts: %w", err)
+	}
+
+	sizes := make(map[int64]int, len(heights))
+	var missing []int64
+	for _, height := range heights {
+		if n, ok := stored[height]; ok {
+			sizes[height] = n
+		} else {
+			missing = append(missing, height)
+		}
+	}
+	counts := make([]int, len(missing))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(wp.numWorkers)
+	for i, height := range missing {
+		g.Go(func() error {
+			hash, err := wp.rpcClient.GetBlockHashByHeight(gctx, height)
+			if err != nil {
+				return err
+			}
+			counts[i], err = wp.rpcClient.GetBlockTxCount(gctx, hash)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for i, height := range missing {
+		sizes[height] = counts[i]
+	}
+	return sizes, nil
+}
+
+// schedule returns the schedule the run dispatched its heights with.
+func (wp *WorkerPool) schedule() Schedule {
+	if wp.opts.Schedule != ScheduleSize || wp.sizesMissing.Load() {
+		return ScheduleFIFO
+	}
+	return ScheduleSize
+}
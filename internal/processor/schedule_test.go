@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc/rpctest"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+)
+
+// TestScheduleBySize orders heights by the transaction counts of a headers
+// sync for the blocks it stored and of the node for the others, and falls
+// back to the given order when the node doesn't know a block.
+func TestScheduleBySize(t *testing.T) {
+	chain := rpctest.Synthetic(10)
+	wp, database := newSourcePool(t, chain, 3, Options{Schedule: ScheduleSize})
+
+	// The synthetic blocks have 2 transactions, the genesis block 1
+	var headers []*models.Block
+	for height, txCount := range map[int64]int{3: 2500, 5: 10, 8: 2500} {
+		headers = append(headers, &models.Block{Hash: fmt.Sprintf("%064x", height), Height: height, TxCount: txCount, Timestamp: rpctest.SyntheticStart})
+	}
+	if _, err := database.InsertBlockHeaders(context.Background(), headers); err != nil {
+		t.Fatal(err)
+	}
+
+	heights := []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	wp.scheduleBySize(context.Background(), heights)
+	if want := []int64{3, 8, 5, 1, 2, 4, 6, 7, 9, 0}; !slices.Equal(heights, want) {
+		t.Errorf("scheduled %v, want %v", heights, want)
+	}
+	if wp.schedule() != ScheduleSize {
+		t.Errorf("schedule() = %s, want size", wp.schedule())
+	}
+
+	heights = []int64{9, 10, 8}
+	wp.scheduleBySize(context.Background(), heights)
+	if want := []int64{9, 10, 8}; !slices.Equal(heights, want) {
+		t.Errorf("scheduled %v without the size of block 10, want %v", heights, want)
+	}
+	if wp.schedule() != ScheduleFIFO {
+		t.Errorf("schedule() = %s after a chunk without sizes, want fifo", wp.schedule())
+	}
+}
+
+// TestTail processes a chain with either schedule and checks the "tail"
+// update sent once its blocks are stored.
+func TestTail(t *testing.T) {
+	chain := rpctest.Synthetic(40)
+	for _, schedule := range []Schedule{ScheduleFIFO, ScheduleSize} {
+		database, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer database.Close()
+		wp := NewWorkerPool(chain, database, 4, Options{Schedule: schedule})
+		var tails []ProgressUpdate
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for u := range wp.GetProgressChannel() {
+				if u.Status == "tail" {
+					tails = append(tails, u)
+				}
+			}
+		}()
+		if err := wp.ProcessBlockRange(context.Background(), 0, 39); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		if len(tails) != 1 || tails[0].Schedule != schedule || tails[0].Tail <= 0 {
+			t.Errorf("%s schedule: tail updates %+v, want one with the schedule and a duration", schedule, tails)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// sinkQueueSize is the number of stored batches queued for the sink before
+// the writer waits for it.
+const sinkQueueSize = 4
+
+// sinkWriter writes the stored batches from queue to the sink, one at a
+// time so the sink is never called concurrently, and flushes it after each
+// batch. It closes done once queue is closed and drained.
+func (wp *WorkerPool) sinkWriter(queue <-chan []*models.BlockData, done chan<- struct{}) {
+	defer close(done)
+
+	for batch := range queue {
+		for _, data := range batch {
+			err := wp.opts.Sink.WriteBlock(data.Block)
+			if err == nil {
+				err = wp.opts.Sink.WriteTransactions(data.Transactions)
+			}
+			if err != nil {
+				wp.send(ProgressUpdate{
+					BlockHeight: data.Block.Height,
+					Status:      "sink",
+					Warning:     fmt.Sprintf("Failed to write block %d to the sink: %v", data.Block.Height, err),
+				})
+			}
+		}
+		if err := wp.opts.Sink.Flush(); err != nil {
+			wp.send(ProgressUpdate{Status: "sink", Warning: fmt.Sprintf("Failed to flush the sink: %v", err)})
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+)
+
+// BlockSource is what a WorkerPool needs from the node. *rpc.Client is the
+// real one; rpctest.Chain serves fixture or synthetic blocks for tests
+// without a node.
+type BlockSource interface {
+	// GetBestBlockHeight returns the height of the tip.
+	GetBestBlockHeight() (int64, error)
+	// GetBlockHashByHeight returns the hash of the block at height.
+	GetBlockHashByHeight(ctx context.Context, height int64) (string, error)
+	// GetBlockVerbose returns the block with its transactions as
+	// getblock with verbosity 2 prints it.
+	GetBlockVerbose(ctx context.Context, hash string) (json.RawMessage, error)
+	// GetBlockTxCount returns the number of transactions in the block.
+	GetBlockTxCount(ctx context.Context, hash string) (int, error)
+	// GetBlockStats returns the getblockstats result of the block at
+	// height, for ModeStats.
+	GetBlockStats(ctx context.Context, height int64) (json.RawMessage, error)
+	// GetRawBlock returns the serialized block, for StoreRawBlocks.
+	GetRawBlock(ctx context.Context, hash string) ([]byte, error)
+
+	// GetNodeSnapshot, GetFeeEstimates and GetBlockTemplate record the
+	// node's state in follow mode.
+	GetNodeSnapshot(ctx context.Context) (*models.NodeSnapshot, error)
+	GetFeeEstimates(ctx context.Context, targets []int) ([]*models.FeeEstimate, error)
+	GetBlockTemplate(ctx context.Context) (*models.NextBlockEstimate, error)
+
+	// InvalidateHashesFrom drops the cached hashes from height on after a
+	// reorg.
+	InvalidateHashesFrom(height int64)
+	// LimiterState, HashCacheStats and Latency describe the requests for
+	// progress output and the adaptive fetchers.
+	LimiterState() string
+	HashCacheStats() (hits, misses uint64)
+	Latency() rpc.LatencyStats
+	// Availability reports outages of the node, see rpc.Client.
+	Availability() <-chan error
+}
+
+var _ BlockSource = (*rpc.Client)(nil)
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// validateValues checks that no output, transaction total or fee of a
+// parsed block is negative or above the 21 million BTC that will ever
+// exist. Such a value can only come from a bug or a broken node, and
+// storing it would corrupt every total computed from it, so the block fails
+// instead.
+func validateValues(data *models.BlockData) error {
+	for _, out := range data.Outputs {
+		if err := checkMoney(out.Value); err != nil {
+			return fmt.Errorf("output %d of transaction %s: %w", out.Vout, out.Txid, err)
+		}
+	}
+	for _, tx := range data.Transactions {
+		for _, v := range []struct {
+			name  string
+			value int64
+		}{
+			{"output value", tx.OutputValue},
+			{"input value", tx.InputValue},
+			{"fee", tx.Fee},
+		} {
+			if err := checkMoney(v.value); err != nil {
+				return fmt.Errorf("%s of transaction %s: %w", v.name, tx.Txid, err)
+			}
+		}
+	}
+	if err := checkMoney(data.Block.TotalFees); err != nil {
+		return fmt.Errorf("total fees: %w", err)
+	}
+	return nil
+}
+
+// checkMoney returns an error if sats is negative or above models.MaxMoney.
+func checkMoney(sats int64) error {
+	switch {
+	case sats < 0:
+		return fmt.Errorf("negative amount of %d satoshis", sats)
+	case sats > models.MaxMoney:
+		return fmt.Errorf("amount of %d satoshis exceeds the 21 million BTC supply", sats)
+	}
+	return nil
+}
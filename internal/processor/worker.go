@@ -2,17 +2,204 @@ package processor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"runtime"
+	"scrapbtc/internal/analysis"
 	"scrapbtc/internal/db"
+	"scrapbtc/internal/price"
 	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/sink"
+	"scrapbtc/internal/watchlist"
+	"scrapbtc/pkg/models"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// dispatchChunkSize is the number of heights whose processing status is
+// loaded and dispatched at a time.
+const dispatchChunkSize = 10000
+
+// parsedQueueSize is the number of parsed blocks queued for the writer.
+const parsedQueueSize = 50
+
+// maxFetchRetries is how many times a block whose fetch failed because the
+// node was unreachable or busy is tried again, waiting fetchRetryDelay
+// before the first retry and twice as long before each next one.
+const (
+	maxFetchRetries = 3
+	fetchRetryDelay = time.Second
+)
+
+// Defaults for Options.FlushRows and Options.FlushInterval.
+const (
+	DefaultFlushRows     = 50000
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// WorkerPool scrapes blocks in a three-stage pipeline: fetchers request
+// blocks from the node, parsers turn the JSON into models and a single
+// writer stores them in batches. The stages are connected by bounded
+// channels, so only a limited number of blocks is held in memory.
 type WorkerPool struct {
-	rpcClient  *rpc.Client
-	db         *db.DB
+	rpcClient  BlockSource
+	db         db.Store
 	numWorkers int
+	numParsers int
+	opts       Options
+	budget     *memoryBudget
+	dbSize     *dbSizeMonitor
+	pause      *pauseGate
+	// fetchLimit bounds the concurrent fetches with AdaptiveFetchers and is
+	// nil otherwise.
+	fetchLimit *fetchLimit
+	completed  atomic.Int64
+	failed     atomic.Int64
 	progress   chan ProgressUpdate
+	updates    <-chan ProgressUpdate
+
+	// deferredLinks are the stored blocks whose predecessor wasn't stored
+	// yet with --validate-chain, checked again once the range is done.
+	deferredLinks []*models.Block
+	// sinkQueue feeds the stored batches to the sink goroutine while a run
+	// with a Sink is in progress.
+	sinkQueue chan []*models.BlockData
+	// sizesMissing is set once a chunk was dispatched in FIFO order with
+	// ScheduleSize because the sizes of its blocks were unknown.
+	sizesMissing atomic.Bool
+	// idleSince is when the first fetcher found no height left to fetch,
+	// in Unix nanoseconds, and zero before.
+	idleSince atomic.Int64
+}
+
+// Options controls what the worker pool stores for each block.
+type Options struct {
+	// Mode selects what is fetched and stored for each block. The empty
+	// mode is ModeFull.
+	Mode Mode
+	// Profile selects the rows ModeFull stores for each block; the others
+	// aren't even decoded. The empty profile is models.ProfileFull.
+	Profile models.Profile
+	// SkipOpReturn disables storing OP_RETURN payloads.
+	SkipOpReturn bool
+	// Watchlist records the outputs paying its addresses and the inputs
+	// spending them in watched_activity, whatever the Profile. Inputs are
+	// only matched in blocks fetched with their prevouts, see
+	// rpc.Client.SetPrevouts.
+	Watchlist *watchlist.Watchlist
+	// Filter drops the transactions it leaves out before they are stored.
+	Filter Filter
+	// ComputeCDD stores coin days destroyed for each block as it is scraped.
+	ComputeCDD bool
+	// ResolveInputs fills the value and address of the inputs of each
+	// stored block from the stored outputs they spend.
+	ResolveInputs bool
+	// Order is the order heights are dispatched in.
+	Order Order
+	// Schedule reorders the heights of each chunk by the size of their
+	// blocks with ScheduleSize. The empty schedule is ScheduleFIFO.
+	Schedule Schedule
+	// StoreRawBlocks archives the serialized block in the raw_blocks table,
+	// or as compressed files under RawDir when it is set.
+	StoreRawBlocks bool
+	RawDir         string
+	// Parsers is the number of goroutines parsing fetched blocks. Zero
+	// uses one per CPU.
+	Parsers int
+	// MaxInflightBytes bounds the estimated memory of the blocks being
+	// fetched, parsed and stored at once. Zero is unlimited.
+	MaxInflightBytes int64
+	// DBPath is the database file whose size is reported in the progress
+	// updates. Empty disables the size monitoring.
+	DBPath string
+	// MaxDBSize stops dispatching blocks once the projected database size
+	// exceeds it. Zero is unlimited.
+	MaxDBSize int64
+	// FlushRows and FlushInterval control how long the writer buffers
+	// blocks: it stores them once they add up to FlushRows rows or
+	// FlushInterval after the first one was buffered. Zero uses
+	// DefaultFlushRows and DefaultFlushInterval.
+	FlushRows     int
+	FlushInterval time.Duration
+	// ForceReprocess processes completed blocks too, replacing their rows.
+	ForceReprocess bool
+	// AdaptiveFetchers starts with a few fetchers and adds more while the
+	// mean RPC latency stays below TargetLatency, halving them when it
+	// rises or requests fail. The number of workers is the upper bound.
+	AdaptiveFetchers bool
+	TargetLatency    time.Duration
+	// OptimizeAtEnd runs db.OptimizeForQueries once every block is stored,
+	// for runs that dropped the secondary indexes to load faster. It is
+	// reported with "optimizing" and "optimized" updates.
+	OptimizeAtEnd bool
+	// ValidateChain checks that each stored block's previous block hash
+	// matches the block stored at the height below and records mismatches
+	// in chain_breaks.
+	ValidateChain bool
+	// PollInterval is how often ProcessFollow checks for new blocks and
+	// records a node snapshot. Zero uses DefaultPollInterval.
+	PollInterval time.Duration
+	// EstimateInterval is how often ProcessFollow records the node's
+	// fee estimates for rpc.FeeEstimateTargets. Zero disables them.
+	EstimateInterval time.Duration
+	// TemplateInterval is how often ProcessFollow records a summary of
+	// the node's block template. Zero disables them.
+	TemplateInterval time.Duration
+	// MinerTagger identifies the pool of each block from its coinbase.
+	// Nil uses the built-in tags.
+	MinerTagger *analysis.MinerTagger
+	// Sink also receives every block stored with ModeFull, once its
+	// transaction is committed. Its failures are reported as warnings and
+	// don't fail the block. The caller closes it after the run.
+	Sink sink.Sink
+	// PriceSource, if set, has ProcessFollow record its latest price every
+	// PriceInterval, zero meaning DefaultPriceInterval, and the settled
+	// history of each past day, reported with "price" updates.
+	PriceSource   price.Source
+	PriceInterval time.Duration
+}
+
+// Mode is what the worker pool fetches and stores for each block.
+type Mode string
+
+const (
+	// ModeFull stores blocks with their transactions, inputs and outputs
+	// from getblock with verbosity 2.
+	ModeFull Mode = "full"
+	// ModeStats only stores the per-block aggregates from getblockstats in
+	// block_stats. Blocks count as processed once their aggregates are
+	// stored; processing_status isn't used.
+	ModeStats Mode = "stats"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case ModeFull, ModeStats:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid mode %q: must be full or stats", s)
+}
+
+// Order is the order in which ProcessBlockRange dispatches heights.
+type Order string
+
+const (
+	OrderAscending  Order = "ascending"
+	OrderDescending Order = "descending"
+	// OrderRandom shuffles the chunks and the heights within each chunk.
+	OrderRandom Order = "random"
+)
+
+func ParseOrder(s string) (Order, error) {
+	switch o := Order(s); o {
+	case OrderAscending, OrderDescending, OrderRandom:
+		return o, nil
+	}
+	return "", fmt.Errorf("invalid order %q: must be ascending, descending or random", s)
 }
 
 type ProgressUpdate struct {
@@ -21,76 +208,459 @@ type ProgressUpdate struct {
 	Status      string
 	Error       error
 	DebugMsg    string
+	// Chunk and Chunks are set on "chunk" updates, sent when the dispatcher
+	// moves on to the next chunk of heights.
+	Chunk  int
+	Chunks int
+	// InflightBytes is the estimated memory of the blocks in flight when the
+	// update was sent, out of InflightLimit. Both are zero without a budget.
+	InflightBytes int64
+	InflightLimit int64
+	// DBSize is the size of the database file and its WAL at the last
+	// sample, and DBSizeProjected its projected size once the range is
+	// processed. Both are zero without size monitoring, and the projection
+	// until enough blocks are stored.
+	DBSize          int64
+	DBSizeProjected int64
+	// FlushBlocks, FlushRows and FlushDuration describe the write on
+	// "flush" updates.
+	FlushBlocks   int
+	FlushRows     int
+	FlushDuration time.Duration
+	// Warning describes a problem that doesn't fail the block, such as a
+	// chain break.
+	Warning string
+	// Fetchers is the current limit on concurrent fetches with adaptive
+	// fetchers, zero otherwise.
+	Fetchers int
+	// EndHeight is the new end of the range on "tip" updates, sent by
+	// ProcessFollow when the node has new blocks.
+	EndHeight int64
+	// HashCacheHits and HashCacheMisses count the block hash and header
+	// lookups served from the RPC cache and sent to a node so far. Both are
+	// zero without a cache.
+	HashCacheHits   uint64
+	HashCacheMisses uint64
+	// Tail and Schedule are set on the "tail" update sent once every block
+	// of a range is stored: Tail is the time from the first fetcher running
+	// out of heights to the last block stored, and Schedule the schedule
+	// the heights were dispatched with.
+	Tail     time.Duration
+	Schedule Schedule
 }
 
-func NewWorkerPool(rpcClient *rpc.Client, database *db.DB, numWorkers int) *WorkerPool {
+// NewWorkerPool returns a pool fetching blocks from rpcClient with
+// numWorkers concurrent fetchers.
+func NewWorkerPool(rpcClient BlockSource, database db.Store, numWorkers int, opts Options) *WorkerPool {
+	numParsers := opts.Parsers
+	if numParsers <= 0 {
+		numParsers = runtime.NumCPU()
+	}
+	if opts.FlushRows <= 0 {
+		opts.FlushRows = DefaultFlushRows
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.MinerTagger == nil {
+		opts.MinerTagger = analysis.NewMinerTagger(nil)
+	}
+	var limit *fetchLimit
+	if opts.AdaptiveFetchers {
+		if opts.TargetLatency <= 0 {
+			opts.TargetLatency = DefaultTargetLatency
+		}
+		limit = newFetchLimit(min(minAdaptiveFetchers, numWorkers))
+	}
+	progress := make(chan ProgressUpdate, numWorkers*2)
 	return &WorkerPool{
 		rpcClient:  rpcClient,
 		db:         database,
 		numWorkers: numWorkers,
-		progress:   make(chan ProgressUpdate, numWorkers*2),
+		numParsers: numParsers,
+		opts:       opts,
+		budget:     newMemoryBudget(opts.MaxInflightBytes),
+		pause:      newPauseGate(),
+		fetchLimit: limit,
+		progress:   progress,
+		updates:    relayProgress(progress),
 	}
 }
 
+// ProcessBlockRange processes every block in [fromHeight, toHeight] that
+// isn't completed yet, or every block with ForceReprocess. Heights are
+// dispatched in chunks of dispatchChunkSize so memory use doesn't grow with
+// the size of the range.
 func (wp *WorkerPool) ProcessBlockRange(ctx context.Context, fromHeight, toHeight int64) error {
-	processedBlocks, err := wp.db.GetProcessedBlocks(fromHeight, toHeight)
+	remaining, err := wp.remaining(fromHeight, toHeight)
 	if err != nil {
-		return fmt.Errorf("failed to get processed blocks: %w", err)
+		close(wp.progress)
+		return err
 	}
 
-	blockHeights := make([]int64, 0)
-	for height := fromHeight; height <= toHeight; height++ {
-		if !processedBlocks[height] {
-			blockHeights = append(blockHeights, height)
-		}
+	return wp.run(ctx, remaining, func(jobs chan<- int64) (int64, error) {
+		return wp.dispatch(ctx, fromHeight, toHeight, jobs)
+	})
+}
+
+// remaining returns the number of blocks in [fromHeight, toHeight] left to
+// process, used to project the database size. Without size monitoring it
+// doesn't query the database and returns the size of the range.
+func (wp *WorkerPool) remaining(fromHeight, toHeight int64) (int64, error) {
+	remaining := toHeight - fromHeight + 1
+	if wp.opts.DBPath == "" || wp.opts.ForceReprocess {
+		return remaining, nil
+	}
+	var completed int64
+	var err error
+	if wp.opts.Mode == ModeStats {
+		completed, err = wp.db.CountBlockStats(fromHeight, toHeight)
+	} else {
+		completed, _, err = wp.db.GetStatusCounts(fromHeight, toHeight)
 	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count processed blocks: %w", err)
+	}
+	return remaining - completed, nil
+}
 
-	if len(blockHeights) == 0 {
-		wp.progress <- ProgressUpdate{Status: "All blocks already processed"}
+// ProcessBlockList processes the given heights that aren't completed yet,
+// or all of them with ForceReprocess, in the configured order and schedule,
+// dispatchChunkSize at a time. Duplicates are processed once.
+func (wp *WorkerPool) ProcessBlockList(ctx context.Context, heights []int64) error {
+	pending, err := wp.pendingHeights(heights)
+	if err != nil {
 		close(wp.progress)
-		return nil
+		return err
 	}
+	wp.orderHeights(pending)
+
+	return wp.run(ctx, int64(len(pending)), func(jobs chan<- int64) (int64, error) {
+		var dispatched int64
+		for start := 0; start < len(pending); start += dispatchChunkSize {
+			chunk := pending[start:min(start+dispatchChunkSize, len(pending))]
+			wp.scheduleBySize(ctx, chunk)
+			sent, err := wp.sendJobs(ctx, chunk, jobs)
+			dispatched += sent
+			if err != nil {
+				return dispatched, err
+			}
+		}
+		return dispatched, nil
+	})
+}
 
-	jobs := make(chan int64, len(blockHeights))
-	var wg sync.WaitGroup
+// run starts the pipeline, feeds it the heights sent by dispatch and waits
+// for every stage to finish. remaining is the number of blocks expected to
+// be processed, used to project the database size.
+func (wp *WorkerPool) run(ctx context.Context, remaining int64, dispatch func(jobs chan<- int64) (int64, error)) error {
+	wp.dbSize = newDBSizeMonitor(wp.opts.DBPath, wp.opts.MaxDBSize, remaining)
 
+	jobs := make(chan int64, wp.numWorkers*2)
+	fetched := make(chan *fetchedBlock, wp.numParsers*2)
+	parsed := make(chan *parsedBlock, parsedQueueSize)
+
+	var fetchers, parsers sync.WaitGroup
 	for i := 0; i < wp.numWorkers; i++ {
-		wg.Add(1)
-		go wp.worker(ctx, jobs, &wg)
+		fetchers.Add(1)
+		go wp.fetcher(ctx, jobs, fetched, &fetchers)
+	}
+	for i := 0; i < wp.numParsers; i++ {
+		parsers.Add(1)
+		go wp.parser(ctx, fetched, parsed, &parsers)
+	}
+	writerDone := make(chan struct{})
+	go wp.writer(ctx, parsed, writerDone)
+	sinkDone := make(chan struct{})
+	if wp.opts.Sink != nil {
+		wp.sinkQueue = make(chan []*models.BlockData, sinkQueueSize)
+		go wp.sinkWriter(wp.sinkQueue, sinkDone)
+	} else {
+		close(sinkDone)
+	}
+
+	stopMonitor := make(chan struct{})
+	monitorDone := make(chan struct{})
+	if wp.dbSize != nil {
+		go wp.monitorDBSize(ctx, stopMonitor, monitorDone)
+	} else {
+		close(monitorDone)
+	}
+	stopPause := make(chan struct{})
+	pauseDone := make(chan struct{})
+	go wp.watchPause(stopPause, pauseDone)
+	stopAdjust := make(chan struct{})
+	adjustDone := make(chan struct{})
+	if wp.fetchLimit != nil {
+		go wp.adjustConcurrency(stopAdjust, adjustDone)
+	} else {
+		close(adjustDone)
+	}
+
+	dispatched, err := dispatch(jobs)
+	close(jobs)
+
+	// Each stage closes the input of the next one once it has drained its
+	// own input and its workers are done.
+	fetchers.Wait()
+	close(fetched)
+	parsers.Wait()
+	close(parsed)
+	<-writerDone
+	if since := wp.idleSince.Load(); since != 0 && err == nil && ctx.Err() == nil && dispatched > 0 {
+		tail := time.Since(time.Unix(0, since))
+		wp.send(ProgressUpdate{
+			Status:   "tail",
+			Tail:     tail,
+			Schedule: wp.schedule(),
+			DebugMsg: fmt.Sprintf("Last blocks stored %s after the first fetcher ran out of blocks (%s schedule)", tail.Round(time.Millisecond), wp.schedule()),
+		})
+	}
+	if wp.sinkQueue != nil {
+		close(wp.sinkQueue)
+	}
+	<-sinkDone
+	if wp.opts.ValidateChain && ctx.Err() == nil {
+		wp.validateDeferredLinks()
+	}
+	if wp.opts.OptimizeAtEnd && ctx.Err() == nil && (err == nil || errors.Is(err, ErrDBSizeLimit)) {
+		wp.optimize()
+	}
+	close(stopMonitor)
+	<-monitorDone
+	close(stopPause)
+	<-pauseDone
+	close(stopAdjust)
+	<-adjustDone
+	if wp.dbSize != nil {
+		wp.dbSize.sample(wp.Counts())
+	}
+	// Read before closing progress: the consumer may cancel ctx once it sees
+	// the channel closed, which doesn't mean the run was interrupted
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil && dispatched == 0 {
+		wp.send(ProgressUpdate{Status: "All blocks already processed"})
+	}
+	close(wp.progress)
+	return err
+}
+
+// dispatch sends the heights that still need processing to jobs, one chunk
+// at a time in the configured order, and returns how many it sent.
+func (wp *WorkerPool) dispatch(ctx context.Context, fromHeight, toHeight int64, jobs chan<- int64) (int64, error) {
+	chunks := (toHeight - fromHeight + dispatchChunkSize) / dispatchChunkSize
+	var dispatched int64
+
+	chunkOrder := make([]int64, chunks)
+	for i := range chunkOrder {
+		chunkOrder[i] = int64(i)
+	}
+	wp.orderHeights(chunkOrder)
+
+	for n, chunk := range chunkOrder {
+		chunkStart := fromHeight + chunk*dispatchChunkSize
+		chunkEnd := chunkStart + dispatchChunkSize - 1
+		if chunkEnd > toHeight {
+			chunkEnd = toHeight
+		}
+
+		processedBlocks, err := wp.processedBlocks(chunkStart, chunkEnd)
+		if err != nil {
+			return dispatched, err
+		}
+
+		heights := make([]int64, 0, chunkEnd-chunkStart+1-int64(len(processedBlocks)))
+		for height := chunkStart; height <= chunkEnd; height++ {
+			if !processedBlocks[height] {
+				heights = append(heights, height)
+			}
+		}
+		wp.orderHeights(heights)
+		wp.scheduleBySize(ctx, heights)
+
+		wp.send(ProgressUpdate{
+			Status:   "chunk",
+			Chunk:    n + 1,
+			Chunks:   int(chunks),
+			DebugMsg: fmt.Sprintf("Chunk %d/%d: blocks %d-%d, %d to process", n+1, chunks, chunkStart, chunkEnd, len(heights)),
+		})
+
+		sent, err := wp.sendJobs(ctx, heights, jobs)
+		dispatched += sent
+		if err != nil {
+			return dispatched, err
+		}
 	}
 
-	for _, height := range blockHeights {
+	return dispatched, nil
+}
+
+// processedBlocks returns the completed heights in [fromHeight, toHeight]
+// that are skipped, none with ForceReprocess. With ModeStats these are the
+// heights already in block_stats.
+func (wp *WorkerPool) processedBlocks(fromHeight, toHeight int64) (map[int64]bool, error) {
+	if wp.opts.ForceReprocess {
+		return map[int64]bool{}, nil
+	}
+	getProcessed := wp.db.GetProcessedBlocks
+	if wp.opts.Mode == ModeStats {
+		getProcessed = wp.db.GetBlockStatsHeights
+	}
+	processed, err := getProcessed(fromHeight, toHeight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processed blocks: %w", err)
+	}
+	return processed, nil
+}
+
+// sendJobs sends heights to jobs until they are all sent, ctx is cancelled
+// or the projected database size exceeds the limit.
+func (wp *WorkerPool) sendJobs(ctx context.Context, heights []int64, jobs chan<- int64) (int64, error) {
+	var sent int64
+	for _, height := range heights {
+		if wp.dbSize.overLimit() {
+			return sent, ErrDBSizeLimit
+		}
 		select {
 		case jobs <- height:
+			sent++
 		case <-ctx.Done():
-			close(jobs)
-			wg.Wait()
-			return ctx.Err()
+			return sent, ctx.Err()
 		}
 	}
-	close(jobs)
+	return sent, nil
+}
 
-	wg.Wait()
-	close(wp.progress)
-	return nil
+// orderHeights puts ascending heights, or chunk numbers, in the configured
+// order.
+func (wp *WorkerPool) orderHeights(heights []int64) {
+	switch wp.opts.Order {
+	case OrderDescending:
+		for i, j := 0, len(heights)-1; i < j; i, j = i+1, j-1 {
+			heights[i], heights[j] = heights[j], heights[i]
+		}
+	case OrderRandom:
+		rand.Shuffle(len(heights), func(i, j int) {
+			heights[i], heights[j] = heights[j], heights[i]
+		})
+	}
+}
+
+// pendingHeights returns the distinct heights that aren't completed yet,
+// in ascending order.
+func (wp *WorkerPool) pendingHeights(heights []int64) ([]int64, error) {
+	sorted := append([]int64(nil), heights...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	pending := make([]int64, 0, len(sorted))
+	for start := 0; start < len(sorted); start += dispatchChunkSize {
+		chunk := sorted[start:min(start+dispatchChunkSize, len(sorted))]
+		processed, err := wp.processedBlocks(chunk[0], chunk[len(chunk)-1])
+		if err != nil {
+			return nil, err
+		}
+		for _, height := range chunk {
+			duplicate := len(pending) > 0 && pending[len(pending)-1] == height
+			if !processed[height] && !duplicate {
+				pending = append(pending, height)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// fetchedBlock is a block fetched with verbosity 2, or its getblockstats
+// result with ModeStats, not parsed yet. weight is what it holds of the
+// memory budget until it is stored. fetchTime is the time all its fetch
+// attempts took and rpcTime the time the successful one spent in RPC calls.
+type fetchedBlock struct {
+	height    int64
+	hash      string
+	result    json.RawMessage
+	weight    int64
+	fetchTime time.Duration
+	rpcTime   time.Duration
 }
 
-func (wp *WorkerPool) worker(ctx context.Context, jobs <-chan int64, wg *sync.WaitGroup) {
+// parsedBlock holds either the rows of a block or, with ModeStats, its
+// aggregates, and the timings recorded once it is stored.
+type parsedBlock struct {
+	data      *models.BlockData
+	stats     *models.BlockStats
+	weight    int64
+	fetchTime time.Duration
+	rpcTime   time.Duration
+	parseTime time.Duration
+}
+
+func (b *parsedBlock) height() int64 {
+	if b.stats != nil {
+		return b.stats.Height
+	}
+	return b.data.Block.Height
+}
+
+func (b *parsedBlock) txCount() int {
+	if b.stats != nil {
+		return int(b.stats.TxCount)
+	}
+	return len(b.data.Transactions)
+}
+
+// rows is the number of rows the block adds to the database.
+func (b *parsedBlock) rows() int {
+	if b.stats != nil {
+		return 1
+	}
+	return blockRows(b.data)
+}
+
+// fetcher marks the heights from jobs processing and fetches their blocks.
+func (wp *WorkerPool) fetcher(ctx context.Context, jobs <-chan int64, fetched chan<- *fetchedBlock, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for {
 		select {
 		case height, ok := <-jobs:
 			if !ok {
+				wp.idleSince.CompareAndSwap(0, time.Now().UnixNano())
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			// Hold the height while paused; it isn't marked processing yet
+			if wp.pause.wait(ctx) != nil {
+				return
+			}
+
+			if wp.fetchLimit.acquire(ctx) != nil {
 				return
 			}
-			
-			if err := wp.processBlock(ctx, height); err != nil {
-				wp.progress <- ProgressUpdate{
+			block, err := wp.fetchWithRetry(ctx, height)
+			wp.fetchLimit.release()
+			if errors.Is(err, db.ErrBlockClaimed) {
+				// Another instance sharing the database is processing it
+				wp.send(ProgressUpdate{
 					BlockHeight: height,
-					Status:      "failed",
-					Error:       err,
-				}
+					Status:      "claimed",
+					DebugMsg:    fmt.Sprintf("Skipping block %d: %v", height, err),
+				})
+				continue
+			}
+			if err != nil {
+				wp.fail(ctx, height, err)
+				continue
+			}
+
+			select {
+			case fetched <- block:
+			case <-ctx.Done():
+				wp.budget.release(block.weight)
+				wp.interrupt(height)
+				return
 			}
 
 		case <-ctx.Done():
@@ -99,79 +669,497 @@ func (wp *WorkerPool) worker(ctx context.Context, jobs <-chan int64, wg *sync.Wa
 	}
 }
 
-func (wp *WorkerPool) processBlock(ctx context.Context, height int64) error {
-	wp.progress <- ProgressUpdate{
+// fetchWithRetry fetches a block, retrying failures that may go away: a
+// node that is unreachable or busy, and a hash replaced by a reorg between
+// getblockhash and getblock. Other failures, such as rejected credentials or
+// pruned blocks, fail the block right away.
+func (wp *WorkerPool) fetchWithRetry(ctx context.Context, height int64) (*fetchedBlock, error) {
+	delay := fetchRetryDelay
+	started := time.Now()
+	for attempt := 0; ; attempt++ {
+		block, err := wp.fetchBlock(ctx, height)
+		if err == nil {
+			block.fetchTime = time.Since(started)
+		}
+		if err == nil || ctx.Err() != nil || !retryable(err, attempt) {
+			return block, err
+		}
+		if errors.Is(err, rpc.ErrBlockNotFound) {
+			// Look the hash up again rather than getting it from the cache
+			wp.rpcClient.InvalidateHashesFrom(height)
+		}
+
+		wp.send(ProgressUpdate{
+			BlockHeight: height,
+			Status:      "retrying",
+			DebugMsg:    fmt.Sprintf("Retrying block %d in %v: %v", height, delay, err),
+		})
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether a fetch that failed with err on the given
+// attempt, counted from zero, is tried again.
+func retryable(err error, attempt int) bool {
+	switch {
+	case errors.Is(err, rpc.ErrAuthFailed), errors.Is(err, rpc.ErrPruned):
+		return false
+	case errors.Is(err, rpc.ErrBlockNotFound):
+		return attempt == 0
+	case rpc.IsTransient(err):
+		return attempt < maxFetchRetries
+	}
+	return false
+}
+
+func (wp *WorkerPool) fetchBlock(ctx context.Context, height int64) (*fetchedBlock, error) {
+	wp.send(ProgressUpdate{
 		BlockHeight: height,
 		Status:      "processing",
-		DebugMsg:    fmt.Sprintf("Starting to process block %d", height),
+		DebugMsg:    fmt.Sprintf("Starting to process block %d (%s)", height, wp.rpcClient.LimiterState()),
+	})
+
+	if wp.opts.Mode == ModeStats {
+		// The aggregates are a few hundred bytes, so they take nothing from
+		// the memory budget
+		result, err := wp.rpcClient.GetBlockStats(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		return &fetchedBlock{height: height, result: result}, nil
 	}
 
-	hash, err := wp.rpcClient.GetBlockHashByHeight(height)
+	start := time.Now()
+	hash, err := wp.rpcClient.GetBlockHashByHeight(ctx, height)
 	if err != nil {
-		wp.db.MarkBlockFailed(height, err.Error())
-		return fmt.Errorf("failed to get hash for block %d: %w", height, err)
+		return nil, fmt.Errorf("failed to get hash for block %d: %w", height, err)
 	}
+	rpcTime := time.Since(start)
 
-	if err := wp.db.MarkBlockProcessing(height, hash); err != nil {
-		return fmt.Errorf("failed to mark block processing: %w", err)
+	if err := wp.db.MarkBlockProcessing(ctx, height, hash); err != nil {
+		return nil, fmt.Errorf("failed to mark block processing: %w", err)
 	}
 
-	block, transactions, err := wp.rpcClient.GetBlockWithTransactions(hash)
+	weight, err := wp.reserve(ctx, height, hash)
 	if err != nil {
-		wp.db.MarkBlockFailed(height, err.Error())
-		return fmt.Errorf("failed to get block %d with transactions: %w", height, err)
+		return nil, err
 	}
 
-	if err := wp.db.InsertBlock(block); err != nil {
-		wp.db.MarkBlockFailed(height, err.Error())
-		return fmt.Errorf("failed to insert block %d: %w", height, err)
-	}
-
-	const batchSize = 500  // Reduced batch size for lower memory usage
-	totalTxs := len(transactions)
-	
-	for i := 0; i < totalTxs; i += batchSize {
-		end := i + batchSize
-		if end > totalTxs {
-			end = totalTxs
-		}
-		
-		batch := transactions[i:end]
-		if err := wp.db.InsertTransactionsBatch(batch); err != nil {
-			wp.db.MarkBlockFailed(height, err.Error())
-			return fmt.Errorf("failed to insert transaction batch: %w", err)
-		}
-		
-		// Clear processed transactions to free memory
-		for j := i; j < end; j++ {
-			transactions[j] = nil
-		}
-		
-		wp.progress <- ProgressUpdate{
-			BlockHeight: height,
-			TxCount:     end,
+	if wp.opts.StoreRawBlocks {
+		if err := wp.storeRawBlock(ctx, height, hash); err != nil {
+			wp.budget.release(weight)
+			return nil, err
+		}
+	}
+
+	start = time.Now()
+	result, err := wp.rpcClient.GetBlockVerbose(ctx, hash)
+	if err != nil {
+		wp.budget.release(weight)
+		return nil, fmt.Errorf("failed to get block %d with transactions: %w", height, err)
+	}
+	rpcTime += time.Since(start)
+	return &fetchedBlock{height: height, hash: hash, result: result, weight: weight, rpcTime: rpcTime}, nil
+}
+
+// reserve waits until the block's estimated size fits in the memory budget
+// and returns the weight to release once it is stored. getblockheader has no
+// size field, so the size is estimated from the transaction count.
+func (wp *WorkerPool) reserve(ctx context.Context, height int64, hash string) (int64, error) {
+	if wp.budget == nil {
+		return 0, nil
+	}
+	txCount, err := wp.rpcClient.GetBlockTxCount(ctx, hash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction count of block %d: %w", height, err)
+	}
+	weight, err := wp.budget.acquire(ctx, int64(txCount)*estimatedBytesPerTx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wait for memory for block %d: %w", height, err)
+	}
+	return weight, nil
+}
+
+// parser turns fetched blocks into models. It drains fetched even after ctx
+// is cancelled, so that every block marked processing is accounted for.
+func (wp *WorkerPool) parser(ctx context.Context, fetched <-chan *fetchedBlock, parsed chan<- *parsedBlock, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for block := range fetched {
+		if ctx.Err() != nil {
+			wp.budget.release(block.weight)
+			wp.interrupt(block.height)
+			continue
+		}
+
+		pb, err := wp.parse(block)
+		if err != nil {
+			wp.budget.release(block.weight)
+			wp.fail(ctx, block.height, fmt.Errorf("failed to parse block %d: %w", block.height, err))
+			continue
+		}
+		totalTxs := pb.txCount()
+
+		msg := fmt.Sprintf("Block %d: storing %d transactions", block.height, totalTxs)
+		if pb.stats != nil {
+			msg = fmt.Sprintf("Block %d: storing stats of %d transactions", block.height, totalTxs)
+		}
+		wp.send(ProgressUpdate{
+			BlockHeight: block.height,
+			TxCount:     totalTxs,
 			Status:      "processing_transactions",
-			DebugMsg:    fmt.Sprintf("Block %d: processed %d/%d transactions", height, end, totalTxs),
+			DebugMsg:    msg,
+		})
+
+		select {
+		case parsed <- pb:
+		case <-ctx.Done():
+			wp.budget.release(block.weight)
+			wp.interrupt(block.height)
 		}
 	}
-	
-	// Clear transaction slice to free memory
-	transactions = nil
+}
+
+// parse turns a fetched block into its rows, or its aggregates with
+// ModeStats.
+func (wp *WorkerPool) parse(block *fetchedBlock) (*parsedBlock, error) {
+	pb := &parsedBlock{weight: block.weight, fetchTime: block.fetchTime, rpcTime: block.rpcTime}
+	start := time.Now()
+	var err error
+	if wp.opts.Mode == ModeStats {
+		pb.stats, err = rpc.ParseBlockStats(block.result)
+	} else {
+		pb.data, err = parseBlockData(block.result, &wp.opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pb.parseTime = time.Since(start)
+	return pb, nil
+}
+
+// parseBlockData parses a block fetched with verbosity 2 into the rows
+// opts stores.
+func parseBlockData(result json.RawMessage, opts *Options) (*models.BlockData, error) {
+	data, err := rpc.ParseBlockWatching(result, opts.Profile, opts.Watchlist)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateValues(data); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	if opts.SkipOpReturn {
+		data.OpReturns = nil
+	}
+	opts.Filter.apply(data)
+	data.Block.MinerTag = opts.MinerTagger.Tag(data.Block.CoinbaseScript)
+	work, err := analysis.BlockWork(data.Block.Bits)
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", data.Block.Height, err)
+	}
+	data.Block.Work = work.String()
+	return data, nil
+}
 
-	if err := wp.db.MarkBlockCompleted(height); err != nil {
-		return fmt.Errorf("failed to mark block completed: %w", err)
+// writer stores parsed blocks. It buffers them until they add up to
+// FlushRows rows or FlushInterval has passed since the first one, then
+// stores the buffer in height order in one transaction. It also flushes
+// once the buffer holds half the memory budget. Blocks are only
+// marked completed by that transaction, so a crash never leaves a block
+// marked completed without its rows.
+func (wp *WorkerPool) writer(ctx context.Context, parsed <-chan *parsedBlock, done chan<- struct{}) {
+	defer close(done)
+
+	var batch []*parsedBlock
+	var rows int
+	var weight int64
+	timer := time.NewTimer(wp.opts.FlushInterval)
+	timer.Stop()
+	var deadline <-chan time.Time
+
+	flush := func(reason string) {
+		timer.Stop()
+		deadline = nil
+		if len(batch) == 0 {
+			return
+		}
+
+		if ctx.Err() != nil {
+			for _, block := range batch {
+				wp.interrupt(block.height())
+			}
+		} else {
+			sort.Slice(batch, func(i, j int) bool {
+				return batch[i].height() < batch[j].height()
+			})
+			start := time.Now()
+			wp.store(ctx, batch)
+			wp.send(ProgressUpdate{
+				Status:        "flush",
+				FlushBlocks:   len(batch),
+				FlushRows:     rows,
+				FlushDuration: time.Since(start),
+				DebugMsg: fmt.Sprintf("Flushed %d blocks, %d rows in %s (%s)",
+					len(batch), rows, time.Since(start).Round(time.Millisecond), reason),
+			})
+		}
+		wp.budget.release(weight)
+		batch, rows, weight = batch[:0], 0, 0
 	}
 
-	wp.progress <- ProgressUpdate{
+	for {
+		select {
+		case block, ok := <-parsed:
+			if !ok {
+				flush("end of range")
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(wp.opts.FlushInterval)
+				deadline = timer.C
+			}
+			batch = append(batch, block)
+			rows += block.rows()
+			weight += block.weight
+			switch {
+			case rows >= wp.opts.FlushRows:
+				flush("row threshold")
+			case wp.budget != nil && weight >= wp.budget.limit/2:
+				// Buffered blocks hold their memory until stored, so
+				// waiting for more would stall the fetchers
+				flush("memory budget")
+			}
+		case <-deadline:
+			flush("interval")
+		}
+	}
+}
+
+// blockRows is the number of rows a block adds to the database.
+func blockRows(data *models.BlockData) int {
+	return 1 + len(data.Transactions) + len(data.Inputs) + len(data.Outputs) + len(data.OpReturns) + len(data.Watched)
+}
+
+// store writes a batch of parsed blocks, which all hold rows or all hold
+// aggregates depending on the mode.
+func (wp *WorkerPool) store(ctx context.Context, batch []*parsedBlock) {
+	if wp.opts.Mode == ModeStats {
+		stats := make([]*models.BlockStats, len(batch))
+		for i, block := range batch {
+			stats[i] = block.stats
+		}
+		wp.writeStats(ctx, stats)
+		return
+	}
+	wp.writeBatch(ctx, batch)
+}
+
+// writeStats stores the aggregates of a batch of blocks, one by one if the
+// batch fails so only the broken one fails.
+func (wp *WorkerPool) writeStats(ctx context.Context, batch []*models.BlockStats) {
+	err := wp.db.InsertBlockStats(ctx, batch)
+	if err != nil && ctx.Err() == nil && len(batch) > 1 {
+		for _, stats := range batch {
+			wp.writeStats(ctx, []*models.BlockStats{stats})
+		}
+		return
+	}
+	for _, stats := range batch {
+		if err != nil {
+			wp.fail(ctx, stats.Height, fmt.Errorf("failed to store stats of block %d: %w", stats.Height, err))
+			continue
+		}
+		wp.send(ProgressUpdate{
+			BlockHeight: stats.Height,
+			TxCount:     int(stats.TxCount),
+			Status:      "completed",
+			DebugMsg:    fmt.Sprintf("Completed stats of block %d with %d transactions", stats.Height, stats.TxCount),
+		})
+	}
+}
+
+func (wp *WorkerPool) writeBatch(ctx context.Context, batch []*parsedBlock) {
+	insert := wp.db.InsertBlocksWithTransactions
+	if wp.opts.ForceReprocess {
+		insert = wp.db.ReplaceBlocksWithTransactions
+	}
+	blocks := make([]*models.BlockData, len(batch))
+	for i, block := range batch {
+		blocks[i] = block.data
+	}
+	start := time.Now()
+	err := insert(ctx, blocks)
+	if err != nil && ctx.Err() == nil && len(batch) > 1 {
+		// Store the blocks one by one so only the broken one fails
+		for _, block := range batch {
+			wp.writeBatch(ctx, []*parsedBlock{block})
+		}
+		return
+	}
+	if err != nil {
+		for _, data := range blocks {
+			wp.fail(ctx, data.Block.Height, fmt.Errorf("failed to store block %d: %w", data.Block.Height, err))
+		}
+		return
+	}
+	wp.recordTimings(ctx, batch, time.Since(start))
+	if wp.sinkQueue != nil {
+		wp.sinkQueue <- blocks
+	}
+	if wp.opts.ResolveInputs {
+		wp.resolveInputs(ctx, blocks)
+	}
+
+	for _, data := range blocks {
+		height := data.Block.Height
+		// CDD reads the committed outputs, so it is computed once the block
+		// is stored. 'analyze cdd' fills it in if this fails.
+		if wp.opts.ComputeCDD {
+			if err := analysis.ComputeBlockCDD(wp.db, data.Block); err != nil {
+				wp.fail(ctx, height, fmt.Errorf("failed to compute coin days destroyed: %w", err))
+				continue
+			}
+		}
+
+		if wp.opts.ValidateChain {
+			wp.validateLink(data.Block)
+		}
+
+		totalTxs := len(data.Transactions)
+		wp.send(ProgressUpdate{
+			BlockHeight: height,
+			TxCount:     totalTxs,
+			Status:      "completed",
+			DebugMsg:    fmt.Sprintf("Completed block %d with %d transactions", height, totalTxs),
+		})
+	}
+}
+
+// recordTimings stores how long each block of a batch took. The time of
+// the transaction that stored the batch is shared among its blocks by the
+// rows they added. The total leaves out the time blocks spent queued
+// between the stages, which depends on the others. Failing to record them
+// only warns.
+func (wp *WorkerPool) recordTimings(ctx context.Context, batch []*parsedBlock, insertTime time.Duration) {
+	var rows int
+	for _, block := range batch {
+		rows += block.rows()
+	}
+	timings := make([]*models.BlockTiming, len(batch))
+	for i, block := range batch {
+		insert := insertTime * time.Duration(block.rows()) / time.Duration(rows)
+		timings[i] = &models.BlockTiming{
+			Height:     block.height(),
+			RPCFetchMs: block.rpcTime.Milliseconds(),
+			ParseMs:    block.parseTime.Milliseconds(),
+			DBInsertMs: insert.Milliseconds(),
+			TotalMs:    (block.fetchTime + block.parseTime + insert).Milliseconds(),
+		}
+	}
+	if err := wp.db.SetBlockTimings(ctx, timings); err != nil && ctx.Err() == nil {
+		wp.send(ProgressUpdate{Status: "timings", Warning: fmt.Sprintf("Failed to record block timings: %v", err)})
+	}
+}
+
+// resolveInputs resolves the inputs of stored blocks and those spending
+// their outputs. Failing to only warns: 'backfill --field prevouts' fills
+// them in.
+func (wp *WorkerPool) resolveInputs(ctx context.Context, blocks []*models.BlockData) {
+	heights := make([]int64, len(blocks))
+	for i, data := range blocks {
+		heights[i] = data.Block.Height
+	}
+	if err := wp.db.ResolveBlockInputs(ctx, heights); err != nil && ctx.Err() == nil {
+		wp.send(ProgressUpdate{Status: "resolve_inputs", Warning: fmt.Sprintf("Failed to resolve the inputs of %d blocks: %v", len(blocks), err)})
+	}
+}
+
+// fail marks height failed, or interrupted if err was caused by ctx being
+// cancelled. With ModeStats the failure is only reported; the height is
+// retried on the next run as it has no row in block_stats.
+func (wp *WorkerPool) fail(ctx context.Context, height int64, err error) {
+	if ctx.Err() != nil {
+		wp.interrupt(height)
+		return
+	}
+	if wp.opts.Mode != ModeStats {
+		wp.db.MarkBlockFailed(height, err.Error())
+	}
+	wp.send(ProgressUpdate{
 		BlockHeight: height,
-		TxCount:     len(transactions),
-		Status:      "completed",
-		DebugMsg:    fmt.Sprintf("Completed block %d with %d transactions", height, len(transactions)),
+		Status:      "failed",
+		Error:       err,
+	})
+}
+
+func (wp *WorkerPool) interrupt(height int64) {
+	if wp.opts.Mode != ModeStats {
+		wp.db.MarkBlockInterrupted(height)
 	}
+	wp.send(ProgressUpdate{
+		BlockHeight: height,
+		Status:      "interrupted",
+		DebugMsg:    fmt.Sprintf("Interrupted block %d", height),
+	})
+}
 
+func (wp *WorkerPool) storeRawBlock(ctx context.Context, height int64, hash string) error {
+	data, err := wp.rpcClient.GetRawBlock(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("failed to get raw block %d: %w", height, err)
+	}
+	raw := &models.RawBlock{Height: height, Hash: hash, SizeBytes: int64(len(data)), Data: data}
+	if wp.opts.RawDir != "" {
+		return db.WriteRawBlockFile(wp.opts.RawDir, raw)
+	}
+	if err := wp.db.InsertRawBlock(ctx, raw); err != nil {
+		return fmt.Errorf("failed to insert raw block %d: %w", height, err)
+	}
 	return nil
 }
 
+// optimize creates the secondary indexes and refreshes the statistics after
+// the bulk load.
+func (wp *WorkerPool) optimize() {
+	wp.send(ProgressUpdate{Status: "optimizing", DebugMsg: "Optimizing database: creating indexes and analyzing tables"})
+	start := time.Now()
+	if err := wp.db.OptimizeForQueries(); err != nil {
+		wp.send(ProgressUpdate{Status: "optimized", Warning: fmt.Sprintf("Failed to optimize database: %v", err)})
+		return
+	}
+	wp.send(ProgressUpdate{
+		Status:   "optimized",
+		DebugMsg: fmt.Sprintf("Optimized database in %s", time.Since(start).Round(time.Millisecond)),
+	})
+}
+
+// send stamps u with the memory in flight and queues it for the consumer.
+func (wp *WorkerPool) send(u ProgressUpdate) {
+	switch u.Status {
+	case "completed":
+		wp.completed.Add(1)
+	case "failed":
+		wp.failed.Add(1)
+	}
+	u.InflightBytes, u.InflightLimit = wp.budget.state()
+	u.DBSize, u.DBSizeProjected = wp.dbSize.state()
+	u.Fetchers = wp.fetchLimit.current()
+	u.HashCacheHits, u.HashCacheMisses = wp.rpcClient.HashCacheStats()
+	wp.progress <- u
+}
+
+// Counts returns the number of blocks completed and failed so far.
+func (wp *WorkerPool) Counts() (completed, failed int64) {
+	return wp.completed.Load(), wp.failed.Load()
+}
+
+// GetProgressChannel returns the channel progress updates are delivered on.
+// Workers never block on it: updates queue up while the consumer is slow.
 func (wp *WorkerPool) GetProgressChannel() <-chan ProgressUpdate {
-	return wp.progress
-}
\ No newline at end of file
+	return wp.updates
+}
@@ -0,0 +1,781 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"scrapbtc/internal/db"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/internal/rpc/rpctest"
+	"scrapbtc/internal/watchlist"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// fakeNode is a JSON-RPC server answering like bitcoind. Methods without a
+// handler fail with "Method not found".
+type fakeNode struct {
+	tip      int64
+	handlers map[string]func(params []json.RawMessage) (any, error)
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		ID     json.RawMessage   `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]any{"id": req.ID, "result": nil, "error": nil}
+	handler, ok := n.handlers[req.Method]
+	switch {
+	case req.Method == "getblockchaininfo":
+		resp["result"] = map[string]any{"chain": "regtest", "blocks": n.tip, "headers": n.tip}
+	case req.Method == "getnetworkinfo":
+		// rpcclient detects the node's version with it
+		resp["result"] = map[string]any{"version": 250000, "subversion": "/Satoshi:25.0.0/"}
+	case !ok:
+		resp["error"] = map[string]any{"code": -32601, "message": "Method not found"}
+	default:
+		result, err := handler(req.Params)
+		if err != nil {
+			resp["error"] = map[string]any{"code": -1, "message": err.Error()}
+		} else {
+			resp["result"] = result
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newTestPool starts node and returns a pool scraping it into a fresh
+// database.
+func newTestPool(t testing.TB, node *fakeNode, numWorkers int, opts Options) (*WorkerPool, *db.DB) {
+	t.Helper()
+	server := httptest.NewServer(node)
+	t.Cleanup(server.Close)
+
+	client, err := rpc.NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	wp := NewWorkerPool(client, database, numWorkers, opts)
+	go func() {
+		for range wp.GetProgressChannel() {
+		}
+	}()
+	return wp, database
+}
+
+// newSourcePool returns a pool scraping source into a fresh database.
+func newSourcePool(t testing.TB, source BlockSource, numWorkers int, opts Options) (*WorkerPool, *db.DB) {
+	t.Helper()
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	wp := NewWorkerPool(source, database, numWorkers, opts)
+	go func() {
+		for range wp.GetProgressChannel() {
+		}
+	}()
+	return wp, database
+}
+
+func testBlockHash(height int64) string {
+	return fmt.Sprintf("%064x", height)
+}
+
+// TestProcessBlockRangeCancel cancels the run while the node is still
+// sending a block. ProcessBlockRange must return right away rather than
+// wait for the request, and the block must be left interrupted.
+func TestProcessBlockRangeCancel(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	stalled := make(chan struct{})
+	node := &fakeNode{tip: 10, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		// The block never finishes downloading
+		"getblock": func([]json.RawMessage) (any, error) {
+			select {
+			case requested <- struct{}{}:
+			default:
+			}
+			<-stalled
+			return nil, errors.New("stalled")
+		},
+	}}
+	wp, database := newTestPool(t, node, 1, Options{})
+	// Registered after the server's cleanup, so the handler returns before
+	// the server waits for it
+	t.Cleanup(func() { close(stalled) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- wp.ProcessBlockRange(ctx, 5, 5)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the block was never requested")
+	}
+	cancel()
+	cancelled := time.Now()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ProcessBlockRange() = %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(cancelled); elapsed > time.Second {
+			t.Errorf("ProcessBlockRange returned %v after the cancellation", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessBlockRange didn't return after the cancellation")
+	}
+
+	summary, err := database.GetStatusSummary(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Counts["interrupted"] != 1 || summary.Total != 1 {
+		t.Errorf("status counts = %v, want one interrupted block", summary.Counts)
+	}
+}
+
+// benchTxsPerBlock is the number of transactions in the blocks of
+// BenchmarkProcessBlockRange, each but the coinbase spending an output of
+// the block before.
+const benchTxsPerBlock = 50
+
+// benchBlock returns the verbose JSON of a synthetic block at height.
+func benchBlock(height int64) json.RawMessage {
+	txid := func(height int64, i int) string { return fmt.Sprintf("%056x%08x", height, i) }
+	output := func(n int, value float64) map[string]any {
+		return map[string]any{"value": value, "n": n, "scriptPubKey": map[string]any{
+			"hex": fmt.Sprintf("0014%040x", n), "address": fmt.Sprintf("bc1qbench%d", n), "type": "witness_v0_keyhash",
+		}}
+	}
+
+	txs := []map[string]any{{
+		"txid": txid(height, 0), "hash": txid(height, 0), "version": 2, "size": 200, "vsize": 173, "weight": 692,
+		"vin":  []any{map[string]any{"coinbase": "03", "sequence": 4294967295}},
+		"vout": []any{output(0, 3.125)},
+	}}
+	for i := 1; i < benchTxsPerBlock; i++ {
+		txs = append(txs, map[string]any{
+			"txid": txid(height, i), "hash": txid(height, i), "version": 2, "size": 222, "vsize": 141, "weight": 561,
+			"vin": []any{map[string]any{
+				"txid": txid(height-1, i), "vout": 0, "sequence": 4294967293,
+				"prevout": map[string]any{"generated": false, "height": height - 1, "value": 0.01},
+			}},
+			"vout": []any{output(0, 0.006), output(1, 0.0039)},
+			"fee":  0.0001,
+		})
+	}
+	block, err := json.Marshal(map[string]any{
+		"hash": testBlockHash(height), "height": height, "version": 2, "merkleroot": txid(height, 0),
+		"time": 1700000000 + height*600, "mediantime": 1700000000 + height*600, "nonce": 1, "bits": "17034219",
+		"difficulty": 1e14, "nTx": len(txs), "previousblockhash": testBlockHash(height - 1),
+		"strippedsize": 10000, "size": 12000, "weight": 42000, "tx": txs,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// BenchmarkProcessBlockRange scrapes 1000 blocks from a node answering
+// getblock after benchLatency, with different numbers of fetchers and
+// parsers. A run takes minutes, so run it once:
+//
+//	go test -run '^$' -bench ProcessBlockRange -benchtime 1x ./internal/processor
+func BenchmarkProcessBlockRange(b *testing.B) {
+	const blocks = 1000
+	const benchLatency = 20 * time.Millisecond
+	byHash := make(map[string]json.RawMessage, blocks)
+	for height := int64(1); height <= blocks; height++ {
+		byHash[testBlockHash(height)] = benchBlock(height)
+	}
+	node := &fakeNode{tip: blocks + 100, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			time.Sleep(benchLatency)
+			return byHash[hash], nil
+		},
+	}}
+
+	for _, bc := range []struct{ fetchers, parsers int }{{1, 1}, {4, 1}, {8, 4}} {
+		b.Run(fmt.Sprintf("fetchers=%d/parsers=%d", bc.fetchers, bc.parsers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				wp, database := newTestPool(b, node, bc.fetchers, Options{Parsers: bc.parsers})
+				b.StartTimer()
+				if err := wp.ProcessBlockRange(context.Background(), 1, blocks); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				completed, failed, err := database.GetStatusCounts(1, blocks)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if completed != blocks || failed != 0 {
+					b.Fatalf("%d blocks completed and %d failed, want %d completed", completed, failed, blocks)
+				}
+				database.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// valueBlock returns the verbose JSON of a block whose coinbase pays each
+// of values, written as the node would print them, to its own address.
+func valueBlock(height int64, values ...string) json.RawMessage {
+	var outputs []any
+	for n, value := range values {
+		outputs = append(outputs, map[string]any{"value": json.RawMessage(value), "n": n, "scriptPubKey": map[string]any{
+			"hex": fmt.Sprintf("0014%040x", n), "address": fmt.Sprintf("bc1qvalue%d_%d", height, n), "type": "witness_v0_keyhash",
+		}})
+	}
+	txid := fmt.Sprintf("%064x", height)
+	block, err := json.Marshal(map[string]any{
+		"hash": testBlockHash(height), "height": height, "time": 1700000000 + height*600, "bits": "17034219",
+		"previousblockhash": testBlockHash(height - 1), "size": 300, "weight": 1200,
+		"tx": []any{map[string]any{
+			"txid": txid, "version": 2, "size": 200, "vsize": 173, "weight": 692,
+			"vin":  []any{map[string]any{"coinbase": "03", "sequence": 4294967295}},
+			"vout": outputs,
+		}},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// TestProcessBlockRangeValues stores amounts that a float64 conversion
+// rounds to the satoshi below exactly, and fails the blocks with negative
+// or impossible amounts instead of storing them.
+func TestProcessBlockRangeValues(t *testing.T) {
+	blocks := map[string]json.RawMessage{
+		testBlockHash(1): valueBlock(1, "0.00000001", "0.29"),
+		testBlockHash(2): valueBlock(2, "-0.5"),
+		testBlockHash(3): valueBlock(3, "21000000.00000001"),
+		testBlockHash(4): valueBlock(4, "20000000", "20000000"),
+		testBlockHash(5): valueBlock(5, "1e-8"),
+		testBlockHash(6): valueBlock(6, "20999999.9769"),
+	}
+	node := &fakeNode{tip: 6, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			return blocks[hash], nil
+		},
+	}}
+	wp, database := newTestPool(t, node, 1, Options{})
+	if err := wp.ProcessBlockRange(context.Background(), 1, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	for address, want := range map[string]int64{
+		"bc1qvalue1_0": 1,
+		"bc1qvalue1_1": 29000000,
+		"bc1qvalue6_0": 2099999997690000,
+	} {
+		outputs, err := database.GetUnspentOutputs(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(outputs) != 1 || outputs[0].Value != want {
+			t.Errorf("%s: got %v, want one output of %d satoshis", address, outputs, want)
+		}
+	}
+
+	failed, err := database.GetFailedBlocks(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]string{
+		2: "negative amount",
+		3: "exceeds the 21 million BTC supply",
+		4: "output value of transaction",
+		5: "invalid amount",
+	}
+	if len(failed) != len(want) {
+		t.Fatalf("got %d failed blocks, want %d", len(failed), len(want))
+	}
+	for _, b := range failed {
+		if !strings.Contains(b.Error, want[b.Height]) {
+			t.Errorf("block %d failed with %q, want it to mention %q", b.Height, b.Error, want[b.Height])
+		}
+	}
+}
+
+// TestProcessBlockRangeTimings records the timings of every stored block.
+// The node takes longer to send block 2, which must come out slowest.
+func TestProcessBlockRangeTimings(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	node := &fakeNode{tip: 3, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			if height == 2 {
+				time.Sleep(delay)
+			}
+			return valueBlock(height, "1"), nil
+		},
+	}}
+	wp, database := newTestPool(t, node, 1, Options{})
+	if err := wp.ProcessBlockRange(context.Background(), 1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := database.GetSlowestBlocks(10, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("got timings of %d blocks, want 3", len(blocks))
+	}
+	if b := blocks[0]; b.Height != 2 || b.RPCFetchMs < delay.Milliseconds() || b.Size != 300 || b.TxCount != 1 {
+		t.Errorf("slowest block %+v, want block 2 of 300 bytes fetched in at least %v", b, delay)
+	}
+	for _, b := range blocks {
+		if b.TotalMs < b.RPCFetchMs+b.ParseMs+b.DBInsertMs {
+			t.Errorf("block %d took %d ms in total, less than its steps", b.Height, b.TotalMs)
+		}
+	}
+}
+
+// recordingSink records the blocks and transactions it gets and fails the
+// blocks in failHeights.
+type recordingSink struct {
+	failHeights map[int64]bool
+	blocks      []int64
+	txs         int
+	flushes     int
+}
+
+func (s *recordingSink) WriteBlock(block *models.Block) error {
+	if s.failHeights[block.Height] {
+		return fmt.Errorf("disk full")
+	}
+	s.blocks = append(s.blocks, block.Height)
+	return nil
+}
+
+func (s *recordingSink) WriteTransactions(txs []*models.Transaction) error {
+	s.txs += len(txs)
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.flushes++
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+// TestProcessBlockRangeSink stores blocks with a sink that fails one of
+// them. The sink gets the other blocks with their transactions, and the
+// failed one is still completed.
+func TestProcessBlockRangeSink(t *testing.T) {
+	node := &fakeNode{tip: 3, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func(params []json.RawMessage) (any, error) {
+			var height int64
+			if err := json.Unmarshal(params[0], &height); err != nil {
+				return nil, err
+			}
+			return testBlockHash(height), nil
+		},
+		"getblock": func(params []json.RawMessage) (any, error) {
+			var hash string
+			if err := json.Unmarshal(params[0], &hash); err != nil {
+				return nil, err
+			}
+			height, err := strconv.ParseInt(hash, 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			return valueBlock(height, "3.125"), nil
+		},
+	}}
+	s := &recordingSink{failHeights: map[int64]bool{2: true}}
+	wp, database := newTestPool(t, node, 2, Options{Sink: s, FlushRows: 1})
+	if err := wp.ProcessBlockRange(context.Background(), 1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(s.blocks)
+	if !slices.Equal(s.blocks, []int64{1, 3}) || s.txs != 2 || s.flushes == 0 {
+		t.Errorf("sink got blocks %v with %d transactions and %d flushes, want 1 and 3 with 2", s.blocks, s.txs, s.flushes)
+	}
+	processed, err := database.GetProcessedBlocks(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 3 {
+		t.Errorf("completed blocks = %v, want 1 to 3 despite the sink failure", processed)
+	}
+}
+
+// fakePrices is a price source whose first Latest and History calls fail.
+type fakePrices struct {
+	mu              sync.Mutex
+	latest, history int
+	yesterday       time.Time
+}
+
+func (p *fakePrices) Name() string { return "fake" }
+
+func (p *fakePrices) Latest(ctx context.Context) (*models.PriceData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latest++
+	if p.latest == 1 {
+		return nil, errors.New("rate limited")
+	}
+	now := time.Now().UTC()
+	return &models.PriceData{Timestamp: now, Price: 100, Source: "fake", FetchedAt: now}, nil
+}
+
+func (p *fakePrices) History(ctx context.Context, from, to time.Time) ([]*models.PriceData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.history++
+	if p.history == 1 {
+		return nil, errors.New("rate limited")
+	}
+	if !from.Equal(p.yesterday) || !to.Equal(p.yesterday.AddDate(0, 0, 1)) {
+		return nil, fmt.Errorf("history of %s to %s, want yesterday", from, to)
+	}
+	return []*models.PriceData{
+		{Timestamp: from, Price: 90, Source: "fake", FetchedAt: from},
+		{Timestamp: from.Add(12 * time.Hour), Price: 95, Source: "fake", FetchedAt: from},
+	}, nil
+}
+
+// TestFollowPrices follows an empty chain with a price source that fails
+// once: the failures must be retried without ending the run, and yesterday's
+// estimate replaced by its history.
+func TestFollowPrices(t *testing.T) {
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	source := &fakePrices{yesterday: yesterday}
+	wp, database := newTestPool(t, &fakeNode{}, 1, Options{PollInterval: time.Hour, PriceSource: source, PriceInterval: 10 * time.Millisecond})
+	estimate := yesterday.Add(6 * time.Hour)
+	if err := database.InsertPriceData(&models.PriceData{Timestamp: estimate, Price: 80, Source: "fake", FetchedAt: estimate}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- wp.ProcessFollow(ctx, 1, 0)
+	}()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		source.mu.Lock()
+		done := source.latest >= 3 && source.history >= 2
+		source.mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("prices not retried")
+		}
+	}
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ProcessFollow() = %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ProcessFollow() didn't return after cancel")
+	}
+
+	prices, err := database.GetPriceData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settled []float64
+	var latest int
+	for _, p := range prices {
+		if p.Timestamp.Before(yesterday.AddDate(0, 0, 1)) {
+			settled = append(settled, p.Price)
+		} else {
+			latest++
+		}
+	}
+	if !slices.Equal(settled, []float64{90, 95}) || latest < 1 {
+		t.Errorf("yesterday's prices %v and %d latest, want the history 90 and 95 and the latest", settled, latest)
+	}
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.history != 2 {
+		t.Errorf("history fetched %d times, want once more after the failure", source.history)
+	}
+}
+
+var _ BlockSource = (*rpctest.Chain)(nil)
+
+// TestProcessSyntheticChain scrapes a synthetic chain without a node: every
+// block must be stored with its fees, and the outputs left unspent must add
+// up to the subsidies. A failing block is retried by the next run.
+func TestProcessSyntheticChain(t *testing.T) {
+	const blocks = 40
+	chain := rpctest.Synthetic(blocks)
+	chain.Fail(17, errors.New("injected"))
+	wp, database := newSourcePool(t, chain, 4, Options{FlushRows: 10})
+	if err := wp.ProcessBlockRange(context.Background(), 0, blocks-1); err != nil {
+		t.Fatal(err)
+	}
+	if completed, failed := wp.Counts(); completed != blocks-1 || failed != 1 {
+		t.Fatalf("completed %d and failed %d blocks, want %d and 1", completed, failed, blocks-1)
+	}
+
+	chain.Fail(17, nil)
+	wp = NewWorkerPool(chain, database, 2, Options{})
+	go func() {
+		for range wp.GetProgressChannel() {
+		}
+	}()
+	if err := wp.ProcessBlockRange(context.Background(), 0, blocks-1); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := database.GetBlocksByTime(time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != blocks {
+		t.Fatalf("stored %d blocks, want %d", len(stored), blocks)
+	}
+	var subsidies int64
+	for _, b := range stored {
+		subsidies += models.SubsidyForHeight(b.Height)
+		if b.TotalFees != rpctest.SyntheticFee(b.Height) || b.TxCount != min(int(b.Height)+1, 2) {
+			t.Errorf("block %d has %d transactions paying %d, want %d", b.Height, b.TxCount, b.TotalFees, rpctest.SyntheticFee(b.Height))
+		}
+	}
+	utxo, err := database.GetUTXOSetSize(blocks - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utxo.Count != 1+2*(blocks-1) || utxo.Value != subsidies {
+		t.Errorf("UTXO set of %d outputs worth %d, want %d worth the subsidies %d", utxo.Count, utxo.Value, 1+2*(blocks-1), subsidies)
+	}
+
+	// Stats mode derives the same fees from getblockstats
+	statsPool, statsDB := newSourcePool(t, chain, 2, Options{Mode: ModeStats})
+	if err := statsPool.ProcessBlockRange(context.Background(), 0, blocks-1); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := statsDB.CountBlockStats(0, blocks-1); err != nil || n != blocks {
+		t.Errorf("CountBlockStats() = %d, %v, want %d", n, err, blocks)
+	}
+}
+
+// claimingStore is a database shared with another instance that holds the
+// claims of the heights in claimed.
+type claimingStore struct {
+	*db.DB
+	claimed map[int64]bool
+}
+
+func (s *claimingStore) MarkBlockProcessing(ctx context.Context, height int64, hash string) error {
+	if s.claimed[height] {
+		return fmt.Errorf("block %d: %w", height, db.ErrBlockClaimed)
+	}
+	return s.DB.MarkBlockProcessing(ctx, height, hash)
+}
+
+// TestProcessClaimedBlocks skips the blocks another instance claimed,
+// neither storing them nor marking them failed.
+func TestProcessClaimedBlocks(t *testing.T) {
+	const blocks = 10
+	_, database := newSourcePool(t, rpctest.Synthetic(blocks), 1, Options{})
+	store := &claimingStore{DB: database, claimed: map[int64]bool{3: true, 7: true}}
+	wp := NewWorkerPool(rpctest.Synthetic(blocks), store, 2, Options{})
+	go func() {
+		for range wp.GetProgressChannel() {
+		}
+	}()
+	if err := wp.ProcessBlockRange(context.Background(), 0, blocks-1); err != nil {
+		t.Fatal(err)
+	}
+	if completed, failed := wp.Counts(); completed != blocks-2 || failed != 0 {
+		t.Errorf("completed %d and failed %d blocks, want %d and 0", completed, failed, blocks-2)
+	}
+	summary, err := database.GetStatusSummary(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != blocks-2 || len(summary.Gaps) != 2 {
+		t.Errorf("status %+v, want the claimed blocks 3 and 7 left out", summary)
+	}
+}
+
+// TestProcessWatchlist scrapes a synthetic chain with the minimal profile
+// and a watchlist: the coinbases paying the miner, their spends and a
+// payment are stored although no output is.
+func TestProcessWatchlist(t *testing.T) {
+	const blocks = 6
+	watch := watchlist.New([]string{"bcrt1qminer", "bcrt1qpayment3"})
+	wp, database := newSourcePool(t, rpctest.Synthetic(blocks), 2, Options{Profile: models.ProfileMinimal, Watchlist: watch})
+	if err := wp.ProcessBlockRange(context.Background(), 0, blocks-1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := database.GetWatchlistByDay(rpctest.SyntheticStart, rpctest.SyntheticStart.AddDate(0, 0, 1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mined, spent int64
+	for height := range int64(blocks) {
+		mined += models.SubsidyForHeight(height) + rpctest.SyntheticFee(height)
+		if height < blocks-1 {
+			spent += models.SubsidyForHeight(height) + rpctest.SyntheticFee(height)
+		}
+	}
+	if len(stats) != 2 {
+		t.Fatalf("activity of %d addresses, want 2", len(stats))
+	}
+	if m := stats[0]; m.Address != "bcrt1qminer" || m.Inflows != blocks || m.Received != mined || m.Outflows != blocks-1 || m.Sent != spent {
+		t.Errorf("miner activity %+v, want %d inflows of %d and %d outflows of %d", m, blocks, mined, blocks-1, spent)
+	}
+	if p := stats[1]; p.Address != "bcrt1qpayment3" || p.Inflows != 1 || p.Outflows != 0 {
+		t.Errorf("payment activity %+v, want one inflow", p)
+	}
+	if utxo, err := database.GetUTXOSetSize(blocks - 1); err != nil || utxo.Count != 0 {
+		t.Errorf("%+v, %v: outputs stored with the minimal profile", utxo, err)
+	}
+}
+
+// TestProcessGenesis scrapes height 0 from the mainnet genesis block, whose
+// coinbase output is unspendable, and checks what verify checks.
+func TestProcessGenesis(t *testing.T) {
+	verbose, err := os.ReadFile("../rpc/testdata/genesis_verbose.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	var raw bytes.Buffer
+	if err := genesis.Serialize(&raw); err != nil {
+		t.Fatal(err)
+	}
+	hash := genesis.BlockHash().String()
+
+	node := &fakeNode{tip: 0, handlers: map[string]func([]json.RawMessage) (any, error){
+		"getblockhash": func([]json.RawMessage) (any, error) { return hash, nil },
+		"getblock": func(params []json.RawMessage) (any, error) {
+			if string(params[1]) == "0" {
+				return hex.EncodeToString(raw.Bytes()), nil
+			}
+			return json.RawMessage(verbose), nil
+		},
+	}}
+	wp, database := newTestPool(t, node, 1, Options{ValidateChain: true, StoreRawBlocks: true})
+	if err := wp.ProcessBlockRange(context.Background(), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if completed, failed := wp.Counts(); completed != 1 || failed != 0 {
+		t.Fatalf("%d blocks completed and %d failed, want the genesis block completed", completed, failed)
+	}
+
+	blocks, err := database.GetBlocksByTime(time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Hash != hash || blocks[0].CoinbaseValue != blocks[0].Subsidy+blocks[0].TotalFees {
+		t.Fatalf("stored blocks %+v, want the genesis block claiming its subsidy", blocks)
+	}
+	counts, err := database.GetStoredTxCounts(time.Time{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[hash] != blocks[0].TxCount {
+		t.Errorf("%d transactions stored of %d", counts[hash], blocks[0].TxCount)
+	}
+	stored, err := database.GetRawBlock(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := chainhash.DoubleHashH(stored.Data[:80]).String(); header != hash || len(stored.Data) != int(blocks[0].Size) {
+		t.Errorf("raw block of %d bytes hashes to %s, want %d bytes hashing to %s", len(stored.Data), header, blocks[0].Size, hash)
+	}
+
+	// Core never added the output to the UTXO set
+	if size, err := database.GetUTXOSetSize(0); err != nil || size.Count != 0 {
+		t.Errorf("GetUTXOSetSize(0) = %+v, %v, want an empty UTXO set", size, err)
+	}
+}
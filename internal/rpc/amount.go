@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// amountDecimals is the number of decimals of a BTC amount, down to a
+// satoshi.
+const amountDecimals = 8
+
+// ParseAmount converts a BTC amount as printed by the node, such as
+// 0.00000001 or 20999999.9769, to satoshis. It works on the decimal digits,
+// since going through a float64 rounds amounts like these to the satoshi
+// below. Amounts with exponents or with digits below a satoshi are
+// rejected; negative ones are returned for the caller to reject.
+func ParseAmount(n json.Number) (int64, error) {
+	s := string(n)
+	digits := strings.TrimPrefix(s, "-")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" || strings.ContainsAny(digits, "eE+") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > amountDecimals {
+		if strings.Trim(frac[amountDecimals:], "0") != "" {
+			return 0, fmt.Errorf("invalid amount %q: more precise than a satoshi", s)
+		}
+		frac = frac[:amountDecimals]
+	}
+	frac += strings.Repeat("0", amountDecimals-len(frac))
+
+	sats, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || sats < 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if digits != s {
+		sats = -sats
+	}
+	return sats, nil
+}
@@ -0,0 +1,39 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount string
+		want   int64
+	}{
+		{"0", 0},
+		{"0.00000001", 1},
+		{"20999999.9769", 2099999997690000},
+		{"21000000.00000000", 2100000000000000},
+		// 0.29 * 1e8 is 28999999.999999996 as a float64
+		{"0.29", 29000000},
+		{"0.00000003", 3},
+		{"1.10000000", 110000000},
+		{"3.125", 312500000},
+		{"50", 5000000000},
+		{"1.000000000", 100000000},
+		{"-0.5", -50000000},
+	} {
+		got, err := ParseAmount(json.Number(tc.amount))
+		if err != nil {
+			t.Errorf("ParseAmount(%s): %v", tc.amount, err)
+		} else if got != tc.want {
+			t.Errorf("ParseAmount(%s) = %d, want %d", tc.amount, got, tc.want)
+		}
+	}
+
+	for _, amount := range []string{"", ".5", "1e-8", "1E8", "+1", "--1", "0.000000001", "1.2.3", "abc", "99999999999999999999"} {
+		if got, err := ParseAmount(json.Number(amount)); err == nil {
+			t.Errorf("ParseAmount(%q) = %d, want an error", amount, got)
+		}
+	}
+}
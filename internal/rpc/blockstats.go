@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strconv"
+)
+
+// GetBlockStats fetches the getblockstats aggregates of the block at height
+// and returns the JSON as is, so that it can be parsed with ParseBlockStats
+// elsewhere. The node computes them from the block and its undo data, which
+// is much cheaper than returning every transaction.
+func (c *Client) GetBlockStats(ctx context.Context, height int64) (json.RawMessage, error) {
+	params := []json.RawMessage{json.RawMessage(strconv.FormatInt(height, 10))}
+	var result json.RawMessage
+	err := c.doRaw(ctx, height, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getblockstats", params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats of block %d: %w", height, err)
+	}
+	return result, nil
+}
+
+// ParseBlockStats parses the result of getblockstats. Amounts are reported
+// in satoshis and fee rates in sat/vB already.
+func ParseBlockStats(result json.RawMessage) (*models.BlockStats, error) {
+	var raw struct {
+		BlockHash          string   `json:"blockhash"`
+		Height             int64    `json:"height"`
+		Time               int64    `json:"time"`
+		MedianTime         int64    `json:"mediantime"`
+		Txs                int64    `json:"txs"`
+		Ins                int64    `json:"ins"`
+		Outs               int64    `json:"outs"`
+		TotalSize          int64    `json:"total_size"`
+		TotalWeight        int64    `json:"total_weight"`
+		TotalFee           int64    `json:"totalfee"`
+		Subsidy            int64    `json:"subsidy"`
+		TotalOut           int64    `json:"total_out"`
+		AvgFee             int64    `json:"avgfee"`
+		MinFee             int64    `json:"minfee"`
+		MaxFee             int64    `json:"maxfee"`
+		MedianFee          int64    `json:"medianfee"`
+		AvgFeeRate         int64    `json:"avgfeerate"`
+		MinFeeRate         int64    `json:"minfeerate"`
+		MaxFeeRate         int64    `json:"maxfeerate"`
+		FeeRatePercentiles [5]int64 `json:"feerate_percentiles"`
+		SwTxs              int64    `json:"swtxs"`
+		SwTotalSize        int64    `json:"swtotal_size"`
+		UTXOIncrease       int64    `json:"utxo_increase"`
+		UTXOSizeInc        int64    `json:"utxo_size_inc"`
+	}
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block stats: %w", err)
+	}
+
+	return &models.BlockStats{
+		Height:             raw.Height,
+		BlockHash:          raw.BlockHash,
+		Timestamp:          models.UnixTime(raw.Time),
+		MedianTime:         models.UnixTime(raw.MedianTime),
+		TxCount:            raw.Txs,
+		Inputs:             raw.Ins,
+		Outputs:            raw.Outs,
+		TotalSize:          raw.TotalSize,
+		TotalWeight:        raw.TotalWeight,
+		TotalFee:           raw.TotalFee,
+		Subsidy:            raw.Subsidy,
+		TotalOut:           raw.TotalOut,
+		AvgFee:             raw.AvgFee,
+		MinFee:             raw.MinFee,
+		MaxFee:             raw.MaxFee,
+		MedianFee:          raw.MedianFee,
+		AvgFeeRate:         raw.AvgFeeRate,
+		MinFeeRate:         raw.MinFeeRate,
+		MaxFeeRate:         raw.MaxFeeRate,
+		FeeRatePercentiles: raw.FeeRatePercentiles,
+		SegwitTxCount:      raw.SwTxs,
+		SegwitTotalSize:    raw.SwTotalSize,
+		UTXOIncrease:       raw.UTXOIncrease,
+		UTXOSizeIncrease:   raw.UTXOSizeInc,
+		ProcessedAt:        models.Now(),
+	}, nil
+}
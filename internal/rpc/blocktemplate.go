@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// blockTemplateRequest asks getblocktemplate for a template following the
+// segwit rules, which Bitcoin Core requires.
+var blockTemplateRequest = json.RawMessage(`{"rules": ["segwit"]}`)
+
+// GetBlockTemplate asks a node for the block it would mine next with
+// getblocktemplate and summarizes it.
+func (c *Client) GetBlockTemplate(ctx context.Context) (*models.NextBlockEstimate, error) {
+	estimatedAt := models.Now()
+	var result json.RawMessage
+	err := c.doRaw(ctx, 0, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getblocktemplate", []json.RawMessage{blockTemplateRequest})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block template: %w", err)
+	}
+	estimate, err := parseBlockTemplate(result)
+	if err != nil {
+		return nil, err
+	}
+	estimate.EstimatedAt = estimatedAt
+	return estimate, nil
+}
+
+// parseBlockTemplate sums the fees and weight of the transactions of a
+// getblocktemplate result and finds the lowest fee rate among them.
+func parseBlockTemplate(result json.RawMessage) (*models.NextBlockEstimate, error) {
+	var raw struct {
+		Height       int64 `json:"height"`
+		Transactions []struct {
+			Fee    int64 `json:"fee"`
+			Weight int64 `json:"weight"`
+		} `json:"transactions"`
+	}
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal getblocktemplate: %w", err)
+	}
+
+	estimate := &models.NextBlockEstimate{Height: raw.Height, TxCount: int64(len(raw.Transactions))}
+	for i, tx := range raw.Transactions {
+		estimate.TotalFees += tx.Fee
+		estimate.Weight += tx.Weight
+		vsize := (tx.Weight + 3) / 4
+		if vsize == 0 {
+			return nil, fmt.Errorf("getblocktemplate transaction %d has no weight", i)
+		}
+		if rate := float64(tx.Fee) / float64(vsize); i == 0 || rate < estimate.MinFeeRate {
+			estimate.MinFeeRate = rate
+		}
+	}
+	return estimate, nil
+}
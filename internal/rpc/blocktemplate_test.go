@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGetBlockTemplate summarizes a template of three transactions, the
+// cheapest paying 2 sat/vB, and checks the segwit rule is requested.
+func TestGetBlockTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params []struct {
+				Rules []string `json:"rules"`
+			} `json:"params"`
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result any
+		switch req.Method {
+		case "getblockchaininfo":
+			result = map[string]any{"chain": "regtest", "blocks": 840000, "headers": 840000}
+		case "getblocktemplate":
+			if len(req.Params) != 1 || len(req.Params[0].Rules) != 1 || req.Params[0].Rules[0] != "segwit" {
+				json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": nil,
+					"error": map[string]any{"code": -8, "message": "getblocktemplate must be called with the segwit rule set"}})
+				return
+			}
+			result = map[string]any{"height": 840001, "coinbasevalue": 312600000, "transactions": []map[string]any{
+				{"fee": 5000, "weight": 800},
+				{"fee": 562, "weight": 1121},
+				{"fee": 40000, "weight": 4000},
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result, "error": nil})
+	}))
+	defer server.Close()
+
+	client, err := NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	e, err := client.GetBlockTemplate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second transaction is 281 vB
+	if e.EstimatedAt.IsZero() || e.Height != 840001 || e.TxCount != 3 || e.Weight != 5921 || e.TotalFees != 45562 || e.MinFeeRate != 2 {
+		t.Errorf("GetBlockTemplate() = %+v", e)
+	}
+
+	empty, err := parseBlockTemplate(json.RawMessage(`{"height": 5, "transactions": []}`))
+	if err != nil || empty.TxCount != 0 || empty.MinFeeRate != 0 {
+		t.Errorf("empty template = %+v, %v", empty, err)
+	}
+}
@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// hashCacheSafeDepth is how far below the tip a block must be before its
+// hash is cached. Hashes closer to the tip can still change in a reorg, so
+// they are always fetched from the node.
+const hashCacheSafeDepth = 10
+
+// hashCache is an LRU cache of block hashes by height and of verbose block
+// headers by hash. Both share the same capacity.
+type hashCache struct {
+	mu       sync.Mutex
+	size     int
+	order    *list.List
+	byHeight map[int64]*list.Element
+	byHash   map[string]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+// hashCacheEntry is the hash at a height, or the header of a hash if header
+// is set.
+type hashCacheEntry struct {
+	height int64
+	hash   string
+	header json.RawMessage
+}
+
+// newHashCache returns a cache holding up to size hashes. A size of zero or
+// less disables caching.
+func newHashCache(size int) *hashCache {
+	return &hashCache{
+		size:     size,
+		order:    list.New(),
+		byHeight: make(map[int64]*list.Element),
+		byHash:   make(map[string]*list.Element),
+	}
+}
+
+func (c *hashCache) get(height int64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byHeight[height]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*hashCacheEntry).hash, true
+}
+
+func (c *hashCache) add(height int64, hash string) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.byHeight[height]; ok {
+		el.Value.(*hashCacheEntry).hash = hash
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byHeight[height] = c.order.PushFront(&hashCacheEntry{height: height, hash: hash})
+	c.evict()
+}
+
+// getHeader returns the header of the block hash.
+func (c *hashCache) getHeader(hash string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byHash[hash]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*hashCacheEntry).header, true
+}
+
+func (c *hashCache) addHeader(hash string, header json.RawMessage) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.byHash[hash]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byHash[hash] = c.order.PushFront(&hashCacheEntry{hash: hash, header: header})
+	c.evict()
+}
+
+// evict drops the least recently used entries over the size of the cache.
+func (c *hashCache) evict() {
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		if e := oldest.Value.(*hashCacheEntry); e.header != nil {
+			delete(c.byHash, e.hash)
+		} else {
+			delete(c.byHeight, e.height)
+		}
+	}
+}
+
+// invalidateFrom drops the hashes at height and above. Headers are kept:
+// the header of a hash never changes, even once its block is orphaned.
+func (c *hashCache) invalidateFrom(height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for h, el := range c.byHeight {
+		if h >= height {
+			c.order.Remove(el)
+			delete(c.byHeight, h)
+		}
+	}
+}
+
+func (c *hashCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *hashCache) state() string {
+	hits, misses := c.stats()
+	return fmt.Sprintf("hash cache %d hits, %d misses", hits, misses)
+}
+
+// maxRoutedHeights is how many heights of hashes a Client remembers to
+// route block fetches, far more than are ever fetched at once.
+const maxRoutedHeights = 10000
+
+// heightLRU is an LRU map of block hashes to their heights. The least
+// recently used hashes are dropped past its size, so hashes that are looked
+// up but never fetched, or only fetched in ways that keep them, don't pile up.
+type heightLRU struct {
+	mu     sync.Mutex
+	size   int
+	order  *list.List
+	byHash map[string]*list.Element
+}
+
+type heightLRUEntry struct {
+	hash   string
+	height int64
+}
+
+func newHeightLRU(size int) *heightLRU {
+	return &heightLRU{size: size, order: list.New(), byHash: make(map[string]*list.Element)}
+}
+
+func (c *heightLRU) add(hash string, height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.byHash[hash]; ok {
+		el.Value.(*heightLRUEntry).height = height
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byHash[hash] = c.order.PushFront(&heightLRUEntry{hash: hash, height: height})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byHash, oldest.Value.(*heightLRUEntry).hash)
+	}
+}
+
+// get returns the height of hash, or 0 if it isn't known.
+func (c *heightLRU) get(hash string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byHash[hash]
+	if !ok {
+		return 0
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*heightLRUEntry).height
+}
+
+// take returns the height of hash, or 0, and forgets it.
+func (c *heightLRU) take(hash string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.byHash[hash]
+	if !ok {
+		return 0
+	}
+	c.order.Remove(el)
+	delete(c.byHash, hash)
+	return el.Value.(*heightLRUEntry).height
+}
+
+func (c *heightLRU) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
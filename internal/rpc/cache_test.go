@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHashCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newHashCache(3)
+	c.add(1, "a")
+	c.addHeader("a", json.RawMessage(`{"height":1}`))
+	c.add(2, "b")
+
+	// Using height 1 makes the header of a the oldest entry
+	if _, ok := c.get(1); !ok {
+		t.Fatal("height 1 isn't cached")
+	}
+	c.add(3, "c")
+	if _, ok := c.getHeader("a"); ok {
+		t.Error("the least recently used header wasn't evicted")
+	}
+	for _, height := range []int64{1, 2, 3} {
+		if _, ok := c.get(height); !ok {
+			t.Errorf("height %d was evicted", height)
+		}
+	}
+	if hits, misses := c.stats(); hits != 4 || misses != 1 {
+		t.Errorf("stats = %d hits, %d misses, want 4 and 1", hits, misses)
+	}
+}
+
+func TestHashCacheInvalidateFrom(t *testing.T) {
+	c := newHashCache(10)
+	for height, hash := range map[int64]string{1: "a", 2: "b", 3: "c"} {
+		c.add(height, hash)
+		c.addHeader(hash, json.RawMessage(`{}`))
+	}
+
+	c.invalidateFrom(2)
+	for height, cached := range map[int64]bool{1: true, 2: false, 3: false} {
+		if _, ok := c.get(height); ok != cached {
+			t.Errorf("height %d cached = %v, want %v", height, ok, cached)
+		}
+	}
+	// Headers of orphaned blocks stay valid
+	for _, hash := range []string{"a", "b", "c"} {
+		if _, ok := c.getHeader(hash); !ok {
+			t.Errorf("header of %s was dropped", hash)
+		}
+	}
+}
+
+func TestHashCacheDisabled(t *testing.T) {
+	c := newHashCache(0)
+	c.add(1, "a")
+	c.addHeader("a", json.RawMessage(`{}`))
+	if _, ok := c.get(1); ok {
+		t.Error("a disabled cache returned a hash")
+	}
+	if _, ok := c.getHeader("a"); ok {
+		t.Error("a disabled cache returned a header")
+	}
+}
+
+func TestHeightLRUBounded(t *testing.T) {
+	c := newHeightLRU(2)
+	c.add("a", 1)
+	c.add("b", 2)
+	// Looking up a makes b the oldest entry
+	if h := c.get("a"); h != 1 {
+		t.Fatalf("get(a) = %d, want 1", h)
+	}
+	c.add("c", 3)
+	if h := c.get("b"); h != 0 {
+		t.Errorf("get(b) = %d after eviction, want 0", h)
+	}
+	if h := c.take("a"); h != 1 || c.get("a") != 0 {
+		t.Errorf("take(a) = %d, then get(a) = %d, want 1 then 0", h, c.get("a"))
+	}
+	if n := c.len(); n != 1 {
+		t.Errorf("len = %d, want 1", n)
+	}
+}
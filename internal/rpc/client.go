@@ -1,171 +1,522 @@
 package rpc
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"net/url"
 	"scrapbtc/pkg/models"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/rpcclient"
 )
 
+const (
+	maxBusyRetries   = 5
+	initialBusyDelay = 500 * time.Millisecond
+	maxBusyDelay     = 8 * time.Second
+
+	// rbfSequenceThreshold is the lowest input sequence that doesn't signal
+	// replaceability under BIP125.
+	rbfSequenceThreshold = 0xfffffffe
+)
+
+// Client talks to one or more Bitcoin Core nodes. Requests are distributed
+// round-robin across healthy nodes and fail over to the next node on error.
 type Client struct {
-	client *rpcclient.Client
+	nodes []*node
+	next  uint64
+	stop  chan struct{}
+	chain string
+
+	// heights remembers the height of hashes returned by GetBlockHashByHeight
+	// so the block fetch can be routed to a node that has it.
+	heights *heightLRU
+
+	// cache holds the hashes of blocks deep enough below the tip that they
+	// won't change, and the headers of blocks.
+	cache *hashCache
+	best  atomic.Int64
+
+	latency *latencyTracker
+	health  *health
+
+	// prevouts fetches blocks with verbosity 3, see SetPrevouts.
+	prevouts bool
 }
 
-func NewClient(host, user, pass string) (*Client, error) {
-	connCfg := &rpcclient.ConnConfig{
-		Host:         host,
-		User:         user,
-		Pass:         pass,
-		HTTPPostMode: true,
-		DisableTLS:   true,
+// NewClient connects to every host in hosts. Each node gets its own limiter
+// built from maxConcurrent and ratePerSec; zero values mean unlimited. Up to
+// cacheSize block hashes and headers are cached; zero disables the cache.
+func NewClient(hosts []string, user, pass string, maxConcurrent int, ratePerSec float64, cacheSize int) (*Client, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("at least one RPC host is required")
 	}
 
-	client, err := rpcclient.New(connCfg, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create RPC client: %w", err)
+	c := &Client{stop: make(chan struct{}), heights: newHeightLRU(maxRoutedHeights), cache: newHashCache(cacheSize), latency: &latencyTracker{}, health: newHealth()}
+	for _, host := range hosts {
+		address, useTLS, err := parseEndpoint(host)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		connCfg := &rpcclient.ConnConfig{
+			Host:         address,
+			User:         user,
+			Pass:         pass,
+			HTTPPostMode: true,
+			DisableTLS:   !useTLS,
+		}
+
+		client, err := rpcclient.New(connCfg, nil)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to create RPC client for %s: %w", host, err)
+		}
+
+		n := &node{
+			host:    host,
+			client:  client,
+			limiter: NewLimiter(maxConcurrent, ratePerSec),
+			latency: c.latency,
+			raw:     newRawClient(address, useTLS, user, pass),
+			timeout: DefaultRequestTimeout,
+		}
+		c.nodes = append(c.nodes, n)
+
+		// Test connection by getting blockchain info
+		var info *btcjson.GetBlockChainInfoResult
+		err = n.do(context.Background(), func(client *rpcclient.Client) error {
+			var err error
+			info, err = client.GetBlockChainInfo()
+			return err
+		})
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to connect to Bitcoin RPC at %s: %w", host, err)
+		}
+
+		if c.chain != "" && c.chain != info.Chain {
+			c.Close()
+			return nil, fmt.Errorf("node %s is on chain %s, expected %s", host, info.Chain, c.chain)
+		}
+		c.chain = info.Chain
+		n.setTip(int64(info.Blocks))
+		if tip := int64(info.Blocks); tip > c.best.Load() {
+			c.best.Store(tip)
+		}
+	}
+
+	if len(c.nodes) > 1 {
+		go c.healthCheck()
 	}
 
-	// Test connection by getting blockchain info
-	info, err := client.GetBlockChainInfo()
+	return c, nil
+}
+
+// parseEndpoint splits an RPC host into the address rpcclient appends to its
+// scheme, which may carry a path, and whether it must be reached over TLS.
+// A bare host:port is plain HTTP; a URL such as
+// https://proxy.example.com/bitcoin keeps its path prefix, so that nodes
+// behind a reverse proxy can be reached.
+func parseEndpoint(host string) (address string, useTLS bool, err error) {
+	if !strings.Contains(host, "://") {
+		return host, false, nil
+	}
+	u, err := url.Parse(host)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Bitcoin RPC: %w", err)
+		return "", false, fmt.Errorf("invalid RPC host %q: %w", host, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false, fmt.Errorf("invalid RPC host %q: must be host:port or an http or https URL", host)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", false, fmt.Errorf("invalid RPC host %q: pass credentials with --user and --pass, and no query or fragment", host)
+	}
+	return u.Host + strings.TrimSuffix(u.EscapedPath(), "/"), u.Scheme == "https", nil
+}
+
+// SetRequestTimeout sets how long each attempt of a request may take before
+// it fails with ErrTimeout and moves on to the next node; zero means no
+// limit.
+func (c *Client) SetRequestTimeout(timeout time.Duration) {
+	for _, n := range c.nodes {
+		n.timeout = timeout
+	}
+}
+
+// SetMaxResponseSize sets the size in bytes above which a block, header or
+// other raw response fails with ErrResponseTooLarge; zero means no limit.
+func (c *Client) SetMaxResponseSize(size int64) {
+	for _, n := range c.nodes {
+		n.raw.maxSize = size
+	}
+}
+
+// SetPrevouts makes GetBlockVerbose fetch blocks with verbosity 3, which
+// adds to every input the output it spends, for the watchlist. Nodes before
+// Bitcoin Core 23 answer as with verbosity 2.
+func (c *Client) SetPrevouts(fetch bool) {
+	c.prevouts = fetch
+}
+
+// LimiterState describes the current rate limiter state of every node for
+// progress output.
+func (c *Client) LimiterState() string {
+	var states []string
+	if len(c.nodes) == 1 {
+		states = append(states, c.nodes[0].limiter.State())
+	} else {
+		for _, n := range c.nodes {
+			states = append(states, n.state())
+		}
+	}
+	if c.cache.size > 0 {
+		states = append(states, c.cache.state())
 	}
-	
-	fmt.Printf("Connected to Bitcoin RPC - Chain: %s, Blocks: %d\n", info.Chain, info.Blocks)
-	
-	return &Client{client: client}, nil
+	return strings.Join(states, "; ")
+}
+
+// HashCacheStats returns the number of block hash and header lookups served
+// from the cache and the number that had to be fetched from a node. Hash
+// lookups too close to the tip to be cached aren't counted.
+func (c *Client) HashCacheStats() (hits, misses uint64) {
+	return c.cache.stats()
+}
+
+// InvalidateHashesFrom drops the cached block hashes at height and above.
+// Call it when a reorg replaced blocks from height on.
+func (c *Client) InvalidateHashesFrom(height int64) {
+	c.cache.invalidateFrom(height)
+}
+
+// cacheable reports whether the hash at height is deep enough below the tip
+// to be served from and stored in the cache.
+func (c *Client) cacheable(height int64) bool {
+	return c.cache.size > 0 && height <= c.best.Load()-hashCacheSafeDepth
+}
+
+// Banner describes the nodes the client connected to.
+func (c *Client) Banner() string {
+	if len(c.nodes) == 1 {
+		return fmt.Sprintf("Connected to Bitcoin RPC - Chain: %s, Blocks: %d", c.chain, c.nodes[0].currentTip())
+	}
+	hosts := make([]string, len(c.nodes))
+	for i, n := range c.nodes {
+		hosts[i] = fmt.Sprintf("%s (%d)", n.host, n.currentTip())
+	}
+	return fmt.Sprintf("Connected to %d Bitcoin RPC nodes - Chain: %s, Nodes: %s", len(c.nodes), c.chain, strings.Join(hosts, ", "))
 }
 
 func (c *Client) Close() {
-	c.client.Shutdown()
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	for _, n := range c.nodes {
+		n.client.Shutdown()
+	}
 }
 
+// GetBestBlockHeight returns the highest tip among the nodes.
 func (c *Client) GetBestBlockHeight() (int64, error) {
-	count, err := c.client.GetBlockCount()
+	count, err := c.refreshTips()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get block count: %w", err)
 	}
 	return count, nil
 }
 
-func (c *Client) GetBlockHashByHeight(height int64) (string, error) {
-	hash, err := c.client.GetBlockHash(height)
+// GetPruneHeight returns the lowest height whose block the nodes can serve,
+// from getblockchaininfo, and whether they are pruned. Requests fail over
+// between nodes, so the nodes count as pruned only if every one of them is,
+// and the one that keeps the oldest blocks sets the height.
+func (c *Client) GetPruneHeight() (int64, bool, error) {
+	lowest := int64(-1)
+	for _, n := range c.nodes {
+		var info *btcjson.GetBlockChainInfoResult
+		err := n.do(context.Background(), func(client *rpcclient.Client) error {
+			var err error
+			info, err = client.GetBlockChainInfo()
+			return err
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get blockchain info from %s: %w", n.host, err)
+		}
+		if !info.Pruned {
+			return 0, false, nil
+		}
+		if height := int64(info.PruneHeight); lowest < 0 || height < lowest {
+			lowest = height
+		}
+	}
+	return lowest, true, nil
+}
+
+func (c *Client) GetBlockHashByHeight(ctx context.Context, height int64) (string, error) {
+	cacheable := c.cacheable(height)
+	if cacheable {
+		if hash, ok := c.cache.get(height); ok {
+			c.heights.add(hash, height)
+			return hash, nil
+		}
+	}
+
+	var hash string
+	err := c.do(ctx, height, func(client *rpcclient.Client) error {
+		h, err := client.GetBlockHash(height)
+		if err != nil {
+			return err
+		}
+		hash = h.String()
+		return nil
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to get block hash for height %d: %w", height, err)
 	}
-	return hash.String(), nil
+	c.heights.add(hash, height)
+	if cacheable {
+		c.cache.add(height, hash)
+	}
+	return hash, nil
 }
 
-func (c *Client) GetBlockWithTransactions(hash string) (*models.Block, []*models.Transaction, error) {
+func (c *Client) GetBlockWithTransactions(ctx context.Context, hash string) (*models.Block, []*models.Transaction, error) {
+	data, err := c.GetBlockData(ctx, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data.Block, data.Transactions, nil
+}
+
+// GetBlockData fetches a block with verbosity 2 and parses the block, its
+// transactions and everything extracted from their outputs.
+func (c *Client) GetBlockData(ctx context.Context, hash string) (*models.BlockData, error) {
+	result, err := c.GetBlockVerbose(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlockData(result)
+}
+
+// GetBlockVerbose fetches a block with verbosity 2, or 3 after
+// SetPrevouts, and returns the JSON as is, so that it can be parsed with
+// ParseBlockData elsewhere.
+func (c *Client) GetBlockVerbose(ctx context.Context, hash string) (json.RawMessage, error) {
 	// Try to get block with full transaction details using a raw JSON-RPC call
 	// This uses verbosity level 2 which should include full transaction details
+	verbosity := "2"
+	if c.prevouts {
+		verbosity = "3"
+	}
 	params := []json.RawMessage{
 		json.RawMessage(`"` + hash + `"`),
-		json.RawMessage(`2`),
+		json.RawMessage(verbosity),
 	}
-	result, err := c.client.RawRequest("getblock", params)
+	minHeight := c.heights.take(hash)
+	var result json.RawMessage
+	err := c.doRaw(ctx, minHeight, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getblock", params)
+		return err
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get block %s with verbosity 2: %w", hash, err)
+		return nil, fmt.Errorf("failed to get block %s with verbosity %s: %w", hash, verbosity, err)
+	}
+	return result, nil
+}
+
+// GetBlockTxCount returns the number of transactions in a block from its
+// header, without fetching the block.
+func (c *Client) GetBlockTxCount(ctx context.Context, hash string) (int, error) {
+	var header struct {
+		NTx int `json:"nTx"`
 	}
+	if err := c.getBlockHeader(ctx, hash, &header); err != nil {
+		return 0, err
+	}
+	return header.NTx, nil
+}
 
-	// Parse the result manually since the btcd library doesn't support verbosity=2 properly
-	var blockData struct {
+// GetBlockHeight returns the height of a block from its header.
+func (c *Client) GetBlockHeight(ctx context.Context, hash string) (int64, error) {
+	var header struct {
+		Height int64 `json:"height"`
+	}
+	if err := c.getBlockHeader(ctx, hash, &header); err != nil {
+		return 0, err
+	}
+	return header.Height, nil
+}
+
+// GetBlockTime returns the timestamp in the header of the block at height.
+func (c *Client) GetBlockTime(ctx context.Context, height int64) (time.Time, error) {
+	hash, err := c.GetBlockHashByHeight(ctx, height)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var header struct {
+		Time int64 `json:"time"`
+	}
+	if err := c.getBlockHeader(ctx, hash, &header); err != nil {
+		return time.Time{}, err
+	}
+	return models.UnixTime(header.Time), nil
+}
+
+// GetBlockChainwork returns the total work of the chain up to a block, in
+// decimal, from its header.
+func (c *Client) GetBlockChainwork(ctx context.Context, hash string) (string, error) {
+	var header struct {
+		Chainwork string `json:"chainwork"`
+	}
+	if err := c.getBlockHeader(ctx, hash, &header); err != nil {
+		return "", err
+	}
+	work, ok := new(big.Int).SetString(header.Chainwork, 16)
+	if !ok {
+		return "", fmt.Errorf("invalid chainwork %q in header of block %s", header.Chainwork, hash)
+	}
+	return work.String(), nil
+}
+
+// GetBlockHeaderByHeight returns the block at height with only the fields
+// its header has. TxCount is the nTx of the header; Size, Weight and
+// everything derived from the transactions stay zero.
+func (c *Client) GetBlockHeaderByHeight(ctx context.Context, height int64) (*models.Block, error) {
+	hash, err := c.GetBlockHashByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	var header struct {
 		Hash              string  `json:"hash"`
 		Height            int64   `json:"height"`
 		Time              int64   `json:"time"`
-		Size              int32   `json:"size"`
-		Weight            int32   `json:"weight"`
+		NTx               int     `json:"nTx"`
 		PreviousBlockHash string  `json:"previousblockhash"`
 		MerkleRoot        string  `json:"merkleroot"`
 		Nonce             uint32  `json:"nonce"`
 		Bits              string  `json:"bits"`
 		Difficulty        float64 `json:"difficulty"`
-		Tx                []struct {
-			Txid     string `json:"txid"`
-			Size     int32  `json:"size"`
-			VSize    int32  `json:"vsize"`
-			Weight   int32  `json:"weight"`
-			Vin      []struct {
-				Txid string `json:"txid"`
-				Vout uint32 `json:"vout"`
-			} `json:"vin"`
-			Vout []struct {
-				Value float64 `json:"value"`
-			} `json:"vout"`
-		} `json:"tx"`
+		Chainwork         string  `json:"chainwork"`
 	}
+	if err := c.getBlockHeader(ctx, hash, &header); err != nil {
+		return nil, err
+	}
+	block := &models.Block{
+		Hash:              header.Hash,
+		Height:            header.Height,
+		Timestamp:         models.UnixTime(header.Time),
+		TxCount:           header.NTx,
+		PreviousBlockHash: header.PreviousBlockHash,
+		MerkleRoot:        header.MerkleRoot,
+		Nonce:             header.Nonce,
+		Bits:              header.Bits,
+		Difficulty:        header.Difficulty,
+		Subsidy:           models.SubsidyForHeight(header.Height),
+		ProcessedAt:       models.Now(),
+	}
+	// Stored in decimal like the chainwork of fully fetched blocks
+	if work, ok := new(big.Int).SetString(header.Chainwork, 16); ok {
+		block.Chainwork = work.String()
+	}
+	return block, nil
+}
 
-	if err := json.Unmarshal(result, &blockData); err != nil {
-		return nil, nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+// getBlockHeader fetches the verbose header of a block into header. Headers
+// are cached: callers only read fields that never change for a hash, unlike
+// confirmations and nextblockhash.
+func (c *Client) getBlockHeader(ctx context.Context, hash string, header any) error {
+	result, err := c.blockHeader(ctx, hash)
+	if err != nil {
+		return err
 	}
+	if err := json.Unmarshal(result, header); err != nil {
+		return fmt.Errorf("failed to unmarshal header of block %s: %w", hash, err)
+	}
+	return nil
+}
 
-	block := &models.Block{
-		Hash:              blockData.Hash,
-		Height:            blockData.Height,
-		Timestamp:         time.Unix(blockData.Time, 0),
-		Size:              blockData.Size,
-		Weight:            blockData.Weight,
-		TxCount:           len(blockData.Tx),
-		PreviousBlockHash: blockData.PreviousBlockHash,
-		MerkleRoot:        blockData.MerkleRoot,
-		Nonce:             blockData.Nonce,
-		Bits:              blockData.Bits,
-		Difficulty:        blockData.Difficulty,
-		ProcessedAt:       time.Now(),
-	}
-
-	blockTime := time.Unix(blockData.Time, 0)
-	processedAt := time.Now()
-
-	// Stream transactions to avoid holding all in memory
-	transactions := make([]*models.Transaction, 0, len(blockData.Tx))
-	
-	for _, rawTx := range blockData.Tx {
-		inputValue := int64(0)
-		outputValue := int64(0)
-		fee := int64(0)
-
-		for _, vout := range rawTx.Vout {
-			outputValue += int64(vout.Value * 100000000)
+func (c *Client) blockHeader(ctx context.Context, hash string) (json.RawMessage, error) {
+	if c.cache.size > 0 {
+		if header, ok := c.cache.getHeader(hash); ok {
+			return header, nil
 		}
+	}
 
-		// Check if it's coinbase transaction
-		isCoinbaseTx := len(rawTx.Vin) == 1 && rawTx.Vin[0].Txid == ""
-		
-		if !isCoinbaseTx {
-			// For now, skip input value calculation to avoid additional RPC calls
-			// This would require the previous transaction data
-			fee = inputValue - outputValue // Will be 0 for now
-		}
+	params := []json.RawMessage{
+		json.RawMessage(`"` + hash + `"`),
+		json.RawMessage(`true`),
+	}
+	minHeight := c.heights.get(hash)
+	var result json.RawMessage
+	err := c.doRaw(ctx, minHeight, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getblockheader", params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header of block %s: %w", hash, err)
+	}
+	c.cache.addHeader(hash, result)
+	return result, nil
+}
 
-		tx := &models.Transaction{
-			Txid:        rawTx.Txid,
-			BlockHash:   hash,
-			BlockHeight: blockData.Height,
-			Size:        rawTx.Size,
-			VSize:       rawTx.VSize,
-			Weight:      rawTx.Weight,
-			Fee:         fee,
-			InputCount:  len(rawTx.Vin),
-			OutputCount: len(rawTx.Vout),
-			InputValue:  inputValue,
-			OutputValue: outputValue,
-			Timestamp:   blockTime,
-			ProcessedAt: processedAt,
-		}
+// GetRawBlock fetches the serialized block with verbosity 0.
+func (c *Client) GetRawBlock(ctx context.Context, hash string) ([]byte, error) {
+	params := []json.RawMessage{
+		json.RawMessage(`"` + hash + `"`),
+		json.RawMessage(`0`),
+	}
+	minHeight := c.heights.get(hash)
+	var result json.RawMessage
+	err := c.doRaw(ctx, minHeight, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getblock", params)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw block %s: %w", hash, err)
+	}
 
-		transactions = append(transactions, tx)
-		
-		// Progress feedback is now handled by the processor layer
+	var rawHex string
+	if err := json.Unmarshal(result, &rawHex); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal raw block %s: %w", hash, err)
 	}
+	raw, err := hex.DecodeString(rawHex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw block %s: %w", hash, err)
+	}
+	return raw, nil
+}
 
-	return block, transactions, nil
+// witnessSize returns the bytes of a transaction taken up by witness data,
+// including the segwit marker and flag. Weight counts the non-witness bytes
+// four times and the witness bytes once.
+func witnessSize(size, weight int32) int64 {
+	if weight <= 0 {
+		return 0
+	}
+	stripped := (weight - size) / 3
+	return int64(size - stripped)
+}
+
+// feeRate returns the fee rate in sat/vB.
+func feeRate(fee int64, vsize int32) float64 {
+	if vsize <= 0 {
+		return 0
+	}
+	return float64(fee) / float64(vsize)
 }
 
 // Deprecated: Use GetBlockWithTransactions instead
 func (c *Client) GetTransactionsByBlock(blockHash string) ([]*models.Transaction, error) {
-	_, transactions, err := c.GetBlockWithTransactions(blockHash)
+	_, transactions, err := c.GetBlockWithTransactions(context.Background(), blockHash)
 	return transactions, err
-}
\ No newline at end of file
+}
@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// Errors returned by the client's requests. The underlying error is wrapped,
+// so errors.As still finds the *btcjson.RPCError of a JSON-RPC failure.
+var (
+	// ErrBlockNotFound means the node doesn't have the requested block or
+	// height, for example after a reorg or above its tip.
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrConnection means the node couldn't be reached.
+	ErrConnection = errors.New("connection to node failed")
+	// ErrNodeBusy means the node refused the request for now: its work
+	// queue is full or it is still warming up.
+	ErrNodeBusy = errors.New("node busy")
+	// ErrAuthFailed means the node rejected the RPC credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrPruned means the node has pruned the requested block's data.
+	ErrPruned = errors.New("block pruned")
+	// ErrTimeout means the node didn't answer within the request timeout.
+	ErrTimeout = errors.New("request timed out")
+	// ErrResponseTooLarge means the response was larger than the maximum
+	// response size.
+	ErrResponseTooLarge = errors.New("response too large")
+)
+
+// JSON-RPC error codes returned by Bitcoin Core, from src/rpc/protocol.h.
+const (
+	rpcMiscError           = -1
+	rpcInvalidAddressOrKey = -5
+	rpcInvalidParameter    = -8
+	rpcInWarmup            = -28
+)
+
+// statusCodePattern matches the error rpcclient returns when the HTTP
+// response isn't JSON, which is how bitcoind answers 401, 403 and 503.
+var statusCodePattern = regexp.MustCompile(`^status code: (\d+)`)
+
+// classifyError wraps err with the typed error matching it, or returns it
+// unchanged when none does:
+//
+//	-5 "Block not found", -8 "Block height out of range"  ErrBlockNotFound
+//	-1 "Block not available (pruned data)"                ErrPruned
+//	-28 warming up, "Work queue depth exceeded", 503      ErrNodeBusy
+//	401, 403                                              ErrAuthFailed
+//	network errors, EOF, client shut down                 ErrConnection
+//
+// rpcclient quotes the whole response in the error of one that isn't JSON,
+// which is cut to an excerpt.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := err.Error(); len(msg) > 2*maxExcerpt && statusCodePattern.MatchString(msg) {
+		err = fmt.Errorf("%s... (%d bytes)", msg[:2*maxExcerpt], len(msg))
+	}
+	if typed := errorType(err); typed != nil && !errors.Is(err, typed) {
+		return fmt.Errorf("%w: %w", typed, err)
+	}
+	return err
+}
+
+func errorType(err error) error {
+	var rpcErr *btcjson.RPCError
+	if errors.As(err, &rpcErr) {
+		switch {
+		case rpcErr.Code == rpcInvalidAddressOrKey && strings.Contains(rpcErr.Message, "not found"),
+			rpcErr.Code == rpcInvalidParameter && strings.Contains(rpcErr.Message, "out of range"):
+			return ErrBlockNotFound
+		case rpcErr.Code == rpcMiscError && strings.Contains(rpcErr.Message, "pruned"):
+			return ErrPruned
+		case rpcErr.Code == rpcInWarmup:
+			return ErrNodeBusy
+		}
+		return nil
+	}
+
+	if m := statusCodePattern.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		switch code {
+		case 401, 403:
+			return ErrAuthFailed
+		case 503:
+			return ErrNodeBusy
+		}
+	}
+	if strings.Contains(err.Error(), "Work queue depth exceeded") {
+		return ErrNodeBusy
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	// A node shutting down closes connections mid-response, which rpcclient
+	// reports as text ending in EOF
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, rpcclient.ErrClientShutdown) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "connection refused") || strings.HasSuffix(err.Error(), "EOF") {
+		return ErrConnection
+	}
+	return nil
+}
+
+// IsTransient reports whether err may go away if the request is retried
+// later: the node was unreachable, busy or too slow to answer.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrConnection) || errors.Is(err, ErrNodeBusy) || errors.Is(err, ErrTimeout)
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+func TestClassifyError(t *testing.T) {
+	rpcError := func(code int, message string) error {
+		return &btcjson.RPCError{Code: btcjson.RPCErrorCode(code), Message: message}
+	}
+	refused := &url.Error{Op: "Post", URL: "http://localhost:8332", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"block not found", rpcError(-5, "Block not found"), ErrBlockNotFound},
+		{"height out of range", rpcError(-8, "Block height out of range"), ErrBlockNotFound},
+		{"pruned", rpcError(-1, "Block not available (pruned data)"), ErrPruned},
+		{"warming up", rpcError(-28, "Loading block index…"), ErrNodeBusy},
+		{"work queue full", fmt.Errorf("status code: 503, response: %q", "Work queue depth exceeded"), ErrNodeBusy},
+		{"unauthorized", fmt.Errorf("status code: 401, response: %q", ""), ErrAuthFailed},
+		{"forbidden", fmt.Errorf("status code: 403, response: %q", ""), ErrAuthFailed},
+		{"connection refused", refused, ErrConnection},
+		{"client shut down", rpcclient.ErrClientShutdown, ErrConnection},
+		{"connection closed", &url.Error{Op: "Post", URL: "http://localhost:8332", Err: io.EOF}, ErrConnection},
+		{"wrapped", fmt.Errorf("failed to get block: %w", rpcError(-5, "Block not found")), ErrBlockNotFound},
+		{"other invalid address", rpcError(-5, "Invalid address"), nil},
+		{"other parameter", rpcError(-8, "Invalid verbosity"), nil},
+		{"other misc", rpcError(-1, "Something else"), nil},
+		{"other status", fmt.Errorf("status code: 500, response: %q", ""), nil},
+	}
+
+	typed := []error{ErrBlockNotFound, ErrConnection, ErrNodeBusy, ErrAuthFailed, ErrPruned}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err)
+			if !errors.Is(got, tt.err) {
+				t.Errorf("classifyError(%v) = %v, doesn't wrap the original error", tt.err, got)
+			}
+			for _, e := range typed {
+				if is := errors.Is(got, e); is != (e == tt.want) {
+					t.Errorf("errors.Is(classifyError(%v), %v) = %v", tt.err, e, is)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyErrorKeepsRPCError(t *testing.T) {
+	err := classifyError(&btcjson.RPCError{Code: -5, Message: "Block not found"})
+	var rpcErr *btcjson.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -5 {
+		t.Errorf("errors.As(%v) didn't find the RPC error", err)
+	}
+	if isNodeError(err) {
+		t.Error("a missing block counts as a node failure")
+	}
+	if classifyError(err) != err {
+		t.Error("classifying an error twice wrapped it again")
+	}
+	if classifyError(nil) != nil {
+		t.Error("classifyError(nil) != nil")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, e := range []error{ErrConnection, ErrNodeBusy} {
+		if !IsTransient(fmt.Errorf("node: %w", e)) {
+			t.Errorf("IsTransient(%v) = false", e)
+		}
+	}
+	for _, e := range []error{ErrBlockNotFound, ErrAuthFailed, ErrPruned, errors.New("other")} {
+		if IsTransient(e) {
+			t.Errorf("IsTransient(%v) = true", e)
+		}
+	}
+}
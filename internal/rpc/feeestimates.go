@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scrapbtc/pkg/models"
+	"strconv"
+)
+
+// FeeEstimateTargets are the confirmation targets GetFeeEstimates is
+// polled with in follow mode: the next block, half an hour, an hour and a
+// day.
+var FeeEstimateTargets = []int{1, 3, 6, 144}
+
+// GetFeeEstimates asks a node for its estimatesmartfee fee rate for each of
+// targets, along with its tip from getblockcount. Targets the node has no
+// estimate for yet, as after a restart, are left out.
+func (c *Client) GetFeeEstimates(ctx context.Context, targets []int) ([]*models.FeeEstimate, error) {
+	estimatedAt := models.Now()
+	var height int64
+	var estimates []*models.FeeEstimate
+	err := c.doRaw(ctx, 0, func(raw rawFunc) error {
+		estimates = estimates[:0]
+		result, err := raw("getblockcount", nil)
+		if err != nil {
+			return fmt.Errorf("getblockcount: %w", err)
+		}
+		if err := json.Unmarshal(result, &height); err != nil {
+			return fmt.Errorf("failed to unmarshal getblockcount: %w", err)
+		}
+		for _, target := range targets {
+			params := []json.RawMessage{json.RawMessage(strconv.Itoa(target))}
+			result, err := raw("estimatesmartfee", params)
+			if err != nil {
+				return fmt.Errorf("estimatesmartfee %d: %w", target, err)
+			}
+			estimate, err := parseFeeEstimate(result)
+			if err != nil {
+				return err
+			}
+			if estimate == nil {
+				continue
+			}
+			estimate.EstimatedAt, estimate.Target, estimate.Height = estimatedAt, target, height
+			estimates = append(estimates, estimate)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fee estimates: %w", err)
+	}
+	return estimates, nil
+}
+
+// parseFeeEstimate parses the result of estimatesmartfee, whose fee rate is
+// in BTC/kvB. It returns nil if the node reported errors instead of a fee
+// rate.
+func parseFeeEstimate(result json.RawMessage) (*models.FeeEstimate, error) {
+	var raw struct {
+		FeeRate *float64 `json:"feerate"`
+		Blocks  int      `json:"blocks"`
+	}
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal estimatesmartfee: %w", err)
+	}
+	if raw.FeeRate == nil {
+		return nil, nil
+	}
+	return &models.FeeEstimate{FeeRate: *raw.FeeRate * 1e5, Blocks: raw.Blocks}, nil
+}
@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestGetFeeEstimates asks a node that has no estimate for the next block
+// yet, as after a restart.
+func TestGetFeeEstimates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string          `json:"method"`
+			Params []int           `json:"params"`
+			ID     json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result any
+		switch {
+		case req.Method == "getblockcount":
+			result = 840000
+		case req.Method == "estimatesmartfee" && req.Params[0] == 1:
+			result = map[string]any{"errors": []string{"Insufficient data or no feerate found"}, "blocks": 0}
+		case req.Method == "estimatesmartfee":
+			// 25 sat/vB, estimated for 4 blocks at least
+			result = map[string]any{"feerate": 0.00025, "blocks": max(req.Params[0], 4)}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result, "error": nil})
+	}))
+	defer server.Close()
+
+	client, err := NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	estimates, err := client.GetFeeEstimates(context.Background(), FeeEstimateTargets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type estimate struct {
+		target, blocks int
+		height         int64
+		feeRate        float64
+	}
+	var got []estimate
+	for _, e := range estimates {
+		if e.EstimatedAt.IsZero() {
+			t.Errorf("estimate for %d blocks has no time", e.Target)
+		}
+		got = append(got, estimate{e.Target, e.Blocks, e.Height, e.FeeRate})
+	}
+	want := []estimate{{3, 4, 840000, 25}, {6, 6, 840000, 25}, {144, 144, 840000, 25}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFeeEstimates() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// Bounds of the delay between the attempts to reach the nodes again during
+// an outage, and the time each attempt may take.
+const (
+	initialReconnectDelay = time.Second
+	maxReconnectDelay     = 30 * time.Second
+	reconnectTimeout      = 10 * time.Second
+)
+
+// health tracks whether the client can reach any node. An outage starts
+// when a request finds every node unreachable or still warming up, for
+// example while bitcoind restarts. Requests then wait for reconnect to get
+// getblockchaininfo answered again instead of failing.
+type health struct {
+	mu sync.Mutex
+	// up is closed to release the waiting requests; nil while available.
+	up chan struct{}
+	// changed carries the error that started the latest outage, or nil
+	// once it ended.
+	changed chan error
+	// delay is the wait before the first reconnect attempt.
+	delay time.Duration
+}
+
+func newHealth() *health {
+	return &health{changed: make(chan error, 1), delay: initialReconnectDelay}
+}
+
+// notify replaces the change not yet received, if any, with err: only the
+// latest state matters. Called with mu held.
+func (h *health) notify(err error) {
+	select {
+	case <-h.changed:
+	default:
+	}
+	h.changed <- err
+}
+
+// unavailable reports whether err means the node can't serve any request
+// for now: it is unreachable or still loading its block index.
+func unavailable(err error) bool {
+	return errors.Is(err, ErrConnection) || isWarmup(err)
+}
+
+// isWarmup reports whether err is the error Bitcoin Core answers with while
+// it loads and verifies its block index after a start.
+func isWarmup(err error) bool {
+	var rpcErr *btcjson.RPCError
+	return errors.As(err, &rpcErr) && rpcErr.Code == rpcInWarmup
+}
+
+// Availability carries the error that made every node unavailable when an
+// outage starts, and nil when it ends. Only the latest change is kept.
+func (c *Client) Availability() <-chan error {
+	return c.health.changed
+}
+
+// waitAvailable returns once the client isn't in an outage, ctx is done or
+// the client is closed.
+func (c *Client) waitAvailable(ctx context.Context) error {
+	c.health.mu.Lock()
+	up := c.health.up
+	c.health.mu.Unlock()
+	if up == nil {
+		return nil
+	}
+	select {
+	case <-up:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.stop:
+		return fmt.Errorf("%w: client closed", ErrConnection)
+	}
+}
+
+// startOutage starts an outage caused by err and reconnects in the
+// background, unless one is already under way.
+func (c *Client) startOutage(err error) {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	if c.health.up != nil {
+		return
+	}
+	c.health.up = make(chan struct{})
+	c.health.notify(err)
+	go c.reconnect()
+}
+
+// reconnect asks every node for getblockchaininfo, waiting twice as long
+// after each round, up to maxReconnectDelay, until one answers. That ends
+// the outage; a node still warming up doesn't.
+func (c *Client) reconnect() {
+	delay := c.health.delay
+	for {
+		select {
+		case <-time.After(delay):
+		case <-c.stop:
+			return
+		}
+		for _, n := range c.nodes {
+			if n.ping() == nil {
+				c.health.mu.Lock()
+				close(c.health.up)
+				c.health.up = nil
+				c.health.notify(nil)
+				c.health.mu.Unlock()
+				return
+			}
+		}
+		delay = min(2*delay, maxReconnectDelay)
+	}
+}
+
+// ping asks the node for getblockchaininfo outside of its limiter, which
+// mustn't be throttled by the errors of a node that is down, and records
+// its tip if it answers.
+func (n *node) ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	result, err := n.raw.request(ctx, "getblockchaininfo", nil)
+	if err != nil {
+		return classifyError(err)
+	}
+	var info btcjson.GetBlockChainInfoResult
+	if err := json.Unmarshal(result, &info); err != nil {
+		return err
+	}
+	n.setTip(int64(info.Blocks))
+	return nil
+}
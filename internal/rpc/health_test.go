@@ -0,0 +1,143 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// restartingNode is a node that can be taken down, which closes every
+// connection without a response, and brought back warming up before it
+// answers again.
+type restartingNode struct {
+	mu    sync.Mutex
+	state string // "up", "down" or "warmup"
+	calls map[string]int
+}
+
+func (n *restartingNode) set(state string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.state = state
+}
+
+func (n *restartingNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string          `json:"method"`
+		ID     json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	state := n.state
+	n.calls[state+" "+req.Method]++
+	n.mu.Unlock()
+
+	switch state {
+	case "down":
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	case "warmup":
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": nil,
+			"error": map[string]any{"code": -28, "message": "Loading block index…"}})
+		return
+	}
+	var result any
+	switch req.Method {
+	case "getblockchaininfo":
+		result = map[string]any{"chain": "regtest", "blocks": 1000, "headers": 1000}
+	case "getblockhash":
+		result = strings.Repeat("ab", 32)
+	case "getblockstats":
+		result = map[string]any{"height": 5}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result, "error": nil})
+}
+
+// TestOutage takes the node down while requests are made: they must wait
+// through the outage and the warmup that follows, and succeed once the node
+// answers again.
+func TestOutage(t *testing.T) {
+	node := &restartingNode{state: "up", calls: make(map[string]int)}
+	server := httptest.NewServer(node)
+	defer server.Close()
+	client, err := NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.health.delay = time.Millisecond
+
+	node.set("down")
+	errs := make(chan error, 2)
+	go func() {
+		_, err := client.GetBlockHashByHeight(context.Background(), 5)
+		errs <- err
+	}()
+	go func() {
+		_, err := client.GetBlockStats(context.Background(), 5)
+		errs <- err
+	}()
+
+	select {
+	case err := <-client.Availability():
+		if !unavailable(err) {
+			t.Errorf("outage started by %v, want a connection error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no outage reported")
+	}
+
+	// Both requests must have failed once, so neither is sent during warmup
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		node.mu.Lock()
+		failed := node.calls["down getblockhash"] > 0 && node.calls["down getblockstats"] > 0
+		node.mu.Unlock()
+		if failed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("requests not sent to the node that is down")
+		}
+	}
+	node.set("warmup")
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatalf("request returned during the outage: %v", err)
+	default:
+	}
+
+	node.set("up")
+	for range 2 {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("request after the outage: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("requests still waiting after the node came back")
+		}
+	}
+	if err := <-client.Availability(); err != nil {
+		t.Errorf("Availability() = %v after the outage, want nil", err)
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.calls["warmup getblockchaininfo"] == 0 {
+		t.Error("no reconnect attempt while warming up")
+	}
+	if n := node.calls["warmup getblockhash"] + node.calls["warmup getblockstats"]; n != 0 {
+		t.Errorf("%d requests sent while warming up, want none before reconnecting", n)
+	}
+}
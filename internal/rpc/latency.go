@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyTracker accumulates the duration and outcome of every RPC request
+// sent to the nodes, excluding the time spent waiting for the limiter.
+type latencyTracker struct {
+	calls  atomic.Int64
+	errors atomic.Int64
+	nanos  atomic.Int64
+}
+
+func (t *latencyTracker) record(d time.Duration, err error) {
+	t.calls.Add(1)
+	t.nanos.Add(int64(d))
+	if err != nil {
+		t.errors.Add(1)
+	}
+}
+
+// LatencyStats are cumulative counts of the RPC requests sent so far.
+// Subtract two snapshots to get the requests in between.
+type LatencyStats struct {
+	Calls  int64
+	Errors int64
+	Total  time.Duration
+}
+
+// Sub returns the requests made between prev and s.
+func (s LatencyStats) Sub(prev LatencyStats) LatencyStats {
+	return LatencyStats{
+		Calls:  s.Calls - prev.Calls,
+		Errors: s.Errors - prev.Errors,
+		Total:  s.Total - prev.Total,
+	}
+}
+
+// Mean returns the average request duration, zero without requests.
+func (s LatencyStats) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// Latency returns the cumulative request statistics of every node.
+func (c *Client) Latency() LatencyStats {
+	return LatencyStats{
+		Calls:  c.latency.calls.Load(),
+		Errors: c.latency.errors.Load(),
+		Total:  time.Duration(c.latency.nanos.Load()),
+	}
+}
@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// throttlePenalty is how long a reduced rate stays in effect after the
+	// node reports that its work queue is full.
+	throttlePenalty = 30 * time.Second
+	// throttleFloorRate is the lowest rate the limiter backs off to.
+	throttleFloorRate = 0.5
+	// unlimitedThrottleRate is the starting rate used when an unlimited
+	// limiter gets throttled and has no configured rate to reduce from.
+	unlimitedThrottleRate = 10.0
+)
+
+// Limiter is a token bucket combined with a concurrency cap that every RPC
+// request acquires before being sent to the node. A zero rate or concurrency
+// means unlimited.
+type Limiter struct {
+	mu             sync.Mutex
+	rate           float64
+	current        float64
+	tokens         float64
+	last           time.Time
+	throttledUntil time.Time
+	throttleCount  int64
+
+	sem      chan struct{}
+	inFlight int
+}
+
+func NewLimiter(maxConcurrent int, ratePerSec float64) *Limiter {
+	l := &Limiter{
+		rate:    ratePerSec,
+		current: ratePerSec,
+		tokens:  1,
+		last:    time.Now(),
+	}
+	if maxConcurrent > 0 {
+		l.sem = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// Acquire blocks until a request may be issued or ctx is done. On success it
+// returns a function that must be called once the request has finished.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if l.sem != nil {
+				<-l.sem
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	l.mu.Lock()
+	l.inFlight++
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+		if l.sem != nil {
+			<-l.sem
+		}
+	}, nil
+}
+
+// reserve takes a token if one is available, otherwise it returns how long
+// to wait before trying again.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if !l.throttledUntil.IsZero() && now.After(l.throttledUntil) {
+		l.current = l.rate
+		l.throttledUntil = time.Time{}
+	}
+
+	if l.current <= 0 {
+		return 0
+	}
+
+	burst := l.current
+	if burst < 1 {
+		burst = 1
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.current
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return time.Duration((1 - l.tokens) / l.current * float64(time.Second))
+	}
+	l.tokens--
+	return 0
+}
+
+// Throttle halves the effective rate for a while. It is called when the node
+// rejects a request because its work queue is full.
+func (l *Limiter) Throttle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.current <= 0 {
+		l.current = unlimitedThrottleRate
+	} else {
+		l.current /= 2
+	}
+	if l.current < throttleFloorRate {
+		l.current = throttleFloorRate
+	}
+	// Start refilling from empty at the reduced rate; an unlimited limiter
+	// never updated last, so the time since it was created would otherwise
+	// refill the whole burst at once
+	now := time.Now()
+	l.tokens = 0
+	l.last = now
+	l.throttledUntil = now.Add(throttlePenalty)
+	l.throttleCount++
+}
+
+// State returns a short human readable description of the limiter.
+func (l *Limiter) State() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate := "unlimited"
+	if l.current > 0 {
+		rate = fmt.Sprintf("%.1f req/s", l.current)
+	}
+	state := fmt.Sprintf("rpc %s, %d in flight", rate, l.inFlight)
+	if l.sem != nil {
+		state = fmt.Sprintf("rpc %s, %d/%d in flight", rate, l.inFlight, cap(l.sem))
+	}
+	if !l.throttledUntil.IsZero() {
+		remaining := time.Until(l.throttledUntil).Truncate(time.Second)
+		state += fmt.Sprintf(", throttled for %s (%d times)", remaining, l.throttleCount)
+	}
+	return state
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if wait := l.reserve(); wait != 0 {
+			t.Fatalf("unlimited limiter asked to wait %v", wait)
+		}
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := NewLimiter(0, 10)
+	l.last = time.Now().Add(-time.Hour)
+
+	// The bucket holds at most one second of requests
+	for i := 0; i < 10; i++ {
+		if wait := l.reserve(); wait != 0 {
+			t.Fatalf("request %d of the burst asked to wait %v", i, wait)
+		}
+	}
+	if wait := l.reserve(); wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("request after the burst waits %v, want up to 100ms", wait)
+	}
+}
+
+func TestLimiterThrottleUnlimited(t *testing.T) {
+	l := NewLimiter(0, 0)
+	// An unlimited limiter never takes tokens, so last stays at creation
+	l.last = time.Now().Add(-time.Minute)
+
+	l.Throttle()
+	if l.current != unlimitedThrottleRate {
+		t.Fatalf("throttled rate = %v, want %v", l.current, unlimitedThrottleRate)
+	}
+	if wait := l.reserve(); wait == 0 {
+		t.Error("first request after throttling got a token from a refilled burst")
+	}
+}
+
+func TestLimiterThrottleHalvesRate(t *testing.T) {
+	l := NewLimiter(0, 8)
+	l.Throttle()
+	l.Throttle()
+	if l.current != 2 {
+		t.Errorf("rate after two throttles = %v, want 2", l.current)
+	}
+	for i := 0; i < 10; i++ {
+		l.Throttle()
+	}
+	if l.current != throttleFloorRate {
+		t.Errorf("rate = %v, want the floor %v", l.current, throttleFloorRate)
+	}
+
+	// The full rate comes back once the penalty is over
+	l.throttledUntil = time.Now().Add(-time.Second)
+	l.reserve()
+	if l.current != 8 || !l.throttledUntil.IsZero() {
+		t.Errorf("rate after the penalty = %v, throttled until %v", l.current, l.throttledUntil)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := NewLimiter(1, 0)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err == nil {
+		t.Fatal("second request acquired the limiter while the first was in flight")
+	}
+
+	release()
+	release, err = l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
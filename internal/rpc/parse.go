@@ -0,0 +1,470 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"scrapbtc/internal/watchlist"
+	"scrapbtc/pkg/models"
+	"time"
+)
+
+// BlockVerbose is the result of getblock with verbosity 2, with the fields
+// the scraper consumes.
+type BlockVerbose struct {
+	Hash              string  `json:"hash"`
+	Height            int64   `json:"height"`
+	Time              int64   `json:"time"`
+	Size              int32   `json:"size"`
+	Weight            int32   `json:"weight"`
+	PreviousBlockHash string  `json:"previousblockhash"`
+	MerkleRoot        string  `json:"merkleroot"`
+	Nonce             uint32  `json:"nonce"`
+	Bits              string  `json:"bits"`
+	Difficulty        float64 `json:"difficulty"`
+	// Chainwork is in hex
+	Chainwork string      `json:"chainwork"`
+	Tx        []TxVerbose `json:"tx"`
+}
+
+// TxVerbose is a transaction of a block fetched with verbosity 2.
+type TxVerbose struct {
+	Txid     string `json:"txid"`
+	Size     int32  `json:"size"`
+	VSize    int32  `json:"vsize"`
+	Weight   int32  `json:"weight"`
+	Version  int32  `json:"version"`
+	LockTime uint32 `json:"locktime"`
+	// Fee is only reported by nodes that have the block's undo data
+	Fee  *json.Number `json:"fee"`
+	Vin  []Vin        `json:"vin"`
+	Vout []Vout       `json:"vout"`
+}
+
+// Vin is an input of a TxVerbose.
+type Vin struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+	// Coinbase is the scriptSig of a coinbase input, in hex
+	Coinbase  string `json:"coinbase"`
+	ScriptSig struct {
+		Hex string `json:"hex"`
+	} `json:"scriptSig"`
+	Witness  []string `json:"txinwitness"`
+	Sequence uint32   `json:"sequence"`
+	// Prevout is only printed by getblock with verbosity 3
+	Prevout *Prevout `json:"prevout"`
+}
+
+// Prevout is the output a Vin spends.
+type Prevout struct {
+	Value        json.Number `json:"value"`
+	ScriptPubKey struct {
+		Address   string   `json:"address"`
+		Addresses []string `json:"addresses"`
+	} `json:"scriptPubKey"`
+}
+
+// Vout is an output of a TxVerbose.
+type Vout struct {
+	Value        json.Number `json:"value"`
+	N            uint32      `json:"n"`
+	ScriptPubKey struct {
+		Hex     string `json:"hex"`
+		Type    string `json:"type"`
+		Address string `json:"address"`
+		// Addresses is used instead of Address by Core before v22
+		Addresses []string `json:"addresses"`
+	} `json:"scriptPubKey"`
+}
+
+// summaryTx is a TxVerbose decoded for the minimal and standard profiles,
+// which skip the scripts, addresses and witnesses rather than decode them.
+type summaryTx struct {
+	TxVerbose
+	Vin []struct {
+		Txid     string `json:"txid"`
+		Vout     uint32 `json:"vout"`
+		Coinbase string `json:"coinbase"`
+		Sequence uint32 `json:"sequence"`
+	} `json:"vin"`
+	Vout []struct {
+		Value json.Number `json:"value"`
+		N     uint32      `json:"n"`
+	} `json:"vout"`
+}
+
+// verbose returns the transaction with the fields it skipped left empty.
+func (tx *summaryTx) verbose() *TxVerbose {
+	v := tx.TxVerbose
+	v.Vin = make([]Vin, len(tx.Vin))
+	v.Vout = make([]Vout, len(tx.Vout))
+	for i, vin := range tx.Vin {
+		v.Vin[i].Txid, v.Vin[i].Vout, v.Vin[i].Coinbase, v.Vin[i].Sequence = vin.Txid, vin.Vout, vin.Coinbase, vin.Sequence
+	}
+	for i, vout := range tx.Vout {
+		v.Vout[i].Value, v.Vout[i].N = vout.Value, vout.N
+	}
+	return &v
+}
+
+// ParseBlockVerbose decodes the result of getblock with verbosity 2 as a
+// whole. BlockData turns it into the models ParseBlockData returns, which
+// decodes the transactions one at a time instead.
+func ParseBlockVerbose(result []byte) (*BlockVerbose, error) {
+	var block BlockVerbose
+	if err := json.Unmarshal(result, &block); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+	}
+	return &block, nil
+}
+
+// BlockData returns the block, its transactions and everything extracted
+// from their outputs, like ParseBlockData.
+func (b *BlockVerbose) BlockData() (*models.BlockData, error) {
+	p := newBlockParser(models.ProfileFull, nil)
+	for i := range b.Tx {
+		if err := p.addTransaction(&b.Tx[i]); err != nil {
+			return nil, err
+		}
+	}
+	return p.finish(b), nil
+}
+
+// ParseBlockData parses a block fetched with verbosity 2 into the block, its
+// transactions and everything extracted from their outputs. The tx array is
+// decoded one transaction at a time, so only the models are kept rather than
+// the decoded JSON of the whole block, which for a full block is several
+// times its size.
+func ParseBlockData(result json.RawMessage) (*models.BlockData, error) {
+	return ParseBlockProfile(result, models.ProfileFull)
+}
+
+// ParseBlockProfile parses a block like ParseBlockData, keeping only the
+// models profile stores. The block's aggregates are over all of its
+// transactions whatever the profile.
+func ParseBlockProfile(result json.RawMessage, profile models.Profile) (*models.BlockData, error) {
+	return ParseBlockWatching(result, profile, nil)
+}
+
+// ParseBlockWatching parses a block like ParseBlockProfile, and records in
+// BlockData.Watched the outputs paying an address of watch and the inputs
+// spending one, whatever the profile. Inputs are only matched in blocks
+// fetched with verbosity 3, which prints the outputs they spend.
+func ParseBlockWatching(result json.RawMessage, profile models.Profile, watch *watchlist.Watchlist) (*models.BlockData, error) {
+	p := newBlockParser(profile, watch)
+	var header BlockVerbose
+	fields := map[string]any{
+		"hash":              &header.Hash,
+		"height":            &header.Height,
+		"time":              &header.Time,
+		"size":              &header.Size,
+		"weight":            &header.Weight,
+		"previousblockhash": &header.PreviousBlockHash,
+		"merkleroot":        &header.MerkleRoot,
+		"nonce":             &header.Nonce,
+		"bits":              &header.Bits,
+		"difficulty":        &header.Difficulty,
+		"chainwork":         &header.Chainwork,
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(result))
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+		}
+		key, _ := token.(string)
+
+		switch field, ok := fields[key]; {
+		case key == "tx":
+			err = p.parseTransactions(dec)
+		case ok:
+			err = dec.Decode(field)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block data: %w", err)
+	}
+	return p.finish(&header), nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+// blockParser accumulates the models of a block while its transactions are
+// decoded. The block's header may come after the tx array, so the fields
+// taken from it are only set by finish.
+type blockParser struct {
+	block        *models.Block
+	processedAt  time.Time
+	profile      models.Profile
+	watch        *watchlist.Watchlist
+	txCount      int
+	transactions []*models.Transaction
+	inputs       []*models.TxInput
+	outputs      []*models.TxOutput
+	opReturns    []*models.OpReturnOutput
+	watched      []*models.WatchedActivity
+}
+
+func newBlockParser(profile models.Profile, watch *watchlist.Watchlist) *blockParser {
+	return &blockParser{block: &models.Block{ProcessedAt: models.Now()}, processedAt: models.Now(), profile: profile, watch: watch}
+}
+
+func (p *blockParser) parseTransactions(dec *json.Decoder) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	// The watchlist needs the addresses the summary skips
+	full := p.profile.Includes(models.ProfileFull) || p.watch != nil
+	for dec.More() {
+		// A fresh value per transaction, so the decoded JSON of the previous
+		// one can be collected
+		var rawTx *TxVerbose
+		if full {
+			rawTx = &TxVerbose{}
+			if err := dec.Decode(rawTx); err != nil {
+				return err
+			}
+		} else {
+			var summary summaryTx
+			if err := dec.Decode(&summary); err != nil {
+				return err
+			}
+			rawTx = summary.verbose()
+		}
+		if err := p.addTransaction(rawTx); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func (p *blockParser) addTransaction(rawTx *TxVerbose) error {
+	block := p.block
+	inputValue := int64(0)
+	outputValue := int64(0)
+	fee := int64(0)
+
+	for _, vout := range rawTx.Vout {
+		value, err := ParseAmount(vout.Value)
+		if err != nil {
+			return fmt.Errorf("output %d of transaction %s: %w", vout.N, rawTx.Txid, err)
+		}
+		outputValue += value
+
+		address := scriptAddress(vout.ScriptPubKey.Address, vout.ScriptPubKey.Addresses)
+		if p.watch.Contains(address) {
+			p.watched = append(p.watched, &models.WatchedActivity{
+				Address: address, Txid: rawTx.Txid, N: vout.N, Direction: models.DirectionIn, Value: value,
+			})
+		}
+		if !p.profile.Includes(models.ProfileFull) {
+			continue
+		}
+		p.outputs = append(p.outputs, &models.TxOutput{
+			Txid:         rawTx.Txid,
+			Vout:         vout.N,
+			Value:        value,
+			ScriptPubKey: vout.ScriptPubKey.Hex,
+			ScriptType:   scriptType(vout.ScriptPubKey.Type),
+			Address:      address,
+		})
+
+		if vout.ScriptPubKey.Type == "nulldata" {
+			data := opReturnPayload(vout.ScriptPubKey.Hex)
+			p.opReturns = append(p.opReturns, &models.OpReturnOutput{
+				Txid:     rawTx.Txid,
+				Vout:     vout.N,
+				DataHex:  hex.EncodeToString(data),
+				DataSize: len(data),
+			})
+		}
+	}
+
+	// Check if it's coinbase transaction
+	isCoinbaseTx := len(rawTx.Vin) == 1 && rawTx.Vin[0].Txid == ""
+	signalsRBF := false
+
+	txWitnessSize := witnessSize(rawTx.Size, rawTx.Weight)
+	if p.profile.Includes(models.ProfileFull) {
+		for _, vin := range rawTx.Vin {
+			if len(vin.Witness) > 0 {
+				block.SegwitTxCount++
+				break
+			}
+		}
+	} else if txWitnessSize > 0 {
+		// The witnesses weren't decoded, but they are what makes the
+		// weight exceed 4 times the size without them
+		block.SegwitTxCount++
+	}
+	block.WitnessSize += txWitnessSize
+
+	if !isCoinbaseTx {
+		for i, vin := range rawTx.Vin {
+			if vin.Sequence < rbfSequenceThreshold {
+				signalsRBF = true
+			}
+			if err := p.watchInput(rawTx.Txid, uint32(i), vin.Prevout); err != nil {
+				return err
+			}
+			if !p.profile.Includes(models.ProfileFull) {
+				continue
+			}
+			p.inputs = append(p.inputs, &models.TxInput{
+				Txid:         rawTx.Txid,
+				Vout:         uint32(i),
+				ScriptSig:    vin.ScriptSig.Hex,
+				Sequence:     vin.Sequence,
+				PrevTxid:     vin.Txid,
+				PrevVout:     vin.Vout,
+				TxidSpending: rawTx.Txid,
+			})
+		}
+	}
+
+	if isCoinbaseTx {
+		block.CoinbaseValue = outputValue
+		block.CoinbaseScript = rawTx.Vin[0].Coinbase
+	} else if rawTx.Fee != nil {
+		var err error
+		if fee, err = ParseAmount(*rawTx.Fee); err != nil {
+			return fmt.Errorf("fee of transaction %s: %w", rawTx.Txid, err)
+		}
+		inputValue = outputValue + fee
+	}
+	block.TotalFees += fee
+
+	p.txCount++
+	if !p.profile.Includes(models.ProfileStandard) {
+		return nil
+	}
+	p.transactions = append(p.transactions, &models.Transaction{
+		Txid:        rawTx.Txid,
+		Size:        rawTx.Size,
+		VSize:       rawTx.VSize,
+		Weight:      rawTx.Weight,
+		Fee:         fee,
+		FeeRate:     feeRate(fee, rawTx.VSize),
+		IsCoinbase:  isCoinbaseTx,
+		InputCount:  len(rawTx.Vin),
+		OutputCount: len(rawTx.Vout),
+		InputValue:  inputValue,
+		OutputValue: outputValue,
+		Version:     rawTx.Version,
+		LockTime:    rawTx.LockTime,
+		SignalsRBF:  signalsRBF,
+		Category:    models.ClassifyTransaction(len(rawTx.Vin), len(rawTx.Vout)),
+		ProcessedAt: p.processedAt,
+	})
+	return nil
+}
+
+// watchInput records input n of txid if it spends an output of a watched
+// address.
+func (p *blockParser) watchInput(txid string, n uint32, prevout *Prevout) error {
+	if p.watch == nil || prevout == nil {
+		return nil
+	}
+	address := scriptAddress(prevout.ScriptPubKey.Address, prevout.ScriptPubKey.Addresses)
+	if !p.watch.Contains(address) {
+		return nil
+	}
+	value, err := ParseAmount(prevout.Value)
+	if err != nil {
+		return fmt.Errorf("prevout of input %d of transaction %s: %w", n, txid, err)
+	}
+	p.watched = append(p.watched, &models.WatchedActivity{
+		Address: address, Txid: txid, N: n, Direction: models.DirectionOut, Value: value,
+	})
+	return nil
+}
+
+// scriptAddress returns the address of a scriptPubKey, which Core before
+// v22 printed in a list.
+func scriptAddress(address string, addresses []string) string {
+	if address == "" && len(addresses) == 1 {
+		return addresses[0]
+	}
+	return address
+}
+
+// finish sets the fields taken from the block header on every model and
+// returns them.
+func (p *blockParser) finish(header *BlockVerbose) *models.BlockData {
+	block := p.block
+	blockTime := models.UnixTime(header.Time)
+	block.Hash = header.Hash
+	block.Height = header.Height
+	block.Timestamp = blockTime
+	block.Size = header.Size
+	block.Weight = header.Weight
+	block.PreviousBlockHash = header.PreviousBlockHash
+	block.MerkleRoot = header.MerkleRoot
+	block.Nonce = header.Nonce
+	block.Bits = header.Bits
+	block.Difficulty = header.Difficulty
+	// Stored in decimal like the work computed from the bits
+	if work, ok := new(big.Int).SetString(header.Chainwork, 16); ok {
+		block.Chainwork = work.String()
+	}
+	block.TxCount = p.txCount
+	block.Subsidy = models.SubsidyForHeight(block.Height)
+	if block.Height == 0 {
+		// Core never added the output of the genesis coinbase, its only
+		// transaction, to the UTXO set, so it can't be spent: it isn't
+		// stored as an output, to stay out of the UTXO set and balances
+		p.outputs, p.opReturns = nil, nil
+	}
+
+	for _, tx := range p.transactions {
+		tx.BlockHash = block.Hash
+		tx.BlockHeight = block.Height
+		tx.Timestamp = blockTime
+	}
+	for _, in := range p.inputs {
+		in.BlockHeight = block.Height
+	}
+	for _, out := range p.outputs {
+		out.BlockHeight = block.Height
+	}
+	for _, op := range p.opReturns {
+		op.BlockHeight = block.Height
+		op.Timestamp = blockTime
+	}
+	for _, w := range p.watched {
+		w.BlockHash = block.Hash
+		w.BlockHeight = block.Height
+		w.Timestamp = blockTime
+	}
+
+	return &models.BlockData{
+		Block:        block,
+		Transactions: p.transactions,
+		Inputs:       p.inputs,
+		Outputs:      p.outputs,
+		OpReturns:    p.opReturns,
+		Watched:      p.watched,
+	}
+}
@@ -0,0 +1,292 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+const (
+	healthCheckInterval = 30 * time.Second
+	// maxNodeFailures is the number of consecutive failures after which a
+	// node stops receiving requests until a health check succeeds again.
+	maxNodeFailures = 3
+)
+
+// node is a single Bitcoin Core endpoint managed by Client.
+type node struct {
+	host    string
+	client  *rpcclient.Client
+	limiter *Limiter
+	latency *latencyTracker
+	// raw sends the requests of doRaw, whose responses rpcclient can't
+	// bound in size.
+	raw *rawClient
+	// timeout bounds each attempt of a request; zero means no limit.
+	timeout time.Duration
+
+	mu       sync.Mutex
+	tip      int64
+	failures int
+	disabled bool
+}
+
+// status reports whether the node's tip has reached minHeight and whether
+// the node is currently enabled.
+func (n *node) status(minHeight int64) (reached, enabled bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.tip >= minHeight, !n.disabled
+}
+
+func (n *node) recordSuccess() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = 0
+}
+
+func (n *node) recordFailure() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures++
+	if n.failures >= maxNodeFailures {
+		n.disabled = true
+	}
+}
+
+func (n *node) setTip(tip int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tip = tip
+	n.failures = 0
+	n.disabled = false
+}
+
+func (n *node) currentTip() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.tip
+}
+
+func (n *node) state() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := "up"
+	if n.disabled {
+		status = "down"
+	}
+	return fmt.Sprintf("%s %s tip %d, %s", n.host, status, n.tip, n.limiter.State())
+}
+
+// do runs a single rpcclient request against the node with call.
+func (n *node) do(ctx context.Context, request func(*rpcclient.Client) error) error {
+	return n.call(ctx, func(context.Context) error { return request(n.client) })
+}
+
+// call runs a single RPC request against the node under its limiter. Errors
+// are wrapped with the typed errors from classifyError. When the node is
+// busy the limiter is throttled and the request is retried with exponential
+// backoff. Each attempt gets the node's request timeout, after which it
+// fails with ErrTimeout. rpcclient has no context support, so when ctx is
+// done or the attempt times out call returns right away and an rpcclient
+// request is left to finish in the background with its result discarded;
+// the ctx passed to request is canceled then.
+func (n *node) call(ctx context.Context, request func(context.Context) error) error {
+	delay := initialBusyDelay
+	for attempt := 0; ; attempt++ {
+		release, err := n.limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if n.timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, n.timeout)
+		}
+		done := make(chan error, 1)
+		go func() {
+			start := time.Now()
+			err := classifyError(request(attemptCtx))
+			n.latency.record(time.Since(start), err)
+			release()
+			done <- err
+		}()
+		select {
+		case err = <-done:
+		case <-attemptCtx.Done():
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: no response from %s within %s", ErrTimeout, n.host, n.timeout)
+		}
+		cancel()
+
+		// A node warming up can take minutes, which each waits out
+		if err == nil || !errors.Is(err, ErrNodeBusy) || isWarmup(err) || attempt >= maxBusyRetries {
+			return err
+		}
+
+		n.limiter.Throttle()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+		if delay > maxBusyDelay {
+			delay = maxBusyDelay
+		}
+	}
+}
+
+// isNodeError reports whether err indicates a problem with the node itself
+// rather than with the request. JSON-RPC errors come from a healthy node,
+// unless it is still warming up.
+func isNodeError(err error) bool {
+	var rpcErr *btcjson.RPCError
+	return !errors.As(err, &rpcErr) || errors.Is(err, ErrNodeBusy)
+}
+
+// do distributes an rpcclient request round-robin over nodes with each.
+func (c *Client) do(ctx context.Context, minHeight int64, request func(*rpcclient.Client) error) error {
+	return c.each(ctx, minHeight, func(n *node) error { return n.do(ctx, request) })
+}
+
+// doRaw is do for requests sent with raw, which checks the size and format
+// of the responses and is canceled when the attempt times out.
+func (c *Client) doRaw(ctx context.Context, minHeight int64, request func(raw rawFunc) error) error {
+	return c.each(ctx, minHeight, func(n *node) error {
+		return n.call(ctx, func(ctx context.Context) error {
+			return request(func(method string, params []json.RawMessage) (json.RawMessage, error) {
+				return n.raw.request(ctx, method, params)
+			})
+		})
+	})
+}
+
+// each distributes a request round-robin over nodes whose tip is at or above
+// minHeight. A request that fails on one node is retried on the next before
+// the error is returned to the caller, unless ctx is done. When every node
+// is unavailable the client enters an outage: the request, like every other,
+// waits until a node answers again and is then retried.
+func (c *Client) each(ctx context.Context, minHeight int64, request func(*node) error) error {
+	for {
+		if err := c.waitAvailable(ctx); err != nil {
+			return err
+		}
+		down, err := c.eachOnce(ctx, minHeight, request)
+		if !down || ctx.Err() != nil {
+			return err
+		}
+		c.startOutage(err)
+	}
+}
+
+// eachOnce tries request on each candidate node until one succeeds. down
+// reports whether every node failed because it was unavailable.
+func (c *Client) eachOnce(ctx context.Context, minHeight int64, request func(*node) error) (down bool, err error) {
+	candidates := c.candidates(minHeight)
+	if len(candidates) == 0 {
+		return false, fmt.Errorf("%w: no node has reached height %d", ErrBlockNotFound, minHeight)
+	}
+
+	var errs []error
+	down = true
+	for _, n := range candidates {
+		err := request(n)
+		if err == nil {
+			n.recordSuccess()
+			return false, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+		if isNodeError(err) {
+			n.recordFailure()
+		}
+		down = down && unavailable(err)
+		if len(c.nodes) == 1 {
+			return down, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", n.host, err))
+	}
+	return down, errors.Join(errs...)
+}
+
+// candidates returns the nodes eligible for a request in round-robin order.
+// Disabled nodes are appended last so a request can still succeed when every
+// node has been marked down.
+func (c *Client) candidates(minHeight int64) []*node {
+	start := int(atomic.AddUint64(&c.next, 1) % uint64(len(c.nodes)))
+
+	var healthy, fallback []*node
+	for i := range c.nodes {
+		n := c.nodes[(start+i)%len(c.nodes)]
+		reached, enabled := n.status(minHeight)
+		if !reached {
+			continue
+		}
+		if enabled {
+			healthy = append(healthy, n)
+		} else {
+			fallback = append(fallback, n)
+		}
+	}
+	return append(healthy, fallback...)
+}
+
+// healthCheck periodically refreshes every node's tip, re-enabling nodes
+// that have recovered.
+func (c *Client) healthCheck() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.refreshTips()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// refreshTips queries getblockcount on every node and returns the highest
+// tip. If the tip went down, cached hashes that are no longer safely below it
+// are dropped.
+func (c *Client) refreshTips() (int64, error) {
+	var best int64 = -1
+	var lastErr error
+	for _, n := range c.nodes {
+		var count int64
+		err := n.do(context.Background(), func(client *rpcclient.Client) error {
+			var err error
+			count, err = client.GetBlockCount()
+			return err
+		})
+		if err != nil {
+			n.recordFailure()
+			lastErr = fmt.Errorf("%s: %w", n.host, err)
+			continue
+		}
+		n.setTip(count)
+		if count > best {
+			best = count
+		}
+	}
+	if best < 0 {
+		return 0, lastErr
+	}
+	if prev := c.best.Swap(best); best < prev {
+		c.cache.invalidateFrom(best - hashCacheSafeDepth + 1)
+	}
+	return best, nil
+}
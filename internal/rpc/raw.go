@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+const (
+	// DefaultMaxResponseSize is the largest response accepted from a node
+	// unless SetMaxResponseSize says otherwise. The largest blocks take
+	// a few tens of megabytes with verbosity 2.
+	DefaultMaxResponseSize = 64 << 20
+	// DefaultRequestTimeout is how long a request may take unless
+	// SetRequestTimeout says otherwise.
+	DefaultRequestTimeout = 2 * time.Minute
+
+	// maxExcerpt is the number of bytes of a response quoted in errors.
+	maxExcerpt = 256
+)
+
+// rawFunc sends a JSON-RPC request to the node it is bound to and returns
+// its result.
+type rawFunc func(method string, params []json.RawMessage) (json.RawMessage, error)
+
+// rawClient sends JSON-RPC requests over HTTP like rpcclient's RawRequest,
+// but with a context, reading at most maxSize bytes of the response and
+// quoting only an excerpt of responses that aren't JSON-RPC.
+type rawClient struct {
+	url        string
+	user, pass string
+	client     *http.Client
+	maxSize    int64
+}
+
+// newRawClient sends requests to address, a host:port optionally followed by
+// a path, over https if useTLS is set.
+func newRawClient(address string, useTLS bool, user, pass string) *rawClient {
+	scheme := "http://"
+	if useTLS {
+		scheme = "https://"
+	}
+	return &rawClient{url: scheme + address, user: user, pass: pass, client: &http.Client{}, maxSize: DefaultMaxResponseSize}
+}
+
+// request sends method with params. Errors follow rpcclient's, so that
+// classifyError recognizes them: JSON-RPC errors are *btcjson.RPCError and
+// other responses fail with their status code.
+func (r *rawClient) request(ctx context.Context, method string, params []json.RawMessage) (json.RawMessage, error) {
+	if params == nil {
+		params = []json.RawMessage{}
+	}
+	body, err := json.Marshal(map[string]any{"jsonrpc": "1.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(r.user, r.pass)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	reader := io.Reader(resp.Body)
+	if r.maxSize > 0 {
+		reader = io.LimitReader(resp.Body, r.maxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading json reply: %w", err)
+	}
+	if !looksLikeJSON(data) {
+		return nil, fmt.Errorf("status code: %d, response: %s", resp.StatusCode, excerpt(data))
+	}
+	if r.maxSize > 0 && int64(len(data)) > r.maxSize {
+		return nil, fmt.Errorf("%w: %s response larger than %d bytes", ErrResponseTooLarge, method, r.maxSize)
+	}
+
+	var reply struct {
+		Result json.RawMessage   `json:"result"`
+		Error  *btcjson.RPCError `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("status code: %d, invalid JSON-RPC response %s: %w", resp.StatusCode, excerpt(data), err)
+	}
+	if reply.Error != nil {
+		return nil, reply.Error
+	}
+	return reply.Result, nil
+}
+
+// looksLikeJSON reports whether data starts like a JSON object, which an
+// HTML error page of a proxy doesn't.
+func looksLikeJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// excerpt quotes data, cut to maxExcerpt bytes.
+func excerpt(data []byte) string {
+	if len(data) <= maxExcerpt {
+		return strconv.Quote(string(data))
+	}
+	return fmt.Sprintf("%q... (%d bytes)", data[:maxExcerpt], len(data))
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawNode answers getblockchaininfo like a regtest node and passes getblock
+// requests to getblock.
+func rawNode(t *testing.T, getblock http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string          `json:"method"`
+			ID     json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method == "getblock" {
+			getblock(w, r)
+			return
+		}
+		info := map[string]any{"chain": "regtest", "blocks": 1000, "headers": 1000}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": info, "error": nil})
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestRawResponseGuards(t *testing.T) {
+	block := `{"result": {"hash": "00ff", "height": 5}, "error": null, "id": 1}`
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	for _, tc := range []struct {
+		name     string
+		getblock http.HandlerFunc
+		want     error
+		check    func(t *testing.T, err error)
+	}{
+		{"block", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(block)) }, nil, nil},
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"result": null, "error": {"code": -5, "message": "Block not found"}, "id": 1}`))
+		}, ErrBlockNotFound, nil},
+		{"html page", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html><body>" + strings.Repeat("Bad gateway ", 100000) + "</body></html>"))
+		}, nil, func(t *testing.T, err error) {
+			if msg := err.Error(); !strings.Contains(msg, "status code: 502") || len(msg) > 1000 {
+				t.Errorf("error of %d bytes, want status code 502 and an excerpt: %.300s", len(msg), msg)
+			}
+		}},
+		{"too large", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"result": "` + strings.Repeat("ab", 1000) + `", "error": null, "id": 1}`))
+		}, ErrResponseTooLarge, nil},
+		{"stuck", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-stuck:
+			case <-r.Context().Done():
+			}
+		}, ErrTimeout, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient([]string{rawNode(t, tc.getblock)}, "user", "pass", 0, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			client.SetRequestTimeout(100 * time.Millisecond)
+			client.SetMaxResponseSize(1000)
+
+			result, err := client.GetBlockVerbose(context.Background(), "00ff")
+			if tc.want == nil && tc.check == nil {
+				if err != nil || !strings.Contains(string(result), `"height": 5`) {
+					t.Errorf("GetBlockVerbose() = %s, %v, want the block", result, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("GetBlockVerbose() = %s, want an error", result)
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("GetBlockVerbose() error = %v, want %v", err, tc.want)
+			}
+			if tc.check != nil {
+				tc.check(t, err)
+			}
+		})
+	}
+	if !IsTransient(ErrTimeout) {
+		t.Error("a timed out request isn't transient")
+	}
+}
+
+func TestClassifyErrorExcerpt(t *testing.T) {
+	page := strings.Repeat("<p>Bad gateway</p>", 100000)
+	err := classifyError(errors.New("status code: 502, response: \"" + page + "\""))
+	if msg := err.Error(); len(msg) > 1000 || !strings.HasPrefix(msg, "status code: 502") {
+		t.Errorf("classifyError() kept an error of %d bytes: %.300s", len(msg), msg)
+	}
+}
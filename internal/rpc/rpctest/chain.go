@@ -0,0 +1,335 @@
+// Package rpctest serves blocks like a node does without one, from JSON
+// fixtures or a synthetic chain, for tests of the scraping pipeline.
+package rpctest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned for the requests a Chain can't answer.
+var ErrUnsupported = errors.New("not supported by rpctest.Chain")
+
+// SyntheticStart is the time of the first block of Synthetic; the others
+// follow every 10 minutes.
+var SyntheticStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Chain serves blocks as getblock with verbosity 2 prints them. It
+// implements processor.BlockSource. Blocks are served by height and hash
+// and the tip is the highest height added. It is safe for concurrent use.
+type Chain struct {
+	mu       sync.Mutex
+	byHeight map[int64]string
+	blocks   map[string]json.RawMessage
+	txCounts map[string]int
+	tip      int64
+	failures map[int64]error
+	requests int64
+	outages  chan error
+}
+
+// NewChain returns an empty chain.
+func NewChain() *Chain {
+	return &Chain{
+		byHeight: make(map[int64]string),
+		blocks:   make(map[string]json.RawMessage),
+		txCounts: make(map[string]int),
+		tip:      -1,
+		failures: make(map[int64]error),
+		outages:  make(chan error),
+	}
+}
+
+// LoadFixtures returns a chain of the verbose blocks in the JSON files at
+// paths, such as those in internal/rpc/testdata.
+func LoadFixtures(paths ...string) (*Chain, error) {
+	c := NewChain()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Add(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// Add adds a verbose block, replacing the block at its height.
+func (c *Chain) Add(block json.RawMessage) error {
+	var header struct {
+		Hash   string            `json:"hash"`
+		Height int64             `json:"height"`
+		Tx     []json.RawMessage `json:"tx"`
+	}
+	if err := json.Unmarshal(block, &header); err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+	if header.Hash == "" {
+		return fmt.Errorf("block at height %d has no hash", header.Height)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.byHeight[header.Height]; ok {
+		delete(c.blocks, old)
+		delete(c.txCounts, old)
+	}
+	c.byHeight[header.Height] = header.Hash
+	c.blocks[header.Hash] = block
+	c.txCounts[header.Hash] = len(header.Tx)
+	c.tip = max(c.tip, header.Height)
+	return nil
+}
+
+// Fail makes the requests for the block at height fail with err, or
+// succeed again if err is nil.
+func (c *Chain) Fail(height int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.failures, height)
+	} else {
+		c.failures[height] = err
+	}
+}
+
+// Requests returns the number of block requests served so far.
+func (c *Chain) Requests() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+// Synthetic returns a chain of n blocks from height 0. Every block has a
+// coinbase paying the subsidy and the fees to a miner address and, from
+// height 1 on, a transaction spending the previous coinbase to a payment
+// and a change output, paying 1000 plus the height satoshis in fees. Its
+// input carries the prevout of getblock with verbosity 3.
+func Synthetic(n int) *Chain {
+	c := NewChain()
+	var prevHash, prevCoinbase string
+	var prevValue int64
+	for height := range int64(n) {
+		block := SyntheticBlock(height, prevHash, prevCoinbase, prevValue)
+		if err := c.Add(block); err != nil {
+			panic(err)
+		}
+		var parsed struct {
+			Hash string `json:"hash"`
+			Tx   []struct {
+				Txid string `json:"txid"`
+			} `json:"tx"`
+		}
+		if err := json.Unmarshal(block, &parsed); err != nil {
+			panic(err)
+		}
+		prevHash, prevCoinbase = parsed.Hash, parsed.Tx[0].Txid
+		prevValue = models.SubsidyForHeight(height) + SyntheticFee(height)
+	}
+	return c
+}
+
+// SyntheticFee is the fee paid in the synthetic block at height.
+func SyntheticFee(height int64) int64 {
+	if height == 0 {
+		return 0
+	}
+	return 1000 + height
+}
+
+// SyntheticBlock returns the verbose JSON of the synthetic block at height,
+// whose non-coinbase transaction spends output 0 of prevCoinbase, worth
+// prevValue satoshis. The genesis block has only its coinbase.
+func SyntheticBlock(height int64, prevHash, prevCoinbase string, prevValue int64) json.RawMessage {
+	fee := SyntheticFee(height)
+	coinbaseID := syntheticHash("coinbase", height)
+	txs := []any{map[string]any{
+		"txid": coinbaseID, "hash": coinbaseID, "version": 2, "size": 150, "vsize": 123, "weight": 492, "locktime": 0,
+		"vin": []any{map[string]any{"coinbase": fmt.Sprintf("%02x", height%256), "sequence": 4294967295}},
+		"vout": []any{
+			syntheticOutput(models.SubsidyForHeight(height)+fee, 0, "miner"),
+		},
+	}}
+	size, weight := 230, 920
+	if height > 0 {
+		payment := (prevValue - fee) / 2
+		paymentID := syntheticHash("payment", height)
+		txs = append(txs, map[string]any{
+			"txid": paymentID, "hash": paymentID, "version": 2, "size": 222, "vsize": 141, "weight": 561, "locktime": 0,
+			"fee": json.Number(btc(fee)),
+			"vin": []any{map[string]any{
+				"txid": prevCoinbase, "vout": 0, "scriptSig": map[string]any{"asm": "", "hex": ""},
+				"txinwitness": []string{"30", "02"}, "sequence": 4294967293,
+				"prevout": map[string]any{
+					"generated": true, "height": height - 1, "value": json.Number(btc(prevValue)),
+					"scriptPubKey": syntheticOutput(prevValue, 0, "miner")["scriptPubKey"],
+				},
+			}},
+			"vout": []any{
+				syntheticOutput(payment, 0, fmt.Sprintf("payment%d", height)),
+				syntheticOutput(prevValue-fee-payment, 1, fmt.Sprintf("change%d", height)),
+			},
+		})
+		size, weight = size+222, weight+561
+	}
+
+	block := map[string]any{
+		"hash": syntheticHash("block", height), "height": height, "version": 536870912,
+		"merkleroot": syntheticHash("merkle", height), "time": SyntheticStart.Unix() + height*600,
+		"mediantime": SyntheticStart.Unix() + height*600, "nonce": height, "bits": "207fffff",
+		"difficulty": 4.656542373906925e-10, "chainwork": fmt.Sprintf("%064x", 2*(height+1)),
+		"nTx": len(txs), "size": size, "strippedsize": size - 100, "weight": weight, "tx": txs,
+	}
+	if prevHash != "" {
+		block["previousblockhash"] = prevHash
+	}
+	data, err := json.Marshal(block)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func syntheticOutput(value int64, n int, owner string) map[string]any {
+	sum := sha256.Sum256([]byte(owner))
+	script := hex.EncodeToString(sum[:20])
+	return map[string]any{
+		"value": json.Number(btc(value)), "n": n,
+		"scriptPubKey": map[string]any{"hex": "0014" + script, "address": "bcrt1q" + owner, "type": "witness_v0_keyhash"},
+	}
+}
+
+func syntheticHash(kind string, height int64) string {
+	sum := sha256.Sum256([]byte(kind + strconv.FormatInt(height, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// btc prints sats as a BTC amount the way the node does.
+func btc(sats int64) string {
+	return strconv.FormatFloat(float64(sats)/models.SatoshisPerBTC, 'f', 8, 64)
+}
+
+// block returns the block with hash, counting the request.
+func (c *Chain) block(hash string) (json.RawMessage, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	block, ok := c.blocks[hash]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", rpc.ErrBlockNotFound, hash)
+	}
+	var height struct {
+		Height int64 `json:"height"`
+	}
+	if err := json.Unmarshal(block, &height); err != nil {
+		return nil, 0, err
+	}
+	if err := c.failures[height.Height]; err != nil {
+		return nil, 0, err
+	}
+	return block, height.Height, nil
+}
+
+func (c *Chain) GetBestBlockHeight() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tip, nil
+}
+
+func (c *Chain) GetBlockHashByHeight(ctx context.Context, height int64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hash, ok := c.byHeight[height]
+	if !ok {
+		return "", fmt.Errorf("%w: height %d", rpc.ErrBlockNotFound, height)
+	}
+	return hash, nil
+}
+
+func (c *Chain) GetBlockVerbose(ctx context.Context, hash string) (json.RawMessage, error) {
+	block, _, err := c.block(hash)
+	return block, err
+}
+
+func (c *Chain) GetBlockTxCount(ctx context.Context, hash string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.txCounts[hash]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", rpc.ErrBlockNotFound, hash)
+	}
+	return n, nil
+}
+
+// GetBlockStats derives the getblockstats counts, sizes and amounts from
+// the block; the fee rate aggregates are left zero.
+func (c *Chain) GetBlockStats(ctx context.Context, height int64) (json.RawMessage, error) {
+	hash, err := c.GetBlockHashByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	data, _, err := c.block(hash)
+	if err != nil {
+		return nil, err
+	}
+	block, err := rpc.ParseBlockData(data)
+	if err != nil {
+		return nil, err
+	}
+	stats := map[string]any{
+		"blockhash": hash, "height": height, "time": block.Block.Timestamp.Unix(), "mediantime": block.Block.Timestamp.Unix(),
+		"txs": len(block.Transactions), "total_size": block.Block.Size, "total_weight": block.Block.Weight,
+		"totalfee": block.Block.TotalFees, "subsidy": models.SubsidyForHeight(height),
+	}
+	var ins, outs, totalOut int64
+	for _, tx := range block.Transactions {
+		ins += int64(tx.InputCount)
+		outs += int64(tx.OutputCount)
+		if !tx.IsCoinbase {
+			totalOut += tx.OutputValue
+		}
+	}
+	stats["ins"], stats["outs"], stats["total_out"] = ins, outs, totalOut
+	return json.Marshal(stats)
+}
+
+func (c *Chain) GetRawBlock(ctx context.Context, hash string) ([]byte, error) {
+	return nil, fmt.Errorf("raw block %s: %w", hash, ErrUnsupported)
+}
+
+// GetNodeSnapshot reports the tip and an empty mempool.
+func (c *Chain) GetNodeSnapshot(ctx context.Context) (*models.NodeSnapshot, error) {
+	tip, _ := c.GetBestBlockHeight()
+	return &models.NodeSnapshot{TakenAt: models.Now(), Height: tip, Headers: tip, VerificationProgress: 1}, nil
+}
+
+func (c *Chain) GetFeeEstimates(ctx context.Context, targets []int) ([]*models.FeeEstimate, error) {
+	return nil, fmt.Errorf("fee estimates: %w", ErrUnsupported)
+}
+
+func (c *Chain) GetBlockTemplate(ctx context.Context) (*models.NextBlockEstimate, error) {
+	return nil, fmt.Errorf("block template: %w", ErrUnsupported)
+}
+
+func (c *Chain) InvalidateHashesFrom(height int64) {}
+
+func (c *Chain) LimiterState() string { return "rpctest" }
+
+func (c *Chain) HashCacheStats() (hits, misses uint64) { return 0, 0 }
+
+func (c *Chain) Latency() rpc.LatencyStats { return rpc.LatencyStats{} }
+
+// Availability never reports an outage.
+func (c *Chain) Availability() <-chan error { return c.outages }
@@ -0,0 +1,71 @@
+package rpctest
+
+import (
+	"context"
+	"errors"
+	"scrapbtc/internal/rpc"
+	"scrapbtc/pkg/models"
+	"testing"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	chain, err := LoadFixtures("../testdata/genesis_verbose.json", "../testdata/early_verbose.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if tip, _ := chain.GetBestBlockHeight(); tip != 170 {
+		t.Errorf("tip = %d, want 170", tip)
+	}
+	hash, err := chain.GetBlockHashByHeight(ctx, 170)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := chain.GetBlockTxCount(ctx, hash); err != nil || n != 2 {
+		t.Errorf("GetBlockTxCount() = %d, %v, want 2", n, err)
+	}
+	if _, err := chain.GetBlockHashByHeight(ctx, 1); !errors.Is(err, rpc.ErrBlockNotFound) {
+		t.Errorf("hash of a missing height: %v, want ErrBlockNotFound", err)
+	}
+}
+
+// TestSynthetic parses every synthetic block: each links to the previous
+// one, its coinbase claims exactly the subsidy and fees, and getblockstats
+// agrees on the fees.
+func TestSynthetic(t *testing.T) {
+	chain := Synthetic(5)
+	ctx := context.Background()
+	var prevHash string
+	for height := range int64(5) {
+		hash, err := chain.GetBlockHashByHeight(ctx, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verbose, err := chain.GetBlockVerbose(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := rpc.ParseBlockData(verbose)
+		if err != nil {
+			t.Fatalf("block %d: %v", height, err)
+		}
+		b := data.Block
+		if b.PreviousBlockHash != prevHash || b.TotalFees != SyntheticFee(height) ||
+			b.CoinbaseValue != models.SubsidyForHeight(height)+SyntheticFee(height) {
+			t.Errorf("block %d: previous %q, fees %d, coinbase %d", height, b.PreviousBlockHash, b.TotalFees, b.CoinbaseValue)
+		}
+		prevHash = hash
+
+		raw, err := chain.GetBlockStats(ctx, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := rpc.ParseBlockStats(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalFee != SyntheticFee(height) || stats.BlockHash != hash {
+			t.Errorf("stats of block %d = %+v", height, stats)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import "encoding/hex"
+
+const (
+	opReturn    = 0x6a
+	opPushData1 = 0x4c
+	opPushData2 = 0x4d
+	opPushData4 = 0x4e
+)
+
+// opReturnPayload returns the data pushed after OP_RETURN in a nulldata
+// script. Scripts that don't parse as a sequence of pushes return everything
+// after the OP_RETURN opcode as is.
+func opReturnPayload(scriptHex string) []byte {
+	script, err := hex.DecodeString(scriptHex)
+	if err != nil || len(script) == 0 || script[0] != opReturn {
+		return nil
+	}
+
+	rest := script[1:]
+	var payload []byte
+	for i := 0; i < len(rest); {
+		op := rest[i]
+		i++
+
+		var n int
+		switch {
+		case op == 0x00:
+			continue
+		case op < opPushData1:
+			n = int(op)
+		case op == opPushData1 && i+1 <= len(rest):
+			n = int(rest[i])
+			i++
+		case op == opPushData2 && i+2 <= len(rest):
+			n = int(rest[i]) | int(rest[i+1])<<8
+			i += 2
+		case op == opPushData4 && i+4 <= len(rest):
+			n = int(rest[i]) | int(rest[i+1])<<8 | int(rest[i+2])<<16 | int(rest[i+3])<<24
+			i += 4
+		default:
+			return rest
+		}
+
+		if n < 0 || i+n > len(rest) {
+			return rest
+		}
+		payload = append(payload, rest[i:i+n]...)
+		i += n
+	}
+
+	return payload
+}
+
+// scriptTypes maps the scriptPubKey types reported by Bitcoin Core to the
+// names stored in tx_outputs.script_type.
+var scriptTypes = map[string]string{
+	"pubkey":                "p2pk",
+	"pubkeyhash":            "p2pkh",
+	"scripthash":            "p2sh",
+	"witness_v0_keyhash":    "p2wpkh",
+	"witness_v0_scripthash": "p2wsh",
+	"witness_v1_taproot":    "p2tr",
+	"multisig":              "multisig",
+	"nulldata":              "op_return",
+	"nonstandard":           "nonstandard",
+}
+
+// scriptType returns the stored name of a scriptPubKey type. Types this
+// version doesn't know, such as future witness versions, are kept as
+// reported by the node.
+func scriptType(coreType string) string {
+	if t, ok := scriptTypes[coreType]; ok {
+		return t
+	}
+	return coreType
+}
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"scrapbtc/pkg/models"
+)
+
+// GetNodeSnapshot records the chain, mempool and network state of a node
+// from getblockchaininfo, getchaintxstats, getmempoolinfo and
+// getnetworkinfo. All four calls go to the same node so the numbers match.
+func (c *Client) GetNodeSnapshot(ctx context.Context) (*models.NodeSnapshot, error) {
+	var chain struct {
+		Blocks               int64   `json:"blocks"`
+		Headers              int64   `json:"headers"`
+		VerificationProgress float64 `json:"verificationprogress"`
+	}
+	var txStats struct {
+		TxCount        int64   `json:"txcount"`
+		WindowBlocks   int64   `json:"window_block_count"`
+		WindowTxs      int64   `json:"window_tx_count"`
+		WindowInterval int64   `json:"window_interval"`
+		TxRate         float64 `json:"txrate"`
+	}
+	var mempool struct {
+		Size          int64   `json:"size"`
+		Bytes         int64   `json:"bytes"`
+		Usage         int64   `json:"usage"`
+		MempoolMinFee float64 `json:"mempoolminfee"`
+	}
+	var network struct {
+		Connections    int `json:"connections"`
+		ConnectionsIn  int `json:"connections_in"`
+		ConnectionsOut int `json:"connections_out"`
+	}
+	calls := []struct {
+		method string
+		result any
+	}{
+		{"getblockchaininfo", &chain},
+		{"getchaintxstats", &txStats},
+		{"getmempoolinfo", &mempool},
+		{"getnetworkinfo", &network},
+	}
+
+	takenAt := models.Now()
+	err := c.doRaw(ctx, 0, func(raw rawFunc) error {
+		for _, call := range calls {
+			result, err := raw(call.method, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", call.method, err)
+			}
+			if err := json.Unmarshal(result, call.result); err != nil {
+				return fmt.Errorf("failed to unmarshal %s: %w", call.method, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node snapshot: %w", err)
+	}
+
+	return &models.NodeSnapshot{
+		TakenAt:              takenAt,
+		Height:               chain.Blocks,
+		Headers:              chain.Headers,
+		VerificationProgress: chain.VerificationProgress,
+		ChainTxCount:         txStats.TxCount,
+		WindowBlocks:         txStats.WindowBlocks,
+		WindowTxs:            txStats.WindowTxs,
+		WindowSeconds:        txStats.WindowInterval,
+		TxRate:               txStats.TxRate,
+		MempoolTxs:           mempool.Size,
+		MempoolBytes:         mempool.Bytes,
+		MempoolUsage:         mempool.Usage,
+		// Reported in BTC/kvB
+		MempoolMinFee:  mempool.MempoolMinFee * 1e5,
+		Connections:    network.Connections,
+		ConnectionsIn:  network.ConnectionsIn,
+		ConnectionsOut: network.ConnectionsOut,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnconfirmed is returned by GetTransactionBlockHash for a transaction
+// that is still in the mempool.
+var ErrUnconfirmed = errors.New("transaction is not in a block yet")
+
+// GetTransactionBlockHash returns the hash of the block that confirmed txid,
+// from getrawtransaction. Nodes find transactions outside their mempool only
+// with -txindex.
+func (c *Client) GetTransactionBlockHash(ctx context.Context, txid string) (string, error) {
+	params := []json.RawMessage{
+		json.RawMessage(`"` + txid + `"`),
+		json.RawMessage(`true`),
+	}
+	var result json.RawMessage
+	err := c.doRaw(ctx, 0, func(raw rawFunc) error {
+		var err error
+		result, err = raw("getrawtransaction", params)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction %s: %w", txid, err)
+	}
+	var tx struct {
+		BlockHash string `json:"blockhash"`
+	}
+	if err := json.Unmarshal(result, &tx); err != nil {
+		return "", fmt.Errorf("failed to unmarshal transaction %s: %w", txid, err)
+	}
+	if tx.BlockHash == "" {
+		return "", fmt.Errorf("%s: %w", txid, ErrUnconfirmed)
+	}
+	return tx.BlockHash, nil
+}
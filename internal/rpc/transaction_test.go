@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetTransactionBlockHash(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string          `json:"method"`
+			Params []any           `json:"params"`
+			ID     json.RawMessage `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var result any
+		switch {
+		case req.Method == "getblockcount":
+			result = 840000
+		case req.Method == "getrawtransaction" && req.Params[0] == "confirmed":
+			result = map[string]any{"txid": "confirmed", "blockhash": "00aa"}
+		case req.Method == "getrawtransaction":
+			result = map[string]any{"txid": req.Params[0]}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": req.ID, "result": result, "error": nil})
+	}))
+	defer server.Close()
+
+	client, err := NewClient([]string{strings.TrimPrefix(server.URL, "http://")}, "user", "pass", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if hash, err := client.GetTransactionBlockHash(context.Background(), "confirmed"); err != nil || hash != "00aa" {
+		t.Errorf("GetTransactionBlockHash(confirmed) = %q, %v, want 00aa", hash, err)
+	}
+	if _, err := client.GetTransactionBlockHash(context.Background(), "mempool"); !errors.Is(err, ErrUnconfirmed) {
+		t.Errorf("GetTransactionBlockHash(mempool) error = %v, want ErrUnconfirmed", err)
+	}
+}
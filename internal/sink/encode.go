@@ -0,0 +1,105 @@
+package sink
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"scrapbtc/pkg/models"
+	"strconv"
+	"time"
+)
+
+// Formats the file sink can write.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var Formats = []string{FormatCSV, FormatNDJSON}
+
+// encoder writes records of one kind to a file: a header once, if the
+// format has one, then one record per value.
+type encoder interface {
+	writeHeader() error
+	encode(v any) error
+	flush() error
+}
+
+func newEncoder(format string, w io.Writer, columns []string, record func(v any) []string) encoder {
+	if format == FormatNDJSON {
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}
+	}
+	return &csvEncoder{w: csv.NewWriter(w), columns: columns, record: record}
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []string
+	record  func(v any) []string
+}
+
+func (e *csvEncoder) writeHeader() error { return e.w.Write(e.columns) }
+func (e *csvEncoder) encode(v any) error { return e.w.Write(e.record(v)) }
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes one JSON object per line with the field names of the
+// models' JSON tags.
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) writeHeader() error { return nil }
+func (e *ndjsonEncoder) encode(v any) error { return e.enc.Encode(v) }
+func (e *ndjsonEncoder) flush() error       { return nil }
+
+// The CSV columns are named like the JSON fields of the models.
+var (
+	blockColumns = []string{
+		"hash", "height", "timestamp", "size", "weight", "tx_count", "filtered_tx_count",
+		"previous_block_hash", "merkle_root", "nonce", "bits", "difficulty",
+		"coinbase_value", "subsidy", "total_fees", "segwit_tx_count", "witness_size",
+		"coinbase_script", "miner_tag", "work", "chainwork", "processed_at",
+	}
+	transactionColumns = []string{
+		"txid", "block_hash", "block_height", "size", "vsize", "weight", "fee", "fee_rate", "is_coinbase",
+		"input_count", "output_count", "input_value", "output_value", "version", "locktime", "signals_rbf",
+		"timestamp", "processed_at",
+	}
+	priceColumns = []string{"timestamp", "price", "market_cap", "volume_24h", "source", "fetched_at"}
+)
+
+func blockRecord(v any) []string {
+	b := v.(*models.Block)
+	return []string{
+		b.Hash, itoa(b.Height), formatTime(b.Timestamp), itoa(int64(b.Size)), itoa(int64(b.Weight)), itoa(int64(b.TxCount)), itoa(int64(b.FilteredTxCount)),
+		b.PreviousBlockHash, b.MerkleRoot, itoa(int64(b.Nonce)), b.Bits, formatFloat(b.Difficulty),
+		itoa(b.CoinbaseValue), itoa(b.Subsidy), itoa(b.TotalFees), itoa(int64(b.SegwitTxCount)), itoa(b.WitnessSize),
+		b.CoinbaseScript, b.MinerTag, b.Work, b.Chainwork, formatTime(b.ProcessedAt),
+	}
+}
+
+func transactionRecord(v any) []string {
+	tx := v.(*models.Transaction)
+	return []string{
+		tx.Txid, tx.BlockHash, itoa(tx.BlockHeight), itoa(int64(tx.Size)), itoa(int64(tx.VSize)), itoa(int64(tx.Weight)),
+		itoa(tx.Fee), formatFloat(tx.FeeRate), strconv.FormatBool(tx.IsCoinbase),
+		itoa(int64(tx.InputCount)), itoa(int64(tx.OutputCount)), itoa(tx.InputValue), itoa(tx.OutputValue),
+		itoa(int64(tx.Version)), itoa(int64(tx.LockTime)), strconv.FormatBool(tx.SignalsRBF),
+		formatTime(tx.Timestamp), formatTime(tx.ProcessedAt),
+	}
+}
+
+func priceRecord(v any) []string {
+	p := v.(*models.PriceData)
+	return []string{formatTime(p.Timestamp), formatFloat(p.Price), itoa(p.MarketCap), itoa(p.Volume24h), p.Source, formatTime(p.FetchedAt)}
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+func formatFloat(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+func formatTime(t time.Time) string { return t.UTC().Format(time.RFC3339Nano) }
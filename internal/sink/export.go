@@ -0,0 +1,134 @@
+package sink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"slices"
+	"time"
+)
+
+// watermarkLayout formats the watermarks in the names of the files of an
+// IncrementalExport: in UTC, to the microsecond the databases store, and
+// without colons, so the names sort in time order and are valid anywhere.
+const watermarkLayout = "20060102T150405.000000Z"
+
+// IncrementalExport writes the rows of an incremental export, those stored
+// after a watermark, to one file per table in a directory. The files are
+// named after the watermarks they span, e.g.
+// blocks-20240501T000000.000000Z-20240502T093000.250000Z.ndjson, so the
+// same export always gets the same names and replaces its earlier files.
+// They are written under a temporary name and renamed by Close.
+type IncrementalExport struct {
+	dir    string
+	format string
+	since  time.Time
+	files  map[string]*file
+
+	Blocks, Transactions, Prices int64
+}
+
+// The tables of an IncrementalExport, in the order of their files.
+var exportTables = []string{"blocks", "transactions", "price_data"}
+
+// NewIncrementalExport creates the files of the export of the rows stored
+// after since to dir, creating it if needed.
+func NewIncrementalExport(dir, format string, since time.Time) (*IncrementalExport, error) {
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	e := &IncrementalExport{dir: dir, format: format, since: since.UTC(), files: make(map[string]*file)}
+	for _, table := range exportTables {
+		columns, record := blockColumns, blockRecord
+		switch table {
+		case "transactions":
+			columns, record = transactionColumns, transactionRecord
+		case "price_data":
+			columns, record = priceColumns, priceRecord
+		}
+		path := filepath.Join(dir, fmt.Sprintf(".%s-%s.%s.tmp", table, e.since.Format(watermarkLayout), format))
+		f, err := os.Create(path)
+		if err != nil {
+			e.Abort()
+			return nil, fmt.Errorf("failed to create export file: %w", err)
+		}
+		buf := bufio.NewWriter(f)
+		e.files[table] = &file{f: f, buf: buf, enc: newEncoder(format, buf, columns, record)}
+		if err := e.files[table].enc.writeHeader(); err != nil {
+			e.Abort()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *IncrementalExport) WriteBlock(block *models.Block) error {
+	e.Blocks++
+	return e.files["blocks"].enc.encode(block)
+}
+
+func (e *IncrementalExport) WriteTransaction(tx *models.Transaction) error {
+	e.Transactions++
+	return e.files["transactions"].enc.encode(tx)
+}
+
+func (e *IncrementalExport) WritePrice(price *models.PriceData) error {
+	e.Prices++
+	return e.files["price_data"].enc.encode(price)
+}
+
+// Close completes the files and gives them their final names, which end
+// with until, the watermark of the export. Files of an earlier run of the
+// same export are replaced.
+func (e *IncrementalExport) Close(until time.Time) error {
+	var errs []error
+	for _, table := range exportTables {
+		f := e.files[table]
+		if err := f.enc.flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.buf.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		e.remove()
+		return fmt.Errorf("failed to complete export files: %w", err)
+	}
+	for _, table := range exportTables {
+		if err := os.Rename(e.files[table].f.Name(), e.Path(table, until)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Abort closes and deletes the files of an export that failed.
+func (e *IncrementalExport) Abort() {
+	for _, f := range e.files {
+		f.f.Close()
+	}
+	e.remove()
+}
+
+func (e *IncrementalExport) remove() {
+	for _, f := range e.files {
+		os.Remove(f.f.Name())
+	}
+}
+
+// Path returns the final name of the file of table, for an export up to
+// until.
+func (e *IncrementalExport) Path(table string, until time.Time) string {
+	return filepath.Join(e.dir, fmt.Sprintf("%s-%s-%s.%s", table,
+		e.since.Format(watermarkLayout), until.UTC().Format(watermarkLayout), e.format))
+}
@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportOnce writes two blocks and a price point after since to dir.
+func exportOnce(t *testing.T, dir, format string, since, until time.Time) *IncrementalExport {
+	t.Helper()
+	e, err := NewIncrementalExport(dir, format, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := range int64(2) {
+		block, txs := testBlock(height, since.Add(time.Duration(height)*time.Minute))
+		block.ProcessedAt = until
+		if err := e.WriteBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range txs {
+			if err := e.WriteTransaction(tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := e.WritePrice(&models.PriceData{Timestamp: since, Price: 65000.5, Source: "test", FetchedAt: until}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(until); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// TestIncrementalExport exports NDJSON twice with the same watermarks: the
+// second run replaces the files of the first with the same content.
+func TestIncrementalExport(t *testing.T) {
+	dir := t.TempDir()
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 5, 2, 9, 30, 0, 250000000, time.FixedZone("CEST", 2*3600))
+	e := exportOnce(t, dir, FormatNDJSON, since, until)
+	if e.Blocks != 2 || e.Transactions != 4 || e.Prices != 1 {
+		t.Errorf("counts = %d blocks, %d transactions, %d prices, want 2, 4 and 1", e.Blocks, e.Transactions, e.Prices)
+	}
+	want := []string{
+		"blocks-20240501T000000.000000Z-20240502T073000.250000Z.ndjson",
+		"price_data-20240501T000000.000000Z-20240502T073000.250000Z.ndjson",
+		"transactions-20240501T000000.000000Z-20240502T073000.250000Z.ndjson",
+	}
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if got := e.Path("blocks", until); got != filepath.Join(dir, want[0]) {
+		t.Errorf("Path(blocks) = %s, want %s", got, want[0])
+	}
+
+	first := make(map[string][]byte)
+	for _, name := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first[name] = data
+	}
+	lines := strings.Split(strings.TrimSpace(string(first[want[2]])), "\n")
+	var tx models.Transaction
+	if err := json.Unmarshal([]byte(lines[0]), &tx); len(lines) != 4 || err != nil || tx.BlockHeight != 0 || !tx.IsCoinbase {
+		t.Errorf("transactions file = %q, %v, want 4 lines starting with the coinbase of block 0", lines, err)
+	}
+
+	exportOnce(t, dir, FormatNDJSON, since, until)
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("files after the second export = %v, want %v", got, want)
+	}
+	for _, name := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, first[name]) {
+			t.Errorf("%s differs between the exports:\n%s\n%s", name, first[name], data)
+		}
+	}
+}
+
+// TestIncrementalExportEmpty exports nothing to CSV: every table still gets
+// a file, with the header only, spanning the same watermark twice.
+func TestIncrementalExportEmpty(t *testing.T) {
+	dir := t.TempDir()
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, err := NewIncrementalExport(dir, FormatCSV, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(since); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "price_data-20240501T000000.000000Z-20240501T000000.000000Z.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != strings.Join(priceColumns, ",")+"\n" {
+		t.Errorf("empty price_data file = %q, want the header", got)
+	}
+	if got := files(t, dir); len(got) != 3 {
+		t.Errorf("files = %v, want one per table", got)
+	}
+
+	if _, err := NewIncrementalExport(dir, "parquet", since); err == nil {
+		t.Error("NewIncrementalExport(parquet) succeeded")
+	}
+}
@@ -0,0 +1,272 @@
+// Package sink writes the scraped blocks to flat files as a run stores
+// them, next to the database, and the files of incremental exports of the
+// database.
+package sink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Sink receives the blocks a run stores, once they are committed to the
+// database. WriteTransactions writes the transactions of the block passed
+// to the last WriteBlock. Calls must not be concurrent.
+type Sink interface {
+	WriteBlock(block *models.Block) error
+	WriteTransactions(txs []*models.Transaction) error
+	// Flush is called after each stored batch. It writes out what is
+	// buffered, to files that may still be incomplete.
+	Flush() error
+	// Close writes out everything left and completes every open file.
+	Close() error
+}
+
+// Rotation is how the file sink splits blocks into files: Blocks per file,
+// or one file per UTC day of the block timestamps when Daily is set.
+type Rotation struct {
+	Blocks int
+	Daily  bool
+}
+
+// ParseRotation parses "day" or a number of blocks per file.
+func ParseRotation(spec string) (Rotation, error) {
+	if spec == "day" {
+		return Rotation{Daily: true}, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return Rotation{}, fmt.Errorf("invalid rotation %q: expected day or a number of blocks", spec)
+	}
+	return Rotation{Blocks: n}, nil
+}
+
+// FileSink writes blocks and transactions to separate files in a directory,
+// named after the heights or the day they cover, e.g.
+// blocks-800000-800999.csv and transactions-800000-800999.csv. Files are
+// written under a temporary name and renamed once complete, so a file with
+// its final name is never partial.
+//
+// Blocks don't arrive in strict height order, so with daily rotation the
+// two most recent days stay open and older ones are completed. A block that
+// arrives for a day already completed starts a new file for it, with a
+// numbered suffix, as do files whose name is taken by an earlier run.
+type FileSink struct {
+	dir      string
+	format   string
+	rotation Rotation
+	open     map[string]*segment
+	last     *segment
+	newest   time.Time
+	parts    int
+}
+
+// segment is the pair of open files of one rotation period. day is the
+// day it covers with daily rotation, zero otherwise.
+type segment struct {
+	key                  string
+	day                  time.Time
+	blocks, transactions *file
+	fromHeight, toHeight int64
+	count                int
+}
+
+type file struct {
+	f   *os.File
+	buf *bufio.Writer
+	enc encoder
+}
+
+// NewFileSink returns a sink writing format files to dir, creating it if
+// needed.
+func NewFileSink(dir, format string, rotation Rotation) (*FileSink, error) {
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("unknown sink format %q", format)
+	}
+	if rotation.Blocks < 1 && !rotation.Daily {
+		return nil, fmt.Errorf("invalid sink rotation: %+v", rotation)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create sink directory: %w", err)
+	}
+	return &FileSink{dir: dir, format: format, rotation: rotation, open: make(map[string]*segment)}, nil
+}
+
+func (s *FileSink) WriteBlock(block *models.Block) error {
+	seg, err := s.segmentFor(block)
+	if err != nil {
+		return err
+	}
+	s.last = seg
+	if seg.count == 0 || block.Height < seg.fromHeight {
+		seg.fromHeight = block.Height
+	}
+	if seg.count == 0 || block.Height > seg.toHeight {
+		seg.toHeight = block.Height
+	}
+	seg.count++
+	return seg.blocks.enc.encode(block)
+}
+
+func (s *FileSink) WriteTransactions(txs []*models.Transaction) error {
+	if s.last == nil {
+		return fmt.Errorf("no block written before its transactions")
+	}
+	for _, tx := range txs {
+		if err := s.last.transactions.enc.encode(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileSink) Flush() error {
+	var errs []error
+	for _, seg := range s.open {
+		for _, f := range []*file{seg.blocks, seg.transactions} {
+			if err := f.enc.flush(); err != nil {
+				errs = append(errs, err)
+			} else if err := f.buf.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *FileSink) Close() error {
+	keys := make([]string, 0, len(s.open))
+	for key := range s.open {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, s.complete(key))
+	}
+	return errors.Join(errs...)
+}
+
+// segmentFor returns the open segment block goes to, completing the
+// segments it won't get any more blocks.
+func (s *FileSink) segmentFor(block *models.Block) (*segment, error) {
+	var key string
+	var day time.Time
+	if s.rotation.Daily {
+		day = block.Timestamp.UTC().Truncate(24 * time.Hour)
+		if day.After(s.newest) {
+			s.newest = day
+			for key, seg := range s.open {
+				if day.Sub(seg.day) > 24*time.Hour {
+					if err := s.complete(key); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		key = day.Format("2006-01-02")
+	} else {
+		key = "part-" + strconv.Itoa(s.parts)
+		if seg, ok := s.open[key]; ok && seg.count >= s.rotation.Blocks {
+			if err := s.complete(key); err != nil {
+				return nil, err
+			}
+			s.parts++
+			key = "part-" + strconv.Itoa(s.parts)
+		}
+	}
+
+	if seg, ok := s.open[key]; ok {
+		return seg, nil
+	}
+	seg := &segment{key: key, day: day}
+	var err error
+	if seg.blocks, err = s.create("blocks", key, blockColumns, blockRecord); err != nil {
+		return nil, err
+	}
+	if seg.transactions, err = s.create("transactions", key, transactionColumns, transactionRecord); err != nil {
+		seg.blocks.f.Close()
+		os.Remove(seg.blocks.f.Name())
+		return nil, err
+	}
+	s.open[key] = seg
+	return seg, nil
+}
+
+// create opens the temporary file of kind for the segment key and writes
+// the header of the format.
+func (s *FileSink) create(kind, key string, columns []string, record func(v any) []string) (*file, error) {
+	path := filepath.Join(s.dir, fmt.Sprintf(".%s-%s.%s.tmp", kind, key, s.format))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sink file: %w", err)
+	}
+	buf := bufio.NewWriter(f)
+	enc := newEncoder(s.format, buf, columns, record)
+	if err := enc.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &file{f: f, buf: buf, enc: enc}, nil
+}
+
+// complete closes the files of the segment key and renames them to their
+// final names. The segment is dropped even if that fails.
+func (s *FileSink) complete(key string) error {
+	seg := s.open[key]
+	delete(s.open, key)
+	if s.last == seg {
+		s.last = nil
+	}
+
+	var errs []error
+	for _, f := range []*file{seg.blocks, seg.transactions} {
+		if err := f.enc.flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.buf.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := f.f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to complete sink files of %s: %w", seg.name(), err)
+	}
+
+	name := seg.name()
+	for n := 2; s.exists("blocks", name) || s.exists("transactions", name); n++ {
+		name = seg.name() + "." + strconv.Itoa(n)
+	}
+	for kind, f := range map[string]*file{"blocks": seg.blocks, "transactions": seg.transactions} {
+		if err := os.Rename(f.f.Name(), s.path(kind, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// name is the part of the file names of the segment after the kind: its
+// day with daily rotation, otherwise the range of heights it holds.
+func (seg *segment) name() string {
+	if !seg.day.IsZero() {
+		return seg.day.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%d-%d", seg.fromHeight, seg.toHeight)
+}
+
+func (s *FileSink) path(kind, name string) string {
+	return filepath.Join(s.dir, kind+"-"+name+"."+s.format)
+}
+
+func (s *FileSink) exists(kind, name string) bool {
+	_, err := os.Stat(s.path(kind, name))
+	return err == nil
+}
@@ -0,0 +1,183 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"scrapbtc/pkg/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testBlock(height int64, timestamp time.Time) (*models.Block, []*models.Transaction) {
+	block := &models.Block{Hash: fmt.Sprintf("%064x", height), Height: height, Timestamp: timestamp, TxCount: 2, Difficulty: 1.5}
+	var txs []*models.Transaction
+	for i := range 2 {
+		txs = append(txs, &models.Transaction{
+			Txid: fmt.Sprintf("%060x%04x", height, i), BlockHash: block.Hash, BlockHeight: height,
+			IsCoinbase: i == 0, FeeRate: 12.25, Timestamp: timestamp,
+		})
+	}
+	return block, txs
+}
+
+func write(t *testing.T, s Sink, height int64, timestamp time.Time) {
+	t.Helper()
+	block, txs := testBlock(height, timestamp)
+	if err := s.WriteBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteTransactions(txs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// files returns the names of the complete files in dir.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if name := e.Name(); name[0] != '.' {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TestFileSinkBlocks writes blocks out of order with two blocks per file.
+// A file only gets its final name once it has all its blocks, and the CSV
+// has a header and a row per block or transaction.
+func TestFileSinkBlocks(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSink(dir, FormatCSV, Rotation{Blocks: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	write(t, s, 11, start)
+	write(t, s, 10, start)
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("complete files before the third block = %v, want none", got)
+	}
+	write(t, s, 12, start)
+	want := []string{"blocks-10-11.csv", "transactions-10-11.csv"}
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Errorf("complete files after the third block = %v, want %v", got, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"blocks-10-11.csv", "blocks-12-12.csv", "transactions-10-11.csv", "transactions-12-12.csv"}
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Errorf("complete files after Close = %v, want %v", got, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "blocks-10-11.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || !slices.Equal(records[0], blockColumns) {
+		t.Fatalf("blocks-10-11.csv has %d records starting with %v, want the header and 2 blocks", len(records), records[0])
+	}
+	if r := records[1]; r[1] != "11" || r[2] != "2024-03-01T00:00:00Z" || r[11] != "1.5" {
+		t.Errorf("block row = %v", r)
+	}
+
+	f, err = os.Open(filepath.Join(dir, "transactions-12-12.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err = csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][7] != "12.25" || records[1][8] != "true" || records[2][8] != "false" {
+		t.Errorf("transactions-12-12.csv = %v, want the header and 2 transactions", records)
+	}
+}
+
+// TestFileSinkDaily writes NDJSON per day. A day is completed once a block
+// two days later arrives, and a late block for it goes to a second file.
+func TestFileSinkDaily(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSink(dir, FormatNDJSON, Rotation{Daily: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 23, 50, 0, 0, time.UTC) }
+	write(t, s, 1, day(1))
+	write(t, s, 3, day(2))
+	write(t, s, 2, day(1))
+	if got := files(t, dir); len(got) != 0 {
+		t.Errorf("complete files with two days open = %v, want none", got)
+	}
+	write(t, s, 4, day(3))
+	want := []string{"blocks-2024-03-01.ndjson", "transactions-2024-03-01.ndjson"}
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Errorf("complete files on the third day = %v, want %v", got, want)
+	}
+	write(t, s, 0, day(1))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"blocks-2024-03-01.2.ndjson", "blocks-2024-03-01.ndjson", "blocks-2024-03-02.ndjson", "blocks-2024-03-03.ndjson",
+		"transactions-2024-03-01.2.ndjson", "transactions-2024-03-01.ndjson", "transactions-2024-03-02.ndjson", "transactions-2024-03-03.ndjson",
+	}
+	if got := files(t, dir); !slices.Equal(got, want) {
+		t.Errorf("complete files after Close = %v, want %v", got, want)
+	}
+
+	for name, heights := range map[string][]int64{
+		"blocks-2024-03-01.ndjson":   {1, 2},
+		"blocks-2024-03-01.2.ndjson": {0},
+	} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var got []int64
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var block models.Block
+			if err := json.Unmarshal(scanner.Bytes(), &block); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, block.Height)
+		}
+		if !slices.Equal(got, heights) {
+			t.Errorf("%s has blocks %v, want %v", name, got, heights)
+		}
+	}
+}
+
+func TestParseRotation(t *testing.T) {
+	for spec, want := range map[string]Rotation{"day": {Daily: true}, "500": {Blocks: 500}} {
+		if got, err := ParseRotation(spec); err != nil || got != want {
+			t.Errorf("ParseRotation(%q) = %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"", "0", "-1", "week"} {
+		if _, err := ParseRotation(spec); err == nil {
+			t.Errorf("ParseRotation(%q) succeeded", spec)
+		}
+	}
+}
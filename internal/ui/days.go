@@ -0,0 +1,85 @@
+package ui
+
+import (
+	"fmt"
+	"scrapbtc/pkg/models"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// DayStatus is a day of a --by-day run and the number of its blocks stored
+// so far.
+type DayStatus struct {
+	Range *models.DayRange
+	Done  int64
+}
+
+// dayProgress counts the completed blocks of each day of a --by-day run.
+type dayProgress struct {
+	days     []DayStatus
+	complete int
+}
+
+// newDayProgress returns the progress of days, ordered by height, or nil
+// without days.
+func newDayProgress(days []DayStatus) *dayProgress {
+	if len(days) == 0 {
+		return nil
+	}
+	p := &dayProgress{days: append([]DayStatus(nil), days...)}
+	for _, d := range p.days {
+		if d.Done >= d.Range.Blocks() {
+			p.complete++
+		}
+	}
+	return p
+}
+
+// add counts a completed block and returns its day if the block completed
+// it.
+func (p *dayProgress) add(height int64) *models.DayRange {
+	i := sort.Search(len(p.days), func(i int) bool { return p.days[i].Range.ToHeight >= height })
+	if i == len(p.days) || p.days[i].Range.FromHeight > height {
+		return nil
+	}
+	d := &p.days[i]
+	d.Done++
+	if d.Done != d.Range.Blocks() {
+		return nil
+	}
+	p.complete++
+	return d.Range
+}
+
+// current returns the first day that isn't complete and the percentage of
+// its blocks done, or nil once every day is.
+func (p *dayProgress) current() (*models.DayRange, float64) {
+	for _, d := range p.days {
+		if d.Done < d.Range.Blocks() {
+			return d.Range, float64(d.Done) / float64(d.Range.Blocks()) * 100
+		}
+	}
+	return nil, 100
+}
+
+// summary describes the days complete and the current day, e.g.
+// "12/31 days complete, current day 2024-03-13 at 43%".
+func (p *dayProgress) summary() string {
+	s := fmt.Sprintf("%d/%d days complete", p.complete, len(p.days))
+	if day, pct := p.current(); day != nil {
+		s += fmt.Sprintf(", current day %s at %.0f%%", day.Day.Format("2006-01-02"), pct)
+	}
+	return s
+}
+
+// renderBar draws the complete days in green and the others in grey.
+func (p *dayProgress) renderBar() string {
+	width := 50
+	done := p.complete * width / len(p.days)
+	doneStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	remainingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	bar := doneStyle.Render(strings.Repeat("█", done)) + remainingStyle.Render(strings.Repeat("░", width-done))
+	return "[" + bar + "] " + p.summary()
+}
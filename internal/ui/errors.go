@@ -0,0 +1,183 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxFailures bounds the failures kept for the error browser; older ones are
+// only counted, their error is still in processing_status.error_message.
+const maxFailures = 1000
+
+// failure is a block that failed during this run.
+type failure struct {
+	height int64
+	at     time.Time
+	err    string
+}
+
+// errorBrowser is the scrollable list of failures shown with 'e'.
+type errorBrowser struct {
+	open     bool
+	cursor   int
+	selected map[int64]bool
+	// message reports the result of the last write.
+	message string
+}
+
+// addFailure records a failure for the error browser.
+func (m *ProgressModel) addFailure(height int64, err string) {
+	m.failures = append(m.failures, failure{height: height, at: time.Now(), err: err})
+	if len(m.failures) > maxFailures {
+		m.failures = m.failures[1:]
+		m.droppedFailures++
+		if m.browser.cursor > 0 {
+			m.browser.cursor--
+		}
+	}
+}
+
+// updateErrorBrowser handles a key while the error browser is open.
+func (m ProgressModel) updateErrorBrowser(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	b := &m.browser
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "e", "esc":
+		b.open = false
+	case "up", "k":
+		if b.cursor > 0 {
+			b.cursor--
+		}
+	case "down", "j":
+		if b.cursor < len(m.failures)-1 {
+			b.cursor++
+		}
+	case "pgup":
+		b.cursor = max(b.cursor-10, 0)
+	case "pgdown":
+		b.cursor = max(min(b.cursor+10, len(m.failures)-1), 0)
+	case "home", "g":
+		b.cursor = 0
+	case "end", "G":
+		b.cursor = max(len(m.failures)-1, 0)
+	case " ":
+		if len(m.failures) > 0 {
+			h := m.failures[b.cursor].height
+			b.selected[h] = !b.selected[h]
+		}
+	case "w":
+		b.message = m.writeFailedHeights()
+	}
+	return m, nil
+}
+
+// writeFailedHeights writes the selected heights, or all failed heights when
+// none are selected, to a file for --heights-file and returns a message
+// with the re-run command.
+func (m ProgressModel) writeFailedHeights() string {
+	var heights []int64
+	for h, ok := range m.browser.selected {
+		if ok {
+			heights = append(heights, h)
+		}
+	}
+	if len(heights) == 0 {
+		for _, f := range m.failures {
+			heights = append(heights, f.height)
+		}
+	}
+	if len(heights) == 0 {
+		return "No failed blocks to write"
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	path := fmt.Sprintf("failed-heights-%s.txt", time.Now().Format("20060102-150405"))
+	var b strings.Builder
+	for _, h := range heights {
+		fmt.Fprintf(&b, "%d\n", h)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Sprintf("Failed to write %s: %v", path, err)
+	}
+	return fmt.Sprintf("Wrote %d heights to %s, re-run them with: scrapbtc --heights-file %s", len(heights), path, path)
+}
+
+// errorBrowserView renders the failures around the cursor, with the full
+// error text wrapped to the terminal width.
+func (m ProgressModel) errorBrowserView() string {
+	width, height := m.width, m.height
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 24
+	}
+
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("1"))
+	cursorStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("6"))
+	textStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("7")).Width(width - 1).PaddingLeft(4)
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+
+	title := fmt.Sprintf("Failed blocks: %d", m.failedBlocks)
+	if m.droppedFailures > 0 {
+		title += fmt.Sprintf(" (oldest %d not shown, see 'scrapbtc status')", m.droppedFailures)
+	}
+	help := helpStyle.Render("↑/↓ move • space select • w write heights for --heights-file • e/esc back • q quit")
+	footer := help
+	if m.browser.message != "" {
+		footer = m.browser.message + "\n" + help
+	}
+
+	if len(m.failures) == 0 {
+		return headerStyle.Render(title) + "\n\nNo failures in this run.\n\n" + footer
+	}
+
+	// Render entries from the cursor on, then fill any room left above it,
+	// so the selected entry is always visible.
+	room := height - 3 - lipgloss.Height(footer)
+	render := func(i int) string {
+		f := m.failures[i]
+		mark := "  "
+		if m.browser.selected[f.height] {
+			mark = "✓ "
+		}
+		line := fmt.Sprintf("%sBlock %d  [%s]", mark, f.height, f.at.Format("15:04:05"))
+		if i == m.browser.cursor {
+			line = cursorStyle.Render("▶ " + line)
+		} else {
+			line = "  " + line
+		}
+		return line + "\n" + textStyle.Render(f.err)
+	}
+
+	var below []string
+	used := 0
+	for i := m.browser.cursor; i < len(m.failures); i++ {
+		entry := render(i)
+		h := lipgloss.Height(entry)
+		if used+h > room && len(below) > 0 {
+			break
+		}
+		below = append(below, entry)
+		used += h
+	}
+	var above []string
+	for i := m.browser.cursor - 1; i >= 0; i-- {
+		entry := render(i)
+		h := lipgloss.Height(entry)
+		if used+h > room {
+			break
+		}
+		above = append([]string{entry}, above...)
+		used += h
+	}
+
+	return headerStyle.Render(title) + "\n\n" + strings.Join(append(above, below...), "\n") + "\n\n" + footer
+}
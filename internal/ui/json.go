@@ -0,0 +1,261 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"scrapbtc/internal/processor"
+)
+
+// jsonSummaryInterval is how often a "summary" event is written in JSON
+// progress mode.
+const jsonSummaryInterval = 5 * time.Second
+
+// ProgressEvent is one line of JSON progress output. Event tells the kind of
+// object:
+//
+//	start    written once before any block, with the range and total
+//	update   one per processor.ProgressUpdate, with Status and the update's fields;
+//	         "tip" updates in follow mode carry the new end height
+//	summary  written every few seconds with the counts, rates, ETA and hash cache hits
+//	day      written in --by-day runs when a day's last block completes, with
+//	         the day, its range and the days complete so far
+//	done     written once at the end with the final counts and failed heights,
+//	         and the tail of a run that stored all its blocks
+//
+// Fields that don't apply to an event are omitted. New fields may be added,
+// but existing ones keep their name and meaning.
+type ProgressEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+
+	// start, done and tip updates
+	StartHeight *int64 `json:"start_height,omitempty"`
+	EndHeight   *int64 `json:"end_height,omitempty"`
+	Database    string `json:"database,omitempty"`
+
+	// update
+	Status          string `json:"status,omitempty"`
+	Height          *int64 `json:"height,omitempty"`
+	TxCount         int    `json:"tx_count,omitempty"`
+	Error           string `json:"error,omitempty"`
+	Warning         string `json:"warning,omitempty"`
+	Debug           string `json:"debug,omitempty"`
+	Chunk           int    `json:"chunk,omitempty"`
+	Chunks          int    `json:"chunks,omitempty"`
+	InflightBytes   int64  `json:"inflight_bytes,omitempty"`
+	InflightLimit   int64  `json:"inflight_limit,omitempty"`
+	Fetchers        int    `json:"fetchers,omitempty"`
+	DBSize          int64  `json:"db_size,omitempty"`
+	DBSizeProjected int64  `json:"db_size_projected,omitempty"`
+	FlushBlocks     int    `json:"flush_blocks,omitempty"`
+	FlushRows       int    `json:"flush_rows,omitempty"`
+	FlushMillis     int64  `json:"flush_ms,omitempty"`
+
+	// start, summary and done
+	TotalBlocks *int64 `json:"total_blocks,omitempty"`
+
+	// day, and start, summary and done in --by-day runs
+	Day          string `json:"day,omitempty"`
+	DaysComplete *int   `json:"days_complete,omitempty"`
+	TotalDays    *int   `json:"total_days,omitempty"`
+
+	// summary and done
+	ProcessedBlocks *int64   `json:"processed_blocks,omitempty"`
+	FailedBlocks    *int64   `json:"failed_blocks,omitempty"`
+	TotalTxs        *int64   `json:"total_txs,omitempty"`
+	ElapsedSeconds  *float64 `json:"elapsed_seconds,omitempty"`
+	BlocksPerSecond *float64 `json:"blocks_per_second,omitempty"`
+	TxsPerSecond    *float64 `json:"txs_per_second,omitempty"`
+	// ETASeconds is omitted until a block has been processed.
+	ETASeconds      *float64 `json:"eta_seconds,omitempty"`
+	FailedHeights   []int64  `json:"failed_heights,omitempty"`
+	HashCacheHits   uint64   `json:"hash_cache_hits,omitempty"`
+	HashCacheMisses uint64   `json:"hash_cache_misses,omitempty"`
+
+	// tail updates and done, once every block is stored
+	TailSeconds *float64 `json:"tail_seconds,omitempty"`
+	Schedule    string   `json:"schedule,omitempty"`
+}
+
+// blockStatuses are the update statuses that refer to a single block, so
+// their events carry its height.
+var blockStatuses = map[string]bool{
+	"processing":              true,
+	"processing_transactions": true,
+	"completed":               true,
+	"failed":                  true,
+	"interrupted":             true,
+	"chain_break":             true,
+}
+
+// jsonProgress tracks the counts behind the summary events.
+type jsonProgress struct {
+	enc         *json.Encoder
+	startTime   time.Time
+	pause       pauseClock
+	totalBlocks int64
+	endHeight   int64
+	processed   int64
+	failed      int64
+	totalTxs    int64
+	failedAt    []int64
+	cacheHits   uint64
+	cacheMisses uint64
+	tail        *processor.ProgressUpdate
+	days        *dayProgress
+}
+
+// write encodes one event. json.Encoder issues a single Write per event and
+// os.Stdout is unbuffered, so every line reaches a pipe as soon as it is
+// written.
+func (p *jsonProgress) write(e ProgressEvent) {
+	e.Time = time.Now().UTC()
+	if err := p.enc.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to write progress event: %v\n", err)
+	}
+}
+
+// counts fills in the counts, rates and ETA of a summary or done event.
+func (p *jsonProgress) counts(e *ProgressEvent) {
+	elapsed := p.pause.elapsed(p.startTime).Seconds()
+	var blockRate, txRate float64
+	if elapsed > 0 {
+		blockRate = float64(p.processed) / elapsed
+		txRate = float64(p.totalTxs) / elapsed
+	}
+	e.TotalBlocks = &p.totalBlocks
+	e.ProcessedBlocks = &p.processed
+	e.FailedBlocks = &p.failed
+	e.TotalTxs = &p.totalTxs
+	e.ElapsedSeconds = &elapsed
+	e.BlocksPerSecond = &blockRate
+	e.TxsPerSecond = &txRate
+	e.HashCacheHits, e.HashCacheMisses = p.cacheHits, p.cacheMisses
+	if e.Event == "done" && p.tail != nil {
+		tail := p.tail.Tail.Seconds()
+		e.TailSeconds, e.Schedule = &tail, string(p.tail.Schedule)
+	}
+	p.dayCounts(e)
+	if blockRate > 0 {
+		eta := float64(p.totalBlocks-p.processed-p.failed) / blockRate
+		if eta < 0 {
+			eta = 0
+		}
+		e.ETASeconds = &eta
+	}
+}
+
+// dayCounts fills in the days complete of a --by-day run.
+func (p *jsonProgress) dayCounts(e *ProgressEvent) {
+	if p.days == nil {
+		return
+	}
+	complete, total := p.days.complete, len(p.days.days)
+	e.DaysComplete, e.TotalDays = &complete, &total
+}
+
+func (p *jsonProgress) update(u processor.ProgressUpdate) {
+	p.pause.update(u.Status)
+	p.cacheHits, p.cacheMisses = u.HashCacheHits, u.HashCacheMisses
+	e := ProgressEvent{
+		Event:           "update",
+		Status:          u.Status,
+		TxCount:         u.TxCount,
+		Warning:         u.Warning,
+		Debug:           u.DebugMsg,
+		Chunk:           u.Chunk,
+		Chunks:          u.Chunks,
+		InflightBytes:   u.InflightBytes,
+		InflightLimit:   u.InflightLimit,
+		Fetchers:        u.Fetchers,
+		DBSize:          u.DBSize,
+		DBSizeProjected: u.DBSizeProjected,
+		FlushBlocks:     u.FlushBlocks,
+		FlushRows:       u.FlushRows,
+		FlushMillis:     u.FlushDuration.Milliseconds(),
+	}
+	if u.Error != nil {
+		e.Error = u.Error.Error()
+		p.failed++
+		p.failedAt = append(p.failedAt, u.BlockHeight)
+	}
+	if blockStatuses[u.Status] || u.Error != nil {
+		height := u.BlockHeight
+		e.Height = &height
+	}
+	if u.Error == nil && u.Status == "completed" {
+		p.processed++
+		p.totalTxs += int64(u.TxCount)
+	}
+	var day *ProgressEvent
+	if u.Error == nil && u.Status == "completed" && p.days != nil {
+		if d := p.days.add(u.BlockHeight); d != nil {
+			day = &ProgressEvent{Event: "day", Day: d.Day.Format("2006-01-02"), StartHeight: &d.FromHeight, EndHeight: &d.ToHeight}
+			p.dayCounts(day)
+		}
+	}
+	if u.Status == "tail" {
+		p.tail = &u
+		tail := u.Tail.Seconds()
+		e.TailSeconds, e.Schedule = &tail, string(u.Schedule)
+	}
+	if u.Status == "tip" && u.EndHeight > p.endHeight {
+		p.totalBlocks += u.EndHeight - p.endHeight
+		p.endHeight = u.EndHeight
+		e.EndHeight = &u.EndHeight
+	}
+	p.write(e)
+	if day != nil {
+		p.write(*day)
+	}
+}
+
+// runJSONProgress writes a ProgressEvent per line to out until progressChan
+// is closed. Warnings and errors are also printed to stderr for whoever
+// watches the run.
+func runJSONProgress(ctx context.Context, out io.Writer, startHeight, endHeight, totalBlocks int64, dbPath string, days []DayStatus, progressChan <-chan processor.ProgressUpdate) error {
+	p := &jsonProgress{enc: json.NewEncoder(out), startTime: time.Now(), totalBlocks: totalBlocks, endHeight: endHeight, days: newDayProgress(days)}
+	start := ProgressEvent{Event: "start", StartHeight: &startHeight, EndHeight: &endHeight, TotalBlocks: &totalBlocks, Database: dbPath}
+	p.dayCounts(&start)
+	p.write(start)
+
+	ticker := time.NewTicker(jsonSummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case update, ok := <-progressChan:
+			if !ok {
+				sort.Slice(p.failedAt, func(i, j int) bool { return p.failedAt[i] < p.failedAt[j] })
+				e := ProgressEvent{Event: "done", StartHeight: &startHeight, EndHeight: &p.endHeight, Database: dbPath, FailedHeights: p.failedAt}
+				p.counts(&e)
+				p.write(e)
+				if len(p.failedAt) > 0 {
+					fmt.Fprintf(os.Stderr, "Failed block heights: %s\n", formatHeights(p.failedAt))
+				}
+				return nil
+			}
+
+			p.update(update)
+			if update.Warning != "" {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", update.Warning)
+			}
+			if update.Error != nil {
+				fmt.Fprintf(os.Stderr, "Error processing block %d: %s\n", update.BlockHeight, update.Error.Error())
+			}
+
+		case <-ticker.C:
+			e := ProgressEvent{Event: "summary"}
+			p.counts(&e)
+			p.write(e)
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// statusInterval is how often line output redraws its status line.
+const statusInterval = 250 * time.Millisecond
+
+// console writes plain progress to a file, flushing after every message so
+// nothing is held back when it is a pipe. With line set it also keeps a
+// status line below the messages, rewritten in place with a carriage
+// return: messages clear it before they are written and it is drawn again
+// on the next redraw. It uses no escape sequences, so a dumb terminal
+// shows it as well.
+type console struct {
+	out  *bufio.Writer
+	fd   int
+	line bool
+	// shown is the width of the status line on screen, 0 without one.
+	shown int
+}
+
+func newConsole(f *os.File, line bool) *console {
+	return &console{out: bufio.NewWriter(f), fd: int(f.Fd()), line: line}
+}
+
+func (c *console) printf(format string, args ...any) {
+	c.clear()
+	fmt.Fprintf(c.out, format, args...)
+	c.out.Flush()
+}
+
+func (c *console) println(s string) {
+	c.printf("%s\n", s)
+}
+
+// status draws s as the status line. It is cut to the width of the
+// terminal, since a wrapped line can't be rewritten with a carriage return.
+func (c *console) status(s string) {
+	if !c.line {
+		return
+	}
+	if width := c.width() - 1; utf8.RuneCountInString(s) > width {
+		s = string([]rune(s)[:max(width, 0)])
+	}
+	n := utf8.RuneCountInString(s)
+	c.out.WriteString("\r" + s)
+	if c.shown > n {
+		c.out.WriteString(strings.Repeat(" ", c.shown-n))
+	}
+	c.shown = n
+	c.out.Flush()
+}
+
+// clear blanks the status line and returns to its start.
+func (c *console) clear() {
+	if c.shown == 0 {
+		return
+	}
+	c.out.WriteString("\r" + strings.Repeat(" ", c.shown) + "\r")
+	c.shown = 0
+}
+
+// finish leaves the status line as it is and moves below it, so whatever is
+// written next doesn't overwrite it.
+func (c *console) finish() {
+	if c.shown > 0 {
+		c.out.WriteString("\n")
+		c.shown = 0
+	}
+	c.out.Flush()
+}
+
+// width returns the width of the terminal, asked on every redraw instead of
+// following SIGWINCH, or $COLUMNS, or 80 when neither is known.
+func (c *console) width() int {
+	if width, _, err := term.GetSize(c.fd); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// isCharDevice reports whether f is a character device, such as a terminal
+// without the capabilities the TUI needs, rather than a pipe or a file.
+func isCharDevice(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -5,112 +5,294 @@ import (
 	"fmt"
 	"os"
 	"scrapbtc/internal/processor"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
 )
 
+// Mode selects how progress is displayed.
+type Mode int
+
+const (
+	// ModeAuto uses the TUI when stdout is a terminal that supports it,
+	// line output when it is another character device, such as a dumb
+	// terminal, and plain output for pipes and files.
+	ModeAuto Mode = iota
+	// ModeTUI always uses the bubbletea interface.
+	ModeTUI
+	// ModePlain always uses line-by-line console output.
+	ModePlain
+	// ModeJSON writes a ProgressEvent per line to stdout instead of
+	// human-readable progress.
+	ModeJSON
+	// ModeLine prints the messages of plain output but keeps the progress
+	// on a single status line, rewritten in place.
+	ModeLine
+	// ModeNoTUI chooses between line and plain output like ModeAuto.
+	ModeNoTUI
+)
+
+// DefaultFailThreshold is the failure percentage above which the TUI warns
+// about failed blocks.
+const DefaultFailThreshold = 5.0
+
+// Options configures the progress display.
+type Options struct {
+	Mode Mode
+	// FailThreshold is the percentage of attempted blocks that may fail
+	// before the TUI header turns red and suggests retrying them.
+	FailThreshold float64
+	// Pauser, if set, is paused and resumed with the 'p' key.
+	Pauser Pauser
+	// Days, if set, are the days of a --by-day run, ordered by height,
+	// whose progress is shown above the blocks'.
+	Days []DayStatus
+}
+
+// Pauser pauses and resumes the work whose progress is shown.
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// pauseClock tracks the time spent paused, which the elapsed time and ETA
+// leave out. It follows the "paused" and "resumed" updates.
+type pauseClock struct {
+	pausedAt  time.Time
+	pausedFor time.Duration
+}
+
+func (c *pauseClock) update(status string) {
+	switch status {
+	case "paused":
+		if c.pausedAt.IsZero() {
+			c.pausedAt = time.Now()
+		}
+	case "resumed":
+		if !c.pausedAt.IsZero() {
+			c.pausedFor += time.Since(c.pausedAt)
+			c.pausedAt = time.Time{}
+		}
+	}
+}
+
+func (c pauseClock) paused() bool {
+	return !c.pausedAt.IsZero()
+}
+
+// elapsed returns the time since start that wasn't spent paused.
+func (c pauseClock) elapsed(start time.Time) time.Duration {
+	d := time.Since(start) - c.pausedFor
+	if c.paused() {
+		d -= time.Since(c.pausedAt)
+	}
+	return d
+}
+
 type ProgressModel struct {
-	startHeight     int64
-	endHeight       int64
-	currentHeight   int64
+	startHeight   int64
+	endHeight     int64
+	currentHeight int64
+	// minDone and maxDone are the lowest and highest completed heights, which
+	// stay meaningful whatever order blocks are processed in.
+	minDone         int64
+	maxDone         int64
 	totalBlocks     int64
 	processedBlocks int64
 	failedBlocks    int64
+	failedHeights   []int64
 	totalTxs        int64
 	currentBlockTxs int
+	chunk           int
+	chunks          int
+	inflightBytes   int64
+	inflightLimit   int64
+	fetchers        int
+	cacheHits       uint64
+	cacheMisses     uint64
+	// tail is the "tail" update sent once every block is stored.
+	tail processor.ProgressUpdate
+	// optimizing describes the final optimize phase once it has started.
+	optimizing      string
+	dbSize          int64
+	dbSizeProjected int64
+	warnings        int64
+	flushes         int64
+	lastFlush       processor.ProgressUpdate
 	startTime       time.Time
 	lastUpdate      time.Time
 	status          string
 	errors          []string
+	failures        []failure
+	droppedFailures int64
+	browser         errorBrowser
+	width           int
+	height          int
 	debugLogs       []string
 	progressChan    <-chan processor.ProgressUpdate
+	pending         *updateBuffer
+	dbPath          string
+	failThreshold   float64
+	pauser          Pauser
+	pause           pauseClock
+	days            *dayProgress
 	done            bool
+	completed       bool
+	// nodeDown is set while the node is unavailable and the client waits
+	// for it to come back.
+	nodeDown bool
 }
 
 type ProgressMsg processor.ProgressUpdate
-type tickMsg struct{}
 
-func NewProgressModel(startHeight, endHeight int64, progressChan <-chan processor.ProgressUpdate) ProgressModel {
+// frameInterval is how often the TUI applies the updates received since
+// the last frame and redraws. Redrawing for every update costs a fast run
+// more CPU than the work it displays.
+const frameInterval = 100 * time.Millisecond
+
+// frameMsg is sent every frameInterval to apply the pending updates.
+type frameMsg struct{}
+
+// updateBuffer holds the updates received between two frames. It is
+// shared by the model copies, so it is only ever used through a pointer.
+type updateBuffer struct {
+	mu      sync.Mutex
+	updates []processor.ProgressUpdate
+	closed  bool
+}
+
+func (b *updateBuffer) add(update processor.ProgressUpdate) {
+	b.mu.Lock()
+	b.updates = append(b.updates, update)
+	b.mu.Unlock()
+}
+
+func (b *updateBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+}
+
+// take returns the pending updates and whether the progress channel has
+// been closed after them.
+func (b *updateBuffer) take() ([]processor.ProgressUpdate, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	updates := b.updates
+	b.updates = nil
+	return updates, b.closed
+}
+
+// NewProgressModel returns a model for processing totalBlocks blocks
+// between startHeight and endHeight.
+func NewProgressModel(startHeight, endHeight, totalBlocks int64, dbPath string, opts Options, progressChan <-chan processor.ProgressUpdate) ProgressModel {
 	return ProgressModel{
 		startHeight:   startHeight,
 		endHeight:     endHeight,
-		totalBlocks:   endHeight - startHeight + 1,
+		totalBlocks:   totalBlocks,
+		failThreshold: opts.FailThreshold,
+		pauser:        opts.Pauser,
+		days:          newDayProgress(opts.Days),
 		startTime:     time.Now(),
 		lastUpdate:    time.Now(),
 		status:        "Starting...",
 		progressChan:  progressChan,
+		pending:       &updateBuffer{},
+		dbPath:        dbPath,
 		errors:        make([]string, 0),
+		browser:       errorBrowser{selected: make(map[int64]bool)},
 		debugLogs:     make([]string, 0),
 	}
 }
 
+// Summary returns the final statistics of the run shown by the model.
+func (m ProgressModel) Summary() RunSummary {
+	failed := append([]int64(nil), m.failedHeights...)
+	sort.Slice(failed, func(i, j int) bool { return failed[i] < failed[j] })
+	return RunSummary{
+		TotalBlocks:     m.totalBlocks,
+		ProcessedBlocks: m.processedBlocks,
+		FailedBlocks:    m.failedBlocks,
+		FailedHeights:   failed,
+		TotalTxs:        m.totalTxs,
+		Elapsed:         m.pause.elapsed(m.startTime),
+		DatabasePath:    m.dbPath,
+		HashCacheHits:   m.cacheHits,
+		HashCacheMisses: m.cacheMisses,
+		Tail:            m.tail.Tail,
+		Schedule:        m.tail.Schedule,
+	}
+}
+
 func (m ProgressModel) Init() tea.Cmd {
-	return m.waitForActivity()
+	return tea.Batch(m.collect(), nextFrame())
 }
 
-func (m *ProgressModel) waitForActivity() tea.Cmd {
+// collect moves the updates from the progress channel into the pending
+// buffer until the channel is closed.
+func (m ProgressModel) collect() tea.Cmd {
 	return func() tea.Msg {
-		select {
-		case update, ok := <-m.progressChan:
-			if !ok {
-				return tea.Quit()
-			}
-			return ProgressMsg(update)
-		case <-time.After(100 * time.Millisecond):
-			// Return a custom tick message to keep the UI updating
-			return tickMsg{}
+		for update := range m.progressChan {
+			m.pending.add(update)
 		}
+		m.pending.close()
+		return nil
 	}
 }
 
+func nextFrame() tea.Cmd {
+	return tea.Tick(frameInterval, func(time.Time) tea.Msg { return frameMsg{} })
+}
+
 func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		if msg.String() == "ctrl+c" || msg.String() == "q" {
+		if m.browser.open {
+			return m.updateErrorBrowser(msg)
+		}
+		switch msg.String() {
+		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "e":
+			m.browser.open = true
+		case "p":
+			if m.pauser != nil {
+				if m.pauser.Paused() {
+					m.pauser.Resume()
+				} else {
+					m.pauser.Pause()
+				}
+			}
 		}
 
-	case tickMsg:
-		// Just continue waiting for activity
-		return m, m.waitForActivity()
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
 
-	case ProgressMsg:
-		m.lastUpdate = time.Now()
-		
-		// Handle debug messages
-		if msg.DebugMsg != "" {
-			m.debugLogs = append(m.debugLogs, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg.DebugMsg))
-			if len(m.debugLogs) > 10 {
-				m.debugLogs = m.debugLogs[1:]
+	case frameMsg:
+		updates, closed := m.pending.take()
+		for _, update := range updates {
+			if m.apply(update) {
+				return m, tea.Quit
 			}
 		}
-		
-		if msg.Error != nil {
-			m.failedBlocks++
-			m.errors = append(m.errors, fmt.Sprintf("Block %d: %s", msg.BlockHeight, msg.Error.Error()))
-			if len(m.errors) > 5 {
-				m.errors = m.errors[1:]
-			}
-		} else if msg.Status == "completed" {
-			m.processedBlocks++
-			m.totalTxs += int64(msg.TxCount)
-			m.currentHeight = msg.BlockHeight
-			m.currentBlockTxs = msg.TxCount
-		} else if msg.Status == "processing_transactions" {
-			m.currentHeight = msg.BlockHeight
-			m.currentBlockTxs = msg.TxCount
+		if closed {
+			m.completed = true
+			m.status = "Completed"
+			return m, tea.Quit
 		}
+		return m, nextFrame()
 
-		if msg.Status == "All blocks already processed" {
-			m.status = "All blocks already processed"
-			m.done = true
+	case ProgressMsg:
+		if m.apply(processor.ProgressUpdate(msg)) {
 			return m, tea.Quit
 		}
 
-		return m, m.waitForActivity()
-
 	case tea.QuitMsg:
 		return m, nil
 	}
@@ -118,6 +300,94 @@ func (m ProgressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// apply records one progress update in the model. It reports whether the
+// update ends the run.
+func (m *ProgressModel) apply(msg processor.ProgressUpdate) bool {
+	m.lastUpdate = time.Now()
+	m.inflightBytes = msg.InflightBytes
+	m.inflightLimit = msg.InflightLimit
+	m.fetchers = msg.Fetchers
+	m.cacheHits, m.cacheMisses = msg.HashCacheHits, msg.HashCacheMisses
+	m.dbSize = msg.DBSize
+	m.dbSizeProjected = msg.DBSizeProjected
+	m.pause.update(msg.Status)
+	switch msg.Status {
+	case "node_unavailable":
+		m.nodeDown = true
+	case "node_available":
+		m.nodeDown = false
+	case "tail":
+		m.tail = msg
+	}
+		
+	// Handle debug messages
+	if msg.DebugMsg != "" {
+		m.debugLogs = append(m.debugLogs, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), msg.DebugMsg))
+		if len(m.debugLogs) > 10 {
+			m.debugLogs = m.debugLogs[1:]
+		}
+	}
+		
+	if msg.Warning != "" {
+		m.warnings++
+		m.errors = append(m.errors, "Warning: "+msg.Warning)
+		if len(m.errors) > 5 {
+			m.errors = m.errors[1:]
+		}
+	}
+
+	if msg.Error != nil {
+		m.failedBlocks++
+		m.failedHeights = append(m.failedHeights, msg.BlockHeight)
+		m.addFailure(msg.BlockHeight, msg.Error.Error())
+		m.errors = append(m.errors, fmt.Sprintf("Block %d: %s", msg.BlockHeight, msg.Error.Error()))
+		if len(m.errors) > 5 {
+			m.errors = m.errors[1:]
+		}
+	} else if msg.Status == "completed" {
+		if m.processedBlocks == 0 || msg.BlockHeight < m.minDone {
+			m.minDone = msg.BlockHeight
+		}
+		if m.processedBlocks == 0 || msg.BlockHeight > m.maxDone {
+			m.maxDone = msg.BlockHeight
+		}
+		m.processedBlocks++
+		if m.days != nil {
+			m.days.add(msg.BlockHeight)
+		}
+		m.totalTxs += int64(msg.TxCount)
+		m.currentHeight = msg.BlockHeight
+		m.currentBlockTxs = msg.TxCount
+	} else if msg.Status == "processing_transactions" {
+		m.currentHeight = msg.BlockHeight
+		m.currentBlockTxs = msg.TxCount
+	} else if msg.Status == "flush" {
+		m.flushes++
+		m.lastFlush = msg
+	} else if msg.Status == "optimizing" {
+		m.optimizing = "running, creating indexes and analyzing tables..."
+	} else if msg.Status == "optimized" {
+		m.optimizing = "done"
+		if msg.Warning != "" {
+			m.optimizing = "failed"
+		}
+	} else if msg.Status == "chunk" {
+		m.chunk = msg.Chunk
+		m.chunks = msg.Chunks
+	} else if msg.Status == "tip" && msg.EndHeight > m.endHeight {
+		m.totalBlocks += msg.EndHeight - m.endHeight
+		m.endHeight = msg.EndHeight
+	}
+
+	if msg.Status == "All blocks already processed" {
+		m.status = "All blocks already processed"
+		m.done = true
+		return true
+	}
+
+	return false
+}
+
 func (m ProgressModel) View() string {
 	if m.done && m.status == "All blocks already processed" {
 		return lipgloss.NewStyle().
@@ -125,8 +395,11 @@ func (m ProgressModel) View() string {
 			Foreground(lipgloss.Color("2")).
 			Render("✓ All blocks already processed\n")
 	}
+	if m.browser.open {
+		return m.errorBrowserView()
+	}
 
-	elapsed := time.Since(m.startTime)
+	elapsed := m.pause.elapsed(m.startTime)
 	progress := float64(m.processedBlocks) / float64(m.totalBlocks) * 100
 	
 	var eta time.Duration
@@ -147,21 +420,75 @@ func (m ProgressModel) View() string {
 	errorStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("1"))
 
-	progressBar := m.renderProgressBar(progress)
+	progressBar := m.renderProgressBar()
+	if m.days != nil {
+		progressBar = "📅 Days: " + m.days.renderBar() + "\n🧱 Blocks: " + progressBar
+	}
 
+	failRate := failureRate(m.processedBlocks, m.failedBlocks)
+	failing := m.failedBlocks > 0 && failRate > m.failThreshold
+	if failing {
+		headerStyle = headerStyle.Foreground(lipgloss.Color("1")).MarginBottom(0)
+	}
 	header := headerStyle.Render("🚀 Bitcoin Blockchain Scraper")
+	if m.pause.paused() {
+		header += "  " + lipgloss.NewStyle().Bold(true).Reverse(true).Foreground(lipgloss.Color("3")).
+			Render(" ⏸ PAUSED - press 'p' to resume ")
+	}
+	if m.nodeDown {
+		header += "  " + lipgloss.NewStyle().Bold(true).Reverse(true).Foreground(lipgloss.Color("1")).
+			Render(" 🔌 node unavailable, retrying… ")
+	}
+	if failing {
+		header += "\n" + errorStyle.Render(fmt.Sprintf(
+			"%.1f%% of blocks failed (threshold %.1f%%): failed blocks are retried on the next run, or re-run with --heights <failed heights> to retry only them",
+			failRate, m.failThreshold))
+	}
+
+	done := "-"
+	if m.processedBlocks > 0 {
+		done = fmt.Sprintf("%d - %d", m.minDone, m.maxDone)
+	}
+
+	var chunkInfo string
+	if m.chunks > 1 {
+		chunkInfo = fmt.Sprintf(" | Chunk %d/%d", m.chunk, m.chunks)
+	}
 	
 	stats := statsStyle.Render(fmt.Sprintf(
-		"📊 Range: %d - %d | Current: %d\n"+
-		"✅ Processed: %d/%d blocks (%.1f%%)\n"+
-		"📈 Transactions: %d total | %d in current block\n"+
-		"⏱️  Elapsed: %s | ETA: %s\n"+
-		"❌ Failed: %d blocks",
-		m.startHeight, m.endHeight, m.currentHeight,
+		"📊 Range: %d - %d | Done: %s%s\n"+
+			"✅ Processed: %d/%d blocks (%.1f%%)\n"+
+			"📈 Transactions: %d total | %d in current block\n"+
+			"⏱️  Elapsed: %s | ETA: %s\n"+
+			"❌ Failed: %d blocks",
+		m.startHeight, m.endHeight, done, chunkInfo,
 		m.processedBlocks, m.totalBlocks, progress,
 		m.totalTxs, m.currentBlockTxs,
 		elapsed.Truncate(time.Second), eta.Truncate(time.Second),
 		m.failedBlocks))
+	if m.inflightLimit > 0 {
+		stats += "\n" + statsStyle.Render(fmt.Sprintf("💾 In flight: %.0f / %.0f MB",
+			float64(m.inflightBytes)/(1<<20), float64(m.inflightLimit)/(1<<20)))
+	}
+	if m.fetchers > 0 {
+		stats += "\n" + statsStyle.Render(fmt.Sprintf("⚙️  Fetchers: %d (adaptive)", m.fetchers))
+	}
+	if m.cacheHits+m.cacheMisses > 0 {
+		stats += "\n" + statsStyle.Render("🗃️  Hash cache: "+hashCacheInfo(m.cacheHits, m.cacheMisses))
+	}
+	if m.flushes > 0 {
+		stats += "\n" + statsStyle.Render(fmt.Sprintf("💽 Flushes: %d | Last: %d blocks, %d rows in %s",
+			m.flushes, m.lastFlush.FlushBlocks, m.lastFlush.FlushRows, m.lastFlush.FlushDuration.Round(time.Millisecond)))
+	}
+	if m.warnings > 0 {
+		stats += "\n" + statsStyle.Render(fmt.Sprintf("⚠️  Warnings: %d", m.warnings))
+	}
+	if m.dbSize > 0 {
+		stats += "\n" + statsStyle.Render("🗄️  Database: "+dbSizeInfo(m.dbSize, m.dbSizeProjected))
+	}
+	if m.optimizing != "" {
+		stats += "\n" + statsStyle.Render("🔧 Optimizing database: "+m.optimizing)
+	}
 
 	var errorSection string
 	if len(m.errors) > 0 {
@@ -182,118 +509,373 @@ func (m ProgressModel) View() string {
 		}
 	}
 
-	return fmt.Sprintf("%s\n\n%s\n\n%s%s%s\n\nPress 'q' or Ctrl+C to quit",
-		header, progressBar, stats, errorSection, debugSection)
+	return fmt.Sprintf("%s\n\n%s\n\n%s%s%s\n\n%s",
+		header, progressBar, stats, errorSection, debugSection, m.help())
 }
 
-func (m ProgressModel) renderProgressBar(progress float64) string {
-	width := 50
-	filled := int(progress / 100 * float64(width))
-	
-	bar := ""
-	for i := 0; i < width; i++ {
-		if i < filled {
-			bar += "█"
-		} else {
-			bar += "░"
-		}
+func (m ProgressModel) help() string {
+	if m.pauser != nil {
+		return "Press 'p' to pause or resume, 'e' to browse errors, 'q' or Ctrl+C to quit"
 	}
-	
-	style := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("2"))
-	
-	return style.Render(fmt.Sprintf("[%s] %.1f%%", bar, progress))
+	return "Press 'e' to browse errors, 'q' or Ctrl+C to quit"
 }
+	
+// renderProgressBar draws completed blocks in green, failed blocks in red
+// and the remaining blocks in grey, followed by the completed and failure
+// percentages.
+func (m ProgressModel) renderProgressBar() string {
+	width := 50
+	var done, failed int
+	if m.totalBlocks > 0 {
+		done = int(float64(m.processedBlocks) / float64(m.totalBlocks) * float64(width))
+		failed = int(float64(m.failedBlocks) / float64(m.totalBlocks) * float64(width))
+	}
+	if m.failedBlocks > 0 && failed == 0 {
+		// Keep a single failure visible on a long run.
+		failed = 1
+	}
+	if done+failed > width {
+		done = width - failed
+	}
+
+	doneStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	failedStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	remainingStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
 
-func RunProgressUI(ctx context.Context, startHeight, endHeight int64, progressChan <-chan processor.ProgressUpdate) error {
-	// Check if we have a TTY, if not use simple console output
-	if !isInteractiveTerminal() {
-		return runSimpleProgress(ctx, startHeight, endHeight, progressChan)
+	bar := doneStyle.Render(strings.Repeat("█", done)) +
+		failedStyle.Render(strings.Repeat("█", failed)) +
+		remainingStyle.Render(strings.Repeat("░", width-done-failed))
+
+	progress := 0.0
+	if m.totalBlocks > 0 {
+		progress = float64(m.processedBlocks) / float64(m.totalBlocks) * 100
+	}
+	label := doneStyle.Render(fmt.Sprintf("%.1f%%", progress))
+	if m.failedBlocks > 0 {
+		label += " " + failedStyle.Render(fmt.Sprintf("(%.1f%% failed)", failureRate(m.processedBlocks, m.failedBlocks)))
 	}
+	return "[" + bar + "] " + label
+}
 	
-	model := NewProgressModel(startHeight, endHeight, progressChan)
+// failureRate returns the percentage of attempted blocks that failed.
+func failureRate(processed, failed int64) float64 {
+	if processed+failed == 0 {
+		return 0
+	}
+	return float64(failed) / float64(processed+failed) * 100
+}
 	
-	p := tea.NewProgram(model, tea.WithAltScreen())
+// RunProgressUI shows the progress of processing totalBlocks blocks between
+// startHeight and endHeight until progressChan is closed.
+func RunProgressUI(ctx context.Context, startHeight, endHeight, totalBlocks int64, dbPath string, opts Options, progressChan <-chan processor.ProgressUpdate) error {
+	if opts.Mode == ModeJSON {
+		return runJSONProgress(ctx, os.Stdout, startHeight, endHeight, totalBlocks, dbPath, opts.Days, progressChan)
+	}
+
+	mode := resolveMode(opts.Mode)
+	if mode != ModeTUI {
+		return runSimpleProgress(ctx, newConsole(os.Stdout, mode == ModeLine), startHeight, endHeight, totalBlocks, dbPath, opts.Days, progressChan)
+	}
+
+	model := NewProgressModel(startHeight, endHeight, totalBlocks, dbPath, opts, progressChan)
+
+	programOpts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithOutput(os.Stdout)}
+	if isTerminal(os.Stdin) {
+		programOpts = append(programOpts, tea.WithInput(os.Stdin))
+	} else {
+		// stdin is a pipe or file (e.g. a block list piped in), so keyboard
+		// input is disabled; Ctrl+C still arrives as a signal.
+		programOpts = append(programOpts, tea.WithInput(nil))
+	}
+	p := tea.NewProgram(model, programOpts...)
 	
 	go func() {
 		<-ctx.Done()
 		p.Quit()
 	}()
 	
-	_, err := p.Run()
+	finalModel, err := p.Run()
 	
 	// If TUI failed, fall back to simple progress
 	if err != nil {
-		return runSimpleProgress(ctx, startHeight, endHeight, progressChan)
+		return runSimpleProgress(ctx, newConsole(os.Stdout, resolveMode(ModeNoTUI) == ModeLine), startHeight, endHeight, totalBlocks, dbPath, opts.Days, progressChan)
+	}
+
+	// The alt screen has been left at this point, so the summary stays visible
+	if m, ok := finalModel.(ProgressModel); ok && m.completed {
+		PrintSummary(m.Summary())
 	}
 	
 	return err
 }
 
-func isInteractiveTerminal() bool {
-	// Check environment variable to force TUI mode
-	if os.Getenv("FORCE_TUI") != "" {
-		return true
+// resolveMode returns the output mode ModeAuto and ModeNoTUI choose for
+// stdout, or mode itself.
+func resolveMode(mode Mode) Mode {
+	switch mode {
+	case ModeAuto:
+		// Check environment variable to force TUI mode
+		if os.Getenv("FORCE_TUI") != "" {
+			return ModeTUI
+		}
+		// The TUI only needs somewhere to draw; stdin may be redirected
+		if isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb" {
+			return ModeTUI
+		}
+		return resolveMode(ModeNoTUI)
+	case ModeNoTUI:
+		if isCharDevice(os.Stdout) {
+			return ModeLine
+		}
+		return ModePlain
 	}
-	
-	// Check if stdin is connected to a terminal
-	if fileInfo, _ := os.Stdin.Stat(); (fileInfo.Mode() & os.ModeCharDevice) == 0 {
-		return false
+	return mode
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Plain progress prints a line per completed block until blocks complete
+// faster than maxBlockLines a second, then a summary every summaryInterval
+// until the rate drops again.
+const (
+	maxBlockLines   = 5
+	summaryInterval = 5 * time.Second
+)
+
+// blockLines tracks the block rate of plain progress and the blocks
+// completed since the last summary.
+type blockLines struct {
+	summarizing bool
+	// recent counts the blocks completed since the last rate check.
+	recent    int64
+	lastCheck time.Time
+	// blocks, txs and height describe the blocks completed since the
+	// last summary.
+	blocks      int64
+	txs         int64
+	height      int64
+	lastSummary time.Time
+}
+
+// completed records a completed block and reports whether it gets a line
+// of its own.
+func (l *blockLines) completed(height int64, txs int) bool {
+	l.recent++
+	if !l.summarizing {
+		return true
 	}
+	l.blocks++
+	l.txs += int64(txs)
+	l.height = height
+	return false
+}
 	
-	// Check if we can open /dev/tty
-	file, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
-	if err != nil {
-		return false
+// check switches between lines and summaries by the block rate since the
+// last check. It reports whether the blocks since the last summary are to
+// be summarized now, which is also the case when leaving summaries.
+func (l *blockLines) check(now time.Time) (switched, summary bool) {
+	rate := float64(l.recent) / now.Sub(l.lastCheck).Seconds()
+	l.recent, l.lastCheck = 0, now
+	switch {
+	case !l.summarizing && rate > maxBlockLines:
+		l.summarizing, l.lastSummary = true, now
+		return true, false
+	case l.summarizing && rate <= maxBlockLines:
+		l.summarizing = false
+		return true, l.blocks > 0
+	case l.summarizing:
+		return false, l.blocks > 0 && now.Sub(l.lastSummary) >= summaryInterval
 	}
-	file.Close()
-	return true
+	return false, false
 }
 
-func runSimpleProgress(ctx context.Context, startHeight, endHeight int64, progressChan <-chan processor.ProgressUpdate) error {
-	totalBlocks := endHeight - startHeight + 1
+// take returns the blocks since the last summary and starts a new one.
+func (l *blockLines) take(now time.Time) (blocks, txs, height int64, elapsed time.Duration) {
+	blocks, txs, height, elapsed = l.blocks, l.txs, l.height, now.Sub(l.lastSummary)
+	l.blocks, l.txs, l.lastSummary = 0, 0, now
+	return blocks, txs, height, elapsed
+}
+
+func runSimpleProgress(ctx context.Context, c *console, startHeight, endHeight, totalBlocks int64, dbPath string, dayStatus []DayStatus, progressChan <-chan processor.ProgressUpdate) error {
 	var processedBlocks, failedBlocks int64
+	var failedHeights []int64
 	var totalTxs int64
+	var cacheHits, cacheMisses uint64
+	var tail processor.ProgressUpdate
+	var pause pauseClock
 	startTime := time.Now()
 	
-	fmt.Printf("Processing blocks from %d to %d (%d blocks total)\n", startHeight, endHeight, totalBlocks)
+	c.printf("Processing blocks from %d to %d (%d blocks total)\n", startHeight, endHeight, totalBlocks)
+	days := newDayProgress(dayStatus)
+	if days != nil {
+		c.printf("📅 %s\n", days.summary())
+	}
+
+	lines := blockLines{lastCheck: startTime}
+	// The status line is redrawn more often than the rate is checked
+	interval := time.Second
+	if c.line {
+		interval = statusInterval
+	}
+	rateCheck := time.NewTicker(interval)
+	defer rateCheck.Stop()
+	var lastHeight int64
+	status := func() {
+		elapsed := pause.elapsed(startTime)
+		var rate float64
+		eta := "-"
+		if elapsed > 0 && processedBlocks > 0 {
+			rate = float64(processedBlocks) / elapsed.Minutes()
+			remaining := max(totalBlocks-processedBlocks-failedBlocks, 0)
+			eta = time.Duration(float64(remaining) / rate * float64(time.Minute)).Truncate(time.Second).String()
+		}
+		line := fmt.Sprintf("Blocks %d/%d (%.1f%%), %.1f blocks/min, ETA %s, last %d",
+			processedBlocks, totalBlocks, float64(processedBlocks)/float64(totalBlocks)*100, rate, eta, lastHeight)
+		if failedBlocks > 0 {
+			line += fmt.Sprintf(", %d failed", failedBlocks)
+		}
+		if pause.paused() {
+			line += ", paused"
+		}
+		c.status(line)
+	}
+	var last processor.ProgressUpdate
+	summarize := func(now time.Time) {
+		blocks, txs, height, elapsed := lines.take(now)
+		progress := float64(processedBlocks) / float64(totalBlocks) * 100
+		c.printf("✅ Completed %d blocks (%d txs) up to block %d, %.1f blocks/s - Progress: %.1f%% (%d/%d)%s\n",
+			blocks, txs, height, float64(blocks)/elapsed.Seconds(), progress, processedBlocks, totalBlocks, inflightInfo(last))
+	}
 	
 	for {
 		select {
+		case now := <-rateCheck.C:
+			if c.line {
+				status()
+				continue
+			}
+			switched, summary := lines.check(now)
+			if summary {
+				summarize(now)
+			}
+			if switched && lines.summarizing {
+				c.printf("⏩ Over %d blocks/s, printing a summary every %s\n", maxBlockLines, summaryInterval)
+			}
+
 		case update, ok := <-progressChan:
 			if !ok {
-				elapsed := time.Since(startTime)
-				fmt.Printf("\nProcessing completed!\n")
-				fmt.Printf("Processed: %d blocks\n", processedBlocks)
-				fmt.Printf("Failed: %d blocks\n", failedBlocks)
-				fmt.Printf("Total transactions: %d\n", totalTxs)
-				fmt.Printf("Total time: %s\n", elapsed.Truncate(time.Second))
+				if c.line {
+					status()
+				} else if lines.blocks > 0 {
+					summarize(time.Now())
+				}
+				c.finish()
+				sort.Slice(failedHeights, func(i, j int) bool { return failedHeights[i] < failedHeights[j] })
+				PrintSummary(RunSummary{
+					TotalBlocks:     totalBlocks,
+					ProcessedBlocks: processedBlocks,
+					FailedBlocks:    failedBlocks,
+					FailedHeights:   failedHeights,
+					TotalTxs:        totalTxs,
+					Elapsed:         pause.elapsed(startTime),
+					DatabasePath:    dbPath,
+					HashCacheHits:   cacheHits,
+					HashCacheMisses: cacheMisses,
+					Tail:            tail.Tail,
+					Schedule:        tail.Schedule,
+				})
 				return nil
 			}
+			cacheHits, cacheMisses = update.HashCacheHits, update.HashCacheMisses
 			
 			if update.DebugMsg != "" {
-				fmt.Printf("[DEBUG] %s\n", update.DebugMsg)
+				c.printf("[DEBUG] %s\n", update.DebugMsg)
+			}
+			if update.Warning != "" {
+				c.printf("⚠️  Warning: %s\n", update.Warning)
 			}
 			
 			if update.Error != nil {
 				failedBlocks++
-				fmt.Printf("Error processing block %d: %s\n", update.BlockHeight, update.Error.Error())
+				failedHeights = append(failedHeights, update.BlockHeight)
+				c.printf("Error processing block %d: %s\n", update.BlockHeight, update.Error.Error())
 			} else if update.Status == "completed" {
 				processedBlocks++
 				totalTxs += int64(update.TxCount)
-				progress := float64(processedBlocks) / float64(totalBlocks) * 100
-				fmt.Printf("✅ Completed block %d (%d txs) - Progress: %.1f%% (%d/%d)\n", 
-					update.BlockHeight, update.TxCount, progress, processedBlocks, totalBlocks)
-			} else if update.Status == "processing_transactions" {
-				fmt.Printf("🔄 Processing block %d: %d transactions processed\n", 
+				last = update
+				lastHeight = update.BlockHeight
+				// The status line shows the blocks in line mode
+				if !c.line && lines.completed(update.BlockHeight, update.TxCount) {
+					progress := float64(processedBlocks) / float64(totalBlocks) * 100
+					c.printf("✅ Completed block %d (%d txs) - Progress: %.1f%% (%d/%d)%s\n",
+						update.BlockHeight, update.TxCount, progress, processedBlocks, totalBlocks, inflightInfo(update))
+				}
+				if days != nil {
+					if day := days.add(update.BlockHeight); day != nil {
+						c.printf("📅 Day %s complete (blocks %d - %d): %s\n",
+							day.Day.Format("2006-01-02"), day.FromHeight, day.ToHeight, days.summary())
+					}
+				}
+			} else if update.Status == "processing_transactions" && !lines.summarizing && !c.line {
+				c.printf("🔄 Processing block %d: %d transactions processed\n",
 					update.BlockHeight, update.TxCount)
+			} else if update.Status == "paused" {
+				pause.update(update.Status)
+				c.println("⏸️  Paused, send SIGUSR2 to resume")
+			} else if update.Status == "resumed" {
+				pause.update(update.Status)
+				c.println("▶️  Resumed")
+			} else if update.Status == "node_unavailable" {
+				c.printf("🔌 %s…\n", update.DebugMsg)
+			} else if update.Status == "node_available" {
+				c.println("🔌 Node available again")
+			} else if update.Status == "tail" {
+				tail = update
+			} else if update.Status == "optimizing" {
+				c.println("🔧 Optimizing database: creating indexes and analyzing tables...")
+			} else if update.Status == "concurrency" {
+				c.printf("⚙️  Fetchers: %d (adaptive)\n", update.Fetchers)
+			} else if update.Status == "tip" && update.EndHeight > endHeight {
+				totalBlocks += update.EndHeight - endHeight
+				endHeight = update.EndHeight
+				c.printf("⛓️  New tip %d, %d blocks total\n", endHeight, totalBlocks)
+			} else if update.Status == "db_size" {
+				c.printf("🗄️  Database: %s\n", dbSizeInfo(update.DBSize, update.DBSizeProjected))
 			} else if update.Status == "All blocks already processed" {
-				fmt.Println("All blocks already processed")
+				c.println("All blocks already processed")
+				c.finish()
 				return nil
 			}
 			
 		case <-ctx.Done():
+			c.finish()
 			return ctx.Err()
 		}
 	}
 }
+
+// inflightInfo describes the memory in flight for plain progress lines, or
+// returns "" without a memory budget.
+func inflightInfo(u processor.ProgressUpdate) string {
+	if u.InflightLimit == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" - In flight: %.0f/%.0f MB", float64(u.InflightBytes)/(1<<20), float64(u.InflightLimit)/(1<<20))
+}
+
+// hashCacheInfo describes the hits and misses of the RPC hash cache.
+func hashCacheInfo(hits, misses uint64) string {
+	return fmt.Sprintf("%d hits, %d misses (%.1f%% hit rate)", hits, misses, float64(hits)/float64(hits+misses)*100)
+}
+
+// dbSizeInfo describes the database size and, once known, its projected
+// size at the end of the run.
+func dbSizeInfo(size, projected int64) string {
+	info := fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	if projected > 0 {
+		info += fmt.Sprintf(" | Projected: %.1f MB", float64(projected)/(1<<20))
+	}
+	return info
+}
@@ -0,0 +1,88 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"scrapbtc/internal/processor"
+	"strings"
+	"time"
+)
+
+// RunSummary holds the final statistics of a scrape run. Both the TUI and the
+// plain console output print it through the same code so the format stays
+// identical for scripts parsing either.
+type RunSummary struct {
+	TotalBlocks     int64
+	ProcessedBlocks int64
+	FailedBlocks    int64
+	FailedHeights   []int64
+	TotalTxs        int64
+	Elapsed         time.Duration
+	DatabasePath    string
+	// HashCacheHits and HashCacheMisses are the lookups of the RPC hash
+	// cache, both zero without a cache.
+	HashCacheHits   uint64
+	HashCacheMisses uint64
+	// Tail is the time from the first fetcher running out of blocks to the
+	// last block stored, with the blocks dispatched by Schedule. Zero for a
+	// run that didn't finish its blocks.
+	Tail     time.Duration
+	Schedule processor.Schedule
+}
+
+func (s RunSummary) blocksPerMinute() float64 {
+	minutes := s.Elapsed.Minutes()
+	if minutes <= 0 {
+		return 0
+	}
+	return float64(s.ProcessedBlocks) / minutes
+}
+
+func (s RunSummary) String() string {
+	var b strings.Builder
+	b.WriteString("Processing completed!\n")
+	fmt.Fprintf(&b, "Total blocks: %d\n", s.TotalBlocks)
+	fmt.Fprintf(&b, "Processed: %d blocks\n", s.ProcessedBlocks)
+	fmt.Fprintf(&b, "Failed: %d blocks\n", s.FailedBlocks)
+	if len(s.FailedHeights) > 0 {
+		fmt.Fprintf(&b, "Failed heights: %s\n", formatHeights(s.FailedHeights))
+	}
+	fmt.Fprintf(&b, "Failure rate: %.1f%%\n", failureRate(s.ProcessedBlocks, s.FailedBlocks))
+	fmt.Fprintf(&b, "Total transactions: %d\n", s.TotalTxs)
+	fmt.Fprintf(&b, "Total time: %s\n", s.Elapsed.Truncate(time.Second))
+	fmt.Fprintf(&b, "Average rate: %.2f blocks/min\n", s.blocksPerMinute())
+	if s.Tail > 0 {
+		fmt.Fprintf(&b, "Tail: %s with fetchers idle (%.1f%% of the run, %s schedule)\n",
+			s.Tail.Round(time.Millisecond), tailShare(s.Tail, s.Elapsed), s.Schedule)
+	}
+	if s.HashCacheHits+s.HashCacheMisses > 0 {
+		fmt.Fprintf(&b, "Hash cache: %s\n", hashCacheInfo(s.HashCacheHits, s.HashCacheMisses))
+	}
+	fmt.Fprintf(&b, "Database: %s\n", s.DatabasePath)
+	return b.String()
+}
+
+// PrintSummary writes the summary to stdout and the failed heights to stderr,
+// so they can be picked up for a re-run even when stdout is discarded.
+func PrintSummary(s RunSummary) {
+	fmt.Print("\n" + s.String())
+	if len(s.FailedHeights) > 0 {
+		fmt.Fprintf(os.Stderr, "Failed block heights: %s\n", formatHeights(s.FailedHeights))
+	}
+}
+
+// tailShare is the percentage of elapsed that the tail took.
+func tailShare(tail, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(tail) / float64(elapsed) * 100
+}
+
+func formatHeights(heights []int64) string {
+	parts := make([]string, len(heights))
+	for i, h := range heights {
+		parts[i] = fmt.Sprintf("%d", h)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,57 @@
+package watchlist
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// bloomFilter is a Bloom filter of strings. It answers "maybe" for every
+// string added and, with probability about its false positive rate, for
+// strings that weren't.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes int
+	seed   maphash.Seed
+}
+
+// newBloomFilter sizes a filter for n strings with the given false
+// positive rate.
+func newBloomFilter(n int, falsePositiveRate float64) *bloomFilter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	hashes := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{
+		bits:   make([]uint64, (m+63)/64),
+		m:      m,
+		hashes: max(hashes, 1),
+		seed:   maphash.MakeSeed(),
+	}
+}
+
+// positions derives the filter's hashes of s from the two halves of one
+// 64-bit hash, as in Kirsch and Mitzenmacher's double hashing.
+func (f *bloomFilter) positions(s string, fn func(bit uint64) bool) bool {
+	h := maphash.String(f.seed, s)
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := range uint64(f.hashes) {
+		if !fn((h1 + i*h2) % f.m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(s string) {
+	f.positions(s, func(bit uint64) bool {
+		f.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+func (f *bloomFilter) mayContain(s string) bool {
+	return f.positions(s, func(bit uint64) bool {
+		return f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
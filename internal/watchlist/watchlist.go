@@ -0,0 +1,106 @@
+// Package watchlist matches addresses against a list of watched ones while
+// blocks are parsed, so that their activity can be stored without storing
+// every output.
+package watchlist
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// smallList is the largest list kept only in a set. Larger lists are
+	// checked against a Bloom filter first, since nearly every address of a
+	// block misses, and its hits are confirmed by a binary search of the
+	// sorted addresses, which take less memory than a map of millions.
+	smallList = 10000
+	// falsePositiveRate is the share of unwatched addresses the Bloom
+	// filter lets through to the binary search.
+	falsePositiveRate = 0.001
+)
+
+// Watchlist is a set of addresses. It is safe for concurrent use once
+// built.
+type Watchlist struct {
+	set    map[string]struct{}
+	filter *bloomFilter
+	sorted []string
+}
+
+// New returns a watchlist of addresses, ignoring duplicates.
+func New(addresses []string) *Watchlist {
+	sorted := slices.Clone(addresses)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	if len(sorted) <= smallList {
+		w := &Watchlist{set: make(map[string]struct{}, len(sorted))}
+		for _, address := range sorted {
+			w.set[address] = struct{}{}
+		}
+		return w
+	}
+	w := &Watchlist{filter: newBloomFilter(len(sorted), falsePositiveRate), sorted: slices.Clip(sorted)}
+	for _, address := range sorted {
+		w.filter.add(address)
+	}
+	return w
+}
+
+// Load reads a watchlist from a file of one address per line. Blank lines
+// and lines starting with # are skipped.
+func Load(path string) (*Watchlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var addresses []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		address := strings.TrimSpace(scanner.Text())
+		if address == "" || strings.HasPrefix(address, "#") {
+			continue
+		}
+		if strings.ContainsAny(address, " \t,") {
+			return nil, fmt.Errorf("%s:%d: expected one address per line, got %q", path, line, address)
+		}
+		addresses = append(addresses, address)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s has no addresses", path)
+	}
+	return New(addresses), nil
+}
+
+// Contains reports whether address is watched. A nil Watchlist watches
+// nothing.
+func (w *Watchlist) Contains(address string) bool {
+	if w == nil || address == "" {
+		return false
+	}
+	if w.set != nil {
+		_, ok := w.set[address]
+		return ok
+	}
+	if !w.filter.mayContain(address) {
+		return false
+	}
+	_, ok := slices.BinarySearch(w.sorted, address)
+	return ok
+}
+
+// Len returns the number of watched addresses.
+func (w *Watchlist) Len() int {
+	if w.set != nil {
+		return len(w.set)
+	}
+	return len(w.sorted)
+}
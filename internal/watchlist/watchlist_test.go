@@ -0,0 +1,77 @@
+package watchlist
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestContains checks a list small enough for the set and one large
+// enough for the Bloom filter: every watched address matches and no other
+// does, although the filter lets some of them through.
+func TestContains(t *testing.T) {
+	for _, n := range []int{3, 3 * smallList} {
+		var addresses []string
+		for i := range n {
+			addresses = append(addresses, fmt.Sprintf("bc1qwatched%d", i))
+		}
+		// Duplicates count once
+		w := New(append(addresses, addresses[0]))
+		if w.Len() != n {
+			t.Errorf("%d addresses: Len() = %d", n, w.Len())
+		}
+		if (w.filter != nil) != (n > smallList) {
+			t.Errorf("%d addresses: Bloom filter %v", n, w.filter != nil)
+		}
+		for _, address := range addresses {
+			if !w.Contains(address) {
+				t.Fatalf("%d addresses: %s isn't watched", n, address)
+			}
+		}
+
+		var passed int
+		for i := range 100000 {
+			address := fmt.Sprintf("bc1qother%d", i)
+			if w.Contains(address) {
+				t.Fatalf("%d addresses: %s is watched", n, address)
+			}
+			if w.filter != nil && w.filter.mayContain(address) {
+				passed++
+			}
+		}
+		// About 100 of them, at the filter's false positive rate
+		if passed > 300 {
+			t.Errorf("%d addresses: the Bloom filter let %d of 100000 unwatched addresses through", n, passed)
+		}
+	}
+
+	var w *Watchlist
+	if w.Contains("bc1qwatched0") {
+		t.Error("a nil watchlist watches an address")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "watch.txt")
+	if err := os.WriteFile(path, []byte("# exchanges\nbc1qa\n\n  1Bb  \r\nbc1qa\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Len() != 2 || !w.Contains("bc1qa") || !w.Contains("1Bb") || w.Contains("# exchanges") {
+		t.Errorf("Load() watches %d addresses: %v", w.Len(), w.set)
+	}
+
+	for _, content := range []string{"", "# none\n", "bc1qa bc1qb\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%q) succeeded", content)
+		}
+	}
+}
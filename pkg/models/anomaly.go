@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Dimensions a block is scored on by scrapbtc analyze anomalies.
+const (
+	AnomalyTxCount  = "tx_count"
+	AnomalyFees     = "total_fees"
+	AnomalyFeeRate  = "fee_rate"
+	AnomalyInterval = "interval"
+	AnomalyOpReturn = "op_return_bytes"
+)
+
+// AnomalyDimensions lists the dimensions in the order they are scored.
+var AnomalyDimensions = []string{AnomalyTxCount, AnomalyFees, AnomalyFeeRate, AnomalyInterval, AnomalyOpReturn}
+
+// BlockFeatures are the values of a stored block that anomalies are looked
+// for in. FeeRate is the total fees over the virtual size of the block, in
+// sat/vB, and Interval the seconds since the block at the height below,
+// nil when that block isn't stored.
+type BlockFeatures struct {
+	Height        int64
+	Hash          string
+	Timestamp     time.Time
+	TxCount       int64
+	TotalFees     int64
+	FeeRate       float64
+	Interval      *float64
+	OpReturnBytes int64
+}
+
+// BlockAnomaly is a dimension on which a block is unusual against the blocks
+// before it. Baseline is the median, or the mean with the z-score method,
+// of those blocks, and Score how many deviations Value is away from it:
+// negative below the baseline.
+type BlockAnomaly struct {
+	Height     int64     `json:"height"`
+	BlockHash  string    `json:"block_hash"`
+	Timestamp  time.Time `json:"timestamp"`
+	Dimension  string    `json:"dimension"`
+	Value      float64   `json:"value"`
+	Baseline   float64   `json:"baseline"`
+	Score      float64   `json:"score"`
+	Method     string    `json:"method"`
+	DetectedAt time.Time `json:"detected_at"`
+}
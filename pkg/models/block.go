@@ -9,30 +9,254 @@ type Block struct {
 	Size              int32     `json:"size"`
 	Weight            int32     `json:"weight"`
 	TxCount           int       `json:"tx_count"`
+	FilteredTxCount   int       `json:"filtered_tx_count"` // of TxCount, left out by the transaction filters
 	PreviousBlockHash string    `json:"previous_block_hash"`
 	MerkleRoot        string    `json:"merkle_root"`
 	Nonce             uint32    `json:"nonce"`
 	Bits              string    `json:"bits"`
 	Difficulty        float64   `json:"difficulty"`
-	ProcessedAt       time.Time `json:"processed_at"`
+	CoinbaseValue     int64     `json:"coinbase_value"`
+	Subsidy           int64     `json:"subsidy"` // allowed by the halving schedule
+	TotalFees         int64     `json:"total_fees"`
+	SegwitTxCount     int       `json:"segwit_tx_count"`
+	WitnessSize       int64     `json:"witness_size"`
+	// CoinbaseScript is the scriptSig of the coinbase input in hex, and
+	// MinerTag the pool identified from its text, or "unknown"
+	CoinbaseScript string `json:"coinbase_script"`
+	MinerTag       string `json:"miner_tag"`
+	// Work is the expected number of hashes to find the block, from its
+	// bits, and Chainwork the total work of the chain up to it, both in
+	// decimal because they overflow 64 bits
+	Work        string    `json:"work"`
+	Chainwork   string    `json:"chainwork"`
+	ProcessedAt time.Time `json:"processed_at"`
 }
 
 type Transaction struct {
+	Txid        string     `json:"txid"`
+	BlockHash   string     `json:"block_hash"`
+	BlockHeight int64      `json:"block_height"`
+	Size        int32      `json:"size"`
+	VSize       int32      `json:"vsize"`
+	Weight      int32      `json:"weight"`
+	Fee         int64      `json:"fee"`
+	FeeRate     float64    `json:"fee_rate"` // sat/vB
+	IsCoinbase  bool       `json:"is_coinbase"`
+	InputCount  int        `json:"input_count"`
+	OutputCount int        `json:"output_count"`
+	InputValue  int64      `json:"input_value"`
+	OutputValue int64      `json:"output_value"`
+	Version     int32      `json:"version"`
+	LockTime    uint32     `json:"locktime"`
+	SignalsRBF  bool       `json:"signals_rbf"` // BIP125 opt-in by any input
+	Category    TxCategory `json:"category"`
+	Timestamp   time.Time  `json:"timestamp"`
+	ProcessedAt time.Time  `json:"processed_at"`
+}
+
+// RawBlock is the serialized block as returned by getblock with verbosity 0.
+type RawBlock struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	SizeBytes int64  `json:"size_bytes"`
+	Data      []byte `json:"-"`
+}
+
+// BlockData is a block together with everything parsed from its transactions.
+type BlockData struct {
+	Block        *Block
+	Transactions []*Transaction
+	Inputs       []*TxInput
+	Outputs      []*TxOutput
+	OpReturns    []*OpReturnOutput
+	// Watched is the activity of the watched addresses, whatever the
+	// profile stores of the block's outputs.
+	Watched []*WatchedActivity
+}
+
+// OpReturnOutput is the payload of an OP_RETURN (nulldata) output.
+type OpReturnOutput struct {
 	Txid        string    `json:"txid"`
-	BlockHash   string    `json:"block_hash"`
+	Vout        uint32    `json:"vout"`
 	BlockHeight int64     `json:"block_height"`
-	Size        int32     `json:"size"`
-	VSize       int32     `json:"vsize"`
-	Weight      int32     `json:"weight"`
-	Fee         int64     `json:"fee"`
-	InputCount  int       `json:"input_count"`
-	OutputCount int       `json:"output_count"`
-	InputValue  int64     `json:"input_value"`
-	OutputValue int64     `json:"output_value"`
+	DataHex     string    `json:"data_hex"`
+	DataSize    int       `json:"data_size"`
 	Timestamp   time.Time `json:"timestamp"`
-	ProcessedAt time.Time `json:"processed_at"`
 }
 
+// OpReturnDailyStats summarizes OP_RETURN usage for one day.
+type OpReturnDailyStats struct {
+	Day     time.Time `json:"day"`
+	Outputs int64     `json:"outputs"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// BlockIntervalStats describes block production in one day or week.
+// Intervals are in seconds between a block and its stored predecessor;
+// intervals that are negative because of out-of-order timestamps count as
+// zero. Hashrate is estimated in hashes per second from the average
+// difficulty and the average interval.
+type BlockIntervalStats struct {
+	Period            time.Time `json:"period"`
+	Blocks            int64     `json:"blocks"`
+	AvgInterval       float64   `json:"avg_interval"`
+	MedianInterval    float64   `json:"median_interval"`
+	NegativeIntervals int64     `json:"negative_intervals"`
+	Difficulty        float64   `json:"difficulty"`
+	Hashrate          float64   `json:"hashrate"`
+}
+
+// BlockFullness describes how full the blocks of one period, or one block,
+// were against the 4M weight unit limit. Fullness is the average weight as
+// a percentage of the limit. Full blocks are above 99% of it, so the limit
+// is what kept more transactions out; partial blocks had room left, as in
+// low-fee periods when fewer transactions pay to get in; empty blocks hold
+// only their coinbase, leaving the room unused by choice of the miner.
+type BlockFullness struct {
+	Period        time.Time `json:"period"`
+	FromHeight    int64     `json:"from_height"`
+	ToHeight      int64     `json:"to_height"`
+	Blocks        int64     `json:"blocks"`
+	Fullness      float64   `json:"fullness"`
+	FullBlocks    int64     `json:"full_blocks"`
+	PartialBlocks int64     `json:"partial_blocks"`
+	EmptyBlocks   int64     `json:"empty_blocks"`
+}
+
+// HashrateEstimate is the hashrate at the last block of one period, in
+// hashes per second, estimated from the chainwork added over the
+// 2016 blocks up to it and the time they took.
+type HashrateEstimate struct {
+	Period    time.Time `json:"period"`
+	Height    int64     `json:"height"`
+	Chainwork string    `json:"chainwork"`
+	Hashrate  float64   `json:"hashrate"`
+}
+
+// RBFDailyStats is the share of non-coinbase transactions signaling
+// replaceability (BIP125) on one day.
+type RBFDailyStats struct {
+	Day          time.Time `json:"day"`
+	Transactions int64     `json:"transactions"`
+	Signaling    int64     `json:"signaling"`
+	Percent      float64   `json:"percent"`
+}
+
+// SegwitDailyStats summarizes segwit usage on one day. WeightRatio is the
+// total block weight divided by the total block size; it is 4 without any
+// witness data and drops as more of the blocks is witness data.
+type SegwitDailyStats struct {
+	Day          time.Time `json:"day"`
+	Blocks       int64     `json:"blocks"`
+	Transactions int64     `json:"transactions"`
+	SegwitTxs    int64     `json:"segwit_txs"`
+	Percent      float64   `json:"percent"`
+	WitnessBytes int64     `json:"witness_bytes"`
+	WeightRatio  float64   `json:"weight_ratio"`
+}
+
+// OutputTypeStats counts the outputs of one script type created on one day.
+// Percent is the share of that day's outputs.
+type OutputTypeStats struct {
+	Day        time.Time `json:"day"`
+	ScriptType string    `json:"script_type"`
+	Outputs    int64     `json:"outputs"`
+	Value      int64     `json:"value"`
+	Percent    float64   `json:"percent"`
+}
+
+// MinerShare counts the blocks one pool mined in one period. Percent is the
+// share of that period's tagged blocks.
+type MinerShare struct {
+	Period   time.Time `json:"period"`
+	MinerTag string    `json:"miner_tag"`
+	Blocks   int64     `json:"blocks"`
+	Percent  float64   `json:"percent"`
+}
+
+// EpochStats summarizes the scraped blocks of one halving epoch. Subsidy is
+// what the schedule allowed them to create and Issued what their coinbases
+// actually claimed beyond the fees, in satoshis; Issued is lower when miners
+// claimed less than allowed.
+type EpochStats struct {
+	Epoch       int64     `json:"epoch"`
+	FirstHeight int64     `json:"first_height"`
+	LastHeight  int64     `json:"last_height"`
+	FirstBlock  time.Time `json:"first_block"`
+	LastBlock   time.Time `json:"last_block"`
+	Blocks      int64     `json:"blocks"`
+	AvgFees     float64   `json:"avg_fees"`
+	Subsidy     int64     `json:"subsidy"`
+	Issued      int64     `json:"issued"`
+}
+
+// MinerRevenue is the miner income for one day split into the block subsidy
+// and transaction fees, in satoshis.
+type MinerRevenue struct {
+	Day     time.Time `json:"day"`
+	Blocks  int64     `json:"blocks"`
+	Subsidy int64     `json:"subsidy"`
+	Fees    int64     `json:"fees"`
+}
+
+// USDVolume is the value moved and earned by miners on one day, in satoshis
+// and in USD at the price matched to each block. The USD amounts only cover
+// the PricedBlocks blocks; the others had no price within 24 hours.
+type USDVolume struct {
+	Day             time.Time `json:"day"`
+	Blocks          int64     `json:"blocks"`
+	PricedBlocks    int64     `json:"priced_blocks"`
+	OutputValue     int64     `json:"output_value"`
+	OutputValueUSD  float64   `json:"output_value_usd"`
+	Fees            int64     `json:"fees"`
+	FeesUSD         float64   `json:"fees_usd"`
+	MinerRevenue    int64     `json:"miner_revenue"`
+	MinerRevenueUSD float64   `json:"miner_revenue_usd"`
+}
+
+// DailyStats is the activity on one day: transactions including
+// coinbases, fees and the value of the non-coinbase outputs, in satoshis.
+// The Avg fields are their averages over the rolling window ending that
+// day and the EMA fields their exponential moving averages; they are nil
+// when not requested, and the averages also when the window is partial and
+// partial windows aren't averaged.
+type DailyStats struct {
+	Day          time.Time `json:"day"`
+	Blocks       int64     `json:"blocks"`
+	Transactions int64     `json:"transactions"`
+	Fees         int64     `json:"fees"`
+	Volume       int64     `json:"volume"`
+
+	TransactionsAvg *float64 `json:"transactions_avg,omitempty"`
+	FeesAvg         *float64 `json:"fees_avg,omitempty"`
+	VolumeAvg       *float64 `json:"volume_avg,omitempty"`
+	TransactionsEMA *float64 `json:"transactions_ema,omitempty"`
+	FeesEMA         *float64 `json:"fees_ema,omitempty"`
+	VolumeEMA       *float64 `json:"volume_ema,omitempty"`
+}
+
+// AddressStats is the running summary of an address, in satoshis.
+type AddressStats struct {
+	Address         string `json:"address"`
+	FirstSeenHeight int64  `json:"first_seen_height"`
+	LastSeenHeight  int64  `json:"last_seen_height"`
+	TotalReceived   int64  `json:"total_received"`
+	TotalSent       int64  `json:"total_sent"`
+	UTXOCount       int64  `json:"utxo_count"`
+	Balance         int64  `json:"balance"`
+	// Label is the imported label of the address, if any
+	Label string `json:"label,omitempty"`
+}
+
+// DailyAddressCount is a number of distinct addresses on one day.
+type DailyAddressCount struct {
+	Day       time.Time `json:"day"`
+	Addresses int64     `json:"addresses"`
+}
+
+// TxInput is a transaction input. Txid and TxidSpending both hold the
+// spending transaction and Vout is the input's index within it; the spent
+// output is PrevTxid:PrevVout.
 type TxInput struct {
 	Txid         string `json:"txid"`
 	Vout         uint32 `json:"vout"`
@@ -43,6 +267,213 @@ type TxInput struct {
 	Value        int64  `json:"value"`
 	Address      string `json:"address"`
 	TxidSpending string `json:"txid_spending"`
+	BlockHeight  int64  `json:"block_height"`
+}
+
+// InputResolution counts the inputs stored for one day by whether their
+// value and address are known. Resolvable inputs spend stored outputs but
+// weren't looked up yet; the outputs of missing ones are outside the
+// scraped range. Percent is the share of resolved inputs.
+type InputResolution struct {
+	Day        time.Time `json:"day"`
+	Inputs     int64     `json:"inputs"`
+	Resolved   int64     `json:"resolved"`
+	Resolvable int64     `json:"resolvable"`
+	Missing    int64     `json:"missing"`
+	Percent    float64   `json:"percent"`
+}
+
+// SpentOutput links the output PrevTxid:PrevVout to the input that spends it.
+type SpentOutput struct {
+	PrevTxid     string `json:"prev_txid"`
+	PrevVout     uint32 `json:"prev_vout"`
+	SpendingTxid string `json:"spending_txid"`
+	SpendingVin  uint32 `json:"spending_vin"`
+}
+
+// UTXOSetSize is the number and total value of unspent outputs at a height.
+type UTXOSetSize struct {
+	Height int64 `json:"height"`
+	Count  int64 `json:"count"`
+	Value  int64 `json:"value"`
+}
+
+// SpentOutputAge is a spent output with the times it was created and spent.
+type SpentOutputAge struct {
+	Value     int64     `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+	SpentAt   time.Time `json:"spent_at"`
+}
+
+// BlockMetrics holds derived per-block metrics. CoinDaysDestroyed is in
+// BTC-days and ValueSpent in satoshis, both over the inputs whose previous
+// outputs are stored.
+type BlockMetrics struct {
+	BlockHeight       int64     `json:"block_height"`
+	BlockHash         string    `json:"block_hash"`
+	Timestamp         time.Time `json:"timestamp"`
+	CoinDaysDestroyed float64   `json:"coin_days_destroyed"`
+	ValueSpent        int64     `json:"value_spent"`
+	ComputedAt        time.Time `json:"computed_at"`
+}
+
+// DailyCDD is the coin days destroyed for one day. AvgDormancy is the
+// value-weighted average age in days of the coins spent that day.
+type DailyCDD struct {
+	Day               time.Time `json:"day"`
+	CoinDaysDestroyed float64   `json:"coin_days_destroyed"`
+	ValueSpent        int64     `json:"value_spent"`
+	AvgDormancy       float64   `json:"avg_dormancy"`
+}
+
+// CoinFlow is the total value of outputs created on CreatedDay and spent on
+// SpentDay. SpentDay is zero for outputs that are still unspent. Outputs are
+// valued in USD at the price of the block that created them and of the
+// block that spent them; UnpricedValue is the value without a creation price
+// and UnpricedSpent the spent value missing either price.
+type CoinFlow struct {
+	CreatedDay    time.Time `json:"created_day"`
+	SpentDay      time.Time `json:"spent_day"`
+	Value         int64     `json:"value"`
+	UnpricedValue int64     `json:"unpriced_value"`
+	// CreatedUSD is the value of the outputs with a creation price
+	CreatedUSD    float64 `json:"created_usd"`
+	UnpricedSpent int64   `json:"unpriced_spent"`
+	// SpentUSD and SpentCreatedUSD value the spent outputs with both prices
+	// at the spend and the creation price
+	SpentUSD        float64 `json:"spent_usd"`
+	SpentCreatedUSD float64 `json:"spent_created_usd"`
+}
+
+// DailyMetrics holds the valuation metrics of one day. RealizedCap is in USD
+// and counts every unspent output at the price of the block that created it.
+// SOPR is the value-weighted ratio of the price of the blocks that spent
+// outputs that day to the price of the blocks that created them, nil when
+// nothing priced was spent. Value without a usable price is reported in the
+// unpriced fields.
+//
+// The other fields feed the price-to-chain ratios. Price is the average
+// price of the day and PriceMA200 its average over the 200 days ending that
+// day, nil without a price on every one of them. IssuedSupply is what the
+// subsidies of the blocks up to the last one of the day may have created.
+// Fees and Subsidy sum the day's blocks, and TransferredValue the outputs of
+// its non-coinbase transactions, of which TransferredExChange leaves out the
+// largest output of each transaction with several, as presumed change.
+type DailyMetrics struct {
+	Day            time.Time `json:"day"`
+	Supply         int64     `json:"supply"`
+	RealizedCap    float64   `json:"realized_cap"`
+	UnpricedSupply int64     `json:"unpriced_supply"`
+	ValueSpent     int64     `json:"value_spent"`
+	SOPR           *float64  `json:"sopr"`
+	UnpricedSpent  int64     `json:"unpriced_spent"`
+	Interpolated   bool      `json:"interpolated"`
+	ComputedAt     time.Time `json:"computed_at"`
+
+	Price               *float64 `json:"price"`
+	PriceMA200          *float64 `json:"price_ma200"`
+	IssuedSupply        int64    `json:"issued_supply"`
+	Fees                int64    `json:"fees"`
+	Subsidy             int64    `json:"subsidy"`
+	TransferredValue    int64    `json:"transferred_value"`
+	TransferredExChange int64    `json:"transferred_ex_change"`
+}
+
+// DailyTransfers sums the blocks of one day, up to LastHeight, and the value
+// their non-coinbase transactions transferred, in satoshis. ValueExChange
+// leaves out the largest output of each transaction with several.
+type DailyTransfers struct {
+	Day           time.Time `json:"day"`
+	LastHeight    int64     `json:"last_height"`
+	Fees          int64     `json:"fees"`
+	Subsidy       int64     `json:"subsidy"`
+	Value         int64     `json:"value"`
+	ValueExChange int64     `json:"value_ex_change"`
+}
+
+// PriceOHLC summarizes the price points of one period: the first, highest,
+// lowest and last price, in USD, and the sum of their volumes.
+type PriceOHLC struct {
+	Period time.Time `json:"period"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int64     `json:"volume"`
+	Points int64     `json:"points"`
+}
+
+// PriceGap is a stretch between two consecutive price points, Seconds
+// apart, with no price data in between.
+type PriceGap struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Seconds int64     `json:"seconds"`
+}
+
+// DailyPrice is the average of the price points of one day, in USD.
+type DailyPrice struct {
+	Day   time.Time `json:"day"`
+	Price float64   `json:"price"`
+}
+
+// DailyRatios compares the price with the chain activity of one day.
+// MarketCap values the issued supply at the day's price, in USD. NVT is the
+// market cap divided by the transferred value at the same price,
+// FeeRewardRatio the share of fees in the miner reward and MayerMultiple the
+// price divided by its 200-day moving average. Each is nil when its inputs
+// are missing or zero.
+type DailyRatios struct {
+	Day              time.Time `json:"day"`
+	Price            *float64  `json:"price"`
+	MarketCap        *float64  `json:"market_cap"`
+	TransferredValue int64     `json:"transferred_value"`
+	NVT              *float64  `json:"nvt"`
+	FeeRewardRatio   *float64  `json:"fee_reward_ratio"`
+	MayerMultiple    *float64  `json:"mayer_multiple"`
+}
+
+// UTXOAgeBand is the number and value of unspent outputs whose age falls in
+// one coin age band, and their share of the value of all unspent outputs.
+type UTXOAgeBand struct {
+	Band    string  `json:"band"`
+	Count   int64   `json:"count"`
+	Value   int64   `json:"value"`
+	Percent float64 `json:"percent"`
+}
+
+// OutputValueBucket is the number and value of the outputs whose value falls
+// in one bucket of an OutputValueDistribution.
+type OutputValueBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int64  `json:"count"`
+	Value  int64  `json:"value"`
+}
+
+// OutputValueDistribution is the histogram of the values of the outputs
+// created in one period, or one block, in log-scale buckets from 1k sats
+// or less to over 1000 BTC. Every bucket is listed, from the smallest.
+type OutputValueDistribution struct {
+	Period     time.Time            `json:"period"`
+	FromHeight int64                `json:"from_height"`
+	ToHeight   int64                `json:"to_height"`
+	Outputs    int64                `json:"outputs"`
+	Buckets    []*OutputValueBucket `json:"buckets"`
+}
+
+// FeeHeatmapCell is the number and virtual size of the non-coinbase
+// transactions of a block paying a fee rate in one band. A band covers the
+// rates from MinFeeRate up to but not including MaxFeeRate, in sat/vB; the
+// lowest has no minimum, the highest no maximum and the unknown band, of
+// the transactions without a fee rate, neither.
+type FeeHeatmapCell struct {
+	Height       int64     `json:"height"`
+	Timestamp    time.Time `json:"timestamp"`
+	Band         string    `json:"band"`
+	MinFeeRate   *float64  `json:"min_fee_rate,omitempty"`
+	MaxFeeRate   *float64  `json:"max_fee_rate,omitempty"`
+	Transactions int64     `json:"transactions"`
+	VSize        int64     `json:"vsize"`
 }
 
 type TxOutput struct {
@@ -50,16 +481,261 @@ type TxOutput struct {
 	Vout         uint32 `json:"vout"`
 	Value        int64  `json:"value"`
 	ScriptPubKey string `json:"script_pub_key"`
+	ScriptType   string `json:"script_type"`
 	Address      string `json:"address"`
 	SpentTxid    string `json:"spent_txid"`
 	SpentVout    uint32 `json:"spent_vout"`
+	BlockHeight  int64  `json:"block_height"`
+}
+
+// HeightRange is an inclusive range of block heights.
+type HeightRange struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// StatusSummary summarizes the processing_status table.
+type StatusSummary struct {
+	Counts          map[string]int64 `json:"counts"`
+	Total           int64            `json:"total"`
+	CompletedRanges []HeightRange    `json:"completed_ranges"`
+	// Gaps are the heights between the completed ranges that aren't
+	// completed, whether they failed or were never processed.
+	Gaps []HeightRange `json:"gaps"`
+}
+
+// FailedBlock is a block whose processing failed.
+type FailedBlock struct {
+	Height    int64     `json:"height"`
+	Hash      string    `json:"hash"`
+	Error     string    `json:"error"`
+	StartedAt time.Time `json:"started_at"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// BlockTiming is the time, in milliseconds, the run that stored a block
+// spent on it: in RPC calls fetching it, parsing it, and its share of the
+// transaction that inserted it. Total also counts failed fetch attempts and
+// waiting for memory, but not the time the block was queued between stages.
+type BlockTiming struct {
+	Height     int64 `json:"height"`
+	RPCFetchMs int64 `json:"rpc_fetch_ms"`
+	ParseMs    int64 `json:"parse_ms"`
+	DBInsertMs int64 `json:"db_insert_ms"`
+	TotalMs    int64 `json:"total_ms"`
+}
+
+// SlowBlock is a stored block with its timings.
+type SlowBlock struct {
+	BlockTiming
+	Hash    string `json:"hash"`
+	Size    int64  `json:"size"`
+	TxCount int64  `json:"tx_count"`
+}
+
+// ChainBreak is a stored block whose previous block hash doesn't match the
+// hash of the block stored at the height below it.
+type ChainBreak struct {
+	Height             int64     `json:"height"`
+	BlockHash          string    `json:"block_hash"`
+	PreviousBlockHash  string    `json:"previous_block_hash"`
+	StoredPreviousHash string    `json:"stored_previous_hash"`
+	DetectedAt         time.Time `json:"detected_at"`
+}
+
+// DayRange is the heights of the blocks of one UTC calendar day: from the
+// first block with a timestamp on that day to the block before the first
+// one of the next day.
+type DayRange struct {
+	Day        time.Time `json:"day"`
+	FromHeight int64     `json:"from_height"`
+	ToHeight   int64     `json:"to_height"`
+}
+
+// Blocks returns the number of blocks of the day.
+func (d *DayRange) Blocks() int64 {
+	return d.ToHeight - d.FromHeight + 1
+}
+
+// BlockStats holds the per-block aggregates returned by getblockstats,
+// stored by --mode stats without the block's transactions. Amounts are in
+// satoshis and fee rates in sat/vB; the fee rate percentiles are weighted by
+// transaction weight. UTXOIncrease and UTXOSizeIncrease may be negative.
+type BlockStats struct {
+	Height             int64     `json:"height"`
+	BlockHash          string    `json:"block_hash"`
+	Timestamp          time.Time `json:"timestamp"`
+	MedianTime         time.Time `json:"median_time"`
+	TxCount            int64     `json:"tx_count"`
+	Inputs             int64     `json:"inputs"`
+	Outputs            int64     `json:"outputs"`
+	TotalSize          int64     `json:"total_size"`
+	TotalWeight        int64     `json:"total_weight"`
+	TotalFee           int64     `json:"total_fee"`
+	Subsidy            int64     `json:"subsidy"`
+	TotalOut           int64     `json:"total_out"`
+	AvgFee             int64     `json:"avg_fee"`
+	MinFee             int64     `json:"min_fee"`
+	MaxFee             int64     `json:"max_fee"`
+	MedianFee          int64     `json:"median_fee"`
+	AvgFeeRate         int64     `json:"avg_fee_rate"`
+	MinFeeRate         int64     `json:"min_fee_rate"`
+	MaxFeeRate         int64     `json:"max_fee_rate"`
+	FeeRatePercentiles [5]int64  `json:"fee_rate_percentiles"` // 10th, 25th, 50th, 75th and 90th
+	SegwitTxCount      int64     `json:"segwit_tx_count"`
+	SegwitTotalSize    int64     `json:"segwit_total_size"`
+	UTXOIncrease       int64     `json:"utxo_increase"`
+	UTXOSizeIncrease   int64     `json:"utxo_size_increase"`
+	ProcessedAt        time.Time `json:"processed_at"`
+}
+
+// NodeSnapshot is the state of the node and its mempool at one poll in
+// follow mode. TxRate is the average number of transactions per second
+// over the last WindowBlocks blocks, as reported by getchaintxstats.
+// MempoolBytes is the total virtual size of the mempool transactions and
+// MempoolMinFee is in sat/vB.
+type NodeSnapshot struct {
+	TakenAt              time.Time `json:"taken_at"`
+	Height               int64     `json:"height"`
+	Headers              int64     `json:"headers"`
+	VerificationProgress float64   `json:"verification_progress"`
+	ChainTxCount         int64     `json:"chain_tx_count"`
+	WindowBlocks         int64     `json:"window_blocks"`
+	WindowTxs            int64     `json:"window_txs"`
+	WindowSeconds        int64     `json:"window_seconds"`
+	TxRate               float64   `json:"tx_rate"`
+	MempoolTxs           int64     `json:"mempool_txs"`
+	MempoolBytes         int64     `json:"mempool_bytes"`
+	MempoolUsage         int64     `json:"mempool_usage"`
+	MempoolMinFee        float64   `json:"mempool_min_fee"`
+	Connections          int       `json:"connections"`
+	ConnectionsIn        int       `json:"connections_in"`
+	ConnectionsOut       int       `json:"connections_out"`
+}
+
+// MempoolFullness compares the mempool recorded in node snapshots with the
+// blocks mined in one hour or day. Fullness is the average block weight as
+// a percentage of the 4M weight unit limit; the block fields are zero when
+// no block of the period is stored.
+type MempoolFullness struct {
+	Period          time.Time `json:"period"`
+	Snapshots       int64     `json:"snapshots"`
+	AvgMempoolTxs   float64   `json:"avg_mempool_txs"`
+	AvgMempoolBytes float64   `json:"avg_mempool_bytes"`
+	MaxMempoolBytes int64     `json:"max_mempool_bytes"`
+	Blocks          int64     `json:"blocks"`
+	Fullness        float64   `json:"fullness"`
+	Fees            int64     `json:"fees"`
+}
+
+// FeeEstimate is the node's estimatesmartfee answer for one confirmation
+// target, taken in follow mode when the tip was at Height. FeeRate is in
+// sat/vB and Blocks is the target the node actually estimated for, which
+// can be higher than Target when it lacks data.
+type FeeEstimate struct {
+	EstimatedAt time.Time `json:"estimated_at"`
+	Target      int       `json:"target"`
+	Height      int64     `json:"height"`
+	FeeRate     float64   `json:"fee_rate"`
+	Blocks      int       `json:"blocks"`
+}
+
+// FeeEstimateAccuracy compares the estimates for one confirmation target
+// taken in a day with the median fee rate of the block mined next, in
+// sat/vB. Estimates whose next block isn't stored are left out.
+// AboveMedian is the percentage of estimates at or above that median.
+type FeeEstimateAccuracy struct {
+	Day               time.Time `json:"day"`
+	Target            int       `json:"target"`
+	Estimates         int64     `json:"estimates"`
+	AvgEstimate       float64   `json:"avg_estimate"`
+	AvgMedianFeeRate  float64   `json:"avg_median_fee_rate"`
+	MeanAbsoluteError float64   `json:"mean_absolute_error"`
+	AboveMedian       float64   `json:"above_median"`
+}
+
+// NextBlockEstimate summarizes the getblocktemplate answer taken in follow
+// mode: the block the node would mine at Height, its transactions besides
+// the coinbase, their weight and fees in satoshis, and the lowest fee rate
+// among them in sat/vB, the floor to get included, which is zero for an
+// empty template. A parent pulled in by its child's fee (CPFP) can be
+// below the floor it sets.
+type NextBlockEstimate struct {
+	EstimatedAt time.Time `json:"estimated_at"`
+	Height      int64     `json:"height"`
+	TxCount     int64     `json:"tx_count"`
+	Weight      int64     `json:"weight"`
+	TotalFees   int64     `json:"total_fees"`
+	MinFeeRate  float64   `json:"min_fee_rate"`
+}
+
+// NextBlockFees compares, per day, the fees of the mined blocks with those
+// of the last template taken for their height, in satoshis. FeesLeft is
+// TemplateFees minus BlockFees: positive when the miners collected less
+// than the template offered, negative when transactions that arrived after
+// the last template paid more. Blocks without a template are left out.
+type NextBlockFees struct {
+	Day           time.Time `json:"day"`
+	Blocks        int64     `json:"blocks"`
+	TemplateTxs   float64   `json:"avg_template_txs"`
+	BlockTxs      float64   `json:"avg_block_txs"`
+	TemplateFees  int64     `json:"template_fees"`
+	BlockFees     int64     `json:"block_fees"`
+	FeesLeft      int64     `json:"fees_left"`
+	AvgMinFeeRate float64   `json:"avg_min_fee_rate"`
+}
+
+// Run statuses.
+const (
+	RunRunning     = "running"
+	RunCompleted   = "completed"
+	RunFailed      = "failed"
+	RunInterrupted = "interrupted"
+	// RunPartial marks a run stopped early by --max-db-size.
+	RunPartial = "partial"
+	// RunAborted marks a run whose process exited without recording it.
+	RunAborted = "aborted"
+)
+
+// Run is one scrape run recorded in the runs table. Args has the RPC
+// password redacted.
+type Run struct {
+	ID              int64      `json:"run_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+	FromHeight      int64      `json:"from_height"`
+	ToHeight        int64      `json:"to_height"`
+	BlocksProcessed int64      `json:"blocks_processed"`
+	BlocksFailed    int64      `json:"blocks_failed"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	Version         string     `json:"version"`
+	Args            string     `json:"args"`
+	Hostname        string     `json:"hostname"`
+	PID             int        `json:"pid"`
+	// Filters describes the transaction filters of the run, empty without
+	Filters string `json:"filters,omitempty"`
+}
+
+// RunProgress is the latest progress snapshot of a run, from the
+// run_progress table, with the status and range of the run.
+type RunProgress struct {
+	RunID      int64     `json:"run_id"`
+	Processed  int64     `json:"processed"`
+	Failed     int64     `json:"failed"`
+	TotalTxs   int64     `json:"total_txs"`
+	Rate       float64   `json:"rate"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Status     string    `json:"status,omitempty"`
+	FromHeight int64     `json:"from_height,omitempty"`
+	ToHeight   int64     `json:"to_height,omitempty"`
 }
 
 type PriceData struct {
-	Timestamp  time.Time `json:"timestamp"`
-	Price      float64   `json:"price"`
-	MarketCap  int64     `json:"market_cap"`
-	Volume24h  int64     `json:"volume_24h"`
-	Source     string    `json:"source"`
-	FetchedAt  time.Time `json:"fetched_at"`
-}
\ No newline at end of file
+	Timestamp time.Time `json:"timestamp"`
+	Price     float64   `json:"price"`
+	MarketCap int64     `json:"market_cap"`
+	Volume24h int64     `json:"volume_24h"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
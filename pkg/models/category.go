@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// TxCategory is what a transaction most likely does, guessed from its input
+// and output counts by ClassifyTransaction.
+type TxCategory string
+
+const (
+	// TxConsolidation merges many coins into one or two outputs, as
+	// wallets and exchanges do while fees are low.
+	TxConsolidation TxCategory = "consolidation"
+	// TxBatch pays many recipients at once from one or two coins.
+	TxBatch TxCategory = "batch"
+	// TxSimple is the typical payment: one or two coins spent to a
+	// recipient and a change output.
+	TxSimple TxCategory = "simple"
+	// TxOther is everything else, such as sweeps of a single coin to a
+	// single output or coinjoins with many inputs and outputs.
+	TxOther TxCategory = "other"
+)
+
+// TxCategories lists the categories in the order reports show them.
+var TxCategories = []TxCategory{TxConsolidation, TxBatch, TxSimple, TxOther}
+
+// Thresholds of ClassifyTransaction. A transaction with at most FewCoins
+// inputs or outputs has few of them; "many" starts at the minimums.
+const (
+	FewCoins               = 2
+	ConsolidationMinInputs = 3
+	BatchMinOutputs        = 3
+)
+
+// ClassifyTransaction returns the category of a transaction with inCount
+// inputs and outCount outputs:
+//
+//   - TxConsolidation: at least ConsolidationMinInputs inputs and at most
+//     FewCoins outputs
+//   - TxBatch: at most FewCoins inputs and at least BatchMinOutputs outputs
+//   - TxSimple: at most FewCoins inputs and exactly 2 outputs
+//   - TxOther: anything else
+//
+// The counts alone can't tell a payment from a transfer between wallets of
+// the same owner, so these are heuristics.
+func ClassifyTransaction(inCount, outCount int) TxCategory {
+	switch {
+	case inCount >= ConsolidationMinInputs && outCount <= FewCoins:
+		return TxConsolidation
+	case inCount <= FewCoins && outCount >= BatchMinOutputs:
+		return TxBatch
+	case inCount <= FewCoins && outCount == 2:
+		return TxSimple
+	}
+	return TxOther
+}
+
+// TxCategoryDailyStats counts the non-coinbase transactions of each
+// category on one day.
+type TxCategoryDailyStats struct {
+	Day            time.Time `json:"day"`
+	Transactions   int64     `json:"transactions"`
+	Consolidations int64     `json:"consolidations"`
+	Batches        int64     `json:"batches"`
+	Simple         int64     `json:"simple"`
+	Other          int64     `json:"other"`
+}
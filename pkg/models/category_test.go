@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestClassifyTransaction(t *testing.T) {
+	tests := []struct {
+		in, out int
+		want    TxCategory
+	}{
+		{1, 2, TxSimple},
+		{2, 2, TxSimple},
+		{1, 1, TxOther},
+		{2, 1, TxOther},
+		{3, 1, TxConsolidation},
+		{3, 2, TxConsolidation},
+		{50, 1, TxConsolidation},
+		{1, 3, TxBatch},
+		{2, 100, TxBatch},
+		{3, 3, TxOther},
+		{10, 10, TxOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyTransaction(tt.in, tt.out); got != tt.want {
+			t.Errorf("ClassifyTransaction(%d, %d) = %s, want %s", tt.in, tt.out, got, tt.want)
+		}
+	}
+}
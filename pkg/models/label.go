@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Categories of the labels commonly imported. Any other category is kept
+// as imported.
+const (
+	LabelExchange = "exchange"
+	LabelMiner    = "miner"
+	LabelService  = "service"
+	// LabelOther is the category of labels imported without one.
+	LabelOther = "other"
+)
+
+// AddressLabel names the owner of an address, such as "Binance cold
+// wallet", and the category of the owner. The addresses sharing a label
+// make up its cluster.
+type AddressLabel struct {
+	Address  string `json:"address"`
+	Label    string `json:"label"`
+	Category string `json:"category"`
+}
+
+// LabelFlow is the value paid to the addresses of a label and spent from
+// them in one day, in satoshis. Net is Inflow minus Outflow.
+type LabelFlow struct {
+	Day      time.Time `json:"day"`
+	Label    string    `json:"label"`
+	Category string    `json:"category"`
+	Inflow   int64     `json:"inflow"`
+	Outflow  int64     `json:"outflow"`
+	Net      int64     `json:"net"`
+}
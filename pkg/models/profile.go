@@ -0,0 +1,45 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Profile is how much of each block a database stores. Each profile stores
+// everything the previous one does.
+type Profile string
+
+const (
+	// ProfileMinimal stores only the blocks, with their aggregates over
+	// the transactions.
+	ProfileMinimal Profile = "minimal"
+	// ProfileStandard adds the transactions.
+	ProfileStandard Profile = "standard"
+	// ProfileFull adds the inputs, outputs and OP_RETURN payloads, and with
+	// them the address rollups and the fees resolved from the outputs
+	// spent.
+	ProfileFull Profile = "full"
+)
+
+// Profiles lists the profiles from the smallest.
+var Profiles = []Profile{ProfileMinimal, ProfileStandard, ProfileFull}
+
+func ParseProfile(s string) (Profile, error) {
+	if p := Profile(s); slices.Contains(Profiles, p) {
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid profile %q: must be minimal, standard or full", s)
+}
+
+// Includes reports whether p stores everything other stores. The empty
+// profile is ProfileFull.
+func (p Profile) Includes(other Profile) bool {
+	return slices.Index(Profiles, p.orFull()) >= slices.Index(Profiles, other.orFull())
+}
+
+func (p Profile) orFull() Profile {
+	if p == "" {
+		return ProfileFull
+	}
+	return p
+}
@@ -0,0 +1,47 @@
+package models
+
+// HalvingInterval is the number of blocks between subsidy halvings.
+const HalvingInterval = 210000
+
+// SatoshisPerBTC is the number of satoshis in a bitcoin.
+const SatoshisPerBTC = 100000000
+
+// MaxMoney is the most satoshis any amount can hold: the 21 million
+// bitcoins that will ever exist, which no output, transaction or fee can
+// exceed.
+const MaxMoney = 21000000 * SatoshisPerBTC
+
+// InitialSubsidy is the subsidy of the blocks of the first epoch, in
+// satoshis.
+const InitialSubsidy = 50 * SatoshisPerBTC
+
+// HalvingEpoch returns the number of halvings before height.
+func HalvingEpoch(height int64) int64 {
+	return height / HalvingInterval
+}
+
+// SubsidyForHeight returns the new coins a block at height may create, in
+// satoshis. It halves every HalvingInterval blocks, rounding down, until it
+// reaches zero in epoch 33; like Bitcoin Core, it is zero from the 64th
+// halving on rather than shifting further.
+func SubsidyForHeight(height int64) int64 {
+	epoch := HalvingEpoch(height)
+	if height < 0 || epoch >= 64 {
+		return 0
+	}
+	return InitialSubsidy >> epoch
+}
+
+// IssuedSupply returns the coins the blocks up to and including height may
+// have created, in satoshis: the sum of their subsidies.
+func IssuedSupply(height int64) int64 {
+	var supply int64
+	for epoch := int64(0); epoch <= HalvingEpoch(height) && epoch < 64; epoch++ {
+		blocks := int64(HalvingInterval)
+		if epoch == HalvingEpoch(height) {
+			blocks = height - epoch*HalvingInterval + 1
+		}
+		supply += SubsidyForHeight(epoch*HalvingInterval) * blocks
+	}
+	return supply
+}
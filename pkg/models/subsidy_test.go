@@ -0,0 +1,71 @@
+package models
+
+import "testing"
+
+func TestSubsidyForHeight(t *testing.T) {
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{0, 5000000000},
+		{209999, 5000000000},
+		// 2012
+		{210000, 2500000000},
+		{419999, 2500000000},
+		// 2016
+		{420000, 1250000000},
+		{629999, 1250000000},
+		// 2020
+		{630000, 625000000},
+		{839999, 625000000},
+		// 2024
+		{840000, 312500000},
+		{1049999, 312500000},
+		{1050000, 156250000},
+		// The last epoch with a subsidy, where halving 5000000000 for the
+		// 32nd time leaves a single satoshi
+		{32 * HalvingInterval, 1},
+		{33*HalvingInterval - 1, 1},
+		{33 * HalvingInterval, 0},
+		{64 * HalvingInterval, 0},
+		{100 * HalvingInterval, 0},
+		{-1, 0},
+	}
+	for _, tt := range tests {
+		if got := SubsidyForHeight(tt.height); got != tt.want {
+			t.Errorf("SubsidyForHeight(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
+
+// TestTotalSubsidy checks the schedule against the supply cap: the subsidies
+// of all blocks add up to just under 21 million BTC.
+func TestTotalSubsidy(t *testing.T) {
+	var total int64
+	for epoch := int64(0); epoch < 64; epoch++ {
+		total += SubsidyForHeight(epoch*HalvingInterval) * HalvingInterval
+	}
+	if want := int64(2099999997690000); total != want {
+		t.Errorf("total subsidy = %d, want %d", total, want)
+	}
+}
+
+func TestIssuedSupply(t *testing.T) {
+	tests := []struct {
+		height int64
+		want   int64
+	}{
+		{-1, 0},
+		{0, 5000000000},
+		{209999, 210000 * 5000000000},
+		{210000, 210000*5000000000 + 2500000000},
+		{840000, 1968750000000000 + 312500000},
+		{64 * HalvingInterval, 2099999997690000},
+		{100 * HalvingInterval, 2099999997690000},
+	}
+	for _, tt := range tests {
+		if got := IssuedSupply(tt.height); got != tt.want {
+			t.Errorf("IssuedSupply(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+	}
+}
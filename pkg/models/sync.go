@@ -0,0 +1,27 @@
+package models
+
+// SyncBlock is a block of the source database that scrapbtc sync copies.
+type SyncBlock struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+	// Replace is set when the destination stores another block, or only
+	// the header, at the height, which is deleted first.
+	Replace bool `json:"replace,omitempty"`
+}
+
+// SyncConflict is a height at which the source and the destination stored
+// different blocks.
+type SyncConflict struct {
+	Height     int64  `json:"height"`
+	SourceHash string `json:"source_hash"`
+	DestHash   string `json:"dest_hash"`
+}
+
+// SyncPlan is what scrapbtc sync copies: the blocks completed in the source
+// and missing in the destination, in height order, and the conflicts.
+type SyncPlan struct {
+	Blocks    []*SyncBlock    `json:"blocks"`
+	Conflicts []*SyncConflict `json:"conflicts"`
+	// SourceProfile is the profile the source is scraped with, if recorded.
+	SourceProfile string `json:"source_profile,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Times are kept in UTC, as the databases store them, so that a model
+// prints the same wherever it was created and days are UTC days whether
+// they are cut in SQL or in Go.
+
+// Now returns the current time in UTC.
+func Now() time.Time {
+	return time.Now().UTC()
+}
+
+// UnixTime returns the UTC time of a unix timestamp in seconds, such as a
+// block header time.
+func UnixTime(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Direction is whether a watched address received or spent coins.
+type Direction string
+
+const (
+	// DirectionIn is an output paying a watched address.
+	DirectionIn Direction = "in"
+	// DirectionOut is an input spending an output of a watched address.
+	DirectionOut Direction = "out"
+)
+
+// WatchedActivity is an output paying a watched address or an input
+// spending one of its outputs. N is the index of the output or input in
+// the transaction.
+type WatchedActivity struct {
+	Address     string    `json:"address"`
+	Txid        string    `json:"txid"`
+	N           uint32    `json:"n"`
+	Direction   Direction `json:"direction"`
+	Value       int64     `json:"value"`
+	BlockHash   string    `json:"block_hash"`
+	BlockHeight int64     `json:"block_height"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// WatchlistDailyStats sums the activity of one watched address in one day,
+// in satoshis.
+type WatchlistDailyStats struct {
+	Day      time.Time `json:"day"`
+	Address  string    `json:"address"`
+	Label    string    `json:"label,omitempty"`
+	Inflows  int64     `json:"inflows"`
+	Received int64     `json:"received"`
+	Outflows int64     `json:"outflows"`
+	Sent     int64     `json:"sent"`
+}